@@ -0,0 +1,5 @@
+package main
+
+// 在这里以空导入的方式编译进自定义插件 (见 pkg/plugin)，例如:
+//
+//	import _ "example.com/my/pgmcp-plugins/billing"
@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// 审计记录的种类
+const (
+	KindToolCall  = "tool_call" // 一次 MCP 工具调用 (来自传输层，带客户端身份)
+	KindStatement = "statement" // 数据库服务执行的一条语句 (包括工具内部生成的 SQL)
+)
+
+// 审计记录的存储方式
+const (
+	SinkFile  = "file"  // JSONL 文件，按大小轮转
+	SinkTable = "table" // 专用数据库中的审计表
+)
+
+// maxValueLength 是参数中单个字符串值写入审计记录的最大长度，超出部分被截断 (例如内联的 CSV 内容)
+const maxValueLength = 4096
+
+// Entry 是一条审计记录
+type Entry struct {
+	Timestamp     time.Time      `json:"timestamp"`                // 开始时间
+	Kind          string         `json:"kind"`                     // tool_call 或 statement
+	SessionID     string         `json:"session_id,omitempty"`     // MCP 会话 ID (仅 tool_call)
+	ClientName    string         `json:"client_name,omitempty"`    // initialize 时上报的客户端名称 (仅 tool_call)
+	ClientVersion string         `json:"client_version,omitempty"` // initialize 时上报的客户端版本 (仅 tool_call)
+	ConnID        string         `json:"conn_id,omitempty"`        // 目标连接 ID
+	Tool          string         `json:"tool,omitempty"`           // 工具名称 (仅 tool_call)
+	SQL           string         `json:"sql,omitempty"`            // 执行的 SQL (tool_call 时取自参数中的 query/sql)
+	Params        any            `json:"params,omitempty"`         // 语句参数或工具的其他调用参数
+	Rows          *int64         `json:"rows,omitempty"`           // 返回或影响的行数，无法确定时为空
+	DurationMs    int64          `json:"duration_ms"`              // 执行时长 (毫秒)
+	Error         string         `json:"error,omitempty"`          // 失败时的错误信息
+	Extra         map[string]any `json:"extra,omitempty"`          // 其他信息
+}
+
+// Recorder 保存审计记录。实现必须可以并发调用，且不能因为审计失败而阻塞或中断业务请求。
+type Recorder interface {
+	// Record 保存一条审计记录
+	Record(entry Entry)
+	// Close 刷新并关闭底层存储
+	Close() error
+}
+
+// New 按配置创建 Recorder；未开启审计时返回不做任何事的 Recorder。
+func New(ctx context.Context, cfg *config.Config) (Recorder, error) {
+	if !cfg.AuditEnabled {
+		return Nop(), nil
+	}
+	switch strings.ToLower(cfg.AuditSink) {
+	case SinkFile, "":
+		recorder, err := newFileRecorder(cfg.AuditFile, int64(cfg.AuditMaxSizeMB)<<20, cfg.AuditMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		utils.DefaultLogger.Info("审计日志已启用", zap.String("sink", SinkFile), zap.String("file", cfg.AuditFile), zap.Int("maxSizeMB", cfg.AuditMaxSizeMB), zap.Int("maxBackups", cfg.AuditMaxBackups))
+		return recorder, nil
+	case SinkTable:
+		recorder, err := newTableRecorder(ctx, cfg.AuditDBURL, cfg.AuditTable)
+		if err != nil {
+			return nil, err
+		}
+		utils.DefaultLogger.Info("审计日志已启用", zap.String("sink", SinkTable), zap.String("table", cfg.AuditTable))
+		return recorder, nil
+	default:
+		return nil, fmt.Errorf("不支持的 AUDIT_SINK '%s' (可选 file, table)", cfg.AuditSink)
+	}
+}
+
+// Nop 返回丢弃所有记录的 Recorder
+func Nop() Recorder {
+	return nopRecorder{}
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) Record(Entry) {}
+
+func (nopRecorder) Close() error { return nil }
+
+// Enabled 判断 Recorder 是否会真正保存记录 (用于跳过构造记录的开销)
+func Enabled(recorder Recorder) bool {
+	if recorder == nil {
+		return false
+	}
+	_, nop := recorder.(nopRecorder)
+	return !nop
+}
+
+// RowCount 将行数转换为记录中使用的指针形式
+func RowCount(rows int64) *int64 {
+	return &rows
+}
+
+// truncateValues 复制参数并截断过长的字符串值
+func truncateValues(value any) any {
+	switch v := value.(type) {
+	case string:
+		if len(v) > maxValueLength {
+			return v[:maxValueLength] + fmt.Sprintf("...(已截断，共 %d 字节)", len(v))
+		}
+		return v
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = truncateValues(item)
+		}
+		return result
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[key] = truncateValues(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// StatementParams 将语句参数转换为可序列化的审计记录内容
+func StatementParams(args []any) any {
+	if len(args) == 0 {
+		return nil
+	}
+	params := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case []byte:
+			params[i] = fmt.Sprintf("<%d 字节的二进制数据>", len(v))
+		case string, bool, nil, int, int32, int64, float32, float64, []string, []any, map[string]any:
+			params[i] = truncateValues(v)
+		default:
+			params[i] = truncateValues(fmt.Sprint(v))
+		}
+	}
+	return params
+}
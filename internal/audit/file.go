@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// fileRecorder 将审计记录以 JSONL 格式追加到文件，文件超过 maxBytes 时轮转:
+// audit.jsonl -> audit.jsonl.1 -> audit.jsonl.2 ...，最多保留 maxBackups 个旧文件。
+type fileRecorder struct {
+	path string
+	file *utils.RotatingFile
+}
+
+func newFileRecorder(path string, maxBytes int64, maxBackups int) (*fileRecorder, error) {
+	if path == "" {
+		return nil, fmt.Errorf("审计日志文件路径 (AUDIT_FILE) 不能为空")
+	}
+	file, err := utils.OpenRotatingFile(path, maxBytes, maxBackups, 0)
+	if err != nil {
+		return nil, fmt.Errorf("打开审计日志文件失败: %w", err)
+	}
+	return &fileRecorder{path: path, file: file}, nil
+}
+
+// Record 实现 Recorder 接口。
+func (r *fileRecorder) Record(entry Entry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		utils.DefaultLogger.Error("序列化审计记录失败", zap.String("kind", entry.Kind), zap.Error(err))
+		return
+	}
+	// 一条记录一次写入，RotatingFile 保证记录不会被拆分到两个文件中
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		utils.DefaultLogger.Error("写入审计日志失败", zap.String("file", r.path), zap.Error(err))
+	}
+}
+
+// Close 实现 Recorder 接口。
+func (r *fileRecorder) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,167 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// tableBufferSize 是等待写入审计表的记录数上限，写入跟不上时新记录被丢弃并记录警告
+const tableBufferSize = 1024
+
+// tableWriteTimeout 是单条审计记录写入的超时时间
+const tableWriteTimeout = 5 * time.Second
+
+// tableRecorder 将审计记录异步写入专用数据库中的审计表。
+// 审计库使用独立的连接池 (AUDIT_DB_URL)，与被审计的连接分开，只读连接也能被审计。
+type tableRecorder struct {
+	pool      *pgxpool.Pool
+	insertSQL string
+	entries   chan Entry
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newTableRecorder(ctx context.Context, connString, table string) (*tableRecorder, error) {
+	if connString == "" {
+		return nil, fmt.Errorf("AUDIT_SINK=table 时必须配置 AUDIT_DB_URL")
+	}
+	qualifiedTable, err := quoteQualifiedName(table)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pgxpool.New(ctx, connString)
+	if err != nil {
+		return nil, fmt.Errorf("连接审计数据库失败: %w", err)
+	}
+	createSQL := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id bigserial PRIMARY KEY,
+		ts timestamptz NOT NULL,
+		kind text NOT NULL,
+		session_id text,
+		client_name text,
+		client_version text,
+		conn_id text,
+		tool text,
+		sql text,
+		params jsonb,
+		rows bigint,
+		duration_ms bigint NOT NULL,
+		error text,
+		extra jsonb
+	)`, qualifiedTable)
+	if _, err := pool.Exec(ctx, createSQL); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("创建审计表 %s 失败: %w", table, err)
+	}
+
+	r := &tableRecorder{
+		pool: pool,
+		insertSQL: fmt.Sprintf(`INSERT INTO %s (ts, kind, session_id, client_name, client_version, conn_id, tool, sql, params, rows, duration_ms, error, extra)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`, qualifiedTable),
+		entries: make(chan Entry, tableBufferSize),
+		done:    make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// Record 实现 Recorder 接口。记录进入缓冲队列后立即返回。
+func (r *tableRecorder) Record(entry Entry) {
+	defer func() {
+		// Close 之后的记录直接丢弃
+		_ = recover()
+	}()
+	select {
+	case r.entries <- entry:
+	default:
+		utils.DefaultLogger.Warn("审计表写入队列已满，丢弃审计记录", zap.String("kind", entry.Kind), zap.String("connID", entry.ConnID), zap.String("tool", entry.Tool))
+	}
+}
+
+// run 在后台逐条写入审计记录，直到队列关闭
+func (r *tableRecorder) run() {
+	defer close(r.done)
+	for entry := range r.entries {
+		r.insert(entry)
+	}
+}
+
+func (r *tableRecorder) insert(entry Entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), tableWriteTimeout)
+	defer cancel()
+	params, err := jsonOrNil(entry.Params)
+	if err != nil {
+		utils.DefaultLogger.Warn("序列化审计记录参数失败", zap.Error(err))
+	}
+	extra, err := jsonOrNil(entry.Extra)
+	if err != nil {
+		utils.DefaultLogger.Warn("序列化审计记录附加信息失败", zap.Error(err))
+	}
+	_, err = r.pool.Exec(ctx, r.insertSQL,
+		entry.Timestamp, entry.Kind, nullIfEmpty(entry.SessionID), nullIfEmpty(entry.ClientName), nullIfEmpty(entry.ClientVersion),
+		nullIfEmpty(entry.ConnID), nullIfEmpty(entry.Tool), nullIfEmpty(entry.SQL), params, entry.Rows, entry.DurationMs,
+		nullIfEmpty(entry.Error), extra)
+	if err != nil {
+		utils.DefaultLogger.Error("写入审计表失败", zap.String("kind", entry.Kind), zap.String("connID", entry.ConnID), zap.Error(err))
+	}
+}
+
+// Close 实现 Recorder 接口。等待队列中的记录写完后关闭连接池。
+func (r *tableRecorder) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.entries)
+		<-r.done
+		r.pool.Close()
+	})
+	return nil
+}
+
+// quoteQualifiedName 为 schema.table 形式的名称的每一部分加引号
+func quoteQualifiedName(name string) (string, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 || name == "" {
+		return "", fmt.Errorf("无效的审计表名 '%s' (格式为 [schema.]table)", name)
+	}
+	for i, part := range parts {
+		if part == "" {
+			return "", fmt.Errorf("无效的审计表名 '%s' (格式为 [schema.]table)", name)
+		}
+		quoted, err := sqlsafe.QuoteIdentifier(part)
+		if err != nil {
+			return "", fmt.Errorf("无效的审计表名 '%s': %w", name, err)
+		}
+		parts[i] = quoted
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// jsonOrNil 将值序列化为 JSON 文本，值为空时返回 nil (写入 NULL)
+func jsonOrNil(value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if m, ok := value.(map[string]any); ok && len(m) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func nullIfEmpty(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
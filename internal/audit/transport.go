@@ -0,0 +1,219 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
+)
+
+// sqlArgumentNames 是工具参数中被视为 SQL 文本的字段
+var sqlArgumentNames = []string{"query", "sql"}
+
+// pendingCall 是等待响应的工具调用
+type pendingCall struct {
+	entry   Entry
+	started time.Time
+}
+
+// client 是会话在 initialize 时上报的客户端信息
+type client struct {
+	name    string
+	version string
+}
+
+// transportAuditor 在传输层观察 tools/call 请求和响应，为每次工具调用生成一条审计记录。
+// go-mcp 不会把会话信息传给 Handler，客户端身份只能在传输层获得 (与 sessions.Tracker 相同)。
+type transportAuditor struct {
+	transport.ServerTransport
+	recorder Recorder
+
+	mu      sync.Mutex
+	clients map[string]client       // sessionID -> 客户端信息
+	pending map[string]*pendingCall // sessionID + 请求 ID -> 调用
+}
+
+// WrapTransport 返回一个包装后的传输层，每次工具调用完成时向 recorder 写入一条 tool_call 记录。
+// 未开启审计时直接返回原传输层。
+func WrapTransport(recorder Recorder, inner transport.ServerTransport) transport.ServerTransport {
+	if !Enabled(recorder) {
+		return inner
+	}
+	return &transportAuditor{
+		ServerTransport: inner,
+		recorder:        recorder,
+		clients:         make(map[string]client),
+		pending:         make(map[string]*pendingCall),
+	}
+}
+
+// rpcMessage 是审计所需的 JSON-RPC 消息字段
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// onReceive 记录 initialize 上报的客户端信息和 tools/call 请求
+func (t *transportAuditor) onReceive(sessionID string, msg []byte) {
+	var message rpcMessage
+	if err := json.Unmarshal(msg, &message); err != nil || message.Method == "" {
+		return
+	}
+	switch protocol.Method(message.Method) {
+	case protocol.Initialize:
+		var params protocol.InitializeRequest
+		if err := json.Unmarshal(message.Params, &params); err == nil {
+			t.mu.Lock()
+			t.clients[sessionID] = client{name: params.ClientInfo.Name, version: params.ClientInfo.Version}
+			t.mu.Unlock()
+		}
+	case protocol.ToolsCall:
+		if len(message.ID) == 0 {
+			return
+		}
+		var params struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return
+		}
+		entry := Entry{Kind: KindToolCall, SessionID: sessionID, Tool: params.Name}
+		entry.ConnID, _ = params.Arguments["conn_id"].(string)
+		others := make(map[string]any, len(params.Arguments))
+		for name, value := range params.Arguments {
+			if name == "conn_id" {
+				continue
+			}
+			if sql, ok := value.(string); ok && entry.SQL == "" && isSQLArgument(name) {
+				entry.SQL = sql
+				continue
+			}
+			others[name] = truncateValues(value)
+		}
+		if len(others) > 0 {
+			entry.Params = others
+		}
+
+		t.mu.Lock()
+		if c, ok := t.clients[sessionID]; ok {
+			entry.ClientName, entry.ClientVersion = c.name, c.version
+		}
+		started := time.Now()
+		entry.Timestamp = started
+		t.pending[sessionID+"/"+string(message.ID)] = &pendingCall{entry: entry, started: started}
+		t.mu.Unlock()
+	}
+}
+
+// onSend 在工具调用的响应发出时补全结果信息并写入审计记录
+func (t *transportAuditor) onSend(sessionID string, msg []byte, sendErr error) {
+	if errors.Is(sendErr, pkg.ErrLackSession) {
+		// 客户端已断开，不再需要它的客户端信息
+		t.mu.Lock()
+		delete(t.clients, sessionID)
+		t.mu.Unlock()
+	}
+	var message rpcMessage
+	if err := json.Unmarshal(msg, &message); err != nil || message.Method != "" || len(message.ID) == 0 {
+		return
+	}
+	key := sessionID + "/" + string(message.ID)
+	t.mu.Lock()
+	call, ok := t.pending[key]
+	delete(t.pending, key)
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	entry := call.entry
+	entry.DurationMs = time.Since(call.started).Milliseconds()
+	switch {
+	case message.Error != nil:
+		entry.Error = message.Error.Message
+	default:
+		var result protocol.CallToolResult
+		if err := json.Unmarshal(message.Result, &result); err == nil {
+			text := firstText(result)
+			if result.IsError {
+				entry.Error = text
+			} else if rows, ok := resultRowCount(text); ok {
+				entry.Rows = RowCount(rows)
+			}
+		}
+	}
+	if sendErr != nil {
+		entry.Extra = map[string]any{"send_error": sendErr.Error()}
+	}
+	t.recorder.Record(entry)
+}
+
+// isSQLArgument 判断参数名是否为 SQL 文本
+func isSQLArgument(name string) bool {
+	for _, candidate := range sqlArgumentNames {
+		if name == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// firstText 返回结果中第一个文本内容块
+func firstText(result protocol.CallToolResult) string {
+	for _, content := range result.Content {
+		if text, ok := content.(protocol.TextContent); ok {
+			return text.Text
+		}
+	}
+	return ""
+}
+
+// resultRowCount 尽量从 JSON 结果中得到行数: 顶层数组的长度，或对象中的 row_count / rows 字段
+func resultRowCount(text string) (int64, bool) {
+	var rows []json.RawMessage
+	if err := json.Unmarshal([]byte(text), &rows); err == nil {
+		return int64(len(rows)), true
+	}
+	var object struct {
+		RowCount *int64           `json:"row_count"`
+		Rows     *json.RawMessage `json:"rows"`
+	}
+	if err := json.Unmarshal([]byte(text), &object); err != nil {
+		return 0, false
+	}
+	if object.RowCount != nil {
+		return *object.RowCount, true
+	}
+	if object.Rows != nil {
+		if err := json.Unmarshal(*object.Rows, &rows); err == nil {
+			return int64(len(rows)), true
+		}
+	}
+	return 0, false
+}
+
+// Send 实现 transport.ServerTransport 接口。
+func (t *transportAuditor) Send(ctx context.Context, sessionID string, msg transport.Message) error {
+	err := t.ServerTransport.Send(ctx, sessionID, msg)
+	t.onSend(sessionID, msg, err)
+	return err
+}
+
+// SetReceiver 实现 transport.ServerTransport 接口。
+func (t *transportAuditor) SetReceiver(receiver transport.ServerReceiver) {
+	t.ServerTransport.SetReceiver(transport.ServerReceiverF(func(ctx context.Context, sessionID string, msg []byte) error {
+		t.onReceive(sessionID, msg)
+		return receiver.Receive(ctx, sessionID, msg)
+	}))
+}
@@ -0,0 +1,79 @@
+// Package buildinfo 保存构建时注入的版本信息。
+//
+// 构建时通过 ldflags 设置:
+//
+//	go build -ldflags "-X github.com/cbc3929/pg_mcp_server/internal/buildinfo.Version=1.2.0 \
+//	    -X github.com/cbc3929/pg_mcp_server/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//	    -X github.com/cbc3929/pg_mcp_server/internal/buildinfo.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/server
+//
+// 未注入 Commit / BuildDate 时使用 Go 工具链记录的 VCS 信息 (vcs.revision / vcs.time)。
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// 由 ldflags 注入的构建信息
+var (
+	Version   = "0.1.0"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info 是服务器的构建信息
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Modified  bool   `json:"modified,omitempty"` // 构建时工作区有未提交的修改 (仅在使用 VCS 信息时可知)
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get 返回构建信息，ldflags 未注入的字段从 debug.ReadBuildInfo 的 VCS 信息补齐。
+func Get() Info {
+	once.Do(func() {
+		info = Info{Version: Version, Commit: Commit, BuildDate: BuildDate, GoVersion: runtime.Version()}
+		build, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	})
+	return info
+}
+
+// ShortCommit 返回 12 位的提交哈希
+func (i Info) ShortCommit() string {
+	if len(i.Commit) > 12 {
+		return i.Commit[:12]
+	}
+	return i.Commit
+}
+
+// DisplayVersion 返回带提交哈希的版本号 (语义化版本的构建元数据形式，例如 1.2.0+3f2a9c1d0b7e)
+func (i Info) DisplayVersion() string {
+	if commit := i.ShortCommit(); commit != "" {
+		return i.Version + "+" + commit
+	}
+	return i.Version
+}
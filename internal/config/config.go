@@ -3,7 +3,8 @@ package config
 import (
 	"os"      // 用于读取环境变量
 	"strconv" // 用于将字符串转换为数字等
-	"time"    // 用于时间相关的配置，如超时
+	"strings"
+	"time" // 用于时间相关的配置，如超时
 
 	"github.com/cbc3929/pg_mcp_server/internal/utils"
 	"github.com/joho/godotenv" // 用于加载 .env 文件
@@ -12,16 +13,142 @@ import (
 
 // Config 结构体定义了应用的所有配置项
 type Config struct {
-	IsDebug       bool   // 是否是debug模式
-	ServerAddr    string // MCP 服务器监听地址 (例如: ":8181")
-	LogLevel      string // 日志级别 (例如: "debug", "info", "warn", "error")
-	ExtensionsDir string // 存放扩展知识 YAML 文件的目录路径
+	IsDebug         bool          // 是否是debug模式
+	ServerAddr      string        // MCP 服务器监听地址 (例如: ":8181")
+	ShutdownTimeout time.Duration // 收到退出信号后等待进行中的工具调用完成的最长时间，超时后取消剩余查询
+	ServerName      string        // initialize 响应 serverInfo 中的服务器名称
+	StartupBanner   bool          // 启动时是否在日志中输出版本、提交和已启用功能的横幅
+	ServerInfoMeta  bool          // initialize 响应的 serverInfo 中是否附带提交、构建时间、功能开关和已连接数据库的指纹
+	ProtocolCompat  bool          // 是否接受 go-mcp 实现的协议版本以外的 MCP 协议版本，并按客户端版本转换内容编码
+	LogLevel        string        // 日志级别 (例如: "debug", "info", "warn", "error")
+	LogFormat       string        // 日志编码格式: console 或 json (默认 debug 模式为 console，否则为 json)
+	LogFile         string        // 日志文件路径，为空时输出到标准输出
+	LogMaxSizeMB    int           // 日志文件超过该大小 (MB) 时轮转，0 表示不轮转
+	LogMaxBackups   int           // 轮转后保留的旧日志文件个数
+	LogMaxAgeDays   int           // 旧日志文件保留的天数，0 表示不按时间清理
+	ExtensionsDir   string        // 存放扩展知识 YAML 文件的目录路径
+	ExtensionsWatch bool          // 是否监听扩展知识目录，文件变化时自动重新加载
+	// --- 远程扩展知识来源 (HTTP(S) 或 git) ---
+	ExtensionsRemoteURL       string        // 远程扩展知识来源: HTTP(S) 地址 (单个 YAML 文件或 .tar.gz 知识包) 或 git 仓库，为空时不使用
+	ExtensionsRemoteRef       string        // git 来源的分支、标签或完整的提交哈希 (固定版本)，为空时使用远程仓库的默认分支
+	ExtensionsRemotePath      string        // git 来源中存放 YAML 文件的子目录，为空时使用仓库根目录
+	ExtensionsRemoteToken     string        // HTTP(S) 来源的 Bearer token，为空时不发送 Authorization
+	ExtensionsRemoteSHA256    string        // HTTP(S) 来源内容的 SHA-256 (十六进制)，不为空时内容不一致则拒绝
+	ExtensionsRemotePublicKey string        // 校验 HTTP(S) 来源签名 (<url>.sig) 或 git 来源标签/提交 SSH 签名的 Ed25519 公钥 (base64)，为空时不校验签名
+	ExtensionsRemoteCacheDir  string        // 远程知识的本地缓存目录 (保存下载内容、ETag 和 git 工作区)
+	ExtensionsRemoteRefresh   time.Duration // 重新获取远程知识的间隔，0 表示只在启动时获取
 	// --- 数据库相关配置 ---
-	DBConnMaxLifetime time.Duration // 连接池中连接的最大生命周期
-	DBConnMaxIdleTime time.Duration // 连接池中连接的最大空闲时间
-	DBMaxOpenConns    int           // 连接池最大打开连接数
-	DBMinOpenConns    int           // 连接池最小空闲连接数
-
+	DBConnMaxLifetime  time.Duration // 连接池中连接的最大生命周期
+	DBConnMaxIdleTime  time.Duration // 连接池中连接的最大空闲时间
+	DBMaxOpenConns     int           // 连接池最大打开连接数
+	DBMinOpenConns     int           // 连接池最小空闲连接数
+	DBDialTimeout      time.Duration // 建立单个数据库连接 (TCP + TLS + 认证) 的超时，连接字符串中的 connect_timeout 优先
+	DBStatementTimeout time.Duration // 服务端 statement_timeout，限制单条语句的执行时间，0 表示不限制，连接字符串中的设置优先
+	DBAcquireTimeout   time.Duration // 从连接池获取连接的最长等待时间 (连接池已满时)，0 表示只受请求超时限制
+	DBPoolIdleEvict    time.Duration // connID 空闲 (没有查询) 超过该时长时关闭其连接池，下次使用时重建，0 表示不关闭
+	DBConnTTL          time.Duration // connID 空闲超过该时长时移除，需要重新 connect，0 表示永不过期
+	DBSSLMode          string        // 连接字符串和 connect 均未指定 sslmode 时使用的默认值，为空时沿用 libpq 默认 (prefer)
+	DBSSLRootCert      string        // 默认的 CA 证书文件 (sslrootcert)，用于 verify-ca / verify-full 校验服务器证书
+	DBSSLCert          string        // 默认的客户端证书文件 (sslcert)，与 DBSSLKey 一起使用
+	DBSSLKey           string        // 默认的客户端私钥文件 (sslkey)
+	DBTLSCertDir       string        // connect 传入的 sslrootcert / sslcert / sslkey 必须位于该目录下，为空时不允许 connect 指定证书文件
+	ListenMaxChannels  int           // pg_listen 同时监听的频道数上限 (每个频道占用一条专用连接)，0 表示不限制
+	ListenBufferSize   int           // 每个监听频道在内存中保留的通知条数，超出时丢弃最旧的通知
+	TxIdleTimeout      time.Duration // tx_begin 开启的事务会话空闲超过该时长时自动回滚，0 表示不限制
+	TxMaxDuration      time.Duration // 事务会话从开始起的最长持续时间，超过后自动回滚，0 表示不限制
+	TxMaxSessions      int           // 每个 connID 同时打开的事务会话数上限 (每个会话占用一条连接)，0 表示不限制
+	// --- 结果缓存配置 ---
+	ResultCacheTTL      time.Duration // 只读查询结果的缓存时长，0 表示不缓存
+	ResultCacheMaxBytes int64         // 结果缓存的容量上限 (按结果的 JSON 大小估算)，超出时淘汰最久未使用的结果
+	// --- 响应预算配置 ---
+	ResponseMaxBytes int // pg_query 编码后结果的默认字节预算，超出时只返回前 N 行和逐列统计，0 表示不限制
+	// --- 长查询监控配置 ---
+	QueryAlertThreshold   time.Duration // 查询执行超过该时长时发送告警，0 表示不告警
+	QueryHardLimit        time.Duration // 查询执行超过该时长时自动取消，0 表示不取消
+	QueryWatchdogInterval time.Duration // 长查询检查间隔
+	QueryAlertWebhookURL  string        // 告警 Webhook 地址 (兼容 Slack Incoming Webhook)，为空时只写日志
+	QueryLogSize          int           // 内存中保留的最近查询历史条数，0 表示不保留
+	// --- Schema 加载相关配置 ---
+	SchemaIncludePostGISObjects bool          // 是否加载 PostGIS 的 topology Schema 以及栅格 (raster) 列元数据
+	SchemaLoadParallelism       int           // 加载 Schema 时并发加载的 Schema 数 (不超过 DB_MAX_OPEN_CONNS)
+	SchemaCacheDir              string        // 持久化 Schema 缓存的目录，启动时先从文件恢复再在后台刷新；为空时不持久化
+	SchemaSummaryTokenBudget    int           // Schema 摘要资源的默认 token 预算
+	SchemaResourcePageSize      int           // resources/list 每页列出的 Schema 对象资源数，0 表示不列出 Schema 对象
+	SchemaRetrievalEmbeddings   string        // relevant_schema 等工具使用的嵌入方式: local (本地哈希嵌入), endpoint (嵌入服务) 或 off (只按关键字排序)
+	EmbeddingEndpointURL        string        // 兼容 OpenAI /v1/embeddings 的嵌入服务地址 (embedding 方式为 endpoint 时使用)
+	EmbeddingModel              string        // 嵌入模型名称
+	EmbeddingAPIKey             string        // 嵌入服务的 API Key (可选)
+	EmbeddingBatchSize          int           // 每次请求嵌入服务的文本数
+	EmbeddingTimeout            time.Duration // 单次嵌入请求的超时
+	EmbeddingIndexFile          string        // 嵌入索引的持久化文件，为空时只保存在内存中
+	// --- 查询相关配置 ---
+	PaginationOrderMode    string   // 分页查询缺少 ORDER BY 时的处理: off, warn, fix (自动按主键排序)
+	SelectStarRewrite      bool     // 是否把单表 SELECT * 改写为省略大字段列的显式列列表
+	SelectStarExcludeTypes []string // SELECT * 改写时省略的列类型，为空时使用默认列表
+	// --- 导出相关配置 ---
+	ExportDir      string // export_query 导出文件的目录
+	ExportBaseURL  string // 导出目录对外访问的 URL 前缀 (例如静态文件服务或对象存储网关)，为空时只返回文件路径
+	ExportMaxBytes int64  // 单个导出文件的大小上限 (字节)，0 表示不限制
+	ImportDir      string // import_csv_temp 允许读取 CSV 文件的目录，为空时只接受内联的 csv_content
+	ToolPacksDir   string // 工具包 (YAML 定义的自定义工具) 所在目录，为空时不加载
+	StateBackupDir string // export_state/import_state 读写服务器状态归档的目录，为空时不注册这两个工具
+	// --- 命名查询和查询模板配置 ---
+	NamedQueriesPath       string // 命名查询注册表的持久化文件路径，为空时只保存在内存中
+	NamedQueryRegistration bool   // 是否注册 register_query 工具 (默认关闭)，关闭时只能运行注册表文件中已有的命名查询
+	QueryTemplatesDir      string // 存放查询模板库 YAML 文件的目录路径，目录不存在时不加载模板
+	// --- 执行计划历史配置 ---
+	PlanStorePath           string  // 执行计划历史的持久化文件路径，为空时只保存在内存中
+	PlanRegressionCostRatio float64 // 估算成本上升超过该倍数时视为计划回归
+	// --- 写入相关配置 ---
+	WriteReviewMode           bool          // 写入工具是否需要操作员通过审核接口批准后才执行
+	WriteReviewAddr           string        // 操作员审核接口 (HTTP) 的监听地址，与 MCP 地址分开，为空时不启动
+	WriteReviewToken          string        // 审核接口的 Bearer token，不能提供给 MCP 客户端
+	WriteReviewTTL            time.Duration // 待审核写入的有效期，超过后不再执行，0 表示不过期
+	WriteReviewMaxPending     int           // 同时等待审核的写入数上限，超过时拒绝新的写入，0 表示不限制
+	IdempotencyPendingTTL     time.Duration // 幂等键执行中状态的有效期，超过后可以被同一个键的新请求接管，0 表示不过期
+	AllowReadWriteConnections bool          // 是否允许 connect 以 read_write 模式注册连接，关闭时所有连接只读
+	AllowRawConnectionStrings bool          // 是否允许 connect 直接传入连接字符串或结构化连接参数中的密码，关闭时只能使用命名凭据 (database 或 credential_ref 参数)
+	ConnectAllowHosts         []string      // connect 允许客户端指定的数据库主机和跳板机 (支持 * 通配符和 CIDR，同时检查 DNS 解析结果)，为空表示不限制
+	ConnectDenyHosts          []string      // connect 禁止客户端指定的数据库主机和跳板机 (支持 * 通配符和 CIDR，同时检查 DNS 解析结果)，例如 production-master
+	CredentialsFile           string        // 命名凭据 YAML 文件 (名称 -> 连接字符串/密码来源)，为空时不使用
+	CredentialsDir            string        // 命名凭据 Secret 目录 (每个文件名为凭据名称，内容为连接字符串)，为空时不使用
+	// --- 凭据提供者 (命名凭据 provider: vault / aws) ---
+	VaultAddr                  string        // Vault 地址，为空时不启用 Vault 提供者
+	VaultToken                 string        // Vault token
+	VaultTokenFile             string        // Vault token 文件 (例如 Vault Agent 的 sink)，每次请求时读取，优先于 VaultToken
+	VaultNamespace             string        // Vault Enterprise 命名空间
+	AWSRegion                  string        // AWS 区域，为空时不启用 AWS Secrets Manager 提供者
+	AWSAccessKeyID             string        // AWS 访问密钥 ID
+	AWSSecretAccessKey         string        // AWS 访问密钥
+	AWSSessionToken            string        // (可选) 临时凭证的会话 token
+	AWSSecretsManagerEndpoint  string        // (可选) Secrets Manager 端点 (例如 VPC 端点或 LocalStack)
+	CredentialRotationInterval time.Duration // 检查 Secret 版本的间隔，版本变化时重建连接池，0 表示不检查
+	ReplicaHealthCheckInterval time.Duration // 只读副本健康检查间隔，失败的副本移出路由、恢复后重新加入，0 表示不检查
+	// --- SSH 隧道 (经跳板机访问数据库) ---
+	SSHKnownHostsFile        string   // 校验跳板机主机密钥的 known_hosts 文件，为空时使用 ~/.ssh/known_hosts
+	SSHInsecureIgnoreHostKey bool     // 是否跳过跳板机主机密钥校验 (仅用于测试环境)
+	SSHKeyDir                string   // connect 传入的 ssh_key_path 必须位于该目录下，为空时不允许 connect 指定私钥文件
+	ProcedureAllowlist       []string // call_procedure 允许调用的存储过程 (schema.procedure，支持 * 通配符)，为空时禁止调用
+	// --- 访问策略 (对所有连接生效，connect 可以追加连接级别的规则) ---
+	AllowSchemas []string // 允许访问的 Schema，为空表示不限制
+	DenySchemas  []string // 禁止访问的 Schema
+	AllowTables  []string // 允许访问的表 (schema.table，支持 * 通配符)
+	DenyTables   []string // 禁止访问的表 (schema.table，支持 * 通配符)，例如敏感的用户凭据表
+	// --- 数据脱敏 ---
+	MaskedColumns []string // 需要脱敏的列 (schema.table.column[:full|partial|hash])
+	// --- 审计日志 ---
+	AuditEnabled    bool   // 是否记录审计日志 (每次工具调用和每条执行的语句)
+	AuditSink       string // 审计记录的存储方式: file 或 table
+	AuditFile       string // file 方式的 JSONL 文件路径
+	AuditMaxSizeMB  int    // 审计文件超过该大小 (MB) 时轮转，0 表示不轮转
+	AuditMaxBackups int    // 轮转后保留的旧文件个数
+	AuditDBURL      string // table 方式写入的数据库连接串 (与被审计的连接分开)
+	AuditTable      string // table 方式写入的表名 ([schema.]table)，不存在时自动创建
+	// --- 训练语料 ---
+	CorpusEnabled    bool   // 是否把带 SQL 的工具调用记录为 NL2SQL 训练语料
+	CorpusFile       string // 训练语料 JSONL 文件路径
+	CorpusMaxSizeMB  int    // 语料文件超过该大小 (MB) 时轮转，0 表示不轮转
+	CorpusMaxBackups int    // 轮转后保留的旧文件个数
 }
 
 // LoadConfig 加载配置信息
@@ -36,17 +163,133 @@ func LoadConfig() *Config {
 
 	cfg := &Config{
 		// 设置默认值
-		ServerAddr:        getEnv("MCP_SERVER_ADDR", ":8181"),
-		IsDebug:           getEnvBool("IsDebug", true),
-		LogLevel:          getEnv("LOG_LEVEL", "info"),
-		ExtensionsDir:     getEnv("EXTENSIONS_DIR", "./extensions_knowledge"), // 默认在项目根目录下的 extensions_knowledge
-		DBConnMaxLifetime: getEnvDuration("DB_CONN_MAX_LIFETIME", 1*time.Hour),
-		DBConnMaxIdleTime: getEnvDuration("DB_CONN_MAX_IDLE_TIME", 30*time.Minute),
-		DBMaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", 10),
-		DBMinOpenConns:    getEnvInt("DB_MIN_OPEN_CONNS", 2),
+		ServerAddr:                  getEnv("MCP_SERVER_ADDR", ":8181"),
+		ShutdownTimeout:             getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		ServerName:                  getEnv("SERVER_NAME", "pg-mcp-server-go"),
+		StartupBanner:               getEnvBool("STARTUP_BANNER", true),
+		ServerInfoMeta:              getEnvBool("SERVER_INFO_METADATA", true),
+		ProtocolCompat:              getEnvBool("PROTOCOL_COMPAT", true),
+		IsDebug:                     getEnvBool("IsDebug", true),
+		LogLevel:                    getEnv("LOG_LEVEL", "info"),
+		LogFile:                     getEnv("LOG_FILE", ""),
+		LogMaxSizeMB:                getEnvInt("LOG_MAX_SIZE_MB", 100),
+		LogMaxBackups:               getEnvInt("LOG_MAX_BACKUPS", 10),
+		LogMaxAgeDays:               getEnvInt("LOG_MAX_AGE_DAYS", 0),
+		ExtensionsDir:               getEnv("EXTENSIONS_DIR", "./extensions_knowledge"), // 默认在项目根目录下的 extensions_knowledge
+		ExtensionsWatch:             getEnvBool("EXTENSIONS_WATCH", true),
+		ExtensionsRemoteURL:         getEnv("EXTENSIONS_REMOTE_URL", ""),
+		ExtensionsRemoteRef:         getEnv("EXTENSIONS_REMOTE_REF", ""),
+		ExtensionsRemotePath:        getEnv("EXTENSIONS_REMOTE_PATH", ""),
+		ExtensionsRemoteToken:       getEnv("EXTENSIONS_REMOTE_TOKEN", ""),
+		ExtensionsRemoteSHA256:      getEnv("EXTENSIONS_REMOTE_SHA256", ""),
+		ExtensionsRemotePublicKey:   getEnv("EXTENSIONS_REMOTE_PUBLIC_KEY", ""),
+		ExtensionsRemoteCacheDir:    getEnv("EXTENSIONS_REMOTE_CACHE_DIR", "./.extensions_remote"),
+		ExtensionsRemoteRefresh:     getEnvDuration("EXTENSIONS_REMOTE_REFRESH", 1*time.Hour),
+		DBConnMaxLifetime:           getEnvDuration("DB_CONN_MAX_LIFETIME", 1*time.Hour),
+		DBConnMaxIdleTime:           getEnvDuration("DB_CONN_MAX_IDLE_TIME", 30*time.Minute),
+		DBPoolIdleEvict:             getEnvDuration("DB_POOL_IDLE_EVICT", 30*time.Minute),
+		DBConnTTL:                   getEnvDuration("DB_CONN_TTL", 0),
+		DBSSLMode:                   getEnv("DB_SSLMODE", ""),
+		DBSSLRootCert:               getEnv("DB_SSLROOTCERT", ""),
+		DBSSLCert:                   getEnv("DB_SSLCERT", ""),
+		DBSSLKey:                    getEnv("DB_SSLKEY", ""),
+		DBTLSCertDir:                getEnv("DB_TLS_CERT_DIR", ""),
+		ListenMaxChannels:           getEnvInt("LISTEN_MAX_CHANNELS", 16),
+		ListenBufferSize:            getEnvInt("LISTEN_BUFFER_SIZE", 1000),
+		TxIdleTimeout:               getEnvDuration("TX_IDLE_TIMEOUT", 5*time.Minute),
+		TxMaxDuration:               getEnvDuration("TX_MAX_DURATION", 30*time.Minute),
+		TxMaxSessions:               getEnvInt("TX_MAX_SESSIONS", 4),
+		ResultCacheTTL:              getEnvDuration("RESULT_CACHE_TTL", 0),
+		ResultCacheMaxBytes:         int64(getEnvInt("RESULT_CACHE_MAX_BYTES", 64<<20)),
+		ResponseMaxBytes:            getEnvInt("RESPONSE_MAX_BYTES", 0),
+		DBMaxOpenConns:              getEnvInt("DB_MAX_OPEN_CONNS", 10),
+		DBMinOpenConns:              getEnvInt("DB_MIN_OPEN_CONNS", 2),
+		DBDialTimeout:               getEnvDuration("DB_DIAL_TIMEOUT", 10*time.Second),
+		DBStatementTimeout:          getEnvDuration("DB_STATEMENT_TIMEOUT", 0),
+		DBAcquireTimeout:            getEnvDuration("DB_ACQUIRE_TIMEOUT", 30*time.Second),
+		QueryAlertThreshold:         getEnvDuration("QUERY_ALERT_THRESHOLD", 0),
+		QueryHardLimit:              getEnvDuration("QUERY_HARD_LIMIT", 0),
+		QueryWatchdogInterval:       getEnvDuration("QUERY_WATCHDOG_INTERVAL", 5*time.Second),
+		QueryAlertWebhookURL:        getEnv("QUERY_ALERT_WEBHOOK_URL", ""),
+		QueryLogSize:                getEnvInt("QUERY_LOG_SIZE", 1000),
+		SchemaIncludePostGISObjects: getEnvBool("SCHEMA_INCLUDE_POSTGIS_OBJECTS", false),
+		SchemaLoadParallelism:       getEnvInt("SCHEMA_LOAD_PARALLELISM", 4),
+		SchemaCacheDir:              getEnv("SCHEMA_CACHE_DIR", ""),
+		SchemaSummaryTokenBudget:    getEnvInt("SCHEMA_SUMMARY_TOKEN_BUDGET", 4000),
+		SchemaResourcePageSize:      getEnvInt("SCHEMA_RESOURCE_PAGE_SIZE", 200),
+		SchemaRetrievalEmbeddings:   strings.ToLower(getEnv("SCHEMA_RETRIEVAL_EMBEDDINGS", "local")),
+		EmbeddingEndpointURL:        getEnv("EMBEDDING_ENDPOINT_URL", ""),
+		EmbeddingModel:              getEnv("EMBEDDING_MODEL", "text-embedding-3-small"),
+		EmbeddingAPIKey:             getEnv("EMBEDDING_API_KEY", ""),
+		EmbeddingBatchSize:          getEnvInt("EMBEDDING_BATCH_SIZE", 64),
+		EmbeddingTimeout:            getEnvDuration("EMBEDDING_TIMEOUT", 30*time.Second),
+		EmbeddingIndexFile:          getEnv("EMBEDDING_INDEX_FILE", "./embeddings/schema_index.json"),
+		PaginationOrderMode:         strings.ToLower(getEnv("PAGINATION_ORDER_MODE", "warn")),
+		SelectStarRewrite:           getEnvBool("SELECT_STAR_REWRITE", false),
+		SelectStarExcludeTypes:      getEnvList("SELECT_STAR_EXCLUDE_TYPES"),
+		ExportDir:                   getEnv("EXPORT_DIR", "./exports"),
+		ExportBaseURL:               getEnv("EXPORT_BASE_URL", ""),
+		ExportMaxBytes:              int64(getEnvInt("EXPORT_MAX_BYTES", 1<<30)),
+		ImportDir:                   getEnv("IMPORT_DIR", ""),
+		ToolPacksDir:                getEnv("TOOL_PACKS_DIR", ""),
+		NamedQueriesPath:            getEnv("NAMED_QUERIES_PATH", ""),
+		NamedQueryRegistration:      getEnvBool("NAMED_QUERY_REGISTRATION", false),
+		QueryTemplatesDir:           getEnv("QUERY_TEMPLATES_DIR", "./query_templates"),
+		StateBackupDir:              getEnv("STATE_BACKUP_DIR", ""),
+		PlanStorePath:               getEnv("PLAN_STORE_PATH", ""),
+		PlanRegressionCostRatio:     getEnvFloat("PLAN_REGRESSION_COST_RATIO", 2.0),
+		WriteReviewMode:             getEnvBool("WRITE_REVIEW_MODE", false),
+		WriteReviewAddr:             getEnv("WRITE_REVIEW_ADDR", ""),
+		WriteReviewToken:            getEnv("WRITE_REVIEW_TOKEN", ""),
+		WriteReviewTTL:              getEnvDuration("WRITE_REVIEW_TTL", 24*time.Hour),
+		WriteReviewMaxPending:       getEnvInt("WRITE_REVIEW_MAX_PENDING", 100),
+		IdempotencyPendingTTL:       getEnvDuration("IDEMPOTENCY_PENDING_TTL", 30*time.Minute),
+		AllowReadWriteConnections:   getEnvBool("ALLOW_READ_WRITE_CONNECTIONS", false),
+		AllowRawConnectionStrings:   getEnvBool("ALLOW_RAW_CONNECTION_STRINGS", true),
+		ConnectAllowHosts:           getEnvList("CONNECT_ALLOW_HOSTS"),
+		ConnectDenyHosts:            getEnvList("CONNECT_DENY_HOSTS"),
+		CredentialsFile:             getEnv("CREDENTIALS_FILE", ""),
+		CredentialsDir:              getEnv("CREDENTIALS_DIR", ""),
+		VaultAddr:                   getEnv("VAULT_ADDR", ""),
+		VaultToken:                  getEnv("VAULT_TOKEN", ""),
+		VaultTokenFile:              getEnv("VAULT_TOKEN_FILE", ""),
+		VaultNamespace:              getEnv("VAULT_NAMESPACE", ""),
+		AWSRegion:                   getEnv("AWS_REGION", ""),
+		AWSAccessKeyID:              getEnv("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretAccessKey:          getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		AWSSessionToken:             getEnv("AWS_SESSION_TOKEN", ""),
+		AWSSecretsManagerEndpoint:   getEnv("AWS_SECRETSMANAGER_ENDPOINT", ""),
+		CredentialRotationInterval:  getEnvDuration("CREDENTIAL_ROTATION_INTERVAL", 5*time.Minute),
+		ReplicaHealthCheckInterval:  getEnvDuration("REPLICA_HEALTH_CHECK_INTERVAL", 10*time.Second),
+		SSHKnownHostsFile:           getEnv("SSH_KNOWN_HOSTS_FILE", ""),
+		SSHInsecureIgnoreHostKey:    getEnvBool("SSH_INSECURE_IGNORE_HOST_KEY", false),
+		SSHKeyDir:                   getEnv("SSH_KEY_DIR", ""),
+		ProcedureAllowlist:          getEnvList("PROCEDURE_ALLOWLIST"),
+		AllowSchemas:                getEnvList("ALLOW_SCHEMAS"),
+		DenySchemas:                 getEnvList("DENY_SCHEMAS"),
+		AllowTables:                 getEnvList("ALLOW_TABLES"),
+		DenyTables:                  getEnvList("DENY_TABLES"),
+		MaskedColumns:               getEnvList("MASKED_COLUMNS"),
+		AuditEnabled:                getEnvBool("AUDIT_ENABLED", false),
+		AuditSink:                   strings.ToLower(getEnv("AUDIT_SINK", "file")),
+		AuditFile:                   getEnv("AUDIT_FILE", "./audit/audit.jsonl"),
+		AuditMaxSizeMB:              getEnvInt("AUDIT_MAX_SIZE_MB", 100),
+		AuditMaxBackups:             getEnvInt("AUDIT_MAX_BACKUPS", 10),
+		AuditDBURL:                  getEnv("AUDIT_DB_URL", ""),
+		AuditTable:                  getEnv("AUDIT_TABLE", "public.mcp_audit_log"),
+		CorpusEnabled:               getEnvBool("CORPUS_ENABLED", false),
+		CorpusFile:                  getEnv("CORPUS_FILE", "./corpus/corpus.jsonl"),
+		CorpusMaxSizeMB:             getEnvInt("CORPUS_MAX_SIZE_MB", 100),
+		CorpusMaxBackups:            getEnvInt("CORPUS_MAX_BACKUPS", 10),
 		// SchemaLoadDBURL: getEnv("SCHEMA_LOAD_DB_URL", ""), // 如果需要固定连接串加载
 	}
 
+	defaultLogFormat := utils.LogFormatJSON
+	if cfg.IsDebug {
+		defaultLogFormat = utils.LogFormatConsole
+	}
+	cfg.LogFormat = strings.ToLower(getEnv("LOG_FORMAT", defaultLogFormat))
+
 	// 可以在这里添加对配置项的验证逻辑
 	if cfg.DBMinOpenConns > cfg.DBMaxOpenConns {
 		utils.DefaultLogger.Info("警告: DB_MIN_OPEN_CONNS  大于 DB_MAX_OPEN_CONNS, 将使用 DB_MAX_OPEN_CONNS 作为最小值。\n")
@@ -57,10 +300,24 @@ func LoadConfig() *Config {
 		zap.String("ServerAddr", cfg.ServerAddr),
 		zap.String("LogLevel", cfg.LogLevel),
 		zap.String("ExtensionsDir", cfg.ExtensionsDir),
+		zap.Bool("ExtensionsWatch", cfg.ExtensionsWatch),
 	)
 	return cfg
 }
 
+// LogConfig 返回日志记录器的配置 (debug 模式下记录调用者信息)
+func (cfg *Config) LogConfig() utils.LogConfig {
+	return utils.LogConfig{
+		Level:       cfg.LogLevel,
+		Format:      cfg.LogFormat,
+		File:        cfg.LogFile,
+		MaxSizeMB:   cfg.LogMaxSizeMB,
+		MaxBackups:  cfg.LogMaxBackups,
+		MaxAgeDays:  cfg.LogMaxAgeDays,
+		Development: cfg.IsDebug,
+	}
+}
+
 // --- 辅助函数 ---
 
 // getEnv 读取环境变量，如果未设置则返回默认值
@@ -109,6 +366,37 @@ func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	}
 	return value
 }
+
+// getEnvFloat 读取环境变量并解析为浮点数，如果未设置或解析失败则返回默认值
+func getEnvFloat(key string, defaultValue float64) float64 {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		utils.DefaultLogger.Warn("警告: 无法将环境变量解析为浮点数, 将使用默认值",
+			zap.String("key", key),
+			zap.String("value", valueStr),
+			zap.Error(err),
+			zap.Float64("defaultValue", defaultValue),
+		)
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvList 读取逗号分隔的环境变量，去掉空白和空项，未设置时返回 nil
+func getEnvList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(getEnv(key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if valueStr, exists := os.LookupEnv(key); exists {
 		if value, err := strconv.ParseBool(valueStr); err == nil {
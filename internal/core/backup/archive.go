@@ -0,0 +1,152 @@
+// Package backup 读写服务器状态归档 (tar.gz)，用于把服务器状态迁移到其他主机。
+//
+// 归档中的每个文件是一个状态分区 (section)，manifest.json 记录格式版本、导出时的服务器版本和包含的分区。
+// 归档只包含扁平的文件名，读取时拒绝目录、链接和超出大小上限的文件。
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FormatVersion 是当前的归档格式版本，读取到更高版本的归档时拒绝导入
+const FormatVersion = 1
+
+const (
+	// manifestName 是归档中描述文件的名称
+	manifestName = "manifest.json"
+	// maxFileBytes 是归档中单个文件的大小上限
+	maxFileBytes = 256 << 20
+	// maxFiles 是归档中的文件数上限
+	maxFiles = 64
+)
+
+// Manifest 描述一个状态归档
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	ServerVersion string    `json:"server_version"`  // 导出时的服务器版本
+	Sections      []string  `json:"sections"`        // 归档中包含的分区
+	Notes         []string  `json:"notes,omitempty"` // 导出时的提示 (例如被移除密码的凭据)
+}
+
+// Write 把分区文件写入 path 指定的归档，先写临时文件再替换，写入失败时不会留下不完整的归档。
+func Write(path string, manifest Manifest, files map[string][]byte) error {
+	manifest.FormatVersion = FormatVersion
+	manifest.Sections = make([]string, 0, len(files))
+	for name := range files {
+		manifest.Sections = append(manifest.Sections, name)
+	}
+	sort.Strings(manifest.Sections)
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("编码归档描述失败: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("创建归档目录失败: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".state-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("创建归档文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gz)
+	entries := append([]string{manifestName}, manifest.Sections...)
+	for _, name := range entries {
+		data := manifestData
+		if name != manifestName {
+			data = files[name]
+		}
+		header := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: manifest.CreatedAt, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			tmp.Close()
+			return fmt.Errorf("写入归档失败: %w", err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			tmp.Close()
+			return fmt.Errorf("写入归档失败: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入归档失败: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入归档失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入归档失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("保存归档文件失败: %w", err)
+	}
+	return nil
+}
+
+// Read 读取归档，返回描述和各分区文件的内容。
+func Read(path string) (Manifest, map[string][]byte, error) {
+	var manifest Manifest
+	file, err := os.Open(path)
+	if err != nil {
+		return manifest, nil, fmt.Errorf("打开归档文件失败: %w", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return manifest, nil, fmt.Errorf("归档不是有效的 gzip 文件: %w", err)
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	foundManifest := false
+	tr := tar.NewReader(gz)
+	for count := 0; ; count++ {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, nil, fmt.Errorf("读取归档失败: %w", err)
+		}
+		if count >= maxFiles {
+			return manifest, nil, fmt.Errorf("归档中的文件超过 %d 个", maxFiles)
+		}
+		if header.Typeflag != tar.TypeReg || header.Name != filepath.Base(header.Name) || strings.HasPrefix(header.Name, ".") {
+			return manifest, nil, fmt.Errorf("归档包含不支持的条目 '%s'", header.Name)
+		}
+		if header.Size > maxFileBytes {
+			return manifest, nil, fmt.Errorf("归档中的文件 '%s' 超过大小上限", header.Name)
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, maxFileBytes))
+		if err != nil {
+			return manifest, nil, fmt.Errorf("读取归档文件 '%s' 失败: %w", header.Name, err)
+		}
+		if header.Name == manifestName {
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return manifest, nil, fmt.Errorf("解析归档描述失败: %w", err)
+			}
+			foundManifest = true
+			continue
+		}
+		files[header.Name] = data
+	}
+	if !foundManifest {
+		return manifest, nil, fmt.Errorf("归档缺少 %s", manifestName)
+	}
+	if manifest.FormatVersion > FormatVersion {
+		return manifest, nil, fmt.Errorf("归档格式版本 %d 高于当前支持的版本 %d，请升级服务器后再导入", manifest.FormatVersion, FormatVersion)
+	}
+	return manifest, files, nil
+}
@@ -0,0 +1,571 @@
+// Package charts 根据查询结果的列类型和基数推荐图表，并生成 Vega-Lite 或 Chart.js 规格，
+// 使聊天客户端可以直接渲染查询结果的可视化。
+package charts
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/results"
+)
+
+// 列的数据类别 (与 Vega-Lite 的 type 一致)
+const (
+	KindQuantitative = "quantitative" // 数值
+	KindTemporal     = "temporal"     // 日期时间
+	KindNominal      = "nominal"      // 类别
+)
+
+// 图表类型
+const (
+	ChartBar       = "bar"
+	ChartLine      = "line"
+	ChartScatter   = "scatter"
+	ChartPie       = "pie"
+	ChartHistogram = "histogram"
+)
+
+// 输出的规格格式
+const (
+	FormatVegaLite = "vega-lite"
+	FormatChartJS  = "chartjs"
+)
+
+const (
+	maxSeries        = 10 // 超过该基数的类别列不作为系列 (颜色) 使用
+	maxPieSlices     = 6  // 饼图最多的扇区数
+	maxBarCategories = 50 // 类别数超过该值时只保留数值最大的类别
+	histogramBins    = 20 // Chart.js 直方图的分箱数
+)
+
+// temporalLayouts 是识别为日期时间的文本格式
+var temporalLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05", "2006-01-02", "2006-01"}
+
+// ColumnProfile 是一列的类别和基数
+type ColumnProfile struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Distinct int    `json:"distinct"` // 不同的非 NULL 值个数
+	Nulls    int    `json:"nulls"`
+}
+
+// Options 是图表推荐的可选条件，为空的字段自动选择
+type Options struct {
+	Type   string // 图表类型
+	X      string // X 轴 (或类别) 列
+	Y      string // Y 轴 (或数值) 列
+	Series string // 系列 (颜色) 列
+}
+
+// Suggestion 是推荐的图表
+type Suggestion struct {
+	Type    string          `json:"type"`
+	X       string          `json:"x,omitempty"`
+	Y       string          `json:"y,omitempty"`
+	Series  string          `json:"series,omitempty"`
+	Reason  string          `json:"reason"` // 选择该图表的原因
+	Columns []ColumnProfile `json:"columns"`
+}
+
+// Profile 分析每一列的类别和基数
+func Profile(columns []string, rows []map[string]any) []ColumnProfile {
+	profiles := make([]ColumnProfile, len(columns))
+	for i, column := range columns {
+		profile := ColumnProfile{Name: column}
+		distinct := make(map[string]bool)
+		numeric, temporal := true, true
+		for _, row := range rows {
+			value := row[column]
+			if value == nil {
+				profile.Nulls++
+				continue
+			}
+			distinct[results.FormatValue(value)] = true
+			if _, ok := Number(value); !ok {
+				numeric = false
+			}
+			if _, ok := Time(value); !ok {
+				temporal = false
+			}
+		}
+		profile.Distinct = len(distinct)
+		switch {
+		case profile.Distinct == 0:
+			profile.Kind = KindNominal
+		case numeric:
+			profile.Kind = KindQuantitative
+		case temporal:
+			profile.Kind = KindTemporal
+		default:
+			profile.Kind = KindNominal
+		}
+		profiles[i] = profile
+	}
+	return profiles
+}
+
+// Suggest 按列的类别选择图表类型和字段:
+// 时间 + 数值为折线图，类别 + 数值为柱状图 (类别少且指定时可为饼图)，两个数值为散点图，
+// 只有一个数值列为直方图，只有类别列时为按类别计数的柱状图。
+func Suggest(columns []string, rows []map[string]any, options Options) (*Suggestion, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("结果没有列，无法生成图表")
+	}
+	profiles := Profile(columns, rows)
+	byName := make(map[string]ColumnProfile, len(profiles))
+	var quantitative, temporal, nominal []string
+	for _, profile := range profiles {
+		byName[profile.Name] = profile
+		switch profile.Kind {
+		case KindQuantitative:
+			quantitative = append(quantitative, profile.Name)
+		case KindTemporal:
+			temporal = append(temporal, profile.Name)
+		default:
+			nominal = append(nominal, profile.Name)
+		}
+	}
+	for _, name := range []string{options.X, options.Y, options.Series} {
+		if _, ok := byName[name]; name != "" && !ok {
+			return nil, fmt.Errorf("结果中没有列 '%s'", name)
+		}
+	}
+
+	s := &Suggestion{Type: options.Type, X: options.X, Y: options.Y, Series: options.Series, Columns: profiles}
+	pick := func(candidates []string, exclude ...string) string {
+		for _, candidate := range candidates {
+			excluded := false
+			for _, name := range exclude {
+				excluded = excluded || candidate == name
+			}
+			if !excluded {
+				return candidate
+			}
+		}
+		return ""
+	}
+	lowCardinality := func(exclude ...string) string {
+		for _, name := range nominal {
+			if byName[name].Distinct <= maxSeries && pick([]string{name}, exclude...) != "" {
+				return name
+			}
+		}
+		return ""
+	}
+
+	if s.Type == "" {
+		switch {
+		case len(temporal) > 0 && len(quantitative) > 0:
+			s.Type, s.Reason = ChartLine, "包含日期时间列和数值列，按时间展示趋势"
+		case len(nominal) > 0 && len(quantitative) > 0:
+			s.Type, s.Reason = ChartBar, "包含类别列和数值列，按类别比较数值"
+		case len(quantitative) >= 2:
+			s.Type, s.Reason = ChartScatter, "包含两个以上的数值列，展示它们之间的关系"
+		case len(quantitative) == 1:
+			s.Type, s.Reason = ChartHistogram, "只有一个数值列，展示数值的分布"
+		case len(temporal) > 0:
+			s.Type, s.Reason = ChartLine, "只有日期时间列，按时间展示行数"
+		default:
+			s.Type, s.Reason = ChartBar, "只有类别列，按类别展示行数"
+		}
+	} else {
+		s.Reason = "使用指定的图表类型"
+	}
+
+	switch s.Type {
+	case ChartLine:
+		if s.X == "" {
+			s.X = pick(append(append([]string{}, temporal...), quantitative...))
+		}
+		if s.Y == "" {
+			s.Y = pick(quantitative, s.X)
+		}
+		if s.Series == "" {
+			s.Series = lowCardinality(s.X, s.Y)
+		}
+	case ChartBar, ChartPie:
+		if s.X == "" {
+			s.X = pick(append(append([]string{}, nominal...), temporal...))
+			if s.X == "" {
+				s.X = pick(quantitative)
+			}
+		}
+		if s.Y == "" {
+			s.Y = pick(quantitative, s.X)
+		}
+		if s.Series == "" && s.Type == ChartBar {
+			s.Series = lowCardinality(s.X, s.Y)
+		}
+		if s.Type == ChartPie && byName[s.X].Distinct > maxPieSlices {
+			return nil, fmt.Errorf("列 '%s' 有 %d 个不同值，饼图最多支持 %d 个扇区，请改用柱状图", s.X, byName[s.X].Distinct, maxPieSlices)
+		}
+	case ChartScatter:
+		if s.X == "" {
+			s.X = pick(quantitative)
+		}
+		if s.Y == "" {
+			s.Y = pick(quantitative, s.X)
+		}
+		if s.Series == "" {
+			s.Series = lowCardinality(s.X, s.Y)
+		}
+		if s.Y == "" {
+			return nil, fmt.Errorf("散点图需要两个数值列")
+		}
+	case ChartHistogram:
+		if s.X == "" {
+			s.X = pick(quantitative)
+		}
+		if s.X == "" || byName[s.X].Kind != KindQuantitative {
+			return nil, fmt.Errorf("直方图需要一个数值列")
+		}
+		s.Y = ""
+	default:
+		return nil, fmt.Errorf("不支持的图表类型: '%s' (可选 bar, line, scatter, pie, histogram)", s.Type)
+	}
+	if s.X == "" {
+		return nil, fmt.Errorf("无法为 %s 图选择 X 轴列", s.Type)
+	}
+	if s.Y != "" && byName[s.Y].Kind != KindQuantitative {
+		return nil, fmt.Errorf("Y 轴列 '%s' 不是数值列", s.Y)
+	}
+	return s, nil
+}
+
+// VegaLite 返回 Vega-Lite v5 规格，数据内联在 data.values 中
+func (s *Suggestion) VegaLite(rows []map[string]any, title string) map[string]any {
+	kinds := make(map[string]string, len(s.Columns))
+	for _, column := range s.Columns {
+		kinds[column.Name] = column.Kind
+	}
+	field := func(name string) map[string]any {
+		return map[string]any{"field": name, "type": kinds[name]}
+	}
+	count := map[string]any{"aggregate": "count", "type": KindQuantitative, "title": "行数"}
+
+	encoding := map[string]any{}
+	var mark any
+	switch s.Type {
+	case ChartLine:
+		mark = map[string]any{"type": "line", "point": true}
+		encoding["x"] = field(s.X)
+		if s.Y != "" {
+			encoding["y"] = field(s.Y)
+		} else {
+			encoding["y"] = count
+		}
+	case ChartBar:
+		mark = "bar"
+		x := field(s.X)
+		if s.Y != "" {
+			encoding["y"] = field(s.Y)
+			if kinds[s.X] == KindNominal {
+				x["sort"] = "-y"
+			}
+		} else {
+			encoding["y"] = count
+		}
+		encoding["x"] = x
+	case ChartPie:
+		mark = "arc"
+		encoding["color"] = field(s.X)
+		if s.Y != "" {
+			encoding["theta"] = field(s.Y)
+		} else {
+			encoding["theta"] = count
+		}
+	case ChartScatter:
+		mark = "point"
+		encoding["x"] = field(s.X)
+		encoding["y"] = field(s.Y)
+	case ChartHistogram:
+		mark = "bar"
+		x := field(s.X)
+		x["bin"] = true
+		encoding["x"] = x
+		encoding["y"] = count
+	}
+	if s.Series != "" && s.Type != ChartPie {
+		encoding["color"] = field(s.Series)
+	}
+	tooltip := []map[string]any{field(s.X)}
+	for _, name := range []string{s.Y, s.Series} {
+		if name != "" {
+			tooltip = append(tooltip, field(name))
+		}
+	}
+	if s.Type != ChartHistogram {
+		encoding["tooltip"] = tooltip
+	}
+
+	spec := map[string]any{
+		"$schema":  "https://vega.github.io/schema/vega-lite/v5.json",
+		"data":     map[string]any{"values": chartValues(rows, s.fields())},
+		"mark":     mark,
+		"encoding": encoding,
+	}
+	if title != "" {
+		spec["title"] = title
+	}
+	return spec
+}
+
+// ChartJS 返回 Chart.js 配置 ({type, data, options})。Chart.js 不做聚合，
+// 柱状图和饼图中相同类别的数值在这里求和 (未指定数值列时计数)，直方图在这里分箱。
+func (s *Suggestion) ChartJS(rows []map[string]any, title string) map[string]any {
+	options := map[string]any{"responsive": true}
+	if title != "" {
+		options["plugins"] = map[string]any{"title": map[string]any{"display": true, "text": title}}
+	}
+
+	var chartType string
+	var data map[string]any
+	switch s.Type {
+	case ChartScatter:
+		chartType = "scatter"
+		data = map[string]any{"datasets": s.pointDatasets(rows)}
+		options["scales"] = axisTitles(s.X, s.Y)
+	case ChartHistogram:
+		chartType = "bar"
+		labels, counts := histogram(rows, s.X, histogramBins)
+		data = map[string]any{"labels": labels, "datasets": []map[string]any{{"label": s.X, "data": counts}}}
+		options["scales"] = axisTitles(s.X, "行数")
+	default:
+		chartType = s.Type
+		labels, datasets := s.categoryDatasets(rows)
+		data = map[string]any{"labels": labels, "datasets": datasets}
+		if s.Type != ChartPie {
+			options["scales"] = axisTitles(s.X, s.Y)
+		}
+	}
+	return map[string]any{"type": chartType, "data": data, "options": options}
+}
+
+// fields 返回图表用到的列
+func (s *Suggestion) fields() []string {
+	fields := []string{s.X}
+	for _, name := range []string{s.Y, s.Series} {
+		if name != "" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// categoryDatasets 为折线图、柱状图和饼图生成标签和数据集 (每个系列一个数据集)
+func (s *Suggestion) categoryDatasets(rows []map[string]any) ([]string, []map[string]any) {
+	var labels, seriesNames []string
+	labelIndex := make(map[string]int)
+	sums := make(map[string]map[string]float64) // 系列 -> 标签 -> 数值
+	for _, row := range rows {
+		if row[s.X] == nil {
+			continue
+		}
+		label := results.FormatValue(row[s.X])
+		if _, ok := labelIndex[label]; !ok {
+			labelIndex[label] = len(labels)
+			labels = append(labels, label)
+		}
+		series := s.Y
+		if series == "" {
+			series = "行数"
+		}
+		if s.Series != "" {
+			series = results.FormatValue(row[s.Series])
+		}
+		if _, ok := sums[series]; !ok {
+			sums[series] = make(map[string]float64)
+			seriesNames = append(seriesNames, series)
+		}
+		value := 1.0
+		if s.Y != "" {
+			value, _ = Number(row[s.Y])
+		}
+		sums[series][label] += value
+	}
+
+	if s.Type == ChartLine {
+		// 折线图按 X 排序 (时间或数值)，其他图保持结果顺序
+		sort.SliceStable(labels, func(i, j int) bool { return lessValue(labels[i], labels[j]) })
+	} else if len(labels) > maxBarCategories {
+		totals := make(map[string]float64, len(labels))
+		for _, series := range sums {
+			for label, value := range series {
+				totals[label] += value
+			}
+		}
+		sort.SliceStable(labels, func(i, j int) bool { return totals[labels[i]] > totals[labels[j]] })
+		labels = labels[:maxBarCategories]
+	}
+
+	datasets := make([]map[string]any, 0, len(seriesNames))
+	for _, series := range seriesNames {
+		values := make([]any, len(labels))
+		for i, label := range labels {
+			// 该系列没有这个标签时为 null (折线图中断开而不是画成 0)
+			if value, ok := sums[series][label]; ok {
+				values[i] = value
+			}
+		}
+		datasets = append(datasets, map[string]any{"label": series, "data": values})
+	}
+	return labels, datasets
+}
+
+// pointDatasets 为散点图生成 {x, y} 点 (每个系列一个数据集)
+func (s *Suggestion) pointDatasets(rows []map[string]any) []map[string]any {
+	var seriesNames []string
+	points := make(map[string][]map[string]float64)
+	for _, row := range rows {
+		x, okX := Number(row[s.X])
+		y, okY := Number(row[s.Y])
+		if !okX || !okY {
+			continue
+		}
+		series := s.Y
+		if s.Series != "" {
+			series = results.FormatValue(row[s.Series])
+		}
+		if _, ok := points[series]; !ok {
+			seriesNames = append(seriesNames, series)
+		}
+		points[series] = append(points[series], map[string]float64{"x": x, "y": y})
+	}
+	datasets := make([]map[string]any, 0, len(seriesNames))
+	for _, series := range seriesNames {
+		datasets = append(datasets, map[string]any{"label": series, "data": points[series]})
+	}
+	return datasets
+}
+
+// histogram 把数值列等宽分箱，返回每个箱的标签和行数
+func histogram(rows []map[string]any, column string, bins int) ([]string, []int) {
+	var values []float64
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, row := range rows {
+		if value, ok := Number(row[column]); ok {
+			values = append(values, value)
+			low, high = math.Min(low, value), math.Max(high, value)
+		}
+	}
+	if len(values) == 0 {
+		return []string{}, []int{}
+	}
+	if high == low {
+		return []string{strconv.FormatFloat(low, 'g', 6, 64)}, []int{len(values)}
+	}
+	width := (high - low) / float64(bins)
+	counts := make([]int, bins)
+	for _, value := range values {
+		counts[min(int((value-low)/width), bins-1)]++
+	}
+	labels := make([]string, bins)
+	for i := range labels {
+		labels[i] = fmt.Sprintf("%s - %s", strconv.FormatFloat(low+float64(i)*width, 'g', 6, 64), strconv.FormatFloat(low+float64(i+1)*width, 'g', 6, 64))
+	}
+	return labels, counts
+}
+
+func axisTitles(x, y string) map[string]any {
+	scales := map[string]any{"x": map[string]any{"title": map[string]any{"display": true, "text": x}}}
+	if y != "" {
+		scales["y"] = map[string]any{"title": map[string]any{"display": true, "text": y}}
+	}
+	return scales
+}
+
+// chartValues 只保留图表用到的列，并把值转换为 JSON 友好的形式 (数值、RFC 3339 时间或文本)
+func chartValues(rows []map[string]any, fields []string) []map[string]any {
+	values := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		value := make(map[string]any, len(fields))
+		for _, field := range fields {
+			switch cell := row[field].(type) {
+			case nil:
+				value[field] = nil
+			case bool, string:
+				value[field] = cell
+			default:
+				if number, ok := Number(cell); ok {
+					value[field] = number
+				} else {
+					value[field] = results.FormatValue(cell)
+				}
+			}
+		}
+		values[i] = value
+	}
+	return values
+}
+
+// lessValue 比较两个标签: 都能解析为数值时按数值，否则按文本 (RFC 3339 时间按文本排序即为时间顺序)
+func lessValue(a, b string) bool {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		return x < y
+	}
+	return a < b
+}
+
+// Number 把数值类型 (包括 numeric 等 pgtype 类型) 转换为 float64
+func Number(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case driver.Valuer:
+		driverValue, err := v.Value()
+		if err != nil || driverValue == nil {
+			return 0, false
+		}
+		if text, ok := driverValue.(string); ok {
+			number, err := strconv.ParseFloat(text, 64)
+			return number, err == nil && !math.IsNaN(number)
+		}
+		if _, isValuer := driverValue.(driver.Valuer); !isValuer {
+			return Number(driverValue)
+		}
+	}
+	return 0, false
+}
+
+// Time 把 time.Time 或常见格式的日期时间文本转换为 time.Time
+func Time(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		text := strings.TrimSpace(v)
+		for _, layout := range temporalLayouts {
+			if parsed, err := time.Parse(layout, text); err == nil {
+				return parsed, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,166 @@
+package credentials
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keywordPassword 匹配 key=value 格式连接字符串中的 password 参数
+var keywordPassword = regexp.MustCompile(`(?i)\bpassword\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+
+// ExportEntries 返回凭据文件中的条目，用于迁移到其他主机。
+// 直接写出的密码、连接字符串中的密码和 SSH 私钥口令会被移除，*_env、*_file 和 provider 引用保持不变；
+// 第二个返回值是被移除了密码的条目名称，导入后需要在新主机上补充。
+func (r *Resolver) ExportEntries() (map[string]Entry, []string, error) {
+	entries, err := r.loadFile()
+	if err != nil {
+		return nil, nil, err
+	}
+	exported := make(map[string]Entry, len(entries))
+	var stripped []string
+	for name, entry := range entries {
+		removed := entry.Password != ""
+		entry.Password = ""
+		if connString, ok := stripPassword(entry.URL); ok {
+			entry.URL = connString
+			removed = true
+		}
+		if entry.SSH != nil {
+			tunnel := *entry.SSH
+			if tunnel.Passphrase != "" {
+				tunnel.Passphrase = ""
+				removed = true
+			}
+			entry.SSH = &tunnel
+		}
+		exported[name] = entry
+		if removed {
+			stripped = append(stripped, name)
+		}
+	}
+	sort.Strings(stripped)
+	return exported, stripped, nil
+}
+
+// ImportEntries 把条目写入凭据文件 (不存在时创建)，已有同名条目时只有 overwrite 为 true 才覆盖。
+// 直接编辑 YAML 节点，文件中已有的注释和条目顺序保持不变。返回写入和跳过的条目名称。
+func (r *Resolver) ImportEntries(entries map[string]Entry, overwrite bool) ([]string, []string, error) {
+	if r.file == "" {
+		return nil, nil, fmt.Errorf("未配置 CREDENTIALS_FILE，无法导入命名凭据")
+	}
+	for name := range entries {
+		if !validName.MatchString(name) {
+			return nil, nil, fmt.Errorf("无效的凭据名称 '%s'", name)
+		}
+	}
+
+	var document yaml.Node
+	data, err := os.ReadFile(r.file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("读取凭据文件失败: %w", err)
+	}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, nil, fmt.Errorf("解析凭据文件 '%s' 失败: %w", r.file, err)
+		}
+	}
+	if len(document.Content) == 0 {
+		document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("凭据文件 '%s' 的顶层不是映射", r.file)
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var written, skipped []string
+	for _, name := range names {
+		var value yaml.Node
+		if err := value.Encode(entries[name]); err != nil {
+			return nil, nil, fmt.Errorf("编码凭据 '%s' 失败: %w", name, err)
+		}
+		index := -1
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == name {
+				index = i + 1
+				break
+			}
+		}
+		switch {
+		case index < 0:
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, &value)
+		case overwrite:
+			root.Content[index] = &value
+		default:
+			skipped = append(skipped, name)
+			continue
+		}
+		written = append(written, name)
+	}
+	if len(written) == 0 {
+		return written, skipped, nil
+	}
+
+	encoded, err := yaml.Marshal(&document)
+	if err != nil {
+		return nil, nil, fmt.Errorf("编码凭据文件失败: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.file), ".credentials-*.yaml")
+	if err != nil {
+		return nil, nil, fmt.Errorf("写入凭据文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(encoded); err != nil {
+		tmp.Close()
+		return nil, nil, fmt.Errorf("写入凭据文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, nil, fmt.Errorf("写入凭据文件失败: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return nil, nil, fmt.Errorf("写入凭据文件失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.file); err != nil {
+		return nil, nil, fmt.Errorf("替换凭据文件失败: %w", err)
+	}
+	return written, skipped, nil
+}
+
+// stripPassword 移除连接字符串中的密码，第二个返回值表示是否移除了内容
+func stripPassword(connString string) (string, bool) {
+	if strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://") {
+		parsed, err := url.Parse(connString)
+		if err != nil {
+			return connString, false
+		}
+		removed := false
+		if parsed.User != nil {
+			if _, ok := parsed.User.Password(); ok {
+				parsed.User = url.User(parsed.User.Username())
+				removed = true
+			}
+		}
+		query := parsed.Query()
+		if query.Has("password") {
+			query.Del("password")
+			parsed.RawQuery = query.Encode()
+			removed = true
+		}
+		return parsed.String(), removed
+	}
+	if !keywordPassword.MatchString(connString) {
+		return connString, false
+	}
+	return strings.Join(strings.Fields(keywordPassword.ReplaceAllString(connString, "")), " "), true
+}
@@ -0,0 +1,255 @@
+// Package credentials 把 connect 工具中的命名凭据 (例如 {"database": "analytics"}) 解析为连接字符串，
+// 使密码只存在于服务端的配置、环境变量或 Secret 文件中，不经过 MCP 通道，也不会出现在客户端日志里。
+//
+// 凭据按以下顺序查找:
+//  1. CREDENTIALS_FILE 指定的 YAML 文件中的同名条目 (可以通过 provider 从 Vault 或 AWS Secrets Manager 读取)；
+//  2. 环境变量 PGMCP_DB_<NAME> (名称转为大写，- 和 . 替换为 _)；
+//  3. CREDENTIALS_DIR 目录下与名称同名的文件 (例如 Docker/Kubernetes 挂载的 Secret)。
+//
+// 每次 connect 时重新读取，轮换密码后无需重启服务器；来自凭据提供者的连接还会由
+// databases.CredentialRotator 定期检查 Secret 版本，轮换后自动重建连接池。
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix 是存放命名凭据连接字符串的环境变量前缀
+const EnvPrefix = "PGMCP_DB_"
+
+// validName 限制凭据名称，防止在 CREDENTIALS_DIR 中通过 ../ 读取其他文件
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Entry 是 YAML 凭据文件中的一个条目。连接字符串和密码都可以直接写出，或从环境变量/文件读取。
+type Entry struct {
+	URL          string `yaml:"url"`                     // 连接字符串 (可以不含密码)
+	Provider     string `yaml:"provider,omitempty"`      // 凭据提供者 (vault 或 aws)，设置时从 secret 读取凭据
+	Secret       string `yaml:"secret,omitempty"`        // 提供者内的 Secret 标识 (Vault API 路径或 AWS SecretId)
+	URLEnv       string `yaml:"url_env,omitempty"`       // 从该环境变量读取连接字符串
+	URLFile      string `yaml:"url_file,omitempty"`      // 从该文件读取连接字符串
+	Password     string `yaml:"password,omitempty"`      // 密码，覆盖连接字符串中的密码
+	PasswordEnv  string `yaml:"password_env,omitempty"`  // 从该环境变量读取密码
+	PasswordFile string `yaml:"password_file,omitempty"` // 从该文件读取密码
+	AccessMode   string `yaml:"access_mode,omitempty"`   // 该凭据允许的最高访问模式 (read_only 或 read_write)，为空时不限制
+	Description  string `yaml:"description,omitempty"`   // 展示给客户端的说明
+
+	SSH      *databases.SSHTunnelConfig `yaml:"ssh,omitempty"`      // (可选) 经跳板机访问数据库的 SSH 隧道 (host, port, user, key_path, passphrase, known_hosts)
+	Replicas []string                   `yaml:"replicas,omitempty"` // (可选) 只读副本 (host 或 host:port)，使用与主库相同的用户和密码
+}
+
+// Credential 是解析后的命名凭据
+type Credential struct {
+	Name             string
+	ConnectionString string
+	AccessMode       string                     // 允许的最高访问模式，为空时不限制
+	Source           string                     // 凭据来源: file, env, secret_dir 或凭据提供者名称 (vault, aws)
+	Secret           *databases.SecretSource    // 来自凭据提供者时的来源，注册连接后用于轮换检查
+	Tunnel           *databases.SSHTunnelConfig // (可选) 凭据文件中配置的 SSH 隧道
+	Replicas         []string                   // (可选) 凭据文件中配置的只读副本
+}
+
+// Info 是可以展示给客户端的凭据信息 (不含连接字符串)
+type Info struct {
+	Name        string `json:"name"`
+	Source      string `json:"source"`
+	AccessMode  string `json:"access_mode,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Resolver 按名称解析命名凭据。
+type Resolver struct {
+	file      string                                  // YAML 凭据文件，为空时不使用
+	dir       string                                  // Secret 目录，为空时不使用
+	providers map[string]databases.CredentialProvider // 可用的凭据提供者
+}
+
+// NewResolver 按配置创建 Resolver。
+func NewResolver(cfg *config.Config, providers map[string]databases.CredentialProvider) *Resolver {
+	return &Resolver{file: cfg.CredentialsFile, dir: cfg.CredentialsDir, providers: providers}
+}
+
+// Resolve 返回名称对应的凭据，找不到时返回错误。
+func (r *Resolver) Resolve(ctx context.Context, name string) (*Credential, error) {
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("无效的凭据名称 '%s'", name)
+	}
+
+	entries, err := r.loadFile()
+	if err != nil {
+		return nil, err
+	}
+	if entry, ok := entries[name]; ok && entry.Provider != "" {
+		return r.resolveProvider(ctx, name, entry)
+	}
+	if entry, ok := entries[name]; ok {
+		connString, err := entry.connectionString()
+		if err != nil {
+			return nil, fmt.Errorf("解析凭据 '%s' 失败: %w", name, err)
+		}
+		return &Credential{Name: name, ConnectionString: connString, AccessMode: entry.AccessMode, Source: "file", Tunnel: entry.SSH, Replicas: entry.Replicas}, nil
+	}
+
+	if value := os.Getenv(envName(name)); value != "" {
+		return &Credential{Name: name, ConnectionString: strings.TrimSpace(value), Source: "env"}, nil
+	}
+
+	if r.dir != "" {
+		data, err := os.ReadFile(filepath.Join(r.dir, name))
+		if err == nil {
+			return &Credential{Name: name, ConnectionString: strings.TrimSpace(string(data)), Source: "secret_dir"}, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("读取凭据文件失败: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("未找到名为 '%s' 的数据库凭据", name)
+}
+
+// List 返回所有可用的凭据名称 (不含连接字符串)，按名称排序
+func (r *Resolver) List() ([]Info, error) {
+	entries, err := r.loadFile()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	infos := []Info{}
+	for name, entry := range entries {
+		seen[name] = true
+		source := "file"
+		if entry.Provider != "" {
+			source = entry.Provider
+		}
+		infos = append(infos, Info{Name: name, Source: source, AccessMode: entry.AccessMode, Description: entry.Description})
+	}
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(key, EnvPrefix) || value == "" {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, EnvPrefix))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			infos = append(infos, Info{Name: name, Source: "env"})
+		}
+	}
+	if r.dir != "" {
+		files, err := os.ReadDir(r.dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("读取凭据目录失败: %w", err)
+		}
+		for _, file := range files {
+			name := file.Name()
+			if file.IsDir() || !validName.MatchString(name) || seen[name] {
+				continue
+			}
+			seen[name] = true
+			infos = append(infos, Info{Name: name, Source: "secret_dir"})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// resolveProvider 从条目指定的凭据提供者读取 Secret
+func (r *Resolver) resolveProvider(ctx context.Context, name string, entry Entry) (*Credential, error) {
+	provider, ok := r.providers[entry.Provider]
+	if !ok {
+		return nil, fmt.Errorf("凭据 '%s' 使用的提供者 '%s' 未配置 (vault 需要 VAULT_ADDR，aws 需要 AWS_REGION)", name, entry.Provider)
+	}
+	if entry.Secret == "" {
+		return nil, fmt.Errorf("凭据 '%s' 缺少 secret", name)
+	}
+	source := &databases.SecretSource{Provider: provider, Ref: entry.Secret, BaseURL: entry.URL}
+	connString, err := source.Resolve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("解析凭据 '%s' 失败: %w", name, err)
+	}
+	return &Credential{Name: name, ConnectionString: connString, AccessMode: entry.AccessMode, Source: provider.Name(), Secret: source, Tunnel: entry.SSH, Replicas: entry.Replicas}, nil
+}
+
+// loadFile 读取 YAML 凭据文件，未配置或文件不存在时返回空
+func (r *Resolver) loadFile() (map[string]Entry, error) {
+	if r.file == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(r.file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取凭据文件失败: %w", err)
+	}
+	entries := make(map[string]Entry)
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("解析凭据文件 '%s' 失败: %w", r.file, err)
+	}
+	return entries, nil
+}
+
+// connectionString 组装条目的连接字符串，指定了密码时替换连接字符串中的密码
+func (e Entry) connectionString() (string, error) {
+	connString, err := readValue(e.URL, e.URLEnv, e.URLFile)
+	if err != nil {
+		return "", fmt.Errorf("读取连接字符串失败: %w", err)
+	}
+	if connString == "" {
+		return "", fmt.Errorf("未配置连接字符串 (url, url_env 或 url_file)")
+	}
+	password, err := readValue(e.Password, e.PasswordEnv, e.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("读取密码失败: %w", err)
+	}
+	if password == "" {
+		return connString, nil
+	}
+	if !strings.HasPrefix(connString, "postgres://") && !strings.HasPrefix(connString, "postgresql://") {
+		connString = "postgresql://" + connString
+	}
+	parsed, err := url.Parse(connString)
+	if err != nil {
+		return "", fmt.Errorf("连接字符串格式无效: %w", err)
+	}
+	username := ""
+	if parsed.User != nil {
+		username = parsed.User.Username()
+	}
+	parsed.User = url.UserPassword(username, password)
+	return parsed.String(), nil
+}
+
+// readValue 依次使用直接写出的值、环境变量和文件
+func readValue(value, envName, fileName string) (string, error) {
+	switch {
+	case value != "":
+		return value, nil
+	case envName != "":
+		env := os.Getenv(envName)
+		if env == "" {
+			return "", fmt.Errorf("环境变量 %s 未设置", envName)
+		}
+		return strings.TrimSpace(env), nil
+	case fileName != "":
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", nil
+}
+
+// envName 返回凭据对应的环境变量名，例如 analytics-eu -> PGMCP_DB_ANALYTICS_EU
+func envName(name string) string {
+	return EnvPrefix + strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToUpper(name))
+}
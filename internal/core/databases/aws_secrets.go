@@ -0,0 +1,167 @@
+package databases
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+)
+
+// AWSSecretsProvider 通过 GetSecretValue API (SigV4 签名) 从 AWS Secrets Manager 读取凭据。
+// ref 是 SecretId 或 ARN；SecretString 可以是 RDS 托管轮换使用的 JSON
+// ({"username", "password", "host", "port", "dbname"})、包含 url 的 JSON 或连接字符串本身。
+// 版本为 VersionId，轮换后会变化。访问密钥来自配置 (AWS_ACCESS_KEY_ID 等)。
+type AWSSecretsProvider struct {
+	region       string
+	endpoint     string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	httpClient   *http.Client
+	now          func() time.Time
+}
+
+// NewAWSSecretsProvider 按配置创建 AWSSecretsProvider。
+func NewAWSSecretsProvider(cfg *config.Config) *AWSSecretsProvider {
+	endpoint := cfg.AWSSecretsManagerEndpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", cfg.AWSRegion)
+	}
+	return &AWSSecretsProvider{
+		region:       cfg.AWSRegion,
+		endpoint:     strings.TrimRight(endpoint, "/"),
+		accessKey:    cfg.AWSAccessKeyID,
+		secretKey:    cfg.AWSSecretAccessKey,
+		sessionToken: cfg.AWSSessionToken,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		now:          time.Now,
+	}
+}
+
+// Name 实现 CredentialProvider 接口。
+func (p *AWSSecretsProvider) Name() string {
+	return ProviderAWS
+}
+
+// Fetch 实现 CredentialProvider 接口。
+func (p *AWSSecretsProvider) Fetch(ctx context.Context, ref string) (*Secret, error) {
+	if p.accessKey == "" || p.secretKey == "" {
+		return nil, fmt.Errorf("未配置 AWS_ACCESS_KEY_ID 或 AWS_SECRET_ACCESS_KEY")
+	}
+	body, _ := json.Marshal(map[string]string{"SecretId": ref})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建 Secrets Manager 请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	p.sign(req, body)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 Secrets Manager 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("读取 Secrets Manager 响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(respBody, &apiErr)
+		return nil, fmt.Errorf("Secrets Manager 返回 HTTP %d: %s %s", resp.StatusCode, apiErr.Type, apiErr.Message)
+	}
+	var parsed struct {
+		SecretString string `json:"SecretString"`
+		VersionID    string `json:"VersionId"`
+	}
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("解析 Secrets Manager 响应失败: %w", err)
+	}
+	if parsed.SecretString == "" {
+		return nil, fmt.Errorf("Secret '%s' 没有 SecretString (不支持二进制 Secret)", ref)
+	}
+
+	var values map[string]string
+	var data map[string]any
+	if err := json.Unmarshal([]byte(parsed.SecretString), &data); err == nil {
+		values = stringValues(data)
+	} else {
+		values = map[string]string{"url": strings.TrimSpace(parsed.SecretString)}
+	}
+	version := parsed.VersionID
+	if version == "" {
+		version = valuesVersion(values)
+	}
+	return &Secret{Values: values, Version: version}, nil
+}
+
+// sign 按 AWS Signature Version 4 为请求签名
+func (p *AWSSecretsProvider) sign(req *http.Request, body []byte) {
+	const service = "secretsmanager"
+	now := p.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if p.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.sessionToken)
+	}
+
+	headers := map[string]string{
+		"content-type": req.Header.Get("Content-Type"),
+		"host":         req.URL.Host,
+		"x-amz-date":   amzDate,
+		"x-amz-target": req.Header.Get("X-Amz-Target"),
+	}
+	names := []string{"content-type", "host", "x-amz-date"}
+	if p.sessionToken != "" {
+		headers["x-amz-security-token"] = p.sessionToken
+		names = append(names, "x-amz-security-token")
+	}
+	names = append(names, "x-amz-target")
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.Query().Encode(), canonicalHeaders.String(), signedHeaders, sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + p.region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+p.secretKey), date)
+	key = hmacSHA256(key, p.region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", p.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
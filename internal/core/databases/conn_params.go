@@ -0,0 +1,214 @@
+package databases
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ConnParams 是 connect 工具的结构化连接参数，由服务端校验并组装为连接字符串，
+// 客户端不需要自己转义密码中的特殊字符，也无法通过拼接 DSN 注入额外的连接参数。
+// sslmode 和证书文件不在其中，通过 ConnectionOptions.TLS 设置。
+type ConnParams struct {
+	Host     string
+	Port     int
+	DBName   string
+	User     string
+	Password string
+	Options  []string // 其他连接参数 (key=value)，只允许 connOptionKeys 中的参数
+}
+
+// sslModes 是 libpq 支持的 sslmode 取值 (TLSOptions 校验使用)
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// connOptionKeys 是 options 中允许的连接参数 (pgx 把 libpq 不认识的参数作为会话参数发送)。
+// 不允许 sslmode、sslrootcert、sslkey 等 TLS 参数 (通过 TLSOptions 设置)、passfile、service 等引用服务端文件的参数，以及有专门字段的参数。
+var connOptionKeys = map[string]bool{
+	"application_name":                    true,
+	"connect_timeout":                     true,
+	"target_session_attrs":                true,
+	"search_path":                         true,
+	"statement_timeout":                   true,
+	"lock_timeout":                        true,
+	"idle_in_transaction_session_timeout": true,
+	"timezone":                            true,
+}
+
+// connStringKeys 是客户端传入的连接字符串中除 connOptionKeys 之外允许的参数: 连接目标和 sslmode
+// (证书文件通过 TLSOptions 设置，见 CheckRawConnString)
+var connStringKeys = map[string]bool{
+	"host":     true,
+	"port":     true,
+	"dbname":   true,
+	"user":     true,
+	"password": true,
+	"sslmode":  true,
+}
+
+// validHostname 匹配主机名和 IPv4 地址 (IPv6 地址由 net.ParseIP 判断)
+var validHostname = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?$`)
+
+// ConnString 校验参数并组装 postgresql:// 连接字符串。返回的错误指出出错的字段。
+func (p ConnParams) ConnString() (string, error) {
+	host := strings.TrimSpace(p.Host)
+	switch {
+	case host == "":
+		return "", fmt.Errorf("缺少 'host' 参数")
+	case net.ParseIP(strings.Trim(host, "[]")) == nil && !validHostname.MatchString(host):
+		return "", fmt.Errorf("'host' 必须是主机名或 IP 地址: %q", p.Host)
+	case p.Port < 0 || p.Port > 65535:
+		return "", fmt.Errorf("'port' 必须在 1-65535 之间")
+	case p.User == "":
+		return "", fmt.Errorf("缺少 'user' 参数")
+	}
+	for field, value := range map[string]string{"user": p.User, "dbname": p.DBName, "password": p.Password} {
+		if strings.ContainsFunc(value, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+			return "", fmt.Errorf("'%s' 不能包含控制字符", field)
+		}
+	}
+
+	query := url.Values{}
+	for _, option := range p.Options {
+		key, value, ok := strings.Cut(option, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		switch {
+		case !ok || key == "":
+			return "", fmt.Errorf("'options' 中的 %q 不是 key=value 形式", option)
+		case !connOptionKeys[key]:
+			return "", fmt.Errorf("'options' 不支持连接参数 '%s' (可用: %s)", key, strings.Join(sortedKeys(connOptionKeys), ", "))
+		case query.Has(key):
+			return "", fmt.Errorf("'options' 中的连接参数 '%s' 重复", key)
+		}
+		query.Set(key, strings.TrimSpace(value))
+	}
+
+	address := strings.Trim(host, "[]")
+	if p.Port > 0 {
+		address = net.JoinHostPort(address, strconv.Itoa(p.Port))
+	} else if strings.Contains(address, ":") {
+		address = "[" + address + "]"
+	}
+	connURL := &url.URL{Scheme: "postgresql", Host: address, Path: "/" + p.DBName, RawQuery: query.Encode()}
+	if p.Password != "" {
+		connURL.User = url.UserPassword(p.User, p.Password)
+	} else {
+		connURL.User = url.User(p.User)
+	}
+	connString := connURL.String()
+	if _, err := pgconn.ParseConfig(connString); err != nil {
+		return "", fmt.Errorf("连接参数无效: %w", err)
+	}
+	return connString, nil
+}
+
+// ConnStringHosts 返回连接字符串中的所有主机 (包括多主机连接字符串中的备用主机)
+func ConnStringHosts(connString string) ([]string, error) {
+	parsed, err := pgconn.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("连接字符串格式无效: %w", err)
+	}
+	hosts := []string{parsed.Host}
+	for _, fallback := range parsed.Fallbacks {
+		if !slices.Contains(hosts, fallback.Host) {
+			hosts = append(hosts, fallback.Host)
+		}
+	}
+	return hosts, nil
+}
+
+// CheckHostPolicy 检查客户端指定的数据库主机或 SSH 跳板机 (host 或 host:port) 是否被 CONNECT_ALLOW_HOSTS / CONNECT_DENY_HOSTS 允许。
+// 规则支持 * 和 ? 通配符以及 CIDR (例如 10.0.0.0/8)，不区分大小写；拒绝优先于允许，允许列表为空表示不限制。
+// 主机名会被解析，规范名称 (CNAME) 和解析出的任一地址被拒绝时同样拒绝；
+// 主机名本身不在允许列表中时，解析出的所有地址都必须被允许。解析失败时只按主机名匹配。
+func CheckHostPolicy(ctx context.Context, cfg *config.Config, hosts ...string) error {
+	if len(cfg.ConnectAllowHosts) == 0 && len(cfg.ConnectDenyHosts) == 0 {
+		return nil
+	}
+	for _, host := range hosts {
+		if name, _, err := net.SplitHostPort(host); err == nil {
+			host = name
+		}
+		host = strings.ToLower(strings.Trim(host, "[]"))
+		resolved := resolveHost(ctx, host)
+		for _, name := range append([]string{host}, resolved...) {
+			if !matchHost(cfg.ConnectDenyHosts, name) {
+				continue
+			}
+			if name == host {
+				return fmt.Errorf("服务端策略禁止连接主机 '%s' (CONNECT_DENY_HOSTS)", host)
+			}
+			return fmt.Errorf("服务端策略禁止连接主机 '%s' (解析为 '%s'，CONNECT_DENY_HOSTS)", host, name)
+		}
+		if len(cfg.ConnectAllowHosts) == 0 || matchHost(cfg.ConnectAllowHosts, host) {
+			continue
+		}
+		if len(resolved) == 0 {
+			return fmt.Errorf("主机 '%s' 不在服务端允许的主机列表中 (CONNECT_ALLOW_HOSTS)", host)
+		}
+		for _, name := range resolved {
+			if !matchHost(cfg.ConnectAllowHosts, name) {
+				return fmt.Errorf("主机 '%s' (解析为 '%s') 不在服务端允许的主机列表中 (CONNECT_ALLOW_HOSTS)", host, name)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveHost 返回主机名的规范名称 (与主机名不同时) 和解析出的地址。IP 地址、Unix 套接字目录和解析失败时返回 nil
+func resolveHost(ctx context.Context, host string) []string {
+	if host == "" || strings.HasPrefix(host, "/") || net.ParseIP(host) != nil {
+		return nil
+	}
+	var names []string
+	if cname, err := net.DefaultResolver.LookupCNAME(ctx, host); err == nil {
+		if cname = strings.ToLower(strings.TrimSuffix(cname, ".")); cname != "" && cname != host {
+			names = append(names, cname)
+		}
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return names
+	}
+	for _, addr := range addrs {
+		if ip := addr.IP.String(); !slices.Contains(names, ip) {
+			names = append(names, ip)
+		}
+	}
+	return names
+}
+
+// matchHost 判断主机 (主机名或 IP 地址) 是否匹配任一规则。CIDR 规则只匹配其中的 IP 地址
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if _, network, err := net.ParseCIDR(pattern); err == nil {
+			if ip := net.ParseIP(host); ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if matched, err := path.Match(strings.ToLower(pattern), host); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys 返回按名称排序的键
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,115 @@
+package databases
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// pingTimeout 是 ListConnections 检查单个连接池的超时时间
+const pingTimeout = 3 * time.Second
+
+// ConnectionSummary 是一个已注册连接的概要，不包含密码等凭据
+type ConnectionSummary struct {
+	ConnID     string     `json:"conn_id"`
+	Host       string     `json:"host,omitempty"`
+	Port       uint16     `json:"port,omitempty"`
+	Database   string     `json:"database,omitempty"`
+	User       string     `json:"user,omitempty"`
+	AccessMode string     `json:"access_mode"`
+	Status     string     `json:"status"`    // ConnectionActive 等
+	PoolOpen   bool       `json:"pool_open"` // 连接池是否已创建 (首次使用或空闲回收后为 false)
+	Pool       *PoolStats `json:"pool,omitempty"`
+	Healthy    *bool      `json:"healthy,omitempty"`    // 只在要求检查且连接池已创建时返回
+	PingMs     *float64   `json:"ping_ms,omitempty"`    // 检查耗时
+	PingError  string     `json:"ping_error,omitempty"` // 检查失败的错误
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Persistent bool       `json:"persistent,omitempty"`
+	Credential string     `json:"credential,omitempty"` // 凭据提供者名称 (vault, aws)，连接字符串直接注册时为空
+	SSHHost    string     `json:"ssh_host,omitempty"`   // 经由的 SSH 跳板机
+	Replicas   []string   `json:"replicas,omitempty"`   // 只读副本地址
+	SSLMode    string     `json:"sslmode,omitempty"`    // 生效的 sslmode (合并 connect 的 TLS 设置和全局默认值)，为空表示使用 libpq 默认的 prefer
+}
+
+// Fingerprint 标识连接指向的数据库: sha256(host:port/database?user=) 的前 16 位，凭据轮换后保持不变
+func (c ConnectionSummary) Fingerprint() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d/%s?user=%s", c.Host, c.Port, c.Database, c.User)))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// ListConnections 实现 Service 接口。
+func (s *pgxService) ListConnections(ctx context.Context, ping bool) []ConnectionSummary {
+	s.mapMutex.RLock()
+	summaries := make([]ConnectionSummary, 0, len(s.connMap))
+	pools := make(map[string]*pgxpool.Pool, len(s.pools))
+	for connID, connString := range s.connMap {
+		summary := ConnectionSummary{ConnID: connID, AccessMode: s.modes[connID], Status: ConnectionActive}
+		if parsed, err := pgconn.ParseConfig(connString); err == nil {
+			summary.Host, summary.Port, summary.Database, summary.User = parsed.Host, parsed.Port, parsed.Database, parsed.User
+		}
+		if usage, ok := s.usage[connID]; ok {
+			lastUsed := time.Unix(0, usage.lastUsed.Load())
+			summary.LastUsedAt = &lastUsed
+			summary.Persistent = usage.persistent.Load()
+			if s.config.DBConnTTL > 0 && !summary.Persistent {
+				expiresAt := lastUsed.Add(s.config.DBConnTTL)
+				summary.ExpiresAt = &expiresAt
+			}
+		}
+		if secret, ok := s.secrets[connID]; ok && secret != nil && secret.Provider != nil {
+			summary.Credential = secret.Provider.Name()
+		}
+		if tunnel, ok := s.tunnelCfgs[connID]; ok && tunnel != nil {
+			summary.SSHHost = tunnel.address()
+		}
+		summary.Replicas = append([]string(nil), s.replicaAddrs[connID]...)
+		if effective, err := ApplyTLS(connString, s.tlsCfgs[connID], s.tlsDefaults()); err == nil {
+			summary.SSLMode = ConnStringParam(effective, "sslmode")
+		}
+		if pool, ok := s.pools[connID]; ok {
+			summary.PoolOpen = true
+			stats := NewPoolStats(pool.Stat())
+			summary.Pool = &stats
+			pools[connID] = pool
+		}
+		summaries = append(summaries, summary)
+	}
+	s.mapMutex.RUnlock()
+
+	if ping {
+		// 并发检查，只检查已创建的连接池，不创建新连接池也不更新最近使用时间
+		var wg sync.WaitGroup
+		for i := range summaries {
+			pool, ok := pools[summaries[i].ConnID]
+			if !ok {
+				continue
+			}
+			wg.Add(1)
+			go func(summary *ConnectionSummary) {
+				defer wg.Done()
+				pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+				defer cancel()
+				start := time.Now()
+				err := pool.Ping(pingCtx)
+				elapsed := float64(time.Since(start).Microseconds()) / 1000
+				healthy := err == nil
+				summary.Healthy, summary.PingMs = &healthy, &elapsed
+				if err != nil {
+					summary.PingError = err.Error()
+				}
+			}(&summaries[i])
+		}
+		wg.Wait()
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ConnID < summaries[j].ConnID })
+	return summaries
+}
@@ -0,0 +1,149 @@
+package databases
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+)
+
+// 内置凭据提供者的名称 (命名凭据 YAML 中的 provider 字段)
+const (
+	ProviderVault = "vault"
+	ProviderAWS   = "aws"
+)
+
+// CredentialProvider 从外部密钥管理服务 (Vault, AWS Secrets Manager 等) 读取数据库凭据。
+// 实现需要可以并发调用。
+type CredentialProvider interface {
+	// Name 返回提供者名称，用于日志和凭据来源展示。
+	Name() string
+
+	// Fetch 读取 ref 指向的 Secret。
+	// ref: 提供者内的 Secret 标识 (Vault 为 API 路径，AWS 为 SecretId 或 ARN)。
+	// 返回值: Secret 内容和版本，以及 error。
+	Fetch(ctx context.Context, ref string) (*Secret, error)
+}
+
+// Secret 是从凭据提供者读取的 Secret
+type Secret struct {
+	Values    map[string]string // Secret 中的键值 (例如 username, password, host 或 url)
+	Version   string            // Secret 版本，变化时表示凭据已轮换
+	ExpiresAt time.Time         // 动态凭据 (例如 Vault 数据库引擎) 的租约到期时间，静态 Secret 为零值
+}
+
+// SecretSource 记录连接使用的凭据来源，轮换检查时重新读取
+type SecretSource struct {
+	Provider  CredentialProvider
+	Ref       string    // 提供者内的 Secret 标识
+	BaseURL   string    // (可选) 不含密码的连接字符串，Secret 中的用户名和密码注入其中
+	Version   string    // 注册连接时读取到的 Secret 版本
+	ExpiresAt time.Time // 动态凭据的租约到期时间
+}
+
+// Resolve 读取 Secret 并组装连接字符串，同时更新 Version 和 ExpiresAt。
+func (s *SecretSource) Resolve(ctx context.Context) (string, error) {
+	secret, err := s.Provider.Fetch(ctx, s.Ref)
+	if err != nil {
+		return "", fmt.Errorf("从 %s 读取 Secret '%s' 失败: %w", s.Provider.Name(), s.Ref, err)
+	}
+	connString, err := secret.ConnectionString(s.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("Secret '%s' 无法组装连接字符串: %w", s.Ref, err)
+	}
+	s.Version, s.ExpiresAt = secret.Version, secret.ExpiresAt
+	return connString, nil
+}
+
+// ConnectionString 由 Secret 组装连接字符串:
+// Secret 中有 url 或 connection_string 时直接使用；base 不为空时把 username/password 注入 base；
+// 否则按 RDS 风格的 host, port, dbname, username, password 组装。
+func (s *Secret) ConnectionString(base string) (string, error) {
+	for _, key := range []string{"url", "connection_string", "uri"} {
+		if value := s.Values[key]; value != "" {
+			return value, nil
+		}
+	}
+	username, password := s.Values["username"], s.Values["password"]
+	if base != "" {
+		if !strings.HasPrefix(base, "postgres://") && !strings.HasPrefix(base, "postgresql://") {
+			base = "postgresql://" + base
+		}
+		parsed, err := url.Parse(base)
+		if err != nil {
+			return "", fmt.Errorf("连接字符串格式无效: %w", err)
+		}
+		if username == "" && parsed.User != nil {
+			username = parsed.User.Username()
+		}
+		if password != "" {
+			parsed.User = url.UserPassword(username, password)
+		} else if username != "" {
+			parsed.User = url.User(username)
+		}
+		return parsed.String(), nil
+	}
+	host := s.Values["host"]
+	if host == "" {
+		return "", fmt.Errorf("Secret 中缺少 url 或 host")
+	}
+	if port := s.Values["port"]; port != "" {
+		host += ":" + port
+	}
+	database := s.Values["dbname"]
+	if database == "" {
+		database = s.Values["database"]
+	}
+	connURL := &url.URL{Scheme: "postgresql", Host: host, Path: "/" + database}
+	if username != "" {
+		connURL.User = url.UserPassword(username, password)
+	}
+	return connURL.String(), nil
+}
+
+// NewCredentialProviders 按配置创建可用的凭据提供者 (名称 -> 提供者)，未配置的提供者不包含在内。
+func NewCredentialProviders(cfg *config.Config) map[string]CredentialProvider {
+	providers := make(map[string]CredentialProvider)
+	if cfg.VaultAddr != "" {
+		providers[ProviderVault] = NewVaultProvider(cfg)
+	}
+	if cfg.AWSRegion != "" {
+		providers[ProviderAWS] = NewAWSSecretsProvider(cfg)
+	}
+	return providers
+}
+
+// valuesVersion 在提供者没有版本号时，用 Secret 内容的摘要作为版本
+func valuesVersion(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%s\n", key, values[key])
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// stringValues 把 JSON 对象的值转换为字符串 (端口等可能是数字)
+func stringValues(data map[string]any) map[string]string {
+	values := make(map[string]string, len(data))
+	for key, value := range data {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			values[key] = v
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values
+}
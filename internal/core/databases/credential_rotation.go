@@ -0,0 +1,143 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// setSecret 记录连接的凭据来源 (为 nil 时保留已有的来源)
+func (s *pgxService) setSecret(connID string, secret *SecretSource) {
+	if secret == nil {
+		return
+	}
+	s.mapMutex.Lock()
+	defer s.mapMutex.Unlock()
+	s.secrets[connID] = secret
+}
+
+// RotateCredentials 实现 Service 接口。
+func (s *pgxService) RotateCredentials(ctx context.Context) ([]CredentialRotation, error) {
+	s.mapMutex.RLock()
+	sources := make(map[string]SecretSource, len(s.secrets))
+	for connID, source := range s.secrets {
+		sources[connID] = *source
+	}
+	s.mapMutex.RUnlock()
+
+	rotations := []CredentialRotation{}
+	var errs []error
+	for connID, source := range sources {
+		// 动态凭据在租约到期前两个检查间隔内才重新申请，避免每次检查都生成新的数据库用户
+		if !source.ExpiresAt.IsZero() && time.Until(source.ExpiresAt) > 2*s.config.CredentialRotationInterval {
+			continue
+		}
+		next := source
+		connString, err := next.Resolve(ctx)
+		if err != nil {
+			utils.DefaultLogger.Error("凭据轮换检查失败", zap.String("connID", connID), zap.String("provider", source.Provider.Name()), zap.Error(err))
+			errs = append(errs, fmt.Errorf("connID %s: %w", connID, err))
+			continue
+		}
+		if next.Version == source.Version {
+			continue
+		}
+		normalized, err := normalizeConnectionString(connString)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("connID %s: 轮换后的连接字符串无效: %w", connID, err))
+			continue
+		}
+		if !s.replaceConnectionString(connID, normalized, &next) {
+			continue // 检查期间连接已断开
+		}
+		utils.DefaultLogger.Info("凭据已轮换，连接池将重建", zap.String("connID", connID), zap.String("provider", source.Provider.Name()), zap.String("ref", source.Ref), zap.String("from", source.Version), zap.String("to", next.Version))
+		rotations = append(rotations, CredentialRotation{ConnID: connID, Provider: source.Provider.Name(), Ref: source.Ref, From: source.Version, To: next.Version})
+	}
+	return rotations, errors.Join(errs...)
+}
+
+// replaceConnectionString 更新连接的连接字符串和凭据来源，并移除现有连接池，下次使用时按新凭据重建。
+// 连接已断开时返回 false。
+func (s *pgxService) replaceConnectionString(connID, connString string, secret *SecretSource) bool {
+	s.poolMutex.Lock()
+	defer s.poolMutex.Unlock()
+	s.mapMutex.Lock()
+	previous, ok := s.connMap[connID]
+	if !ok {
+		s.mapMutex.Unlock()
+		return false
+	}
+	delete(s.reverseMap, connKey(previous, s.optionKeys[connID]))
+	s.connMap[connID] = connString
+	s.reverseMap[connKey(connString, s.optionKeys[connID])] = connID
+	s.secrets[connID] = secret
+	pool, exists := s.pools[connID]
+	delete(s.pools, connID)
+	s.mapMutex.Unlock()
+	if exists {
+		go pool.Close() // Close 会等待在途查询归还连接
+	}
+	return true
+}
+
+// CredentialRotator 定期调用 RotateCredentials，使 Vault/AWS Secrets Manager 中轮换的凭据及时生效。
+type CredentialRotator struct {
+	service  Service
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewCredentialRotator 根据配置创建一个新的 CredentialRotator。
+// 未配置任何凭据提供者或检查间隔为 0 时返回 nil，表示不启用。
+func NewCredentialRotator(service Service, cfg *config.Config) *CredentialRotator {
+	if cfg.CredentialRotationInterval <= 0 || len(NewCredentialProviders(cfg)) == 0 {
+		return nil
+	}
+	return &CredentialRotator{service: service, interval: cfg.CredentialRotationInterval}
+}
+
+// Start 在后台启动检查循环。对 nil CredentialRotator 调用是安全的。
+func (r *CredentialRotator) Start() {
+	if r == nil {
+		return
+	}
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	utils.DefaultLogger.Info("凭据轮换检查已启动", zap.Duration("interval", r.interval))
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+				rotations, err := r.service.RotateCredentials(ctx)
+				cancel()
+				if err != nil {
+					utils.DefaultLogger.Warn("部分连接的凭据轮换检查失败", zap.Error(err))
+				}
+				if len(rotations) > 0 {
+					utils.DefaultLogger.Info("凭据轮换检查完成", zap.Int("rotated", len(rotations)))
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止检查循环并等待其退出。对 nil CredentialRotator 调用是安全的。
+func (r *CredentialRotator) Stop() {
+	if r == nil || r.stop == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"time"
 
+	"github.com/cbc3929/pg_mcp_server/internal/core/requests"
+	"github.com/cbc3929/pg_mcp_server/internal/core/results"
 	"github.com/cbc3929/pg_mcp_server/internal/utils"
 	"go.uber.org/zap"
 
@@ -13,14 +17,31 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// acquireConn 从连接池获取连接。timeout > 0 时最多等待 timeout，连接池已满时返回明确的错误而不是一直排队，
+// 这与查询本身的执行时间 (由请求 Context 和 statement_timeout 控制) 分开计算。
+func acquireConn(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration) (*pgxpool.Conn, error) {
+	if timeout <= 0 {
+		return pool.Acquire(ctx)
+	}
+	acquireCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := pool.Acquire(acquireCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(acquireCtx.Err(), context.DeadlineExceeded) {
+		stat := pool.Stat()
+		return nil, fmt.Errorf("等待连接池空闲连接超时 (DB_ACQUIRE_TIMEOUT=%s，已占用 %d/%d 个连接): %w", timeout, stat.AcquiredConns(), stat.MaxConns(), err)
+	}
+	return conn, err
+}
+
 // executeQueryInternal 是实际执行 SQL 查询并返回结果的内部函数。
-// 它处理事务和只读模式。
-func executeQueryInternal(ctx context.Context, pool *pgxpool.Pool, readOnly bool, sql string, args ...any) ([]map[string]any, error) {
-	conn, err := pool.Acquire(ctx)
+// 它处理事务和只读模式，返回结果列的描述 (按查询中的顺序) 和结果行。
+func executeQueryInternal(ctx context.Context, pool *pgxpool.Pool, acquireTimeout time.Duration, readOnly bool, sql string, args ...any) ([]pgconn.FieldDescription, []map[string]any, error) {
+	conn, err := acquireConn(ctx, pool, acquireTimeout)
 	if err != nil {
-		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+		return nil, nil, fmt.Errorf("获取数据库连接失败: %w", err)
 	}
 	defer conn.Release() // 确保连接在使用后返回池中
+	recordBackendPID(ctx, conn.Conn().PgConn().PID())
 
 	txOptions := pgx.TxOptions{}
 	if readOnly {
@@ -35,7 +56,7 @@ func executeQueryInternal(ctx context.Context, pool *pgxpool.Pool, readOnly bool
 
 	tx, err := conn.BeginTx(ctx, txOptions)
 	if err != nil {
-		return nil, fmt.Errorf("开始数据库事务失败: %w", err)
+		return nil, nil, fmt.Errorf("开始数据库事务失败: %w", err)
 	}
 	// 确保事务最终会被处理 (回滚未提交的)
 	defer func() {
@@ -52,14 +73,15 @@ func executeQueryInternal(ctx context.Context, pool *pgxpool.Pool, readOnly bool
 		// 检查是否是 PostgreSQL 错误并提供更详细信息
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
-			return nil, fmt.Errorf("数据库查询执行错误: %s (Code: %s, Detail: %s): %w", pgErr.Message, pgErr.Code, pgErr.Detail, err)
+			return nil, nil, fmt.Errorf("数据库查询执行错误: %s (Code: %s, Detail: %s): %w", pgErr.Message, pgErr.Code, pgErr.Detail, err)
 		}
-		return nil, fmt.Errorf("数据库查询执行错误: %w", err)
+		return nil, nil, fmt.Errorf("数据库查询执行错误: %w", err)
 	}
 	defer rows.Close() // 确保 rows 被关闭
 
-	// 将结果行转换为 map 切片
-	results, err := rowsToMaps(rows)
+	// 将结果行转换为 map 切片 (FieldDescriptions 的底层数组会被下一次查询复用，需要复制)
+	fields := append([]pgconn.FieldDescription{}, rows.FieldDescriptions()...)
+	results, err := rowsToMaps(ctx, rows)
 	if err != nil {
 		// 此时查询已成功，但处理结果失败，仍然需要回滚吗？通常不需要，但可以记录错误。
 		// 这里选择不回滚，因为查询本身是成功的，只是数据转换出问题。
@@ -67,14 +89,14 @@ func executeQueryInternal(ctx context.Context, pool *pgxpool.Pool, readOnly bool
 		// 可以选择返回部分成功的结果和错误，或者直接返回错误
 		// return results, fmt.Errorf("转换查询结果失败: %w", err)
 		// 或者返回空和错误
-		return nil, fmt.Errorf("转换查询结果失败: %w", err)
+		return nil, nil, fmt.Errorf("转换查询结果失败: %w", err)
 	}
 
 	// 显式检查 rows.Err()，确保迭代过程中没有错误
 	if err := rows.Err(); err != nil {
 		utils.DefaultLogger.Error("警告: 迭代查询结果时发生错误,", zap.Error(err))
 		// 同上，可能不需要回滚，但需要报告错误
-		return nil, fmt.Errorf("迭代查询结果时发生错误: %w", err)
+		return nil, nil, fmt.Errorf("迭代查询结果时发生错误: %w", err)
 	}
 
 	// 提交事务
@@ -83,19 +105,20 @@ func executeQueryInternal(ctx context.Context, pool *pgxpool.Pool, readOnly bool
 		// 此时结果 `results` 可能不完全可靠（虽然通常数据已读出）
 		utils.DefaultLogger.Error("警告: 提交数据库事务失败", zap.Error(err))
 		// 根据业务需求决定是否返回已读取的数据和错误，或者只返回错误
-		return nil, fmt.Errorf("提交数据库事务失败: %w", err)
+		return nil, nil, fmt.Errorf("提交数据库事务失败: %w", err)
 	}
 
-	return results, nil
+	return fields, results, nil
 }
 
 // executeNonQueryInternal 是实际执行不返回结果的 SQL 命令的内部函数。
-func executeNonQueryInternal(ctx context.Context, pool *pgxpool.Pool, readOnly bool, sql string, args ...any) error {
-	conn, err := pool.Acquire(ctx)
+func executeNonQueryInternal(ctx context.Context, pool *pgxpool.Pool, acquireTimeout time.Duration, readOnly bool, sql string, args ...any) error {
+	conn, err := acquireConn(ctx, pool, acquireTimeout)
 	if err != nil {
 		return fmt.Errorf("获取数据库连接失败: %w", err)
 	}
 	defer conn.Release()
+	recordBackendPID(ctx, conn.Conn().PgConn().PID())
 
 	txOptions := pgx.TxOptions{}
 	if readOnly {
@@ -138,12 +161,86 @@ func executeNonQueryInternal(ctx context.Context, pool *pgxpool.Pool, readOnly b
 	return nil
 }
 
-// rowsToMaps 将 pgx.Rows 转换为 []map[string]any
-func rowsToMaps(rows pgx.Rows) ([]map[string]any, error) {
+// writeTxInternal 在读写事务中执行 fn，fn 返回 nil 时提交事务，否则回滚。
+func writeTxInternal(ctx context.Context, pool *pgxpool.Pool, acquireTimeout time.Duration, fn func(tx pgx.Tx) error) error {
+	conn, err := acquireConn(ctx, pool, acquireTimeout)
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	defer conn.Release()
+	recordBackendPID(ctx, conn.Conn().PgConn().PID())
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return fmt.Errorf("开始数据库事务失败: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx) // 确保未提交的事务被回滚
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		utils.DefaultLogger.Error("提交数据库事务失败,", zap.Error(err))
+		return fmt.Errorf("提交数据库事务失败: %w", err)
+	}
+	return nil
+}
+
+// copyToInternal 在只读事务中执行 COPY ... TO STDOUT，将输出写入 w，返回导出的行数。
+func copyToInternal(ctx context.Context, pool *pgxpool.Pool, acquireTimeout time.Duration, sql string, w io.Writer) (int64, error) {
+	conn, err := acquireConn(ctx, pool, acquireTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	defer conn.Release()
+	recordBackendPID(ctx, conn.Conn().PgConn().PID())
+	utils.DefaultLogger.Info("数据库操作 (COPY): 只读模式,", zap.String(" SQL:", sql))
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return 0, fmt.Errorf("开始数据库事务失败: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	commandTag, err := tx.Conn().PgConn().CopyTo(ctx, w, sql)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			return 0, fmt.Errorf("COPY 执行错误: %s (Code: %s, Detail: %s): %w", pgErr.Message, pgErr.Code, pgErr.Detail, err)
+		}
+		return 0, fmt.Errorf("COPY 执行错误: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("提交数据库事务失败: %w", err)
+	}
+	return commandTag.RowsAffected(), nil
+}
+
+// progressRowInterval 是报告已读取行数的间隔 (行)
+const progressRowInterval = 1000
+
+// rowsToMaps 将 pgx.Rows 转换为 []map[string]any，读取大结果集时向客户端报告已读取的行数
+func rowsToMaps(ctx context.Context, rows pgx.Rows) ([]map[string]any, error) {
 	fieldDescriptions := rows.FieldDescriptions()
-	var results []map[string]any
+	var resultRows []map[string]any
+
+	// pgx 不认识的类型 (扩展类型) 以文本形式返回，其中的 PostGIS geometry/geography 转换为 GeoJSON
+	extensionTypes := make([]bool, len(fieldDescriptions))
+	if conn := rows.Conn(); conn != nil {
+		for i, fd := range fieldDescriptions {
+			_, known := conn.TypeMap().TypeForOID(fd.DataTypeOID)
+			extensionTypes[i] = !known
+		}
+	}
 
 	for rows.Next() {
+		if len(resultRows) > 0 && len(resultRows)%progressRowInterval == 0 {
+			requests.ReportProgress(ctx, float64(len(resultRows)), 0, fmt.Sprintf("已读取 %d 行", len(resultRows)))
+		}
 		values, err := rows.Values()
 		if err != nil {
 			return nil, fmt.Errorf("读取行数据失败: %w", err)
@@ -151,17 +248,22 @@ func rowsToMaps(rows pgx.Rows) ([]map[string]any, error) {
 
 		rowMap := make(map[string]any, len(fieldDescriptions))
 		for i, fd := range fieldDescriptions {
-			// 需要处理可能的 NULL 值或其他类型转换问题吗？
-			// pgx 通常能处理好，但复杂类型可能需要特殊处理。
-			rowMap[fd.Name] = values[i]
+			// 其他类型在编码为 JSON 时由 results.NormalizeValue 转换
+			value := values[i]
+			if text, isText := value.(string); isText && extensionTypes[i] {
+				if geometry, ok := results.ParseEWKBHex(text); ok {
+					value = geometry
+				}
+			}
+			rowMap[fd.Name] = value
 		}
-		results = append(results, rowMap)
+		resultRows = append(resultRows, rowMap)
 	}
 
 	// 检查迭代过程中是否有错误
 	if err := rows.Err(); err != nil {
-		return results, fmt.Errorf("迭代结果行时出错: %w", err) // 可能返回部分结果和错误
+		return resultRows, fmt.Errorf("迭代结果行时出错: %w", err) // 可能返回部分结果和错误
 	}
 
-	return results, nil
+	return resultRows, nil
 }
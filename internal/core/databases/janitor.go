@@ -0,0 +1,295 @@
+package databases
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// 连接回收的原因 (ConnectionEviction.Reason)
+const (
+	EvictionIdlePool     = "idle_pool"    // 连接池空闲超过 DB_POOL_IDLE_EVICT 被关闭，connID 仍然有效，下次使用时重建
+	EvictionExpired      = "expired"      // connID 空闲超过 DB_CONN_TTL 被移除，需要重新 connect
+	EvictionDisconnected = "disconnected" // connID 被 disconnect 主动断开
+)
+
+// expiredRetention 是已过期 connID 的保留时间，期间使用该 connID 会得到明确的过期提示
+const expiredRetention = 24 * time.Hour
+
+// ConnectionEviction 是一次连接回收
+type ConnectionEviction struct {
+	ConnID  string        `json:"conn_id"`
+	Reason  string        `json:"reason"`   // EvictionIdlePool, EvictionExpired 或 EvictionDisconnected
+	IdleFor time.Duration `json:"idle_for"` // 回收时已空闲的时长
+	At      time.Time     `json:"at"`
+}
+
+// ConnectionStatus 是一个 connID 的状态
+type ConnectionStatus struct {
+	ConnID     string     `json:"conn_id"`
+	Status     string     `json:"status"`    // active, expired 或 unknown
+	PoolOpen   bool       `json:"pool_open"` // 连接池是否已创建 (空闲回收后为 false，下次使用时重建)
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // 按当前空闲情况计算的过期时间，未配置 DB_CONN_TTL 或持久连接时为空
+	ExpiredAt  *time.Time `json:"expired_at,omitempty"`
+}
+
+// 连接状态 (ConnectionStatus.Status)
+const (
+	ConnectionActive  = "active"
+	ConnectionExpired = "expired"
+	ConnectionUnknown = "unknown"
+)
+
+// connUsage 记录连接最近一次被使用的时间
+type connUsage struct {
+	lastUsed   atomic.Int64 // UnixNano
+	persistent atomic.Bool  // 不受 DB_CONN_TTL 影响
+}
+
+func newConnUsage(persistent bool) *connUsage {
+	usage := &connUsage{}
+	usage.persistent.Store(persistent)
+	usage.touch()
+	return usage
+}
+
+// touchUsage 在重复注册或使用连接时更新最近使用时间，persistent 为 true 时把连接标记为持久
+func (s *pgxService) touchUsage(connID string, persistent bool) {
+	s.mapMutex.RLock()
+	usage, ok := s.usage[connID]
+	s.mapMutex.RUnlock()
+	if !ok {
+		return
+	}
+	usage.touch()
+	if persistent {
+		usage.persistent.Store(true)
+	}
+}
+
+// touch 更新最近使用时间
+func (u *connUsage) touch() {
+	u.lastUsed.Store(time.Now().UnixNano())
+}
+
+// idleFor 返回距最近一次使用的时长
+func (u *connUsage) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, u.lastUsed.Load()))
+}
+
+// evictionListeners 保存连接回收的监听函数
+type evictionListeners struct {
+	mu        sync.RWMutex
+	listeners []func(ConnectionEviction)
+}
+
+// AddEvictionListener 实现 Service 接口。
+func (s *pgxService) AddEvictionListener(listener func(ConnectionEviction)) {
+	s.evictions.mu.Lock()
+	defer s.evictions.mu.Unlock()
+	s.evictions.listeners = append(s.evictions.listeners, listener)
+}
+
+// emitEviction 通知所有监听函数
+func (s *pgxService) emitEviction(eviction ConnectionEviction) {
+	s.evictions.mu.RLock()
+	listeners := append([]func(ConnectionEviction){}, s.evictions.listeners...)
+	s.evictions.mu.RUnlock()
+	for _, listener := range listeners {
+		listener(eviction)
+	}
+}
+
+// EvictIdleConnections 实现 Service 接口。
+func (s *pgxService) EvictIdleConnections(ctx context.Context) ([]ConnectionEviction, error) {
+	idleEvict, ttl := s.config.DBPoolIdleEvict, s.config.DBConnTTL
+	now := time.Now()
+
+	// 有在途查询的连接不回收
+	busy := make(map[string]bool)
+	for _, query := range s.tracker.list("") {
+		busy[query.ConnID] = true
+	}
+
+	s.mapMutex.Lock()
+	for connID, expiredAt := range s.expired {
+		if now.Sub(expiredAt) > expiredRetention {
+			delete(s.expired, connID)
+		}
+	}
+	usages := make(map[string]*connUsage, len(s.usage))
+	for connID, usage := range s.usage {
+		usages[connID] = usage
+	}
+	s.mapMutex.Unlock()
+
+	evictions := []ConnectionEviction{}
+	for connID, usage := range usages {
+		idle := usage.idleFor(now)
+		if busy[connID] || s.poolInUse(connID) {
+			continue
+		}
+		switch {
+		case ttl > 0 && !usage.persistent.Load() && idle >= ttl:
+			if err := s.disconnect(ctx, connID); err != nil {
+				continue // 期间已被断开
+			}
+			s.mapMutex.Lock()
+			s.expired[connID] = now
+			s.mapMutex.Unlock()
+			utils.DefaultLogger.Info("connID 空闲超过 DB_CONN_TTL，已移除", zap.String("connID", connID), zap.Duration("idle", idle))
+			evictions = append(evictions, ConnectionEviction{ConnID: connID, Reason: EvictionExpired, IdleFor: idle, At: now})
+		case idleEvict > 0 && idle >= idleEvict:
+			if !s.closeIdlePool(connID, idleEvict) {
+				continue
+			}
+			utils.DefaultLogger.Info("连接池空闲超过 DB_POOL_IDLE_EVICT，已关闭", zap.String("connID", connID), zap.Duration("idle", idle))
+			evictions = append(evictions, ConnectionEviction{ConnID: connID, Reason: EvictionIdlePool, IdleFor: idle, At: now})
+		}
+	}
+	for _, eviction := range evictions {
+		s.emitEviction(eviction)
+	}
+	return evictions, nil
+}
+
+// poolInUse 判断连接池是否有被借出的连接 (例如会话工具持有的事务连接)
+func (s *pgxService) poolInUse(connID string) bool {
+	s.mapMutex.RLock()
+	pool, exists := s.pools[connID]
+	set := s.replicaSets[connID]
+	s.mapMutex.RUnlock()
+	if exists && pool.Stat().AcquiredConns() > 0 {
+		return true
+	}
+	if set != nil {
+		for _, host := range set.replicas {
+			if host.pool.Stat().AcquiredConns() > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// closeIdlePool 关闭连接的连接池 (以及副本连接池和 SSH 隧道)，保留 connID。
+// 持有锁后再次确认仍然空闲 (GetPool 在读取连接池之前更新使用时间)，连接池不存在或期间被使用时返回 false。
+func (s *pgxService) closeIdlePool(connID string, idleEvict time.Duration) bool {
+	s.poolMutex.Lock()
+	defer s.poolMutex.Unlock()
+	s.mapMutex.Lock()
+	pool, exists := s.pools[connID]
+	usage := s.usage[connID]
+	if !exists || usage == nil || usage.idleFor(time.Now()) < idleEvict {
+		s.mapMutex.Unlock()
+		return false
+	}
+	delete(s.pools, connID)
+	s.mapMutex.Unlock()
+	go pool.Close()
+	s.dropReplicaSet(connID)
+	s.closeTunnel(connID)
+	return true
+}
+
+// unknownConnIDError 返回未注册 connID 的错误，connID 刚因空闲过期时给出明确提示
+func (s *pgxService) unknownConnIDError(connID string) error {
+	s.mapMutex.RLock()
+	expiredAt, expired := s.expired[connID]
+	s.mapMutex.RUnlock()
+	if expired {
+		return fmt.Errorf("connID %s 已于 %s 因空闲超过 DB_CONN_TTL 被移除，请重新调用 connect", connID, expiredAt.Format(time.RFC3339))
+	}
+	return fmt.Errorf("未知的 connID: %s", connID)
+}
+
+// ConnectionStatus 实现 Service 接口。
+func (s *pgxService) ConnectionStatus(connID string) ConnectionStatus {
+	s.mapMutex.RLock()
+	defer s.mapMutex.RUnlock()
+	status := ConnectionStatus{ConnID: connID, Status: ConnectionUnknown}
+	if expiredAt, expired := s.expired[connID]; expired {
+		status.Status = ConnectionExpired
+		status.ExpiredAt = &expiredAt
+		return status
+	}
+	usage, ok := s.usage[connID]
+	if !ok {
+		return status
+	}
+	status.Status = ConnectionActive
+	_, status.PoolOpen = s.pools[connID]
+	lastUsed := time.Unix(0, usage.lastUsed.Load())
+	status.LastUsedAt = &lastUsed
+	if s.config.DBConnTTL > 0 && !usage.persistent.Load() {
+		expiresAt := lastUsed.Add(s.config.DBConnTTL)
+		status.ExpiresAt = &expiresAt
+	}
+	return status
+}
+
+// ConnectionJanitor 定期关闭空闲的连接池，并移除空闲超过 TTL 的 connID。
+type ConnectionJanitor struct {
+	service  Service
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewConnectionJanitor 根据配置创建一个新的 ConnectionJanitor。
+// DB_POOL_IDLE_EVICT 和 DB_CONN_TTL 都为 0 时返回 nil，表示不启用。
+// 检查间隔为两者中较小值的四分之一，限制在 1 秒到 1 分钟之间。
+func NewConnectionJanitor(service Service, cfg *config.Config) *ConnectionJanitor {
+	shortest := cfg.DBPoolIdleEvict
+	if cfg.DBConnTTL > 0 && (shortest <= 0 || cfg.DBConnTTL < shortest) {
+		shortest = cfg.DBConnTTL
+	}
+	if shortest <= 0 {
+		return nil
+	}
+	interval := min(max(shortest/4, time.Second), time.Minute)
+	return &ConnectionJanitor{service: service, interval: interval}
+}
+
+// Start 在后台启动回收循环。对 nil ConnectionJanitor 调用是安全的。
+func (j *ConnectionJanitor) Start() {
+	if j == nil {
+		return
+	}
+	j.stop = make(chan struct{})
+	j.done = make(chan struct{})
+	utils.DefaultLogger.Info("空闲连接回收已启动", zap.Duration("interval", j.interval))
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), j.interval)
+				if _, err := j.service.EvictIdleConnections(ctx); err != nil {
+					utils.DefaultLogger.Warn("空闲连接回收失败", zap.Error(err))
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop 停止回收循环并等待其退出。对 nil ConnectionJanitor 调用是安全的。
+func (j *ConnectionJanitor) Stop() {
+	if j == nil || j.stop == nil {
+		return
+	}
+	close(j.stop)
+	<-j.done
+}
@@ -2,15 +2,23 @@ package databases
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/url" // 用于解析连接字符串，确保格式正确
+	"strconv"
 	"strings" // 字符串操作
 	"sync"    // 用于并发控制 (Mutex)
 	"time"
 
+	"github.com/cbc3929/pg_mcp_server/internal/audit"
 	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
 	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool" // pgx 连接池
 	"go.uber.org/zap"
 )
@@ -18,42 +26,139 @@ import (
 // pgxService 是 DatabaseService 接口的 pgx 实现。
 // 它管理连接池和 connID 映射。
 type pgxService struct {
-	config     *config.Config           // 应用配置
-	connMap    map[string]string        // connID -> connectionString 映射
-	reverseMap map[string]string        // connectionString -> connID 映射
-	pools      map[string]*pgxpool.Pool // connID -> pgxpool.Pool 映射
-	mapMutex   sync.RWMutex             // 保护 connMap 和 reverseMap 的读写锁
-	poolMutex  sync.Mutex               // 保护 pools 映射的互斥锁 (主要用于创建/删除pool)
+	config     *config.Config              // 应用配置
+	connMap    map[string]string           // connID -> connectionString 映射
+	reverseMap map[string]string           // 注册键 (连接字符串 + 选项指纹，见 registrationKey) -> connID 映射
+	optionKeys map[string]string           // connID -> 注册选项指纹
+	modes      map[string]string           // connID -> 访问模式 (read_only / read_write)
+	policies   map[string]sqlguard.Policy  // connID -> 连接级别的访问策略
+	secrets    map[string]*SecretSource    // connID -> 由凭据提供者管理的凭据来源 (用于轮换检查)
+	tunnelCfgs map[string]*SSHTunnelConfig // connID -> SSH 隧道配置
+	tlsCfgs    map[string]*TLSOptions      // connID -> 连接级别的 TLS 设置
+	pools      map[string]*pgxpool.Pool    // connID -> pgxpool.Pool 映射
+	tunnels    map[string]*sshTunnel       // connID -> 已建立的 SSH 隧道 (由 poolMutex 保护)
+	mapMutex   sync.RWMutex                // 保护 connMap, reverseMap, optionKeys, modes, policies, secrets, tunnelCfgs 和 tlsCfgs 的读写锁
+	poolMutex  sync.Mutex                  // 保护 pools 映射的互斥锁 (主要用于创建/删除pool)
+	tracker    *queryTracker               // 在途查询追踪
+	auditor    audit.Recorder              // 审计记录，每条执行的语句写入一条 statement 记录
+
+	customTypes map[string][]string // connID -> 需要注册编解码器的自定义类型 (schema.type)
+	typesMutex  sync.RWMutex        // 保护 customTypes
+
+	replicaAddrs map[string][]string    // connID -> 只读副本地址 (由 mapMutex 保护)
+	replicaSets  map[string]*replicaSet // connID -> 副本连接池 (由 mapMutex 保护，创建时持有 poolMutex)
+
+	usage     map[string]*connUsage // connID -> 最近使用时间 (由 mapMutex 保护)
+	expired   map[string]time.Time  // 因空闲过期被移除的 connID -> 过期时间 (由 mapMutex 保护)
+	evictions evictionListeners     // 连接回收的监听函数
+
+	globalPolicy sqlguard.Policy            // 配置中对所有连接生效的访问策略
+	schemaNames  map[string]map[string]bool // connID -> 数据库中存在的 Schema 名 (小写)，允许列表生效时用于识别 schema.table
+	guardMutex   sync.Mutex                 // 保护 schemaNames
+
+	txSessions map[string]*txSession // tx_id -> 打开的事务会话 (由 txMutex 保护)
+	txMutex    sync.Mutex
+
+	results *resultCache // 只读查询结果缓存，RESULT_CACHE_TTL 为 0 时为 nil
 }
 
 // NewPgxService 创建一个新的 pgxService 实例。
-func NewPgxService(cfg *config.Config) Service {
+// auditor 为 nil 时不记录审计日志。
+func NewPgxService(cfg *config.Config, auditor audit.Recorder) Service {
 	utils.DefaultLogger.Info("初始化 Pgx 数据库服务...")
+	if auditor == nil {
+		auditor = audit.Nop()
+	}
 	return &pgxService{
 		config:     cfg,
 		connMap:    make(map[string]string),
 		reverseMap: make(map[string]string),
+		optionKeys: make(map[string]string),
+		modes:      make(map[string]string),
+		policies:   make(map[string]sqlguard.Policy),
+		secrets:    make(map[string]*SecretSource),
+		tunnelCfgs: make(map[string]*SSHTunnelConfig),
+		tlsCfgs:    make(map[string]*TLSOptions),
 		pools:      make(map[string]*pgxpool.Pool),
+		tunnels:    make(map[string]*sshTunnel),
+		tracker:    newQueryTracker(cfg.QueryLogSize, cfg.QueryAlertThreshold),
+		auditor:    auditor,
+
+		customTypes:  make(map[string][]string),
+		replicaAddrs: make(map[string][]string),
+		replicaSets:  make(map[string]*replicaSet),
+		usage:        make(map[string]*connUsage),
+		expired:      make(map[string]time.Time),
+		globalPolicy: sqlguard.Policy{
+			AllowSchemas: cfg.AllowSchemas,
+			DenySchemas:  cfg.DenySchemas,
+			AllowTables:  cfg.AllowTables,
+			DenyTables:   cfg.DenyTables,
+		},
+		schemaNames: make(map[string]map[string]bool),
+		txSessions:  make(map[string]*txSession),
+		results:     newResultCache(cfg.ResultCacheTTL, cfg.ResultCacheMaxBytes),
 		// mapMutex 和 poolMutex 默认是零值可用
 	}
 }
 
 // RegisterConnection 实现 Service 接口。
-func (s *pgxService) RegisterConnection(ctx context.Context, connString string) (string, error) {
+func (s *pgxService) RegisterConnection(ctx context.Context, connString string, opts ConnectionOptions) (string, error) {
+	accessMode := opts.AccessMode
+	switch accessMode {
+	case "":
+		accessMode = AccessModeReadOnly
+	case AccessModeReadOnly:
+	case AccessModeReadWrite:
+		if !s.config.AllowReadWriteConnections {
+			return "", fmt.Errorf("服务端未开启 ALLOW_READ_WRITE_CONNECTIONS，不允许注册 read_write 连接")
+		}
+	default:
+		return "", fmt.Errorf("无效的 access_mode: '%s' (可选 %s, %s)", accessMode, AccessModeReadOnly, AccessModeReadWrite)
+	}
+	if err := opts.Policy.Validate(); err != nil {
+		return "", fmt.Errorf("无效的访问策略: %w", err)
+	}
+	if opts.Tunnel != nil {
+		if err := opts.Tunnel.Validate(); err != nil {
+			return "", fmt.Errorf("无效的 SSH 隧道配置: %w", err)
+		}
+		if len(opts.Replicas) > 0 {
+			return "", fmt.Errorf("暂不支持同时配置 SSH 隧道和只读副本")
+		}
+	}
+	if err := ValidateReplicas(opts.Replicas); err != nil {
+		return "", err
+	}
+	// 副本连接池复制主库的用户和密码，副本主机同样要符合 CONNECT_ALLOW_HOSTS / CONNECT_DENY_HOSTS
+	if err := CheckHostPolicy(ctx, s.config, opts.Replicas...); err != nil {
+		return "", err
+	}
+	if opts.TLS != nil {
+		if err := opts.TLS.Validate(); err != nil {
+			return "", fmt.Errorf("无效的 TLS 设置: %w", err)
+		}
+	}
+
 	// 规范化连接字符串 (例如，确保有 postgresql:// 前缀)
 	normalizedConnString, err := normalizeConnectionString(connString)
 	if err != nil {
 		return "", fmt.Errorf("无效的连接字符串格式: %w", err)
 	}
 
+	opts.AccessMode = accessMode
+	key, fingerprint := registrationKey(normalizedConnString, opts)
+
 	// --- 读锁保护检查是否存在 ---
 	s.mapMutex.RLock()
-	existingConnID, ok := s.reverseMap[normalizedConnString]
+	existingConnID, ok := s.reverseMap[key]
 	s.mapMutex.RUnlock()
 	// --- 读锁结束 ---
 
 	if ok {
 		utils.DefaultLogger.Info("连接字符串已注册，返回现有 connID:", zap.String("connID", existingConnID))
+		s.setSecret(existingConnID, opts.Secret)
+		s.touchUsage(existingConnID, opts.Persistent)
 		// 可选：尝试 Ping 一下现有连接池确保可用
 		if pool, poolExists := s.pools[existingConnID]; poolExists {
 			go func() { // 异步 Ping，不阻塞注册流程
@@ -73,38 +178,86 @@ func (s *pgxService) RegisterConnection(ctx context.Context, connString string)
 	defer s.mapMutex.Unlock()
 
 	// 双重检查，防止在获取写锁期间其他 goroutine 已经注册
-	if existingConnID, ok = s.reverseMap[normalizedConnString]; ok {
+	if existingConnID, ok = s.reverseMap[key]; ok {
 		utils.DefaultLogger.Info("连接字符串在获取写锁期间已被注册，返回现有 connID:\n", zap.String("connID", existingConnID))
+		if opts.Secret != nil {
+			s.secrets[existingConnID] = opts.Secret
+		}
+		if usage, ok := s.usage[existingConnID]; ok && opts.Persistent {
+			usage.persistent.Store(true)
+		}
 		return existingConnID, nil
 	}
 
 	// 生成新的唯一 connID
-	newConnID, err := utils.ConnectionStringToUUID(normalizedConnString) // 假设 utils 包有此函数
+	baseConnID, err := utils.ConnectionStringToUUID(normalizedConnString) // 假设 utils 包有此函数
 	if err != nil {
 		return "err", fmt.Errorf("无效的连接字符串格式: %w", err)
 	}
+	newConnID := optionsConnID(baseConnID, fingerprint)
 	// 存储映射关系
 	s.connMap[newConnID] = normalizedConnString
-	s.reverseMap[normalizedConnString] = newConnID
-	utils.DefaultLogger.Info("注册新连接:", zap.String("connID", newConnID), zap.String("connstring:", normalizedConnString[:20])) // 日志中隐藏部分连接串
+	s.reverseMap[key] = newConnID
+	s.optionKeys[newConnID] = fingerprint
+	s.modes[newConnID] = accessMode
+	s.policies[newConnID] = opts.Policy
+	if opts.Secret != nil {
+		s.secrets[newConnID] = opts.Secret
+	}
+	if opts.Tunnel != nil {
+		s.tunnelCfgs[newConnID] = opts.Tunnel
+	}
+	if opts.TLS != nil {
+		s.tlsCfgs[newConnID] = opts.TLS
+	}
+	if len(opts.Replicas) > 0 {
+		s.replicaAddrs[newConnID] = opts.Replicas
+	}
+	s.usage[newConnID] = newConnUsage(opts.Persistent)
+	delete(s.expired, newConnID)
+	utils.DefaultLogger.Info("注册新连接:", zap.String("connID", newConnID), zap.String("connstring:", normalizedConnString[:20]), zap.String("accessMode", accessMode)) // 日志中隐藏部分连接串
 
 	return newConnID, nil
 }
 
 // DisconnectConnection 实现 Service 接口。
 func (s *pgxService) DisconnectConnection(ctx context.Context, connID string) error {
+	if err := s.disconnect(ctx, connID); err != nil {
+		return err
+	}
+	s.emitEviction(ConnectionEviction{ConnID: connID, Reason: EvictionDisconnected, At: time.Now()})
+	return nil
+}
+
+// disconnect 移除 connID 并关闭其连接池，不通知回收监听函数 (由调用方按原因通知)
+func (s *pgxService) disconnect(ctx context.Context, connID string) error {
 	s.mapMutex.Lock() // 获取写锁，因为要修改映射
 	connString, ok := s.connMap[connID]
 	if ok {
 		delete(s.connMap, connID)
-		delete(s.reverseMap, connString) // 清理反向映射
+		delete(s.reverseMap, connKey(connString, s.optionKeys[connID])) // 清理反向映射
+		delete(s.optionKeys, connID)
+		delete(s.modes, connID)
+		delete(s.policies, connID)
+		delete(s.secrets, connID)
+		delete(s.tunnelCfgs, connID)
+		delete(s.tlsCfgs, connID)
+		delete(s.replicaAddrs, connID)
+		delete(s.usage, connID)
 	}
 	s.mapMutex.Unlock() // 释放映射锁
 
+	s.guardMutex.Lock()
+	delete(s.schemaNames, connID)
+	s.guardMutex.Unlock()
+
 	if !ok {
 		utils.DefaultLogger.Error("警告: 尝试断开未注册的:", zap.String("connID", connID))
 		return errors.New("未知的 connID") // 或者返回 nil 允许幂等操作？根据需求决定
 	}
+	// 事务会话持有的连接不归还就无法关闭连接池
+	s.closeTxSessions(connID, TxEndDisconnected)
+	s.results.invalidate(connID)
 
 	utils.DefaultLogger.Info("正在断开连接:", zap.String("connID", connID))
 
@@ -122,21 +275,132 @@ func (s *pgxService) DisconnectConnection(ctx context.Context, connID string) er
 		utils.DefaultLogger.Warn("警告: 连接池不存在或已被关闭",
 			zap.String("connID", connID))
 	}
+	s.dropReplicaSet(connID)
+	// 连接池关闭后再拆除隧道
+	s.closeTunnel(connID)
 	// --- Pool 锁结束 ---
 
 	return nil
 }
 
+// AccessMode 实现 Service 接口。
+func (s *pgxService) AccessMode(connID string) (string, error) {
+	s.mapMutex.RLock()
+	defer s.mapMutex.RUnlock()
+	if _, ok := s.connMap[connID]; !ok {
+		return "", fmt.Errorf("未知的 connID: %s", connID)
+	}
+	if mode, ok := s.modes[connID]; ok {
+		return mode, nil
+	}
+	return AccessModeReadOnly, nil
+}
+
+// Policies 实现 Service 接口。
+func (s *pgxService) Policies(connID string) sqlguard.Policies {
+	s.mapMutex.RLock()
+	defer s.mapMutex.RUnlock()
+	policies := sqlguard.Policies{}
+	if !s.globalPolicy.IsZero() {
+		policies = append(policies, s.globalPolicy)
+	}
+	if policy, ok := s.policies[connID]; ok && !policy.IsZero() {
+		policies = append(policies, policy)
+	}
+	return policies
+}
+
+// CheckPolicy 实现 Service 接口。
+func (s *pgxService) CheckPolicy(ctx context.Context, connID string, statements ...string) error {
+	if s.Policies(connID).IsZero() {
+		return nil
+	}
+	pool, err := s.GetPool(ctx, connID)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if err := s.checkPolicy(ctx, connID, pool, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPolicy 按连接的访问策略检查查询文本，拒绝引用被禁止对象的查询
+func (s *pgxService) checkPolicy(ctx context.Context, connID string, pool *pgxpool.Pool, sql string) error {
+	policies := s.Policies(connID)
+	if policies.IsZero() {
+		return nil
+	}
+	var isSchema func(string) bool
+	if policies.HasAllowRules() {
+		names, err := s.schemaNamesFor(ctx, connID, pool)
+		if err != nil {
+			return fmt.Errorf("加载 Schema 列表失败 (访问策略检查): %w", err)
+		}
+		isSchema = func(name string) bool { return names[strings.ToLower(name)] }
+	}
+	if err := policies.CheckQuery(sql, isSchema); err != nil {
+		utils.DefaultLogger.Warn("查询被访问策略拒绝", zap.String("connID", connID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// schemaNamesFor 返回数据库中存在的 Schema 名 (小写)，首次调用时查询 pg_namespace 并缓存
+func (s *pgxService) schemaNamesFor(ctx context.Context, connID string, pool *pgxpool.Pool) (map[string]bool, error) {
+	s.guardMutex.Lock()
+	names, ok := s.schemaNames[connID]
+	s.guardMutex.Unlock()
+	if ok {
+		return names, nil
+	}
+	_, rows, err := executeQueryInternal(ctx, pool, s.config.DBAcquireTimeout, true, "SELECT lower(nspname) AS name FROM pg_catalog.pg_namespace")
+	if err != nil {
+		return nil, err
+	}
+	names = make(map[string]bool, len(rows))
+	for _, row := range rows {
+		if name, ok := row["name"].(string); ok {
+			names[name] = true
+		}
+	}
+	s.guardMutex.Lock()
+	s.schemaNames[connID] = names
+	s.guardMutex.Unlock()
+	return names, nil
+}
+
+// checkWritable 在请求读写事务时确认连接不是只读模式
+func (s *pgxService) checkWritable(connID string, readOnly bool) error {
+	if readOnly {
+		return nil
+	}
+	mode, err := s.AccessMode(connID)
+	if err != nil {
+		return err
+	}
+	if mode != AccessModeReadWrite {
+		return fmt.Errorf("%w (connID: %s)", ErrReadOnlyConnection, connID)
+	}
+	return nil
+}
+
 // GetPool 实现 Service 接口。
 func (s *pgxService) GetPool(ctx context.Context, connID string) (*pgxpool.Pool, error) {
 	// --- 读锁保护获取连接字符串 ---
 	s.mapMutex.RLock()
 	connString, ok := s.connMap[connID]
+	usage := s.usage[connID]
 	s.mapMutex.RUnlock()
 	// --- 读锁结束 ---
 
 	if !ok {
-		return nil, fmt.Errorf("未知的 connID: %s", connID)
+		return nil, s.unknownConnIDError(connID)
+	}
+	if usage != nil {
+		usage.touch() // 所有查询都经过 GetPool，用于空闲回收
 	}
 
 	// --- 再次读锁检查 Pool 是否已存在 (避免获取更重的 poolMutex) ---
@@ -166,6 +430,11 @@ func (s *pgxService) GetPool(ctx context.Context, connID string) (*pgxpool.Pool,
 	utils.DefaultLogger.Info("连接池不存在，为创建新连接池...",
 		zap.String("connID", connID),
 	)
+	// 连接级别的 TLS 设置和全局默认值写入连接字符串，由 ParseConfig 生成 TLS 配置
+	connString, err := s.poolConnString(connID, connString)
+	if err != nil {
+		return nil, err
+	}
 	poolConfig, err := pgxpool.ParseConfig(connString)
 	if err != nil {
 		return nil, fmt.Errorf("解析连接字符串失败 (connID: %s): %w", connID, err)
@@ -176,6 +445,26 @@ func (s *pgxService) GetPool(ctx context.Context, connID string) (*pgxpool.Pool,
 	poolConfig.MinConns = int32(s.config.DBMinOpenConns)
 	poolConfig.MaxConnLifetime = s.config.DBConnMaxLifetime
 	poolConfig.MaxConnIdleTime = s.config.DBConnMaxIdleTime
+	// 连接字符串中的 connect_timeout / statement_timeout 优先于全局配置
+	if poolConfig.ConnConfig.ConnectTimeout == 0 && s.config.DBDialTimeout > 0 {
+		poolConfig.ConnConfig.ConnectTimeout = s.config.DBDialTimeout
+	}
+	_, explicit := poolConfig.ConnConfig.RuntimeParams["statement_timeout"]
+	explicit = explicit || strings.Contains(poolConfig.ConnConfig.RuntimeParams["options"], "statement_timeout")
+	if !explicit && s.config.DBStatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(s.config.DBStatementTimeout.Milliseconds(), 10)
+	}
+	// 新连接建立后注册自定义类型 (枚举, 域, 复合类型) 的编解码器
+	poolConfig.AfterConnect = s.afterConnect(connID)
+	// 访问策略限制了可用 Schema 时，让未限定 Schema 的表名只能解析到允许的 Schema
+	if searchPath := s.Policies(connID).SearchPath(); searchPath != "" {
+		poolConfig.ConnConfig.RuntimeParams["search_path"] = searchPath
+		utils.DefaultLogger.Info("按访问策略设置 search_path", zap.String("connID", connID), zap.String("searchPath", searchPath))
+	}
+	// 配置了 SSH 隧道时，连接池连接到本地转发端口
+	if err := s.applyTunnel(connID, poolConfig); err != nil {
+		return nil, err
+	}
 
 	// 创建连接池
 	// 使用 context.Background() 创建，因为池的生命周期与应用相关，不应被单个请求取消
@@ -196,28 +485,274 @@ func (s *pgxService) GetPool(ctx context.Context, connID string) (*pgxpool.Pool,
 
 // ExecuteQuery 实现 Service 接口，委托给 executor。
 func (s *pgxService) ExecuteQuery(ctx context.Context, connID string, readOnly bool, sql string, args ...any) ([]map[string]any, error) {
+	if err := s.checkWritable(connID, readOnly); err != nil {
+		return nil, err
+	}
 	pool, err := s.GetPool(ctx, connID)
 	if err != nil {
 		return nil, fmt.Errorf("获取连接池失败 (connID: %s): %w", connID, err)
 	}
+	if err := s.checkPolicy(ctx, connID, pool, sql); err != nil {
+		return nil, err
+	}
+	ctx, done := s.tracker.track(ctx, connID, sql, readOnly)
+	started := time.Now()
 	// 调用 executor.go 中的内部执行函数
-	return executeQueryInternal(ctx, pool, readOnly, sql, args...)
+	var results []map[string]any
+	if readOnly {
+		// 只读查询可以路由到只读副本
+		err = s.routeRead(ctx, connID, pool, func(pool *pgxpool.Pool) (bool, error) {
+			var runErr error
+			_, results, runErr = executeQueryInternal(ctx, pool, s.config.DBAcquireTimeout, readOnly, sql, args...)
+			return true, runErr
+		})
+	} else {
+		_, results, err = executeQueryInternal(ctx, pool, s.config.DBAcquireTimeout, readOnly, sql, args...)
+	}
+	done(err)
+	s.auditStatement(connID, sql, args, started, audit.RowCount(int64(len(results))), err)
+	if !readOnly {
+		s.results.invalidate(connID)
+	}
+	return results, err
+}
+
+// QueryWithColumns 实现 Service 接口，委托给 executor。
+func (s *pgxService) QueryWithColumns(ctx context.Context, connID string, readOnly bool, sql string, args ...any) (*QueryResult, error) {
+	if err := s.checkWritable(connID, readOnly); err != nil {
+		return nil, err
+	}
+	pool, err := s.GetPool(ctx, connID)
+	if err != nil {
+		return nil, fmt.Errorf("获取连接池失败 (connID: %s): %w", connID, err)
+	}
+	if err := s.checkPolicy(ctx, connID, pool, sql); err != nil {
+		return nil, err
+	}
+	// 访问检查之后才查找缓存，策略变化后不会返回已被禁止的结果
+	cacheKey, cacheable := "", readOnly && s.results != nil && useResultCache(ctx)
+	if cacheable {
+		cacheKey, cacheable = resultCacheKeyFor(connID, sql, args)
+	}
+	if cacheable {
+		if cached, cachedAt, ok := s.results.get(cacheKey); ok {
+			cached.CachedAt = cachedAt
+			utils.DefaultLogger.Debug("查询命中结果缓存", zap.String("connID", connID), zap.Time("cachedAt", cachedAt))
+			s.auditCacheHit(connID, sql, args, cachedAt, int64(len(cached.Rows)))
+			return cached, nil
+		}
+	}
+	ctx, done := s.tracker.track(ctx, connID, sql, readOnly)
+	started := time.Now()
+	var fields []pgconn.FieldDescription
+	var results []map[string]any
+	if readOnly {
+		err = s.routeRead(ctx, connID, pool, func(pool *pgxpool.Pool) (bool, error) {
+			var runErr error
+			fields, results, runErr = executeQueryInternal(ctx, pool, s.config.DBAcquireTimeout, readOnly, sql, args...)
+			return true, runErr
+		})
+	} else {
+		fields, results, err = executeQueryInternal(ctx, pool, s.config.DBAcquireTimeout, readOnly, sql, args...)
+	}
+	done(err)
+	s.auditStatement(connID, sql, args, started, audit.RowCount(int64(len(results))), err)
+	if !readOnly {
+		s.results.invalidate(connID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryResult{
+		Columns: make([]string, len(fields)),
+		Sources: make([]ColumnSource, len(fields)),
+		Rows:    results,
+	}
+	for i, field := range fields {
+		result.Columns[i] = field.Name
+		result.Sources[i] = ColumnSource{TableOID: field.TableOID, Attribute: field.TableAttributeNumber}
+	}
+	if cacheable {
+		s.results.put(cacheKey, connID, result)
+	}
+	return result, nil
+}
+
+// ResultCacheStats 实现 Service 接口。
+func (s *pgxService) ResultCacheStats() ResultCacheStats {
+	return s.results.stats()
 }
 
 // ExecuteNonQuery 实现 Service 接口，委托给 executor。
 func (s *pgxService) ExecuteNonQuery(ctx context.Context, connID string, readOnly bool, sql string, args ...any) error {
+	if err := s.checkWritable(connID, readOnly); err != nil {
+		return err
+	}
 	pool, err := s.GetPool(ctx, connID)
 	if err != nil {
 		return fmt.Errorf("获取连接池失败 (connID: %s): %w", connID, err)
 	}
+	if err := s.checkPolicy(ctx, connID, pool, sql); err != nil {
+		return err
+	}
+	ctx, done := s.tracker.track(ctx, connID, sql, readOnly)
+	started := time.Now()
 	// 调用 executor.go 中的内部执行函数
-	return executeNonQueryInternal(ctx, pool, readOnly, sql, args...)
+	err = executeNonQueryInternal(ctx, pool, s.config.DBAcquireTimeout, readOnly, sql, args...)
+	done(err)
+	s.auditStatement(connID, sql, args, started, nil, err)
+	if !readOnly {
+		s.results.invalidate(connID)
+	}
+	return err
+}
+
+// WriteTx 实现 Service 接口。
+func (s *pgxService) WriteTx(ctx context.Context, connID string, statements []string, fn func(tx pgx.Tx) error) error {
+	if err := s.checkWritable(connID, false); err != nil {
+		return err
+	}
+	pool, err := s.GetPool(ctx, connID)
+	if err != nil {
+		return fmt.Errorf("获取连接池失败 (connID: %s): %w", connID, err)
+	}
+	for _, statement := range statements {
+		if err := s.checkPolicy(ctx, connID, pool, statement); err != nil {
+			return err
+		}
+	}
+	sql := strings.Join(statements, ";\n")
+	ctx, done := s.tracker.track(ctx, connID, sql, false)
+	started := time.Now()
+	utils.DefaultLogger.Warn("数据库操作 (WriteTx): 读写模式! ", zap.String(" SQL:", sql))
+	err = writeTxInternal(ctx, pool, s.config.DBAcquireTimeout, fn)
+	done(err)
+	s.auditStatement(connID, sql, nil, started, nil, err)
+	// 提交出错时无法确定事务是否已生效，无论结果如何都清除缓存
+	s.results.invalidate(connID)
+	return err
+}
+
+// CopyTo 实现 Service 接口，委托给 executor。
+func (s *pgxService) CopyTo(ctx context.Context, connID string, sql string, w io.Writer) (int64, error) {
+	pool, err := s.GetPool(ctx, connID)
+	if err != nil {
+		return 0, fmt.Errorf("获取连接池失败 (connID: %s): %w", connID, err)
+	}
+	if err := s.checkPolicy(ctx, connID, pool, sql); err != nil {
+		return 0, err
+	}
+	ctx, done := s.tracker.track(ctx, connID, sql, true)
+	started := time.Now()
+	var rowCount int64
+	err = s.routeRead(ctx, connID, pool, func(pool *pgxpool.Pool) (bool, error) {
+		// 已经写出部分数据时不能改由主库重试
+		counter := &countingWriter{w: w}
+		var runErr error
+		rowCount, runErr = copyToInternal(ctx, pool, s.config.DBAcquireTimeout, sql, counter)
+		return counter.n == 0, runErr
+	})
+	done(err)
+	s.auditStatement(connID, sql, nil, started, audit.RowCount(rowCount), err)
+	return rowCount, err
+}
+
+// auditStatement 为一条执行完成的语句写入审计记录；rows 为 nil 表示行数未知
+func (s *pgxService) auditStatement(connID, sql string, args []any, started time.Time, rows *int64, err error) {
+	if !audit.Enabled(s.auditor) {
+		return
+	}
+	entry := audit.Entry{
+		Timestamp:  started,
+		Kind:       audit.KindStatement,
+		ConnID:     connID,
+		SQL:        sql,
+		Params:     audit.StatementParams(args),
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Rows = rows
+	}
+	s.auditor.Record(entry)
+}
+
+// auditCacheHit 为命中结果缓存的查询写入审计记录，Extra 中标明结果来自缓存及其生成时间
+func (s *pgxService) auditCacheHit(connID, sql string, args []any, cachedAt time.Time, rows int64) {
+	if !audit.Enabled(s.auditor) {
+		return
+	}
+	s.auditor.Record(audit.Entry{
+		Timestamp: time.Now(),
+		Kind:      audit.KindStatement,
+		ConnID:    connID,
+		SQL:       sql,
+		Params:    audit.StatementParams(args),
+		Rows:      audit.RowCount(rows),
+		Extra:     map[string]any{"cache_hit": true, "cached_at": cachedAt},
+	})
+}
+
+// ListActiveQueries 实现 Service 接口。
+func (s *pgxService) ListActiveQueries(connID string) []ActiveQuery {
+	return s.tracker.list(connID)
+}
+
+// RecentQueries 实现 Service 接口。
+func (s *pgxService) RecentQueries(connID string) []QueryLogEntry {
+	return s.tracker.recent(connID)
+}
+
+// cancelGracePeriod 是取消 context 后等待查询结束的时间，超过后才调用 pg_cancel_backend 兜底
+const cancelGracePeriod = 2 * time.Second
+
+// CancelQuery 实现 Service 接口。
+func (s *pgxService) CancelQuery(ctx context.Context, queryID string) (*ActiveQuery, error) {
+	info, cancel, ok := s.tracker.get(queryID)
+	if !ok {
+		return nil, fmt.Errorf("未找到在途查询 (queryID: %s)，可能已执行完成", queryID)
+	}
+	utils.DefaultLogger.Warn("正在取消在途查询", zap.String("queryID", queryID), zap.String("connID", info.ConnID), zap.Uint32("backendPID", info.BackendPID))
+
+	// 1. 取消 context，pgx 会检测到并向服务端发送 CancelRequest
+	cancel()
+	info.ElapsedMs = time.Since(info.StartedAt).Milliseconds()
+	if info.BackendPID == 0 || s.tracker.waitFinished(ctx, queryID, cancelGracePeriod) {
+		return &info, nil
+	}
+
+	// 2. 宽限时间内查询仍未结束时调用 pg_cancel_backend 兜底 (不经过 tracker，避免追踪自身)。
+	// 连接归还连接池后同一后端可能已经在执行其他查询: 只有 tracker 仍显示该查询在这个后端上执行，
+	// 且 pg_stat_activity 中该后端正在执行同一条 SQL 时才取消。
+	if !s.tracker.runningOn(queryID, info.BackendPID) {
+		return &info, nil
+	}
+	// 查询在只读副本上执行时，必须在同一主机上取消
+	pool, err := s.hostPool(ctx, info.ConnID, info.Host)
+	if err != nil {
+		return &info, fmt.Errorf("context 已取消，但获取连接池失败，未能调用 pg_cancel_backend: %w", err)
+	}
+	// pg_stat_activity.query 可能被 track_activity_query_size 截断，按前缀比较
+	_, rows, err := executeQueryInternal(ctx, pool, s.config.DBAcquireTimeout, true,
+		`SELECT pg_cancel_backend(pid) AS cancelled FROM pg_stat_activity
+         WHERE pid = $1 AND state = 'active' AND query <> '' AND left($2::text, length(query)) = query`,
+		int32(info.BackendPID), info.SQL)
+	if err != nil {
+		utils.DefaultLogger.Warn("调用 pg_cancel_backend 失败 (context 已取消)", zap.String("queryID", queryID), zap.Error(err))
+		return &info, fmt.Errorf("context 已取消，但 pg_cancel_backend 调用失败: %w", err)
+	}
+	if len(rows) == 0 {
+		utils.DefaultLogger.Info("后端已不在执行该查询，跳过 pg_cancel_backend", zap.String("queryID", queryID), zap.Uint32("backendPID", info.BackendPID))
+	}
+	return &info, nil
 }
 
 // CloseAll 实现 Service 接口。
 func (s *pgxService) CloseAll(ctx context.Context) error {
 	utils.DefaultLogger.Info("关闭所有连接池...")
 	var MError error // 用于收集关闭过程中的错误
+	s.closeTxSessions("", TxEndDisconnected)
 
 	s.poolMutex.Lock() // 锁住 pool map 进行迭代和删除
 	s.mapMutex.Lock()  // 同时锁住 map，因为要清空
@@ -228,17 +763,71 @@ func (s *pgxService) CloseAll(ctx context.Context) error {
 		utils.DefaultLogger.Info("关闭连接池:", zap.String("connID", connID))
 		pool.Close() // 同步关闭
 	}
+	for _, set := range s.replicaSets {
+		set.close()
+	}
+	for connID := range s.tunnels {
+		s.closeTunnel(connID)
+	}
 
 	// 清空所有映射
 	s.pools = make(map[string]*pgxpool.Pool)
 	s.connMap = make(map[string]string)
 	s.reverseMap = make(map[string]string)
+	s.optionKeys = make(map[string]string)
+	s.secrets = make(map[string]*SecretSource)
+	s.tunnelCfgs = make(map[string]*SSHTunnelConfig)
+	s.tlsCfgs = make(map[string]*TLSOptions)
+	s.replicaAddrs = make(map[string][]string)
+	s.replicaSets = make(map[string]*replicaSet)
+	s.usage = make(map[string]*connUsage)
 	utils.DefaultLogger.Info("所有数据库连接池已关闭。")
 	return MError // 返回收集到的错误（如果需要更精细的错误处理）
 }
 
 // --- 内部辅助函数 ---
 
+// registrationKey 返回连接注册的去重键和选项指纹。去重键由连接字符串和指纹组成，指纹包含
+// 注册后不能再由其他 connect 修改的选项 (访问模式、只读副本、访问策略、TLS 设置、SSH 隧道)：选项不同的注册得到不同的 connID，
+// 一个会话的 connect 不会改变 (例如开启写入、放宽策略、降级 TLS 或改道隧道) 其他会话正在使用的同一连接。
+// opts.AccessMode 必须已规范化，只读模式不写入指纹，保持只读连接的 connID 不变。
+func registrationKey(normalized string, opts ConnectionOptions) (key, fingerprint string) {
+	var parts []string
+	if opts.AccessMode == AccessModeReadWrite {
+		parts = append(parts, "mode="+opts.AccessMode)
+	}
+	if len(opts.Replicas) > 0 {
+		parts = append(parts, "replicas="+strings.Join(opts.Replicas, ","))
+	}
+	// 两者都只包含字符串，序列化不会失败
+	if !opts.Policy.IsZero() {
+		policy, _ := json.Marshal(opts.Policy)
+		parts = append(parts, "policy="+string(policy))
+	}
+	if opts.TLS != nil && *opts.TLS != (TLSOptions{}) {
+		tlsOptions, _ := json.Marshal(opts.TLS)
+		parts = append(parts, "tls="+string(tlsOptions))
+	}
+	if opts.Tunnel != nil {
+		parts = append(parts, "tunnel="+opts.Tunnel.fingerprint())
+	}
+	fingerprint = strings.Join(parts, "\n")
+	return connKey(normalized, fingerprint), fingerprint
+}
+
+// connKey 返回 reverseMap 中的注册键
+func connKey(connString, fingerprint string) string {
+	return connString + "\x00" + fingerprint
+}
+
+// optionsConnID 由连接字符串的 connID 和选项指纹派生出注册的 connID，没有选项时保持原 connID 不变
+func optionsConnID(baseConnID, fingerprint string) string {
+	if fingerprint == "" {
+		return baseConnID
+	}
+	return uuid.NewSHA1(uuid.MustParse(baseConnID), []byte(fingerprint)).String()
+}
+
 // normalizeConnectionString 确保连接字符串以 "postgresql://" 开头
 func normalizeConnectionString(connString string) (string, error) {
 	trimmed := strings.TrimSpace(connString)
@@ -0,0 +1,44 @@
+package databases
+
+import "github.com/jackc/pgx/v5/pgxpool"
+
+// PoolStats 是连接池状态的快照 (pgxpool.Stat 的可序列化形式)，用于判断连接池是否已经饱和
+type PoolStats struct {
+	MaxConns                int32   `json:"max_conns"`                  // 连接池允许的最大连接数
+	TotalConns              int32   `json:"total_conns"`                // 当前连接总数 (使用中 + 空闲 + 建立中)
+	AcquiredConns           int32   `json:"acquired_conns"`             // 正在被使用的连接数
+	IdleConns               int32   `json:"idle_conns"`                 // 空闲连接数
+	ConstructingConns       int32   `json:"constructing_conns"`         // 正在建立的连接数
+	AcquireCount            int64   `json:"acquire_count"`              // 累计成功获取连接的次数
+	AcquireDurationMs       float64 `json:"acquire_duration_ms"`        // 累计等待获取连接的时间 (毫秒)
+	AvgAcquireDurationMs    float64 `json:"avg_acquire_duration_ms"`    // 平均每次获取连接的等待时间 (毫秒)
+	EmptyAcquireCount       int64   `json:"empty_acquire_count"`        // 获取连接时没有空闲连接、需要等待或新建的次数
+	CanceledAcquireCount    int64   `json:"canceled_acquire_count"`     // 等待连接时被取消 (超时) 的次数
+	NewConnsCount           int64   `json:"new_conns_count"`            // 累计新建的连接数
+	MaxLifetimeDestroyCount int64   `json:"max_lifetime_destroy_count"` // 因超过最大生存时间被关闭的连接数
+	MaxIdleDestroyCount     int64   `json:"max_idle_destroy_count"`     // 因超过最大空闲时间被关闭的连接数
+	Saturated               bool    `json:"saturated"`                  // 所有连接都在使用中且已达到上限
+}
+
+// NewPoolStats 从 pgxpool.Stat 生成快照
+func NewPoolStats(stat *pgxpool.Stat) PoolStats {
+	stats := PoolStats{
+		MaxConns:                stat.MaxConns(),
+		TotalConns:              stat.TotalConns(),
+		AcquiredConns:           stat.AcquiredConns(),
+		IdleConns:               stat.IdleConns(),
+		ConstructingConns:       stat.ConstructingConns(),
+		AcquireCount:            stat.AcquireCount(),
+		AcquireDurationMs:       float64(stat.AcquireDuration().Microseconds()) / 1000,
+		EmptyAcquireCount:       stat.EmptyAcquireCount(),
+		CanceledAcquireCount:    stat.CanceledAcquireCount(),
+		NewConnsCount:           stat.NewConnsCount(),
+		MaxLifetimeDestroyCount: stat.MaxLifetimeDestroyCount(),
+		MaxIdleDestroyCount:     stat.MaxIdleDestroyCount(),
+	}
+	if stats.AcquireCount > 0 {
+		stats.AvgAcquireDurationMs = stats.AcquireDurationMs / float64(stats.AcquireCount)
+	}
+	stats.Saturated = stats.MaxConns > 0 && stats.AcquiredConns >= stats.MaxConns
+	return stats
+}
@@ -0,0 +1,423 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// 主机角色 (HostStats.Role)
+const (
+	HostRolePrimary = "primary"
+	HostRoleReplica = "replica"
+)
+
+// HostStats 是连接中一个主机 (主库或只读副本) 的路由状态
+type HostStats struct {
+	Host        string     `json:"host"`                    // host:port
+	Role        string     `json:"role"`                    // primary 或 replica
+	Healthy     bool       `json:"healthy"`                 // 副本是否参与路由 (主库始终为 true)
+	Queries     int64      `json:"queries"`                 // 路由到该主机的只读查询数
+	Failures    int64      `json:"failures"`                // 连接失败次数 (查询失败后改由主库执行)
+	LastError   string     `json:"last_error,omitempty"`    // 最近一次连接失败或健康检查失败的错误
+	LastCheckAt *time.Time `json:"last_check_at,omitempty"` // 最近一次健康检查的时间
+	Pool        PoolStats  `json:"pool"`                    // 该主机的连接池状态
+}
+
+// replicaHost 是一个只读副本及其连接池
+type replicaHost struct {
+	addr string
+	pool *pgxpool.Pool
+
+	mu        sync.Mutex
+	healthy   bool
+	queries   int64
+	failures  int64
+	lastError string
+	lastCheck time.Time
+}
+
+// isHealthy 返回副本当前是否参与路由
+func (h *replicaHost) isHealthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.healthy
+}
+
+// recordQuery 记录一次路由到该主机的查询
+func (h *replicaHost) recordQuery() {
+	h.mu.Lock()
+	h.queries++
+	h.mu.Unlock()
+}
+
+// markUnhealthy 把副本移出路由，直到健康检查恢复
+func (h *replicaHost) markUnhealthy(err error) {
+	h.mu.Lock()
+	h.healthy = false
+	h.failures++
+	h.lastError = err.Error()
+	h.mu.Unlock()
+}
+
+// stats 返回主机状态快照
+func (h *replicaHost) stats(role string, pool *pgxpool.Pool) HostStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stats := HostStats{
+		Host:      h.addr,
+		Role:      role,
+		Healthy:   h.healthy,
+		Queries:   h.queries,
+		Failures:  h.failures,
+		LastError: h.lastError,
+		Pool:      NewPoolStats(pool.Stat()),
+	}
+	if !h.lastCheck.IsZero() {
+		lastCheck := h.lastCheck
+		stats.LastCheckAt = &lastCheck
+	}
+	return stats
+}
+
+// replicaSet 是一个连接的主库和只读副本。副本连接池由主库连接池的配置派生，
+// 主库连接池重建 (策略变更、凭据轮换) 后副本连接池随之重建。
+type replicaSet struct {
+	primary     *pgxpool.Pool // 派生副本连接池时的主库连接池
+	primaryHost *replicaHost  // 主库的统计 (pool 为 primary)
+	replicas    []*replicaHost
+	next        atomic.Uint64 // 轮询位置
+}
+
+// pick 按轮询选择一个健康的副本，全部不可用时返回 nil
+func (rs *replicaSet) pick() *replicaHost {
+	n := uint64(len(rs.replicas))
+	start := rs.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if host := rs.replicas[(start+i)%n]; host.isHealthy() {
+			return host
+		}
+	}
+	return nil
+}
+
+// close 关闭所有副本连接池 (主库连接池由 pools 管理)
+func (rs *replicaSet) close() {
+	for _, host := range rs.replicas {
+		host.pool.Close()
+	}
+}
+
+// ValidateReplicas 检查副本地址 (host 或 host:port，IPv6 使用 [addr]:port)
+func ValidateReplicas(replicas []string) error {
+	for _, addr := range replicas {
+		if _, _, err := parseHostAddr(addr, 5432); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseHostAddr 解析 host[:port]，未指定端口时使用 defaultPort
+func parseHostAddr(addr string, defaultPort uint16) (string, uint16, error) {
+	if addr == "" || strings.ContainsAny(addr, "/@?, ") {
+		return "", 0, fmt.Errorf("无效的副本地址 '%s' (格式为 host 或 host:port)", addr)
+	}
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		// 没有端口 (包括不带方括号的 IPv6 地址)
+		return strings.Trim(addr, "[]"), defaultPort, nil
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil || port == 0 || host == "" {
+		return "", 0, fmt.Errorf("无效的副本地址 '%s' (格式为 host 或 host:port)", addr)
+	}
+	return host, uint16(port), nil
+}
+
+// dropReplicaSet 移除并关闭连接的副本连接池。调用方必须持有 poolMutex。
+func (s *pgxService) dropReplicaSet(connID string) {
+	s.mapMutex.Lock()
+	set, exists := s.replicaSets[connID]
+	delete(s.replicaSets, connID)
+	s.mapMutex.Unlock()
+	if exists {
+		set.close()
+	}
+}
+
+// replicaSetFor 返回连接的副本集合，未配置副本时返回 nil。
+// 副本连接池按需创建，主库连接池变化后重新创建。
+func (s *pgxService) replicaSetFor(ctx context.Context, connID string) (*replicaSet, error) {
+	s.mapMutex.RLock()
+	addrs := s.replicaAddrs[connID]
+	s.mapMutex.RUnlock()
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	primary, err := s.GetPool(ctx, connID)
+	if err != nil {
+		return nil, err
+	}
+	s.mapMutex.RLock()
+	set := s.replicaSets[connID]
+	s.mapMutex.RUnlock()
+	if set != nil && set.primary == primary {
+		return set, nil
+	}
+
+	s.poolMutex.Lock()
+	defer s.poolMutex.Unlock()
+	s.mapMutex.RLock()
+	set = s.replicaSets[connID]
+	addrs = s.replicaAddrs[connID]
+	s.mapMutex.RUnlock()
+	if set != nil && set.primary == primary {
+		return set, nil
+	}
+	if len(addrs) == 0 {
+		return nil, nil // 等待锁期间连接已断开
+	}
+
+	primaryConfig := primary.Config()
+	next := &replicaSet{
+		primary:     primary,
+		primaryHost: &replicaHost{addr: net.JoinHostPort(primaryConfig.ConnConfig.Host, strconv.Itoa(int(primaryConfig.ConnConfig.Port))), pool: primary, healthy: true},
+	}
+	for _, addr := range addrs {
+		host, port, err := parseHostAddr(addr, primaryConfig.ConnConfig.Port)
+		if err != nil {
+			next.close()
+			return nil, err
+		}
+		replicaConfig := primary.Config()
+		replicaConfig.ConnConfig.Host = host
+		replicaConfig.ConnConfig.Port = port
+		replicaConfig.ConnConfig.Fallbacks = nil
+		if replicaConfig.ConnConfig.TLSConfig != nil {
+			replicaConfig.ConnConfig.TLSConfig.ServerName = host
+		}
+		pool, err := pgxpool.NewWithConfig(context.Background(), replicaConfig)
+		if err != nil {
+			next.close()
+			return nil, fmt.Errorf("创建副本连接池失败 (connID: %s, host: %s): %w", connID, addr, err)
+		}
+		next.replicas = append(next.replicas, &replicaHost{addr: net.JoinHostPort(host, strconv.Itoa(int(port))), pool: pool, healthy: true})
+	}
+
+	s.mapMutex.Lock()
+	s.replicaSets[connID] = next
+	s.mapMutex.Unlock()
+	if set != nil {
+		go set.close() // 旧的副本连接池派生自已被替换的主库连接池
+	}
+	utils.DefaultLogger.Info("副本连接池创建成功", zap.String("connID", connID), zap.Strings("replicas", addrs))
+	return next, nil
+}
+
+// routeRead 在副本上执行只读操作：按轮询选择健康的副本，连接失败时把副本移出路由并改由主库执行。
+// run 返回 retryable=false 时 (例如已经写出部分结果) 不改由主库重试。
+func (s *pgxService) routeRead(ctx context.Context, connID string, primary *pgxpool.Pool, run func(pool *pgxpool.Pool) (retryable bool, err error)) error {
+	set, err := s.replicaSetFor(ctx, connID)
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		_, err := run(primary)
+		return err
+	}
+	if host := set.pick(); host != nil {
+		host.recordQuery()
+		recordHost(ctx, host.addr)
+		retryable, err := run(host.pool)
+		if err == nil || !retryable || ctx.Err() != nil {
+			return err
+		}
+		switch {
+		case isConnectionError(err):
+			host.markUnhealthy(err)
+			utils.DefaultLogger.Warn("只读副本连接失败，已移出路由，改由主库执行", zap.String("connID", connID), zap.String("host", host.addr), zap.Error(err))
+		case isRecoveryConflict(err):
+			utils.DefaultLogger.Warn("只读副本上的查询因恢复冲突被取消，改由主库执行", zap.String("connID", connID), zap.String("host", host.addr), zap.Error(err))
+		default:
+			return err
+		}
+	}
+	set.primaryHost.recordQuery()
+	recordHost(ctx, "")
+	_, err = run(set.primary)
+	return err
+}
+
+// isConnectionError 判断错误是否由于无法连接或连接中断 (而不是查询本身出错)
+func isConnectionError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 08: 连接异常；57P01-57P03: 服务端关闭或尚不能接受连接 (例如副本正在启动)
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) || errors.As(err, &netErr) || pgconn.SafeToRetry(err) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isRecoveryConflict 判断错误是否是副本上的查询与 WAL 回放冲突被取消 (canceling statement due to conflict with recovery)
+func isRecoveryConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "40001" && strings.Contains(pgErr.Detail+pgErr.Message, "recovery")
+}
+
+// countingWriter 记录已写出的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// hostPool 返回连接中指定主机的连接池，host 为空或未找到时返回主库连接池
+func (s *pgxService) hostPool(ctx context.Context, connID, host string) (*pgxpool.Pool, error) {
+	if host != "" {
+		s.mapMutex.RLock()
+		set := s.replicaSets[connID]
+		s.mapMutex.RUnlock()
+		if set != nil {
+			for _, replica := range set.replicas {
+				if replica.addr == host {
+					return replica.pool, nil
+				}
+			}
+		}
+	}
+	return s.GetPool(ctx, connID)
+}
+
+// HostStats 实现 Service 接口。
+func (s *pgxService) HostStats(ctx context.Context, connID string) ([]HostStats, error) {
+	set, err := s.replicaSetFor(ctx, connID)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		pool, err := s.GetPool(ctx, connID)
+		if err != nil {
+			return nil, err
+		}
+		connConfig := pool.Config().ConnConfig
+		primary := &replicaHost{addr: net.JoinHostPort(connConfig.Host, strconv.Itoa(int(connConfig.Port))), healthy: true}
+		return []HostStats{primary.stats(HostRolePrimary, pool)}, nil
+	}
+	stats := []HostStats{set.primaryHost.stats(HostRolePrimary, set.primary)}
+	for _, host := range set.replicas {
+		stats = append(stats, host.stats(HostRoleReplica, host.pool))
+	}
+	return stats, nil
+}
+
+// CheckReplicas 实现 Service 接口。
+func (s *pgxService) CheckReplicas(ctx context.Context) error {
+	s.mapMutex.RLock()
+	sets := make(map[string]*replicaSet, len(s.replicaSets))
+	for connID, set := range s.replicaSets {
+		sets[connID] = set
+	}
+	s.mapMutex.RUnlock()
+
+	var errs []error
+	for connID, set := range sets {
+		for _, host := range set.replicas {
+			pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err := host.pool.Ping(pingCtx)
+			cancel()
+
+			host.mu.Lock()
+			wasHealthy := host.healthy
+			host.healthy = err == nil
+			host.lastCheck = time.Now()
+			if err != nil {
+				host.lastError = err.Error()
+			}
+			host.mu.Unlock()
+
+			switch {
+			case err != nil && wasHealthy:
+				utils.DefaultLogger.Warn("只读副本健康检查失败，已移出路由", zap.String("connID", connID), zap.String("host", host.addr), zap.Error(err))
+			case err == nil && !wasHealthy:
+				utils.DefaultLogger.Info("只读副本已恢复，重新参与路由", zap.String("connID", connID), zap.String("host", host.addr))
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("connID %s, host %s: %w", connID, host.addr, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReplicaHealthChecker 定期检查只读副本，把恢复的副本重新加入路由。
+type ReplicaHealthChecker struct {
+	service  Service
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewReplicaHealthChecker 根据配置创建一个新的 ReplicaHealthChecker。
+// 检查间隔为 0 时返回 nil，表示不启用 (连接失败的副本将不再参与路由，直到重新 connect)。
+func NewReplicaHealthChecker(service Service, cfg *config.Config) *ReplicaHealthChecker {
+	if cfg.ReplicaHealthCheckInterval <= 0 {
+		return nil
+	}
+	return &ReplicaHealthChecker{service: service, interval: cfg.ReplicaHealthCheckInterval}
+}
+
+// Start 在后台启动检查循环。对 nil ReplicaHealthChecker 调用是安全的。
+func (c *ReplicaHealthChecker) Start() {
+	if c == nil {
+		return
+	}
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	utils.DefaultLogger.Info("只读副本健康检查已启动", zap.Duration("interval", c.interval))
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), c.interval)
+				_ = c.service.CheckReplicas(ctx) // 失败已按主机记录日志
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop 停止检查循环并等待其退出。对 nil ReplicaHealthChecker 调用是安全的。
+func (c *ReplicaHealthChecker) Stop() {
+	if c == nil || c.stop == nil {
+		return
+	}
+	close(c.stop)
+	<-c.done
+}
@@ -0,0 +1,195 @@
+package databases
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resultCacheKey 是标记查询可以使用结果缓存的 Context 键
+type resultCacheKey struct{}
+
+// WithResultCache 标记 ctx 中的只读 QueryWithColumns 可以使用结果缓存 (RESULT_CACHE_TTL 为 0 时没有效果)。
+// 只有面向客户端的查询工具 (例如 pg_query) 使用缓存，服务器内部的目录查询总是读取最新数据。
+func WithResultCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, resultCacheKey{}, true)
+}
+
+// useResultCache 判断 ctx 是否标记了使用结果缓存
+func useResultCache(ctx context.Context) bool {
+	enabled, _ := ctx.Value(resultCacheKey{}).(bool)
+	return enabled
+}
+
+// ResultCacheStats 是结果缓存的状态和命中统计
+type ResultCacheStats struct {
+	Enabled   bool    `json:"enabled"`
+	TTLMS     int64   `json:"ttl_ms"`
+	MaxBytes  int64   `json:"max_bytes"`
+	Entries   int     `json:"entries"`
+	Bytes     int64   `json:"bytes"` // 缓存结果按 JSON 估算的大小
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	Evictions int64   `json:"evictions"` // 因容量不足被淘汰的结果数 (不包括过期和写入后失效)
+	HitRatio  float64 `json:"hit_ratio"`
+}
+
+// cachedResult 是缓存中的一个查询结果
+type cachedResult struct {
+	key      string
+	connID   string
+	result   *QueryResult
+	size     int64
+	cachedAt time.Time
+}
+
+// resultCache 是按 (connID, SQL, 参数) 缓存只读查询结果的 LRU 缓存，容量按结果的 JSON 大小计算。
+// 连接上执行写入或连接被断开时，该连接的缓存结果全部失效。
+type resultCache struct {
+	ttl      time.Duration
+	maxBytes int64
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element // key -> lru 中的 *cachedResult
+	lru       *list.List               // 最近使用的在前
+	bytes     int64
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+// newResultCache 创建结果缓存，ttl 或 maxBytes 不大于 0 时返回 nil (所有方法对 nil 都是空操作)
+func newResultCache(ttl time.Duration, maxBytes int64) *resultCache {
+	if ttl <= 0 || maxBytes <= 0 {
+		return nil
+	}
+	return &resultCache{ttl: ttl, maxBytes: maxBytes, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// resultCacheKeyFor 返回查询的缓存键，参数无法序列化时返回 false (不缓存)
+func resultCacheKeyFor(connID, sql string, args []any) (string, bool) {
+	encodedArgs, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	return connID + "\x00" + sql + "\x00" + string(encodedArgs), true
+}
+
+// get 返回未过期的缓存结果副本和缓存时间
+func (c *resultCache) get(key string) (*QueryResult, time.Time, bool) {
+	if c == nil {
+		return nil, time.Time{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if ok {
+		entry := element.Value.(*cachedResult)
+		if time.Since(entry.cachedAt) < c.ttl {
+			c.lru.MoveToFront(element)
+			c.hits++
+			return copyQueryResult(entry.result), entry.cachedAt, true
+		}
+		c.removeLocked(element)
+	}
+	c.misses++
+	return nil, time.Time{}, false
+}
+
+// put 缓存查询结果的副本 (调用方之后可能修改结果，例如脱敏)，超过容量时淘汰最久未使用的结果
+func (c *resultCache) put(key, connID string, result *QueryResult) {
+	if c == nil {
+		return
+	}
+	encoded, err := json.Marshal(result.Rows)
+	if err != nil {
+		return
+	}
+	size := int64(len(encoded) + len(key))
+	if size > c.maxBytes/4 {
+		// 单个结果占用过多缓存时不缓存，避免挤掉所有其他结果
+		return
+	}
+	entry := &cachedResult{key: key, connID: connID, result: copyQueryResult(result), size: size, cachedAt: time.Now()}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.removeLocked(element)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			break
+		}
+		c.removeLocked(oldest)
+		c.evictions++
+	}
+}
+
+// invalidate 删除 connID 的所有缓存结果 (connID 上执行了写入或连接被断开)
+func (c *resultCache) invalidate(connID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := connID + "\x00"
+	for key, element := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.removeLocked(element)
+		}
+	}
+}
+
+// stats 返回缓存状态
+func (c *resultCache) stats() ResultCacheStats {
+	if c == nil {
+		return ResultCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := ResultCacheStats{
+		Enabled:   true,
+		TTLMS:     c.ttl.Milliseconds(),
+		MaxBytes:  c.maxBytes,
+		Entries:   len(c.entries),
+		Bytes:     c.bytes,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRatio = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+// removeLocked 删除一个缓存结果 (调用方持有 mu)
+func (c *resultCache) removeLocked(element *list.Element) {
+	entry := c.lru.Remove(element).(*cachedResult)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+// copyQueryResult 复制查询结果的列和行 (行中的值不复制，调用方只替换值而不修改值本身)
+func copyQueryResult(result *QueryResult) *QueryResult {
+	copied := &QueryResult{
+		Columns: append([]string(nil), result.Columns...),
+		Sources: append([]ColumnSource(nil), result.Sources...),
+		Rows:    make([]map[string]any, len(result.Rows)),
+	}
+	for i, row := range result.Rows {
+		copiedRow := make(map[string]any, len(row))
+		for column, value := range row {
+			copiedRow[column] = value
+		}
+		copied.Rows[i] = copiedRow
+	}
+	return copied
+}
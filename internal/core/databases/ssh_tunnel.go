@@ -0,0 +1,335 @@
+package databases
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHTunnelConfig 是通过跳板机 (bastion) 访问数据库时的 SSH 隧道配置
+type SSHTunnelConfig struct {
+	Host       string `json:"host" yaml:"host"`                                   // 跳板机地址
+	Port       int    `json:"port,omitempty" yaml:"port,omitempty"`               // 跳板机 SSH 端口，默认 22
+	User       string `json:"user" yaml:"user"`                                   // SSH 用户名
+	KeyPath    string `json:"key_path,omitempty" yaml:"key_path,omitempty"`       // 私钥文件，为空时使用 SSH_AUTH_SOCK 指向的 ssh-agent
+	Passphrase string `json:"-" yaml:"passphrase,omitempty"`                      // (可选) 私钥口令
+	KnownHosts string `json:"known_hosts,omitempty" yaml:"known_hosts,omitempty"` // (可选) known_hosts 文件，覆盖 SSH_KNOWN_HOSTS_FILE
+}
+
+// Validate 检查隧道配置是否完整
+func (c *SSHTunnelConfig) Validate() error {
+	if c.Host == "" || c.User == "" {
+		return fmt.Errorf("SSH 隧道需要 host 和 user")
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("无效的 SSH 端口: %d", c.Port)
+	}
+	return nil
+}
+
+// address 返回跳板机的 host:port
+func (c *SSHTunnelConfig) address() string {
+	port := c.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+// fingerprint 返回隧道配置的指纹 (跳板机地址、用户、私钥指纹和 known_hosts 文件)，用于区分使用不同隧道的注册。
+// 私钥指纹是私钥文件内容的 SHA-256，文件无法读取时使用文件路径 (建立隧道时会报告错误)
+func (c *SSHTunnelConfig) fingerprint() string {
+	key := "agent"
+	if c.KeyPath != "" {
+		key = "path:" + c.KeyPath
+		if data, err := os.ReadFile(c.KeyPath); err == nil {
+			sum := sha256.Sum256(data)
+			key = "sha256:" + hex.EncodeToString(sum[:])
+		}
+	}
+	return fmt.Sprintf("%s@%s key=%s known_hosts=%s", c.User, c.address(), key, c.KnownHosts)
+}
+
+// applyTunnel 为连接建立 (或复用) SSH 隧道，并把连接池指向本地转发端口。
+// 调用方必须持有 poolMutex。
+func (s *pgxService) applyTunnel(connID string, poolConfig *pgxpool.Config) error {
+	s.mapMutex.RLock()
+	tunnelConfig := s.tunnelCfgs[connID]
+	s.mapMutex.RUnlock()
+	if tunnelConfig == nil {
+		return nil
+	}
+	connConfig := poolConfig.ConnConfig
+	if strings.HasPrefix(connConfig.Host, "/") {
+		return fmt.Errorf("SSH 隧道不支持 Unix socket 连接 (connID: %s)", connID)
+	}
+	remote := net.JoinHostPort(connConfig.Host, strconv.Itoa(int(connConfig.Port)))
+
+	tunnel, exists := s.tunnels[connID]
+	if exists && tunnel.remote != remote {
+		// 凭据轮换等更换了数据库地址
+		s.closeTunnel(connID)
+		exists = false
+	}
+	if !exists {
+		var err error
+		tunnel, err = openSSHTunnel(s.config, tunnelConfig, remote)
+		if err != nil {
+			return fmt.Errorf("建立 SSH 隧道失败 (connID: %s): %w", connID, err)
+		}
+		s.tunnels[connID] = tunnel
+	}
+
+	// TLS 的 ServerName 仍是原始主机名，证书校验不受影响；隧道只转发到一个地址，不使用备用主机
+	connConfig.Host = "127.0.0.1"
+	connConfig.Port = tunnel.localPort()
+	connConfig.Fallbacks = nil
+	return nil
+}
+
+// closeTunnel 关闭并移除连接的 SSH 隧道。调用方必须持有 poolMutex。
+func (s *pgxService) closeTunnel(connID string) {
+	tunnel, exists := s.tunnels[connID]
+	if !exists {
+		return
+	}
+	delete(s.tunnels, connID)
+	if err := tunnel.Close(); err != nil {
+		utils.DefaultLogger.Warn("关闭 SSH 隧道失败", zap.String("connID", connID), zap.Error(err))
+	}
+}
+
+// sshTunnel 在本地回环地址上监听，把每个连接经跳板机转发到数据库地址。
+// SSH 连接断开后，下一个转发请求会自动重连。
+type sshTunnel struct {
+	config   *SSHTunnelConfig
+	remote   string // 数据库的 host:port (从跳板机看到的地址)
+	listener net.Listener
+	client   *ssh.Client
+	clientMu sync.Mutex
+	closed   chan struct{}
+	wg       sync.WaitGroup
+
+	knownHosts  string // 默认的 known_hosts 文件
+	insecureKey bool   // 是否跳过主机密钥校验
+}
+
+// openSSHTunnel 建立到跳板机的 SSH 连接，并在 127.0.0.1 的随机端口上开始转发到 remote
+func openSSHTunnel(cfg *config.Config, tunnelConfig *SSHTunnelConfig, remote string) (*sshTunnel, error) {
+	t := &sshTunnel{
+		config:      tunnelConfig,
+		remote:      remote,
+		closed:      make(chan struct{}),
+		knownHosts:  cfg.SSHKnownHostsFile,
+		insecureKey: cfg.SSHInsecureIgnoreHostKey,
+	}
+	if _, err := t.sshClient(); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.closeClient()
+		return nil, fmt.Errorf("监听本地转发端口失败: %w", err)
+	}
+	t.listener = listener
+	t.wg.Add(1)
+	go t.acceptLoop()
+	utils.DefaultLogger.Info("SSH 隧道已建立", zap.String("bastion", tunnelConfig.address()), zap.String("remote", remote), zap.String("local", listener.Addr().String()))
+	return t, nil
+}
+
+// localPort 返回本地转发端口
+func (t *sshTunnel) localPort() uint16 {
+	return uint16(t.listener.Addr().(*net.TCPAddr).Port)
+}
+
+// acceptLoop 接受本地连接并转发
+func (t *sshTunnel) acceptLoop() {
+	defer t.wg.Done()
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.closed:
+				return
+			default:
+			}
+			utils.DefaultLogger.Warn("SSH 隧道接受本地连接失败", zap.String("remote", t.remote), zap.Error(err))
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.forward(local)
+		}()
+	}
+}
+
+// forward 经 SSH 连接打开到数据库的通道，双向复制数据直到任一端关闭
+func (t *sshTunnel) forward(local net.Conn) {
+	defer local.Close()
+	remote, err := t.dialRemote()
+	if err != nil {
+		utils.DefaultLogger.Error("SSH 隧道连接数据库失败", zap.String("remote", t.remote), zap.Error(err))
+		return
+	}
+	defer remote.Close()
+	done := make(chan struct{}, 2)
+	go func() { _, _ = io.Copy(remote, local); done <- struct{}{} }()
+	go func() { _, _ = io.Copy(local, remote); done <- struct{}{} }()
+	select {
+	case <-done:
+	case <-t.closed:
+	}
+}
+
+// dialRemote 打开到数据库的通道，SSH 连接已断开时重连一次
+func (t *sshTunnel) dialRemote() (net.Conn, error) {
+	client, err := t.sshClient()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial("tcp", t.remote)
+	if err == nil {
+		return conn, nil
+	}
+	utils.DefaultLogger.Warn("SSH 通道打开失败，重新连接跳板机", zap.String("bastion", t.config.address()), zap.Error(err))
+	t.closeClient()
+	if client, err = t.sshClient(); err != nil {
+		return nil, err
+	}
+	return client.Dial("tcp", t.remote)
+}
+
+// sshClient 返回当前的 SSH 连接，不存在时建立新连接
+func (t *sshTunnel) sshClient() (*ssh.Client, error) {
+	t.clientMu.Lock()
+	defer t.clientMu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+	clientConfig, err := t.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.Dial("tcp", t.config.address(), clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("连接跳板机 %s 失败: %w", t.config.address(), err)
+	}
+	t.client = client
+	go func() {
+		// SSH 连接断开后清除，下次转发时重连
+		_ = client.Wait()
+		t.clientMu.Lock()
+		if t.client == client {
+			t.client = nil
+		}
+		t.clientMu.Unlock()
+	}()
+	return client, nil
+}
+
+// clientConfig 组装认证方式和主机密钥校验
+func (t *sshTunnel) clientConfig() (*ssh.ClientConfig, error) {
+	var auth ssh.AuthMethod
+	if t.config.KeyPath != "" {
+		key, err := os.ReadFile(t.config.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取 SSH 私钥失败: %w", err)
+		}
+		var signer ssh.Signer
+		if t.config.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(t.config.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析 SSH 私钥 '%s' 失败: %w", t.config.KeyPath, err)
+		}
+		auth = ssh.PublicKeys(signer)
+	} else {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, fmt.Errorf("SSH 隧道未指定 key_path，且没有可用的 ssh-agent (SSH_AUTH_SOCK)")
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("连接 ssh-agent 失败: %w", err)
+		}
+		auth = ssh.PublicKeysCallback(agent.NewClient(conn).Signers)
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	if t.insecureKey {
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		path := t.config.KnownHosts
+		if path == "" {
+			path = t.knownHosts
+		}
+		if path == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("无法确定 known_hosts 文件: %w", err)
+			}
+			path = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		callback, err := knownhosts.New(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取 known_hosts 文件 '%s' 失败: %w", path, err)
+		}
+		hostKeyCallback = callback
+	}
+	return &ssh.ClientConfig{
+		User:            t.config.User,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	}, nil
+}
+
+// closeClient 关闭当前的 SSH 连接
+func (t *sshTunnel) closeClient() {
+	t.clientMu.Lock()
+	defer t.clientMu.Unlock()
+	if t.client != nil {
+		_ = t.client.Close()
+		t.client = nil
+	}
+}
+
+// Close 停止监听，关闭 SSH 连接并等待转发结束
+func (t *sshTunnel) Close() error {
+	select {
+	case <-t.closed:
+		return nil
+	default:
+	}
+	close(t.closed)
+	err := t.listener.Close()
+	t.closeClient()
+	t.wg.Wait()
+	if errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
+	utils.DefaultLogger.Info("SSH 隧道已关闭", zap.String("remote", t.remote))
+	return err
+}
@@ -0,0 +1,207 @@
+package databases
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// TLSOptions 是连接级别的 TLS 设置 (文件均为服务端路径)。
+// 创建连接池时写入连接字符串，由 pgxpool.ParseConfig 按 libpq 的语义生成 TLS 配置；
+// 为空的字段沿用连接字符串中的设置，连接字符串也没有时使用 DB_SSLMODE 等全局默认值。
+type TLSOptions struct {
+	SSLMode  string // disable, allow, prefer, require, verify-ca 或 verify-full
+	RootCert string // 校验服务器证书的 CA 证书文件 (sslrootcert)
+	Cert     string // 客户端证书文件 (sslcert)
+	Key      string // 客户端私钥文件 (sslkey)
+}
+
+// Validate 检查 sslmode 取值，以及证书文件是否可读
+func (t *TLSOptions) Validate() error {
+	if t.SSLMode != "" && !slices.Contains(sslModes, t.SSLMode) {
+		return fmt.Errorf("'sslmode' 必须是 %s 之一", strings.Join(sslModes, ", "))
+	}
+	if (t.Cert == "") != (t.Key == "") {
+		return fmt.Errorf("客户端证书 (sslcert) 和私钥 (sslkey) 必须同时指定")
+	}
+	for _, file := range []struct{ name, path string }{{"sslrootcert", t.RootCert}, {"sslcert", t.Cert}, {"sslkey", t.Key}} {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			return fmt.Errorf("无法读取 %s 文件: %w", file.name, err)
+		}
+	}
+	return nil
+}
+
+// params 返回 TLS 设置对应的连接参数 (按固定顺序，值为空表示未设置)
+func (t *TLSOptions) params() [][2]string {
+	return [][2]string{{"sslmode", t.SSLMode}, {"sslrootcert", t.RootCert}, {"sslcert", t.Cert}, {"sslkey", t.Key}}
+}
+
+// ApplyTLS 把 TLS 设置写入连接字符串: overrides (可以为 nil) 中的非空字段覆盖连接字符串中的参数，
+// defaults 中的字段只在连接字符串没有该参数时使用。
+func ApplyTLS(connString string, overrides *TLSOptions, defaults TLSOptions) (string, error) {
+	if overrides == nil {
+		overrides = &TLSOptions{}
+	}
+	var set [][2]string
+	defaultParams := defaults.params()
+	for i, param := range overrides.params() {
+		if param[1] == "" && defaultParams[i][1] != "" && ConnStringParam(connString, param[0]) == "" {
+			param[1] = defaultParams[i][1]
+		}
+		if param[1] != "" {
+			set = append(set, param)
+		}
+	}
+	if len(set) == 0 {
+		return connString, nil
+	}
+
+	if isURLConnString(connString) {
+		parsed, err := url.Parse(connString)
+		if err != nil {
+			return "", fmt.Errorf("连接字符串格式无效: %w", err)
+		}
+		query := parsed.Query()
+		for _, param := range set {
+			query.Set(param[0], param[1])
+		}
+		parsed.RawQuery = query.Encode()
+		return parsed.String(), nil
+	}
+	// key=value 形式中同名参数以最后出现的为准
+	var b strings.Builder
+	b.WriteString(connString)
+	for _, param := range set {
+		value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(param[1])
+		fmt.Fprintf(&b, " %s='%s'", param[0], value)
+	}
+	return b.String(), nil
+}
+
+// ConnStringParam 返回连接字符串 (URL 或 key=value 形式) 中的参数值，不存在时返回空
+func ConnStringParam(connString, key string) string {
+	params, err := connStringParams(connString)
+	if err != nil {
+		return ""
+	}
+	return params[key]
+}
+
+// serverFileParams 是引用服务端文件的 libpq 连接参数。客户端传入的连接字符串不能包含它们:
+// 证书文件需要通过 sslrootcert/sslcert/sslkey 参数指定 (限制在 DB_TLS_CERT_DIR 下)，
+// passfile 和 service 会读取服务端的密码文件和服务定义。
+var serverFileParams = []string{"sslrootcert", "sslcert", "sslkey", "sslcrl", "sslcrldir", "passfile", "service", "servicefile"}
+
+// CheckRawConnString 检查客户端传入的连接字符串没有引用服务端文件的参数，
+// 并且与结构化参数的 options 相同只包含 connOptionKeys 中的参数 (以及 connStringKeys 中的连接目标和 sslmode)
+func CheckRawConnString(connString string) error {
+	params, err := connStringParams(connString)
+	if err != nil {
+		return err
+	}
+	for _, key := range serverFileParams {
+		if _, ok := params[key]; ok {
+			return fmt.Errorf("连接字符串不能包含 '%s' 参数 (证书文件请使用 sslrootcert/sslcert/sslkey 参数并放在 DB_TLS_CERT_DIR 下)", key)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(params)) {
+		if !connOptionKeys[key] && !connStringKeys[key] {
+			allowed := append(sortedKeys(connStringKeys), sortedKeys(connOptionKeys)...)
+			return fmt.Errorf("连接字符串不支持参数 '%s' (可用: %s)", key, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// connStringParams 解析连接字符串中的参数 (参数名小写)。URL 形式返回查询参数；
+// key=value 形式按 libpq 的规则解析: '=' 两侧可以有空白，值可以用单引号包裹，反斜杠转义下一个字符。
+// 同名参数以最后出现的为准。
+func connStringParams(connString string) (map[string]string, error) {
+	params := make(map[string]string)
+	if isURLConnString(connString) {
+		parsed, err := url.Parse(connString)
+		if err != nil {
+			return nil, fmt.Errorf("连接字符串格式无效: %w", err)
+		}
+		for key, values := range parsed.Query() {
+			params[strings.ToLower(key)] = values[len(values)-1]
+		}
+		return params, nil
+	}
+	isSpace := func(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v' }
+	s := connString
+	i := 0
+	skipSpace := func() {
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+	}
+	for {
+		skipSpace()
+		if i >= len(s) {
+			return params, nil
+		}
+		start := i
+		for i < len(s) && s[i] != '=' && !isSpace(s[i]) {
+			i++
+		}
+		key := strings.ToLower(s[start:i])
+		skipSpace()
+		if i >= len(s) || s[i] != '=' || key == "" {
+			return nil, fmt.Errorf("连接字符串格式无效: 参数 '%s' 缺少 '='", s[start:i])
+		}
+		i++
+		skipSpace()
+		var value strings.Builder
+		if i < len(s) && s[i] == '\'' {
+			i++
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("连接字符串格式无效: 参数 '%s' 的引号未闭合", key)
+			}
+			i++
+		} else {
+			for ; i < len(s) && !isSpace(s[i]); i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+		}
+		params[key] = value.String()
+	}
+}
+
+// isURLConnString 判断连接字符串是否为 URL 形式
+func isURLConnString(connString string) bool {
+	return strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://")
+}
+
+// tlsDefaults 返回配置中的全局 TLS 默认值
+func (s *pgxService) tlsDefaults() TLSOptions {
+	return TLSOptions{SSLMode: s.config.DBSSLMode, RootCert: s.config.DBSSLRootCert, Cert: s.config.DBSSLCert, Key: s.config.DBSSLKey}
+}
+
+// poolConnString 返回创建连接池使用的连接字符串 (写入连接级别的 TLS 设置和全局默认值)
+func (s *pgxService) poolConnString(connID, connString string) (string, error) {
+	s.mapMutex.RLock()
+	overrides := s.tlsCfgs[connID]
+	s.mapMutex.RUnlock()
+	connString, err := ApplyTLS(connString, overrides, s.tlsDefaults())
+	if err != nil {
+		return "", fmt.Errorf("应用 TLS 设置失败 (connID: %s): %w", connID, err)
+	}
+	return connString, nil
+}
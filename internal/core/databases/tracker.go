@@ -0,0 +1,224 @@
+package databases
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+)
+
+// ActiveQuery 描述一个正在执行中的查询 (由 MCP 发起)。
+type ActiveQuery struct {
+	QueryID    string    `json:"query_id"`       // 服务端生成的查询 ID
+	ConnID     string    `json:"conn_id"`        // 所属连接 ID
+	SQL        string    `json:"sql"`            // 执行的 SQL
+	ReadOnly   bool      `json:"read_only"`      // 是否只读事务
+	StartedAt  time.Time `json:"started_at"`     // 开始时间
+	ElapsedMs  int64     `json:"elapsed_ms"`     // 已执行时长 (毫秒)，在快照时计算
+	BackendPID uint32    `json:"backend_pid"`    // PostgreSQL 后端进程 PID (获取连接后才有值)
+	Host       string    `json:"host,omitempty"` // 执行查询的只读副本 (host:port)，在主库上执行时为空
+}
+
+// QueryLogEntry 是一条已执行完成的查询记录 (由 MCP 发起)。
+type QueryLogEntry struct {
+	QueryID    string    `json:"query_id"`        // 服务端生成的查询 ID
+	ConnID     string    `json:"conn_id"`         // 所属连接 ID
+	SQL        string    `json:"sql"`             // 执行的 SQL
+	ReadOnly   bool      `json:"read_only"`       // 是否只读事务
+	StartedAt  time.Time `json:"started_at"`      // 开始时间
+	DurationMs int64     `json:"duration_ms"`     // 执行时长 (毫秒)
+	Slow       bool      `json:"slow"`            // 是否超过慢查询阈值
+	Error      string    `json:"error,omitempty"` // 执行失败时的错误信息
+}
+
+// trackedQuery 是 tracker 内部保存的查询条目。
+type trackedQuery struct {
+	info    ActiveQuery
+	cancel  context.CancelFunc // 取消该查询的 context
+	tracker *queryTracker      // 所属 tracker，用于回填 PID 时加锁
+}
+
+// trackedQueryKey 用于在 context 中传递当前查询条目，使 executor 获取连接后能回填 PID。
+type trackedQueryKey struct{}
+
+// queryTracker 记录所有在途查询，以及最近完成的查询历史。
+type queryTracker struct {
+	mu      sync.RWMutex
+	queries map[string]*trackedQuery // queryID -> 条目
+
+	history       []QueryLogEntry // 环形缓冲区，保存最近完成的查询
+	historyNext   int             // 下一条记录写入的位置
+	historyFull   bool            // 缓冲区是否已写满
+	slowThreshold time.Duration   // 慢查询阈值，0 表示不标记
+}
+
+// newQueryTracker 创建 tracker。historySize 为保留的查询历史条数，<= 0 时不保留历史。
+func newQueryTracker(historySize int, slowThreshold time.Duration) *queryTracker {
+	if historySize < 0 {
+		historySize = 0
+	}
+	return &queryTracker{
+		queries:       make(map[string]*trackedQuery),
+		history:       make([]QueryLogEntry, historySize),
+		slowThreshold: slowThreshold,
+	}
+}
+
+// track 登记一个新查询，返回派生的可取消 context 以及查询结束时必须调用的 done 函数。
+// done 的参数是查询的执行结果，用于记录查询历史。
+func (t *queryTracker) track(ctx context.Context, connID, sql string, readOnly bool) (context.Context, func(err error)) {
+	queryCtx, cancel := context.WithCancel(ctx)
+	entry := &trackedQuery{
+		info: ActiveQuery{
+			QueryID:   utils.GenerateUUID(),
+			ConnID:    connID,
+			SQL:       sql,
+			ReadOnly:  readOnly,
+			StartedAt: time.Now(),
+		},
+		cancel:  cancel,
+		tracker: t,
+	}
+
+	t.mu.Lock()
+	t.queries[entry.info.QueryID] = entry
+	t.mu.Unlock()
+
+	queryCtx = context.WithValue(queryCtx, trackedQueryKey{}, entry)
+	done := func(err error) {
+		t.mu.Lock()
+		delete(t.queries, entry.info.QueryID)
+		t.record(entry.info, err)
+		t.mu.Unlock()
+		cancel()
+	}
+	return queryCtx, done
+}
+
+// recordBackendPID 在 executor 获取到数据库连接后回填后端 PID。
+func recordBackendPID(ctx context.Context, pid uint32) {
+	entry, ok := ctx.Value(trackedQueryKey{}).(*trackedQuery)
+	if !ok {
+		return // 未被追踪的调用 (例如内部的 pg_cancel_backend)
+	}
+	entry.tracker.mu.Lock()
+	entry.info.BackendPID = pid
+	entry.tracker.mu.Unlock()
+}
+
+// recordHost 在只读查询被路由到副本时回填副本地址，CancelQuery 据此在同一主机上调用 pg_cancel_backend。
+func recordHost(ctx context.Context, host string) {
+	entry, ok := ctx.Value(trackedQueryKey{}).(*trackedQuery)
+	if !ok {
+		return
+	}
+	entry.tracker.mu.Lock()
+	entry.info.Host = host
+	entry.tracker.mu.Unlock()
+}
+
+// list 返回在途查询的快照，connID 为空时返回全部。结果按开始时间排序。
+func (t *queryTracker) list(connID string) []ActiveQuery {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	now := time.Now()
+	result := make([]ActiveQuery, 0, len(t.queries))
+	for _, entry := range t.queries {
+		if connID != "" && entry.info.ConnID != connID {
+			continue
+		}
+		info := entry.info
+		info.ElapsedMs = now.Sub(info.StartedAt).Milliseconds()
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].StartedAt.Before(result[j].StartedAt) })
+	return result
+}
+
+// get 返回指定查询的快照及其取消函数。
+func (t *queryTracker) get(queryID string) (ActiveQuery, context.CancelFunc, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	entry, ok := t.queries[queryID]
+	if !ok {
+		return ActiveQuery{}, nil, false
+	}
+	return entry.info, entry.cancel, true
+}
+
+// runningOn 判断查询是否仍在执行，并且是在指定后端 PID 上
+func (t *queryTracker) runningOn(queryID string, pid uint32) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	entry, ok := t.queries[queryID]
+	return ok && entry.info.BackendPID == pid
+}
+
+// waitFinished 等待查询结束 (从在途查询中移除)，在 timeout 内结束时返回 true
+func (t *queryTracker) waitFinished(ctx context.Context, queryID string, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if _, _, ok := t.get(queryID); !ok {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// record 将完成的查询写入历史环形缓冲区，调用方需持有写锁。
+func (t *queryTracker) record(info ActiveQuery, err error) {
+	if len(t.history) == 0 {
+		return
+	}
+	duration := time.Since(info.StartedAt)
+	logEntry := QueryLogEntry{
+		QueryID:    info.QueryID,
+		ConnID:     info.ConnID,
+		SQL:        info.SQL,
+		ReadOnly:   info.ReadOnly,
+		StartedAt:  info.StartedAt,
+		DurationMs: duration.Milliseconds(),
+		Slow:       t.slowThreshold > 0 && duration >= t.slowThreshold,
+	}
+	if err != nil {
+		logEntry.Error = err.Error()
+	}
+	t.history[t.historyNext] = logEntry
+	t.historyNext = (t.historyNext + 1) % len(t.history)
+	if t.historyNext == 0 {
+		t.historyFull = true
+	}
+}
+
+// recent 返回查询历史的快照 (按开始时间排序)，connID 为空时返回全部。
+func (t *queryTracker) recent(connID string) []QueryLogEntry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	count := t.historyNext
+	if t.historyFull {
+		count = len(t.history)
+	}
+	result := make([]QueryLogEntry, 0, count)
+	for i := 0; i < count; i++ {
+		logEntry := t.history[i]
+		if connID != "" && logEntry.ConnID != connID {
+			continue
+		}
+		result = append(result, logEntry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].StartedAt.Before(result[j].StartedAt) })
+	return result
+}
@@ -0,0 +1,123 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+// maxSavepointNameLength 是保存点名称 (PostgreSQL 标识符) 的最大字节数
+const maxSavepointNameLength = 63
+
+// ErrSavepointNotFound 表示事务会话中没有该名称的保存点
+var ErrSavepointNotFound = errors.New("保存点不存在")
+
+// txSavepoint 是会话中的一个保存点，记录创建时的临时表列表以便回滚时恢复
+type txSavepoint struct {
+	name       string
+	tempTables map[string]bool
+}
+
+// SavepointTx 实现 Service 接口。
+func (s *pgxService) SavepointTx(ctx context.Context, txID, name string) (*TxSession, error) {
+	if name == "" || len(name) > maxSavepointNameLength {
+		return nil, fmt.Errorf("保存点名称不能为空且不能超过 %d 字节", maxSavepointNameLength)
+	}
+	quoted, err := sqlsafe.QuoteIdentifier(name)
+	if err != nil {
+		return nil, fmt.Errorf("无效的保存点名称: %w", err)
+	}
+	return s.txSavepointStatement(ctx, txID, "SAVEPOINT "+quoted, func(session *txSession) (func(), error) {
+		if session.info.Status == TxStatusFailed {
+			return nil, ErrTxAborted
+		}
+		return func() {
+			tempTables := make(map[string]bool, len(session.tempTables))
+			for table := range session.tempTables {
+				tempTables[table] = true
+			}
+			session.savepoints = append(session.savepoints, txSavepoint{name: name, tempTables: tempTables})
+		}, nil
+	})
+}
+
+// RollbackToSavepointTx 实现 Service 接口。
+func (s *pgxService) RollbackToSavepointTx(ctx context.Context, txID, name string) (*TxSession, error) {
+	quoted, err := sqlsafe.QuoteIdentifier(name)
+	if err != nil {
+		return nil, fmt.Errorf("无效的保存点名称: %w", err)
+	}
+	return s.txSavepointStatement(ctx, txID, "ROLLBACK TO SAVEPOINT "+quoted, func(session *txSession) (func(), error) {
+		// 在发送前检查保存点是否存在: 回滚到不存在的保存点会使 PostgreSQL 中止整个事务
+		index := -1
+		for i := len(session.savepoints) - 1; i >= 0; i-- {
+			if session.savepoints[i].name == name {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrSavepointNotFound, name)
+		}
+		return func() {
+			// 之后创建的保存点被撤销，保存点本身保留
+			savepoint := session.savepoints[index]
+			session.savepoints = session.savepoints[:index+1]
+			session.tempTables = make(map[string]bool, len(savepoint.tempTables))
+			for table := range savepoint.tempTables {
+				session.tempTables[table] = true
+			}
+			session.info.Status = TxStatusActive
+		}, nil
+	})
+}
+
+// txSavepointStatement 在会话的连接上执行保存点语句。prepare 检查会话状态并返回语句成功后更新会话的函数
+func (s *pgxService) txSavepointStatement(ctx context.Context, txID, statement string, prepare func(*txSession) (func(), error)) (*TxSession, error) {
+	session, err := s.txSession(txID)
+	if err != nil {
+		return nil, err
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.closed {
+		return nil, ErrTxSessionNotFound
+	}
+	apply, err := prepare(session)
+	if err != nil {
+		info := session.snapshot()
+		return &info, err
+	}
+
+	connID := session.info.ConnID
+	started := time.Now()
+	_, err = session.conn.Exec(ctx, statement)
+	s.auditStatement(connID, statement, nil, started, nil, err)
+	session.info.LastUsedAt = time.Now()
+	pgConn := session.conn.Conn().PgConn()
+	if pgConn.IsClosed() || pgConn.TxStatus() == 'I' {
+		s.closeTxSession(context.Background(), session, TxEndConnectionLost, false)
+		info := session.snapshot()
+		if err == nil {
+			err = errors.New("事务会话意外结束")
+		}
+		return &info, fmt.Errorf("事务会话已结束 (%s): %w", TxEndConnectionLost, err)
+	}
+	if err == nil {
+		apply()
+	} else if pgConn.TxStatus() == 'E' {
+		session.info.Status = TxStatusFailed
+	}
+	s.armTxTimer(session)
+	info := session.snapshot()
+	if err != nil {
+		return &info, fmt.Errorf("执行 %s 失败: %w", statement, err)
+	}
+	utils.DefaultLogger.Debug("事务会话保存点语句执行成功", zap.String("txID", txID), zap.String("statement", statement))
+	return &info, nil
+}
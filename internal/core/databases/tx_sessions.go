@@ -0,0 +1,554 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/audit"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// 事务会话的状态
+const (
+	TxStatusActive = "active" // 可以继续执行语句
+	TxStatusFailed = "failed" // 语句出错后事务已中止，只能回滚
+)
+
+// 事务会话的结束原因
+const (
+	TxEndCommitted      = "committed"
+	TxEndRolledBack     = "rolled_back"
+	TxEndIdleTimeout    = "idle_timeout"    // 空闲超过 TX_IDLE_TIMEOUT
+	TxEndMaxDuration    = "max_duration"    // 持续时间超过 TX_MAX_DURATION
+	TxEndDisconnected   = "disconnected"    // connID 被断开
+	TxEndConnectionLost = "connection_lost" // 会话的连接中断或事务意外结束
+)
+
+// 事务会话的隔离级别
+const (
+	TxIsolationRepeatableRead = "repeatable_read" // 默认: 整个会话共用事务开始时的快照
+	TxIsolationSerializable   = "serializable"
+)
+
+var (
+	// ErrTxSessionNotFound 表示事务会话不存在或已经结束
+	ErrTxSessionNotFound = errors.New("事务会话不存在或已结束")
+	// ErrTooManyTxSessions 表示连接上打开的事务会话数已达到 TX_MAX_SESSIONS
+	ErrTooManyTxSessions = errors.New("连接上打开的事务会话数已达上限")
+	// ErrTxAborted 表示事务因之前的语句出错已中止
+	ErrTxAborted = errors.New("事务已因之前的语句出错而中止，只能回滚整个事务或回滚到出错前的保存点")
+)
+
+// txControlKeywords 是事务会话中禁止执行的语句的首个关键字: 它们会结束或改变会话的事务，
+// 使之后的语句在事务之外 (自动提交，且不受只读限制) 执行
+var txControlKeywords = map[string]bool{
+	"begin": true, "start": true, "commit": true, "end": true, "rollback": true, "abort": true,
+	"savepoint": true, "release": true, "prepare": true,
+}
+
+// txReadKeywords 是允许临时表的 (读写) 事务会话中允许的读取语句的首个关键字
+var txReadKeywords = map[string]bool{"select": true, "with": true, "values": true, "table": true, "show": true, "explain": true}
+
+// txWriteKeywords 是允许临时表的事务会话中，读取语句 (和临时表语句的其余部分) 不能包含的关键字，
+// 用于拒绝数据修改 CTE、SELECT INTO、FOR UPDATE 和 EXPLAIN ANALYZE 写入语句
+var txWriteKeywords = map[string]bool{
+	"insert": true, "update": true, "delete": true, "merge": true, "truncate": true, "copy": true,
+	"into": true, "create": true, "drop": true, "alter": true, "grant": true, "revoke": true,
+}
+
+// TxOptions 是开始事务会话的选项
+type TxOptions struct {
+	Isolation  string // TxIsolationRepeatableRead (默认) 或 TxIsolationSerializable
+	TempTables bool   // 允许创建和写入本会话的临时表 (需要 read_write 连接，事务以读写模式开始)
+}
+
+// TxSession 是事务会话的快照
+type TxSession struct {
+	TxID            string    `json:"tx_id"`
+	ConnID          string    `json:"conn_id"`
+	Isolation       string    `json:"isolation"`
+	ReadOnly        bool      `json:"read_only"`
+	AllowTempTables bool      `json:"allow_temp_tables"`
+	TempTables      []string  `json:"temp_tables,omitempty"` // 本会话创建的临时表
+	Savepoints      []string  `json:"savepoints,omitempty"`  // 当前有效的保存点 (按创建顺序)
+	Status          string    `json:"status"`
+	EndReason       string    `json:"end_reason,omitempty"`
+	BackendPID      uint32    `json:"backend_pid"`
+	Snapshot        string    `json:"snapshot"` // txid_current_snapshot()
+	Statements      int       `json:"statements"`
+	StartedAt       time.Time `json:"started_at"`
+	LastUsedAt      time.Time `json:"last_used_at"`
+	ExpiresAt       time.Time `json:"expires_at,omitempty"` // 按当前空闲时间计算的自动回滚时间
+}
+
+// txSession 是一个打开的事务会话 (字段由 mu 保护，mu 同时串行化会话中的语句)
+type txSession struct {
+	mu         sync.Mutex
+	info       TxSession
+	conn       *pgxpool.Conn
+	tempTables map[string]bool
+	savepoints []txSavepoint
+	deadline   time.Time // 按 TX_MAX_DURATION 计算的最晚结束时间，零值表示不限制
+	timer      *time.Timer
+	closed     bool
+}
+
+// BeginTx 实现 Service 接口。
+func (s *pgxService) BeginTx(ctx context.Context, connID string, opts TxOptions) (*TxSession, error) {
+	isolation := opts.Isolation
+	if isolation == "" {
+		isolation = TxIsolationRepeatableRead
+	}
+	if isolation != TxIsolationRepeatableRead && isolation != TxIsolationSerializable {
+		return nil, fmt.Errorf("不支持的隔离级别 '%s' (可选 %s, %s)", opts.Isolation, TxIsolationRepeatableRead, TxIsolationSerializable)
+	}
+	if _, err := s.AccessMode(connID); err != nil {
+		return nil, err
+	}
+	if opts.TempTables {
+		if err := s.checkWritable(connID, false); err != nil {
+			return nil, fmt.Errorf("创建临时表需要读写连接: %w", err)
+		}
+	}
+	if limit := s.config.TxMaxSessions; limit > 0 && len(s.ListTxSessions(connID)) >= limit {
+		return nil, fmt.Errorf("%w (TX_MAX_SESSIONS=%d)，请先提交或回滚不再需要的会话", ErrTooManyTxSessions, limit)
+	}
+
+	pool, err := s.GetPool(ctx, connID)
+	if err != nil {
+		return nil, fmt.Errorf("获取连接池失败 (connID: %s): %w", connID, err)
+	}
+	conn, err := acquireConn(ctx, pool, s.config.DBAcquireTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	accessMode := "READ ONLY"
+	if opts.TempTables {
+		accessMode = "READ WRITE"
+	}
+	statements := []string{fmt.Sprintf("BEGIN ISOLATION LEVEL %s %s", strings.ToUpper(strings.ReplaceAll(isolation, "_", " ")), accessMode)}
+	if idle := s.config.TxIdleTimeout; idle > 0 {
+		// 数据库端兜底: 服务器未能按时回滚 (例如进程退出) 时由 PostgreSQL 终止空闲事务
+		statements = append(statements, fmt.Sprintf("SET LOCAL idle_in_transaction_session_timeout = %d", (idle+time.Minute).Milliseconds()))
+	}
+	for _, statement := range statements {
+		if _, err := conn.Exec(ctx, statement); err != nil {
+			discardTxConn(conn)
+			return nil, fmt.Errorf("开始事务会话失败: %w", err)
+		}
+	}
+	// 执行第一条查询时获取快照，之后的语句都使用该快照，也不能再把事务改为读写
+	var snapshot string
+	if err := conn.QueryRow(ctx, "SELECT pg_catalog.txid_current_snapshot()::text").Scan(&snapshot); err != nil {
+		discardTxConn(conn)
+		return nil, fmt.Errorf("获取事务快照失败: %w", err)
+	}
+
+	now := time.Now()
+	session := &txSession{
+		info: TxSession{
+			TxID:            utils.GenerateUUID(),
+			ConnID:          connID,
+			Isolation:       isolation,
+			ReadOnly:        !opts.TempTables,
+			AllowTempTables: opts.TempTables,
+			Status:          TxStatusActive,
+			BackendPID:      conn.Conn().PgConn().PID(),
+			Snapshot:        snapshot,
+			StartedAt:       now,
+			LastUsedAt:      now,
+		},
+		conn:       conn,
+		tempTables: make(map[string]bool),
+	}
+	if s.config.TxMaxDuration > 0 {
+		session.deadline = now.Add(s.config.TxMaxDuration)
+	}
+	s.txMutex.Lock()
+	s.txSessions[session.info.TxID] = session
+	s.txMutex.Unlock()
+	session.mu.Lock()
+	s.armTxTimer(session)
+	info := session.snapshot()
+	session.mu.Unlock()
+	utils.DefaultLogger.Info("事务会话已开始", zap.String("txID", info.TxID), zap.String("connID", connID),
+		zap.String("isolation", isolation), zap.Bool("tempTables", opts.TempTables), zap.Uint32("backendPID", info.BackendPID))
+	return &info, nil
+}
+
+// ExecuteTx 实现 Service 接口。
+func (s *pgxService) ExecuteTx(ctx context.Context, txID, sql string, args ...any) (*QueryResult, *TxSession, error) {
+	session, err := s.txSession(txID)
+	if err != nil {
+		return nil, nil, err
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.closed {
+		return nil, nil, ErrTxSessionNotFound
+	}
+	if session.info.Status == TxStatusFailed {
+		info := session.snapshot()
+		return nil, &info, ErrTxAborted
+	}
+	applyTempTables, err := session.checkStatement(sql)
+	if err != nil {
+		info := session.snapshot()
+		return nil, &info, err
+	}
+	connID := session.info.ConnID
+	pool, err := s.GetPool(ctx, connID) // 同时记录 connID 的使用时间
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取连接池失败 (connID: %s): %w", connID, err)
+	}
+	if err := s.checkPolicy(ctx, connID, pool, sql); err != nil {
+		info := session.snapshot()
+		return nil, &info, err
+	}
+
+	if !session.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, session.deadline)
+		defer cancel()
+	}
+	ctx, done := s.tracker.track(ctx, connID, sql, session.info.ReadOnly)
+	recordBackendPID(ctx, session.info.BackendPID)
+	started := time.Now()
+	var fields []pgconn.FieldDescription
+	var results []map[string]any
+	rows, err := session.conn.Query(ctx, sql, args...)
+	if err == nil {
+		fields = append([]pgconn.FieldDescription{}, rows.FieldDescriptions()...)
+		results, err = rowsToMaps(ctx, rows)
+		rows.Close()
+		if err == nil {
+			err = rows.Err()
+		}
+	}
+	done(err)
+	s.auditStatement(connID, sql, args, started, audit.RowCount(int64(len(results))), err)
+
+	session.info.Statements++
+	session.info.LastUsedAt = time.Now()
+	pgConn := session.conn.Conn().PgConn()
+	switch {
+	case pgConn.IsClosed() || pgConn.TxStatus() == 'I':
+		// 连接中断 (例如语句超时被取消) 或事务意外结束，会话不能再继续
+		reason := TxEndConnectionLost
+		if !session.deadline.IsZero() && !time.Now().Before(session.deadline) {
+			reason = TxEndMaxDuration
+		}
+		s.closeTxSession(context.Background(), session, reason, false)
+		info := session.snapshot()
+		if err == nil {
+			err = errors.New("事务会话意外结束")
+		}
+		return nil, &info, fmt.Errorf("事务会话已结束 (%s): %w", reason, err)
+	case pgConn.TxStatus() == 'E':
+		session.info.Status = TxStatusFailed
+	}
+	s.armTxTimer(session)
+	info := session.snapshot()
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			return nil, &info, fmt.Errorf("数据库查询执行错误: %s (Code: %s, Detail: %s): %w", pgErr.Message, pgErr.Code, pgErr.Detail, err)
+		}
+		return nil, &info, fmt.Errorf("数据库查询执行错误: %w", err)
+	}
+	if applyTempTables != nil {
+		applyTempTables()
+		info = session.snapshot()
+	}
+
+	result := &QueryResult{
+		Columns: make([]string, len(fields)),
+		Sources: make([]ColumnSource, len(fields)),
+		Rows:    results,
+	}
+	for i, field := range fields {
+		result.Columns[i] = field.Name
+		result.Sources[i] = ColumnSource{TableOID: field.TableOID, Attribute: field.TableAttributeNumber}
+	}
+	return result, &info, nil
+}
+
+// CommitTx 实现 Service 接口。
+func (s *pgxService) CommitTx(ctx context.Context, txID string) (*TxSession, error) {
+	return s.finishTx(ctx, txID, true)
+}
+
+// RollbackTx 实现 Service 接口。
+func (s *pgxService) RollbackTx(ctx context.Context, txID string) (*TxSession, error) {
+	return s.finishTx(ctx, txID, false)
+}
+
+// ListTxSessions 实现 Service 接口。
+func (s *pgxService) ListTxSessions(connID string) []TxSession {
+	s.txMutex.Lock()
+	sessions := make([]*txSession, 0, len(s.txSessions))
+	for _, session := range s.txSessions {
+		sessions = append(sessions, session)
+	}
+	s.txMutex.Unlock()
+
+	list := make([]TxSession, 0, len(sessions))
+	for _, session := range sessions {
+		session.mu.Lock()
+		info, closed := session.snapshot(), session.closed
+		session.mu.Unlock()
+		if !closed && (connID == "" || info.ConnID == connID) {
+			list = append(list, info)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.Before(list[j].StartedAt) })
+	return list
+}
+
+// finishTx 提交或回滚事务会话
+func (s *pgxService) finishTx(ctx context.Context, txID string, commit bool) (*TxSession, error) {
+	session, err := s.txSession(txID)
+	if err != nil {
+		return nil, err
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.closed {
+		return nil, ErrTxSessionNotFound
+	}
+	reason := TxEndRolledBack
+	if commit {
+		reason = TxEndCommitted
+	}
+	err = s.closeTxSession(ctx, session, reason, commit)
+	info := session.snapshot()
+	return &info, err
+}
+
+// closeTxSession 结束事务会话 (调用方持有 session.mu): 提交或回滚事务后关闭会话的连接，
+// 不把连接归还连接池，使临时表和会话中修改的设置不会留给之后的查询。
+func (s *pgxService) closeTxSession(ctx context.Context, session *txSession, reason string, commit bool) error {
+	if session.timer != nil {
+		session.timer.Stop()
+	}
+	var err error
+	if !session.conn.Conn().PgConn().IsClosed() {
+		statement := "ROLLBACK"
+		if commit {
+			statement = "COMMIT"
+		}
+		var tag pgconn.CommandTag
+		tag, err = session.conn.Exec(ctx, statement)
+		if err == nil && commit && tag.String() == "ROLLBACK" {
+			// 已中止的事务执行 COMMIT 时 PostgreSQL 会回滚
+			reason, err = TxEndRolledBack, ErrTxAborted
+		}
+		if err != nil {
+			err = fmt.Errorf("执行 %s 失败: %w", statement, err)
+		}
+	}
+	discardTxConn(session.conn)
+	if commit {
+		// 提交出错时无法确定事务是否已生效，同样清除缓存
+		s.results.invalidate(session.info.ConnID)
+	}
+	session.closed = true
+	session.info.EndReason = reason
+	s.txMutex.Lock()
+	delete(s.txSessions, session.info.TxID)
+	s.txMutex.Unlock()
+
+	logFields := []zap.Field{zap.String("txID", session.info.TxID), zap.String("connID", session.info.ConnID), zap.String("reason", reason), zap.Int("statements", session.info.Statements)}
+	if err != nil {
+		utils.DefaultLogger.Warn("事务会话结束时出错", append(logFields, zap.Error(err))...)
+	} else {
+		utils.DefaultLogger.Info("事务会话已结束", logFields...)
+	}
+	return err
+}
+
+// closeTxSessions 回滚 connID 的所有事务会话 (connID 为空时回滚所有会话)，在断开连接或关闭服务时调用
+func (s *pgxService) closeTxSessions(connID, reason string) {
+	s.txMutex.Lock()
+	var sessions []*txSession
+	for _, session := range s.txSessions {
+		if connID == "" || session.info.ConnID == connID {
+			sessions = append(sessions, session)
+		}
+	}
+	s.txMutex.Unlock()
+	for _, session := range sessions {
+		session.mu.Lock()
+		if !session.closed {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_ = s.closeTxSession(ctx, session, reason, false)
+			cancel()
+		}
+		session.mu.Unlock()
+	}
+}
+
+// armTxTimer 按空闲超时和最长持续时间设置自动回滚的定时器 (调用方持有 session.mu)
+func (s *pgxService) armTxTimer(session *txSession) {
+	var expiresAt time.Time
+	if idle := s.config.TxIdleTimeout; idle > 0 {
+		expiresAt = session.info.LastUsedAt.Add(idle)
+	}
+	if !session.deadline.IsZero() && (expiresAt.IsZero() || session.deadline.Before(expiresAt)) {
+		expiresAt = session.deadline
+	}
+	session.info.ExpiresAt = expiresAt
+	if expiresAt.IsZero() {
+		return
+	}
+	if session.timer != nil {
+		session.timer.Stop()
+	}
+	session.timer = time.AfterFunc(time.Until(expiresAt), func() { s.expireTx(session) })
+}
+
+// expireTx 在定时器到期时回滚事务会话；正在执行的语句结束后才会获得锁，届时重新检查是否仍然过期
+func (s *pgxService) expireTx(session *txSession) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.closed {
+		return
+	}
+	now := time.Now()
+	reason := TxEndIdleTimeout
+	switch {
+	case !session.deadline.IsZero() && !now.Before(session.deadline):
+		reason = TxEndMaxDuration
+	case s.config.TxIdleTimeout > 0 && now.Sub(session.info.LastUsedAt) >= s.config.TxIdleTimeout:
+	default:
+		s.armTxTimer(session) // 期间有新的语句
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = s.closeTxSession(ctx, session, reason, false)
+}
+
+// txSession 按 ID 查找事务会话
+func (s *pgxService) txSession(txID string) (*txSession, error) {
+	s.txMutex.Lock()
+	defer s.txMutex.Unlock()
+	session, ok := s.txSessions[txID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTxSessionNotFound, txID)
+	}
+	return session, nil
+}
+
+// snapshot 返回会话状态的副本 (调用方持有 mu)
+func (session *txSession) snapshot() TxSession {
+	info := session.info
+	info.TempTables = make([]string, 0, len(session.tempTables))
+	for name := range session.tempTables {
+		info.TempTables = append(info.TempTables, name)
+	}
+	sort.Strings(info.TempTables)
+	info.Savepoints = make([]string, len(session.savepoints))
+	for i, savepoint := range session.savepoints {
+		info.Savepoints[i] = savepoint.name
+	}
+	if session.closed {
+		info.ExpiresAt = time.Time{}
+	}
+	return info
+}
+
+// checkStatement 检查语句是否可以在会话中执行，返回语句成功后更新本会话临时表列表的函数 (可能为 nil)。
+// 只读会话由 PostgreSQL 的 READ ONLY 事务拒绝写入，这里只拒绝事务控制语句；
+// 允许临时表的读写会话只接受读取语句以及创建/写入/删除本会话临时表的语句。
+func (session *txSession) checkStatement(sql string) (func(), error) {
+	words := sqlguard.Keywords(sql)
+	if len(words) == 0 {
+		return nil, errors.New("语句为空")
+	}
+	// SELECT 之前的括号不产生单词，首个单词就是语句类型
+	first := words[0]
+	if txControlKeywords[first] {
+		return nil, fmt.Errorf("事务会话中不能执行事务控制语句 (%s)，请使用 tx_commit 或 tx_rollback 结束会话，使用 tx_savepoint 和 tx_rollback_to 管理保存点", strings.ToUpper(first))
+	}
+	if !session.info.AllowTempTables {
+		return nil, nil
+	}
+
+	var rest []string
+	var apply func()
+	switch {
+	case txReadKeywords[first]:
+		rest = words[1:]
+	case first == "create" && len(words) > 2 && (words[1] == "temp" || words[1] == "temporary") && words[2] == "table":
+		name, err := txTargetTable(sqlguard.IdentifierChains(sql), 3)
+		if err != nil {
+			return nil, err
+		}
+		rest = words[3:]
+		apply = func() { session.tempTables[name] = true }
+	case first == "insert" && len(words) > 1 && words[1] == "into", first == "drop" && len(words) > 1 && words[1] == "table":
+		name, err := txTargetTable(sqlguard.IdentifierChains(sql), 2)
+		if err != nil {
+			return nil, err
+		}
+		if !session.tempTables[name] {
+			return nil, fmt.Errorf("只能 %s 本会话创建的临时表，'%s' 不是本会话的临时表", strings.ToUpper(first), name)
+		}
+		rest = words[2:]
+		if first == "drop" {
+			// DROP TABLE 只能删除一张表，不能用逗号追加其他表
+			for _, word := range rest {
+				if word != name && word != "if" && word != "exists" && word != "pg_temp" && word != "cascade" && word != "restrict" {
+					return nil, fmt.Errorf("DROP TABLE 只能删除一张本会话的临时表")
+				}
+			}
+			apply = func() { delete(session.tempTables, name) }
+		}
+	default:
+		return nil, fmt.Errorf("允许临时表的事务会话只能执行查询 (SELECT, WITH, VALUES, TABLE, SHOW, EXPLAIN)、CREATE TEMP TABLE，以及对本会话临时表的 INSERT INTO 和 DROP TABLE，不能执行 %s", strings.ToUpper(first))
+	}
+	for _, word := range rest {
+		if txWriteKeywords[word] {
+			return nil, fmt.Errorf("允许临时表的事务会话中，语句不能包含 %s (只允许写入本会话的临时表)", strings.ToUpper(word))
+		}
+	}
+	return apply, nil
+}
+
+// txTargetTable 返回语句在前 start 个单词之后 (跳过 IF [NOT] EXISTS) 的目标表名。
+// 表名只能不带 Schema 或使用 pg_temp Schema。
+func txTargetTable(chains [][]string, start int) (string, error) {
+	i := start
+	for i < len(chains) && len(chains[i]) == 1 && (chains[i][0] == "if" || chains[i][0] == "not" || chains[i][0] == "exists") {
+		i++
+	}
+	if i >= len(chains) {
+		return "", errors.New("缺少表名")
+	}
+	target := chains[i]
+	switch {
+	case len(target) == 1:
+	case len(target) == 2 && target[0] == "pg_temp":
+		target = target[1:]
+	default:
+		return "", fmt.Errorf("临时表名不能指定 pg_temp 以外的 Schema: %s", strings.Join(target, "."))
+	}
+	return target[0], nil
+}
+
+// discardTxConn 关闭会话的连接并从连接池中移除
+func discardTxConn(conn *pgxpool.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = conn.Hijack().Close(ctx)
+}
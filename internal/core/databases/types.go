@@ -0,0 +1,73 @@
+package databases
+
+import (
+	"context"
+
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// RegisterCustomTypes 实现 Service 接口。
+// 保存连接的自定义类型列表，并重置已有连接池，使池中的连接在重新建立时注册这些类型。
+func (s *pgxService) RegisterCustomTypes(ctx context.Context, connID string, typeNames []string) error {
+	names := make([]string, 0, len(typeNames)*2)
+	for _, name := range typeNames {
+		// 同时注册数组类型，数组类型名为 schema._type
+		names = append(names, name, arrayTypeName(name))
+	}
+
+	s.typesMutex.Lock()
+	s.customTypes[connID] = names
+	s.typesMutex.Unlock()
+
+	s.mapMutex.RLock()
+	pool, exists := s.pools[connID]
+	s.mapMutex.RUnlock()
+	if exists {
+		// 空闲连接立即关闭，使用中的连接在归还时关闭，新连接会经过 AfterConnect 注册类型
+		pool.Reset()
+	}
+	utils.DefaultLogger.Info("已登记连接的自定义类型", zap.String("connID", connID), zap.Int("count", len(typeNames)))
+	return nil
+}
+
+// afterConnect 返回连接池的 AfterConnect 回调，为每个新建连接注册该连接登记的自定义类型。
+// 注册失败只记录日志，不影响连接建立 (未注册的类型仍以文本形式返回)。
+func (s *pgxService) afterConnect(connID string) func(context.Context, *pgx.Conn) error {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		s.typesMutex.RLock()
+		names := s.customTypes[connID]
+		s.typesMutex.RUnlock()
+		if len(names) == 0 {
+			return nil
+		}
+
+		types, err := conn.LoadTypes(ctx, names)
+		if err == nil {
+			conn.TypeMap().RegisterTypes(types)
+			return nil
+		}
+		// 某个类型依赖未注册的类型 (例如扩展提供的基础类型) 时整批加载会失败，逐个加载以跳过这些类型
+		utils.DefaultLogger.Debug("批量注册自定义类型失败，改为逐个注册", zap.String("connID", connID), zap.Error(err))
+		for _, name := range names {
+			types, err := conn.LoadTypes(ctx, []string{name})
+			if err != nil {
+				utils.DefaultLogger.Debug("跳过无法注册的自定义类型", zap.String("connID", connID), zap.String("type", name), zap.Error(err))
+				continue
+			}
+			conn.TypeMap().RegisterTypes(types)
+		}
+		return nil
+	}
+}
+
+// arrayTypeName 返回类型对应的数组类型名 (PostgreSQL 默认在类型名前加下划线)
+func arrayTypeName(name string) string {
+	for i := len(name) - 1; i >= 0; i-- {
+		if name[i] == '.' {
+			return name[:i+1] + "_" + name[i+1:]
+		}
+	}
+	return "_" + name
+}
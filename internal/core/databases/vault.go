@@ -0,0 +1,118 @@
+package databases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+)
+
+// VaultProvider 通过 HTTP API 从 HashiCorp Vault 读取凭据。
+// ref 是 /v1/ 之后的路径，支持 KV v2 (例如 secret/data/pg/analytics，版本为 metadata.version)、
+// KV v1 和数据库 Secret 引擎 (例如 database/creds/readonly，每次读取生成新的用户，版本为 lease_id)。
+type VaultProvider struct {
+	addr       string
+	token      string
+	tokenFile  string // Vault Agent 写出的 token 文件，每次请求时重新读取
+	namespace  string
+	httpClient *http.Client
+}
+
+// NewVaultProvider 按配置创建 VaultProvider。
+func NewVaultProvider(cfg *config.Config) *VaultProvider {
+	return &VaultProvider{
+		addr:       strings.TrimRight(cfg.VaultAddr, "/"),
+		token:      cfg.VaultToken,
+		tokenFile:  cfg.VaultTokenFile,
+		namespace:  cfg.VaultNamespace,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name 实现 CredentialProvider 接口。
+func (p *VaultProvider) Name() string {
+	return ProviderVault
+}
+
+// vaultResponse 是 Vault 读取 Secret 的响应
+type vaultResponse struct {
+	LeaseID       string         `json:"lease_id"`
+	LeaseDuration int            `json:"lease_duration"` // 秒
+	Data          map[string]any `json:"data"`
+	Errors        []string       `json:"errors"`
+}
+
+// Fetch 实现 CredentialProvider 接口。
+func (p *VaultProvider) Fetch(ctx context.Context, ref string) (*Secret, error) {
+	token, err := p.currentToken()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.addr+"/v1/"+strings.TrimLeft(ref, "/"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Vault 请求失败: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 Vault 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("读取 Vault 响应失败: %w", err)
+	}
+	var parsed vaultResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("解析 Vault 响应失败 (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Vault 返回 HTTP %d: %s", resp.StatusCode, strings.Join(parsed.Errors, "; "))
+	}
+
+	// KV v2 的实际内容在 data.data 中，版本在 data.metadata.version
+	if inner, ok := parsed.Data["data"].(map[string]any); ok {
+		if metadata, ok := parsed.Data["metadata"].(map[string]any); ok {
+			values := stringValues(inner)
+			version := valuesVersion(values)
+			if v, ok := metadata["version"]; ok && v != nil {
+				version = fmt.Sprint(v)
+			}
+			return &Secret{Values: values, Version: version}, nil
+		}
+	}
+	values := stringValues(parsed.Data)
+	if parsed.LeaseID == "" {
+		return &Secret{Values: values, Version: valuesVersion(values)}, nil
+	}
+	// 动态凭据每次读取都会生成新的用户，只在租约快到期时才需要重新读取
+	secret := &Secret{Values: values, Version: parsed.LeaseID}
+	if parsed.LeaseDuration > 0 {
+		secret.ExpiresAt = time.Now().Add(time.Duration(parsed.LeaseDuration) * time.Second)
+	}
+	return secret, nil
+}
+
+// currentToken 返回 Vault token，配置了 token 文件时读取文件 (Vault Agent 会定期续期并重写该文件)
+func (p *VaultProvider) currentToken() (string, error) {
+	if p.tokenFile != "" {
+		data, err := os.ReadFile(p.tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("读取 Vault token 文件失败: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if p.token == "" {
+		return "", fmt.Errorf("未配置 VAULT_TOKEN 或 VAULT_TOKEN_FILE")
+	}
+	return p.token, nil
+}
@@ -0,0 +1,220 @@
+package databases
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// watchdogSQLPreviewLen 是告警中 SQL 的最大长度，避免把超长语句推送到聊天工具
+const watchdogSQLPreviewLen = 1000
+
+// QueryAlert 是长时间运行查询的告警内容，以 JSON 形式 POST 到配置的 Webhook。
+// Text 字段兼容 Slack Incoming Webhook 的消息格式。
+type QueryAlert struct {
+	Text       string `json:"text"`        // 可读的告警摘要
+	Event      string `json:"event"`       // slow_query 或 query_cancelled
+	QueryID    string `json:"query_id"`    // 服务端查询 ID
+	ConnID     string `json:"conn_id"`     // 所属连接 ID
+	BackendPID uint32 `json:"backend_pid"` // PostgreSQL 会话 (后端进程) PID
+	SQL        string `json:"sql"`         // 执行的 SQL (可能被截断)
+	ElapsedMs  int64  `json:"elapsed_ms"`  // 已执行时长 (毫秒)
+	ReadOnly   bool   `json:"read_only"`   // 是否只读事务
+}
+
+// 告警事件类型
+const (
+	AlertEventSlowQuery      = "slow_query"
+	AlertEventQueryCancelled = "query_cancelled"
+)
+
+// Watchdog 定期检查由本服务发起的在途查询:
+// 超过告警阈值时发送一次告警，超过硬性上限时自动取消查询并再次告警。
+type Watchdog struct {
+	service    Service
+	interval   time.Duration // 检查间隔
+	threshold  time.Duration // 告警阈值，0 表示不告警
+	hardLimit  time.Duration // 自动取消上限，0 表示不取消
+	webhookURL string        // 告警 Webhook 地址，为空时只写日志
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	alerted   map[string]bool // 已发送过慢查询告警的 queryID
+	cancelled map[string]bool // 已自动取消 (并告警) 的 queryID，取消后查询结束前不再重复取消和告警
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewWatchdog 根据配置创建一个新的 Watchdog。阈值和上限都为 0 时返回 nil，表示不启用。
+func NewWatchdog(service Service, cfg *config.Config) *Watchdog {
+	if cfg.QueryAlertThreshold <= 0 && cfg.QueryHardLimit <= 0 {
+		return nil
+	}
+	interval := cfg.QueryWatchdogInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &Watchdog{
+		service:    service,
+		interval:   interval,
+		threshold:  cfg.QueryAlertThreshold,
+		hardLimit:  cfg.QueryHardLimit,
+		webhookURL: cfg.QueryAlertWebhookURL,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		alerted:    make(map[string]bool),
+		cancelled:  make(map[string]bool),
+	}
+}
+
+// Start 在后台启动检查循环。对 nil Watchdog 调用是安全的。
+func (w *Watchdog) Start() {
+	if w == nil {
+		return
+	}
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	utils.DefaultLogger.Info("长查询监控已启动",
+		zap.Duration("interval", w.interval),
+		zap.Duration("alertThreshold", w.threshold),
+		zap.Duration("hardLimit", w.hardLimit),
+		zap.Bool("webhook", w.webhookURL != ""))
+
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.check()
+			}
+		}
+	}()
+}
+
+// Stop 停止检查循环并等待其退出。对 nil 或未启动的 Watchdog 调用是安全的。
+func (w *Watchdog) Stop() {
+	if w == nil || w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	utils.DefaultLogger.Info("长查询监控已停止")
+}
+
+// check 执行一轮检查
+func (w *Watchdog) check() {
+	queries := w.service.ListActiveQueries("")
+	running := make(map[string]bool, len(queries))
+	for _, query := range queries {
+		running[query.QueryID] = true
+		elapsed := time.Duration(query.ElapsedMs) * time.Millisecond
+
+		if w.hardLimit > 0 && elapsed >= w.hardLimit {
+			if w.mark(w.cancelled, query.QueryID) {
+				w.cancel(query)
+			}
+			continue
+		}
+		if w.threshold > 0 && elapsed >= w.threshold && w.mark(w.alerted, query.QueryID) {
+			utils.DefaultLogger.Warn("检测到长时间运行的查询", zap.String("queryID", query.QueryID), zap.String("connID", query.ConnID),
+				zap.Uint32("backendPID", query.BackendPID), zap.Int64("elapsedMs", query.ElapsedMs))
+			w.notify(AlertEventSlowQuery, query)
+		}
+	}
+
+	// 清理已结束查询的告警和取消记录
+	w.mu.Lock()
+	for _, handled := range []map[string]bool{w.alerted, w.cancelled} {
+		for queryID := range handled {
+			if !running[queryID] {
+				delete(handled, queryID)
+			}
+		}
+	}
+	w.mu.Unlock()
+}
+
+// mark 在 handled 中记录查询已处理，首次记录时返回 true
+func (w *Watchdog) mark(handled map[string]bool, queryID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if handled[queryID] {
+		return false
+	}
+	handled[queryID] = true
+	return true
+}
+
+// cancel 取消超过硬性上限的查询并发送告警
+func (w *Watchdog) cancel(query ActiveQuery) {
+	utils.DefaultLogger.Warn("查询超过执行时长上限，自动取消", zap.String("queryID", query.QueryID), zap.String("connID", query.ConnID),
+		zap.Uint32("backendPID", query.BackendPID), zap.Int64("elapsedMs", query.ElapsedMs), zap.Duration("hardLimit", w.hardLimit))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := w.service.CancelQuery(ctx, query.QueryID); err != nil {
+		utils.DefaultLogger.Warn("自动取消查询失败", zap.String("queryID", query.QueryID), zap.Error(err))
+	}
+	w.notify(AlertEventQueryCancelled, query)
+}
+
+// notify 将告警 POST 到配置的 Webhook，未配置时只记录日志
+func (w *Watchdog) notify(event string, query ActiveQuery) {
+	if w.webhookURL == "" {
+		return
+	}
+	sql := truncateSQLPreview(query.SQL, watchdogSQLPreviewLen)
+	action := "仍在执行"
+	if event == AlertEventQueryCancelled {
+		action = "已超过执行上限并被自动取消"
+	}
+	alert := QueryAlert{
+		Text: fmt.Sprintf("[pg-mcp-server] 查询 %s (conn %s, pid %d) %s，已执行 %s\n%s",
+			query.QueryID, query.ConnID, query.BackendPID, action, (time.Duration(query.ElapsedMs) * time.Millisecond).String(), sql),
+		Event:      event,
+		QueryID:    query.QueryID,
+		ConnID:     query.ConnID,
+		BackendPID: query.BackendPID,
+		SQL:        sql,
+		ElapsedMs:  query.ElapsedMs,
+		ReadOnly:   query.ReadOnly,
+	}
+	body, err := json.Marshal(alert)
+	if err != nil {
+		utils.DefaultLogger.Error("序列化查询告警失败", zap.Error(err))
+		return
+	}
+
+	resp, err := w.httpClient.Post(w.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		utils.DefaultLogger.Warn("发送查询告警失败", zap.String("queryID", query.QueryID), zap.Error(err))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		utils.DefaultLogger.Warn("查询告警 Webhook 返回错误状态", zap.String("queryID", query.QueryID), zap.Int("status", resp.StatusCode))
+	}
+}
+
+// truncateSQLPreview 把 SQL 截断到最多 maxLen 字节 (不切开多字节字符)，截断时追加 "..."
+func truncateSQLPreview(sql string, maxLen int) string {
+	if len(sql) <= maxLen {
+		return sql
+	}
+	end := maxLen
+	for end > 0 && !utf8.RuneStart(sql[end]) {
+		end--
+	}
+	return sql[:end] + "..."
+}
@@ -1,16 +1,18 @@
 package extensions
 
 import (
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/cbc3929/pg_mcp_server/internal/utils"
 
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v3" // 引入 YAML 解析库
 )
 
 // Manager 定义了扩展知识管理器的接口
@@ -18,47 +20,184 @@ type Manager interface {
 	// LoadKnowledge 从配置的目录加载所有扩展知识 YAML 文件并缓存。
 	LoadKnowledge() error
 
+	// ReloadKnowledge 重新加载目录中的 YAML 文件，返回与上次加载相比新增、修改、删除和加载失败的扩展。
+	// 加载失败的文件保留上次成功加载的知识；目录无法读取时返回错误，缓存保持不变。
+	ReloadKnowledge() (KnowledgeReload, error)
+
 	// GetExtensionKnowledge 返回指定扩展名的缓存知识数据。
 	// found bool指示是否找到了该扩展的知识。
 	GetExtensionKnowledge(extensionName string) (KnowledgeData, bool)
+
+	// AllKnowledge 返回所有已加载的扩展知识 (扩展名 -> 知识数据)。
+	AllKnowledge() map[string]KnowledgeData
+
+	// ValidateKnowledge 校验目录中的 YAML 文件 (extensionName 不为空时只校验该扩展)，不改变已加载的知识。
+	ValidateKnowledge(extensionName string) ([]KnowledgeFileReport, error)
+}
+
+// KnowledgeReload 是一次重新加载的结果
+type KnowledgeReload struct {
+	Added     []string          `json:"added,omitempty"`   // 新增的扩展
+	Updated   []string          `json:"updated,omitempty"` // 文件内容变化的扩展
+	Removed   []string          `json:"removed,omitempty"` // 文件被删除的扩展
+	Failed    map[string]string `json:"failed,omitempty"`  // 读取或解析失败的扩展 -> 错误 (沿用上次加载的知识)
+	Unchanged int               `json:"unchanged"`         // 内容未变化的扩展数
+	Loaded    int               `json:"loaded"`            // 重新加载后缓存中的扩展总数
+}
+
+// Changed 判断重新加载是否改变了缓存
+func (r KnowledgeReload) Changed() bool {
+	return len(r.Added) > 0 || len(r.Updated) > 0 || len(r.Removed) > 0
 }
 
 // manager 是 ExtensionManager 接口的实现。
 type manager struct {
 	extensionsDir string                   // 存放 YAML 文件的目录
+	fallbackDirs  []string                 // 优先级低于 extensionsDir 的目录 (例如远程知识的本地副本)，同名扩展以 extensionsDir 为准
 	cache         map[string]KnowledgeData // 扩展名 -> 解析后的 YAML 数据
+	digests       map[string][32]byte      // 扩展名 -> 文件内容的 SHA-256，用于判断重新加载时文件是否变化
 	mu            sync.RWMutex             // 保护缓存的读写锁
+	reloadMu      sync.Mutex               // 串行化重新加载 (文件监听和 reload_extensions 工具可能同时触发)
 }
 
 // NewManager 创建一个新的 Extension Manager 实例。
 // extensionsDir: 包含扩展知识 YAML 文件的目录路径。
-func NewManager(extensionsDir string) Manager {
-	utils.DefaultLogger.Info("初始化扩展知识管理器...", zap.String("directory", extensionsDir))
+// fallbackDirs: 优先级较低的其他目录 (按优先级从低到高排列)，目录不存在时跳过。
+func NewManager(extensionsDir string, fallbackDirs ...string) Manager {
+	utils.DefaultLogger.Info("初始化扩展知识管理器...", zap.String("directory", extensionsDir), zap.Strings("fallbackDirectories", fallbackDirs))
 	return &manager{
 		extensionsDir: extensionsDir,
+		fallbackDirs:  fallbackDirs,
 		cache:         make(map[string]KnowledgeData),
+		digests:       make(map[string][32]byte),
 		// mu 默认零值可用
 	}
 }
 
 // LoadKnowledge 实现 Manager 接口。
 func (m *manager) LoadKnowledge() error {
+	_, err := m.ReloadKnowledge()
+	return err
+}
+
+// ReloadKnowledge 实现 Manager 接口。
+// 先在锁外读取和解析所有文件，再一次性替换缓存，读取期间的查询看到的仍是完整的旧知识。
+func (m *manager) ReloadKnowledge() (KnowledgeReload, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
 	utils.DefaultLogger.Info("开始加载扩展知识 YAML 文件...", zap.String("directory", m.extensionsDir))
 
+	// 扩展名 -> 文件路径；后读取的目录优先级更高，覆盖先前目录中的同名扩展
+	paths := make(map[string]string)
+	for _, dir := range m.fallbackDirs {
+		if err := collectKnowledgeFiles(dir, paths); err != nil {
+			utils.DefaultLogger.Debug("读取扩展知识目录失败，跳过", zap.String("directory", dir), zap.Error(err))
+		}
+	}
+	if err := collectKnowledgeFiles(m.extensionsDir, paths); err != nil {
+		// 如果目录不存在或是其他读取错误，记录错误但允许服务器继续运行（无扩展知识）
+		utils.DefaultLogger.Error("读取扩展知识目录失败", zap.String("directory", m.extensionsDir), zap.Error(err))
+		return KnowledgeReload{}, fmt.Errorf("读取扩展目录 '%s' 失败: %w", m.extensionsDir, err) // 返回错误，让上层决定是否中止
+	}
+
+	m.mu.RLock()
+	previous, previousDigests := m.cache, m.digests
+	m.mu.RUnlock()
+
+	result := KnowledgeReload{}
+	cache := make(map[string]KnowledgeData, len(paths))
+	digests := make(map[string][32]byte, len(paths))
+	for extensionName, filePath := range paths {
+		utils.DefaultLogger.Debug("正在加载扩展文件...", zap.String("path", filePath))
+
+		knowledge, digest, err := readKnowledgeFile(filePath)
+		if err != nil {
+			utils.DefaultLogger.Error("加载扩展 YAML 文件失败", zap.String("path", filePath), zap.Error(err))
+			if result.Failed == nil {
+				result.Failed = make(map[string]string)
+			}
+			result.Failed[extensionName] = err.Error()
+			// 沿用上次成功加载的知识，编辑过程中写出的半个文件不会让扩展知识消失
+			if old, ok := previous[extensionName]; ok {
+				cache[extensionName], digests[extensionName] = old, previousDigests[extensionName]
+			}
+			continue
+		}
+
+		// 存入缓存
+		cache[extensionName], digests[extensionName] = knowledge, digest
+		oldDigest, existed := previousDigests[extensionName]
+		switch {
+		case !existed:
+			result.Added = append(result.Added, extensionName)
+			utils.DefaultLogger.Info("成功加载并缓存扩展知识", zap.String("extension", extensionName), zap.String("file", filePath))
+		case oldDigest != digest:
+			result.Updated = append(result.Updated, extensionName)
+			utils.DefaultLogger.Info("扩展知识已更新", zap.String("extension", extensionName), zap.String("file", filePath))
+		default:
+			result.Unchanged++
+		}
+	}
+	for extensionName := range previous {
+		if _, ok := cache[extensionName]; !ok {
+			result.Removed = append(result.Removed, extensionName)
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Updated)
+	sort.Strings(result.Removed)
+	result.Loaded = len(cache)
+
 	m.mu.Lock() // 获取写锁
-	defer m.mu.Unlock()
+	m.cache, m.digests = cache, digests
+	m.mu.Unlock()
 
-	// 清空旧缓存，确保加载的是最新的
-	m.cache = make(map[string]KnowledgeData)
+	utils.DefaultLogger.Info("扩展知识加载完成", zap.Int("loadedCount", len(cache)), zap.Int("totalFilesChecked", len(paths)),
+		zap.Strings("added", result.Added), zap.Strings("updated", result.Updated), zap.Strings("removed", result.Removed))
+	return result, nil
+}
 
-	files, err := os.ReadDir(m.extensionsDir)
-	if err != nil {
-		// 如果目录不存在或是其他读取错误，记录错误但允许服务器继续运行（无扩展知识）
-		utils.DefaultLogger.Error("读取扩展知识目录失败", zap.String("directory", m.extensionsDir), zap.Error(err))
-		return fmt.Errorf("读取扩展目录 '%s' 失败: %w", m.extensionsDir, err) // 返回错误，让上层决定是否中止
+// ValidateKnowledge 实现 Manager 接口。
+// 与加载使用相同的目录和优先级，只校验实际生效的文件 (被 extensionsDir 中同名文件覆盖的低优先级文件不校验)。
+func (m *manager) ValidateKnowledge(extensionName string) ([]KnowledgeFileReport, error) {
+	paths := make(map[string]string)
+	for _, dir := range m.fallbackDirs {
+		_ = collectKnowledgeFiles(dir, paths) // 与加载时相同，低优先级目录不存在时跳过
 	}
+	if err := collectKnowledgeFiles(m.extensionsDir, paths); err != nil {
+		return nil, fmt.Errorf("读取扩展目录 '%s' 失败: %w", m.extensionsDir, err)
+	}
+
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		if extensionName == "" || name == extensionName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	reports := make([]KnowledgeFileReport, 0, len(names))
+	for _, name := range names {
+		report := KnowledgeFileReport{Extension: name, File: paths[name], Valid: true}
+		if _, _, err := readKnowledgeFile(paths[name]); err != nil {
+			report.Valid = false
+			var knowledgeErr *KnowledgeError
+			if errors.As(err, &knowledgeErr) {
+				report.Issues = knowledgeErr.Issues
+			} else {
+				report.Issues = []KnowledgeIssue{{Message: err.Error()}}
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
 
-	loadedCount := 0
+// collectKnowledgeFiles 把目录中的 YAML 文件按扩展名 (文件名去除后缀) 记录到 paths 中，覆盖已有的同名扩展
+func collectKnowledgeFiles(dir string, paths map[string]string) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
 	for _, file := range files {
 		// 跳过目录和非 YAML 文件
 		if file.IsDir() {
@@ -68,36 +207,25 @@ func (m *manager) LoadKnowledge() error {
 		if !strings.HasSuffix(fileName, ".yaml") && !strings.HasSuffix(fileName, ".yml") {
 			continue
 		}
+		paths[strings.TrimSuffix(fileName, filepath.Ext(fileName))] = filepath.Join(dir, fileName)
+	}
+	return nil
+}
 
-		// 提取扩展名 (文件名去除后缀)
-		extensionName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
-		filePath := filepath.Join(m.extensionsDir, fileName)
-
-		utils.DefaultLogger.Debug("正在加载扩展文件...", zap.String("path", filePath))
-
-		// 读取文件内容
-		yamlData, err := os.ReadFile(filePath)
-		if err != nil {
-			utils.DefaultLogger.Error("读取扩展 YAML 文件失败", zap.String("path", filePath), zap.Error(err))
-			continue // 跳过这个文件，继续加载其他的
-		}
-
-		// 解析 YAML 内容
-		var knowledge KnowledgeData
-		err = yaml.Unmarshal(yamlData, &knowledge)
-		if err != nil {
-			utils.DefaultLogger.Error("解析扩展 YAML 文件失败", zap.String("path", filePath), zap.Error(err))
-			continue // 跳过这个文件
-		}
-
-		// 存入缓存
-		m.cache[extensionName] = knowledge
-		loadedCount++
-		utils.DefaultLogger.Info("成功加载并缓存扩展知识", zap.String("extension", extensionName), zap.String("file", fileName))
+// readKnowledgeFile 读取并解析一个扩展知识 YAML 文件，返回知识数据和文件内容的摘要
+func readKnowledgeFile(filePath string) (KnowledgeData, [32]byte, error) {
+	// 读取文件内容
+	yamlData, err := os.ReadFile(filePath)
+	if err != nil {
+		return KnowledgeData{}, [32]byte{}, fmt.Errorf("读取文件失败: %w", err)
 	}
 
-	utils.DefaultLogger.Info("扩展知识加载完成", zap.Int("loadedCount", loadedCount), zap.Int("totalFilesChecked", len(files)))
-	return nil
+	// 解析并校验 YAML 内容
+	knowledge, err := ParseKnowledge(yamlData)
+	if err != nil {
+		return KnowledgeData{}, [32]byte{}, fmt.Errorf("扩展知识格式错误: %w", err)
+	}
+	return knowledge, sha256.Sum256(yamlData), nil
 }
 
 // GetExtensionKnowledge 实现 Manager 接口。
@@ -109,3 +237,15 @@ func (m *manager) GetExtensionKnowledge(extensionName string) (KnowledgeData, bo
 	// 返回浅拷贝，如果需要防止外部修改缓存，应考虑深拷贝
 	return knowledge, found
 }
+
+// AllKnowledge 实现 Manager 接口。
+func (m *manager) AllKnowledge() map[string]KnowledgeData {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	all := make(map[string]KnowledgeData, len(m.cache))
+	for name, knowledge := range m.cache {
+		all[name] = knowledge
+	}
+	return all
+}
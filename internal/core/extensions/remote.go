@@ -0,0 +1,545 @@
+package extensions
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// 远程来源的类型
+const (
+	remoteKindHTTP = "http"
+	remoteKindGit  = "git"
+)
+
+const (
+	// remoteMaxBytes 是下载内容 (单个文件或解压后的知识包) 的大小上限
+	remoteMaxBytes = 32 << 20
+	// remoteSyncTimeout 是定期重新获取时单次获取的超时
+	remoteSyncTimeout = 5 * time.Minute
+)
+
+// remoteMeta 是 HTTP(S) 来源最近一次成功获取的记录，保存在缓存目录的 meta.json 中
+type remoteMeta struct {
+	URL    string `json:"url"`
+	ETag   string `json:"etag,omitempty"`
+	SHA256 string `json:"sha256"`
+}
+
+// RemoteSource 从 HTTP(S) 地址或 git 仓库获取扩展知识，保存到本地缓存目录，由 Manager 作为低优先级目录加载。
+// 获取失败时缓存目录中保留上次成功获取的内容，远程服务不可用不影响启动。
+type RemoteSource struct {
+	kind      string
+	url       string
+	ref       string // git 分支、标签或完整的提交哈希 (固定版本)
+	subdir    string // git 仓库中存放 YAML 文件的子目录
+	token     string
+	checksum  string            // 期望的内容 SHA-256 (小写十六进制)，为空时不校验
+	publicKey ed25519.PublicKey // 签名公钥，为空时不校验签名 (HTTP(S) 来源校验 <url>.sig，git 来源校验标签或提交的 SSH 签名)
+	cacheDir  string
+	interval  time.Duration
+
+	httpClient *http.Client
+	syncMu     sync.Mutex // 串行化获取 (启动时获取和定期获取不会同时写缓存目录)
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRemoteSource 根据配置创建一个新的 RemoteSource。
+// 未配置 EXTENSIONS_REMOTE_URL 时返回 nil，表示不启用；配置无效时记录错误并返回 nil。
+func NewRemoteSource(cfg *config.Config) *RemoteSource {
+	if cfg.ExtensionsRemoteURL == "" {
+		return nil
+	}
+	source := &RemoteSource{
+		ref:        cfg.ExtensionsRemoteRef,
+		token:      cfg.ExtensionsRemoteToken,
+		checksum:   strings.ToLower(strings.TrimSpace(cfg.ExtensionsRemoteSHA256)),
+		cacheDir:   cfg.ExtensionsRemoteCacheDir,
+		interval:   cfg.ExtensionsRemoteRefresh,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+	source.kind, source.url = parseRemoteURL(cfg.ExtensionsRemoteURL)
+
+	var err error
+	switch {
+	case source.kind == remoteKindHTTP && !isHTTPURL(source.url):
+		err = fmt.Errorf("地址必须是 http(s) 地址或 git 仓库")
+	case source.kind == remoteKindGit && strings.HasPrefix(source.ref, "-"):
+		err = fmt.Errorf("EXTENSIONS_REMOTE_REF 不能以 '-' 开头")
+	case cfg.ExtensionsRemotePath != "" && !filepath.IsLocal(cfg.ExtensionsRemotePath):
+		err = fmt.Errorf("EXTENSIONS_REMOTE_PATH 必须是仓库内的相对路径")
+	case source.kind == remoteKindGit && source.checksum != "":
+		err = fmt.Errorf("EXTENSIONS_REMOTE_SHA256 只适用于 HTTP(S) 来源，git 来源请在 EXTENSIONS_REMOTE_REF 中指定完整的提交哈希来固定版本")
+	case source.checksum != "" && (len(source.checksum) != sha256.Size*2 || !isHex(source.checksum)):
+		err = fmt.Errorf("EXTENSIONS_REMOTE_SHA256 必须是 64 位十六进制字符串")
+	}
+	if err == nil && cfg.ExtensionsRemotePublicKey != "" {
+		key, decodeErr := base64.StdEncoding.DecodeString(strings.TrimSpace(cfg.ExtensionsRemotePublicKey))
+		if decodeErr != nil || len(key) != ed25519.PublicKeySize {
+			err = fmt.Errorf("EXTENSIONS_REMOTE_PUBLIC_KEY 必须是 base64 编码的 %d 字节 Ed25519 公钥", ed25519.PublicKeySize)
+		}
+		source.publicKey = key
+	}
+	if err != nil {
+		utils.DefaultLogger.Error("远程扩展知识来源配置无效，不使用远程知识", zap.String("url", redactURL(source.url)), zap.Error(err))
+		return nil
+	}
+	source.subdir = cfg.ExtensionsRemotePath
+	return source
+}
+
+// parseRemoteURL 判断来源类型: git+ 前缀、git@ / ssh:// / git:// 开头或以 .git 结尾的地址为 git 仓库，其他为 HTTP(S) 地址
+func parseRemoteURL(rawURL string) (string, string) {
+	rawURL = strings.TrimSpace(rawURL)
+	if trimmed, ok := strings.CutPrefix(rawURL, "git+"); ok {
+		return remoteKindGit, trimmed
+	}
+	if strings.HasPrefix(rawURL, "git@") || strings.HasPrefix(rawURL, "ssh://") || strings.HasPrefix(rawURL, "git://") ||
+		strings.HasSuffix(strings.TrimSuffix(rawURL, "/"), ".git") {
+		return remoteKindGit, rawURL
+	}
+	return remoteKindHTTP, rawURL
+}
+
+// Dirs 返回需要由 Manager 加载的本地缓存目录。对 nil RemoteSource 调用返回 nil。
+func (r *RemoteSource) Dirs() []string {
+	if r == nil {
+		return nil
+	}
+	if r.kind == remoteKindGit {
+		return []string{filepath.Join(r.cacheDir, "git", r.subdir)}
+	}
+	return []string{filepath.Join(r.cacheDir, "http", "files")}
+}
+
+// Sync 获取一次远程知识并更新本地缓存目录，返回内容是否变化。对 nil RemoteSource 调用是安全的。
+// 获取或校验失败时返回错误，缓存目录保持不变。
+func (r *RemoteSource) Sync(ctx context.Context) (bool, error) {
+	if r == nil {
+		return false, nil
+	}
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+
+	var changed bool
+	var err error
+	if r.kind == remoteKindGit {
+		changed, err = r.syncGit(ctx)
+	} else {
+		changed, err = r.syncHTTP(ctx)
+	}
+	if err != nil {
+		return false, err
+	}
+	if changed {
+		utils.DefaultLogger.Info("远程扩展知识已更新", zap.String("url", redactURL(r.url)))
+	} else {
+		utils.DefaultLogger.Debug("远程扩展知识未变化", zap.String("url", redactURL(r.url)))
+	}
+	return changed, nil
+}
+
+// Start 在后台按 EXTENSIONS_REMOTE_REFRESH 定期获取远程知识，内容变化时重新加载 manager 的扩展知识。
+// 间隔为 0 时不启动。对 nil RemoteSource 调用是安全的。
+func (r *RemoteSource) Start(manager Manager) {
+	if r == nil || r.interval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	utils.DefaultLogger.Info("远程扩展知识定期获取已启动", zap.String("url", redactURL(r.url)), zap.Duration("interval", r.interval))
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				syncCtx, syncCancel := context.WithTimeout(ctx, remoteSyncTimeout)
+				changed, err := r.Sync(syncCtx)
+				syncCancel()
+				if err != nil {
+					utils.DefaultLogger.Warn("获取远程扩展知识失败，继续使用上次获取的内容", zap.String("url", redactURL(r.url)), zap.Error(err))
+					continue
+				}
+				if changed {
+					if _, err := manager.ReloadKnowledge(); err != nil {
+						utils.DefaultLogger.Error("远程扩展知识更新后重新加载失败", zap.Error(err))
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止定期获取并等待其退出 (会中断进行中的获取)。对 nil 或未启动的 RemoteSource 调用是安全的。
+func (r *RemoteSource) Stop() {
+	if r == nil || r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+	utils.DefaultLogger.Info("远程扩展知识定期获取已停止")
+}
+
+// syncHTTP 下载 HTTP(S) 来源。带上次响应的 ETag 发送 If-None-Match，304 时不重新下载；
+// 新内容通过校验和与签名校验后解压到临时目录，再替换缓存目录。
+func (r *RemoteSource) syncHTTP(ctx context.Context) (bool, error) {
+	baseDir := filepath.Join(r.cacheDir, "http")
+	filesDir := filepath.Join(baseDir, "files")
+	metaPath := filepath.Join(baseDir, "meta.json")
+
+	var meta remoteMeta
+	if data, err := os.ReadFile(metaPath); err == nil {
+		_ = json.Unmarshal(data, &meta) // 损坏的记录等同于没有记录
+	}
+	if _, err := os.Stat(filesDir); err != nil || meta.URL != r.url {
+		meta = remoteMeta{}
+	}
+
+	body, etag, err := r.fetch(ctx, r.url, meta.ETag)
+	if err != nil {
+		return false, err
+	}
+	if body == nil {
+		return false, nil // 304 Not Modified
+	}
+
+	digest := sha256.Sum256(body)
+	sum := hex.EncodeToString(digest[:])
+	if r.checksum != "" && sum != r.checksum {
+		return false, fmt.Errorf("内容的 SHA-256 为 %s，与 EXTENSIONS_REMOTE_SHA256 不一致", sum)
+	}
+	if r.publicKey != nil {
+		if err := r.verifySignature(ctx, body); err != nil {
+			return false, err
+		}
+	}
+	if sum == meta.SHA256 {
+		// 服务端不支持 ETag 时每次都会返回完整内容，内容未变化时只更新记录
+		meta.ETag = etag
+		return false, writeRemoteMeta(metaPath, meta)
+	}
+
+	tmpDir := filesDir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return false, fmt.Errorf("清理临时目录失败: %w", err)
+	}
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return false, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	var count int
+	if len(body) >= 2 && body[0] == 0x1f && body[1] == 0x8b {
+		count, err = extractKnowledgeArchive(body, tmpDir)
+	} else {
+		count, err = writeKnowledgeFile(body, r.url, tmpDir)
+	}
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return false, err
+	}
+
+	oldDir := filesDir + ".old"
+	os.RemoveAll(oldDir)
+	if err := os.Rename(filesDir, oldDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		os.RemoveAll(tmpDir)
+		return false, fmt.Errorf("替换缓存目录失败: %w", err)
+	}
+	if err := os.Rename(tmpDir, filesDir); err != nil {
+		return false, fmt.Errorf("替换缓存目录失败: %w", err)
+	}
+	os.RemoveAll(oldDir)
+	utils.DefaultLogger.Info("已下载远程扩展知识", zap.String("url", redactURL(r.url)), zap.Int("files", count), zap.String("sha256", sum))
+	return true, writeRemoteMeta(metaPath, remoteMeta{URL: r.url, ETag: etag, SHA256: sum})
+}
+
+// fetch 发送 GET 请求，返回响应内容和 ETag；etag 不为空且服务端返回 304 时内容为 nil
+func (r *RemoteSource) fetch(ctx context.Context, rawURL, etag string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("创建请求失败: %w", err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("请求 '%s' 失败: %w", redactURL(rawURL), err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && etag != "":
+		return nil, etag, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, "", fmt.Errorf("请求 '%s' 返回 HTTP %d", redactURL(rawURL), resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, remoteMaxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("读取 '%s' 的响应失败: %w", redactURL(rawURL), err)
+	}
+	if len(body) > remoteMaxBytes {
+		return nil, "", fmt.Errorf("'%s' 的内容超过 %d 字节", redactURL(rawURL), remoteMaxBytes)
+	}
+	return body, resp.Header.Get("ETag"), nil
+}
+
+// verifySignature 下载 <url>.sig 并用配置的公钥校验内容的 Ed25519 签名。签名文件可以是 base64 文本或原始的 64 字节
+func (r *RemoteSource) verifySignature(ctx context.Context, body []byte) error {
+	sigURL, err := url.Parse(r.url)
+	if err != nil {
+		return fmt.Errorf("解析地址失败: %w", err)
+	}
+	sigURL.Path += ".sig"
+	signature, _, err := r.fetch(ctx, sigURL.String(), "")
+	if err != nil {
+		return fmt.Errorf("下载签名失败: %w", err)
+	}
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil || len(decoded) != ed25519.SignatureSize {
+			return fmt.Errorf("签名格式无效: 需要 base64 编码或原始的 %d 字节 Ed25519 签名", ed25519.SignatureSize)
+		}
+		signature = decoded
+	}
+	if !ed25519.Verify(r.publicKey, body, signature) {
+		return fmt.Errorf("签名校验失败，拒绝使用下载的扩展知识")
+	}
+	return nil
+}
+
+// extractKnowledgeArchive 把 .tar.gz 知识包中的 YAML 文件解压到 dir (忽略目录结构和其他文件)，返回文件个数
+func extractKnowledgeArchive(body []byte, dir string) (int, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("解压知识包失败: %w", err)
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	written := make(map[string]string)
+	var total int64
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("读取知识包失败: %w", err)
+		}
+		name := path.Base(header.Name)
+		if header.Typeflag != tar.TypeReg || strings.HasPrefix(name, ".") ||
+			(!strings.HasSuffix(name, ".yaml") && !strings.HasSuffix(name, ".yml")) {
+			continue
+		}
+		if previous, ok := written[name]; ok {
+			return 0, fmt.Errorf("知识包中 '%s' 和 '%s' 的文件名重复", previous, header.Name)
+		}
+		total += header.Size
+		if total > remoteMaxBytes {
+			return 0, fmt.Errorf("知识包解压后超过 %d 字节", remoteMaxBytes)
+		}
+		data, err := io.ReadAll(io.LimitReader(reader, header.Size))
+		if err != nil {
+			return 0, fmt.Errorf("读取知识包中的 '%s' 失败: %w", header.Name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return 0, fmt.Errorf("写入 '%s' 失败: %w", name, err)
+		}
+		written[name] = header.Name
+	}
+	if len(written) == 0 {
+		return 0, fmt.Errorf("知识包中没有 YAML 文件")
+	}
+	return len(written), nil
+}
+
+// writeKnowledgeFile 把单个 YAML 文件写入 dir，文件名 (即扩展名) 取自地址的最后一段
+func writeKnowledgeFile(body []byte, rawURL, dir string) (int, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, fmt.Errorf("解析地址失败: %w", err)
+	}
+	name := path.Base(parsed.Path)
+	if !strings.HasSuffix(name, ".yaml") && !strings.HasSuffix(name, ".yml") {
+		return 0, fmt.Errorf("地址既不是 .tar.gz 知识包，也不以 .yaml/.yml 结尾，无法确定扩展名")
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), body, 0o644); err != nil {
+		return 0, fmt.Errorf("写入 '%s' 失败: %w", name, err)
+	}
+	return 1, nil
+}
+
+// writeRemoteMeta 写入最近一次成功获取的记录
+func writeRemoteMeta(metaPath string, meta remoteMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("序列化获取记录失败: %w", err)
+	}
+	if err := os.WriteFile(metaPath, data, 0o644); err != nil {
+		return fmt.Errorf("写入获取记录失败: %w", err)
+	}
+	return nil
+}
+
+// syncGit 初始化或更新 git 来源 (浅获取，只获取指定分支、标签或提交)，返回提交是否变化。
+// 获取的提交在通过固定提交和签名校验后才检出到工作区，校验失败时工作区保持不变。
+func (r *RemoteSource) syncGit(ctx context.Context) (bool, error) {
+	repoDir := filepath.Join(r.cacheDir, "git")
+	// 只在工作区自身有 .git 时才在其中执行命令: 否则 git 会向上查找，可能操作到包含缓存目录的其他仓库
+	_, statErr := os.Stat(filepath.Join(repoDir, ".git"))
+	var origin, before string
+	if statErr == nil {
+		origin, _ = runGit(ctx, repoDir, "remote", "get-url", "origin")
+	}
+	if origin == r.url {
+		// 新初始化的工作区还没有提交，rev-parse 失败时 before 为空
+		before, _ = runGit(ctx, repoDir, "rev-parse", "--verify", "--quiet", "HEAD")
+	} else {
+		// 工作区不存在、不完整或来源地址变化，重新初始化
+		if err := os.RemoveAll(repoDir); err != nil {
+			return false, fmt.Errorf("清理 git 工作区失败: %w", err)
+		}
+		if err := os.MkdirAll(repoDir, 0o755); err != nil {
+			return false, fmt.Errorf("创建 git 工作区失败: %w", err)
+		}
+		if _, err := runGit(ctx, repoDir, "init", "--quiet"); err != nil {
+			return false, err
+		}
+		if _, err := runGit(ctx, repoDir, "remote", "add", "origin", "--", r.url); err != nil {
+			return false, err
+		}
+	}
+
+	ref := r.ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err := runGit(ctx, repoDir, "fetch", "--quiet", "--depth", "1", "origin", ref); err != nil {
+		return false, err
+	}
+	after, err := runGit(ctx, repoDir, "rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return false, err
+	}
+	if isCommitHash(r.ref) && after != strings.ToLower(r.ref) {
+		return false, fmt.Errorf("获取的提交 %s 与 EXTENSIONS_REMOTE_REF 固定的提交 %s 不一致", after, r.ref)
+	}
+	// 提交未变化时也校验签名: 工作区中的提交可能是配置公钥之前检出的
+	if r.publicKey != nil {
+		if err := r.verifyGitSignature(ctx, repoDir); err != nil {
+			return false, err
+		}
+	}
+	if before == after {
+		return false, nil
+	}
+	if _, err := runGit(ctx, repoDir, "reset", "--quiet", "--hard", after); err != nil {
+		return false, err
+	}
+	utils.DefaultLogger.Info("git 来源已更新到新的提交", zap.String("url", redactURL(r.url)), zap.String("from", before), zap.String("to", after))
+	return true, nil
+}
+
+// verifyGitSignature 用配置的公钥校验 FETCH_HEAD 的 SSH 签名: 获取的是附注标签时校验标签签名，否则校验提交签名。
+// git 通过 ssh-keygen 校验签名，允许的签名者文件写在缓存目录中。
+func (r *RemoteSource) verifyGitSignature(ctx context.Context, repoDir string) error {
+	signersPath := filepath.Join(r.cacheDir, "allowed_signers")
+	if err := os.WriteFile(signersPath, []byte("* "+sshEd25519PublicKey(r.publicKey)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("写入允许的签名者文件失败: %w", err)
+	}
+	verify := "verify-commit"
+	if objectType, err := runGit(ctx, repoDir, "cat-file", "-t", "FETCH_HEAD"); err == nil && objectType == "tag" {
+		verify = "verify-tag"
+	}
+	absPath, err := filepath.Abs(signersPath)
+	if err != nil {
+		return fmt.Errorf("解析允许的签名者文件路径失败: %w", err)
+	}
+	if _, err := runGit(ctx, repoDir, "config", "gpg.ssh.allowedSignersFile", absPath); err != nil {
+		return err
+	}
+	if _, err := runGit(ctx, repoDir, verify, "FETCH_HEAD"); err != nil {
+		return fmt.Errorf("git 来源的签名校验失败，拒绝使用获取的扩展知识: %w", err)
+	}
+	return nil
+}
+
+// sshEd25519PublicKey 把 Ed25519 公钥编码为 OpenSSH authorized_keys 格式 (ssh-ed25519 <base64>)
+func sshEd25519PublicKey(key ed25519.PublicKey) string {
+	const keyType = "ssh-ed25519"
+	wire := binary.BigEndian.AppendUint32(nil, uint32(len(keyType)))
+	wire = append(wire, keyType...)
+	wire = binary.BigEndian.AppendUint32(wire, uint32(len(key)))
+	wire = append(wire, key...)
+	return keyType + " " + base64.StdEncoding.EncodeToString(wire)
+}
+
+// isCommitHash 判断 git 引用是否为完整的提交哈希 (SHA-1 的 40 位或 SHA-256 的 64 位十六进制)
+func isCommitHash(ref string) bool {
+	return (len(ref) == 40 || len(ref) == 64) && isHex(ref)
+}
+
+// runGit 在 dir 中执行 git 命令 (禁止交互式输入凭据)，返回去除首尾空白的输出
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s 失败: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// isHTTPURL 判断地址是否为 http(s) 地址
+func isHTTPURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// isHex 判断字符串是否为十六进制编码
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// redactURL 隐藏地址中的密码，用于日志
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return rawURL
+	}
+	return parsed.Redacted()
+}
@@ -1,3 +1,102 @@
 package extensions
 
-type KnowledgeData map[string]any
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KnowledgeData 是一个扩展知识 YAML 文件的内容 (文件结构见 validate.go 中的校验规则)
+type KnowledgeData struct {
+	Extension     string           `yaml:"extension,omitempty" json:"extension,omitempty"` // 对应的 PostgreSQL 扩展名 (pg_extension.extname)，为空时与知识名称 (文件名) 相同
+	Description   string           `yaml:"description" json:"description"`
+	DataTypes     []KnowledgeItem  `yaml:"data_types,omitempty" json:"data_types,omitempty"`
+	Operators     []KnowledgeItem  `yaml:"operators,omitempty" json:"operators,omitempty"`
+	Functions     FunctionList     `yaml:"functions,omitempty" json:"functions,omitempty"`
+	Examples      []QueryExample   `yaml:"examples,omitempty" json:"examples,omitempty"`
+	BestPractices []string         `yaml:"best_practices,omitempty" json:"best_practices,omitempty"`
+	PlanAdvice    []PlanAdviceRule `yaml:"plan_advice,omitempty" json:"plan_advice,omitempty"`
+}
+
+// ExtensionName 返回知识对应的 PostgreSQL 扩展名，name 是知识名称 (文件名)
+func (k KnowledgeData) ExtensionName(name string) string {
+	if k.Extension != "" {
+		return k.Extension
+	}
+	return name
+}
+
+// KnowledgeItem 是扩展提供的一个数据类型、操作符或函数
+type KnowledgeItem struct {
+	Name        string `yaml:"name" json:"name"`
+	Symbol      string `yaml:"symbol,omitempty" json:"symbol,omitempty"`     // 操作符的符号，例如 <->
+	Category    string `yaml:"category,omitempty" json:"category,omitempty"` // 函数的分类，例如 constructors
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Example     string `yaml:"example,omitempty" json:"example,omitempty"`
+	Notes       string `yaml:"notes,omitempty" json:"notes,omitempty"`
+}
+
+// FunctionList 是扩展提供的函数。YAML 中可以写成列表，也可以写成 分类 -> 列表 的映射，
+// 后者解析后按分类顺序展开为列表，分类记录在 Category 中。
+type FunctionList []KnowledgeItem
+
+// UnmarshalYAML 实现 yaml.Unmarshaler，支持列表和按分类的映射两种写法
+func (f *FunctionList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		var items []KnowledgeItem
+		if err := value.Decode(&items); err != nil {
+			return err
+		}
+		*f = items
+		return nil
+	}
+	var functions FunctionList
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		var items []KnowledgeItem
+		if err := value.Content[i+1].Decode(&items); err != nil {
+			return fmt.Errorf("分类 '%s': %w", value.Content[i].Value, err)
+		}
+		for _, item := range items {
+			item.Category = value.Content[i].Value
+			functions = append(functions, item)
+		}
+	}
+	*f = functions
+	return nil
+}
+
+// QueryExample 是一个示例查询
+type QueryExample struct {
+	Name        string         `yaml:"name" json:"name"`
+	Description string         `yaml:"description,omitempty" json:"description,omitempty"`
+	Query       string         `yaml:"query" json:"query"`
+	Result      *ExampleResult `yaml:"result,omitempty" json:"result,omitempty"` // 预期的结果形状
+}
+
+// ExampleResult 是示例查询预期返回的结果形状
+type ExampleResult struct {
+	Columns []ExampleColumn `yaml:"columns,omitempty" json:"columns,omitempty"`
+	Rows    string          `yaml:"rows,omitempty" json:"rows,omitempty"` // 行数和顺序的说明，例如 "最多 5 行，按距离升序"
+}
+
+// ExampleColumn 是示例查询结果中的一列
+type ExampleColumn struct {
+	Name        string `yaml:"name" json:"name"`
+	Type        string `yaml:"type,omitempty" json:"type,omitempty"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// PlanAdviceRule 是扩展知识中定义的一条执行计划建议规则 (规则的匹配逻辑见 plans 包)
+type PlanAdviceRule struct {
+	ID           string            `yaml:"id" json:"id"`
+	NodeTypes    []string          `yaml:"node_types,omitempty" json:"node_types,omitempty"`         // 节点类型 (Node Type)，为空时匹配所有节点
+	Match        map[string]string `yaml:"match,omitempty" json:"match,omitempty"`                   // 节点字段 -> 正则表达式，字段必须存在且匹配 (数组字段以 ", " 连接)
+	Absent       []string          `yaml:"absent,omitempty" json:"absent,omitempty"`                 // 节点中必须不存在的字段
+	MinTableRows float64           `yaml:"min_table_rows,omitempty" json:"min_table_rows,omitempty"` // 访问的表在 Schema 缓存中的大致行数下限
+	MinRows      float64           `yaml:"min_rows,omitempty" json:"min_rows,omitempty"`             // 节点每次循环输出的行数下限
+	MinLoops     float64           `yaml:"min_loops,omitempty" json:"min_loops,omitempty"`           // 节点执行次数下限
+	MinBytes     float64           `yaml:"min_bytes,omitempty" json:"min_bytes,omitempty"`           // 节点输出数据量 (行数 × 行宽) 下限
+	MinTotalCost float64           `yaml:"min_total_cost,omitempty" json:"min_total_cost,omitempty"` // 节点总成本下限
+	Severity     string            `yaml:"severity,omitempty" json:"severity,omitempty"`             // info 或 warning，默认 info
+	Advice       string            `yaml:"advice" json:"advice"`                                     // 建议文本，可以使用 {relation} {index} {node} {rows} {loops} {bytes} {table_rows} 占位符
+}
@@ -0,0 +1,369 @@
+package extensions
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxErrorIssues 是 KnowledgeError.Error() 中列出的问题数上限，完整列表见 Issues
+const maxErrorIssues = 5
+
+// KnowledgeIssue 是扩展知识文件中的一个问题
+type KnowledgeIssue struct {
+	Line    int    `json:"line,omitempty"`   // 行号 (从 1 开始)，0 表示与位置无关 (例如文件无法读取)
+	Column  int    `json:"column,omitempty"` // 列号 (从 1 开始)
+	Path    string `json:"path,omitempty"`   // 字段路径，例如 examples[2].query
+	Message string `json:"message"`
+}
+
+// String 返回 "行:列 路径: 问题" 形式的描述 (YAML 语法错误只有行号)
+func (i KnowledgeIssue) String() string {
+	var b strings.Builder
+	switch {
+	case i.Line > 0 && i.Column > 0:
+		fmt.Fprintf(&b, "%d:%d ", i.Line, i.Column)
+	case i.Line > 0:
+		fmt.Fprintf(&b, "%d: ", i.Line)
+	}
+	if i.Path != "" {
+		b.WriteString(i.Path)
+		b.WriteString(": ")
+	}
+	b.WriteString(i.Message)
+	return b.String()
+}
+
+// KnowledgeError 是扩展知识文件未通过校验时返回的错误
+type KnowledgeError struct {
+	Issues []KnowledgeIssue
+}
+
+// Error 实现 error 接口，列出前几个问题
+func (e *KnowledgeError) Error() string {
+	parts := make([]string, 0, min(len(e.Issues), maxErrorIssues)+1)
+	for i, issue := range e.Issues {
+		if i == maxErrorIssues {
+			parts = append(parts, fmt.Sprintf("另有 %d 个问题", len(e.Issues)-maxErrorIssues))
+			break
+		}
+		parts = append(parts, issue.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// KnowledgeFileReport 是一个扩展知识文件的校验结果
+type KnowledgeFileReport struct {
+	Extension string           `json:"extension"`
+	File      string           `json:"file"`
+	Valid     bool             `json:"valid"`
+	Issues    []KnowledgeIssue `json:"issues,omitempty"`
+}
+
+// fieldKind 是知识文件中字段值的类型
+type fieldKind int
+
+const (
+	fieldString    fieldKind = iota // 标量 (数字、布尔值按文本处理)
+	fieldNumber                     // 数值
+	fieldStrings                    // 标量列表
+	fieldStringMap                  // 名称 -> 标量 的映射
+	fieldObject                     // 对象
+	fieldItems                      // 对象列表
+	fieldFunctions                  // 对象列表，或 分类 -> 对象列表 的映射
+)
+
+// fieldSpec 描述知识文件中的一个字段
+type fieldSpec struct {
+	kind     fieldKind
+	required bool
+	item     map[string]fieldSpec                                      // fieldObject 的字段，或 fieldItems / fieldFunctions 列表元素的字段
+	check    func(v *knowledgeValidator, node *yaml.Node, path string) // 类型正确时的额外检查
+}
+
+// knowledgeItemFields 返回数据类型、操作符和函数条目的字段，extra 是该列表特有的可选字段
+func knowledgeItemFields(extra ...string) map[string]fieldSpec {
+	fields := map[string]fieldSpec{
+		"name":        {kind: fieldString, required: true},
+		"description": {kind: fieldString},
+		"example":     {kind: fieldString},
+		"notes":       {kind: fieldString},
+	}
+	for _, name := range extra {
+		fields[name] = fieldSpec{kind: fieldString}
+	}
+	return fields
+}
+
+// planAdviceFields 是 plan_advice 规则的字段
+var planAdviceFields = map[string]fieldSpec{
+	"id":             {kind: fieldString, required: true, check: checkAdviceID},
+	"node_types":     {kind: fieldStrings},
+	"match":          {kind: fieldStringMap, check: checkAdviceMatch},
+	"absent":         {kind: fieldStrings},
+	"min_table_rows": {kind: fieldNumber},
+	"min_rows":       {kind: fieldNumber},
+	"min_loops":      {kind: fieldNumber},
+	"min_bytes":      {kind: fieldNumber},
+	"min_total_cost": {kind: fieldNumber},
+	"severity":       {kind: fieldString, check: checkAdviceSeverity},
+	"advice":         {kind: fieldString, required: true},
+}
+
+// knowledgeFields 是知识文件顶层的字段
+var knowledgeFields = map[string]fieldSpec{
+	"description":    {kind: fieldString, required: true},
+	"data_types":     {kind: fieldItems, item: knowledgeItemFields()},
+	"operators":      {kind: fieldItems, item: knowledgeItemFields("symbol")},
+	"functions":      {kind: fieldFunctions, item: knowledgeItemFields("category")},
+	"best_practices": {kind: fieldStrings},
+	"plan_advice":    {kind: fieldItems, item: planAdviceFields},
+	"extension":      {kind: fieldString},
+	"examples": {kind: fieldItems, item: map[string]fieldSpec{
+		"name":        {kind: fieldString, required: true},
+		"description": {kind: fieldString},
+		"query":       {kind: fieldString, required: true},
+		"result": {kind: fieldObject, item: map[string]fieldSpec{
+			"rows": {kind: fieldString},
+			"columns": {kind: fieldItems, item: map[string]fieldSpec{
+				"name":        {kind: fieldString, required: true},
+				"type":        {kind: fieldString},
+				"description": {kind: fieldString},
+			}},
+		}},
+	}},
+}
+
+// yamlErrorLine 匹配 yaml.v3 错误信息中的行号，例如 "yaml: line 3: did not find expected key"
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// ParseKnowledge 解析并校验扩展知识 YAML。未通过校验时返回 *KnowledgeError，其中列出所有问题及其行号；
+// 未知字段、类型错误、缺少必填字段和无效的 plan_advice 规则都视为错误，避免拼写错误的字段被静默忽略。
+func ParseKnowledge(data []byte) (KnowledgeData, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return KnowledgeData{}, &KnowledgeError{Issues: yamlErrorIssues(err)}
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return KnowledgeData{}, &KnowledgeError{Issues: []KnowledgeIssue{{Line: 1, Column: 1, Message: "文件为空"}}}
+	}
+
+	v := &knowledgeValidator{adviceIDs: make(map[string]int)}
+	v.mapping(root.Content[0], "", knowledgeFields)
+	if len(v.issues) > 0 {
+		return KnowledgeData{}, &KnowledgeError{Issues: v.issues}
+	}
+
+	var knowledge KnowledgeData
+	if err := root.Decode(&knowledge); err != nil {
+		return KnowledgeData{}, &KnowledgeError{Issues: yamlErrorIssues(err)}
+	}
+	return knowledge, nil
+}
+
+// yamlErrorIssues 把 yaml.v3 的错误转换为带行号的问题
+func yamlErrorIssues(err error) []KnowledgeIssue {
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+	issues := make([]KnowledgeIssue, 0, len(messages))
+	for _, message := range messages {
+		issue := KnowledgeIssue{Message: strings.TrimPrefix(message, "yaml: ")}
+		if match := yamlErrorLine.FindStringSubmatch(message); match != nil {
+			issue.Line, _ = strconv.Atoi(match[1])
+			issue.Message = match[2]
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// knowledgeValidator 按 fieldSpec 遍历 YAML 节点树并收集问题
+type knowledgeValidator struct {
+	issues    []KnowledgeIssue
+	adviceIDs map[string]int // plan_advice 规则 id -> 首次出现的行号
+}
+
+// addf 记录节点位置上的一个问题
+func (v *knowledgeValidator) addf(node *yaml.Node, path, format string, args ...any) {
+	v.issues = append(v.issues, KnowledgeIssue{Line: node.Line, Column: node.Column, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// mapping 检查映射节点的字段: 未知字段、重复字段、缺少或为空的必填字段，并递归检查字段值
+func (v *knowledgeValidator) mapping(node *yaml.Node, path string, fields map[string]fieldSpec) {
+	node = resolveAlias(node)
+	if node.Kind != yaml.MappingNode {
+		v.addf(node, path, "应为映射 (键: 值)，实际为%s", nodeKindName(node))
+		return
+	}
+	seen := make(map[string]bool, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		key := keyNode.Value
+		fieldPath := joinPath(path, key)
+		spec, ok := fields[key]
+		switch {
+		case !ok:
+			v.addf(keyNode, fieldPath, "未知字段 '%s' (可用字段: %s)", key, strings.Join(sortedFieldNames(fields), ", "))
+			continue
+		case seen[key]:
+			v.addf(keyNode, fieldPath, "字段 '%s' 重复", key)
+			continue
+		}
+		seen[key] = true
+		v.value(valueNode, fieldPath, spec)
+	}
+	for _, name := range sortedFieldNames(fields) {
+		if fields[name].required && !seen[name] {
+			v.addf(node, path, "缺少必填字段 '%s'", name)
+		}
+	}
+}
+
+// value 检查字段值的类型，类型正确时执行字段的额外检查
+func (v *knowledgeValidator) value(node *yaml.Node, path string, spec fieldSpec) {
+	node = resolveAlias(node)
+	switch spec.kind {
+	case fieldString:
+		if node.Kind != yaml.ScalarNode {
+			v.addf(node, path, "应为文本，实际为%s", nodeKindName(node))
+			return
+		}
+		if spec.required && (node.Tag == "!!null" || strings.TrimSpace(node.Value) == "") {
+			v.addf(node, path, "不能为空")
+			return
+		}
+	case fieldNumber:
+		if node.Kind != yaml.ScalarNode || (node.Tag != "!!int" && node.Tag != "!!float") {
+			v.addf(node, path, "应为数值，实际为%s", nodeKindName(node))
+			return
+		}
+	case fieldStrings:
+		if node.Kind != yaml.SequenceNode {
+			v.addf(node, path, "应为列表，实际为%s", nodeKindName(node))
+			return
+		}
+		for i, item := range node.Content {
+			if item = resolveAlias(item); item.Kind != yaml.ScalarNode {
+				v.addf(item, fmt.Sprintf("%s[%d]", path, i), "应为文本，实际为%s", nodeKindName(item))
+			}
+		}
+	case fieldStringMap:
+		if node.Kind != yaml.MappingNode {
+			v.addf(node, path, "应为映射 (键: 值)，实际为%s", nodeKindName(node))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if item := resolveAlias(node.Content[i+1]); item.Kind != yaml.ScalarNode {
+				v.addf(item, joinPath(path, node.Content[i].Value), "应为文本，实际为%s", nodeKindName(item))
+			}
+		}
+	case fieldObject:
+		v.mapping(node, path, spec.item)
+	case fieldItems:
+		v.items(node, path, spec.item)
+	case fieldFunctions:
+		if node.Kind != yaml.MappingNode {
+			v.items(node, path, spec.item)
+			break
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.items(node.Content[i+1], joinPath(path, node.Content[i].Value), spec.item)
+		}
+	}
+	if spec.check != nil {
+		spec.check(v, node, path)
+	}
+}
+
+// items 检查对象列表中的每个元素
+func (v *knowledgeValidator) items(node *yaml.Node, path string, fields map[string]fieldSpec) {
+	node = resolveAlias(node)
+	if node.Kind != yaml.SequenceNode {
+		v.addf(node, path, "应为列表，实际为%s", nodeKindName(node))
+		return
+	}
+	for i, item := range node.Content {
+		v.mapping(item, fmt.Sprintf("%s[%d]", path, i), fields)
+	}
+}
+
+// checkAdviceID 检查 plan_advice 规则 id 在文件中唯一 (同一规则的建议按 id 去重)
+func checkAdviceID(v *knowledgeValidator, node *yaml.Node, path string) {
+	if line, ok := v.adviceIDs[node.Value]; ok {
+		v.addf(node, path, "规则 id '%s' 与第 %d 行的规则重复", node.Value, line)
+		return
+	}
+	v.adviceIDs[node.Value] = node.Line
+}
+
+// checkAdviceSeverity 检查 plan_advice 规则的 severity
+func checkAdviceSeverity(v *knowledgeValidator, node *yaml.Node, path string) {
+	switch node.Value {
+	case "", "info", "warning":
+	default:
+		v.addf(node, path, "severity 只能是 info 或 warning")
+	}
+}
+
+// checkAdviceMatch 检查 plan_advice 规则 match 中的正则表达式
+func checkAdviceMatch(v *knowledgeValidator, node *yaml.Node, path string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		pattern := resolveAlias(node.Content[i+1])
+		if _, err := regexp.Compile(pattern.Value); err != nil {
+			v.addf(pattern, joinPath(path, node.Content[i].Value), "正则表达式无效: %v", err)
+		}
+	}
+}
+
+// resolveAlias 返回别名 (*name) 指向的节点
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// nodeKindName 返回节点类型的描述，用于错误信息
+func nodeKindName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "映射"
+	case yaml.SequenceNode:
+		return "列表"
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return "空值"
+		}
+		return fmt.Sprintf("文本 '%s'", node.Value)
+	}
+	return "未知类型"
+}
+
+// joinPath 拼接字段路径
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// sortedFieldNames 返回按名称排序的字段名
+func sortedFieldNames(fields map[string]fieldSpec) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
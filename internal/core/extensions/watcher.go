@@ -0,0 +1,105 @@
+package extensions
+
+import (
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// watchDebounce 是目录最后一次变化后等待的时长，编辑器保存文件通常会连续产生多次写入和重命名事件
+const watchDebounce = 500 * time.Millisecond
+
+// Watcher 监听扩展知识目录，目录中的文件变化后重新加载扩展知识。
+// 任何事件都会触发重新加载 (而不只是 .yaml 文件): Kubernetes ConfigMap 挂载的目录通过替换 ..data 符号链接更新，
+// 事件中的文件名不是 YAML 文件；内容未变化的重新加载不会改变缓存。
+type Watcher struct {
+	manager Manager
+	dir     string
+
+	watcher *fsnotify.Watcher
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewWatcher 根据配置创建一个新的 Watcher。未开启 EXTENSIONS_WATCH 时返回 nil，表示不启用。
+func NewWatcher(manager Manager, cfg *config.Config) *Watcher {
+	if !cfg.ExtensionsWatch {
+		return nil
+	}
+	return &Watcher{manager: manager, dir: cfg.ExtensionsDir}
+}
+
+// Start 开始监听目录。目录无法监听时记录警告并放弃监听 (仍可通过 reload_extensions 工具重新加载)。
+// 对 nil Watcher 调用是安全的。
+func (w *Watcher) Start() {
+	if w == nil {
+		return
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		utils.DefaultLogger.Warn("创建扩展知识目录监听失败，文件变化不会自动重新加载", zap.String("directory", w.dir), zap.Error(err))
+		return
+	}
+	if err := watcher.Add(w.dir); err != nil {
+		watcher.Close()
+		utils.DefaultLogger.Warn("监听扩展知识目录失败，文件变化不会自动重新加载", zap.String("directory", w.dir), zap.Error(err))
+		return
+	}
+	w.watcher = watcher
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	utils.DefaultLogger.Info("扩展知识目录监听已启动", zap.String("directory", w.dir))
+
+	go func() {
+		defer close(w.done)
+		timer := time.NewTimer(watchDebounce)
+		timer.Stop()
+		defer timer.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				utils.DefaultLogger.Debug("扩展知识目录发生变化", zap.String("name", event.Name), zap.String("op", event.Op.String()))
+				timer.Reset(watchDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				utils.DefaultLogger.Warn("扩展知识目录监听出错", zap.String("directory", w.dir), zap.Error(err))
+			case <-timer.C:
+				w.reload()
+			}
+		}
+	}()
+}
+
+// Stop 停止监听并等待监听循环退出。对 nil 或未启动的 Watcher 调用是安全的。
+func (w *Watcher) Stop() {
+	if w == nil || w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.watcher.Close()
+	utils.DefaultLogger.Info("扩展知识目录监听已停止")
+}
+
+// reload 重新加载扩展知识；失败时保留当前缓存 (ReloadKnowledge 已记录错误日志)
+func (w *Watcher) reload() {
+	result, err := w.manager.ReloadKnowledge()
+	if err != nil {
+		return
+	}
+	if result.Changed() || len(result.Failed) > 0 {
+		utils.DefaultLogger.Info("扩展知识目录变化，已重新加载",
+			zap.Strings("added", result.Added), zap.Strings("updated", result.Updated),
+			zap.Strings("removed", result.Removed), zap.Int("failed", len(result.Failed)))
+	}
+}
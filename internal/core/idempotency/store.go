@@ -0,0 +1,192 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// tableName 是记录幂等键的表，放在 temp schema 下，与其他写入操作的限制一致
+const tableName = "temp.mcp_idempotency_keys"
+
+// completeAttempts 是保存结果失败时的尝试次数，每次重试前等待的时间递增 completeRetryDelay
+const (
+	completeAttempts   = 3
+	completeRetryDelay = 200 * time.Millisecond
+)
+
+// 幂等键的状态
+const (
+	StatusPending   = "pending"   // 请求正在执行
+	StatusCompleted = "completed" // 请求已完成，保存了结果
+)
+
+// ErrKeyInProgress 表示相同幂等键的请求仍在执行中
+var ErrKeyInProgress = errors.New("相同幂等键的请求仍在执行中")
+
+// ErrKeyMismatch 表示幂等键被用于参数不同的请求
+var ErrKeyMismatch = errors.New("幂等键已被参数不同的请求使用")
+
+// Record 是一条已登记的幂等键记录
+type Record struct {
+	Key    string // 调用方提供的幂等键
+	Tool   string // 工具名称
+	Status string // pending 或 completed
+	Result string // 完成时保存的工具结果 (JSON 文本)
+}
+
+// Store 定义了幂等键存储的接口
+type Store interface {
+	// Begin 登记一个幂等键。
+	// 如果该键是首次出现，返回 (nil, nil)，调用方应执行实际写入并在结束后调用 Complete 或 Abort。
+	// 如果该键已完成，返回之前保存的记录，调用方应直接重放结果。
+	// 如果该键仍在执行中或参数不一致，返回 ErrKeyInProgress / ErrKeyMismatch。
+	Begin(ctx context.Context, connID, tool, key string, args any) (*Record, error)
+
+	// Complete 保存写入操作的结果，之后的重放将直接返回该结果。
+	// 请求的 ctx 被取消后仍会保存，失败时重试；返回 error 时该键保持执行中状态 (直到 pendingTTL 过期)，不会被释放。
+	Complete(ctx context.Context, connID, tool, key, result string) error
+
+	// Abort 删除执行失败的幂等键，允许调用方使用同一个键重试。
+	Abort(ctx context.Context, connID, tool, key string)
+}
+
+// store 是基于 temp schema 表的 Store 实现。
+type store struct {
+	dbService  databases.Service
+	pendingTTL time.Duration // 执行中的键超过该时长后视为请求已中断，可以被新的请求接管；0 表示不过期
+	mu         sync.Mutex
+	prepared   map[string]bool // connID -> 记录表是否已创建
+}
+
+// NewStore 创建一个新的幂等键存储。
+// pendingTTL 是执行中状态的有效期，服务在执行写入时退出等原因留下的键在过期后可以重新使用；0 表示不过期。
+func NewStore(dbService databases.Service, pendingTTL time.Duration) Store {
+	return &store{dbService: dbService, pendingTTL: pendingTTL, prepared: make(map[string]bool)}
+}
+
+// ensureTable 在首次使用某个连接时创建记录表
+func (s *store) ensureTable(ctx context.Context, connID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.prepared[connID] {
+		return nil
+	}
+	ddl := `CREATE TABLE IF NOT EXISTS ` + tableName + ` (
+        tool         text        NOT NULL,
+        key          text        NOT NULL,
+        request_hash text        NOT NULL,
+        status       text        NOT NULL,
+        result       text,
+        created_at   timestamptz NOT NULL DEFAULT now(),
+        completed_at timestamptz,
+        PRIMARY KEY (tool, key)
+    )`
+	if err := s.dbService.ExecuteNonQuery(ctx, connID, false, ddl); err != nil {
+		return fmt.Errorf("创建幂等键记录表失败: %w", err)
+	}
+	s.prepared[connID] = true
+	return nil
+}
+
+// Begin 实现 Store 接口。
+func (s *store) Begin(ctx context.Context, connID, tool, key string, args any) (*Record, error) {
+	if err := s.ensureTable(ctx, connID); err != nil {
+		return nil, err
+	}
+	requestHash, err := hashArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// 通过主键冲突保证同一个键只有一个请求能进入执行；执行中状态已过期的键由本次请求接管
+	query := `INSERT INTO ` + tableName + ` (tool, key, request_hash, status) VALUES ($1, $2, $3, $4)
+         ON CONFLICT (tool, key) DO NOTHING RETURNING key`
+	queryArgs := []any{tool, key, requestHash, StatusPending}
+	if s.pendingTTL > 0 {
+		query = `INSERT INTO ` + tableName + ` AS k (tool, key, request_hash, status) VALUES ($1, $2, $3, $4)
+         ON CONFLICT (tool, key) DO UPDATE SET request_hash = EXCLUDED.request_hash, created_at = now()
+         WHERE k.status = $4 AND k.created_at < now() - make_interval(secs => $5) RETURNING key`
+		queryArgs = append(queryArgs, s.pendingTTL.Seconds())
+	}
+	inserted, err := s.dbService.ExecuteQuery(ctx, connID, false, query, queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("登记幂等键失败: %w", err)
+	}
+	if len(inserted) > 0 {
+		return nil, nil
+	}
+
+	rows, err := s.dbService.ExecuteQuery(ctx, connID, true,
+		`SELECT request_hash, status, result FROM `+tableName+` WHERE tool = $1 AND key = $2`, tool, key)
+	if err != nil {
+		return nil, fmt.Errorf("查询幂等键失败: %w", err)
+	}
+	if len(rows) == 0 {
+		// 记录在两次查询之间被 Abort 删除，视为本次请求可重试
+		return nil, fmt.Errorf("%w: 请稍后重试", ErrKeyInProgress)
+	}
+	row := rows[0]
+	if hash, _ := row["request_hash"].(string); hash != requestHash {
+		return nil, ErrKeyMismatch
+	}
+	record := &Record{Key: key, Tool: tool}
+	record.Status, _ = row["status"].(string)
+	record.Result, _ = row["result"].(string)
+	if record.Status != StatusCompleted {
+		if s.pendingTTL > 0 {
+			return nil, fmt.Errorf("%w (执行中状态超过 %s 后可以重新使用该键)", ErrKeyInProgress, s.pendingTTL)
+		}
+		return nil, ErrKeyInProgress
+	}
+	utils.DefaultLogger.Info("幂等键命中，重放之前的结果", zap.String("connID", connID), zap.String("tool", tool), zap.String("key", key))
+	return record, nil
+}
+
+// Complete 实现 Store 接口。
+func (s *store) Complete(ctx context.Context, connID, tool, key, result string) error {
+	// 写入已经执行，客户端断开也要记录结果，否则同一个键的重试会再次执行写入
+	ctx = context.WithoutCancel(ctx)
+	var err error
+	for attempt := 1; attempt <= completeAttempts; attempt++ {
+		err = s.dbService.ExecuteNonQuery(ctx, connID, false,
+			`UPDATE `+tableName+` SET status = $3, result = $4, completed_at = now() WHERE tool = $1 AND key = $2`,
+			tool, key, StatusCompleted, result)
+		if err == nil {
+			return nil
+		}
+		utils.DefaultLogger.Warn("保存幂等键结果失败", zap.String("tool", tool), zap.String("key", key), zap.Int("attempt", attempt), zap.Error(err))
+		if attempt < completeAttempts {
+			time.Sleep(time.Duration(attempt) * completeRetryDelay)
+		}
+	}
+	return fmt.Errorf("保存幂等键结果失败: %w", err)
+}
+
+// Abort 实现 Store 接口。
+func (s *store) Abort(ctx context.Context, connID, tool, key string) {
+	err := s.dbService.ExecuteNonQuery(context.WithoutCancel(ctx), connID, false,
+		`DELETE FROM `+tableName+` WHERE tool = $1 AND key = $2 AND status = $3`, tool, key, StatusPending)
+	if err != nil {
+		utils.DefaultLogger.Warn("删除失败请求的幂等键失败，该键在执行中状态过期后才能重新使用", zap.String("tool", tool), zap.String("key", key), zap.Error(err))
+	}
+}
+
+// hashArgs 计算请求参数的摘要，用于检测同一个键被不同请求复用
+func hashArgs(args any) (string, error) {
+	argsBytes, err := json.Marshal(args) // map 的键会被排序，结果是稳定的
+	if err != nil {
+		return "", fmt.Errorf("序列化请求参数失败: %w", err)
+	}
+	sum := sha256.Sum256(argsBytes)
+	return hex.EncodeToString(sum[:]), nil
+}
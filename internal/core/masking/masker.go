@@ -0,0 +1,264 @@
+package masking
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/results"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// 脱敏方式
+const (
+	ModeFull    = "full"    // 整个值替换为固定的占位符
+	ModePartial = "partial" // 保留少量字符 (邮箱保留首字符和域名，其他保留末尾 4 个字符)
+	ModeHash    = "hash"    // 替换为值的 SHA-256 前缀，相同的值得到相同的结果，仍可用于分组和关联
+)
+
+// fullMask 是 full 方式的占位符
+const fullMask = "******"
+
+// Rule 标记一个需要脱敏的列
+type Rule struct {
+	Schema string
+	Table  string
+	Column string
+	Mode   string
+}
+
+// ParseRules 解析 "schema.table.column:mode" 格式的规则列表，省略 mode 时为 full。
+// 名称比较不区分大小写。
+func ParseRules(specs []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(specs))
+	for _, spec := range specs {
+		target, mode, found := strings.Cut(spec, ":")
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		if !found || mode == "" {
+			mode = ModeFull
+		}
+		if mode != ModeFull && mode != ModePartial && mode != ModeHash {
+			return nil, fmt.Errorf("脱敏规则 '%s' 的方式无效 (可选 full, partial, hash)", spec)
+		}
+		parts := strings.Split(strings.TrimSpace(target), ".")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("无效的脱敏规则 '%s' (格式为 schema.table.column[:full|partial|hash])", spec)
+		}
+		rules = append(rules, Rule{Schema: parts[0], Table: parts[1], Column: parts[2], Mode: mode})
+	}
+	return rules, nil
+}
+
+// Masker 在结果返回给客户端之前对标记为脱敏的列做替换
+type Masker struct {
+	dbService databases.Service
+	rules     []Rule
+	names     map[string]string // 小写列名 -> 脱敏方式，用于无法追溯来源表的列
+
+	mu       sync.Mutex
+	resolved map[string]map[databases.ColumnSource]string // connID -> 来源列 -> 脱敏方式
+}
+
+// NewMasker 创建一个新的 Masker；rules 为空时所有方法都不修改结果。
+func NewMasker(dbService databases.Service, rules []Rule) *Masker {
+	names := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		names[strings.ToLower(rule.Column)] = strongerMode(names[strings.ToLower(rule.Column)], rule.Mode)
+	}
+	return &Masker{
+		dbService: dbService,
+		rules:     rules,
+		names:     names,
+		resolved:  make(map[string]map[databases.ColumnSource]string),
+	}
+}
+
+// Enabled 判断是否配置了任何脱敏规则
+func (m *Masker) Enabled() bool {
+	return m != nil && len(m.rules) > 0
+}
+
+// ModeFor 返回列的脱敏方式，不需要脱敏时返回空字符串
+func (m *Masker) ModeFor(schema, table, column string) string {
+	if m == nil {
+		return ""
+	}
+	return ModeFor(m.rules, schema, table, column)
+}
+
+// ModeFor 在规则列表中查找列的脱敏方式，不需要脱敏时返回空字符串
+func ModeFor(rules []Rule, schema, table, column string) string {
+	for _, rule := range rules {
+		if strings.EqualFold(rule.Schema, schema) && strings.EqualFold(rule.Table, table) && strings.EqualFold(rule.Column, column) {
+			return rule.Mode
+		}
+	}
+	return ""
+}
+
+// MaskTableRows 对来自单张表 (例如 SELECT * FROM schema.table) 的结果行按列名脱敏
+func (m *Masker) MaskTableRows(schema, table string, rows []map[string]any) {
+	if !m.Enabled() {
+		return
+	}
+	for _, row := range rows {
+		for column, value := range row {
+			if mode := m.ModeFor(schema, table, column); mode != "" {
+				row[column] = MaskValue(mode, value)
+			}
+		}
+	}
+}
+
+// MaskResult 对任意查询的结果脱敏。
+// 直接引用表列的结果列 (包括使用别名时) 按 RowDescription 中的来源表 OID 和列编号匹配规则；
+// 表达式计算出的列没有来源信息，保守地按列名匹配任何规则中的列名。
+// 经过函数变换 (例如 lower(email)) 或通过视图读取的值无法追溯，需要为视图列单独配置规则或配合访问策略使用。
+func (m *Masker) MaskResult(ctx context.Context, connID string, result *databases.QueryResult) error {
+	if !m.Enabled() || result == nil || len(result.Rows) == 0 {
+		return nil
+	}
+	masked, err := m.MaskedColumns(ctx, connID, result)
+	if err != nil {
+		return err
+	}
+	for column, mode := range masked {
+		for _, row := range result.Rows {
+			if value, ok := row[column]; ok {
+				row[column] = MaskValue(mode, value)
+			}
+		}
+	}
+	return nil
+}
+
+// MaskedColumns 返回结果中需要脱敏的列 (列名 -> 脱敏方式)，匹配规则与 MaskResult 相同。
+// 只使用列的来源信息，不需要结果行，可以配合 LIMIT 0 的查询在执行前检查结果是否包含脱敏列。
+func (m *Masker) MaskedColumns(ctx context.Context, connID string, result *databases.QueryResult) (map[string]string, error) {
+	if !m.Enabled() || result == nil {
+		return nil, nil
+	}
+	sources, err := m.sourceModes(ctx, connID)
+	if err != nil {
+		return nil, err
+	}
+	masked := make(map[string]string)
+	for i, column := range result.Columns {
+		var mode string
+		if i < len(result.Sources) && result.Sources[i].TableOID != 0 {
+			mode = sources[result.Sources[i]]
+		} else {
+			mode = m.names[strings.ToLower(column)]
+		}
+		if mode != "" {
+			masked[column] = mode
+		}
+	}
+	return masked, nil
+}
+
+// sourceModes 返回连接上所有脱敏列的 (表 OID, 列编号)，结果按连接缓存
+func (m *Masker) sourceModes(ctx context.Context, connID string) (map[databases.ColumnSource]string, error) {
+	m.mu.Lock()
+	cached, ok := m.resolved[connID]
+	m.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	schemaNames := make([]string, len(m.rules))
+	tableNames := make([]string, len(m.rules))
+	columnNames := make([]string, len(m.rules))
+	modes := make([]string, len(m.rules))
+	for i, rule := range m.rules {
+		schemaNames[i] = strings.ToLower(rule.Schema)
+		tableNames[i] = strings.ToLower(rule.Table)
+		columnNames[i] = strings.ToLower(rule.Column)
+		modes[i] = rule.Mode
+	}
+	query := `
+		SELECT c.oid::int8 AS table_oid, a.attnum::int4 AS attnum, r.mode
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[]) AS r(schema_name, table_name, column_name, mode)
+		JOIN pg_catalog.pg_namespace n ON lower(n.nspname) = r.schema_name
+		JOIN pg_catalog.pg_class c ON c.relnamespace = n.oid AND lower(c.relname) = r.table_name
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = c.oid AND lower(a.attname) = r.column_name
+		WHERE a.attnum > 0 AND NOT a.attisdropped;
+	`
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaNames, tableNames, columnNames, modes)
+	if err != nil {
+		return nil, fmt.Errorf("解析脱敏列失败: %w", err)
+	}
+	resolved := make(map[databases.ColumnSource]string, len(rows))
+	for _, row := range rows {
+		tableOID, _ := row["table_oid"].(int64)
+		attnum, _ := row["attnum"].(int32)
+		mode, _ := row["mode"].(string)
+		source := databases.ColumnSource{TableOID: uint32(tableOID), Attribute: uint16(attnum)}
+		resolved[source] = strongerMode(resolved[source], mode)
+	}
+	if len(resolved) < len(m.rules) {
+		utils.DefaultLogger.Warn("部分脱敏规则在数据库中没有对应的列", zap.String("connID", connID), zap.Int("rules", len(m.rules)), zap.Int("resolved", len(resolved)))
+	}
+
+	m.mu.Lock()
+	m.resolved[connID] = resolved
+	m.mu.Unlock()
+	return resolved, nil
+}
+
+// Invalidate 丢弃连接的来源列缓存 (例如重新加载 Schema 之后表可能被重建)
+func (m *Masker) Invalidate(connID string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	delete(m.resolved, connID)
+	m.mu.Unlock()
+}
+
+// MaskValue 按脱敏方式替换单个值，NULL 保持不变
+func MaskValue(mode string, value any) any {
+	if value == nil {
+		return nil
+	}
+	switch mode {
+	case ModeHash:
+		sum := sha256.Sum256([]byte(results.FormatValue(value)))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	case ModePartial:
+		text, ok := value.(string)
+		if !ok {
+			return fullMask
+		}
+		return maskPartial(text)
+	default:
+		return fullMask
+	}
+}
+
+// maskPartial 保留邮箱的首字符和域名，或其他文本的末尾 4 个字符 (文本太短时全部替换)
+func maskPartial(text string) string {
+	runes := []rune(text)
+	if at := strings.LastIndex(text, "@"); at > 0 {
+		local := []rune(text[:at])
+		return string(local[0]) + "***" + text[at:]
+	}
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+	return strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-4:])
+}
+
+// strongerMode 返回两种方式中泄露信息更少的一种 (full > hash > partial)
+func strongerMode(a, b string) string {
+	rank := map[string]int{"": 0, ModePartial: 1, ModeHash: 2, ModeFull: 3}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
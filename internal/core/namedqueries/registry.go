@@ -0,0 +1,206 @@
+// Package namedqueries 保存经过审核的参数化查询 (命名查询)。
+//
+// 运维人员在注册表文件中登记查询 (名称、SQL 模板和参数定义)，开启 NAMED_QUERY_REGISTRATION 时
+// 也可以通过 register_query 登记 (不能替换注册表文件中的查询)；
+// 客户端通过 run_named_query 按名称运行，只能提供参数值而不能修改 SQL。
+// 参数定义和绑定规则与工具包 (toolpacks) 相同。
+package namedqueries
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/toolpacks"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ErrNotFound 表示注册表中没有该名称的命名查询
+var ErrNotFound = errors.New("命名查询不存在")
+
+// ErrOperatorQuery 表示同名的命名查询来自运维人员维护的注册表文件，不能通过 register_query 替换
+var ErrOperatorQuery = errors.New("同名的命名查询由运维人员在注册表文件中配置，不能替换")
+
+// SourceRegisterQuery 是通过 register_query 工具登记的查询的来源。
+// 来源为空的查询是运维人员在注册表文件中配置的
+const SourceRegisterQuery = "register_query"
+
+// Query 是一个命名查询。命名查询总是以只读方式执行
+type Query struct {
+	Name         string               `json:"name"`               // 查询名称 (小写字母、数字和下划线)
+	Description  string               `json:"description"`        // 查询说明，展示给客户端
+	SQL          string               `json:"sql"`                // SQL 模板，参数使用 :name 命名占位符
+	Params       []toolpacks.ParamDef `json:"params,omitempty"`   // 参数定义
+	ConnIDs      []string             `json:"conn_ids,omitempty"` // 允许运行该查询的连接 ID，为空时不限制
+	Timeout      string               `json:"timeout,omitempty"`  // 执行超时 (Go duration 格式)，默认 60s
+	Source       string               `json:"source,omitempty"`   // 登记来源: SourceRegisterQuery 或空 (注册表文件)
+	RegisteredAt time.Time            `json:"registered_at"`
+}
+
+// ToolDef 返回与命名查询等价的工具包工具定义，用于校验和绑定参数
+func (q Query) ToolDef() toolpacks.ToolDef {
+	readOnly := true
+	return toolpacks.ToolDef{
+		Name:        q.Name,
+		Description: q.Description,
+		SQL:         q.SQL,
+		Params:      q.Params,
+		ReadOnly:    &readOnly,
+		Timeout:     q.Timeout,
+		Pack:        "named_queries",
+	}
+}
+
+// AllowsConn 判断查询是否允许在 connID 上运行
+func (q Query) AllowsConn(connID string) bool {
+	if len(q.ConnIDs) == 0 {
+		return true
+	}
+	for _, allowed := range q.ConnIDs {
+		if allowed == connID {
+			return true
+		}
+	}
+	return false
+}
+
+// persistedState 是写入磁盘的内容
+type persistedState struct {
+	Queries []Query `json:"queries"`
+}
+
+// Registry 保存命名查询，path 非空时每次修改后写入文件
+type Registry struct {
+	path string
+
+	mu      sync.Mutex
+	queries map[string]Query
+}
+
+// NewRegistry 创建命名查询注册表，path 非空时从文件加载已保存的查询 (无效的查询被跳过并记录警告)。
+func NewRegistry(path string) *Registry {
+	r := &Registry{path: path, queries: make(map[string]Query)}
+	if path != "" {
+		if err := r.load(); err != nil {
+			utils.DefaultLogger.Warn("加载命名查询注册表失败，将从空注册表开始", zap.String("path", path), zap.Error(err))
+		}
+	}
+	return r
+}
+
+// Register 校验并保存命名查询，同名查询被替换；返回是否替换了已有查询。
+// 通过 register_query 登记的查询 (Source 为 SourceRegisterQuery) 不能替换注册表文件中配置的同名查询，返回 ErrOperatorQuery。
+func (r *Registry) Register(query Query) (bool, error) {
+	if err := validate(&query); err != nil {
+		return false, err
+	}
+	if query.RegisteredAt.IsZero() {
+		query.RegisteredAt = time.Now()
+	}
+
+	r.mu.Lock()
+	existing, replaced := r.queries[query.Name]
+	if replaced && existing.Source != SourceRegisterQuery && query.Source == SourceRegisterQuery {
+		r.mu.Unlock()
+		return false, fmt.Errorf("%w: %s", ErrOperatorQuery, query.Name)
+	}
+	r.queries[query.Name] = query
+	state := r.stateLocked()
+	r.mu.Unlock()
+
+	r.save(state)
+	utils.DefaultLogger.Info("命名查询已注册", zap.String("name", query.Name), zap.Bool("replaced", replaced), zap.Int("params", len(query.Params)))
+	return replaced, nil
+}
+
+// Get 按名称返回命名查询
+func (r *Registry) Get(name string) (Query, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	query, ok := r.queries[name]
+	if !ok {
+		return Query{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return query, nil
+}
+
+// List 返回所有命名查询，按名称排序
+func (r *Registry) List() []Query {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stateLocked().Queries
+}
+
+// validate 按工具包的规则检查名称、说明、SQL 和参数定义
+func validate(query *Query) error {
+	def := query.ToolDef()
+	if err := def.Validate(); err != nil {
+		return fmt.Errorf("命名查询 '%s' 无效: %w", query.Name, err)
+	}
+	// Validate 会补全参数的默认类型
+	query.Params = def.Params
+	return nil
+}
+
+// stateLocked 返回按名称排序的查询列表 (调用方持有 mu)
+func (r *Registry) stateLocked() *persistedState {
+	state := &persistedState{Queries: make([]Query, 0, len(r.queries))}
+	for _, query := range r.queries {
+		state.Queries = append(state.Queries, query)
+	}
+	sort.Slice(state.Queries, func(i, j int) bool { return state.Queries[i].Name < state.Queries[j].Name })
+	return state
+}
+
+// load 从持久化文件恢复注册表，文件不存在时不是错误
+func (r *Registry) load() error {
+	data, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	state := new(persistedState)
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("解析命名查询注册表文件失败: %w", err)
+	}
+	for _, query := range state.Queries {
+		if err := validate(&query); err != nil {
+			utils.DefaultLogger.Warn("跳过注册表文件中无效的命名查询", zap.String("path", r.path), zap.Error(err))
+			continue
+		}
+		r.queries[query.Name] = query
+	}
+	utils.DefaultLogger.Info("已加载命名查询注册表", zap.String("path", r.path), zap.Int("queries", len(r.queries)))
+	return nil
+}
+
+// save 将注册表写入临时文件后重命名，避免写入中断导致文件损坏
+func (r *Registry) save(state *persistedState) {
+	if r.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		utils.DefaultLogger.Error("序列化命名查询注册表失败", zap.Error(err))
+		return
+	}
+	if dir := filepath.Dir(r.path); dir != "" {
+		_ = os.MkdirAll(dir, 0o755)
+	}
+	tmpPath := r.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		utils.DefaultLogger.Warn("保存命名查询注册表失败", zap.String("path", r.path), zap.Error(err))
+		return
+	}
+	if err := os.Rename(tmpPath, r.path); err != nil {
+		utils.DefaultLogger.Warn("保存命名查询注册表失败", zap.String("path", r.path), zap.Error(err))
+	}
+}
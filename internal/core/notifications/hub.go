@@ -0,0 +1,321 @@
+// Package notifications 把 PostgreSQL 的 LISTEN/NOTIFY 转发给 MCP 客户端。
+//
+// 每个被监听的频道占用一条从连接池中取出 (Hijack) 的专用连接，收到的 NOTIFY 保存在按频道划分的有界缓冲区中，
+// 客户端通过 pg_poll_notifications 按序号游标读取，或订阅 pgmcp://{conn_id}/notifications 资源在有新通知时收到更新。
+// go-mcp 不会把会话 ID 传给 Handler，因此通知不区分会话，所有客户端看到同样的缓冲区。
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// maxChannelLength 是 PostgreSQL 标识符 (频道名) 的最大字节数
+const maxChannelLength = 63
+
+// ErrTooManyChannels 表示监听的频道数已达到 LISTEN_MAX_CHANNELS
+var ErrTooManyChannels = errors.New("监听的频道数已达上限")
+
+// Notification 是收到的一条 NOTIFY 消息
+type Notification struct {
+	ID         int64     `json:"id"` // 服务器内单调递增的序号，作为 pg_poll_notifications 的游标
+	ConnID     string    `json:"conn_id"`
+	Channel    string    `json:"channel"`
+	Payload    string    `json:"payload"`
+	PID        uint32    `json:"pid"` // 发送通知的后端进程 ID
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// Subscription 是一个被监听的频道的状态
+type Subscription struct {
+	ConnID    string    `json:"conn_id"`
+	Channel   string    `json:"channel"`
+	Active    bool      `json:"active"`          // 专用连接是否仍在监听
+	Error     string    `json:"error,omitempty"` // 专用连接中断的原因，重新 pg_listen 会建立新连接
+	StartedAt time.Time `json:"started_at"`
+	Received  int64     `json:"received"` // 累计收到的通知数
+	Buffered  int       `json:"buffered"` // 缓冲区中尚保留的通知数
+	Dropped   int64     `json:"dropped"`  // 缓冲区已满时丢弃的最旧通知数
+}
+
+// channelKey 标识一个连接上的频道
+type channelKey struct {
+	connID  string
+	channel string
+}
+
+// listener 是一个频道的专用连接和缓冲区 (字段由 Hub.mu 保护)
+type listener struct {
+	conn   *pgx.Conn
+	cancel context.CancelFunc
+	done   chan struct{} // 接收循环退出后关闭
+	sub    Subscription
+	buffer []Notification
+}
+
+// Hub 管理所有被监听的频道
+type Hub struct {
+	root        context.Context // 服务器的根 Context，关闭时所有专用连接随之关闭
+	dbService   databases.Service
+	maxChannels int
+	bufferSize  int
+
+	mu        sync.Mutex
+	listeners map[channelKey]*listener
+	nextID    int64
+	arrived   chan struct{} // 有新通知时关闭并替换，唤醒等待中的 Poll
+	observers []func(Notification)
+}
+
+// NewHub 创建一个 Hub。maxChannels 是同时监听的频道数上限 (0 表示不限制)，bufferSize 是每个频道保留的通知数。
+func NewHub(root context.Context, dbService databases.Service, maxChannels, bufferSize int) *Hub {
+	return &Hub{
+		root:        root,
+		dbService:   dbService,
+		maxChannels: maxChannels,
+		bufferSize:  max(bufferSize, 1),
+		listeners:   make(map[channelKey]*listener),
+		arrived:     make(chan struct{}),
+	}
+}
+
+// AddObserver 注册收到通知时调用的函数 (例如向订阅资源的客户端发送 resources/updated)，在接收循环中同步调用
+func (h *Hub) AddObserver(observer func(Notification)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.observers = append(h.observers, observer)
+}
+
+// Listen 在专用连接上执行 LISTEN。频道名区分大小写，与 pg_notify('channel', ...) 的第一个参数一致
+// (SQL 中未加引号的 NOTIFY channel 会被折叠为小写)。频道已在监听时直接返回其状态。
+func (h *Hub) Listen(ctx context.Context, connID, channel string) (Subscription, error) {
+	if channel == "" || len(channel) > maxChannelLength {
+		return Subscription{}, fmt.Errorf("频道名不能为空且不能超过 %d 字节", maxChannelLength)
+	}
+	key := channelKey{connID: connID, channel: channel}
+	h.mu.Lock()
+	existing, ok := h.listeners[key]
+	switch {
+	case ok && existing.sub.Active:
+		sub := h.snapshotLocked(existing)
+		h.mu.Unlock()
+		return sub, nil
+	case !ok && h.maxChannels > 0 && h.activeLocked() >= h.maxChannels:
+		h.mu.Unlock()
+		return Subscription{}, fmt.Errorf("%w (%d)，请先 pg_unlisten 不再需要的频道", ErrTooManyChannels, h.maxChannels)
+	}
+	h.mu.Unlock()
+
+	pool, err := h.dbService.GetPool(ctx, connID)
+	if err != nil {
+		return Subscription{}, err
+	}
+	pooled, err := pool.Acquire(ctx)
+	if err != nil {
+		return Subscription{}, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	// 取出的连接不再归还连接池，关闭连接即结束监听
+	conn := pooled.Hijack()
+	quotedChannel, err := sqlsafe.QuoteIdentifier(channel)
+	if err != nil {
+		_ = conn.Close(context.Background())
+		return Subscription{}, fmt.Errorf("无效的通知频道名: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+quotedChannel); err != nil {
+		_ = conn.Close(context.Background())
+		return Subscription{}, fmt.Errorf("执行 LISTEN 失败: %w", err)
+	}
+
+	loopCtx, cancel := context.WithCancel(h.root)
+	l := &listener{
+		conn:   conn,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		sub:    Subscription{ConnID: connID, Channel: channel, Active: true, StartedAt: time.Now()},
+	}
+	h.mu.Lock()
+	if previous, ok := h.listeners[key]; ok {
+		if previous.sub.Active {
+			// 并发的 Listen 已经建立了监听，保留先建立的连接
+			sub := h.snapshotLocked(previous)
+			h.mu.Unlock()
+			cancel()
+			_ = conn.Close(context.Background())
+			return sub, nil
+		}
+		// 中断的监听: 保留缓冲区和计数，客户端可以继续读取中断前收到的通知
+		l.buffer, l.sub.Received, l.sub.Dropped = previous.buffer, previous.sub.Received, previous.sub.Dropped
+	}
+	h.listeners[key] = l
+	sub := h.snapshotLocked(l)
+	h.mu.Unlock()
+
+	go h.receive(loopCtx, key, l)
+	utils.DefaultLogger.Info("开始监听 PostgreSQL 通知频道", zap.String("connID", connID), zap.String("channel", channel))
+	return sub, nil
+}
+
+// receive 是一个频道的接收循环，Context 取消或连接中断时退出并关闭连接
+func (h *Hub) receive(ctx context.Context, key channelKey, l *listener) {
+	defer close(l.done)
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = l.conn.Close(closeCtx)
+	}()
+	for {
+		n, err := l.conn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			utils.DefaultLogger.Warn("通知监听连接中断", zap.String("connID", key.connID), zap.String("channel", key.channel), zap.Error(err))
+			h.mu.Lock()
+			l.sub.Active, l.sub.Error = false, err.Error()
+			h.mu.Unlock()
+			return
+		}
+
+		h.mu.Lock()
+		h.nextID++
+		notification := Notification{ID: h.nextID, ConnID: key.connID, Channel: n.Channel, Payload: n.Payload, PID: n.PID, ReceivedAt: time.Now()}
+		if len(l.buffer) >= h.bufferSize {
+			l.buffer = l.buffer[1:]
+			l.sub.Dropped++
+		}
+		l.buffer = append(l.buffer, notification)
+		l.sub.Received++
+		close(h.arrived)
+		h.arrived = make(chan struct{})
+		observers := append([]func(Notification){}, h.observers...)
+		h.mu.Unlock()
+
+		for _, observer := range observers {
+			observer(notification)
+		}
+	}
+}
+
+// Unlisten 停止监听频道并关闭其专用连接，丢弃缓冲区中的通知；返回频道停止前的状态和频道是否存在
+func (h *Hub) Unlisten(connID, channel string) (Subscription, bool) {
+	key := channelKey{connID: connID, channel: channel}
+	h.mu.Lock()
+	l, ok := h.listeners[key]
+	if ok {
+		delete(h.listeners, key)
+	}
+	h.mu.Unlock()
+	if !ok {
+		return Subscription{}, false
+	}
+	l.cancel()
+	<-l.done
+
+	h.mu.Lock()
+	sub := h.snapshotLocked(l)
+	h.mu.Unlock()
+	sub.Active = false
+	utils.DefaultLogger.Info("停止监听 PostgreSQL 通知频道", zap.String("connID", connID), zap.String("channel", channel))
+	return sub, true
+}
+
+// UnlistenAll 停止监听连接上的所有频道 (connID 被移除时调用)，返回停止的频道数
+func (h *Hub) UnlistenAll(connID string) int {
+	var channels []string
+	for _, sub := range h.Subscriptions(connID) {
+		channels = append(channels, sub.Channel)
+	}
+	for _, channel := range channels {
+		h.Unlisten(connID, channel)
+	}
+	return len(channels)
+}
+
+// Subscriptions 返回被监听的频道 (connID 为空时返回所有连接的频道)，按连接和频道名排序
+func (h *Hub) Subscriptions(connID string) []Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := make([]Subscription, 0, len(h.listeners))
+	for key, l := range h.listeners {
+		if connID == "" || key.connID == connID {
+			subs = append(subs, h.snapshotLocked(l))
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].ConnID != subs[j].ConnID {
+			return subs[i].ConnID < subs[j].ConnID
+		}
+		return subs[i].Channel < subs[j].Channel
+	})
+	return subs
+}
+
+// Poll 返回序号大于 sinceID 的通知 (按序号排序，最多 limit 条，connID/channel 为空时不过滤)。
+// 没有新通知且 wait 大于 0 时等待新通知到达，直到 wait 超时或 ctx 结束。
+func (h *Hub) Poll(ctx context.Context, connID, channel string, sinceID int64, limit int, wait time.Duration) []Notification {
+	var deadline <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		h.mu.Lock()
+		var result []Notification
+		for key, l := range h.listeners {
+			if (connID != "" && key.connID != connID) || (channel != "" && key.channel != channel) {
+				continue
+			}
+			for _, n := range l.buffer {
+				if n.ID > sinceID {
+					result = append(result, n)
+				}
+			}
+		}
+		arrived := h.arrived
+		h.mu.Unlock()
+
+		if len(result) > 0 || deadline == nil {
+			sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+			if limit > 0 && len(result) > limit {
+				result = result[:limit]
+			}
+			return result
+		}
+		select {
+		case <-arrived:
+		case <-deadline:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// activeLocked 返回仍在监听的频道数 (调用方持有 mu)
+func (h *Hub) activeLocked() int {
+	active := 0
+	for _, l := range h.listeners {
+		if l.sub.Active {
+			active++
+		}
+	}
+	return active
+}
+
+// snapshotLocked 返回频道状态的副本 (调用方持有 mu)
+func (h *Hub) snapshotLocked(l *listener) Subscription {
+	sub := l.sub
+	sub.Buffered = len(l.buffer)
+	return sub
+}
@@ -0,0 +1,247 @@
+package plans
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/extensions"
+)
+
+// AdviceRule 是一条执行计划建议规则: 计划节点满足所有已设置的条件时给出建议。
+// 行数和循环次数在计划包含 ANALYZE 的实际值时使用实际值，否则使用估算值
+// (Nested Loop 内侧节点的估算循环次数为外侧节点的估算行数)。
+type AdviceRule struct {
+	extensions.PlanAdviceRule
+	Source        string `json:"source"` // 规则所在的扩展知识名称
+	matchPatterns map[string]*regexp.Regexp
+}
+
+// Advice 是规则对计划中一个节点给出的建议
+type Advice struct {
+	Rule      string  `json:"rule"`
+	Source    string  `json:"source"`
+	Severity  string  `json:"severity"`
+	NodeType  string  `json:"node_type"`
+	Relation  string  `json:"relation,omitempty"`
+	Index     string  `json:"index,omitempty"`
+	Path      string  `json:"path"` // 从根节点到该节点的节点类型路径
+	Rows      float64 `json:"rows"`
+	Loops     float64 `json:"loops"`
+	TableRows int64   `json:"table_rows,omitempty"`
+	Message   string  `json:"message"`
+}
+
+// TableRowsFunc 返回表的大致行数 (来自 Schema 缓存)，计划中只有表名时 schema 为空
+type TableRowsFunc func(schema, table string) (int64, bool)
+
+// KnowledgeAdviceRules 从扩展知识 (名称 -> 知识数据) 的 plan_advice 列表中取出规则，按知识名称排序。
+// 无效的规则会被跳过并通过 errs 返回，不影响其他规则。
+func KnowledgeAdviceRules(knowledge map[string]extensions.KnowledgeData) (rules []AdviceRule, errs []error) {
+	names := make([]string, 0, len(knowledge))
+	for name := range knowledge {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, spec := range knowledge[name].PlanAdvice {
+			rule := AdviceRule{PlanAdviceRule: spec, Source: name}
+			if err := rule.compile(); err != nil {
+				errs = append(errs, fmt.Errorf("扩展知识 '%s' 的规则 '%s' 无效: %w", name, rule.ID, err))
+				continue
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules, errs
+}
+
+// compile 检查规则并编译字段正则表达式
+func (r *AdviceRule) compile() error {
+	if r.ID == "" || r.Advice == "" {
+		return fmt.Errorf("缺少 id 或 advice")
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = "info"
+	case "info", "warning":
+	default:
+		return fmt.Errorf("severity 只能是 info 或 warning")
+	}
+	r.matchPatterns = make(map[string]*regexp.Regexp, len(r.Match))
+	for field, pattern := range r.Match {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("字段 '%s' 的正则表达式无效: %w", field, err)
+		}
+		r.matchPatterns[field] = compiled
+	}
+	return nil
+}
+
+// Advise 用规则检查 EXPLAIN (FORMAT JSON) 的输出，返回按计划节点顺序排列的建议。
+// 同一规则对同一个表 (或同类无表节点) 只给出一次建议。tableRows 为 nil 时 min_table_rows 条件不满足。
+func Advise(planJSON []byte, rules []AdviceRule, tableRows TableRowsFunc) ([]Advice, error) {
+	var explained []map[string]any
+	if err := json.Unmarshal(planJSON, &explained); err != nil {
+		return nil, fmt.Errorf("解析执行计划 JSON 失败: %w", err)
+	}
+	w := &adviceWalker{rules: rules, tableRows: tableRows, seen: make(map[string]bool)}
+	for _, entry := range explained {
+		if root, ok := entry["Plan"].(map[string]any); ok {
+			w.walk(root, 1, nil)
+		}
+	}
+	return w.advice, nil
+}
+
+// adviceWalker 遍历计划树并收集建议
+type adviceWalker struct {
+	rules     []AdviceRule
+	tableRows TableRowsFunc
+	seen      map[string]bool
+	advice    []Advice
+}
+
+// walk 检查节点并递归检查子节点。loops 是节点的估算执行次数，path 是祖先节点类型
+func (w *adviceWalker) walk(node map[string]any, loops float64, path []string) {
+	nodeType, _ := node["Node Type"].(string)
+	path = append(path, nodeType)
+	if actual, ok := node["Actual Loops"].(float64); ok {
+		loops = actual
+	}
+	rows, ok := node["Actual Rows"].(float64)
+	if !ok {
+		rows, _ = node["Plan Rows"].(float64)
+	}
+	for i := range w.rules {
+		w.check(&w.rules[i], node, nodeType, rows, loops, path)
+	}
+
+	children, _ := node["Plans"].([]any)
+	var outerRows float64
+	for i, child := range children {
+		childNode, ok := child.(map[string]any)
+		if !ok {
+			continue
+		}
+		childLoops := loops
+		if nodeType == "Nested Loop" && i > 0 {
+			// 内侧节点对外侧的每一行执行一次
+			childLoops = loops * max(outerRows, 1)
+		}
+		if i == 0 {
+			outerRows, _ = childNode["Plan Rows"].(float64)
+		}
+		w.walk(childNode, childLoops, path)
+	}
+}
+
+// check 对一个节点应用一条规则
+func (w *adviceWalker) check(rule *AdviceRule, node map[string]any, nodeType string, rows, loops float64, path []string) {
+	if len(rule.NodeTypes) > 0 && !containsString(rule.NodeTypes, nodeType) {
+		return
+	}
+	for field, pattern := range rule.matchPatterns {
+		value, ok := node[field]
+		if !ok || !pattern.MatchString(planFieldString(value)) {
+			return
+		}
+	}
+	for _, field := range rule.Absent {
+		if _, ok := node[field]; ok {
+			return
+		}
+	}
+	if rows < rule.MinRows || loops < rule.MinLoops {
+		return
+	}
+	width, _ := node["Plan Width"].(float64)
+	if rule.MinBytes > 0 && rows*width < rule.MinBytes {
+		return
+	}
+	if cost, _ := node["Total Cost"].(float64); cost < rule.MinTotalCost {
+		return
+	}
+	relation, _ := node["Relation Name"].(string)
+	index, _ := node["Index Name"].(string)
+	var tableRows int64
+	if rule.MinTableRows > 0 {
+		if relation == "" || w.tableRows == nil {
+			return
+		}
+		schema, _ := node["Schema"].(string)
+		count, ok := w.tableRows(schema, relation)
+		if !ok || float64(count) < rule.MinTableRows {
+			return
+		}
+		tableRows = count
+	}
+
+	key := rule.Source + "/" + rule.ID + "/" + relation
+	if relation == "" {
+		key += "/" + nodeType
+	}
+	if w.seen[key] {
+		return
+	}
+	w.seen[key] = true
+	message := strings.NewReplacer(
+		"{relation}", relation,
+		"{index}", index,
+		"{node}", nodeType,
+		"{rows}", formatPlanNumber(rows),
+		"{loops}", formatPlanNumber(loops),
+		"{bytes}", formatPlanNumber(rows*width),
+		"{table_rows}", strconv.FormatInt(tableRows, 10),
+	).Replace(rule.Advice)
+	w.advice = append(w.advice, Advice{
+		Rule:      rule.ID,
+		Source:    rule.Source,
+		Severity:  rule.Severity,
+		NodeType:  nodeType,
+		Relation:  relation,
+		Index:     index,
+		Path:      strings.Join(path, " > "),
+		Rows:      rows,
+		Loops:     loops,
+		TableRows: tableRows,
+		Message:   strings.TrimSpace(message),
+	})
+}
+
+// planFieldString 把计划字段转换为用于正则匹配的字符串
+func planFieldString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, planFieldString(item))
+		}
+		return strings.Join(parts, ", ")
+	case float64:
+		return formatPlanNumber(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// formatPlanNumber 把行数、字节数等格式化为不带小数的整数
+func formatPlanNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', 0, 64)
+}
+
+// containsString 判断 values 是否包含 target
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package plans
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// compactDroppedFields 是精简计划时删除的节点字段: 输出列表、并行/异步标记等对分析查询性能帮助很小的信息
+var compactDroppedFields = map[string]bool{
+	"Output":              true, // 带 schema 前缀的输出列列表 (VERBOSE)，通常是计划中最大的部分
+	"Schema":              true,
+	"Parallel Aware":      true,
+	"Async Capable":       true,
+	"Inner Unique":        true,
+	"Single Copy":         true,
+	"Startup Cost":        true,
+	"Plan Width":          true,
+	"Actual Startup Time": true,
+	"Query Identifier":    true,
+	"Sort Space Type":     true,
+}
+
+// compactDefaultValues 是取默认值时删除的字段
+var compactDefaultValues = map[string]any{
+	"Scan Direction":      "Forward",
+	"Partial Mode":        "Simple",
+	"Parent Relationship": "Outer",
+	"Disabled":            false,
+}
+
+// compactPassthroughNodes 是只有一个子节点且没有过滤条件时可以折叠的节点类型
+var compactPassthroughNodes = map[string]bool{
+	"Result":        true,
+	"Subquery Scan": true,
+	"Append":        true,
+	"Merge Append":  true,
+}
+
+// compactFilterFields 是使节点不可折叠的字段
+var compactFilterFields = []string{"Filter", "One-Time Filter", "Subplan Name"}
+
+// Compact 精简 EXPLAIN (FORMAT JSON) 的输出，供 LLM 阅读:
+// 删除输出列表、并行标记、启动成本等很少有用的字段，删除取默认值或为 0 的统计字段，
+// 与表名相同的 Alias，并折叠没有过滤条件的单子节点透传节点 (Result, Subquery Scan, 单分支 Append)。
+// 节点类型、访问的表和索引、条件、成本、行数和实际耗时保持不变。
+func Compact(planJSON []byte) ([]byte, error) {
+	var explained []map[string]any
+	if err := json.Unmarshal(planJSON, &explained); err != nil {
+		return nil, fmt.Errorf("解析执行计划 JSON 失败: %w", err)
+	}
+	for _, entry := range explained {
+		if root, ok := entry["Plan"].(map[string]any); ok {
+			entry["Plan"] = compactNode(root)
+		}
+		delete(entry, "Query Identifier")
+		delete(entry, "JIT")
+	}
+	// 不转义 <、> 等字符，条件表达式中的比较运算符保持可读且不增加体积
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(explained); err != nil {
+		return nil, fmt.Errorf("序列化精简后的执行计划失败: %w", err)
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// compactNode 递归精简一个计划节点，返回精简后的节点 (折叠时为其子节点)
+func compactNode(node map[string]any) map[string]any {
+	for field, value := range node {
+		if compactDroppedFields[field] {
+			delete(node, field)
+			continue
+		}
+		if defaultValue, ok := compactDefaultValues[field]; ok && value == defaultValue {
+			delete(node, field)
+			continue
+		}
+		if number, ok := value.(float64); ok && number == 0 && isZeroDroppableField(field) {
+			delete(node, field)
+		}
+	}
+	if alias, ok := node["Alias"]; ok && alias == node["Relation Name"] {
+		delete(node, "Alias")
+	}
+
+	children, _ := node["Plans"].([]any)
+	compactedChildren := make([]any, 0, len(children))
+	for _, child := range children {
+		if childNode, ok := child.(map[string]any); ok {
+			compactedChildren = append(compactedChildren, compactNode(childNode))
+		}
+	}
+	if len(compactedChildren) > 0 {
+		node["Plans"] = compactedChildren
+	}
+
+	nodeType, _ := node["Node Type"].(string)
+	if compactPassthroughNodes[nodeType] && len(compactedChildren) == 1 && !hasAnyField(node, compactFilterFields) {
+		child := compactedChildren[0].(map[string]any)
+		if relationship, ok := node["Parent Relationship"]; ok {
+			child["Parent Relationship"] = relationship
+		} else {
+			delete(child, "Parent Relationship")
+		}
+		return child
+	}
+	return node
+}
+
+// isZeroDroppableField 判断值为 0 时可以删除的统计字段 (缓冲区、I/O 计时、被过滤的行数等)
+func isZeroDroppableField(field string) bool {
+	switch field {
+	case "Rows Removed by Filter", "Rows Removed by Join Filter", "Rows Removed by Index Recheck",
+		"Heap Fetches", "Workers Launched", "Peak Memory Usage", "Original Hash Batches", "Hash Batches",
+		"Shared Hit Blocks", "Shared Read Blocks", "Shared Dirtied Blocks", "Shared Written Blocks",
+		"Local Hit Blocks", "Local Read Blocks", "Local Dirtied Blocks", "Local Written Blocks",
+		"Temp Read Blocks", "Temp Written Blocks",
+		"Shared I/O Read Time", "Shared I/O Write Time", "Local I/O Read Time", "Local I/O Write Time",
+		"Temp I/O Read Time", "Temp I/O Write Time", "I/O Read Time", "I/O Write Time":
+		return true
+	}
+	return false
+}
+
+func hasAnyField(node map[string]any, fields []string) bool {
+	for _, field := range fields {
+		if _, ok := node[field]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package plans
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	stringLiteralPattern  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numberLiteralPattern  = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	whitespacePattern     = regexp.MustCompile(`\s+`)
+	operatorSpacePattern  = regexp.MustCompile(`\s*([=<>!,()+\-*/%|:.])\s*`)
+	trailingSymbolPattern = regexp.MustCompile(`[;\s]+$`)
+)
+
+// planNode 是 EXPLAIN (FORMAT JSON) 中计划节点里用于比较的字段
+type planNode struct {
+	NodeType     string     `json:"Node Type"`
+	RelationName string     `json:"Relation Name"`
+	IndexName    string     `json:"Index Name"`
+	JoinType     string     `json:"Join Type"`
+	Strategy     string     `json:"Strategy"`
+	TotalCost    float64    `json:"Total Cost"`
+	PlanRows     float64    `json:"Plan Rows"`
+	Plans        []planNode `json:"Plans"`
+}
+
+// Fingerprint 计算查询的指纹: 去掉字面量、统一大小写和空白后取摘要，
+// 使只有常量不同的同一条查询共用计划历史。
+func Fingerprint(query string) string {
+	normalized := stringLiteralPattern.ReplaceAllString(query, "?")
+	normalized = numberLiteralPattern.ReplaceAllString(normalized, "?")
+	normalized = whitespacePattern.ReplaceAllString(strings.ToLower(normalized), " ")
+	normalized = operatorSpacePattern.ReplaceAllString(normalized, "$1")
+	normalized = trailingSymbolPattern.ReplaceAllString(strings.TrimSpace(normalized), "")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:8])
+}
+
+// summarizePlan 从 EXPLAIN (FORMAT JSON) 的输出中提取计划形状、根节点成本和估算行数
+func summarizePlan(planJSON []byte) (string, float64, float64, error) {
+	var explained []struct {
+		Plan planNode `json:"Plan"`
+	}
+	if err := json.Unmarshal(planJSON, &explained); err != nil {
+		return "", 0, 0, fmt.Errorf("解析执行计划 JSON 失败: %w", err)
+	}
+	if len(explained) == 0 || explained[0].Plan.NodeType == "" {
+		return "", 0, 0, fmt.Errorf("执行计划为空")
+	}
+	root := explained[0].Plan
+	var sb strings.Builder
+	writeShape(&sb, root)
+	return sb.String(), root.TotalCost, root.PlanRows, nil
+}
+
+// writeShape 将计划树写成 "Hash Join[Inner](Seq Scan[orders], Hash(Index Scan[users:users_pkey]))" 形式，
+// 只包含节点类型和访问路径，不包含成本和行数，因此统计信息的细微变化不会改变形状。
+func writeShape(sb *strings.Builder, node planNode) {
+	sb.WriteString(node.NodeType)
+	var details []string
+	for _, detail := range []string{node.Strategy, node.JoinType} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+	if node.RelationName != "" {
+		relation := node.RelationName
+		if node.IndexName != "" {
+			relation += ":" + node.IndexName
+		}
+		details = append(details, relation)
+	} else if node.IndexName != "" {
+		details = append(details, node.IndexName)
+	}
+	if len(details) > 0 {
+		sb.WriteString("[" + strings.Join(details, ",") + "]")
+	}
+	if len(node.Plans) > 0 {
+		sb.WriteString("(")
+		for i, child := range node.Plans {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeShape(sb, child)
+		}
+		sb.WriteString(")")
+	}
+}
@@ -0,0 +1,410 @@
+package plans
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxSnapshotsPerQuery 是每个查询指纹保留的历史计划数
+	maxSnapshotsPerQuery = 20
+	// maxTrackedQueries 是保留历史计划的查询指纹 (按连接区分) 数，超出时淘汰最久没有捕获计划的查询
+	maxTrackedQueries = 1000
+	// maxRegressions 是内存中保留的最近回归记录数
+	maxRegressions = 200
+	// defaultCostRatio 是未配置时判定成本显著上升的倍数
+	defaultCostRatio = 2.0
+	// saveDelay 是修改后写入持久化文件的延迟，期间的多次修改合并为一次写入
+	saveDelay = 2 * time.Second
+)
+
+// Snapshot 是某个查询在某一时刻的执行计划摘要
+type Snapshot struct {
+	Fingerprint string    `json:"fingerprint"`      // 规范化查询文本的摘要
+	ConnID      string    `json:"conn_id"`          // 所属连接 ID
+	Query       string    `json:"query"`            // 最近一次捕获时的原始 SQL
+	Params      []any     `json:"params,omitempty"` // 捕获时使用的参数，重新检查时复用 (只保留在每个查询最近的快照上)
+	Shape       string    `json:"shape"`            // 计划形状 (节点类型、关系、索引、连接方式)
+	TotalCost   float64   `json:"total_cost"`       // 根节点的估算总成本
+	PlanRows    float64   `json:"plan_rows"`        // 根节点的估算行数
+	CapturedAt  time.Time `json:"captured_at"`
+}
+
+// Regression 是一次检测到的计划变化
+type Regression struct {
+	Fingerprint string    `json:"fingerprint"`
+	ConnID      string    `json:"conn_id"`
+	Query       string    `json:"query"`
+	Reasons     []string  `json:"reasons"` // 变化原因，例如计划形状变化、成本上升倍数
+	Previous    Snapshot  `json:"previous"`
+	Current     Snapshot  `json:"current"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+// RegressionAlert 是计划回归的告警内容，以 JSON 形式 POST 到配置的 Webhook。
+// Text 字段兼容 Slack Incoming Webhook 的消息格式。
+type RegressionAlert struct {
+	Text  string `json:"text"`
+	Event string `json:"event"` // 固定为 plan_regression
+	Regression
+}
+
+// persistedState 是写入磁盘的内容
+type persistedState struct {
+	Snapshots   map[string][]Snapshot `json:"snapshots"`
+	Regressions []Regression          `json:"regressions"`
+}
+
+// Store 保存按连接和查询指纹分组的历史执行计划，并在计划形状或成本显著变化时记录回归。
+type Store struct {
+	path       string  // 持久化文件路径，为空时只保存在内存中
+	costRatio  float64 // 成本上升超过该倍数时视为回归
+	webhookURL string  // 回归告警 Webhook，为空时只写日志
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	snapshots   map[string][]Snapshot // connID + "/" + fingerprint -> 按时间排列的计划快照
+	regressions []Regression
+	saveTimer   *time.Timer // 等待写入持久化文件的定时器 (由 mu 保护)
+
+	saveMu sync.Mutex // 保证持久化文件按顺序写入
+}
+
+// NewStore 创建一个新的计划存储，path 非空时从文件加载已保存的历史。
+// 修改在 saveDelay 后合并写入文件 (权限 0600，快照中带有查询参数)，进程异常退出时可能丢失最近的修改。
+func NewStore(path string, costRatio float64, webhookURL string) *Store {
+	if costRatio <= 1 {
+		costRatio = defaultCostRatio
+	}
+	s := &Store{
+		path:       path,
+		costRatio:  costRatio,
+		webhookURL: webhookURL,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		snapshots:  make(map[string][]Snapshot),
+	}
+	if path != "" {
+		if err := s.load(); err != nil {
+			utils.DefaultLogger.Warn("加载已保存的执行计划历史失败，将从空历史开始", zap.String("path", path), zap.Error(err))
+		}
+	}
+	return s
+}
+
+// Record 记录一次 EXPLAIN (FORMAT JSON) 的结果，并与该查询上一次的计划比较。
+// 检测到回归时返回回归记录 (同时写日志并发送告警)，否则返回 nil。
+func (s *Store) Record(connID, query string, params []any, planJSON []byte) (*Snapshot, *Regression, error) {
+	shape, totalCost, planRows, err := summarizePlan(planJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot := Snapshot{
+		Fingerprint: Fingerprint(query),
+		ConnID:      connID,
+		Query:       query,
+		Params:      params,
+		Shape:       shape,
+		TotalCost:   totalCost,
+		PlanRows:    planRows,
+		CapturedAt:  time.Now(),
+	}
+
+	s.mu.Lock()
+	key := connID + "/" + snapshot.Fingerprint
+	history := s.snapshots[key]
+	var regression *Regression
+	if len(history) > 0 {
+		regression = s.compare(history[len(history)-1], snapshot)
+		// 只有最近的快照需要参数 (重新检查时复用)
+		history[len(history)-1].Params = nil
+	}
+	history = append(history, snapshot)
+	if len(history) > maxSnapshotsPerQuery {
+		history = history[len(history)-maxSnapshotsPerQuery:]
+	}
+	s.snapshots[key] = history
+	s.evictLocked()
+	if regression != nil {
+		s.regressions = append(s.regressions, *regression)
+		if len(s.regressions) > maxRegressions {
+			s.regressions = s.regressions[len(s.regressions)-maxRegressions:]
+		}
+	}
+	s.scheduleSaveLocked()
+	s.mu.Unlock()
+
+	if regression != nil {
+		utils.DefaultLogger.Warn("检测到执行计划回归", zap.String("connID", connID), zap.String("fingerprint", snapshot.Fingerprint),
+			zap.Strings("reasons", regression.Reasons), zap.Float64("previousCost", regression.Previous.TotalCost), zap.Float64("currentCost", totalCost))
+		go s.notify(*regression)
+	}
+	return &snapshot, regression, nil
+}
+
+// compare 比较同一查询的前后两次计划，没有显著变化时返回 nil
+func (s *Store) compare(previous, current Snapshot) *Regression {
+	var reasons []string
+	if previous.Shape != current.Shape {
+		reasons = append(reasons, "计划形状发生变化")
+	}
+	if previous.TotalCost > 0 && current.TotalCost >= previous.TotalCost*s.costRatio {
+		reasons = append(reasons, fmt.Sprintf("估算成本上升 %.1f 倍 (%.2f -> %.2f)", current.TotalCost/previous.TotalCost, previous.TotalCost, current.TotalCost))
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	return &Regression{
+		Fingerprint: current.Fingerprint,
+		ConnID:      current.ConnID,
+		Query:       current.Query,
+		Reasons:     reasons,
+		Previous:    withoutParams(previous),
+		Current:     withoutParams(current),
+		DetectedAt:  current.CapturedAt,
+	}
+}
+
+// withoutParams 返回去掉参数的快照副本，回归记录中不保存查询参数
+func withoutParams(snapshot Snapshot) Snapshot {
+	snapshot.Params = nil
+	return snapshot
+}
+
+// Latest 返回指定连接下每个查询指纹最近一次的计划快照，按捕获时间升序排列
+func (s *Store) Latest(connID string) []Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latest := make([]Snapshot, 0)
+	for _, history := range s.snapshots {
+		if len(history) > 0 && history[0].ConnID == connID {
+			latest = append(latest, history[len(history)-1])
+		}
+	}
+	sort.Slice(latest, func(i, j int) bool { return latest[i].CapturedAt.Before(latest[j].CapturedAt) })
+	return latest
+}
+
+// Regressions 返回指定连接最近检测到的计划回归 (最新的在前)
+func (s *Store) Regressions(connID string) []Regression {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Regression, 0)
+	for i := len(s.regressions) - 1; i >= 0; i-- {
+		if s.regressions[i].ConnID == connID {
+			result = append(result, s.regressions[i])
+		}
+	}
+	return result
+}
+
+// Export 返回全部计划历史和回归记录 (与持久化文件格式相同的 JSON)，用于备份。
+func (s *Store) Export() ([]byte, error) {
+	s.mu.Lock()
+	state := s.copyLocked()
+	s.mu.Unlock()
+	return json.MarshalIndent(state, "", "  ")
+}
+
+// Import 合并备份中的计划历史: 同一查询的快照按捕获时间合并去重，保留最近的 maxSnapshotsPerQuery 个；
+// 回归记录按检测时间合并。返回合并后新增的快照数。
+func (s *Store) Import(data []byte) (int, error) {
+	imported := new(persistedState)
+	if err := json.Unmarshal(data, imported); err != nil {
+		return 0, fmt.Errorf("解析计划历史失败: %w", err)
+	}
+
+	s.mu.Lock()
+	added := 0
+	for key, history := range imported.Snapshots {
+		existing := s.snapshots[key]
+		seen := make(map[time.Time]bool, len(existing))
+		for _, snapshot := range existing {
+			seen[snapshot.CapturedAt] = true
+		}
+		merged := append([]Snapshot(nil), existing...)
+		for _, snapshot := range history {
+			if !seen[snapshot.CapturedAt] {
+				seen[snapshot.CapturedAt] = true
+				merged = append(merged, snapshot)
+				added++
+			}
+		}
+		sort.Slice(merged, func(i, j int) bool { return merged[i].CapturedAt.Before(merged[j].CapturedAt) })
+		s.snapshots[key] = trimHistory(merged)
+	}
+	s.evictLocked()
+	seen := make(map[string]bool, len(s.regressions))
+	for _, regression := range s.regressions {
+		seen[regression.ConnID+"/"+regression.Fingerprint+"/"+regression.DetectedAt.String()] = true
+	}
+	for _, regression := range imported.Regressions {
+		if key := regression.ConnID + "/" + regression.Fingerprint + "/" + regression.DetectedAt.String(); !seen[key] {
+			seen[key] = true
+			s.regressions = append(s.regressions, regression)
+		}
+	}
+	sort.Slice(s.regressions, func(i, j int) bool { return s.regressions[i].DetectedAt.Before(s.regressions[j].DetectedAt) })
+	if len(s.regressions) > maxRegressions {
+		s.regressions = s.regressions[len(s.regressions)-maxRegressions:]
+	}
+	s.mu.Unlock()
+
+	// 导入是显式操作，立即写入文件
+	s.flush()
+	return added, nil
+}
+
+// trimHistory 保留最近的 maxSnapshotsPerQuery 个快照，并去掉最近一个之外的快照中的参数
+func trimHistory(history []Snapshot) []Snapshot {
+	if len(history) > maxSnapshotsPerQuery {
+		history = history[len(history)-maxSnapshotsPerQuery:]
+	}
+	for i := 0; i < len(history)-1; i++ {
+		history[i].Params = nil
+	}
+	return history
+}
+
+// evictLocked 在查询指纹超过 maxTrackedQueries 时淘汰最久没有捕获计划的查询，调用方需持有锁
+func (s *Store) evictLocked() {
+	if len(s.snapshots) <= maxTrackedQueries {
+		return
+	}
+	keys := make([]string, 0, len(s.snapshots))
+	for key := range s.snapshots {
+		keys = append(keys, key)
+	}
+	lastCaptured := func(key string) time.Time {
+		history := s.snapshots[key]
+		if len(history) == 0 {
+			return time.Time{}
+		}
+		return history[len(history)-1].CapturedAt
+	}
+	sort.Slice(keys, func(i, j int) bool { return lastCaptured(keys[i]).Before(lastCaptured(keys[j])) })
+	for _, key := range keys[:len(keys)-maxTrackedQueries] {
+		delete(s.snapshots, key)
+	}
+}
+
+// scheduleSaveLocked 在 saveDelay 后写入持久化文件，已有等待中的写入时不重复安排，调用方需持有锁
+func (s *Store) scheduleSaveLocked() {
+	if s.path == "" || s.saveTimer != nil {
+		return
+	}
+	s.saveTimer = time.AfterFunc(saveDelay, s.flush)
+}
+
+// flush 立即将当前状态写入持久化文件，并取消等待中的写入
+func (s *Store) flush() {
+	if s.path == "" {
+		return
+	}
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.Lock()
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+		s.saveTimer = nil
+	}
+	state := s.copyLocked()
+	s.mu.Unlock()
+	s.save(state)
+}
+
+// copyLocked 复制当前状态，调用方需持有锁
+func (s *Store) copyLocked() *persistedState {
+	state := &persistedState{Snapshots: make(map[string][]Snapshot, len(s.snapshots)), Regressions: append([]Regression(nil), s.regressions...)}
+	for key, history := range s.snapshots {
+		state.Snapshots[key] = append([]Snapshot(nil), history...)
+	}
+	return state
+}
+
+// load 从持久化文件恢复历史，文件不存在时不是错误
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	state := new(persistedState)
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("解析计划历史文件失败: %w", err)
+	}
+	for key, history := range state.Snapshots {
+		s.snapshots[key] = trimHistory(history)
+	}
+	s.evictLocked()
+	s.regressions = state.Regressions
+	if len(s.regressions) > maxRegressions {
+		s.regressions = s.regressions[len(s.regressions)-maxRegressions:]
+	}
+	utils.DefaultLogger.Info("已加载执行计划历史", zap.String("path", s.path), zap.Int("queries", len(s.snapshots)), zap.Int("regressions", len(s.regressions)))
+	return nil
+}
+
+// save 将状态写入临时文件后重命名，避免写入中断导致文件损坏；
+// 快照中带有查询参数，文件只允许服务进程的用户读写
+func (s *Store) save(state *persistedState) {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		utils.DefaultLogger.Error("序列化执行计划历史失败", zap.Error(err))
+		return
+	}
+	if dir := filepath.Dir(s.path); dir != "" {
+		_ = os.MkdirAll(dir, 0o700)
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		utils.DefaultLogger.Warn("保存执行计划历史失败", zap.String("path", s.path), zap.Error(err))
+		return
+	}
+	// WriteFile 不修改已存在文件的权限
+	if err := os.Chmod(tmpPath, 0o600); err != nil {
+		utils.DefaultLogger.Warn("保存执行计划历史失败", zap.String("path", s.path), zap.Error(err))
+		return
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		utils.DefaultLogger.Warn("保存执行计划历史失败", zap.String("path", s.path), zap.Error(err))
+	}
+}
+
+// notify 将回归告警 POST 到配置的 Webhook
+func (s *Store) notify(regression Regression) {
+	if s.webhookURL == "" {
+		return
+	}
+	alert := RegressionAlert{
+		Text: fmt.Sprintf("[pg-mcp-server] 查询 %s (conn %s) 的执行计划发生变化: %v\n%s",
+			regression.Fingerprint, regression.ConnID, regression.Reasons, regression.Query),
+		Event:      "plan_regression",
+		Regression: regression,
+	}
+	body, err := json.Marshal(alert)
+	if err != nil {
+		utils.DefaultLogger.Error("序列化计划回归告警失败", zap.Error(err))
+		return
+	}
+	resp, err := s.httpClient.Post(s.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		utils.DefaultLogger.Warn("发送计划回归告警失败", zap.String("fingerprint", regression.Fingerprint), zap.Error(err))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		utils.DefaultLogger.Warn("计划回归告警 Webhook 返回错误状态", zap.String("fingerprint", regression.Fingerprint), zap.Int("status", resp.StatusCode))
+	}
+}
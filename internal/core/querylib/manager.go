@@ -0,0 +1,174 @@
+// Package querylib 从目录加载 YAML 查询模板库 (名称、说明、带 :name 占位符的 SQL 和参数类型)。
+//
+// 与扩展知识相同，目录下的每个 .yaml/.yml 文件是一个模板库 (库名为文件名)，无效的文件或模板被跳过并记录日志，
+// 不影响其他模板和服务器启动。模板通过 pgmcp://server/query_templates 资源列出，通过 run_template 工具运行。
+package querylib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/toolpacks"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Library 是一个模板库文件的内容:
+//
+//	description: 常用的运维查询
+//	templates:
+//	  - name: long_running_queries
+//	    description: 列出运行时间超过指定秒数的查询
+//	    sql: SELECT pid, state, query FROM pg_stat_activity WHERE now() - query_start > make_interval(secs => :seconds)
+//	    params:
+//	      - name: seconds
+//	        type: integer
+//	        default: 60
+type Library struct {
+	Description string     `yaml:"description,omitempty" json:"description,omitempty"`
+	Templates   []Template `yaml:"templates" json:"templates"`
+}
+
+// Template 是一个查询模板。模板总是以只读方式执行，参数定义和绑定规则与工具包相同
+type Template struct {
+	Name        string               `yaml:"name" json:"name"`                           // 模板名称，在所有模板库中唯一
+	Description string               `yaml:"description" json:"description"`             // 模板说明
+	SQL         string               `yaml:"sql" json:"sql"`                             // SQL 模板，参数使用 :name 命名占位符
+	Params      []toolpacks.ParamDef `yaml:"params,omitempty" json:"params,omitempty"`   // 参数定义
+	Tags        []string             `yaml:"tags,omitempty" json:"tags,omitempty"`       // 分类标签，便于客户端筛选
+	Timeout     string               `yaml:"timeout,omitempty" json:"timeout,omitempty"` // 执行超时 (Go duration 格式)，默认 60s
+	Library     string               `yaml:"-" json:"library"`                           // 所属模板库 (文件名)
+}
+
+// ToolDef 返回与模板等价的工具包工具定义，用于校验和绑定参数
+func (t Template) ToolDef() toolpacks.ToolDef {
+	readOnly := true
+	return toolpacks.ToolDef{
+		Name:        t.Name,
+		Description: t.Description,
+		SQL:         t.SQL,
+		Params:      t.Params,
+		ReadOnly:    &readOnly,
+		Timeout:     t.Timeout,
+		Pack:        t.Library,
+	}
+}
+
+// Manager 定义了查询模板库管理器的接口
+type Manager interface {
+	// LoadTemplates 从配置的目录加载所有模板库并缓存 (替换之前加载的模板)。
+	LoadTemplates() error
+
+	// GetTemplate 返回指定名称的模板。
+	GetTemplate(name string) (Template, bool)
+
+	// AllTemplates 返回所有已加载的模板，按模板库和名称排序。
+	AllTemplates() []Template
+}
+
+// manager 是 Manager 接口的实现。
+type manager struct {
+	templatesDir string
+	validate     func(Template) error // 额外的模板检查 (例如占位符与参数定义一致)，可以为 nil
+	cache        map[string]Template  // 模板名 -> 模板
+	mu           sync.RWMutex
+}
+
+// NewManager 创建一个新的查询模板库管理器。validate 在工具包规则之外对每个模板做额外检查，可以为 nil。
+func NewManager(templatesDir string, validate func(Template) error) Manager {
+	utils.DefaultLogger.Info("初始化查询模板库管理器...", zap.String("directory", templatesDir))
+	return &manager{templatesDir: templatesDir, validate: validate, cache: make(map[string]Template)}
+}
+
+// LoadTemplates 实现 Manager 接口。
+func (m *manager) LoadTemplates() error {
+	files, err := os.ReadDir(m.templatesDir)
+	if err != nil {
+		return fmt.Errorf("读取查询模板目录 '%s' 失败: %w", m.templatesDir, err)
+	}
+
+	cache := make(map[string]Template)
+	for _, file := range files {
+		fileName := file.Name()
+		if file.IsDir() || (!strings.HasSuffix(fileName, ".yaml") && !strings.HasSuffix(fileName, ".yml")) {
+			continue
+		}
+		libraryName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+		filePath := filepath.Join(m.templatesDir, fileName)
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			utils.DefaultLogger.Error("读取查询模板文件失败", zap.String("path", filePath), zap.Error(err))
+			continue
+		}
+		var library Library
+		if err := yaml.Unmarshal(data, &library); err != nil {
+			utils.DefaultLogger.Error("解析查询模板文件失败", zap.String("path", filePath), zap.Error(err))
+			continue
+		}
+
+		loaded := 0
+		for _, template := range library.Templates {
+			template.Library = libraryName
+			if err := m.check(&template); err != nil {
+				utils.DefaultLogger.Error("跳过无效的查询模板", zap.String("path", filePath), zap.String("template", template.Name), zap.Error(err))
+				continue
+			}
+			if previous, ok := cache[template.Name]; ok {
+				utils.DefaultLogger.Error("跳过重名的查询模板", zap.String("path", filePath), zap.String("template", template.Name), zap.String("definedIn", previous.Library))
+				continue
+			}
+			cache[template.Name] = template
+			loaded++
+		}
+		utils.DefaultLogger.Info("成功加载查询模板库", zap.String("library", libraryName), zap.String("file", fileName), zap.Int("templates", loaded))
+	}
+
+	m.mu.Lock()
+	m.cache = cache
+	m.mu.Unlock()
+	utils.DefaultLogger.Info("查询模板库加载完成", zap.Int("templates", len(cache)))
+	return nil
+}
+
+// check 按工具包的规则检查模板，并补全参数的默认类型
+func (m *manager) check(template *Template) error {
+	def := template.ToolDef()
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	template.Params = def.Params
+	if m.validate != nil {
+		return m.validate(*template)
+	}
+	return nil
+}
+
+// GetTemplate 实现 Manager 接口。
+func (m *manager) GetTemplate(name string) (Template, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	template, ok := m.cache[name]
+	return template, ok
+}
+
+// AllTemplates 实现 Manager 接口。
+func (m *manager) AllTemplates() []Template {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	all := make([]Template, 0, len(m.cache))
+	for _, template := range m.cache {
+		all = append(all, template)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Library != all[j].Library {
+			return all[i].Library < all[j].Library
+		}
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
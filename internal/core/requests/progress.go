@@ -0,0 +1,96 @@
+package requests
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// minProgressInterval 是两条进度通知之间的最小间隔，避免逐行查询时刷屏
+const minProgressInterval = 500 * time.Millisecond
+
+// progressKey 是请求 Context 中 progressReporter 的键
+type progressKey struct{}
+
+// progressReporter 向客户端发送一个工具调用的 notifications/progress。
+// 客户端在请求的 params._meta.progressToken 中提供令牌时才会创建。
+type progressReporter struct {
+	sessionID string
+	token     json.RawMessage // 保持客户端原样的字符串或整数令牌
+	send      func(ctx context.Context, sessionID string, msg []byte) error
+
+	mu       sync.Mutex
+	last     float64   // 已发送的最大进度，规范要求进度单调递增
+	lastSent time.Time // 最近一次发送的时间，为零值时尚未发送
+}
+
+// progressParams 是 notifications/progress 的参数 (message 字段自 2025-03-26 起定义，旧客户端会忽略)
+type progressParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Progress      float64         `json:"progress"`
+	Total         float64         `json:"total,omitempty"`
+	Message       string          `json:"message,omitempty"`
+}
+
+// progressToken 返回 tools/call 请求 params._meta.progressToken 的原始 JSON，没有时返回 nil
+func progressToken(params json.RawMessage) json.RawMessage {
+	var request struct {
+		Meta struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil
+	}
+	if token := request.Meta.ProgressToken; len(token) > 0 && string(token) != "null" {
+		return token
+	}
+	return nil
+}
+
+// WithoutProgress 返回不再发送进度通知的 Context。
+// 自行报告整体进度的 Handler 把它交给内部调用，避免内部查询报告的行数打乱整体进度。
+func WithoutProgress(ctx context.Context) context.Context {
+	if ctx.Value(progressKey{}) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, (*progressReporter)(nil))
+}
+
+// ReportProgress 报告当前工具调用的进度 (例如已处理的表数或已读取的行数)，total 为 0 表示总量未知。
+// ctx 不属于提供了 progressToken 的工具调用、调用已经结束，或距上次通知不足 minProgressInterval 时不发送
+// (progress 达到 total 的最终进度除外)。
+func ReportProgress(ctx context.Context, progress, total float64, message string) {
+	reporter, _ := ctx.Value(progressKey{}).(*progressReporter)
+	if reporter == nil || ctx.Err() != nil {
+		return
+	}
+	reporter.mu.Lock()
+	now := time.Now()
+	final := total > 0 && progress >= total
+	if !reporter.lastSent.IsZero() && (progress <= reporter.last || (!final && now.Sub(reporter.lastSent) < minProgressInterval)) {
+		reporter.mu.Unlock()
+		return
+	}
+	reporter.last, reporter.lastSent = progress, now
+	reporter.mu.Unlock()
+
+	notification := protocol.NewJSONRPCNotification(protocol.NotificationProgress, progressParams{
+		ProgressToken: reporter.token,
+		Progress:      progress,
+		Total:         total,
+		Message:       message,
+	})
+	msg, err := json.Marshal(notification)
+	if err != nil {
+		return
+	}
+	if err := reporter.send(ctx, reporter.sessionID, msg); err != nil {
+		utils.DefaultLogger.Debug("发送进度通知失败", zap.String("sessionID", reporter.sessionID), zap.Error(err))
+	}
+}
@@ -0,0 +1,270 @@
+// Package requests 为每次工具调用提供请求级别的 Context。
+//
+// go-mcp 调用 Handler 时不传 Context，客户端的 notifications/cancelled 也不会被处理。
+// Tracker 在传输层为每个 tools/call 请求创建一个从服务器根 Context 派生的 Context，
+// 通过注入到调用参数中的请求键交给 Handler；客户端取消请求、响应发出或服务器关闭时该 Context 被取消，
+// 正在执行的 PostgreSQL 查询随之被中断。
+//
+// 客户端在请求中提供 progressToken 时，Handler 通过 ReportProgress 向客户端发送 notifications/progress
+// (例如 Schema 加载的表数、查询已读取的行数)。
+package requests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ErrShuttingDown 是服务器关闭期间收到新的工具调用时返回的错误
+var ErrShuttingDown = errors.New("服务器正在关闭，不再接受新的工具调用")
+
+// KeyArg 是传输层注入到工具调用参数中的请求键，Handler 通过 Tracker.Context 取回后将其删除
+const KeyArg = "_mcp_request_key"
+
+// Tracker 记录正在执行的工具调用及其 Context
+type Tracker struct {
+	root       context.Context
+	cancelRoot context.CancelFunc
+
+	mu       sync.Mutex
+	inFlight map[string]*call // sessionID + "/" + 请求 ID -> 调用
+	draining bool             // 开始关闭后不再接受新的工具调用
+	wg       sync.WaitGroup   // 每个 inFlight 中的调用计数一次
+}
+
+// call 是正在执行的工具调用
+type call struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewTracker 创建一个 Tracker，所有请求的 Context 都从 parent 派生
+func NewTracker(parent context.Context) *Tracker {
+	root, cancel := context.WithCancel(parent)
+	return &Tracker{
+		root:       root,
+		cancelRoot: cancel,
+		inFlight:   make(map[string]*call),
+	}
+}
+
+// Root 返回服务器的根 Context (资源读取等拿不到请求键的 Handler 使用)
+func (t *Tracker) Root() context.Context {
+	return t.root
+}
+
+// CancelAll 取消根 Context 和所有正在执行的请求 (服务器关闭时调用)
+func (t *Tracker) CancelAll() {
+	t.cancelRoot()
+}
+
+// Drain 停止接受新的工具调用并等待正在执行的调用完成，ctx 结束时返回 ctx 的错误 (调用仍在执行)
+func (t *Tracker) Drain(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// InFlight 返回正在执行的工具调用数
+func (t *Tracker) InFlight() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.inFlight)
+}
+
+// Context 返回工具调用的请求 Context，并从 req 的参数中删除注入的请求键。
+// 找不到请求键时 (例如 Handler 被直接调用) 返回根 Context。
+func (t *Tracker) Context(req *protocol.CallToolRequest) context.Context {
+	if req == nil || len(req.RawArguments) == 0 {
+		return t.root
+	}
+	var arguments map[string]json.RawMessage
+	if err := json.Unmarshal(req.RawArguments, &arguments); err != nil {
+		return t.root
+	}
+	rawKey, ok := arguments[KeyArg]
+	if !ok {
+		return t.root
+	}
+	delete(arguments, KeyArg)
+	if raw, err := json.Marshal(arguments); err == nil {
+		req.RawArguments = raw
+	}
+	delete(req.Arguments, KeyArg)
+
+	var key string
+	if err := json.Unmarshal(rawKey, &key); err != nil {
+		return t.root
+	}
+	t.mu.Lock()
+	c, ok := t.inFlight[key]
+	t.mu.Unlock()
+	if !ok {
+		// 请求在 Handler 开始执行前已被取消
+		ctx, cancel := context.WithCancel(t.root)
+		cancel()
+		return ctx
+	}
+	return c.ctx
+}
+
+// WrapTransport 返回一个包装后的传输层，为每个 tools/call 请求创建 Context 并处理 notifications/cancelled。
+// 需要包装在其他观察工具参数的传输层 (如审计) 外层，使它们看不到注入的请求键。
+func (t *Tracker) WrapTransport(inner transport.ServerTransport) transport.ServerTransport {
+	return &trackedTransport{ServerTransport: inner, tracker: t}
+}
+
+type trackedTransport struct {
+	transport.ServerTransport
+	tracker *Tracker
+}
+
+// rpcMessage 是需要的 JSON-RPC 消息字段
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// onReceive 为 tools/call 请求创建 Context 并注入请求键，返回 (可能被改写的) 消息和请求键。
+// 请求带有 progressToken 时，Context 中附带通过 send 发送进度通知的 progressReporter。
+// 关闭期间收到的工具调用返回 ErrShuttingDown。
+func (t *Tracker) onReceive(sessionID string, msg []byte, send func(ctx context.Context, sessionID string, msg []byte) error) ([]byte, string, error) {
+	var message rpcMessage
+	if err := json.Unmarshal(msg, &message); err != nil {
+		return msg, "", nil
+	}
+	switch protocol.Method(message.Method) {
+	case protocol.NotificationCancelled:
+		var params struct {
+			RequestID json.RawMessage `json:"requestId"`
+			Reason    string          `json:"reason"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err == nil && len(params.RequestID) > 0 {
+			if t.finish(sessionID + "/" + string(params.RequestID)) {
+				utils.DefaultLogger.Info("客户端取消了工具调用", zap.String("sessionID", sessionID), zap.String("requestID", string(params.RequestID)), zap.String("reason", params.Reason))
+			}
+		}
+		return msg, "", nil
+	case protocol.ToolsCall:
+		if len(message.ID) == 0 {
+			return msg, "", nil
+		}
+	default:
+		return msg, "", nil
+	}
+
+	key := sessionID + "/" + string(message.ID)
+	rewritten, err := injectKey(msg, key)
+	if err != nil {
+		return msg, "", nil
+	}
+	ctx, cancel := context.WithCancel(t.root)
+	if token := progressToken(message.Params); token != nil {
+		ctx = context.WithValue(ctx, progressKey{}, &progressReporter{sessionID: sessionID, token: token, send: send})
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		cancel()
+		return nil, "", ErrShuttingDown
+	}
+	if previous, ok := t.inFlight[key]; ok {
+		previous.cancel() // 客户端重复使用了仍在执行的请求 ID，计数由新的调用继承
+	} else {
+		t.wg.Add(1)
+	}
+	t.inFlight[key] = &call{ctx: ctx, cancel: cancel}
+	return rewritten, key, nil
+}
+
+// finish 取消并移除请求的 Context，返回请求是否仍在执行
+func (t *Tracker) finish(key string) bool {
+	t.mu.Lock()
+	c, ok := t.inFlight[key]
+	delete(t.inFlight, key)
+	t.mu.Unlock()
+	if ok {
+		c.cancel()
+		t.wg.Done()
+	}
+	return ok
+}
+
+// injectKey 把请求键写入 tools/call 消息的 params.arguments
+func injectKey(msg []byte, key string) ([]byte, error) {
+	var message map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &message); err != nil {
+		return nil, err
+	}
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(message["params"], &params); err != nil {
+		return nil, err
+	}
+	arguments := make(map[string]json.RawMessage)
+	if raw, ok := params["arguments"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &arguments); err != nil {
+			return nil, err
+		}
+	}
+	rawKey, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	arguments[KeyArg] = rawKey
+	if params["arguments"], err = json.Marshal(arguments); err != nil {
+		return nil, err
+	}
+	if message["params"], err = json.Marshal(params); err != nil {
+		return nil, err
+	}
+	return json.Marshal(message)
+}
+
+// Send 实现 transport.ServerTransport 接口。响应发出后取消对应请求的 Context。
+func (tt *trackedTransport) Send(ctx context.Context, sessionID string, msg transport.Message) error {
+	err := tt.ServerTransport.Send(ctx, sessionID, msg)
+	var message rpcMessage
+	if jsonErr := json.Unmarshal(msg, &message); jsonErr == nil && message.Method == "" && len(message.ID) > 0 {
+		tt.tracker.finish(sessionID + "/" + string(message.ID))
+	}
+	return err
+}
+
+// SetReceiver 实现 transport.ServerTransport 接口。
+func (tt *trackedTransport) SetReceiver(receiver transport.ServerReceiver) {
+	tt.ServerTransport.SetReceiver(transport.ServerReceiverF(func(ctx context.Context, sessionID string, msg []byte) error {
+		rewritten, key, err := tt.tracker.onReceive(sessionID, msg, func(ctx context.Context, sessionID string, msg []byte) error {
+			return tt.ServerTransport.Send(ctx, sessionID, msg)
+		})
+		if err != nil {
+			return err
+		}
+		if err := receiver.Receive(ctx, sessionID, rewritten); err != nil {
+			// 请求没有被接受 (例如 go-mcp 已开始关闭)，不会有响应
+			if key != "" {
+				tt.tracker.finish(key)
+			}
+			return err
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,183 @@
+package results
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BytesPerToken 是把 token 预算换算为字节预算时使用的近似值 (英文和 SQL 结果约 4 字节/token)
+const BytesPerToken = 4
+
+// ColumnSummary 是一列在全部结果行上的统计，结果被截断时代替未返回的行
+type ColumnSummary struct {
+	Column   string `json:"column"`
+	Count    int    `json:"count"`              // 非 NULL 值的个数
+	Nulls    int    `json:"nulls"`              // NULL 值的个数
+	Distinct int    `json:"distinct,omitempty"` // 不同值的个数 (超过 maxDistinctTracked 时不统计)
+	Min      string `json:"min,omitempty"`      // 最小值 (数值、时间和文本列)
+	Max      string `json:"max,omitempty"`      // 最大值
+}
+
+// Truncation 是结果超过响应预算时附带的截断说明
+type Truncation struct {
+	Notice       string          `json:"notice"`
+	BudgetBytes  int             `json:"budget_bytes"`
+	RowsTotal    int             `json:"rows_total"`    // 查询返回的全部行数
+	RowsReturned int             `json:"rows_returned"` // 实际编码返回的行数
+	FullBytes    int             `json:"full_bytes"`    // 编码全部行时的字节数
+	Columns      []ColumnSummary `json:"column_summaries"`
+}
+
+// maxDistinctTracked 是每列统计不同值个数的上限，超过后不再报告 distinct，避免大结果集占用过多内存
+const maxDistinctTracked = 10000
+
+// EncodeWithinBudget 按格式编码结果，编码后超过 budgetBytes 时只编码能放进预算的前 N 行，
+// 并返回截断说明 (包含全部行的逐列统计)。budgetBytes 不大于 0 或结果未超过预算时 truncation 为 nil。
+func EncodeWithinBudget(format string, columns []string, rows []map[string]any, budgetBytes int) (encoded string, kept []map[string]any, truncation *Truncation, err error) {
+	encoded, err = Encode(format, columns, rows)
+	if err != nil || budgetBytes <= 0 || len(encoded) <= budgetBytes {
+		return encoded, rows, nil, err
+	}
+	fullBytes := len(encoded)
+
+	// 编码大小随行数单调增长，二分查找能放进预算的最大行数
+	low, high := 0, len(rows)-1
+	for low < high {
+		mid := (low + high + 1) / 2
+		candidate, err := Encode(format, columns, rows[:mid])
+		if err != nil {
+			return "", nil, nil, err
+		}
+		if len(candidate) <= budgetBytes {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	kept = rows[:low]
+	if encoded, err = Encode(format, columns, kept); err != nil {
+		return "", nil, nil, err
+	}
+	truncation = &Truncation{
+		Notice: fmt.Sprintf("结果编码后为 %d 字节，超过响应预算 %d 字节，只返回了前 %d 行 (共 %d 行)；column_summaries 是全部行的逐列统计。需要其余数据时请加 LIMIT/OFFSET、WHERE 条件或只选择需要的列",
+			fullBytes, budgetBytes, low, len(rows)),
+		BudgetBytes:  budgetBytes,
+		RowsTotal:    len(rows),
+		RowsReturned: low,
+		FullBytes:    fullBytes,
+		Columns:      SummarizeColumns(columns, rows),
+	}
+	return encoded, kept, truncation, nil
+}
+
+// SummarizeColumns 统计每列的非 NULL 个数、NULL 个数、不同值个数以及最小/最大值。
+// 数值按数值比较，时间按时间比较，文本按字典序比较；布尔值、JSON 等其他类型只统计个数。
+func SummarizeColumns(columns []string, rows []map[string]any) []ColumnSummary {
+	summaries := make([]ColumnSummary, 0, len(columns))
+	for _, column := range columns {
+		summary := ColumnSummary{Column: column}
+		distinct := make(map[string]struct{})
+		var minValue, maxValue comparableValue
+		for _, row := range rows {
+			value := row[column]
+			if value == nil {
+				summary.Nulls++
+				continue
+			}
+			summary.Count++
+			text := FormatValue(value)
+			if distinct != nil {
+				distinct[text] = struct{}{}
+				if len(distinct) > maxDistinctTracked {
+					distinct = nil
+				}
+			}
+			current, ok := toComparable(value, text)
+			if !ok {
+				continue
+			}
+			if minValue.kind == kindNone || (current.kind == minValue.kind && current.less(minValue)) {
+				minValue = current
+			}
+			if maxValue.kind == kindNone || (current.kind == maxValue.kind && maxValue.less(current)) {
+				maxValue = current
+			}
+		}
+		if distinct != nil {
+			summary.Distinct = len(distinct)
+		}
+		if minValue.kind != kindNone {
+			summary.Min = shortenSummaryText(minValue.text)
+			summary.Max = shortenSummaryText(maxValue.text)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// 可比较值的种类
+const (
+	kindNone = iota
+	kindNumber
+	kindTime
+	kindText
+)
+
+// comparableValue 是用于求最小/最大值的值
+type comparableValue struct {
+	kind   int
+	number float64
+	time   time.Time
+	text   string // 展示用文本 (FormatValue 的结果)
+}
+
+// less 比较同一种类的两个值
+func (v comparableValue) less(other comparableValue) bool {
+	switch v.kind {
+	case kindNumber:
+		return v.number < other.number
+	case kindTime:
+		return v.time.Before(other.time)
+	default:
+		return v.text < other.text
+	}
+}
+
+// maxSummaryText 是文本列最小/最大值的展示长度上限
+const maxSummaryText = 64
+
+// shortenSummaryText 截断过长的最小/最大值文本
+func shortenSummaryText(text string) string {
+	if len(text) <= maxSummaryText {
+		return text
+	}
+	return strings.ToValidUTF8(text[:maxSummaryText], "") + "…"
+}
+
+// toComparable 把结果值转换为可比较值，不支持比较的类型返回 false
+func toComparable(value any, text string) (comparableValue, bool) {
+	switch v := value.(type) {
+	case int64:
+		return comparableValue{kind: kindNumber, number: float64(v), text: text}, true
+	case int32:
+		return comparableValue{kind: kindNumber, number: float64(v), text: text}, true
+	case int16:
+		return comparableValue{kind: kindNumber, number: float64(v), text: text}, true
+	case float64:
+		return comparableValue{kind: kindNumber, number: v, text: text}, true
+	case float32:
+		return comparableValue{kind: kindNumber, number: float64(v), text: text}, true
+	case time.Time:
+		return comparableValue{kind: kindTime, time: v, text: text}, true
+	case string:
+		return comparableValue{kind: kindText, text: text}, true
+	case driver.Valuer: // numeric 等 pgtype 类型按文本形式解析为数值
+		if number, err := strconv.ParseFloat(text, 64); err == nil {
+			return comparableValue{kind: kindNumber, number: number, text: text}, true
+		}
+	}
+	return comparableValue{}, false
+}
@@ -0,0 +1,159 @@
+package results
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持的结果输出格式
+const (
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatTSV      = "tsv"
+	FormatMarkdown = "markdown"
+)
+
+// mimeTypes 是各格式对应的 MIME 类型
+var mimeTypes = map[string]string{
+	FormatJSON:     "application/json",
+	FormatCSV:      "text/csv",
+	FormatTSV:      "text/tab-separated-values",
+	FormatMarkdown: "text/markdown",
+}
+
+// tsvEscaper 转义 TSV 中会破坏行列结构的字符
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// IsSupportedFormat 判断格式名是否受支持 (空字符串视为 json)
+func IsSupportedFormat(format string) bool {
+	if format == "" {
+		return true
+	}
+	_, ok := mimeTypes[format]
+	return ok
+}
+
+// MimeType 返回格式对应的 MIME 类型
+func MimeType(format string) string {
+	if mimeType, ok := mimeTypes[format]; ok {
+		return mimeType
+	}
+	return mimeTypes[FormatJSON]
+}
+
+// Encode 将查询结果按指定格式编码为文本。
+// json 输出为对象数组 (与 pg_query 的默认输出一致)，值按 NormalizeValue 转换；csv/tsv/markdown 输出带表头的表格，列顺序与 columns 一致。
+// 表格格式中 NULL 在 csv/tsv 中为空值，在 markdown 中显示为 NULL；markdown 中过长的值会被截断 (见 MarkdownMaxCellWidth)。
+func Encode(format string, columns []string, rows []map[string]any) (string, error) {
+	switch format {
+	case "", FormatJSON:
+		if rows == nil {
+			rows = []map[string]any{}
+		}
+		data, err := json.Marshal(NormalizeRows(rows))
+		if err != nil {
+			return "", fmt.Errorf("序列化查询结果失败: %w", err)
+		}
+		return string(data), nil
+	case FormatCSV:
+		return encodeCSV(columns, rows)
+	case FormatTSV:
+		return encodeTSV(columns, rows), nil
+	case FormatMarkdown:
+		return encodeMarkdown(columns, rows), nil
+	default:
+		return "", fmt.Errorf("不支持的输出格式: '%s' (可选 json, csv, tsv, markdown)", format)
+	}
+}
+
+// encodeCSV 按 RFC 4180 输出 CSV，必要时由 encoding/csv 负责加引号
+func encodeCSV(columns []string, rows []map[string]any) (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(columns); err != nil {
+		return "", fmt.Errorf("写入 CSV 表头失败: %w", err)
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, col := range columns {
+			record[i] = FormatValue(row[col])
+		}
+		if err := writer.Write(record); err != nil {
+			return "", fmt.Errorf("写入 CSV 行失败: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", fmt.Errorf("写入 CSV 失败: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// encodeTSV 输出制表符分隔的文本，值中的制表符和换行被转义为 \t、\n
+func encodeTSV(columns []string, rows []map[string]any) string {
+	var sb strings.Builder
+	cells := make([]string, len(columns))
+	for i, col := range columns {
+		cells[i] = tsvEscaper.Replace(col)
+	}
+	sb.WriteString(strings.Join(cells, "\t"))
+	sb.WriteString("\n")
+	for _, row := range rows {
+		for i, col := range columns {
+			cells[i] = tsvEscaper.Replace(FormatValue(row[col]))
+		}
+		sb.WriteString(strings.Join(cells, "\t"))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// FormatValue 将查询结果中的单个值转换为文本。
+// 标量直接格式化，时间使用 RFC 3339，bytea 使用 PostgreSQL 的 \x 十六进制形式，
+// 数组、对象等复杂值使用 JSON。NULL 返回空字符串。
+func FormatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []byte:
+		return `\x` + hex.EncodeToString(v)
+	case [16]byte: // uuid
+		return fmt.Sprintf("%x-%x-%x-%x-%x", v[0:4], v[4:6], v[6:8], v[8:10], v[10:16])
+	case fmt.Stringer:
+		return v.String()
+	case driver.Valuer: // numeric 等 pgtype 类型
+		if driverValue, err := v.Value(); err == nil {
+			if _, isValuer := driverValue.(driver.Valuer); !isValuer {
+				return FormatValue(driverValue)
+			}
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,283 @@
+package results
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// WKB 几何类型编号
+const (
+	wkbPoint              = 1
+	wkbLineString         = 2
+	wkbPolygon            = 3
+	wkbMultiPoint         = 4
+	wkbMultiLineString    = 5
+	wkbMultiPolygon       = 6
+	wkbGeometryCollection = 7
+)
+
+// EWKB 类型字段中的标记位
+const (
+	ewkbZFlag    = 0x80000000
+	ewkbMFlag    = 0x40000000
+	ewkbSRIDFlag = 0x20000000
+)
+
+// maxGeometryDepth 是 GeometryCollection 的最大嵌套层数
+const maxGeometryDepth = 16
+
+// geoJSONTypes 是 WKB 类型编号对应的 GeoJSON 类型名
+var geoJSONTypes = map[uint32]string{
+	wkbPoint:              "Point",
+	wkbLineString:         "LineString",
+	wkbPolygon:            "Polygon",
+	wkbMultiPoint:         "MultiPoint",
+	wkbMultiLineString:    "MultiLineString",
+	wkbMultiPolygon:       "MultiPolygon",
+	wkbGeometryCollection: "GeometryCollection",
+}
+
+// ParseEWKBHex 把 PostGIS geometry/geography 的文本输出 (十六进制 EWKB) 转换为 GeoJSON 对象。
+// 坐标包含 Z (不包含 M)，SRID 不是 4326 时与 ST_AsGeoJSON 相同附加 crs；
+// 文本不是完整有效的 EWKB 时返回 false，调用方保留原值。
+func ParseEWKBHex(text string) (map[string]any, bool) {
+	// 最短的 EWKB (空的 GeometryCollection) 有 9 字节
+	if len(text) < 18 || len(text)%2 != 0 || (text[:2] != "00" && text[:2] != "01") {
+		return nil, false
+	}
+	data, err := hex.DecodeString(text)
+	if err != nil {
+		return nil, false
+	}
+	reader := &wkbReader{data: data}
+	geometry, srid, err := reader.readGeometry(0)
+	if err != nil || reader.offset != len(data) {
+		return nil, false
+	}
+	if srid != 0 && srid != 4326 {
+		geometry["crs"] = map[string]any{"type": "name", "properties": map[string]any{"name": fmt.Sprintf("EPSG:%d", srid)}}
+	}
+	return geometry, true
+}
+
+// errInvalidWKB 表示数据不是有效的 WKB
+var errInvalidWKB = errors.New("无效的 WKB 数据")
+
+// wkbReader 按顺序读取 WKB 数据
+type wkbReader struct {
+	data   []byte
+	offset int
+	order  binary.ByteOrder
+}
+
+// readGeometry 读取一个几何对象 (包括字节序和类型头)，返回 GeoJSON 对象和 SRID
+func (r *wkbReader) readGeometry(depth int) (map[string]any, uint32, error) {
+	if depth > maxGeometryDepth || r.offset >= len(r.data) {
+		return nil, 0, errInvalidWKB
+	}
+	switch r.data[r.offset] {
+	case 0:
+		r.order = binary.BigEndian
+	case 1:
+		r.order = binary.LittleEndian
+	default:
+		return nil, 0, errInvalidWKB
+	}
+	r.offset++
+	typeCode, err := r.readUint32()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var srid uint32
+	hasZ := typeCode&ewkbZFlag != 0
+	hasM := typeCode&ewkbMFlag != 0
+	if typeCode&ewkbSRIDFlag != 0 {
+		if srid, err = r.readUint32(); err != nil {
+			return nil, 0, err
+		}
+	}
+	typeCode &^= ewkbZFlag | ewkbMFlag | ewkbSRIDFlag
+	// ISO WKB 用 1000/2000/3000 的偏移表示 Z/M/ZM
+	switch typeCode / 1000 {
+	case 1:
+		hasZ = true
+	case 2:
+		hasM = true
+	case 3:
+		hasZ, hasM = true, true
+	case 0:
+	default:
+		return nil, 0, errInvalidWKB
+	}
+	typeCode %= 1000
+	geoJSONType, ok := geoJSONTypes[typeCode]
+	if !ok {
+		return nil, 0, errInvalidWKB
+	}
+	dims := 2
+	if hasZ {
+		dims++
+	}
+	if hasM {
+		dims++
+	}
+
+	geometry := map[string]any{"type": geoJSONType}
+	switch typeCode {
+	case wkbPoint:
+		point, err := r.readPosition(dims, hasZ)
+		if err != nil {
+			return nil, 0, err
+		}
+		if isEmptyPosition(point) {
+			geometry["coordinates"] = []any{}
+		} else {
+			geometry["coordinates"] = point
+		}
+	case wkbLineString:
+		positions, err := r.readPositions(dims, hasZ)
+		if err != nil {
+			return nil, 0, err
+		}
+		geometry["coordinates"] = positions
+	case wkbPolygon:
+		rings, err := r.readRings(dims, hasZ)
+		if err != nil {
+			return nil, 0, err
+		}
+		geometry["coordinates"] = rings
+	case wkbMultiPoint, wkbMultiLineString, wkbMultiPolygon:
+		members, err := r.readMembers(depth)
+		if err != nil {
+			return nil, 0, err
+		}
+		coordinates := make([]any, 0, len(members))
+		for _, member := range members {
+			if member["type"] != geoJSONTypes[typeCode-3] {
+				return nil, 0, errInvalidWKB
+			}
+			coordinates = append(coordinates, member["coordinates"])
+		}
+		geometry["coordinates"] = coordinates
+	case wkbGeometryCollection:
+		members, err := r.readMembers(depth)
+		if err != nil {
+			return nil, 0, err
+		}
+		geometries := make([]any, len(members))
+		for i, member := range members {
+			geometries[i] = member
+		}
+		geometry["geometries"] = geometries
+	}
+	return geometry, srid, nil
+}
+
+// readMembers 读取 Multi* 和 GeometryCollection 中的成员几何对象 (成员各自带有字节序和类型头)
+func (r *wkbReader) readMembers(depth int) ([]map[string]any, error) {
+	order := r.order
+	count, err := r.readCount(5)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]map[string]any, 0, count)
+	for i := 0; i < count; i++ {
+		member, _, err := r.readGeometry(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	r.order = order
+	return members, nil
+}
+
+// readRings 读取多边形的环列表
+func (r *wkbReader) readRings(dims int, hasZ bool) ([]any, error) {
+	count, err := r.readCount(4)
+	if err != nil {
+		return nil, err
+	}
+	rings := make([]any, 0, count)
+	for i := 0; i < count; i++ {
+		ring, err := r.readPositions(dims, hasZ)
+		if err != nil {
+			return nil, err
+		}
+		rings = append(rings, ring)
+	}
+	return rings, nil
+}
+
+// readPositions 读取坐标点列表
+func (r *wkbReader) readPositions(dims int, hasZ bool) ([]any, error) {
+	count, err := r.readCount(dims * 8)
+	if err != nil {
+		return nil, err
+	}
+	positions := make([]any, 0, count)
+	for i := 0; i < count; i++ {
+		position, err := r.readPosition(dims, hasZ)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
+// readPosition 读取一个坐标点，返回 [x, y] 或 [x, y, z] (丢弃 M)
+func (r *wkbReader) readPosition(dims int, hasZ bool) ([]any, error) {
+	if len(r.data)-r.offset < dims*8 {
+		return nil, errInvalidWKB
+	}
+	size := 2
+	if hasZ {
+		size = 3
+	}
+	position := make([]any, 0, size)
+	for i := 0; i < dims; i++ {
+		bits := r.order.Uint64(r.data[r.offset:])
+		r.offset += 8
+		if i < size {
+			position = append(position, normalizeFloat(math.Float64frombits(bits)))
+		}
+	}
+	return position, nil
+}
+
+// readCount 读取元素个数，并检查剩余数据至少能容纳 count 个 minSize 字节的元素，避免按伪造的个数分配内存
+func (r *wkbReader) readCount(minSize int) (int, error) {
+	count, err := r.readUint32()
+	if err != nil {
+		return 0, err
+	}
+	if int64(count)*int64(minSize) > int64(len(r.data)-r.offset) {
+		return 0, errInvalidWKB
+	}
+	return int(count), nil
+}
+
+// readUint32 按当前字节序读取一个 uint32
+func (r *wkbReader) readUint32() (uint32, error) {
+	if len(r.data)-r.offset < 4 {
+		return 0, errInvalidWKB
+	}
+	value := r.order.Uint32(r.data[r.offset:])
+	r.offset += 4
+	return value, nil
+}
+
+// isEmptyPosition 判断坐标是否为 POINT EMPTY (WKB 中坐标都是 NaN)
+func isEmptyPosition(position []any) bool {
+	for _, coordinate := range position {
+		if coordinate != "NaN" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package results
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+// ewkb 按字节序编码一个几何对象: typeCode 带有 SRID 标记时在类型后写入 srid，
+// parts 中的 uint32 是元素个数，float64 是坐标，[]byte 是已编码的成员几何对象
+func ewkb(order binary.AppendByteOrder, typeCode, srid uint32, parts ...any) []byte {
+	data := []byte{1}
+	if order == binary.BigEndian {
+		data[0] = 0
+	}
+	data = order.AppendUint32(data, typeCode)
+	if typeCode&ewkbSRIDFlag != 0 {
+		data = order.AppendUint32(data, srid)
+	}
+	for _, part := range parts {
+		switch v := part.(type) {
+		case uint32:
+			data = order.AppendUint32(data, v)
+		case float64:
+			data = order.AppendUint64(data, math.Float64bits(v))
+		case []byte:
+			data = append(data, v...)
+		default:
+			panic("ewkb: 不支持的类型")
+		}
+	}
+	return data
+}
+
+// le 是小端序 (PostGIS 的默认输出) 的 ewkb
+func le(typeCode, srid uint32, parts ...any) []byte {
+	return ewkb(binary.LittleEndian, typeCode, srid, parts...)
+}
+
+func TestParseEWKBHex(t *testing.T) {
+	point := func(x, y float64) []byte { return le(wkbPoint, 0, x, y) }
+	nested := le(wkbGeometryCollection, 0, uint32(0))
+	for i := 0; i < maxGeometryDepth; i++ {
+		nested = le(wkbGeometryCollection, 0, uint32(1), nested)
+	}
+	tooDeep := le(wkbGeometryCollection, 0, uint32(1), nested)
+
+	tests := []struct {
+		name string
+		data []byte
+		text string // 非空时代替 data 的十六进制编码
+		want string // GeoJSON 的 JSON 编码，空表示无效
+	}{
+		{name: "Point SRID 4326 不附加 crs", data: le(wkbPoint|ewkbSRIDFlag, 4326, 116.4, 39.9), want: `{"coordinates":[116.4,39.9],"type":"Point"}`},
+		{name: "Point 无 SRID", data: point(1, 2), want: `{"coordinates":[1,2],"type":"Point"}`},
+		{name: "Point 大端序", data: ewkb(binary.BigEndian, wkbPoint|ewkbSRIDFlag, 4326, 1.5, -2.5), want: `{"coordinates":[1.5,-2.5],"type":"Point"}`},
+		{name: "Point SRID 3857 附加 crs", data: le(wkbPoint|ewkbSRIDFlag, 3857, 100.0, 200.0), want: `{"coordinates":[100,200],"crs":{"properties":{"name":"EPSG:3857"},"type":"name"},"type":"Point"}`},
+		{name: "PointZ", data: le(wkbPoint|ewkbZFlag, 0, 1.0, 2.0, 3.0), want: `{"coordinates":[1,2,3],"type":"Point"}`},
+		{name: "PointM 丢弃 M", data: le(wkbPoint|ewkbMFlag, 0, 1.0, 2.0, 9.0), want: `{"coordinates":[1,2],"type":"Point"}`},
+		{name: "PointZM 丢弃 M", data: le(wkbPoint|ewkbZFlag|ewkbMFlag, 0, 1.0, 2.0, 3.0, 9.0), want: `{"coordinates":[1,2,3],"type":"Point"}`},
+		{name: "ISO Point Z", data: le(1001, 0, 1.0, 2.0, 3.0), want: `{"coordinates":[1,2,3],"type":"Point"}`},
+		{name: "ISO Point M", data: le(2001, 0, 1.0, 2.0, 9.0), want: `{"coordinates":[1,2],"type":"Point"}`},
+		{name: "ISO Point ZM", data: le(3001, 0, 1.0, 2.0, 3.0, 9.0), want: `{"coordinates":[1,2,3],"type":"Point"}`},
+		{name: "POINT EMPTY", data: le(wkbPoint, 0, math.NaN(), math.NaN()), want: `{"coordinates":[],"type":"Point"}`},
+		{name: "LineString", data: le(wkbLineString|ewkbSRIDFlag, 4326, uint32(2), 0.0, 0.0, 1.0, 1.0), want: `{"coordinates":[[0,0],[1,1]],"type":"LineString"}`},
+		{name: "空 LineString", data: le(wkbLineString, 0, uint32(0)), want: `{"coordinates":[],"type":"LineString"}`},
+		{name: "Polygon", data: le(wkbPolygon, 0, uint32(1), uint32(4), 0.0, 0.0, 1.0, 0.0, 1.0, 1.0, 0.0, 0.0), want: `{"coordinates":[[[0,0],[1,0],[1,1],[0,0]]],"type":"Polygon"}`},
+		{name: "MultiPoint", data: le(wkbMultiPoint|ewkbSRIDFlag, 4326, uint32(2), point(1, 2), point(3, 4)), want: `{"coordinates":[[1,2],[3,4]],"type":"MultiPoint"}`},
+		{name: "MultiLineString", data: le(wkbMultiLineString, 0, uint32(1), le(wkbLineString, 0, uint32(2), 0.0, 0.0, 1.0, 1.0)), want: `{"coordinates":[[[0,0],[1,1]]],"type":"MultiLineString"}`},
+		{name: "MultiPolygon", data: le(wkbMultiPolygon, 0, uint32(1), le(wkbPolygon, 0, uint32(0))), want: `{"coordinates":[[]],"type":"MultiPolygon"}`},
+		{name: "成员使用不同的字节序", data: le(wkbMultiPoint, 0, uint32(2), ewkb(binary.BigEndian, wkbPoint, 0, 1.0, 2.0), point(3, 4)), want: `{"coordinates":[[1,2],[3,4]],"type":"MultiPoint"}`},
+		{name: "GeometryCollection", data: le(wkbGeometryCollection|ewkbSRIDFlag, 4326, uint32(2), point(1, 2), le(wkbLineString, 0, uint32(1), 5.0, 6.0)), want: `{"geometries":[{"coordinates":[1,2],"type":"Point"},{"coordinates":[[5,6]],"type":"LineString"}],"type":"GeometryCollection"}`},
+		{name: "空 GeometryCollection", data: le(wkbGeometryCollection, 0, uint32(0)), want: `{"geometries":[],"type":"GeometryCollection"}`},
+		{name: "最大嵌套层数", data: nested, want: `{"geometries":[` + strings.Repeat(`{"geometries":[`, maxGeometryDepth-1) + `{"geometries":[],"type":"GeometryCollection"}` + strings.Repeat(`],"type":"GeometryCollection"}`, maxGeometryDepth)},
+
+		{name: "普通文本", text: "hello world, not geometry"},
+		{name: "太短", text: "0101000000"},
+		{name: "奇数长度", text: hex.EncodeToString(point(1, 2)) + "0"},
+		{name: "无效的字节序", text: "02" + hex.EncodeToString(point(1, 2))[2:]},
+		{name: "非十六进制字符", text: "01zz" + hex.EncodeToString(point(1, 2))[4:]},
+		{name: "多余的尾部数据", data: append(point(1, 2), 0)},
+		{name: "坐标被截断", data: point(1, 2)[:17]},
+		{name: "未知的几何类型", data: le(8, 0, uint32(0))},
+		{name: "无效的 ISO 维度", data: le(4001, 0, 1.0, 2.0)},
+		{name: "伪造的元素个数", data: le(wkbLineString, 0, uint32(math.MaxUint32), 0.0, 0.0)},
+		{name: "MultiPoint 中的 LineString", data: le(wkbMultiPoint, 0, uint32(1), le(wkbLineString, 0, uint32(0)))},
+		{name: "超过最大嵌套层数", data: tooDeep},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := tt.text
+			if text == "" {
+				text = strings.ToUpper(hex.EncodeToString(tt.data))
+			}
+			geometry, ok := ParseEWKBHex(text)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("ParseEWKBHex(%q) = %v, 期望无效", text, geometry)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("ParseEWKBHex(%q) 无效, want %s", text, tt.want)
+			}
+			encoded, err := json.Marshal(geometry)
+			if err != nil {
+				t.Fatalf("GeoJSON 无法序列化: %v", err)
+			}
+			if string(encoded) != tt.want {
+				t.Errorf("ParseEWKBHex(%q) = %s, want %s", text, encoded, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package results
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// MarkdownMaxCellWidth 是 Markdown 表格单元格的最大显示宽度，更长的值截断并以 … 结尾，
+// 避免个别长文本 (JSON、日志、SQL 等) 把整张表撑得无法阅读
+const MarkdownMaxCellWidth = 60
+
+// markdownEscaper 转义 Markdown 表格单元格中的管道符和换行
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+// encodeMarkdown 输出 GitHub 风格的 Markdown 表格。
+// 单元格按列宽补齐空格，直接显示文本的客户端也能对齐阅读；全部非 NULL 值都是数值的列右对齐。
+func encodeMarkdown(columns []string, rows []map[string]any) string {
+	header := make([]string, len(columns))
+	widths := make([]int, len(columns))
+	numeric := make([]bool, len(columns))
+	for i, col := range columns {
+		header[i] = markdownCell(col)
+		widths[i] = max(displayWidth(header[i]), 3) // 分隔行至少需要 ---
+		numeric[i] = len(rows) > 0
+	}
+
+	body := make([][]string, len(rows))
+	for r, row := range rows {
+		cells := make([]string, len(columns))
+		for i, col := range columns {
+			value := row[col]
+			if value == nil {
+				cells[i] = "NULL"
+			} else {
+				text := FormatValue(value)
+				if comparable, ok := toComparable(value, text); !ok || comparable.kind != kindNumber {
+					numeric[i] = false
+				}
+				cells[i] = markdownCell(text)
+			}
+			widths[i] = max(widths[i], displayWidth(cells[i]))
+		}
+		body[r] = cells
+	}
+
+	var sb strings.Builder
+	writeMarkdownRow(&sb, header, widths, nil)
+	separator := make([]string, len(columns))
+	for i := range columns {
+		if numeric[i] {
+			separator[i] = strings.Repeat("-", widths[i]-1) + ":"
+		} else {
+			separator[i] = strings.Repeat("-", widths[i])
+		}
+	}
+	writeMarkdownRow(&sb, separator, widths, nil)
+	for _, cells := range body {
+		writeMarkdownRow(&sb, cells, widths, numeric)
+	}
+	return sb.String()
+}
+
+// writeMarkdownRow 写入一行表格，按列宽补齐空格 (rightAlign 中为 true 的列在左侧补齐)
+func writeMarkdownRow(sb *strings.Builder, cells []string, widths []int, rightAlign []bool) {
+	sb.WriteString("|")
+	for i, cell := range cells {
+		padding := strings.Repeat(" ", widths[i]-displayWidth(cell))
+		sb.WriteString(" ")
+		if rightAlign != nil && rightAlign[i] {
+			sb.WriteString(padding + cell)
+		} else {
+			sb.WriteString(cell + padding)
+		}
+		sb.WriteString(" |")
+	}
+	sb.WriteString("\n")
+}
+
+// markdownCell 截断超过 MarkdownMaxCellWidth 的值并转义为单元格文本。
+// 先截断再转义，截断不会拆开 \| 和 <br> 转义序列。
+func markdownCell(text string) string {
+	if displayWidth(text) > MarkdownMaxCellWidth {
+		width := 0
+		for i, r := range text {
+			width += runeWidth(r)
+			if width > MarkdownMaxCellWidth-1 {
+				text = text[:i] + "…"
+				break
+			}
+		}
+	}
+	return markdownEscaper.Replace(text)
+}
+
+// displayWidth 返回文本在等宽字体中的显示宽度 (中日韩等全角字符占两列)
+func displayWidth(text string) int {
+	if isASCII(text) {
+		return len(text)
+	}
+	width := 0
+	for _, r := range text {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// isASCII 判断文本是否只包含 ASCII 字符
+func isASCII(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// runeWidth 返回字符的显示宽度，只区分常见的全角字符范围
+func runeWidth(r rune) int {
+	switch {
+	case r >= 0x1100 && r <= 0x115F, // 谚文字母
+		r >= 0x2E80 && r <= 0xA4CF,   // 中日韩部首、符号、假名和统一表意文字
+		r >= 0xAC00 && r <= 0xD7A3,   // 谚文音节
+		r >= 0xF900 && r <= 0xFAFF,   // 中日韩兼容表意文字
+		r >= 0xFE30 && r <= 0xFE4F,   // 中日韩兼容形式
+		r >= 0xFF00 && r <= 0xFF60,   // 全角 ASCII
+		r >= 0xFFE0 && r <= 0xFFE6,   // 全角符号
+		r >= 0x1F300 && r <= 0x1FAFF, // emoji
+		r >= 0x20000 && r <= 0x3FFFD: // 扩展表意文字
+		return 2
+	}
+	return 1
+}
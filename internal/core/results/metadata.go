@@ -0,0 +1,25 @@
+package results
+
+import (
+	"time"
+)
+
+// Metadata 是一次查询的执行信息，随结果返回给客户端，便于估计查询成本并调整下一次查询
+// (例如结果过大时加 LIMIT 或只选择需要的列)。
+type Metadata struct {
+	DurationMs      int64 `json:"duration_ms"`      // 查询耗时 (含等待连接，不含结果编码)
+	RowsReturned    int   `json:"rows_returned"`    // 返回的结果行数
+	Columns         int   `json:"columns"`          // 结果列数
+	BytesSerialized int   `json:"bytes_serialized"` // 编码后结果内容的字节数 (约等于占用的上下文大小)
+	Truncated       bool  `json:"truncated"`        // 是否只返回了部分结果行
+}
+
+// NewMetadata 根据查询耗时和编码后的结果生成执行信息
+func NewMetadata(elapsed time.Duration, columns []string, rows []map[string]any, encoded string) Metadata {
+	return Metadata{
+		DurationMs:      elapsed.Milliseconds(),
+		RowsReturned:    len(rows),
+		Columns:         len(columns),
+		BytesSerialized: len(encoded),
+	}
+}
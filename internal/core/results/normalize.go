@@ -0,0 +1,142 @@
+package results
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// NormalizeRows 返回行的副本，其中的值都转换为稳定的 JSON 表示 (见 NormalizeValue)，不修改原来的行
+func NormalizeRows(rows []map[string]any) []map[string]any {
+	if rows == nil {
+		return nil
+	}
+	normalized := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		normalizedRow := make(map[string]any, len(row))
+		for column, value := range row {
+			normalizedRow[column] = NormalizeValue(value)
+		}
+		normalized[i] = normalizedRow
+	}
+	return normalized
+}
+
+// NormalizeValue 把 pgx 返回的值转换为稳定、可序列化的 JSON 表示:
+//
+//   - numeric 转为字符串 (保留精度，NaN 和 ±Infinity 也是字符串)，float 的 NaN/±Infinity 转为字符串
+//   - interval、time、bit 等没有 JSON 形式的类型转为 PostgreSQL 的文本形式
+//   - bytea 转为 base64 字符串，uuid 转为标准的 8-4-4-4-12 形式，macaddr 转为 xx:xx:xx:xx:xx:xx
+//   - date/timestamp 的 ±infinity 转为 "infinity" / "-infinity"
+//   - range 转为 {lower, upper, lower_inclusive, upper_inclusive} 对象 (空 range 为 {"empty": true})
+//   - 数组和 JSON 对象中的元素逐个转换
+//
+// PostGIS geometry/geography 在读取结果行时已经转换为 GeoJSON (见 ParseEWKBHex)。
+func NormalizeValue(value any) any {
+	switch v := value.(type) {
+	case nil, string, bool, int64, int32, int16:
+		return v
+	case float64:
+		return normalizeFloat(v)
+	case float32:
+		return normalizeFloat(float64(v))
+	case pgtype.Numeric:
+		return normalizeNumeric(v)
+	case pgtype.InfinityModifier:
+		return v.String()
+	case net.HardwareAddr:
+		return v.String()
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case [16]byte:
+		return FormatValue(v)
+	case pgtype.Range[any]:
+		return normalizeRange(v)
+	case pgtype.Multirange[pgtype.Range[any]]:
+		ranges := make([]any, len(v))
+		for i, r := range v {
+			ranges[i] = normalizeRange(r)
+		}
+		return ranges
+	case []any:
+		elements := make([]any, len(v))
+		for i, element := range v {
+			elements[i] = NormalizeValue(element)
+		}
+		return elements
+	case map[string]any:
+		object := make(map[string]any, len(v))
+		for key, element := range v {
+			object[key] = NormalizeValue(element)
+		}
+		return object
+	case json.Marshaler:
+		// time.Time、netip.Prefix、pgtype.Point 等已有明确的 JSON 形式
+		return v
+	case driver.Valuer:
+		// interval、time、bits、box 等: 使用 PostgreSQL 的文本形式
+		if driverValue, err := v.Value(); err == nil {
+			if _, isValuer := driverValue.(driver.Valuer); !isValuer {
+				return NormalizeValue(driverValue)
+			}
+		}
+	}
+	return value
+}
+
+// normalizeFloat 把 JSON 无法表示的 NaN 和 ±Infinity 转为与 PostgreSQL 一致的字符串
+func normalizeFloat(v float64) any {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	}
+	return v
+}
+
+// normalizeNumeric 把 numeric 转为字符串，避免客户端按 float64 解析时丢失精度
+func normalizeNumeric(v pgtype.Numeric) any {
+	switch {
+	case !v.Valid:
+		return nil
+	case v.NaN:
+		return "NaN"
+	case v.InfinityModifier == pgtype.Infinity:
+		return "Infinity"
+	case v.InfinityModifier == pgtype.NegativeInfinity:
+		return "-Infinity"
+	}
+	text, err := v.Value()
+	if err != nil {
+		return nil
+	}
+	return text
+}
+
+// normalizeRange 把 range 转为对象，无界的一端省略 lower/upper
+func normalizeRange(v pgtype.Range[any]) any {
+	if !v.Valid {
+		return nil
+	}
+	if v.LowerType == pgtype.Empty || v.UpperType == pgtype.Empty {
+		return map[string]any{"empty": true}
+	}
+	object := map[string]any{
+		"lower_inclusive": v.LowerType == pgtype.Inclusive,
+		"upper_inclusive": v.UpperType == pgtype.Inclusive,
+	}
+	if v.LowerType != pgtype.Unbounded {
+		object["lower"] = NormalizeValue(v.Lower)
+	}
+	if v.UpperType != pgtype.Unbounded {
+		object["upper"] = NormalizeValue(v.Upper)
+	}
+	return object
+}
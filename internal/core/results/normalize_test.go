@@ -0,0 +1,107 @@
+package results
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	numeric := func(value int64, exp int32) pgtype.Numeric {
+		return pgtype.Numeric{Int: big.NewInt(value), Exp: exp, Valid: true}
+	}
+	uuid := [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	mac, _ := net.ParseMAC("08:00:2b:01:02:03")
+	tests := []struct {
+		name  string
+		value any
+		want  string // NormalizeValue 结果的 JSON 编码
+	}{
+		{name: "NULL", value: nil, want: `null`},
+		{name: "文本", value: "订单", want: `"订单"`},
+		{name: "布尔", value: true, want: `true`},
+		{name: "bigint", value: int64(math.MaxInt64), want: `9223372036854775807`},
+		{name: "integer", value: int32(-7), want: `-7`},
+		{name: "smallint", value: int16(42), want: `42`},
+		{name: "double", value: 1.5, want: `1.5`},
+		{name: "real", value: float32(0.25), want: `0.25`},
+		{name: "double NaN", value: math.NaN(), want: `"NaN"`},
+		{name: "double +Infinity", value: math.Inf(1), want: `"Infinity"`},
+		{name: "real -Infinity", value: float32(math.Inf(-1)), want: `"-Infinity"`},
+
+		{name: "numeric 保留精度", value: numeric(12345678901234567, -4), want: `"1234567890123.4567"`},
+		{name: "numeric 整数", value: numeric(42, 0), want: `"42"`},
+		{name: "numeric 负数", value: numeric(-5, -1), want: `"-0.5"`},
+		{name: "numeric 正指数", value: numeric(12, 3), want: `"12000"`},
+		{name: "numeric NaN", value: pgtype.Numeric{NaN: true, Valid: true}, want: `"NaN"`},
+		{name: "numeric Infinity", value: pgtype.Numeric{InfinityModifier: pgtype.Infinity, Valid: true}, want: `"Infinity"`},
+		{name: "numeric -Infinity", value: pgtype.Numeric{InfinityModifier: pgtype.NegativeInfinity, Valid: true}, want: `"-Infinity"`},
+		{name: "numeric NULL", value: pgtype.Numeric{}, want: `null`},
+
+		{name: "interval", value: pgtype.Interval{Months: 14, Days: 3, Microseconds: 3723000000, Valid: true}, want: `"14 mon 3 day 01:02:03"`},
+		{name: "负的 interval", value: pgtype.Interval{Microseconds: -90000000, Valid: true}, want: `"-00:01:30"`},
+		{name: "interval NULL", value: pgtype.Interval{}, want: `null`},
+		{name: "time", value: pgtype.Time{Microseconds: 45296789000, Valid: true}, want: `"12:34:56.789000"`},
+		{name: "bit", value: pgtype.Bits{Bytes: []byte{0xa0}, Len: 4, Valid: true}, want: `"1010"`},
+
+		{name: "bytea 转为 base64", value: []byte{0x00, 0xff, 0x10}, want: `"AP8Q"`},
+		{name: "空 bytea", value: []byte{}, want: `""`},
+		{name: "uuid", value: uuid, want: `"12345678-9abc-def0-0123-456789abcdef"`},
+		{name: "macaddr", value: mac, want: `"08:00:2b:01:02:03"`},
+		{name: "timestamptz 保持 JSON 形式", value: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), want: `"2024-01-02T03:04:05Z"`},
+		{name: "timestamp infinity", value: pgtype.Infinity, want: `"infinity"`},
+		{name: "timestamp -infinity", value: pgtype.NegativeInfinity, want: `"-infinity"`},
+
+		{name: "数组逐个转换", value: []any{numeric(15, -1), nil, []byte("hi"), math.NaN()}, want: `["1.5",null,"aGk=","NaN"]`},
+		{name: "多维数组", value: []any{[]any{int32(1), int32(2)}, []any{int32(3), nil}}, want: `[[1,2],[3,null]]`},
+		{name: "空数组", value: []any{}, want: `[]`},
+		{name: "JSON 对象中的值", value: map[string]any{"amount": numeric(995, -2), "tags": []any{"a"}, "none": nil}, want: `{"amount":"9.95","none":null,"tags":["a"]}`},
+
+		{name: "range", value: pgtype.Range[any]{Lower: int32(1), Upper: int32(10), LowerType: pgtype.Inclusive, UpperType: pgtype.Exclusive, Valid: true}, want: `{"lower":1,"lower_inclusive":true,"upper":10,"upper_inclusive":false}`},
+		{name: "无上界的 range", value: pgtype.Range[any]{Lower: numeric(5, -1), LowerType: pgtype.Exclusive, UpperType: pgtype.Unbounded, Valid: true}, want: `{"lower":"0.5","lower_inclusive":false,"upper_inclusive":false}`},
+		{name: "空 range", value: pgtype.Range[any]{LowerType: pgtype.Empty, UpperType: pgtype.Empty, Valid: true}, want: `{"empty":true}`},
+		{name: "range NULL", value: pgtype.Range[any]{}, want: `null`},
+		{name: "multirange", value: pgtype.Multirange[pgtype.Range[any]]{
+			{Lower: int32(1), Upper: int32(2), LowerType: pgtype.Inclusive, UpperType: pgtype.Exclusive, Valid: true},
+			{Lower: int32(5), LowerType: pgtype.Inclusive, UpperType: pgtype.Unbounded, Valid: true},
+		}, want: `[{"lower":1,"lower_inclusive":true,"upper":2,"upper_inclusive":false},{"lower":5,"lower_inclusive":true,"upper_inclusive":false}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := json.Marshal(NormalizeValue(tt.value))
+			if err != nil {
+				t.Fatalf("NormalizeValue(%#v) 的结果无法序列化: %v", tt.value, err)
+			}
+			if string(encoded) != tt.want {
+				t.Errorf("NormalizeValue(%#v) = %s, want %s", tt.value, encoded, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeRows(t *testing.T) {
+	if NormalizeRows(nil) != nil {
+		t.Error("NormalizeRows(nil) 应返回 nil")
+	}
+	rows := []map[string]any{
+		{"id": int64(1), "amount": pgtype.Numeric{Int: big.NewInt(1999), Exp: -2, Valid: true}, "payload": []byte{1, 2}},
+		{"id": int64(2), "amount": pgtype.Numeric{}, "payload": nil},
+	}
+	normalized := NormalizeRows(rows)
+	encoded, err := json.Marshal(normalized)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	want := `[{"amount":"19.99","id":1,"payload":"AQI="},{"amount":null,"id":2,"payload":null}]`
+	if string(encoded) != want {
+		t.Errorf("NormalizeRows = %s, want %s", encoded, want)
+	}
+	if _, ok := rows[0]["amount"].(pgtype.Numeric); !ok {
+		t.Error("NormalizeRows 修改了原来的行")
+	}
+}
@@ -0,0 +1,131 @@
+// Package retrieval 按自然语言问题对缓存的表进行相关度排序，用于在表很多的数据库上挑选编写 SQL 所需的表。
+package retrieval
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Embedder 把文本转换为向量，相似文本的向量余弦相似度更高
+type Embedder interface {
+	// Name 返回嵌入方式的名称 (记录在结果和索引中)
+	Name() string
+	// Embed 返回每段文本的向量，所有向量维度相同
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// localDimensions 是本地嵌入的向量维度
+const localDimensions = 512
+
+// LocalEmbedder 是不依赖外部服务的本地嵌入: 把单词和字符三元组哈希到固定维度 (feature hashing)。
+// 它不理解同义词，但能匹配拼写相近的名称 (order / orders, cust_id / customer) 和中文注释中的字词。
+type LocalEmbedder struct{}
+
+// Name 实现 Embedder 接口。
+func (LocalEmbedder) Name() string { return "local" }
+
+// Embed 实现 Embedder 接口。
+func (LocalEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = localVector(text)
+	}
+	return vectors, nil
+}
+
+// localVector 计算单段文本的本地嵌入 (L2 归一化)
+func localVector(text string) []float32 {
+	vector := make([]float32, localDimensions)
+	add := func(feature string, weight float32) {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(feature))
+		sum := h.Sum32()
+		// 用哈希的最高位决定符号，减少哈希冲突带来的偏差
+		if sum&(1<<31) != 0 {
+			weight = -weight
+		}
+		vector[sum%localDimensions] += weight
+	}
+	for _, word := range Tokenize(text) {
+		add("w:"+word, 1)
+		runes := []rune("^" + word + "$")
+		for i := 0; i+3 <= len(runes); i++ {
+			add("t:"+string(runes[i:i+3]), 0.5)
+		}
+	}
+	normalize(vector)
+	return vector
+}
+
+// stopWords 是问题中常见但对定位表没有帮助的英文单词
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "of": true, "in": true, "on": true, "for": true, "to": true, "by": true,
+	"and": true, "or": true, "with": true, "from": true, "at": true, "is": true, "are": true, "was": true, "were": true,
+	"what": true, "which": true, "who": true, "how": true, "many": true, "much": true, "show": true, "list": true,
+	"get": true, "find": true, "give": true, "me": true, "all": true, "each": true, "per": true, "that": true,
+	"their": true, "has": true, "have": true, "do": true, "does": true, "did": true, "be": true, "there": true,
+}
+
+// Tokenize 把名称、注释或问题拆分为小写单词: 按非字母数字字符和下划线分隔，去掉停用词；
+// 中文等没有空格分隔的文字按单个字切分。
+func Tokenize(text string) []string {
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			word := string(current)
+			if !stopWords[word] {
+				words = append(words, word)
+			}
+			current = current[:0]
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			words = append(words, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			current = append(current, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return words
+}
+
+// Cosine 返回两个向量的余弦相似度，维度不同或有零向量时返回 0
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// normalize 把向量缩放为单位长度
+func normalize(vector []float32) {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+}
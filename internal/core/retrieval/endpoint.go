@@ -0,0 +1,105 @@
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const defaultEndpointBatchSize = 64 // 每次请求嵌入服务的文本数
+
+// EndpointEmbedder 调用兼容 OpenAI /v1/embeddings 接口的嵌入服务 (OpenAI、Azure、Ollama、vLLM 等)。
+type EndpointEmbedder struct {
+	url        string
+	model      string
+	apiKey     string
+	batchSize  int
+	httpClient *http.Client
+}
+
+// NewEndpointEmbedder 创建通过 HTTP 接口计算嵌入的 Embedder，batchSize <= 0 时使用默认值。
+func NewEndpointEmbedder(url, model, apiKey string, batchSize int, timeout time.Duration) (*EndpointEmbedder, error) {
+	if url == "" {
+		return nil, fmt.Errorf("嵌入服务地址 (EMBEDDING_ENDPOINT_URL) 不能为空")
+	}
+	if batchSize <= 0 {
+		batchSize = defaultEndpointBatchSize
+	}
+	return &EndpointEmbedder{
+		url:        url,
+		model:      model,
+		apiKey:     apiKey,
+		batchSize:  batchSize,
+		httpClient: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Name 实现 Embedder 接口，包含模型名，模型变化时持久化的索引会重新计算。
+func (e *EndpointEmbedder) Name() string {
+	return "endpoint:" + e.model
+}
+
+// Embed 实现 Embedder 接口，按 batchSize 分批请求。
+func (e *EndpointEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += e.batchSize {
+		end := min(start+e.batchSize, len(texts))
+		batch, err := e.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// embeddingResponse 是 /v1/embeddings 的响应
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *EndpointEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": e.model, "input": texts})
+	if err != nil {
+		return nil, fmt.Errorf("序列化嵌入请求失败: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建嵌入请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求嵌入服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("嵌入服务返回错误状态 %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	var parsed embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("解析嵌入服务响应失败: %w", err)
+	}
+	if len(parsed.Data) != len(texts) {
+		return nil, fmt.Errorf("嵌入服务返回了 %d 个向量，期望 %d 个", len(parsed.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, item := range parsed.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("嵌入服务返回了无效的 index %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
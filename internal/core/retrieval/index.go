@@ -0,0 +1,345 @@
+package retrieval
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/core/extensions"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// 索引中的文档种类
+const (
+	DocumentTable     = "table"     // ID 为 schema.table
+	DocumentColumn    = "column"    // ID 为 schema.table.column
+	DocumentKnowledge = "knowledge" // ID 为扩展名
+)
+
+const maxKnowledgeText = 4000 // 单个扩展知识文档的最大字符数
+
+// Document 是需要计算嵌入的一段文本
+type Document struct {
+	Kind string
+	ID   string
+	Text string
+}
+
+// Entry 是索引中的一条向量
+type Entry struct {
+	Kind   string    `json:"kind"`
+	ID     string    `json:"id"`
+	Hash   string    `json:"hash"` // 文本的哈希，文本变化时重新计算向量
+	Vector []float32 `json:"vector"`
+}
+
+// Match 是一条相似度搜索结果
+type Match struct {
+	Kind  string  `json:"kind"`
+	ID    string  `json:"id"`
+	Score float64 `json:"score"` // 余弦相似度
+}
+
+// persistedIndex 是索引持久化文件的内容
+type persistedIndex struct {
+	Embedder  string    `json:"embedder"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Entries   []*Entry  `json:"entries"`
+}
+
+// Index 是表、列和扩展知识的嵌入索引。文本未变化的文档复用已有向量，
+// path 非空时每次更新后保存到文件，重启后只需为变化的部分调用嵌入服务。
+type Index struct {
+	embedder Embedder
+	path     string
+
+	mu        sync.RWMutex
+	entries   map[string]*Entry // kind + ":" + id -> 向量
+	updatedAt time.Time
+}
+
+// NewIndex 创建嵌入索引，path 非空时从文件加载已保存的向量 (嵌入方式不同时丢弃)。
+func NewIndex(embedder Embedder, path string) *Index {
+	ix := &Index{embedder: embedder, path: path, entries: make(map[string]*Entry)}
+	if path != "" {
+		if err := ix.load(); err != nil {
+			utils.DefaultLogger.Warn("加载已保存的嵌入索引失败，将重新计算", zap.String("path", path), zap.Error(err))
+		}
+	}
+	return ix
+}
+
+// Embedder 返回索引使用的嵌入方式
+func (ix *Index) Embedder() Embedder {
+	return ix.embedder
+}
+
+// Update 使索引与 docs 一致: 为新增或文本变化的文档计算向量，删除不再存在的文档。
+// 返回重新计算的文档数。
+func (ix *Index) Update(ctx context.Context, docs []Document) (int, error) {
+	ix.mu.RLock()
+	var stale []Document
+	var staleHashes []string
+	for _, doc := range docs {
+		hash := textHash(doc.Text)
+		if entry, ok := ix.entries[doc.Kind+":"+doc.ID]; !ok || entry.Hash != hash {
+			stale = append(stale, doc)
+			staleHashes = append(staleHashes, hash)
+		}
+	}
+	removed := len(ix.entries) - (len(docs) - len(stale))
+	ix.mu.RUnlock()
+	if len(stale) == 0 && removed == 0 {
+		return 0, nil
+	}
+
+	texts := make([]string, len(stale))
+	for i, doc := range stale {
+		texts[i] = doc.Text
+	}
+	vectors, err := ix.embedder.Embed(ctx, texts)
+	if err != nil {
+		return 0, fmt.Errorf("计算嵌入向量失败: %w", err)
+	}
+	if len(vectors) != len(stale) {
+		return 0, fmt.Errorf("嵌入服务返回了 %d 个向量，期望 %d 个", len(vectors), len(stale))
+	}
+
+	ix.mu.Lock()
+	entries := make(map[string]*Entry, len(docs))
+	for _, doc := range docs {
+		key := doc.Kind + ":" + doc.ID
+		if entry, ok := ix.entries[key]; ok {
+			entries[key] = entry
+		}
+	}
+	for i, doc := range stale {
+		entries[doc.Kind+":"+doc.ID] = &Entry{Kind: doc.Kind, ID: doc.ID, Hash: staleHashes[i], Vector: vectors[i]}
+	}
+	ix.entries = entries
+	ix.updatedAt = time.Now()
+	state := ix.snapshot()
+	ix.mu.Unlock()
+
+	utils.DefaultLogger.Info("嵌入索引已更新", zap.String("embedder", ix.embedder.Name()), zap.Int("documents", len(docs)), zap.Int("embedded", len(stale)))
+	if ix.path != "" {
+		ix.save(state)
+	}
+	return len(stale), nil
+}
+
+// Vector 返回文档的向量
+func (ix *Index) Vector(kind, id string) ([]float32, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	entry, ok := ix.entries[kind+":"+id]
+	if !ok {
+		return nil, false
+	}
+	return entry.Vector, true
+}
+
+// Entries 返回索引中所有向量 (按种类和 ID 排序)
+func (ix *Index) Entries() []*Entry {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.snapshot().Entries
+}
+
+// Search 返回与 query 最相似的 limit 个文档，kinds 为空时搜索所有种类
+func (ix *Index) Search(ctx context.Context, query string, kinds []string, limit int) ([]Match, error) {
+	embedded, err := ix.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("计算查询的嵌入向量失败: %w", err)
+	}
+	wantKinds := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		wantKinds[kind] = true
+	}
+
+	ix.mu.RLock()
+	matches := []Match{}
+	for _, entry := range ix.entries {
+		if len(wantKinds) > 0 && !wantKinds[entry.Kind] {
+			continue
+		}
+		if score := Cosine(embedded[0], entry.Vector); score > 0 {
+			matches = append(matches, Match{Kind: entry.Kind, ID: entry.ID, Score: score})
+		}
+	}
+	ix.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// snapshot 返回待持久化的索引内容，调用方需持有锁
+func (ix *Index) snapshot() *persistedIndex {
+	state := &persistedIndex{Embedder: ix.embedder.Name(), UpdatedAt: ix.updatedAt, Entries: make([]*Entry, 0, len(ix.entries))}
+	for _, entry := range ix.entries {
+		state.Entries = append(state.Entries, entry)
+	}
+	sort.Slice(state.Entries, func(i, j int) bool {
+		if state.Entries[i].Kind != state.Entries[j].Kind {
+			return state.Entries[i].Kind < state.Entries[j].Kind
+		}
+		return state.Entries[i].ID < state.Entries[j].ID
+	})
+	return state
+}
+
+func (ix *Index) load() error {
+	data, err := os.ReadFile(ix.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	state := new(persistedIndex)
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("解析嵌入索引文件失败: %w", err)
+	}
+	if state.Embedder != ix.embedder.Name() {
+		utils.DefaultLogger.Info("嵌入方式已变化，忽略已保存的嵌入索引", zap.String("saved", state.Embedder), zap.String("current", ix.embedder.Name()))
+		return nil
+	}
+	for _, entry := range state.Entries {
+		ix.entries[entry.Kind+":"+entry.ID] = entry
+	}
+	ix.updatedAt = state.UpdatedAt
+	utils.DefaultLogger.Info("已加载嵌入索引", zap.String("path", ix.path), zap.Int("entries", len(ix.entries)))
+	return nil
+}
+
+// save 将索引写入临时文件后重命名，避免写入中断导致文件损坏
+func (ix *Index) save(state *persistedIndex) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		utils.DefaultLogger.Error("序列化嵌入索引失败", zap.Error(err))
+		return
+	}
+	if dir := filepath.Dir(ix.path); dir != "" {
+		_ = os.MkdirAll(dir, 0o755)
+	}
+	tmpPath := ix.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		utils.DefaultLogger.Warn("保存嵌入索引失败", zap.String("path", ix.path), zap.Error(err))
+		return
+	}
+	if err := os.Rename(tmpPath, ix.path); err != nil {
+		utils.DefaultLogger.Warn("保存嵌入索引失败", zap.String("path", ix.path), zap.Error(err))
+	}
+}
+
+func textHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// SchemaDocuments 返回 Schema 快照中所有表和列的文档
+func SchemaDocuments(dbInfo *schemas.DatabaseInfo) []Document {
+	var docs []Document
+	for _, schema := range dbInfo.Schemas {
+		for i := range schema.Tables {
+			table := &schema.Tables[i]
+			tableID := schema.Name + "." + table.Name
+			docs = append(docs, Document{Kind: DocumentTable, ID: tableID, Text: TableDocument(table)})
+			for _, column := range table.Columns {
+				text := table.Name + " " + column.Name
+				if column.Description != "" {
+					text += ": " + column.Description
+				}
+				docs = append(docs, Document{Kind: DocumentColumn, ID: tableID + "." + column.Name, Text: text})
+			}
+		}
+	}
+	return docs
+}
+
+// KnowledgeDocuments 返回每个扩展知识的文档: 扩展名和知识中的所有文本
+func KnowledgeDocuments(knowledge map[string]extensions.KnowledgeData) []Document {
+	names := make([]string, 0, len(knowledge))
+	for name := range knowledge {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	docs := make([]Document, 0, len(names))
+	for _, name := range names {
+		var b strings.Builder
+		b.WriteString(name)
+		collectKnowledgeText(&b, knowledge[name])
+		text := b.String()
+		if len(text) > maxKnowledgeText {
+			text = strings.ToValidUTF8(text[:maxKnowledgeText], "")
+		}
+		docs = append(docs, Document{Kind: DocumentKnowledge, ID: name, Text: text})
+	}
+	return docs
+}
+
+// collectKnowledgeText 按文件中的字段顺序收集知识中的文本，空字段跳过
+func collectKnowledgeText(b *strings.Builder, knowledge extensions.KnowledgeData) {
+	texts := []string{knowledge.Description}
+	for _, items := range [][]extensions.KnowledgeItem{knowledge.DataTypes, knowledge.Operators, knowledge.Functions} {
+		for _, item := range items {
+			texts = append(texts, item.Name, item.Symbol, item.Description, item.Example, item.Notes)
+		}
+	}
+	for _, example := range knowledge.Examples {
+		texts = append(texts, example.Name, example.Description, example.Query)
+	}
+	texts = append(texts, knowledge.BestPractices...)
+	for _, rule := range knowledge.PlanAdvice {
+		texts = append(texts, rule.Advice)
+	}
+	for _, text := range texts {
+		if b.Len() >= maxKnowledgeText {
+			return
+		}
+		if text != "" {
+			b.WriteString("\n")
+			b.WriteString(text)
+		}
+	}
+}
+
+// OpenIndex 按配置创建嵌入索引；SCHEMA_RETRIEVAL_EMBEDDINGS=off 时返回 nil。
+func OpenIndex(cfg *config.Config) (*Index, error) {
+	var embedder Embedder
+	switch cfg.SchemaRetrievalEmbeddings {
+	case "off", "":
+		return nil, nil
+	case "local":
+		embedder = LocalEmbedder{}
+	case "endpoint":
+		endpoint, err := NewEndpointEmbedder(cfg.EmbeddingEndpointURL, cfg.EmbeddingModel, cfg.EmbeddingAPIKey, cfg.EmbeddingBatchSize, cfg.EmbeddingTimeout)
+		if err != nil {
+			return nil, err
+		}
+		embedder = endpoint
+	default:
+		return nil, fmt.Errorf("无效的 SCHEMA_RETRIEVAL_EMBEDDINGS '%s' (可选 local, endpoint, off)", cfg.SchemaRetrievalEmbeddings)
+	}
+	utils.DefaultLogger.Info("Schema 嵌入索引已启用", zap.String("embedder", embedder.Name()), zap.String("file", cfg.EmbeddingIndexFile))
+	return NewIndex(embedder, cfg.EmbeddingIndexFile), nil
+}
@@ -0,0 +1,292 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/extensions"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+)
+
+// 关键字匹配的得分 (每个问题单词累加)
+const (
+	scoreTableWord   = 3.0 // 表名中的某个单词与问题单词相同
+	scoreTablePart   = 1.5 // 表名包含问题单词
+	scoreTableDesc   = 1.0 // 表注释包含问题单词
+	scoreColumnWord  = 1.0 // 列名中的某个单词与问题单词相同
+	scoreColumnDesc  = 0.5 // 列注释包含问题单词
+	maxColumnMatches = 3   // 每个问题单词最多计入的匹配列数，避免宽表占优
+)
+
+// 关键字得分和语义得分在综合得分中的权重
+const (
+	keywordWeight  = 0.6
+	semanticWeight = 0.4
+)
+
+// TableScore 是一张表与问题的相关度
+type TableScore struct {
+	Schema         string   `json:"schema"`
+	Table          string   `json:"table"`
+	Score          float64  `json:"score"`                     // 综合得分 (0-1)
+	KeywordScore   float64  `json:"keyword_score"`             // 关键字得分 (按本次结果中的最高分归一化)
+	SemanticScore  float64  `json:"semantic_score,omitempty"`  // 嵌入向量的余弦相似度 (未启用嵌入时为 0)
+	MatchedColumns []string `json:"matched_columns,omitempty"` // 与问题单词匹配的列
+}
+
+// RankOptions 是排序的可选条件
+type RankOptions struct {
+	Schema string // 只在该 Schema 中排序，为空时包含全部
+	TopK   int    // 返回的表数
+}
+
+// 语义得分中表文档与最相似列的权重
+const (
+	tableSimilarityWeight  = 0.7
+	columnSimilarityWeight = 0.3
+)
+
+// Ranker 按问题对缓存中的表排序。Schema 重新加载后在下一次排序时增量更新嵌入索引。
+type Ranker struct {
+	schemaManager schemas.Manager
+	extManager    extensions.Manager
+	index         *Index // 为 nil 时只使用关键字得分
+
+	mu        sync.Mutex
+	indexedOf *schemas.DatabaseInfo // 索引对应的 Schema 快照
+}
+
+// NewRanker 创建 Ranker，index 为 nil 时只按关键字排序。
+func NewRanker(schemaManager schemas.Manager, extManager extensions.Manager, index *Index) *Ranker {
+	return &Ranker{schemaManager: schemaManager, extManager: extManager, index: index}
+}
+
+// EmbedderName 返回使用的嵌入方式，未启用时为空
+func (r *Ranker) EmbedderName() string {
+	if r.index == nil {
+		return ""
+	}
+	return r.index.Embedder().Name()
+}
+
+// Index 返回嵌入索引，未启用时为 nil
+func (r *Ranker) Index() *Index {
+	return r.index
+}
+
+// Rank 返回与问题最相关的 TopK 张表 (按综合得分降序，得分为 0 的表不返回)
+func (r *Ranker) Rank(ctx context.Context, question string, options RankOptions) ([]TableScore, error) {
+	terms := uniqueTerms(Tokenize(question))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("问题中没有可用于匹配的单词")
+	}
+	dbInfo, found := r.schemaManager.GetDatabaseInfo()
+	if !found || dbInfo == nil {
+		return nil, fmt.Errorf("Schema 信息尚未加载")
+	}
+
+	var questionVector []float32
+	if r.index != nil {
+		if err := r.EnsureIndex(ctx); err != nil {
+			return nil, err
+		}
+		embedded, err := r.index.Embedder().Embed(ctx, []string{question})
+		if err != nil {
+			return nil, fmt.Errorf("计算问题的嵌入向量失败: %w", err)
+		}
+		questionVector = embedded[0]
+	}
+
+	scores := []TableScore{}
+	maxKeyword := 0.0
+	for _, schema := range dbInfo.Schemas {
+		if options.Schema != "" && schema.Name != options.Schema {
+			continue
+		}
+		for i := range schema.Tables {
+			table := &schema.Tables[i]
+			keyword, columns := keywordScore(terms, table)
+			score := TableScore{Schema: schema.Name, Table: table.Name, KeywordScore: keyword, MatchedColumns: columns}
+			if questionVector != nil {
+				score.SemanticScore = r.semanticScore(questionVector, schema.Name, table)
+			}
+			if score.KeywordScore == 0 && score.SemanticScore == 0 {
+				continue
+			}
+			maxKeyword = max(maxKeyword, keyword)
+			scores = append(scores, score)
+		}
+	}
+
+	for i := range scores {
+		if maxKeyword > 0 {
+			scores[i].KeywordScore /= maxKeyword
+		}
+		if questionVector != nil {
+			scores[i].Score = keywordWeight*scores[i].KeywordScore + semanticWeight*scores[i].SemanticScore
+		} else {
+			scores[i].Score = scores[i].KeywordScore
+		}
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Schema+"."+scores[i].Table < scores[j].Schema+"."+scores[j].Table
+	})
+	if options.TopK > 0 && len(scores) > options.TopK {
+		scores = scores[:options.TopK]
+	}
+	return scores, nil
+}
+
+// semanticScore 返回表文档和表中最相似列与问题的加权相似度
+func (r *Ranker) semanticScore(questionVector []float32, schemaName string, table *schemas.TableInfo) float64 {
+	tableID := schemaName + "." + table.Name
+	var tableSimilarity, columnSimilarity float64
+	if vector, ok := r.index.Vector(DocumentTable, tableID); ok {
+		tableSimilarity = Cosine(questionVector, vector)
+	}
+	for _, column := range table.Columns {
+		if vector, ok := r.index.Vector(DocumentColumn, tableID+"."+column.Name); ok {
+			columnSimilarity = max(columnSimilarity, Cosine(questionVector, vector))
+		}
+	}
+	return max(tableSimilarityWeight*tableSimilarity+columnSimilarityWeight*columnSimilarity, 0)
+}
+
+// Knowledge 返回与问题最相关的扩展知识 (未启用嵌入索引时为空)
+func (r *Ranker) Knowledge(ctx context.Context, question string, limit int) ([]Match, error) {
+	if r.index == nil {
+		return nil, nil
+	}
+	if err := r.EnsureIndex(ctx); err != nil {
+		return nil, err
+	}
+	return r.index.Search(ctx, question, []string{DocumentKnowledge}, limit)
+}
+
+// EnsureIndex 在 Schema 快照变化后更新嵌入索引 (表、列和扩展知识)，未变化的文档复用已有向量
+func (r *Ranker) EnsureIndex(ctx context.Context) error {
+	if r.index == nil {
+		return fmt.Errorf("未启用嵌入索引 (SCHEMA_RETRIEVAL_EMBEDDINGS=off)")
+	}
+	dbInfo, found := r.schemaManager.GetDatabaseInfo()
+	if !found || dbInfo == nil {
+		return fmt.Errorf("Schema 信息尚未加载")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.indexedOf == dbInfo {
+		return nil
+	}
+	docs := SchemaDocuments(dbInfo)
+	if r.extManager != nil {
+		docs = append(docs, KnowledgeDocuments(r.extManager.AllKnowledge())...)
+	}
+	if _, err := r.index.Update(ctx, docs); err != nil {
+		return fmt.Errorf("更新嵌入索引失败: %w", err)
+	}
+	r.indexedOf = dbInfo
+	return nil
+}
+
+// TableDocument 返回用于计算表嵌入的文本: 表名、表注释以及列名和列注释
+func TableDocument(table *schemas.TableInfo) string {
+	var b strings.Builder
+	b.WriteString(table.Name)
+	if table.Description != "" {
+		b.WriteString(": ")
+		b.WriteString(table.Description)
+	}
+	for _, column := range table.Columns {
+		b.WriteString("\n")
+		b.WriteString(column.Name)
+		if column.Description != "" {
+			b.WriteString(" ")
+			b.WriteString(column.Description)
+		}
+	}
+	return b.String()
+}
+
+// keywordScore 返回表的关键字得分和匹配的列
+func keywordScore(terms []string, table *schemas.TableInfo) (float64, []string) {
+	tableWords := wordSet(table.Name)
+	tableName := strings.ToLower(table.Name)
+	tableDesc := strings.ToLower(table.Description)
+	var matched []string
+	seen := make(map[string]bool)
+	score := 0.0
+	for _, term := range terms {
+		switch {
+		case tableWords[term]:
+			score += scoreTableWord
+		case len(term) > 2 && strings.Contains(tableName, term):
+			score += scoreTablePart
+		}
+		if tableDesc != "" && strings.Contains(tableDesc, term) {
+			score += scoreTableDesc
+		}
+		columnMatches := 0
+		for _, column := range table.Columns {
+			if columnMatches >= maxColumnMatches {
+				break
+			}
+			columnScore := 0.0
+			if wordSet(column.Name)[term] {
+				columnScore = scoreColumnWord
+			} else if column.Description != "" && strings.Contains(strings.ToLower(column.Description), term) {
+				columnScore = scoreColumnDesc
+			}
+			if columnScore == 0 {
+				continue
+			}
+			score += columnScore
+			columnMatches++
+			if !seen[column.Name] {
+				seen[column.Name] = true
+				matched = append(matched, column.Name)
+			}
+		}
+	}
+	return score, matched
+}
+
+// wordSet 返回名称拆分后的单词集合 (同时包含去掉复数后缀的形式)
+func wordSet(name string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range Tokenize(name) {
+		words[word] = true
+		words[singular(word)] = true
+	}
+	return words
+}
+
+// uniqueTerms 对问题单词去重并转换为单数形式
+func uniqueTerms(words []string) []string {
+	seen := make(map[string]bool, len(words))
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		word = singular(word)
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// singular 去掉常见的英文复数后缀 (orders -> order, categories -> category)
+func singular(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss"):
+		return word[:len(word)-1]
+	}
+	return word
+}
@@ -0,0 +1,169 @@
+package schemas
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+// tableConstraintDef 是从 pg_constraint 读取的表级约束定义
+type tableConstraintDef struct {
+	name       string
+	definition string
+}
+
+// GetTableDDL 实现 Manager 接口。
+func (m *manager) GetTableDDL(ctx context.Context, connID, schemaName, tableName string) (string, error) {
+	table, found := m.GetTableInfo(schemaName, tableName)
+	if !found {
+		return "", fmt.Errorf("表 '%s.%s' 不在 Schema 缓存中", schemaName, tableName)
+	}
+
+	// 约束优先使用 pg_get_constraintdef 的权威定义；查询失败时退回到缓存中的主键/唯一/外键信息
+	constraints, err := m.fetchConstraintDefinitions(ctx, connID, schemaName, tableName)
+	if err != nil {
+		utils.DefaultLogger.Warn("获取约束定义失败，使用缓存的约束信息生成 DDL",
+			zap.String("schema", schemaName), zap.String("table", tableName), zap.Error(err))
+		if constraints, err = cachedConstraintDefinitions(table); err != nil {
+			return "", err
+		}
+	}
+	return buildTableDDL(schemaName, table, constraints)
+}
+
+// fetchConstraintDefinitions 按 PRIMARY KEY, UNIQUE, CHECK, EXCLUDE, FOREIGN KEY 的顺序获取表级约束定义
+func (m *manager) fetchConstraintDefinitions(ctx context.Context, connID, schemaName, tableName string) ([]tableConstraintDef, error) {
+	query := `
+        SELECT c.conname::text AS name, pg_get_constraintdef(c.oid, true) AS definition
+        FROM pg_constraint c
+        JOIN pg_class t ON t.oid = c.conrelid
+        JOIN pg_namespace n ON n.oid = t.relnamespace
+        WHERE n.nspname = $1 AND t.relname = $2 AND c.contype IN ('p', 'u', 'c', 'x', 'f')
+        ORDER BY array_position(ARRAY['p', 'u', 'c', 'x', 'f'], c.contype::text), c.conname
+    `
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	constraints := make([]tableConstraintDef, 0, len(rows))
+	for _, row := range rows {
+		constraints = append(constraints, tableConstraintDef{name: dbString(row["name"]), definition: dbString(row["definition"])})
+	}
+	return constraints, nil
+}
+
+// cachedConstraintDefinitions 根据缓存的索引和外键信息近似重建约束 (CHECK 约束无法还原)
+func cachedConstraintDefinitions(table *TableInfo) ([]tableConstraintDef, error) {
+	var constraints []tableConstraintDef
+	for _, idx := range table.Indexes {
+		if idx.IsPrimary {
+			columns, err := quoteIdentifierList(idx.Columns)
+			if err != nil {
+				return nil, err
+			}
+			constraints = append(constraints, tableConstraintDef{name: idx.IndexName, definition: "PRIMARY KEY (" + columns + ")"})
+		}
+	}
+	for _, fk := range table.ForeignKeys {
+		columns, err := quoteIdentifierList(fk.Columns)
+		if err != nil {
+			return nil, err
+		}
+		referenced, err := sqlsafe.QuoteQualified(fk.ReferencedSchema, fk.ReferencedTable)
+		if err != nil {
+			return nil, err
+		}
+		referencedColumns, err := quoteIdentifierList(fk.ReferencedColumns)
+		if err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, tableConstraintDef{
+			name:       fk.ConstraintName,
+			definition: fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s(%s)", columns, referenced, referencedColumns),
+		})
+	}
+	return constraints, nil
+}
+
+// buildTableDDL 拼接 CREATE TABLE、非约束索引、触发器和注释
+func buildTableDDL(schemaName string, table *TableInfo, constraints []tableConstraintDef) (string, error) {
+	qualifiedName, err := sqlsafe.QuoteQualified(schemaName, table.Name)
+	if err != nil {
+		return "", err
+	}
+	columnNames := make([]string, len(table.Columns))
+	for i, col := range table.Columns {
+		columnNames[i] = col.Name
+	}
+	columns, err := sqlsafe.QuoteIdentifiers(columnNames)
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, 0, len(table.Columns)+len(constraints))
+	for i, col := range table.Columns {
+		line := "    " + columns[i] + " " + col.Type
+		if col.DefaultValue != nil {
+			line += " DEFAULT " + *col.DefaultValue
+		}
+		if !col.IsNullable {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line)
+	}
+	constraintNames := make(map[string]bool, len(constraints))
+	for _, constraint := range constraints {
+		constraintNames[constraint.name] = true
+		name, err := sqlsafe.QuoteIdentifier(constraint.name)
+		if err != nil {
+			return "", fmt.Errorf("无效的约束名: %w", err)
+		}
+		lines = append(lines, "    CONSTRAINT "+name+" "+constraint.definition)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("CREATE TABLE " + qualifiedName + " (\n")
+	sb.WriteString(strings.Join(lines, ",\n"))
+	sb.WriteString("\n);\n")
+
+	// 主键/唯一约束的索引已经由约束隐式创建，不再重复输出
+	for _, idx := range table.Indexes {
+		if idx.IsPrimary || constraintNames[idx.IndexName] || idx.IndexDefinition == "" {
+			continue
+		}
+		sb.WriteString("\n" + idx.IndexDefinition + ";")
+	}
+	for _, trigger := range table.Triggers {
+		if trigger.Definition == "" {
+			continue
+		}
+		sb.WriteString("\n" + trigger.Definition + ";")
+	}
+	if len(table.Indexes) > 0 || len(table.Triggers) > 0 {
+		sb.WriteString("\n")
+	}
+
+	if table.Description != "" {
+		sb.WriteString(fmt.Sprintf("\nCOMMENT ON TABLE %s IS %s;", qualifiedName, utils.QuoteLiteral(table.Description)))
+	}
+	for i, col := range table.Columns {
+		if col.Description == "" {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\nCOMMENT ON COLUMN %s.%s IS %s;", qualifiedName, columns[i], utils.QuoteLiteral(col.Description)))
+	}
+	return strings.TrimRight(sb.String(), "\n") + "\n", nil
+}
+
+// quoteIdentifierList 校验、引用并用逗号连接标识符列表
+func quoteIdentifierList(names []string) (string, error) {
+	quoted, err := sqlsafe.QuoteIdentifiers(names)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(quoted, ", "), nil
+}
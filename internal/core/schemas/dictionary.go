@@ -0,0 +1,241 @@
+package schemas
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dictionaryEscaper 转义 Markdown 表格单元格中的管道符和换行
+var dictionaryEscaper = strings.NewReplacer("|", "\\|", "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+// RenderDataDictionary 根据缓存的元数据生成 schema 的数据字典 (Markdown):
+// 表的注释、大致行数、列 (类型, 可空, 默认值, 键, 注释)、外键和被引用关系、索引，以及视图、自定义类型和函数。
+// info 用于查找其他 Schema 中引用本 Schema 表的外键。
+func RenderDataDictionary(info *DatabaseInfo, schema *SchemaInfo) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Data dictionary: %s\n\n", schema.Name))
+	if schema.Description != "" {
+		sb.WriteString(schema.Description + "\n\n")
+	}
+	sb.WriteString(fmt.Sprintf("%d tables, %d views, %d types, %d functions.\n", len(schema.Tables), len(schema.Views), len(schema.Types), len(schema.Functions)))
+
+	if len(schema.Tables) > 0 {
+		sb.WriteString("\n## Tables\n\n")
+		for _, table := range schema.Tables {
+			line := fmt.Sprintf("- [%s](#%s) (~%d rows)", table.Name, dictionaryAnchor(table.Name), table.RowCount)
+			if table.Description != "" {
+				line += " — " + firstLine(table.Description)
+			}
+			sb.WriteString(line + "\n")
+		}
+	}
+
+	referencedBy := incomingForeignKeys(info, schema.Name)
+	for _, table := range schema.Tables {
+		renderDictionaryTable(&sb, schema.Name, table, referencedBy[table.Name])
+	}
+
+	if len(schema.Views) > 0 {
+		sb.WriteString("\n## Views\n")
+		aggregates := make(map[string]ContinuousAggregateInfo, len(schema.ContinuousAggregates))
+		for _, aggregate := range schema.ContinuousAggregates {
+			aggregates[aggregate.Name] = aggregate
+		}
+		for _, view := range schema.Views {
+			kind := "view"
+			if aggregate, ok := aggregates[view.Name]; ok {
+				kind = "continuous aggregate on " + aggregate.HypertableSchema + "." + aggregate.HypertableName
+			} else if view.Materialized {
+				kind = "materialized view"
+			}
+			sb.WriteString(fmt.Sprintf("\n### %s (%s)\n\n", view.Name, kind))
+			if view.Description != "" {
+				sb.WriteString(view.Description + "\n\n")
+			}
+			sb.WriteString("| Column | Type | Derived from |\n|---|---|---|\n")
+			for _, col := range view.Columns {
+				sources := make([]string, 0, len(col.Sources))
+				for _, source := range col.Sources {
+					sources = append(sources, source.Schema+"."+source.Table+"."+source.Column)
+				}
+				derived := strings.Join(sources, ", ")
+				if col.Expression != "" {
+					derived = strings.TrimSpace("`" + col.Expression + "` " + derived)
+				}
+				sb.WriteString(dictionaryRow(col.Name, col.Type, derived))
+			}
+		}
+	}
+
+	if len(schema.Types) > 0 {
+		sb.WriteString("\n## Types\n\n| Type | Kind | Definition | Description |\n|---|---|---|---|\n")
+		for _, typeInfo := range schema.Types {
+			var definition string
+			switch typeInfo.Kind {
+			case EnumType:
+				definition = strings.Join(typeInfo.EnumLabels, ", ")
+			case CompositeType:
+				attributes := make([]string, 0, len(typeInfo.Attributes))
+				for _, attr := range typeInfo.Attributes {
+					attributes = append(attributes, attr.Name+" "+attr.Type)
+				}
+				definition = strings.Join(attributes, ", ")
+			case DomainType:
+				definition = strings.Join(append([]string{typeInfo.BaseType}, typeInfo.Checks...), " ")
+			}
+			sb.WriteString(dictionaryRow(typeInfo.Name, typeInfo.Kind, definition, typeInfo.Description))
+		}
+	}
+
+	if len(schema.Functions) > 0 {
+		sb.WriteString("\n## Functions\n\n| Function | Kind | Returns | Description |\n|---|---|---|---|\n")
+		for _, fn := range schema.Functions {
+			sb.WriteString(dictionaryRow(fn.Name+"("+fn.Arguments+")", fn.Kind, fn.ReturnType, fn.Description))
+		}
+	}
+	return sb.String()
+}
+
+// renderDictionaryTable 渲染一张表的章节
+func renderDictionaryTable(sb *strings.Builder, schemaName string, table TableInfo, referencedBy []string) {
+	sb.WriteString(fmt.Sprintf("\n## %s\n\n", table.Name))
+	if table.Description != "" {
+		sb.WriteString(table.Description + "\n\n")
+	}
+	sb.WriteString(fmt.Sprintf("Approximately %d rows.", table.RowCount))
+	if table.Temporal != nil {
+		if table.Temporal.IsHistoryOf != "" {
+			sb.WriteString(fmt.Sprintf(" History table of `%s.%s`.", schemaName, table.Temporal.IsHistoryOf))
+		} else if table.Temporal.HistoryTable != "" {
+			sb.WriteString(fmt.Sprintf(" History is kept in `%s.%s`.", table.Temporal.HistorySchema, table.Temporal.HistoryTable))
+		}
+	}
+	if hypertable := table.Hypertable; hypertable != nil {
+		sb.WriteString(fmt.Sprintf(" TimescaleDB hypertable partitioned by `%s` (chunk interval %s, %d chunks).", hypertable.TimeColumn, hypertable.ChunkInterval, hypertable.NumChunks))
+		if hypertable.CompressAfter != "" {
+			sb.WriteString(fmt.Sprintf(" Chunks older than %s are compressed.", hypertable.CompressAfter))
+		}
+		if hypertable.RetentionDropAfter != "" {
+			sb.WriteString(fmt.Sprintf(" Chunks older than %s are dropped.", hypertable.RetentionDropAfter))
+		}
+	}
+	sb.WriteString("\n\n")
+
+	fkTargets := make(map[string]string)
+	for _, fk := range table.ForeignKeys {
+		for i, col := range fk.Columns {
+			if i < len(fk.ReferencedColumns) {
+				fkTargets[col] = fk.ReferencedSchema + "." + fk.ReferencedTable + "." + fk.ReferencedColumns[i]
+			}
+		}
+	}
+	sb.WriteString("| Column | Type | Nullable | Default | Key | Description |\n|---|---|---|---|---|---|\n")
+	for _, col := range table.Columns {
+		var keys []string
+		for _, constraint := range col.Constraints {
+			switch constraint {
+			case PrimaryKeyConstraint:
+				keys = append(keys, "PK")
+			case UniqueConstraint:
+				keys = append(keys, "UQ")
+			}
+		}
+		if target, ok := fkTargets[col.Name]; ok {
+			keys = append(keys, "FK → "+target)
+		}
+		nullable := "NO"
+		if col.IsNullable {
+			nullable = "YES"
+		}
+		var defaultValue string
+		if col.DefaultValue != nil {
+			defaultValue = "`" + *col.DefaultValue + "`"
+		}
+		description := col.Description
+		if col.Masked != "" {
+			description = strings.TrimSpace(description + fmt.Sprintf(" (masked: %s)", col.Masked))
+		}
+		sb.WriteString(dictionaryRow(col.Name, col.Type, nullable, defaultValue, strings.Join(keys, ", "), description))
+	}
+
+	if len(table.ForeignKeys) > 0 {
+		sb.WriteString("\n**Foreign keys**\n\n")
+		for _, fk := range table.ForeignKeys {
+			line := fmt.Sprintf("- `%s`: (%s) → %s.%s (%s)", fk.ConstraintName, strings.Join(fk.Columns, ", "),
+				fk.ReferencedSchema, fk.ReferencedTable, strings.Join(fk.ReferencedColumns, ", "))
+			if fk.Description != "" {
+				line += " — " + firstLine(fk.Description)
+			}
+			sb.WriteString(line + "\n")
+		}
+	}
+	if len(referencedBy) > 0 {
+		sb.WriteString("\n**Referenced by**\n\n")
+		for _, ref := range referencedBy {
+			sb.WriteString("- " + ref + "\n")
+		}
+	}
+	if len(table.Indexes) > 0 {
+		sb.WriteString("\n**Indexes**\n\n")
+		for _, idx := range table.Indexes {
+			var markers []string
+			if idx.IsPrimary {
+				markers = append(markers, "primary")
+			} else if idx.IsUnique {
+				markers = append(markers, "unique")
+			}
+			markers = append(markers, idx.IndexType)
+			sb.WriteString(fmt.Sprintf("- `%s` (%s): %s\n", idx.IndexName, strings.Join(markers, ", "), strings.Join(idx.Columns, ", ")))
+		}
+	}
+}
+
+// incomingForeignKeys 返回引用 schemaName 下各表的外键: 表名 -> "schema.table (columns) via constraint"
+func incomingForeignKeys(info *DatabaseInfo, schemaName string) map[string][]string {
+	referencedBy := make(map[string][]string)
+	if info == nil {
+		return referencedBy
+	}
+	for _, schema := range info.Schemas {
+		for _, table := range schema.Tables {
+			for _, fk := range table.ForeignKeys {
+				if fk.ReferencedSchema != schemaName {
+					continue
+				}
+				referencedBy[fk.ReferencedTable] = append(referencedBy[fk.ReferencedTable],
+					fmt.Sprintf("%s.%s (%s) via `%s`", schema.Name, table.Name, strings.Join(fk.Columns, ", "), fk.ConstraintName))
+			}
+		}
+	}
+	return referencedBy
+}
+
+// dictionaryRow 渲染一行 Markdown 表格
+func dictionaryRow(cells ...string) string {
+	for i, cell := range cells {
+		cells[i] = dictionaryEscaper.Replace(cell)
+	}
+	return "| " + strings.Join(cells, " | ") + " |\n"
+}
+
+// dictionaryAnchor 返回 GitHub 风格的标题锚点: 小写，空格换成连字符，去掉其他标点
+func dictionaryAnchor(title string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r == ' ':
+			sb.WriteRune('-')
+		case r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r > 127:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// firstLine 返回多行注释的第一行，用于列表项
+func firstLine(text string) string {
+	if i := strings.IndexAny(text, "\r\n"); i >= 0 {
+		return strings.TrimSpace(text[:i]) + " …"
+	}
+	return text
+}
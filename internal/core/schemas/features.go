@@ -0,0 +1,91 @@
+package schemas
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// GetFeatures 实现 Manager 接口。
+func (m *manager) GetFeatures(ctx context.Context, connID string) (*FeatureInfo, error) {
+	m.featuresMu.Lock()
+	cached, ok := m.features[connID]
+	m.featuresMu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	features, err := m.fetchFeatures(ctx, connID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.featuresMu.Lock()
+	m.features[connID] = features
+	m.featuresMu.Unlock()
+	utils.DefaultLogger.Info("数据库特性检测完成",
+		zap.String("connID", connID), zap.String("pgVersion", features.PgVersion),
+		zap.Bool("postgis", features.HasPostGIS), zap.Bool("pgvector", features.HasPGVector),
+		zap.Bool("timescale", features.HasTimescale), zap.Bool("readOnly", features.ReadOnly))
+	return features, nil
+}
+
+// fetchFeatures 查询服务端版本、当前角色、已安装扩展，并判断当前角色是否实际只读。
+func (m *manager) fetchFeatures(ctx context.Context, connID string) (*FeatureInfo, error) {
+	query := `
+        SELECT
+            current_setting('server_version') AS server_version,
+            current_setting('server_version_num')::bigint AS server_version_num,
+            current_user::text AS current_user_name,
+            COALESCE((SELECT rolsuper FROM pg_roles WHERE rolname = current_user), false) AS is_superuser,
+            pg_is_in_recovery() AS in_recovery,
+            current_setting('default_transaction_read_only') = 'on' AS default_read_only,
+            EXISTS (
+                SELECT 1
+                FROM pg_class c
+                JOIN pg_namespace n ON n.oid = c.relnamespace
+                WHERE c.relkind IN ('r', 'p')
+                  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+                  AND n.nspname NOT LIKE 'pg\_%' ESCAPE '\'
+                  AND (has_table_privilege(c.oid, 'INSERT')
+                       OR has_table_privilege(c.oid, 'UPDATE')
+                       OR has_table_privilege(c.oid, 'DELETE'))
+            ) AS can_write
+    `
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query)
+	if err != nil {
+		return nil, fmt.Errorf("查询服务端信息失败: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("查询服务端信息未返回结果")
+	}
+	row := rows[0]
+
+	features := &FeatureInfo{
+		ConnID:       connID,
+		PgVersion:    dbString(row["server_version"]),
+		PgVersionNum: dbInt64(row["server_version_num"]),
+		CurrentUser:  dbString(row["current_user_name"]),
+	}
+	features.IsSuperuser, _ = row["is_superuser"].(bool)
+	features.InRecovery, _ = row["in_recovery"].(bool)
+	defaultReadOnly, _ := row["default_read_only"].(bool)
+	canWrite, _ := row["can_write"].(bool)
+	features.ReadOnly = features.InRecovery || defaultReadOnly || (!canWrite && !features.IsSuperuser)
+
+	extRows, err := m.dbService.ExecuteQuery(ctx, connID, true, `SELECT extname::text AS name, extversion AS version FROM pg_extension`)
+	if err != nil {
+		return nil, fmt.Errorf("查询已安装扩展失败: %w", err)
+	}
+	features.Extensions = make(map[string]string, len(extRows))
+	for _, ext := range extRows {
+		features.Extensions[dbString(ext["name"])] = dbString(ext["version"])
+	}
+	_, features.HasPostGIS = features.Extensions["postgis"]
+	_, features.HasPGVector = features.Extensions["vector"]
+	_, features.HasTimescale = features.Extensions["timescaledb"]
+
+	return features, nil
+}
@@ -0,0 +1,150 @@
+package schemas
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 关系图支持的输出格式
+const (
+	GraphFormatJSON    = "json"
+	GraphFormatMermaid = "mermaid"
+	GraphFormatDOT     = "dot"
+)
+
+// GraphNode 是关系图中的一张表
+type GraphNode struct {
+	ID          string   `json:"id"`                    // schema.table
+	Schema      string   `json:"schema"`                // 所在 Schema
+	Table       string   `json:"table"`                 // 表名
+	PrimaryKey  []string `json:"primary_key,omitempty"` // 主键列
+	RowCount    int64    `json:"row_count"`             // 估算行数
+	Description string   `json:"description,omitempty"` // 表注释
+}
+
+// GraphEdge 是关系图中的一个外键: From 表的 Columns 引用 To 表的 ReferencedColumns
+type GraphEdge struct {
+	Name              string   `json:"name"`               // 外键约束名
+	From              string   `json:"from"`               // 引用方表 ID
+	To                string   `json:"to"`                 // 被引用表 ID
+	Columns           []string `json:"columns"`            // 引用方的列
+	ReferencedColumns []string `json:"referenced_columns"` // 被引用的列
+	Join              string   `json:"join"`               // 可直接使用的 JOIN 条件
+}
+
+// RelationshipGraph 是基于缓存外键信息构建的表关系图
+type RelationshipGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// BuildRelationshipGraph 从缓存的 Schema 信息构建表关系图，schemaName 为空时包含全部 Schema。
+// 引用了不在缓存中的表 (例如被过滤掉的 Schema) 的外键同样保留，被引用表会作为无详细信息的节点加入。
+func BuildRelationshipGraph(info *DatabaseInfo, schemaName string) *RelationshipGraph {
+	graph := &RelationshipGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	if info == nil {
+		return graph
+	}
+
+	known := make(map[string]bool)
+	for _, schema := range info.Schemas {
+		if schemaName != "" && schema.Name != schemaName {
+			continue
+		}
+		for _, table := range schema.Tables {
+			node := GraphNode{
+				ID:          schema.Name + "." + table.Name,
+				Schema:      schema.Name,
+				Table:       table.Name,
+				RowCount:    table.RowCount,
+				Description: table.Description,
+			}
+			for _, col := range table.Columns {
+				for _, constraint := range col.Constraints {
+					if constraint == PrimaryKeyConstraint {
+						node.PrimaryKey = append(node.PrimaryKey, col.Name)
+						break
+					}
+				}
+			}
+			graph.Nodes = append(graph.Nodes, node)
+			known[node.ID] = true
+
+			for _, fk := range table.ForeignKeys {
+				to := fk.ReferencedSchema + "." + fk.ReferencedTable
+				conditions := make([]string, 0, len(fk.Columns))
+				for i, col := range fk.Columns {
+					if i < len(fk.ReferencedColumns) {
+						conditions = append(conditions, fmt.Sprintf("%s.%s = %s.%s", node.ID, col, to, fk.ReferencedColumns[i]))
+					}
+				}
+				graph.Edges = append(graph.Edges, GraphEdge{
+					Name:              fk.ConstraintName,
+					From:              node.ID,
+					To:                to,
+					Columns:           fk.Columns,
+					ReferencedColumns: fk.ReferencedColumns,
+					Join:              strings.Join(conditions, " AND "),
+				})
+			}
+		}
+	}
+
+	for _, edge := range graph.Edges {
+		if known[edge.To] {
+			continue
+		}
+		schema, table, _ := strings.Cut(edge.To, ".")
+		graph.Nodes = append(graph.Nodes, GraphNode{ID: edge.To, Schema: schema, Table: table, RowCount: -1})
+		known[edge.To] = true
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+	sort.SliceStable(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].Name < graph.Edges[j].Name
+	})
+	return graph
+}
+
+// Mermaid 将关系图渲染为 Mermaid erDiagram 文本
+func (g *RelationshipGraph) Mermaid() string {
+	var sb strings.Builder
+	sb.WriteString("erDiagram\n")
+	for _, node := range g.Nodes {
+		sb.WriteString(fmt.Sprintf("    %s\n", mermaidID(node.ID)))
+	}
+	for _, edge := range g.Edges {
+		// 被引用方 ||--o{ 引用方: 一对多
+		sb.WriteString(fmt.Sprintf("    %s ||--o{ %s : \"%s\"\n",
+			mermaidID(edge.To), mermaidID(edge.From), strings.Join(edge.Columns, ",")))
+	}
+	return sb.String()
+}
+
+// DOT 将关系图渲染为 Graphviz DOT 文本
+func (g *RelationshipGraph) DOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph relationships {\n    rankdir=LR;\n    node [shape=box];\n")
+	for _, node := range g.Nodes {
+		sb.WriteString(fmt.Sprintf("    %q;\n", node.ID))
+	}
+	for _, edge := range g.Edges {
+		sb.WriteString(fmt.Sprintf("    %q -> %q [label=%q];\n", edge.From, edge.To, strings.Join(edge.Columns, ",")))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// mermaidID 将 schema.table 转换为 Mermaid 允许的实体名
+func mermaidID(id string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, id)
+}
@@ -0,0 +1,381 @@
+package schemas
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/requests"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// catalogSignatures 记录加载缓存时每个表、视图以及每个 Schema 级对象集合的目录签名，
+// 增量刷新比较前后的签名找出需要重新加载的对象
+type catalogSignatures struct {
+	Options   string                                  `json:"options"`   // 加载选项的摘要 (loadOptions)，变化时不能增量刷新
+	Relations map[string]map[string]relationSignature `json:"relations"` // Schema 名 -> 关系名 -> 签名
+	Schemas   map[string]string                       `json:"schemas"`   // Schema 名 -> 类型、函数和注释的签名
+}
+
+// relationSignature 是一个表或视图的目录签名
+type relationSignature struct {
+	Kind      string `json:"kind"` // pg_class.relkind: r (表), v (视图), m (物化视图)
+	Signature string `json:"signature"`
+}
+
+// IncrementalRefresh 描述一次增量刷新重新加载的对象 (表和视图使用 schema.name 的形式)
+type IncrementalRefresh struct {
+	Full           bool     `json:"full"`                      // 执行了完整加载
+	Reason         string   `json:"reason,omitempty"`          // 执行完整加载的原因
+	Unchanged      bool     `json:"unchanged"`                 // 目录未变化，缓存保持不变
+	ReloadedTables []string `json:"reloaded_tables,omitempty"` // 新增或结构变化后重新加载的表
+	RemovedTables  []string `json:"removed_tables,omitempty"`
+	ReloadedViews  []string `json:"reloaded_views,omitempty"`  // 重新加载了视图的 Schema
+	ReloadedTypes  []string `json:"reloaded_types,omitempty"`  // 重新加载了类型和函数的 Schema
+	AddedSchemas   []string `json:"added_schemas,omitempty"`   // 完整加载的新 Schema
+	RemovedSchemas []string `json:"removed_schemas,omitempty"` // 已删除或被访问策略排除的 Schema
+}
+
+// relationSignaturesQuery 为每个表和视图计算签名: 关系本身以及列、默认值、约束、索引、触发器、视图规则的目录行
+// (oid 和 xmin)，加上它们的注释。DDL 会插入、删除或更新这些行，ANALYZE 等原地更新不改变签名。
+const relationSignaturesQuery = `
+    SELECT
+        n.nspname AS schema_name,
+        c.relname AS relation_name,
+        c.relkind::text AS relkind,
+        md5(concat_ws('|',
+            c.oid::text || ':' || c.xmin::text,
+            (SELECT string_agg(a.attnum::text || ':' || a.xmin::text, ',' ORDER BY a.attnum)
+               FROM pg_attribute a WHERE a.attrelid = c.oid AND a.attnum > 0),
+            (SELECT string_agg(d.oid::text || ':' || d.xmin::text, ',' ORDER BY d.oid) FROM pg_attrdef d WHERE d.adrelid = c.oid),
+            (SELECT string_agg(k.oid::text || ':' || k.xmin::text, ',' ORDER BY k.oid) FROM pg_constraint k WHERE k.conrelid = c.oid),
+            (SELECT string_agg(i.indexrelid::text || ':' || i.xmin::text || ':' || ic.xmin::text, ',' ORDER BY i.indexrelid)
+               FROM pg_index i JOIN pg_class ic ON ic.oid = i.indexrelid WHERE i.indrelid = c.oid),
+            (SELECT string_agg(t.oid::text || ':' || t.xmin::text, ',' ORDER BY t.oid) FROM pg_trigger t WHERE t.tgrelid = c.oid),
+            (SELECT string_agg(r.oid::text || ':' || r.xmin::text, ',' ORDER BY r.oid) FROM pg_rewrite r WHERE r.ev_class = c.oid),
+            (SELECT string_agg(ds.objoid::text || '.' || ds.objsubid::text || ':' || md5(ds.description), ',' ORDER BY ds.objoid, ds.objsubid)
+               FROM pg_description ds
+               WHERE ds.objoid = c.oid
+                  OR ds.objoid IN (SELECT indexrelid FROM pg_index WHERE indrelid = c.oid)
+                  OR ds.objoid IN (SELECT oid FROM pg_constraint WHERE conrelid = c.oid)
+                  OR ds.objoid IN (SELECT oid FROM pg_trigger WHERE tgrelid = c.oid))
+        )) AS signature
+    FROM pg_class c
+    JOIN pg_namespace n ON n.oid = c.relnamespace
+    WHERE
+        n.nspname NOT IN ('pg_catalog', 'information_schema')
+        AND n.nspname NOT LIKE 'pg\_toast%' AND n.nspname NOT LIKE 'pg\_temp%'
+        AND c.relkind IN ('r', 'v', 'm')
+`
+
+// schemaSignaturesQuery 为每个 Schema 计算类型 (含枚举标签、复合类型属性和域约束)、函数以及它们和 Schema 本身注释的签名
+const schemaSignaturesQuery = `
+    SELECT
+        n.nspname AS schema_name,
+        md5(concat_ws('|',
+            n.oid::text || ':' || n.xmin::text,
+            (SELECT string_agg(t.oid::text || ':' || t.xmin::text, ',' ORDER BY t.oid) FROM pg_type t WHERE t.typnamespace = n.oid AND t.typtype IN ('e', 'c', 'd')),
+            (SELECT string_agg(e.oid::text || ':' || e.xmin::text, ',' ORDER BY e.oid)
+               FROM pg_enum e JOIN pg_type t ON t.oid = e.enumtypid WHERE t.typnamespace = n.oid),
+            (SELECT string_agg(a.attrelid::text || '.' || a.attnum::text || ':' || a.xmin::text, ',' ORDER BY a.attrelid, a.attnum)
+               FROM pg_attribute a JOIN pg_class c ON c.oid = a.attrelid WHERE c.relnamespace = n.oid AND c.relkind = 'c' AND a.attnum > 0),
+            (SELECT string_agg(k.oid::text || ':' || k.xmin::text, ',' ORDER BY k.oid) FROM pg_constraint k WHERE k.connamespace = n.oid AND k.contypid <> 0),
+            (SELECT string_agg(p.oid::text || ':' || p.xmin::text, ',' ORDER BY p.oid) FROM pg_proc p WHERE p.pronamespace = n.oid),
+            (SELECT string_agg(ds.objoid::text || ':' || md5(ds.description), ',' ORDER BY ds.objoid)
+               FROM pg_description ds
+               WHERE ds.objoid = n.oid
+                  OR ds.objoid IN (SELECT oid FROM pg_type WHERE typnamespace = n.oid)
+                  OR ds.objoid IN (SELECT oid FROM pg_proc WHERE pronamespace = n.oid))
+        )) AS signature
+    FROM pg_namespace n
+    WHERE
+        n.nspname NOT IN ('pg_catalog', 'information_schema')
+        AND n.nspname NOT LIKE 'pg\_toast%' AND n.nspname NOT LIKE 'pg\_temp%'
+`
+
+// fetchCatalogSignatures 获取当前数据库目录中各对象的签名
+func (m *manager) fetchCatalogSignatures(ctx context.Context, connID string) (*catalogSignatures, error) {
+	relationRows, err := m.dbService.ExecuteQuery(ctx, connID, true, relationSignaturesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("获取表和视图的签名失败: %w", err)
+	}
+	schemaRows, err := m.dbService.ExecuteQuery(ctx, connID, true, schemaSignaturesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("获取 Schema 对象的签名失败: %w", err)
+	}
+
+	signatures := &catalogSignatures{
+		Options:   m.loadOptions(connID),
+		Relations: make(map[string]map[string]relationSignature),
+		Schemas:   make(map[string]string, len(schemaRows)),
+	}
+	for _, row := range relationRows {
+		schemaName := dbString(row["schema_name"])
+		if signatures.Relations[schemaName] == nil {
+			signatures.Relations[schemaName] = make(map[string]relationSignature)
+		}
+		signatures.Relations[schemaName][dbString(row["relation_name"])] = relationSignature{
+			Kind:      dbString(row["relkind"]),
+			Signature: dbString(row["signature"]),
+		}
+	}
+	for _, row := range schemaRows {
+		signatures.Schemas[dbString(row["schema_name"])] = dbString(row["signature"])
+	}
+	return signatures, nil
+}
+
+// changedRelations 返回 Schema 下签名发生变化 (新增, 修改或删除) 的表和视图，值为 relkind (已删除的对象为删除前的 relkind)
+func changedRelations(previous, current map[string]relationSignature) map[string]string {
+	changed := make(map[string]string)
+	for name, sig := range current {
+		if previous[name] != sig {
+			changed[name] = sig.Kind
+		}
+	}
+	for name, sig := range previous {
+		if _, ok := current[name]; !ok {
+			changed[name] = sig.Kind
+		}
+	}
+	return changed
+}
+
+// RefreshIncremental 实现 Manager 接口。
+func (m *manager) RefreshIncremental(ctx context.Context, connID string) (IncrementalRefresh, error) {
+	result, refresh, err := m.refreshIncremental(ctx, connID)
+	if err != nil {
+		return result, err
+	}
+	if result.Full {
+		utils.DefaultLogger.Info("无法增量刷新 Schema 缓存，执行完整加载", zap.String("connID", connID), zap.String("reason", result.Reason))
+		return result, m.LoadSchema(ctx, connID)
+	}
+	if refresh != nil {
+		m.emitRefresh(*refresh)
+	}
+	return result, nil
+}
+
+// refreshIncremental 在 loadMu 下比较签名并替换缓存；需要完整加载时返回 Full 为 true 的结果而不修改缓存
+func (m *manager) refreshIncremental(ctx context.Context, connID string) (IncrementalRefresh, *SchemaRefresh, error) {
+	m.loadMu.Lock()
+	defer m.loadMu.Unlock()
+	ctx = requests.WithoutProgress(ctx)
+
+	m.mu.RLock()
+	previous, previousConnID, previousChecksum, previousSignatures := m.cache, m.cacheConnID, m.checksum, m.signatures
+	m.mu.RUnlock()
+	switch {
+	case previousConnID != connID:
+		return IncrementalRefresh{Full: true, Reason: "缓存尚未加载或来自其他连接"}, nil, nil
+	case previousChecksum == "" || previousSignatures == nil:
+		return IncrementalRefresh{Full: true, Reason: "缓存没有记录加载时的目录签名"}, nil, nil
+	case previousSignatures.Options != m.loadOptions(connID):
+		return IncrementalRefresh{Full: true, Reason: "访问策略或脱敏规则已变化"}, nil, nil
+	}
+
+	checksum, err := m.fetchCatalogChecksum(ctx, connID)
+	if err != nil {
+		return IncrementalRefresh{}, nil, fmt.Errorf("计算数据库目录校验和失败: %w", err)
+	}
+	if checksum == previousChecksum {
+		utils.DefaultLogger.Info("数据库目录未变化，保留现有 Schema 缓存", zap.String("connID", connID))
+		return IncrementalRefresh{Unchanged: true}, nil, nil
+	}
+	signatures, err := m.fetchCatalogSignatures(ctx, connID)
+	if err != nil {
+		return IncrementalRefresh{}, nil, err
+	}
+	schemaRows, err := m.fetchSchemas(ctx, connID)
+	if err != nil {
+		return IncrementalRefresh{}, nil, fmt.Errorf("获取 Schema 列表失败: %w", err)
+	}
+	var topologies map[string]*TopologyInfo
+	if m.includePostGISObjects {
+		topologies, err = m.fetchTopologies(ctx, connID)
+		if err != nil {
+			utils.DefaultLogger.Debug("获取 PostGIS 拓扑信息失败，跳过", zap.String("connID", connID), zap.Error(err))
+		}
+	}
+	policies := m.dbService.Policies(connID)
+
+	// 视图的列来源可能在其他 Schema 中，先汇总所有变化的表和视图
+	changed := make(map[string]map[string]string)
+	for schemaName := range previousSignatures.Relations {
+		changed[schemaName] = changedRelations(previousSignatures.Relations[schemaName], signatures.Relations[schemaName])
+	}
+	for schemaName := range signatures.Relations {
+		if _, ok := changed[schemaName]; !ok {
+			changed[schemaName] = changedRelations(nil, signatures.Relations[schemaName])
+		}
+	}
+
+	previousSchemas := make(map[string]*SchemaInfo, len(previous.Schemas))
+	for i := range previous.Schemas {
+		previousSchemas[previous.Schemas[i].Name] = &previous.Schemas[i]
+	}
+	result := IncrementalRefresh{}
+	newCache := &DatabaseInfo{Schemas: make([]SchemaInfo, 0, len(schemaRows)), Features: previous.Features}
+	kept := make(map[string]bool, len(schemaRows))
+	for _, row := range schemaRows {
+		schemaName := row["schema_name"].(string)
+		if !policies.SchemaVisible(schemaName) {
+			continue
+		}
+		old, ok := previousSchemas[schemaName]
+		if !ok {
+			tables, err := m.fetchTables(ctx, connID, schemaName)
+			if err != nil {
+				return IncrementalRefresh{}, nil, fmt.Errorf("获取 Schema '%s' 的表信息失败: %w", schemaName, err)
+			}
+			newCache.Schemas = append(newCache.Schemas, m.loadSchemaInfo(ctx, connID, schemaJob{schema: row, tables: tables}, topologies, policies))
+			result.AddedSchemas = append(result.AddedSchemas, schemaName)
+			continue
+		}
+		kept[schemaName] = true
+		schemaInfo, err := m.refreshSchemaInfo(ctx, connID, row, old, changed, previousSignatures, signatures, topologies, policies, &result)
+		if err != nil {
+			return IncrementalRefresh{}, nil, err
+		}
+		newCache.Schemas = append(newCache.Schemas, schemaInfo)
+	}
+	for _, s := range previous.Schemas {
+		if !kept[s.Name] {
+			result.RemovedSchemas = append(result.RemovedSchemas, s.Name)
+		}
+	}
+
+	// 请求被取消或超时时部分查询会失败，不用残缺的结果替换缓存
+	if err := ctx.Err(); err != nil {
+		return IncrementalRefresh{}, nil, fmt.Errorf("增量刷新 Schema 被中断，保留原有缓存: %w", err)
+	}
+	if len(result.ReloadedTypes) > 0 || len(result.AddedSchemas) > 0 {
+		m.registerCustomTypes(ctx, connID, newCache)
+	}
+	// 分块数和策略的变化不反映在目录签名中，每次刷新都重新获取
+	m.attachTimescaleMetadata(ctx, connID, newCache)
+
+	loadedAt := time.Now()
+	refresh := m.swapCache(connID, newCache, loadedAt, checksum, signatures)
+	utils.DefaultLogger.Info("数据库 Schema 缓存增量刷新完成", zap.String("connID", connID),
+		zap.Strings("reloadedTables", result.ReloadedTables), zap.Strings("removedTables", result.RemovedTables),
+		zap.Strings("reloadedViews", result.ReloadedViews), zap.Strings("reloadedTypes", result.ReloadedTypes),
+		zap.Strings("addedSchemas", result.AddedSchemas), zap.Strings("removedSchemas", result.RemovedSchemas))
+	m.saveCacheFile(ctx, connID, newCache, loadedAt, checksum, signatures)
+	return result, &refresh, nil
+}
+
+// refreshSchemaInfo 基于缓存中的 Schema 组装刷新后的 Schema: 只重新加载签名变化的表、
+// 视图 (自身变化或来源表变化时) 以及类型和函数，其余部分沿用缓存 (表的大致行数更新为最新值)。
+// 缓存中的对象不可修改，变化的字段都替换为新的切片。
+func (m *manager) refreshSchemaInfo(ctx context.Context, connID string, row map[string]any, old *SchemaInfo, changed map[string]map[string]string,
+	previousSignatures, signatures *catalogSignatures, topologies map[string]*TopologyInfo, policies sqlguard.Policies, result *IncrementalRefresh) (SchemaInfo, error) {
+	schemaInfo := *old
+	schemaInfo.Description = dbString(row["description"])
+	if m.includePostGISObjects {
+		schemaInfo.Topology = topologies[schemaInfo.Name]
+	}
+
+	changedTables := make(map[string]bool)
+	for name, kind := range changed[schemaInfo.Name] {
+		if kind == "r" {
+			changedTables[name] = true
+		}
+	}
+	if len(changedTables) > 0 {
+		tableRows, err := m.fetchTables(ctx, connID, schemaInfo.Name)
+		if err != nil {
+			return SchemaInfo{}, fmt.Errorf("获取 Schema '%s' 的表信息失败: %w", schemaInfo.Name, err)
+		}
+		var reloadRows []map[string]any
+		var reloadNames []string
+		for _, t := range tableRows {
+			if name := t["table_name"].(string); changedTables[name] {
+				reloadRows = append(reloadRows, t)
+				reloadNames = append(reloadNames, name)
+			}
+		}
+		reloaded := map[string]TableInfo{}
+		if len(reloadRows) > 0 {
+			tables, err := m.loadTables(ctx, connID, schemaInfo.Name, reloadRows, reloadNames, policies)
+			if err != nil {
+				return SchemaInfo{}, fmt.Errorf("获取 Schema '%s' 的列信息失败: %w", schemaInfo.Name, err)
+			}
+			for _, t := range tables {
+				reloaded[t.Name] = t
+			}
+		}
+
+		oldTables := make(map[string]TableInfo, len(old.Tables))
+		for _, t := range old.Tables {
+			oldTables[t.Name] = t
+		}
+		tables := make([]TableInfo, 0, len(tableRows))
+		present := make(map[string]bool, len(tableRows))
+		for _, t := range tableRows {
+			name := t["table_name"].(string)
+			present[name] = true
+			if table, ok := reloaded[name]; ok {
+				tables = append(tables, table)
+				result.ReloadedTables = append(result.ReloadedTables, schemaInfo.Name+"."+name)
+			} else if table, ok := oldTables[name]; ok && !changedTables[name] {
+				table.RowCount = dbInt64(t["row_count"])
+				tables = append(tables, table)
+			}
+		}
+		for _, t := range old.Tables {
+			if !present[t.Name] {
+				result.RemovedTables = append(result.RemovedTables, schemaInfo.Name+"."+t.Name)
+			}
+		}
+
+		// 时态模式依赖表之间的关系，在新的表集合上重新识别
+		for i := range tables {
+			tables[i].Temporal = nil
+		}
+		schemaInfo.Tables = tables
+		detectTemporalPatterns(&schemaInfo)
+	}
+
+	if viewsChanged(old, changed) {
+		schemaInfo.Views = m.loadViews(ctx, connID, schemaInfo.Name, policies)
+		result.ReloadedViews = append(result.ReloadedViews, schemaInfo.Name)
+	}
+
+	if previousSignatures.Schemas[schemaInfo.Name] != signatures.Schemas[schemaInfo.Name] {
+		types, err := m.fetchTypes(ctx, connID, schemaInfo.Name)
+		if err != nil {
+			return SchemaInfo{}, fmt.Errorf("获取 Schema '%s' 的自定义类型信息失败: %w", schemaInfo.Name, err)
+		}
+		functions, err := m.fetchFunctions(ctx, connID, schemaInfo.Name)
+		if err != nil {
+			return SchemaInfo{}, fmt.Errorf("获取 Schema '%s' 的函数信息失败: %w", schemaInfo.Name, err)
+		}
+		schemaInfo.Types, schemaInfo.Functions = types, functions
+		result.ReloadedTypes = append(result.ReloadedTypes, schemaInfo.Name)
+	}
+	return schemaInfo, nil
+}
+
+// viewsChanged 判断 Schema 的视图是否需要重新加载: Schema 下的视图有变化，或缓存中视图列的来源表/视图有变化
+// (例如基表的列被重命名，视图自身的目录行不会改变)
+func viewsChanged(schema *SchemaInfo, changed map[string]map[string]string) bool {
+	for _, kind := range changed[schema.Name] {
+		if kind != "r" {
+			return true
+		}
+	}
+	for _, view := range schema.Views {
+		for _, col := range view.Columns {
+			for _, source := range col.Sources {
+				if _, ok := changed[source.Schema][source.Table]; ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+package schemas
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/requests"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// loadProgress 汇总各个 worker 已加载的表数，向客户端报告整体进度
+type loadProgress struct {
+	ctx   context.Context // 带有进度令牌的请求 Context
+	total int
+
+	mu     sync.Mutex
+	loaded int
+}
+
+// schemaDone 记录一个 Schema 的 tables 张表已处理完成 (无论成功与否)
+func (p *loadProgress) schemaDone(schemaName string, tables int) {
+	p.mu.Lock()
+	p.loaded += tables
+	loaded := p.loaded
+	p.mu.Unlock()
+	requests.ReportProgress(p.ctx, float64(loaded), float64(p.total), fmt.Sprintf("已加载 %d/%d 张表 (%s)", loaded, p.total, schemaName))
+}
+
+// schemaJob 是一个待加载的 Schema
+type schemaJob struct {
+	schema map[string]any   // fetchSchemas 返回的行
+	tables []map[string]any // fetchTables 返回的行
+}
+
+// loadSchemas 加载各 Schema 的详细信息，返回的顺序与 jobs 相同。
+// 最多 m.loadParallelism 个 worker 并发加载不同的 Schema (每个 worker 占用连接池中的一个连接)。
+func (m *manager) loadSchemas(ctx context.Context, connID string, jobs []schemaJob, topologies map[string]*TopologyInfo, policies sqlguard.Policies, progress *loadProgress) []SchemaInfo {
+	results := make([]SchemaInfo, len(jobs))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for range min(m.loadParallelism, len(jobs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = m.loadSchemaInfo(ctx, connID, jobs[i], topologies, policies)
+				progress.schemaDone(results[i].Name, len(jobs[i].tables))
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return results
+}
+
+// loadSchemaInfo 加载一个 Schema 下的表、自定义类型和函数
+func (m *manager) loadSchemaInfo(ctx context.Context, connID string, job schemaJob, topologies map[string]*TopologyInfo, policies sqlguard.Policies) SchemaInfo {
+	schemaInfo := SchemaInfo{
+		Name:        job.schema["schema_name"].(string),
+		Description: dbString(job.schema["description"]), // 处理可能的 NULL
+		Tables:      []TableInfo{},
+		Topology:    topologies[job.schema["schema_name"].(string)],
+	}
+
+	// 获取每个表的详细信息 (列, 索引, 外键, 触发器)
+	tables, err := m.loadTables(ctx, connID, schemaInfo.Name, job.tables, nil, policies)
+	if err != nil {
+		utils.DefaultLogger.Error("获取列信息失败", zap.String("schema", schemaInfo.Name), zap.String("connID", connID), zap.Error(err))
+	} else {
+		schemaInfo.Tables = tables
+	}
+
+	// 获取 Schema 下的视图及其列的来源
+	schemaInfo.Views = m.loadViews(ctx, connID, schemaInfo.Name, policies)
+
+	// 获取 Schema 下的自定义类型 (枚举标签对生成正确的字面量尤其重要)
+	types, err := m.fetchTypes(ctx, connID, schemaInfo.Name)
+	if err != nil {
+		utils.DefaultLogger.Error("获取自定义类型信息失败", zap.String("schema", schemaInfo.Name), zap.String("connID", connID), zap.Error(err))
+	} else {
+		schemaInfo.Types = types
+	}
+
+	// 获取 Schema 下的用户函数和存储过程
+	functions, err := m.fetchFunctions(ctx, connID, schemaInfo.Name)
+	if err != nil {
+		utils.DefaultLogger.Error("获取函数信息失败", zap.String("schema", schemaInfo.Name), zap.String("connID", connID), zap.Error(err))
+	} else {
+		schemaInfo.Functions = functions
+	}
+
+	// 基于已加载的列和触发器识别时态表/历史表模式
+	detectTemporalPatterns(&schemaInfo)
+	return schemaInfo
+}
+
+// loadTables 加载一个 Schema 下各表的详细信息，返回的顺序与 tables 相同。
+// 列、索引、外键、约束和触发器各用一条按 Schema 过滤的目录查询获取，再在内存中按表组装，
+// 查询次数与表的数量无关。only 不为 nil 时目录查询只获取其中的表 (增量刷新)，tables 应只包含这些表。
+// 获取列信息失败时返回错误，其他信息获取失败时记录日志并继续。
+func (m *manager) loadTables(ctx context.Context, connID, schemaName string, tables []map[string]any, only []string, policies sqlguard.Policies) ([]TableInfo, error) {
+	constraints, err := m.fetchSchemaConstraints(ctx, connID, schemaName, only)
+	if err != nil {
+		utils.DefaultLogger.Warn("获取约束信息失败，列信息中将缺少约束详情", zap.String("schema", schemaName), zap.String("connID", connID), zap.Error(err))
+	}
+	columns, err := m.fetchSchemaColumns(ctx, connID, schemaName, only, constraints)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := m.fetchSchemaIndexes(ctx, connID, schemaName, only)
+	if err != nil {
+		// 索引信息通常不是最关键的，选择继续
+		utils.DefaultLogger.Error("获取索引信息失败", zap.String("schema", schemaName), zap.String("connID", connID), zap.Error(err))
+	}
+	foreignKeys, err := m.fetchSchemaForeignKeys(ctx, connID, schemaName, only)
+	if err != nil {
+		// 外键信息比较重要，但也可以选择继续
+		utils.DefaultLogger.Error("获取外键信息失败", zap.String("schema", schemaName), zap.String("connID", connID), zap.Error(err))
+	}
+	triggers, err := m.fetchSchemaTriggers(ctx, connID, schemaName, only)
+	if err != nil {
+		// 触发器信息不是关键信息，选择继续
+		utils.DefaultLogger.Error("获取触发器信息失败", zap.String("schema", schemaName), zap.String("connID", connID), zap.Error(err))
+	}
+
+	loaded := make([]TableInfo, 0, len(tables))
+	for _, t := range tables {
+		tableName := t["table_name"].(string)
+		if !policies.TableAllowed(schemaName, tableName) {
+			utils.DefaultLogger.Debug("表被访问策略排除，跳过加载", zap.String("schema", schemaName), zap.String("table", tableName))
+			continue
+		}
+		tableInfo := TableInfo{
+			Name:        tableName,
+			Description: dbString(t["description"]),
+			RowCount:    dbInt64(t["row_count"]), // 大致行数
+			Columns:     orEmpty(columns[tableName]),
+			Indexes:     orEmpty(indexes[tableName]),
+			ForeignKeys: orEmpty(foreignKeys[tableName]),
+			Triggers:    orEmpty(triggers[tableName]),
+		}
+		for i := range tableInfo.Columns {
+			tableInfo.Columns[i].Masked = masking.ModeFor(m.maskingRules, schemaName, tableName, tableInfo.Columns[i].Name)
+		}
+
+		// 基于列类型和索引参数补充 pgvector 向量列信息
+		attachVectorMetadata(&tableInfo)
+		loaded = append(loaded, tableInfo)
+	}
+	return loaded, nil
+}
+
+// orEmpty 把 nil 切片替换为空切片，保持序列化结果为 [] 而不是 null
+func orEmpty[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+// fetchSchemaConstraints 一次性获取 Schema 下所有表 (tables 不为 nil 时只获取其中的表) 的约束信息，返回 表名 -> 约束
+func (m *manager) fetchSchemaConstraints(ctx context.Context, connID, schemaName string, tables []string) (map[string][]map[string]any, error) {
+	query := `
+        SELECT
+            t.relname as table_name,
+            c.conname as constraint_name,
+            c.contype as constraint_type,
+            CASE
+                WHEN c.contype = 'p' THEN 'PRIMARY KEY'
+                WHEN c.contype = 'u' THEN 'UNIQUE'
+                WHEN c.contype = 'f' THEN 'FOREIGN KEY'
+                WHEN c.contype = 'c' THEN 'CHECK'
+                ELSE 'OTHER'
+            END as constraint_type_desc,
+            ARRAY_AGG(col.attname::text ORDER BY u.attposition) filter (where col.attname is not null) as column_names -- 过滤掉可能的 NULL
+        FROM
+            pg_constraint c
+        JOIN
+            pg_namespace n ON n.oid = c.connamespace
+        JOIN
+            pg_class t ON t.oid = c.conrelid
+        LEFT JOIN
+            LATERAL unnest(c.conkey) WITH ORDINALITY AS u(attnum, attposition) ON TRUE
+        LEFT JOIN
+            pg_attribute col ON col.attrelid = t.oid AND col.attnum = u.attnum
+        WHERE
+            n.nspname = $1
+            AND ($2::text[] IS NULL OR t.relname = ANY($2::text[]))
+        GROUP BY
+            t.relname, c.conname, c.contype
+        ORDER BY
+            t.relname, c.contype, c.conname
+    `
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tables)
+	if err != nil {
+		return nil, err
+	}
+	constraints := make(map[string][]map[string]any)
+	for _, row := range rows {
+		row["column_names"] = interfaceSliceToStringSlice(row["column_names"])
+		tableName := dbString(row["table_name"])
+		constraints[tableName] = append(constraints[tableName], row)
+	}
+	return constraints, nil
+}
+
+// fetchSchemaTriggers 一次性获取 Schema 下所有表 (tables 不为 nil 时只获取其中的表) 的触发器，返回 表名 -> 触发器
+func (m *manager) fetchSchemaTriggers(ctx context.Context, connID, schemaName string, tables []string) (map[string][]TriggerInfo, error) {
+	// tgtype 是位掩码: 1=ROW, 2=BEFORE, 4=INSERT, 8=DELETE, 16=UPDATE, 32=TRUNCATE, 64=INSTEAD OF
+	query := `
+        SELECT
+            t.relname as table_name,
+            tg.tgname as trigger_name,
+            CASE
+                WHEN (tg.tgtype & 2) <> 0 THEN 'BEFORE'
+                WHEN (tg.tgtype & 64) <> 0 THEN 'INSTEAD OF'
+                ELSE 'AFTER'
+            END as timing,
+            array_remove(ARRAY[
+                CASE WHEN (tg.tgtype & 4) <> 0 THEN 'INSERT' END,
+                CASE WHEN (tg.tgtype & 16) <> 0 THEN 'UPDATE' END,
+                CASE WHEN (tg.tgtype & 8) <> 0 THEN 'DELETE' END,
+                CASE WHEN (tg.tgtype & 32) <> 0 THEN 'TRUNCATE' END
+            ], NULL) as events,
+            CASE WHEN (tg.tgtype & 1) <> 0 THEN 'ROW' ELSE 'STATEMENT' END as level,
+            pn.nspname || '.' || p.proname as function_name,
+            tg.tgenabled::text as enabled_code, -- "char" 类型转为 text 便于处理
+            pg_get_triggerdef(tg.oid) as definition,
+            obj_description(tg.oid, 'pg_trigger') as description
+        FROM
+            pg_trigger tg
+        JOIN
+            pg_class t ON t.oid = tg.tgrelid
+        JOIN
+            pg_namespace n ON n.oid = t.relnamespace
+        JOIN
+            pg_proc p ON p.oid = tg.tgfoid
+        JOIN
+            pg_namespace pn ON pn.oid = p.pronamespace
+        WHERE
+            n.nspname = $1
+            AND ($2::text[] IS NULL OR t.relname = ANY($2::text[]))
+            AND NOT tg.tgisinternal -- 排除约束内部使用的触发器 (例如外键)
+        ORDER BY
+            t.relname, tg.tgname
+    `
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	triggers := make(map[string][]TriggerInfo)
+	for _, row := range rows {
+		tableName := dbString(row["table_name"])
+		triggers[tableName] = append(triggers[tableName], TriggerInfo{
+			Name:        dbString(row["trigger_name"]),
+			Timing:      dbString(row["timing"]),
+			Events:      interfaceSliceToStringSlice(row["events"]),
+			Level:       dbString(row["level"]),
+			Function:    dbString(row["function_name"]),
+			Enabled:     triggerEnabledState(dbString(row["enabled_code"])),
+			Definition:  dbString(row["definition"]),
+			Description: dbString(row["description"]),
+		})
+	}
+	return triggers, nil
+}
@@ -3,10 +3,15 @@ package schemas
 import (
 	"context" // 用于处理可能的 NULL 字符串
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/cbc3929/pg_mcp_server/internal/config"
 	// 引入数据库服务接口
 	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/requests"
 	"github.com/cbc3929/pg_mcp_server/internal/utils" // 引入日志
 
 	"go.uber.org/zap" // 引入 zap 日志
@@ -21,116 +26,296 @@ type Manager interface {
 	// GetDatabaseInfo 返回缓存的整个数据库结构信息。
 	GetDatabaseInfo() (*DatabaseInfo, bool)
 
+	// CacheInfo 返回缓存的来源连接、加载时间和规模，用于判断缓存是否陈旧。
+	CacheInfo() CacheInfo
+
 	// GetSchemaInfo 返回指定名称的 Schema 的缓存信息。
 	GetSchemaInfo(schemaName string) (*SchemaInfo, bool)
 
 	// GetTableInfo 返回指定 Schema 和表名的表的缓存信息。
 	GetTableInfo(schemaName, tableName string) (*TableInfo, bool)
+
+	// GetViewLineage 返回视图各输出列引用的列，以及沿视图追溯到的基表列 (由解析视图定义得到的提示)。
+	GetViewLineage(schemaName, viewName string) (*ViewLineage, bool)
+
+	// GetFeatures 返回指定连接的特性摘要 (版本, 关键扩展, 是否只读)。
+	// 首次调用时查询数据库，之后使用缓存。
+	GetFeatures(ctx context.Context, connID string) (*FeatureInfo, error)
+
+	// GetTableDDL 根据缓存的列/索引/注释以及数据库中的约束定义重建表的 CREATE TABLE 语句。
+	GetTableDDL(ctx context.Context, connID, schemaName, tableName string) (string, error)
+
+	// SearchSchema 在缓存的 Schema 元数据 (表名, 列名, 注释, 函数名等) 中按关键字搜索，结果按相关度排序。
+	SearchSchema(keyword string, options SearchOptions) []SearchResult
+
+	// AddRefreshListener 注册缓存刷新的监听函数 (例如向订阅资源的客户端发送 MCP 通知)，
+	// 每次 LoadSchema 成功替换缓存后在释放锁之后同步调用。
+	AddRefreshListener(listener func(SchemaRefresh))
+
+	// RestoreSnapshot 用导出的 Schema 快照替换缓存 (例如迁移主机后在数据库可用前恢复)，
+	// connID 是恢复后记录的来源连接，loadedAt 保留快照原本的加载时间。与 LoadSchema 一样通知监听函数。
+	RestoreSnapshot(connID string, info *DatabaseInfo, loadedAt time.Time)
+
+	// WarmStart 从 SCHEMA_CACHE_DIR 读取 connID 对应数据库的缓存文件并恢复缓存，返回是否恢复成功。
+	// 未配置缓存目录、文件不存在或格式版本、加载选项 (访问策略, 脱敏规则) 不匹配时返回 false，调用方应执行 LoadSchema。
+	WarmStart(ctx context.Context, connID string) bool
+
+	// RefreshIfChanged 计算数据库目录的校验和，与当前缓存加载时的校验和不同时 (增量地) 重新加载 Schema，返回是否重新加载。
+	RefreshIfChanged(ctx context.Context, connID string) (bool, error)
+
+	// RefreshIncremental 比较各表、视图和 Schema 级对象 (类型, 函数, 注释) 的目录行版本与缓存加载时的记录，
+	// 只重新加载发生变化的部分。缓存来自其他连接、没有记录或加载选项已变化时执行完整加载。
+	RefreshIncremental(ctx context.Context, connID string) (IncrementalRefresh, error)
+}
+
+// SchemaRefresh 描述一次缓存刷新，监听函数据此比较刷新前后的差异
+type SchemaRefresh struct {
+	ConnID         string        // 本次加载使用的连接 ID
+	PreviousConnID string        // 刷新前缓存的来源连接 ID，首次加载时为空
+	Previous       *DatabaseInfo // 刷新前的缓存 (不可修改)
+	Current        *DatabaseInfo // 刷新后的缓存 (不可修改)
+}
+
+// CacheInfo 描述 Schema 缓存的来源和加载时间
+type CacheInfo struct {
+	ConnID   string     `json:"conn_id,omitempty"`   // 加载缓存使用的连接 ID，尚未加载时为空
+	LoadedAt *time.Time `json:"loaded_at,omitempty"` // 最近一次成功加载的时间
+	Schemas  int        `json:"schemas"`
+	Tables   int        `json:"tables"`
 }
 
 // manager 是 SchemaManager 接口的实现。
 type manager struct {
-	dbService databases.Service // 数据库服务依赖
-	cache     *DatabaseInfo     // 内存缓存
-	mu        sync.RWMutex      // 保护缓存的读写锁
+	dbService             databases.Service  // 数据库服务依赖
+	cache                 *DatabaseInfo      // 内存缓存
+	cacheConnID           string             // 加载缓存使用的连接 ID (由 mu 保护)
+	loadedAt              time.Time          // 缓存的加载时间 (由 mu 保护)
+	checksum              string             // 缓存加载时数据库目录的校验和，未知时为空 (由 mu 保护)
+	signatures            *catalogSignatures // 缓存加载时各对象的目录签名，未知时为 nil (由 mu 保护)
+	mu                    sync.RWMutex       // 保护缓存的读写锁
+	loadMu                sync.Mutex         // 串行化 Schema 加载，加载期间不阻塞对缓存的读取
+	cacheDir              string             // 持久化缓存文件的目录，为空时不持久化
+	includePostGISObjects bool               // 是否加载 topology Schema 和栅格列元数据
+	loadParallelism       int                // 加载时并发加载 Schema 的 worker 数
+	maskingRules          []masking.Rule     // 脱敏规则，用于在列信息中标记脱敏列
+
+	featuresMu sync.Mutex              // 保护 features
+	features   map[string]*FeatureInfo // connID -> 特性摘要缓存
+
+	listenersMu sync.RWMutex          // 保护 listeners
+	listeners   []func(SchemaRefresh) // 缓存刷新的监听函数
 }
 
 // NewManager 创建一个新的 Schema Manager 实例。
 // dbService: 数据库服务实例，用于执行查询。
-func NewManager(dbService databases.Service) Manager {
-	utils.DefaultLogger.Info("初始化 Schema 管理器...")
-	return &manager{
-		dbService: dbService,
-		cache:     &DatabaseInfo{Schemas: []SchemaInfo{}}, // 初始化空缓存
+// cfg: 应用配置，决定加载哪些可选的 Schema 对象。
+func NewManager(dbService databases.Service, cfg *config.Config) Manager {
+	// 每个 worker 占用一个连接，不超过连接池上限
+	loadParallelism := max(cfg.SchemaLoadParallelism, 1)
+	if cfg.DBMaxOpenConns > 0 {
+		loadParallelism = min(loadParallelism, cfg.DBMaxOpenConns)
+	}
+	utils.DefaultLogger.Info("初始化 Schema 管理器...", zap.Bool("includePostGISObjects", cfg.SchemaIncludePostGISObjects), zap.Int("loadParallelism", loadParallelism))
+	maskingRules, err := masking.ParseRules(cfg.MaskedColumns)
+	if err != nil {
+		utils.DefaultLogger.Error("解析脱敏规则失败，Schema 信息中不标记脱敏列", zap.Error(err))
+	}
+	m := &manager{
+		dbService:             dbService,
+		cache:                 &DatabaseInfo{Schemas: []SchemaInfo{}}, // 初始化空缓存
+		includePostGISObjects: cfg.SchemaIncludePostGISObjects,
+		loadParallelism:       loadParallelism,
+		cacheDir:              cfg.SchemaCacheDir,
+		maskingRules:          maskingRules,
+		features:              make(map[string]*FeatureInfo),
 		// mu 默认零值可用
 	}
+	// connID 被移除后清除其特性摘要，之后注册的同名 connID 可能指向升级过或权限不同的服务端
+	dbService.AddEvictionListener(func(eviction databases.ConnectionEviction) {
+		if eviction.Reason != databases.EvictionIdlePool {
+			m.featuresMu.Lock()
+			delete(m.features, eviction.ConnID)
+			m.featuresMu.Unlock()
+		}
+	})
+	return m
 }
 
 // LoadSchema 实现 Manager 接口。
 func (m *manager) LoadSchema(ctx context.Context, connID string) error {
 	utils.DefaultLogger.Info("开始加载数据库 Schema 信息...", zap.String("connID", connID))
 
-	m.mu.Lock() // 获取写锁以更新缓存
-	defer m.mu.Unlock()
+	refresh, err := m.loadSchema(ctx, connID)
+	if err != nil {
+		return err
+	}
+	m.emitRefresh(refresh)
+	return nil
+}
+
+// loadSchema 加载并替换缓存，返回刷新前后的缓存供监听函数使用
+func (m *manager) loadSchema(ctx context.Context, connID string) (SchemaRefresh, error) {
+	// 同一时间只有一个加载，新缓存组装完成后才获取写锁替换
+	m.loadMu.Lock()
+	defer m.loadMu.Unlock()
+
+	// 按表数报告整体进度，内部的元数据查询不再单独报告读取的行数
+	progressCtx := ctx
+	ctx = requests.WithoutProgress(ctx)
 
 	newCache := &DatabaseInfo{Schemas: []SchemaInfo{}}
 
+	// 加载前记录目录校验和与各对象的签名: 加载期间发生的 DDL 会使下次比较不一致，从而再次加载
+	checksum, err := m.fetchCatalogChecksum(ctx, connID)
+	if err != nil {
+		utils.DefaultLogger.Warn("计算数据库目录校验和失败，本次加载的缓存不会持久化", zap.String("connID", connID), zap.Error(err))
+	}
+	signatures, err := m.fetchCatalogSignatures(ctx, connID)
+	if err != nil {
+		utils.DefaultLogger.Warn("获取数据库目录签名失败，下次刷新将执行完整加载", zap.String("connID", connID), zap.Error(err))
+	}
+
 	// 1. 获取所有相关的 Schema
 	schemas, err := m.fetchSchemas(ctx, connID)
 	if err != nil {
 		utils.DefaultLogger.Error("获取 Schema 列表失败", zap.String("connID", connID), zap.Error(err))
-		return fmt.Errorf("获取 Schema 列表失败: %w", err)
+		return SchemaRefresh{}, fmt.Errorf("获取 Schema 列表失败: %w", err)
 	}
 	if len(schemas) == 0 {
 		utils.DefaultLogger.Warn("未在数据库中找到用户相关的 Schema", zap.String("connID", connID))
-		m.cache = newCache // 更新为空缓存
-		return nil         // 没有 Schema 就无需继续
+		// 更新为空缓存，没有 Schema 就无需继续
+		return m.swapCache(connID, newCache, time.Now(), checksum, signatures), nil
 	}
 	utils.DefaultLogger.Info("成功获取 Schema 列表", zap.Int("count", len(schemas)), zap.String("connID", connID))
 
-	newCache.Schemas = make([]SchemaInfo, 0, len(schemas))
-	for _, s := range schemas {
-		schemaInfo := SchemaInfo{
-			Name:        s["schema_name"].(string),
-			Description: dbString(s["description"]), // 处理可能的 NULL
-			Tables:      []TableInfo{},
+	// 开启 PostGIS 对象加载时，先获取已注册的拓扑 (Schema 名 -> 拓扑信息)
+	var topologies map[string]*TopologyInfo
+	if m.includePostGISObjects {
+		topologies, err = m.fetchTopologies(ctx, connID)
+		if err != nil {
+			// 未安装 postgis_topology 时查询会失败，属于正常情况
+			utils.DefaultLogger.Debug("获取 PostGIS 拓扑信息失败，跳过", zap.String("connID", connID), zap.Error(err))
 		}
+	}
+
+	// 访问策略禁止的 Schema 和表不进入缓存，也就不会出现在摘要、搜索和资源中
+	policies := m.dbService.Policies(connID)
 
-		// 2. 获取当前 Schema 下的所有表
-		tables, err := m.fetchTables(ctx, connID, schemaInfo.Name)
+	// 2. 先获取所有可见 Schema 下的表，得到总表数用于向客户端报告进度
+	schemaTables := make(map[string][]map[string]any, len(schemas))
+	totalTables := 0
+	for _, s := range schemas {
+		schemaName := s["schema_name"].(string)
+		if !policies.SchemaVisible(schemaName) {
+			continue
+		}
+		tables, err := m.fetchTables(ctx, connID, schemaName)
 		if err != nil {
-			utils.DefaultLogger.Error("获取表信息失败", zap.String("schema", schemaInfo.Name), zap.String("connID", connID), zap.Error(err))
+			utils.DefaultLogger.Error("获取表信息失败", zap.String("schema", schemaName), zap.String("connID", connID), zap.Error(err))
 			// 选择继续处理其他 Schema 还是直接返回错误？这里选择继续
 			continue
 		}
-		schemaInfo.Tables = make([]TableInfo, 0, len(tables))
-
-		// 3. 获取每个表的详细信息 (列, 索引, 外键)
-		for _, t := range tables {
-			tableName := t["table_name"].(string)
-			tableInfo := TableInfo{
-				Name:        tableName,
-				Description: dbString(t["description"]),
-				RowCount:    dbInt64(t["row_count"]), // 大致行数
-				Columns:     []ColumnInfo{},
-				Indexes:     []IndexInfo{},
-				ForeignKeys: []ForeignKeyInfo{},
-			}
+		schemaTables[schemaName] = tables
+		totalTables += len(tables)
+	}
+	requests.ReportProgress(progressCtx, 0, float64(totalTables), fmt.Sprintf("开始加载 %d 个 Schema 中的 %d 张表", len(schemaTables), totalTables))
+	progress := &loadProgress{ctx: progressCtx, total: totalTables}
 
-			// 3a. 获取列信息
-			columns, err := m.fetchColumns(ctx, connID, schemaInfo.Name, tableName)
-			if err != nil {
-				utils.DefaultLogger.Error("获取列信息失败", zap.String("schema", schemaInfo.Name), zap.String("table", tableName), zap.String("connID", connID), zap.Error(err))
-				continue // 继续处理下一张表
-			}
-			tableInfo.Columns = columns // columns 已经在 fetchColumns 中组装好
+	// 3-4. 并发加载各 Schema 的详细信息，并识别时态表模式
+	jobs := make([]schemaJob, 0, len(schemaTables))
+	for _, s := range schemas {
+		if !policies.SchemaVisible(s["schema_name"].(string)) {
+			utils.DefaultLogger.Info("Schema 被访问策略排除，跳过加载", zap.String("schema", s["schema_name"].(string)))
+			continue
+		}
+		tables, ok := schemaTables[s["schema_name"].(string)]
+		if !ok {
+			continue // 获取表列表失败
+		}
+		jobs = append(jobs, schemaJob{schema: s, tables: tables})
+	}
+	newCache.Schemas = m.loadSchemas(ctx, connID, jobs, topologies, policies, progress)
 
-			// 3b. 获取索引信息
-			indexes, err := m.fetchIndexes(ctx, connID, schemaInfo.Name, tableName)
-			if err != nil {
-				utils.DefaultLogger.Error("获取索引信息失败", zap.String("schema", schemaInfo.Name), zap.String("table", tableName), zap.String("connID", connID), zap.Error(err))
-				// 索引信息通常不是最关键的，选择继续
-			} else {
-				tableInfo.Indexes = indexes
-			}
+	// 请求被取消或超时时各表的查询都会失败，不用残缺的结果替换缓存
+	if err := ctx.Err(); err != nil {
+		return SchemaRefresh{}, fmt.Errorf("加载 Schema 被中断，保留原有缓存: %w", err)
+	}
 
-			// 3c. 获取外键信息
-			foreignKeys, err := m.fetchForeignKeys(ctx, connID, schemaInfo.Name, tableName)
-			if err != nil {
-				utils.DefaultLogger.Error("获取外键信息失败", zap.String("schema", schemaInfo.Name), zap.String("table", tableName), zap.String("connID", connID), zap.Error(err))
-				// 外键信息比较重要，但也可以选择继续
-			} else {
-				tableInfo.ForeignKeys = foreignKeys
-			}
+	// 5. 为发现的自定义类型注册编解码器，使查询结果可读
+	m.registerCustomTypes(ctx, connID, newCache)
 
-			schemaInfo.Tables = append(schemaInfo.Tables, tableInfo)
-		}
-		newCache.Schemas = append(newCache.Schemas, schemaInfo)
+	// 6. 记录加载所用连接的特性摘要
+	features, err := m.GetFeatures(ctx, connID)
+	if err != nil {
+		utils.DefaultLogger.Warn("检测数据库特性失败", zap.String("connID", connID), zap.Error(err))
+	} else {
+		newCache.Features = features
 	}
 
-	m.cache = newCache // 原子地替换整个缓存
+	// 7. 安装了 timescaledb 时补充超表和连续聚合信息
+	m.attachTimescaleMetadata(ctx, connID, newCache)
+
+	loadedAt := time.Now()
+	refresh := m.swapCache(connID, newCache, loadedAt, checksum, signatures) // 原子地替换整个缓存
 	utils.DefaultLogger.Info("数据库 Schema 信息加载并缓存完成", zap.String("connID", connID))
-	return nil
+	requests.ReportProgress(progressCtx, float64(totalTables), float64(totalTables), fmt.Sprintf("Schema 加载完成，共 %d 张表", totalTables))
+	if checksum != "" {
+		m.saveCacheFile(ctx, connID, newCache, loadedAt, checksum, signatures)
+	}
+	return refresh, nil
+}
+
+// registerCustomTypes 为缓存中的自定义类型注册编解码器
+func (m *manager) registerCustomTypes(ctx context.Context, connID string, info *DatabaseInfo) {
+	var typeNames []string
+	for _, schemaInfo := range info.Schemas {
+		for _, typeInfo := range schemaInfo.Types {
+			typeNames = append(typeNames, schemaInfo.Name+"."+typeInfo.Name)
+		}
+	}
+	if len(typeNames) > 0 {
+		if err := m.dbService.RegisterCustomTypes(ctx, connID, typeNames); err != nil {
+			utils.DefaultLogger.Warn("注册自定义类型编解码器失败", zap.String("connID", connID), zap.Error(err))
+		}
+	}
+}
+
+// swapCache 在写锁下替换缓存，返回包含刷新前后缓存的 SchemaRefresh
+func (m *manager) swapCache(connID string, info *DatabaseInfo, loadedAt time.Time, checksum string, signatures *catalogSignatures) SchemaRefresh {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	refresh := SchemaRefresh{ConnID: connID, PreviousConnID: m.cacheConnID, Previous: m.cache, Current: info}
+	m.cache = info
+	m.cacheConnID, m.loadedAt, m.checksum, m.signatures = connID, loadedAt, checksum, signatures
+	return refresh
+}
+
+// RestoreSnapshot 实现 Manager 接口。
+func (m *manager) RestoreSnapshot(connID string, info *DatabaseInfo, loadedAt time.Time) {
+	if info.Schemas == nil {
+		info.Schemas = []SchemaInfo{}
+	}
+	// 快照对应的目录校验和未知，RefreshIfChanged 总会完整地重新加载
+	refresh := m.swapCache(connID, info, loadedAt, "", nil)
+	utils.DefaultLogger.Info("已从快照恢复 Schema 缓存", zap.String("connID", connID), zap.Time("loadedAt", loadedAt), zap.Int("schemas", len(info.Schemas)))
+	m.emitRefresh(refresh)
+}
+
+// AddRefreshListener 实现 Manager 接口。
+func (m *manager) AddRefreshListener(listener func(SchemaRefresh)) {
+	m.listenersMu.Lock()
+	defer m.listenersMu.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+// emitRefresh 通知所有监听函数
+func (m *manager) emitRefresh(refresh SchemaRefresh) {
+	m.listenersMu.RLock()
+	listeners := append([]func(SchemaRefresh){}, m.listeners...)
+	m.listenersMu.RUnlock()
+	for _, listener := range listeners {
+		listener(refresh)
+	}
 }
 
 // GetDatabaseInfo 实现 Manager 接口。
@@ -145,6 +330,24 @@ func (m *manager) GetDatabaseInfo() (*DatabaseInfo, bool) {
 	return m.cache, true
 }
 
+// CacheInfo 实现 Manager 接口。
+func (m *manager) CacheInfo() CacheInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	info := CacheInfo{ConnID: m.cacheConnID}
+	if !m.loadedAt.IsZero() {
+		loadedAt := m.loadedAt
+		info.LoadedAt = &loadedAt
+	}
+	if m.cache != nil {
+		info.Schemas = len(m.cache.Schemas)
+		for _, schema := range m.cache.Schemas {
+			info.Tables += len(schema.Tables)
+		}
+	}
+	return info
+}
+
 // GetSchemaInfo 实现 Manager 接口。
 func (m *manager) GetSchemaInfo(schemaName string) (*SchemaInfo, bool) {
 	m.mu.RLock()
@@ -178,6 +381,10 @@ func (m *manager) GetTableInfo(schemaName, tableName string) (*TableInfo, bool)
 // --- 内部查询辅助函数 ---
 
 func (m *manager) fetchSchemas(ctx context.Context, connID string) ([]map[string]any, error) {
+	topologyFilter := "AND schema_name NOT LIKE 'topolo%' -- 排除postgis的 schema"
+	if m.includePostGISObjects {
+		topologyFilter = "" // 以 PostGIS 为主要负载时保留 topology 相关 Schema
+	}
 	query := `
         SELECT
             schema_name,
@@ -188,7 +395,9 @@ func (m *manager) fetchSchemas(ctx context.Context, connID string) ([]map[string
             schema_name NOT IN ('pg_catalog', 'information_schema', 'pg_toast')
             AND schema_name NOT LIKE 'pg\_%' ESCAPE '\' -- 正确转义下划线
             AND schema_name NOT LIKE 'temp%' -- 排除我们自己的临时 schema
-						AND schema_name NOT LIKE 'topolo%' -- 排除postgis的 schema
+            AND schema_name NOT LIKE '\_timescaledb\_%' ESCAPE '\' -- 排除 TimescaleDB 的内部 Schema (分块、目录等)
+            AND schema_name NOT LIKE 'timescaledb\_%' ESCAPE '\'
+            ` + topologyFilter + `
         ORDER BY schema_name
     `
 	return m.dbService.ExecuteQuery(ctx, connID, true, query) // 只读查询
@@ -213,85 +422,159 @@ func (m *manager) fetchTables(ctx context.Context, connID, schemaName string) ([
 	return m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName)
 }
 
-func (m *manager) fetchColumns(ctx context.Context, connID, schemaName, tableName string) ([]ColumnInfo, error) {
-	// 获取基本列信息
+// fetchSchemaColumns 一次性获取 Schema 下所有表 (tables 不为 nil 时只获取其中的表) 的列信息，返回 表名 -> 列 (按列序排列)。
+// constraints 来自 fetchSchemaConstraints，用于标注列上的主键/唯一等约束。
+func (m *manager) fetchSchemaColumns(ctx context.Context, connID, schemaName string, tables []string, constraints map[string][]map[string]any) (map[string][]ColumnInfo, error) {
+	// 直接查询 pg_attribute，避免 information_schema.columns 视图在大型数据库上的开销
 	queryColumns := `
         SELECT
-            c.column_name,
+            cls.relname AS table_name,
+            a.attname AS column_name,
             format_type(a.atttypid, a.atttypmod) AS formatted_type, -- 获取完整格式化类型
-            c.is_nullable,
-            c.column_default,
-            col_description(cls.oid, c.ordinal_position) as description
-            -- 也可以选择性地保留 c.data_type, c.udt_name 用于调试
-            -- c.data_type,
-            -- c.udt_name
-        FROM information_schema.columns c -- 主要用于获取列顺序和基本信息
-        JOIN pg_namespace ns ON c.table_schema = ns.nspname
-        JOIN pg_class cls ON c.table_name = cls.relname AND ns.oid = cls.relnamespace
-        JOIN pg_attribute a ON a.attrelid = cls.oid AND a.attname = c.column_name -- 关联 pg_attribute 获取类型 OID 和修饰符
+            NOT a.attnotnull AS is_nullable,
+            pg_get_expr(d.adbin, d.adrelid) AS column_default,
+            col_description(cls.oid, a.attnum) as description
+        FROM pg_attribute a
+        JOIN pg_class cls ON cls.oid = a.attrelid
+        JOIN pg_namespace ns ON ns.oid = cls.relnamespace
+        LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
         WHERE
-            c.table_schema = $1 AND
-            c.table_name = $2
+            ns.nspname = $1
+            AND ($2::text[] IS NULL OR cls.relname = ANY($2::text[]))
             AND cls.relkind = 'r'
             AND a.attnum > 0 -- 排除系统列
             AND NOT a.attisdropped -- 排除已删除的列
-        ORDER BY c.ordinal_position -- 保持 information_schema 的顺序
+        ORDER BY cls.relname, a.attnum -- 保持列的定义顺序
     `
-	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, queryColumns, schemaName, tableName)
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, queryColumns, schemaName, tables)
 	if err != nil {
 		return nil, err
 	}
 
-	// 获取表的所有约束信息，以便后面匹配
-	constraints, err := m.fetchConstraintsForTable(ctx, connID, schemaName, tableName)
-	if err != nil {
-		utils.DefaultLogger.Warn("获取约束信息失败，列信息中将缺少约束详情",
-			zap.String("schema", schemaName), zap.String("table", tableName), zap.Error(err))
-		constraints = nil // 置空，后续逻辑会处理 nil
-	}
-
-	columns := make([]ColumnInfo, 0, len(rows))
+	columns := make(map[string][]ColumnInfo)
 	for _, row := range rows {
-		colName := row["column_name"].(string)
+		tableName := dbString(row["table_name"])
+		colName := dbString(row["column_name"])
+		isNullable, _ := row["is_nullable"].(bool)
 		col := ColumnInfo{
 			Name:         colName,
 			Type:         dbString(row["formatted_type"]),
-			IsNullable:   row["is_nullable"].(string) == "YES",
+			IsNullable:   isNullable,
 			DefaultValue: dbStringPtr(row["column_default"]), // 处理可能的 NULL 默认值
 			Description:  dbString(row["description"]),
 			Constraints:  []ColumnConstraint{}, // 初始化为空切片
 		}
 
 		// 匹配约束
-		if constraints != nil {
-			for _, constr := range constraints {
-				constrCols, _ := constr["column_names"].([]string) // 需要类型断言和检查
-				constrTypeDesc, _ := constr["constraint_type_desc"].(string)
-				if stringInSlice(colName, constrCols) {
-					// 只添加非外键和非NotNull的约束类型到列上（外键单独处理，NotNull由IsNullable表示）
-					cc := ColumnConstraint(constrTypeDesc)
-					if cc != ForeignKeyConstraint && constrTypeDesc != "" {
-						col.Constraints = append(col.Constraints, cc)
+		for _, constr := range constraints[tableName] {
+			constrCols, _ := constr["column_names"].([]string)
+			constrTypeDesc, _ := constr["constraint_type_desc"].(string)
+			if stringInSlice(colName, constrCols) {
+				// 只添加非外键和非NotNull的约束类型到列上（外键单独处理，NotNull由IsNullable表示）
+				cc := ColumnConstraint(constrTypeDesc)
+				if cc != ForeignKeyConstraint && constrTypeDesc != "" {
+					col.Constraints = append(col.Constraints, cc)
+				}
+			}
+		}
+
+		columns[tableName] = append(columns[tableName], col)
+	}
+
+	hasGeo, hasRaster := false, false
+	for _, tableColumns := range columns {
+		hasGeo = hasGeo || hasGeoColumn(tableColumns)
+		hasRaster = hasRaster || hasRasterColumn(tableColumns)
+	}
+
+	// 存在空间类型列时，补充 PostGIS 元数据 (SRID, 几何类型, 维度)
+	if hasGeo {
+		geoInfos, err := m.fetchGeoColumns(ctx, connID, schemaName, tables)
+		if err != nil {
+			utils.DefaultLogger.Warn("获取空间列信息失败，列信息中将缺少 SRID 等详情",
+				zap.String("schema", schemaName), zap.Error(err))
+		} else {
+			for tableName, tableColumns := range columns {
+				for i := range tableColumns {
+					if geo, ok := geoInfos[tableName][tableColumns[i].Name]; ok {
+						tableColumns[i].Geo = geo
 					}
 				}
 			}
 		}
+	}
 
-		columns = append(columns, col)
+	// 开启 PostGIS 对象加载时，补充栅格列元数据
+	if m.includePostGISObjects && hasRaster {
+		rasterInfos, err := m.fetchRasterColumns(ctx, connID, schemaName, tables)
+		if err != nil {
+			utils.DefaultLogger.Warn("获取栅格列信息失败，列信息中将缺少栅格详情",
+				zap.String("schema", schemaName), zap.Error(err))
+		} else {
+			for tableName, tableColumns := range columns {
+				for i := range tableColumns {
+					if raster, ok := rasterInfos[tableName][tableColumns[i].Name]; ok {
+						tableColumns[i].Raster = raster
+					}
+				}
+			}
+		}
 	}
 
 	return columns, nil
 }
 
-func (m *manager) fetchIndexes(ctx context.Context, connID, schemaName, tableName string) ([]IndexInfo, error) {
+// fetchGeoColumns 从 PostGIS 的 geometry_columns / geography_columns 视图中获取 Schema 下的空间列信息。
+// 返回 表名 -> 列名 -> GeoInfo；未安装 PostGIS 时查询会失败，由调用方处理。tables 不为 nil 时只获取其中的表。
+func (m *manager) fetchGeoColumns(ctx context.Context, connID, schemaName string, tables []string) (map[string]map[string]*GeoInfo, error) {
+	query := `
+        SELECT f_table_name::text AS table_name, f_geometry_column::text AS column_name, 'geometry' AS kind, srid, type AS geometry_type, coord_dimension
+        FROM geometry_columns
+        WHERE f_table_schema = $1 AND ($2::text[] IS NULL OR f_table_name = ANY($2::text[]))
+        UNION ALL
+        SELECT f_table_name::text AS table_name, f_geography_column::text AS column_name, 'geography' AS kind, srid, type AS geometry_type, coord_dimension
+        FROM geography_columns
+        WHERE f_table_schema = $1 AND ($2::text[] IS NULL OR f_table_name = ANY($2::text[]))
+    `
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	geoInfos := make(map[string]map[string]*GeoInfo)
+	for _, row := range rows {
+		tableName := dbString(row["table_name"])
+		if geoInfos[tableName] == nil {
+			geoInfos[tableName] = make(map[string]*GeoInfo)
+		}
+		geoInfos[tableName][dbString(row["column_name"])] = &GeoInfo{
+			Kind:         dbString(row["kind"]),
+			SRID:         dbInt64(row["srid"]),
+			GeometryType: dbString(row["geometry_type"]),
+			Dimensions:   dbInt64(row["coord_dimension"]),
+		}
+	}
+	return geoInfos, nil
+}
+
+// fetchSchemaIndexes 一次性获取 Schema 下所有表 (tables 不为 nil 时只获取其中的表) 的索引，返回 表名 -> 索引
+func (m *manager) fetchSchemaIndexes(ctx context.Context, connID, schemaName string, tables []string) (map[string][]IndexInfo, error) {
 	query := `
         SELECT
+						t.relname as table_name,
 						i.relname as index_name,
 						am.amname as index_type,
 						ix.indisunique as is_unique,
 						ix.indisprimary as is_primary,
 						obj_description(i.oid, 'pg_class') as description,
 						pg_get_indexdef(i.oid) as index_definition, -- 获取完整定义
+						i.reloptions as options, -- 索引的存储参数 (如 ivfflat 的 lists, hnsw 的 m/ef_construction)
+						(
+								SELECT array_agg(opc.opcname::text ORDER BY o.n)
+								FROM pg_index ixo CROSS JOIN LATERAL unnest(ixo.indclass::oid[]) WITH ORDINALITY AS o(opcoid, n)
+								JOIN pg_opclass opc ON opc.oid = o.opcoid
+								WHERE ixo.indexrelid = i.oid
+						) as opclasses, -- 每个索引列的操作符类
 						-- 获取索引列名，处理表达式索引
 						array_agg(
 								CASE
@@ -318,19 +601,19 @@ func (m *manager) fetchIndexes(ctx context.Context, connID, schemaName, tableNam
 						pg_attribute a ON a.attrelid = t.oid AND a.attnum = ix.indkey[k.attpos] -- 使用 ix.indkey[k.attpos]
 				WHERE
 						n.nspname = $1
-						AND t.relname = $2
+						AND ($2::text[] IS NULL OR t.relname = ANY($2::text[]))
 						AND ix.indislive -- 只选择有效的索引
 				GROUP BY
-						i.relname, i.oid, am.amname, ix.indisunique, ix.indisprimary
+						t.relname, i.relname, i.oid, i.reloptions, am.amname, ix.indisunique, ix.indisprimary
 				ORDER BY
-						i.relname;
+						t.relname, i.relname;
     `
-	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tableName)
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tables)
 	if err != nil {
 		return nil, err
 	}
 
-	indexes := make([]IndexInfo, 0, len(rows))
+	indexes := make(map[string][]IndexInfo)
 	for _, row := range rows {
 		// 需要小心处理 array_agg 返回的类型，它可能是 []interface{} 或特定类型数组
 		var cols []string
@@ -353,15 +636,20 @@ func (m *manager) fetchIndexes(ctx context.Context, connID, schemaName, tableNam
 			IsPrimary:       row["is_primary"].(bool),
 			IndexDefinition: dbString(row["index_definition"]),
 			Description:     dbString(row["description"]),
+			Options:         parseRelOptions(interfaceSliceToStringSlice(row["options"])),
+			OpClasses:       interfaceSliceToStringSlice(row["opclasses"]),
 		}
-		indexes = append(indexes, idx)
+		tableName := dbString(row["table_name"])
+		indexes[tableName] = append(indexes[tableName], idx)
 	}
 	return indexes, nil
 }
 
-func (m *manager) fetchForeignKeys(ctx context.Context, connID, schemaName, tableName string) ([]ForeignKeyInfo, error) {
+// fetchSchemaForeignKeys 一次性获取 Schema 下所有表 (tables 不为 nil 时只获取其中的表) 的外键，返回 表名 -> 外键
+func (m *manager) fetchSchemaForeignKeys(ctx context.Context, connID, schemaName string, tables []string) (map[string][]ForeignKeyInfo, error) {
 	query := `
         SELECT
+            t.relname as table_name,
             c.conname as constraint_name,
             ARRAY_AGG(col.attname ORDER BY u.attposition) as column_names,
             nr.nspname as referenced_schema,
@@ -388,19 +676,19 @@ func (m *manager) fetchForeignKeys(ctx context.Context, connID, schemaName, tabl
             pg_attribute ref_col ON ref_col.attrelid = c.confrelid AND ref_col.attnum = u2.attnum
         WHERE
             n.nspname = $1
-            AND t.relname = $2
+            AND ($2::text[] IS NULL OR t.relname = ANY($2::text[]))
             AND c.contype = 'f' -- 只选择外键约束
         GROUP BY
-            c.conname, nr.nspname, ref_table.relname, c.oid
+            t.relname, c.conname, nr.nspname, ref_table.relname, c.oid
         ORDER BY
-            c.conname
+            t.relname, c.conname
     `
-	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tableName)
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tables)
 	if err != nil {
 		return nil, err
 	}
 
-	foreignKeys := make([]ForeignKeyInfo, 0, len(rows))
+	foreignKeys := make(map[string][]ForeignKeyInfo)
 	for _, row := range rows {
 		// 处理可能的数组类型转换
 		cols := interfaceSliceToStringSlice(row["column_names"])
@@ -414,44 +702,204 @@ func (m *manager) fetchForeignKeys(ctx context.Context, connID, schemaName, tabl
 			ReferencedColumns: refCols,
 			Description:       dbString(row["description"]),
 		}
-		foreignKeys = append(foreignKeys, fk)
+		tableName := dbString(row["table_name"])
+		foreignKeys[tableName] = append(foreignKeys[tableName], fk)
 	}
 	return foreignKeys, nil
 }
 
-// fetchConstraintsForTable 获取指定表的所有约束信息 (供内部使用)
-func (m *manager) fetchConstraintsForTable(ctx context.Context, connID, schemaName, tableName string) ([]map[string]any, error) {
+// fetchTypes 获取 Schema 下的枚举、复合类型和域，排除由扩展创建的类型和表的行类型。
+func (m *manager) fetchTypes(ctx context.Context, connID, schemaName string) ([]TypeInfo, error) {
 	query := `
         SELECT
-            c.conname as constraint_name,
-            c.contype as constraint_type,
-            CASE
-                WHEN c.contype = 'p' THEN 'PRIMARY KEY'
-                WHEN c.contype = 'u' THEN 'UNIQUE'
-                WHEN c.contype = 'f' THEN 'FOREIGN KEY'
-                WHEN c.contype = 'c' THEN 'CHECK'
-                ELSE 'OTHER'
-            END as constraint_type_desc,
-            ARRAY_AGG(col.attname ORDER BY u.attposition) filter (where col.attname is not null) as column_names -- 过滤掉可能的 NULL
-        FROM
-            pg_constraint c
-        JOIN
-            pg_namespace n ON n.oid = c.connamespace
-        JOIN
-            pg_class t ON t.oid = c.conrelid
-        LEFT JOIN
-            LATERAL unnest(c.conkey) WITH ORDINALITY AS u(attnum, attposition) ON TRUE
-        LEFT JOIN
-            pg_attribute col ON col.attrelid = t.oid AND col.attnum = u.attnum
+            t.typname::text AS type_name,
+            t.typtype::text AS type_kind,
+            obj_description(t.oid, 'pg_type') AS description,
+            (SELECT array_agg(e.enumlabel::text ORDER BY e.enumsortorder)
+               FROM pg_enum e WHERE e.enumtypid = t.oid) AS enum_labels,
+            (SELECT array_agg(a.attname::text ORDER BY a.attnum)
+               FROM pg_attribute a WHERE a.attrelid = t.typrelid AND a.attnum > 0 AND NOT a.attisdropped) AS attribute_names,
+            (SELECT array_agg(format_type(a.atttypid, a.atttypmod) ORDER BY a.attnum)
+               FROM pg_attribute a WHERE a.attrelid = t.typrelid AND a.attnum > 0 AND NOT a.attisdropped) AS attribute_types,
+            CASE WHEN t.typtype = 'd' THEN format_type(t.typbasetype, t.typtypmod) END AS base_type,
+            t.typnotnull AS not_null,
+            t.typdefault AS default_value,
+            (SELECT array_agg(pg_get_constraintdef(c.oid) ORDER BY c.conname)
+               FROM pg_constraint c WHERE c.contypid = t.oid) AS checks
+        FROM pg_type t
+        JOIN pg_namespace n ON n.oid = t.typnamespace
+        LEFT JOIN pg_class rel ON rel.oid = t.typrelid
         WHERE
             n.nspname = $1
-            AND t.relname = $2
-        GROUP BY
-            c.conname, c.contype
-        ORDER BY
-            c.contype, c.conname
+            AND t.typtype IN ('e', 'c', 'd')
+            AND (t.typtype <> 'c' OR rel.relkind = 'c') -- 只保留独立的复合类型，排除表/视图的行类型
+            AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = t.oid AND d.deptype = 'e') -- 排除扩展创建的类型
+        ORDER BY t.typname
+    `
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	types := make([]TypeInfo, 0, len(rows))
+	for _, row := range rows {
+		typeInfo := TypeInfo{
+			Name:        dbString(row["type_name"]),
+			Description: dbString(row["description"]),
+		}
+		switch dbString(row["type_kind"]) {
+		case "e":
+			typeInfo.Kind = EnumType
+			typeInfo.EnumLabels = interfaceSliceToStringSlice(row["enum_labels"])
+		case "c":
+			typeInfo.Kind = CompositeType
+			names := interfaceSliceToStringSlice(row["attribute_names"])
+			attrTypes := interfaceSliceToStringSlice(row["attribute_types"])
+			for i := 0; i < len(names) && i < len(attrTypes); i++ {
+				typeInfo.Attributes = append(typeInfo.Attributes, TypeAttribute{Name: names[i], Type: attrTypes[i]})
+			}
+		case "d":
+			typeInfo.Kind = DomainType
+			typeInfo.BaseType = dbString(row["base_type"])
+			typeInfo.NotNull, _ = row["not_null"].(bool)
+			typeInfo.Default = dbStringPtr(row["default_value"])
+			typeInfo.Checks = interfaceSliceToStringSlice(row["checks"])
+		}
+		types = append(types, typeInfo)
+	}
+	return types, nil
+}
+
+// fetchRasterColumns 从 PostGIS 的 raster_columns / raster_overviews 视图中获取 Schema 下的栅格列信息。
+// 返回 表名 -> 列名 -> RasterInfo。tables 不为 nil 时只获取其中的表。
+func (m *manager) fetchRasterColumns(ctx context.Context, connID, schemaName string, tables []string) (map[string]map[string]*RasterInfo, error) {
+	query := `
+        SELECT
+            rc.r_table_name::text AS table_name,
+            rc.r_raster_column::text AS column_name,
+            rc.srid, rc.scale_x, rc.scale_y, rc.blocksize_x, rc.blocksize_y,
+            rc.num_bands, rc.pixel_types, rc.out_db, rc.same_alignment,
+            ro.r_table_schema || '.' || ro.r_table_name || '.' || ro.r_raster_column AS overview_of,
+            ro.overview_factor
+        FROM raster_columns rc
+        LEFT JOIN raster_overviews ro
+            ON ro.o_table_schema = rc.r_table_schema
+            AND ro.o_table_name = rc.r_table_name
+            AND ro.o_raster_column = rc.r_raster_column
+        WHERE rc.r_table_schema = $1 AND ($2::text[] IS NULL OR rc.r_table_name = ANY($2::text[]))
+    `
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	rasterInfos := make(map[string]map[string]*RasterInfo)
+	for _, row := range rows {
+		raster := &RasterInfo{
+			SRID:          dbInt64(row["srid"]),
+			ScaleX:        dbFloat64Ptr(row["scale_x"]),
+			ScaleY:        dbFloat64Ptr(row["scale_y"]),
+			BlockSizeX:    dbInt64(row["blocksize_x"]),
+			BlockSizeY:    dbInt64(row["blocksize_y"]),
+			NumBands:      dbInt64(row["num_bands"]),
+			PixelTypes:    interfaceSliceToStringSlice(row["pixel_types"]),
+			OverviewOf:    dbString(row["overview_of"]),
+			OverviewLevel: dbInt64(row["overview_factor"]),
+		}
+		raster.SameAlignment, _ = row["same_alignment"].(bool)
+		if outDB, ok := row["out_db"].([]any); ok {
+			for _, v := range outDB {
+				b, _ := v.(bool)
+				raster.OutDB = append(raster.OutDB, b)
+			}
+		}
+		tableName := dbString(row["table_name"])
+		if rasterInfos[tableName] == nil {
+			rasterInfos[tableName] = make(map[string]*RasterInfo)
+		}
+		rasterInfos[tableName][dbString(row["column_name"])] = raster
+	}
+	return rasterInfos, nil
+}
+
+// fetchTopologies 从 topology.topology 获取已注册的 PostGIS 拓扑。
+// 返回 Schema 名 -> TopologyInfo (每个拓扑的数据保存在与其同名的 Schema 中)。
+func (m *manager) fetchTopologies(ctx context.Context, connID string) (map[string]*TopologyInfo, error) {
+	query := `SELECT id, name::text AS name, srid, precision, hasz FROM topology.topology ORDER BY id`
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query)
+	if err != nil {
+		return nil, err
+	}
+
+	topologies := make(map[string]*TopologyInfo, len(rows))
+	for _, row := range rows {
+		topology := &TopologyInfo{
+			ID:   dbInt64(row["id"]),
+			Name: dbString(row["name"]),
+			SRID: dbInt64(row["srid"]),
+		}
+		if precision := dbFloat64Ptr(row["precision"]); precision != nil {
+			topology.Precision = *precision
+		}
+		topology.HasZ, _ = row["hasz"].(bool)
+		topologies[topology.Name] = topology
+	}
+	return topologies, nil
+}
+
+// fetchFunctions 获取 Schema 下的用户函数和存储过程，排除由扩展创建的函数
+func (m *manager) fetchFunctions(ctx context.Context, connID, schemaName string) ([]FunctionInfo, error) {
+	query := `
+        SELECT
+            p.proname::text AS function_name,
+            CASE p.prokind WHEN 'p' THEN 'procedure' WHEN 'a' THEN 'aggregate' WHEN 'w' THEN 'window' ELSE 'function' END AS kind,
+            pg_get_function_arguments(p.oid) AS arguments,
+            ARRAY(
+                SELECT format_type(t.oid, NULL)
+                FROM unnest(p.proargtypes) WITH ORDINALITY AS t(oid, ord)
+                ORDER BY t.ord
+            )::text[] AS arg_types,
+            ARRAY(
+                -- 与 proargtypes 对齐: 函数只保留输入参数，存储过程 (PG14+) 的 proargtypes 包含 OUT 参数
+                SELECT CASE m.mode WHEN 'o' THEN 'out' WHEN 'b' THEN 'inout' WHEN 'v' THEN 'variadic' ELSE 'in' END
+                FROM unnest(COALESCE(p.proargmodes, array_fill('i'::"char", ARRAY[p.pronargs::int]))) WITH ORDINALITY AS m(mode, ord)
+                WHERE p.prokind = 'p' OR m.mode IN ('i', 'b', 'v')
+                ORDER BY m.ord
+            )::text[] AS arg_modes,
+            p.pronargdefaults::int AS default_args,
+            CASE WHEN p.prokind = 'p' THEN NULL ELSE pg_get_function_result(p.oid) END AS return_type,
+            l.lanname::text AS language,
+            CASE p.provolatile WHEN 'i' THEN 'immutable' WHEN 's' THEN 'stable' ELSE 'volatile' END AS volatility,
+            obj_description(p.oid, 'pg_proc') AS description
+        FROM pg_proc p
+        JOIN pg_namespace n ON n.oid = p.pronamespace
+        JOIN pg_language l ON l.oid = p.prolang
+        WHERE
+            n.nspname = $1
+            AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = p.oid AND d.deptype = 'e') -- 排除扩展创建的函数
+        ORDER BY p.proname, pg_get_function_arguments(p.oid)
     `
-	return m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tableName)
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	functions := make([]FunctionInfo, 0, len(rows))
+	for _, row := range rows {
+		functions = append(functions, FunctionInfo{
+			Name:        dbString(row["function_name"]),
+			Kind:        dbString(row["kind"]),
+			Arguments:   dbString(row["arguments"]),
+			ArgTypes:    interfaceSliceToStringSlice(row["arg_types"]),
+			ArgModes:    interfaceSliceToStringSlice(row["arg_modes"]),
+			DefaultArgs: dbInt64(row["default_args"]),
+			ReturnType:  dbString(row["return_type"]),
+			Language:    dbString(row["language"]),
+			Volatility:  dbString(row["volatility"]),
+			Description: dbString(row["description"]),
+		})
+	}
+	return functions, nil
 }
 
 // --- 数据库 NULL 值处理辅助函数 ---
@@ -505,6 +953,71 @@ func dbInt64(v any) int64 {
 	}
 }
 
+// dbFloat64Ptr 安全地从 map[string]any 中获取 float64 指针，处理 nil
+func dbFloat64Ptr(v any) *float64 {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case float64:
+		return &val
+	case float32:
+		f := float64(val)
+		return &f
+	default:
+		utils.DefaultLogger.Warn("预期数据库返回浮点类型，但类型不匹配", zap.Any("value", v), zap.String("type", fmt.Sprintf("%T", v)))
+		return nil
+	}
+}
+
+// triggerEnabledState 将 pg_trigger.tgenabled 的代码转换为可读的状态
+func triggerEnabledState(code string) string {
+	switch code {
+	case "O":
+		return "enabled" // 在 origin 和 local 模式下触发
+	case "D":
+		return "disabled"
+	case "R":
+		return "replica" // 仅在 replica 模式下触发
+	case "A":
+		return "always"
+	default:
+		return code
+	}
+}
+
+// hasGeoColumn 检查列中是否包含 PostGIS 空间类型 (类型名可能带 Schema 前缀或类型修饰符，如 geometry(Point,4326))
+func hasGeoColumn(columns []ColumnInfo) bool {
+	for _, col := range columns {
+		if strings.Contains(col.Type, "geometry") || strings.Contains(col.Type, "geography") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRasterColumn 检查列中是否包含 PostGIS 栅格类型
+func hasRasterColumn(columns []ColumnInfo) bool {
+	for _, col := range columns {
+		if strings.Contains(col.Type, "raster") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRelOptions 将 reloptions (形如 ["lists=100", "m=16"]) 解析为键值对
+func parseRelOptions(options []string) map[string]string {
+	if len(options) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(options))
+	for _, option := range options {
+		key, value, _ := strings.Cut(option, "=")
+		result[key] = value
+	}
+	return result
+}
+
 // stringInSlice 检查字符串是否在字符串切片中
 func stringInSlice(a string, list []string) bool {
 	for _, b := range list {
@@ -0,0 +1,200 @@
+package schemas
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// cacheFileVersion 是持久化缓存文件的格式版本。
+// DatabaseInfo 的结构或加载逻辑不兼容地变化时递增，旧版本的文件会被忽略。
+const cacheFileVersion = 4
+
+// cacheFile 是写入 SCHEMA_CACHE_DIR 的缓存文件
+type cacheFile struct {
+	Version     int                `json:"version"`
+	Fingerprint string             `json:"fingerprint"`          // 连接指向的数据库 (databases.ConnectionSummary.Fingerprint)
+	Checksum    string             `json:"checksum"`             // 加载时数据库目录的校验和
+	Signatures  *catalogSignatures `json:"signatures,omitempty"` // 加载时各对象的目录签名，用于增量刷新
+	Options     string             `json:"options"`              // 加载选项 (访问策略, 脱敏规则等) 的摘要
+	ConnID      string             `json:"conn_id"`
+	LoadedAt    time.Time          `json:"loaded_at"`
+	Database    *DatabaseInfo      `json:"database"`
+}
+
+// catalogChecksumQuery 计算用户对象目录行的校验和。
+// DDL 会插入、删除或更新目录行 (更新产生新的 xmin)，ANALYZE 等原地更新不改变 xmin，因此统计信息变化不触发重新加载。
+// 临时表和 TOAST 所在的 Schema 被排除，避免会话级的临时对象不断改变校验和。
+const catalogChecksumQuery = `
+    WITH ns AS (
+        SELECT oid, xmin FROM pg_namespace
+        WHERE nspname NOT IN ('pg_catalog', 'information_schema')
+          AND nspname NOT LIKE 'pg\_toast%' AND nspname NOT LIKE 'pg\_temp%'
+    ), rel AS (
+        SELECT c.oid, c.xmin FROM pg_class c WHERE c.relnamespace IN (SELECT oid FROM ns)
+    )
+    SELECT md5(concat_ws('|',
+        (SELECT string_agg(oid::text || ':' || xmin::text, ',' ORDER BY oid) FROM ns),
+        (SELECT string_agg(oid::text || ':' || xmin::text, ',' ORDER BY oid) FROM rel),
+        (SELECT string_agg(a.attrelid::text || '.' || a.attnum::text || ':' || a.xmin::text, ',' ORDER BY a.attrelid, a.attnum)
+           FROM pg_attribute a WHERE a.attrelid IN (SELECT oid FROM rel) AND a.attnum > 0),
+        (SELECT string_agg(oid::text || ':' || xmin::text, ',' ORDER BY oid) FROM pg_constraint WHERE connamespace IN (SELECT oid FROM ns)),
+        (SELECT string_agg(oid::text || ':' || xmin::text, ',' ORDER BY oid) FROM pg_trigger WHERE tgrelid IN (SELECT oid FROM rel)),
+        (SELECT string_agg(oid::text || ':' || xmin::text, ',' ORDER BY oid) FROM pg_proc WHERE pronamespace IN (SELECT oid FROM ns)),
+        (SELECT string_agg(oid::text || ':' || xmin::text, ',' ORDER BY oid) FROM pg_type WHERE typnamespace IN (SELECT oid FROM ns)),
+        (SELECT string_agg(oid::text || ':' || xmin::text, ',' ORDER BY oid) FROM pg_enum),
+        (SELECT string_agg(objoid::text || '.' || classoid::text || '.' || objsubid::text || ':' || md5(description), ',' ORDER BY objoid, classoid, objsubid)
+           FROM pg_description WHERE objoid >= 16384) -- 只包含用户对象的注释
+    )) AS checksum
+`
+
+// fetchCatalogChecksum 返回数据库目录的校验和，用于判断持久化的缓存是否仍然有效
+func (m *manager) fetchCatalogChecksum(ctx context.Context, connID string) (string, error) {
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, catalogChecksumQuery)
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", fmt.Errorf("校验和查询没有返回结果")
+	}
+	return dbString(rows[0]["checksum"]), nil
+}
+
+// loadOptions 返回影响缓存内容的加载选项的摘要: 访问策略过滤掉的对象和脱敏标记都会写入缓存
+func (m *manager) loadOptions(connID string) string {
+	data, _ := json.Marshal(struct {
+		Policies              sqlguard.Policies
+		MaskingRules          []masking.Rule
+		IncludePostGISObjects bool
+	}{m.dbService.Policies(connID), m.maskingRules, m.includePostGISObjects})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheFilePath 返回 connID 指向的数据库的缓存文件路径和数据库指纹，connID 未注册时返回空字符串
+func (m *manager) cacheFilePath(ctx context.Context, connID string) (string, string) {
+	for _, conn := range m.dbService.ListConnections(ctx, false) {
+		if conn.ConnID == connID {
+			fingerprint := conn.Fingerprint()
+			return filepath.Join(m.cacheDir, "schema-"+fingerprint+".json"), fingerprint
+		}
+	}
+	return "", ""
+}
+
+// saveCacheFile 把加载完成的缓存写入文件，先写临时文件再替换；写入失败只记录日志
+func (m *manager) saveCacheFile(ctx context.Context, connID string, info *DatabaseInfo, loadedAt time.Time, checksum string, signatures *catalogSignatures) {
+	if m.cacheDir == "" {
+		return
+	}
+	path, fingerprint := m.cacheFilePath(ctx, connID)
+	if path == "" {
+		return
+	}
+	data, err := json.Marshal(cacheFile{
+		Version:     cacheFileVersion,
+		Fingerprint: fingerprint,
+		Checksum:    checksum,
+		Signatures:  signatures,
+		Options:     m.loadOptions(connID),
+		ConnID:      connID,
+		LoadedAt:    loadedAt,
+		Database:    info,
+	})
+	if err != nil {
+		utils.DefaultLogger.Warn("编码 Schema 缓存失败", zap.String("connID", connID), zap.Error(err))
+		return
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		utils.DefaultLogger.Warn("写入 Schema 缓存文件失败", zap.String("path", path), zap.Error(err))
+		return
+	}
+	utils.DefaultLogger.Info("Schema 缓存已写入文件", zap.String("path", path), zap.Int("bytes", len(data)))
+}
+
+// writeFileAtomic 写入临时文件后替换 path，写入失败时不会留下不完整的文件
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".schema-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// WarmStart 实现 Manager 接口。
+func (m *manager) WarmStart(ctx context.Context, connID string) bool {
+	if m.cacheDir == "" {
+		return false
+	}
+	path, fingerprint := m.cacheFilePath(ctx, connID)
+	if path == "" {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			utils.DefaultLogger.Info("没有可用的 Schema 缓存文件，执行完整加载", zap.String("path", path))
+		} else {
+			utils.DefaultLogger.Warn("读取 Schema 缓存文件失败，执行完整加载", zap.String("path", path), zap.Error(err))
+		}
+		return false
+	}
+	file := new(cacheFile)
+	if err := json.Unmarshal(data, file); err != nil || file.Database == nil {
+		utils.DefaultLogger.Warn("Schema 缓存文件无效，执行完整加载", zap.String("path", path), zap.Error(err))
+		return false
+	}
+	switch {
+	case file.Version != cacheFileVersion:
+		utils.DefaultLogger.Info("Schema 缓存文件版本不匹配，执行完整加载", zap.String("path", path), zap.Int("version", file.Version))
+		return false
+	case file.Fingerprint != fingerprint:
+		utils.DefaultLogger.Info("Schema 缓存文件属于其他数据库，执行完整加载", zap.String("path", path))
+		return false
+	case file.Options != m.loadOptions(connID):
+		utils.DefaultLogger.Info("访问策略或脱敏规则已变化，不使用 Schema 缓存文件", zap.String("path", path))
+		return false
+	}
+	if file.Database.Schemas == nil {
+		file.Database.Schemas = []SchemaInfo{}
+	}
+
+	m.registerCustomTypes(ctx, connID, file.Database)
+	refresh := m.swapCache(connID, file.Database, file.LoadedAt, file.Checksum, file.Signatures)
+	utils.DefaultLogger.Info("已从文件恢复 Schema 缓存", zap.String("path", path), zap.Time("loadedAt", file.LoadedAt), zap.Int("schemas", len(file.Database.Schemas)))
+	m.emitRefresh(refresh)
+	return true
+}
+
+// RefreshIfChanged 实现 Manager 接口。
+func (m *manager) RefreshIfChanged(ctx context.Context, connID string) (bool, error) {
+	result, err := m.RefreshIncremental(ctx, connID)
+	if err != nil {
+		return false, err
+	}
+	return !result.Unchanged, nil
+}
@@ -0,0 +1,172 @@
+package schemas
+
+import (
+	"sort"
+	"strings"
+)
+
+// 搜索结果中的对象种类
+const (
+	SearchKindTable    = "table"
+	SearchKindColumn   = "column"
+	SearchKindFunction = "function"
+	SearchKindType     = "type"
+)
+
+const defaultSearchLimit = 20 // 默认返回的结果数
+
+// 各匹配方式的得分
+const (
+	scoreNameExact    = 10.0 // 名称与关键字完全相同
+	scoreNamePrefix   = 6.0  // 名称以关键字开头
+	scoreNameWord     = 5.0  // 名称中按下划线分隔的某个单词与关键字相同
+	scoreNameContains = 3.0  // 名称包含关键字
+	scoreDescription  = 2.0  // 注释包含关键字
+	scoreDetail       = 1.0  // 类型/签名/枚举值等附加信息包含关键字
+)
+
+// searchKindWeights 调整不同种类对象的排序权重，表通常是 Agent 最先需要定位的对象
+var searchKindWeights = map[string]float64{
+	SearchKindTable:    1.2,
+	SearchKindColumn:   1.0,
+	SearchKindFunction: 1.0,
+	SearchKindType:     0.9,
+}
+
+// SearchOptions 是 Schema 搜索的可选条件
+type SearchOptions struct {
+	Schema string   // 只在该 Schema 中搜索，为空时搜索全部
+	Kinds  []string // 只返回这些种类 (table, column, function, type)，为空时返回全部
+	Limit  int      // 返回结果数上限，<= 0 时使用默认值
+}
+
+// SearchResult 是一条 Schema 搜索结果
+type SearchResult struct {
+	Kind        string  `json:"kind"`                  // 对象种类
+	Schema      string  `json:"schema"`                // 所在 Schema
+	Table       string  `json:"table,omitempty"`       // 所在表 (仅列)
+	Name        string  `json:"name"`                  // 对象名称
+	Detail      string  `json:"detail,omitempty"`      // 附加信息: 列类型、函数签名、类型种类等
+	Description string  `json:"description,omitempty"` // 对象注释
+	Location    string  `json:"location"`              // 完整位置，例如 public.orders.customer_id
+	Score       float64 `json:"score"`                 // 相关度得分
+}
+
+// SearchSchema 实现 Manager 接口。
+func (m *manager) SearchSchema(keyword string, options SearchOptions) []SearchResult {
+	terms := strings.Fields(strings.ToLower(keyword))
+	if len(terms) == 0 {
+		return []SearchResult{}
+	}
+	limit := options.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	kinds := make(map[string]bool, len(options.Kinds))
+	for _, kind := range options.Kinds {
+		kinds[strings.ToLower(kind)] = true
+	}
+	wantKind := func(kind string) bool { return len(kinds) == 0 || kinds[kind] }
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := []SearchResult{}
+	add := func(result SearchResult, detailTexts ...string) {
+		score := scoreMatch(terms, result.Name, result.Description, detailTexts)
+		if score == 0 {
+			return
+		}
+		result.Score = score * searchKindWeights[result.Kind]
+		results = append(results, result)
+	}
+
+	for _, schema := range m.cache.Schemas {
+		if options.Schema != "" && schema.Name != options.Schema {
+			continue
+		}
+		for _, table := range schema.Tables {
+			if wantKind(SearchKindTable) {
+				add(SearchResult{
+					Kind: SearchKindTable, Schema: schema.Name, Name: table.Name,
+					Description: table.Description, Location: schema.Name + "." + table.Name,
+				})
+			}
+			if wantKind(SearchKindColumn) {
+				for _, col := range table.Columns {
+					add(SearchResult{
+						Kind: SearchKindColumn, Schema: schema.Name, Table: table.Name, Name: col.Name,
+						Detail: col.Type, Description: col.Description,
+						Location: schema.Name + "." + table.Name + "." + col.Name,
+					}, col.Type)
+				}
+			}
+		}
+		if wantKind(SearchKindFunction) {
+			for _, fn := range schema.Functions {
+				signature := fn.Name + "(" + fn.Arguments + ")"
+				if fn.ReturnType != "" {
+					signature += " RETURNS " + fn.ReturnType
+				}
+				add(SearchResult{
+					Kind: SearchKindFunction, Schema: schema.Name, Name: fn.Name,
+					Detail: signature, Description: fn.Description, Location: schema.Name + "." + fn.Name,
+				}, fn.Arguments)
+			}
+		}
+		if wantKind(SearchKindType) {
+			for _, t := range schema.Types {
+				add(SearchResult{
+					Kind: SearchKindType, Schema: schema.Name, Name: t.Name,
+					Detail: t.Kind, Description: t.Description, Location: schema.Name + "." + t.Name,
+				}, t.EnumLabels...)
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Location < results[j].Location
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// scoreMatch 计算所有关键字在名称、注释和附加信息中的匹配得分之和
+func scoreMatch(terms []string, name, description string, details []string) float64 {
+	lowerName := strings.ToLower(name)
+	lowerDescription := strings.ToLower(description)
+	nameWords := strings.FieldsFunc(lowerName, func(r rune) bool { return r == '_' || r == '.' })
+
+	total := 0.0
+	for _, term := range terms {
+		score := 0.0
+		switch {
+		case lowerName == term:
+			score = scoreNameExact
+		case strings.HasPrefix(lowerName, term):
+			score = scoreNamePrefix
+		case stringInSlice(term, nameWords):
+			score = scoreNameWord
+		case strings.Contains(lowerName, term):
+			score = scoreNameContains
+		}
+		if lowerDescription != "" && strings.Contains(lowerDescription, term) {
+			score += scoreDescription
+		}
+		if score == 0 {
+			for _, detail := range details {
+				if strings.Contains(strings.ToLower(detail), term) {
+					score = scoreDetail
+					break
+				}
+			}
+		}
+		total += score
+	}
+	return total
+}
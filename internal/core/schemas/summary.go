@@ -0,0 +1,167 @@
+package schemas
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// 摘要的详细程度，从详细到精简依次降级，直到满足 token 预算
+const (
+	summaryDetailFull  = iota // 关键列 + 部分普通列 + 注释
+	summaryDetailKeys         // 仅关键列 (主键, 外键, 唯一)
+	summaryDetailNames        // 仅表名
+)
+
+// summaryMaxOtherColumns 是详细模式下每张表额外展示的普通列数
+const summaryMaxOtherColumns = 5
+
+// SummarizeDatabase 生成适合放入 LLM 上下文的 Markdown 摘要: Schema -> 表 -> 关键列及外键关系。
+// tokenBudget 是摘要的近似 token 上限；内容过多时依次降低详细程度，最后按行截断。
+func SummarizeDatabase(info *DatabaseInfo, tokenBudget int) string {
+	if info == nil {
+		return ""
+	}
+	var summary string
+	for level := summaryDetailFull; level <= summaryDetailNames; level++ {
+		summary = renderSummary(info, level)
+		if tokenBudget <= 0 || EstimateTokens(summary) <= tokenBudget {
+			return summary
+		}
+	}
+	return truncateSummary(summary, tokenBudget)
+}
+
+// EstimateTokens 粗略估算文本的 token 数: ASCII 字符约 4 个一个 token，其他字符 (如中文) 约 1 个一个 token。
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// renderSummary 按指定的详细程度渲染摘要
+func renderSummary(info *DatabaseInfo, level int) string {
+	var sb strings.Builder
+	sb.WriteString("# Database summary\n")
+	if info.Features != nil {
+		sb.WriteString(fmt.Sprintf("PostgreSQL %s", info.Features.PgVersion))
+		var extensions []string
+		if info.Features.HasPostGIS {
+			extensions = append(extensions, "postgis")
+		}
+		if info.Features.HasPGVector {
+			extensions = append(extensions, "pgvector")
+		}
+		if info.Features.HasTimescale {
+			extensions = append(extensions, "timescaledb")
+		}
+		if len(extensions) > 0 {
+			sb.WriteString("; extensions: " + strings.Join(extensions, ", "))
+		}
+		if info.Features.ReadOnly {
+			sb.WriteString("; read-only")
+		}
+		sb.WriteString("\n")
+	}
+
+	for _, schema := range info.Schemas {
+		sb.WriteString(fmt.Sprintf("\n## %s (%d tables)\n", schema.Name, len(schema.Tables)))
+		if level == summaryDetailFull && schema.Description != "" {
+			sb.WriteString(schema.Description + "\n")
+		}
+		if level == summaryDetailNames {
+			names := make([]string, 0, len(schema.Tables))
+			for _, table := range schema.Tables {
+				names = append(names, table.Name)
+			}
+			sb.WriteString(strings.Join(names, ", ") + "\n")
+			continue
+		}
+		for _, table := range schema.Tables {
+			sb.WriteString(renderTableSummary(table, level))
+		}
+	}
+	return sb.String()
+}
+
+// renderTableSummary 渲染单张表: "- orders (~1200 rows): id PK, customer_id -> public.customers.id, +8 more"
+func renderTableSummary(table TableInfo, level int) string {
+	fkTargets := make(map[string]string)
+	for _, fk := range table.ForeignKeys {
+		for i, col := range fk.Columns {
+			if i < len(fk.ReferencedColumns) {
+				fkTargets[col] = fk.ReferencedSchema + "." + fk.ReferencedTable + "." + fk.ReferencedColumns[i]
+			}
+		}
+	}
+
+	var parts []string
+	otherShown, hidden := 0, 0
+	for _, col := range table.Columns {
+		var markers []string
+		for _, constraint := range col.Constraints {
+			switch constraint {
+			case PrimaryKeyConstraint:
+				markers = append(markers, "PK")
+			case UniqueConstraint:
+				markers = append(markers, "UQ")
+			}
+		}
+		target, isFK := fkTargets[col.Name]
+		isKey := len(markers) > 0 || isFK
+
+		if !isKey {
+			if level == summaryDetailFull && otherShown < summaryMaxOtherColumns {
+				parts = append(parts, col.Name+" "+col.Type)
+				otherShown++
+			} else {
+				hidden++
+			}
+			continue
+		}
+		part := col.Name
+		if len(markers) > 0 {
+			part += " " + strings.Join(markers, "/")
+		}
+		if isFK {
+			part += " -> " + target
+		}
+		parts = append(parts, part)
+	}
+	if hidden > 0 {
+		parts = append(parts, fmt.Sprintf("+%d more", hidden))
+	}
+
+	rows := fmt.Sprintf("~%d rows", table.RowCount)
+	if table.Hypertable != nil && table.Hypertable.TimeColumn != "" {
+		rows += ", hypertable on " + table.Hypertable.TimeColumn
+	}
+	line := fmt.Sprintf("- %s (%s): %s", table.Name, rows, strings.Join(parts, ", "))
+	if level == summaryDetailFull && table.Description != "" {
+		line += " — " + table.Description
+	}
+	return line + "\n"
+}
+
+// truncateSummary 按行截断摘要以满足预算，并注明省略的行数
+func truncateSummary(summary string, tokenBudget int) string {
+	lines := strings.Split(strings.TrimRight(summary, "\n"), "\n")
+	var sb strings.Builder
+	used := 0
+	for i, line := range lines {
+		cost := EstimateTokens(line + "\n")
+		if used+cost > tokenBudget {
+			sb.WriteString(fmt.Sprintf("... (已省略 %d 行，可缩小范围或使用 search_schema 定位对象)\n", len(lines)-i))
+			break
+		}
+		sb.WriteString(line + "\n")
+		used += cost
+	}
+	return sb.String()
+}
@@ -0,0 +1,128 @@
+package schemas
+
+import (
+	"strings"
+
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// 时态表的识别模式
+const (
+	TemporalPeriodColumns = "period_columns" // 一对有效期列 (valid_from / valid_to 等)
+	TemporalRangeColumn   = "range_column"   // 单个范围类型列 (sys_period tstzrange 等)
+	TemporalHistoryTable  = "history_table"  // 当前表 + *_history 历史表 (temporal_tables 扩展或触发器维护)
+)
+
+// periodColumnPairs 是常见的有效期列命名，按优先级排列
+var periodColumnPairs = [][2]string{
+	{"valid_from", "valid_to"},
+	{"valid_from", "valid_until"},
+	{"effective_from", "effective_to"},
+	{"effective_start", "effective_end"},
+	{"sys_start", "sys_end"},
+	{"start_ts", "end_ts"},
+}
+
+// periodRangeColumns 是常见的范围类型有效期列命名
+var periodRangeColumns = []string{"sys_period", "valid_period", "validity", "period"}
+
+// historyTableSuffixes 是常见的历史/审计表后缀
+var historyTableSuffixes = []string{"_history", "_hist", "_audit", "_log"}
+
+// detectTemporalPatterns 在一个 Schema 加载完成后识别时态表/历史表模式，并写入 TableInfo.Temporal。
+// 识别基于命名惯例和触发器定义，属于启发式结果。
+func detectTemporalPatterns(schema *SchemaInfo) {
+	tablesByName := make(map[string]*TableInfo, len(schema.Tables))
+	for i := range schema.Tables {
+		tablesByName[schema.Tables[i].Name] = &schema.Tables[i]
+	}
+
+	for i := range schema.Tables {
+		table := &schema.Tables[i]
+		if temporal := detectPeriodColumns(table); temporal != nil {
+			if table.Temporal != nil {
+				temporal.IsHistoryOf = table.Temporal.IsHistoryOf // 保留先前作为历史表的标记
+			}
+			table.Temporal = temporal
+		}
+
+		// 历史表优先级更高: 当前表只保存最新版本，as-of 查询需要合并历史表
+		if historyTable, detectedBy := findHistoryTable(table, tablesByName); historyTable != nil {
+			temporal := &TemporalInfo{
+				Pattern:       TemporalHistoryTable,
+				HistorySchema: schema.Name,
+				HistoryTable:  historyTable.Name,
+				DetectedBy:    detectedBy,
+			}
+			// 有效期信息一般保存在历史表 (以及当前表) 上
+			if periodInfo := detectPeriodColumns(historyTable); periodInfo != nil {
+				temporal.ValidFromColumn = periodInfo.ValidFromColumn
+				temporal.ValidToColumn = periodInfo.ValidToColumn
+				temporal.PeriodColumn = periodInfo.PeriodColumn
+			}
+			table.Temporal = temporal
+			// 历史表本身也标记，避免 Agent 把它当成普通业务表
+			if historyTable.Temporal == nil {
+				historyTable.Temporal = &TemporalInfo{Pattern: TemporalHistoryTable, IsHistoryOf: table.Name, DetectedBy: detectedBy}
+			} else {
+				historyTable.Temporal.IsHistoryOf = table.Name
+			}
+		}
+
+		if table.Temporal != nil {
+			utils.DefaultLogger.Debug("识别到时态表模式",
+				zap.String("schema", schema.Name), zap.String("table", table.Name),
+				zap.String("pattern", table.Temporal.Pattern), zap.String("detectedBy", table.Temporal.DetectedBy))
+		}
+	}
+}
+
+// detectPeriodColumns 通过列名和类型识别有效期列
+func detectPeriodColumns(table *TableInfo) *TemporalInfo {
+	columns := make(map[string]ColumnInfo, len(table.Columns))
+	for _, col := range table.Columns {
+		columns[strings.ToLower(col.Name)] = col
+	}
+
+	for _, name := range periodRangeColumns {
+		if col, ok := columns[name]; ok && strings.Contains(col.Type, "range") {
+			return &TemporalInfo{Pattern: TemporalRangeColumn, PeriodColumn: col.Name, DetectedBy: "naming"}
+		}
+	}
+	for _, pair := range periodColumnPairs {
+		from, fromOK := columns[pair[0]]
+		to, toOK := columns[pair[1]]
+		if fromOK && toOK {
+			return &TemporalInfo{Pattern: TemporalPeriodColumns, ValidFromColumn: from.Name, ValidToColumn: to.Name, DetectedBy: "naming"}
+		}
+	}
+	return nil
+}
+
+// findHistoryTable 查找当前表对应的历史表。
+// 先检查触发器定义中是否引用了 *_history 之类的表 (temporal_tables 的 versioning 触发器会带上历史表名)，
+// 再退回到同 Schema 下的命名匹配。
+func findHistoryTable(table *TableInfo, tablesByName map[string]*TableInfo) (*TableInfo, string) {
+	for _, suffix := range historyTableSuffixes {
+		candidate, ok := tablesByName[table.Name+suffix]
+		if !ok {
+			continue
+		}
+		for _, trigger := range table.Triggers {
+			if strings.Contains(trigger.Definition, candidate.Name) {
+				return candidate, "trigger"
+			}
+		}
+	}
+	for _, suffix := range historyTableSuffixes {
+		if candidate, ok := tablesByName[table.Name+suffix]; ok {
+			// *_log / *_audit 命名过于宽泛，只有带有效期列时才认定为历史表
+			if (suffix == "_log" || suffix == "_audit") && detectPeriodColumns(candidate) == nil {
+				continue
+			}
+			return candidate, "naming"
+		}
+	}
+	return nil, ""
+}
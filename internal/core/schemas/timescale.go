@@ -0,0 +1,251 @@
+package schemas
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// TimescaleDB 后台作业的函数名
+const (
+	timescaleRetentionPolicy   = "policy_retention"
+	timescaleCompressionPolicy = "policy_compression"
+	timescaleRefreshPolicy     = "policy_refresh_continuous_aggregate"
+)
+
+// timescaleMetadata 是一次加载得到的 TimescaleDB 元数据
+type timescaleMetadata struct {
+	hypertables map[string]map[string]*HypertableInfo // Schema 名 -> 表名 -> 超表信息
+	rowCounts   map[string]map[string]int64           // Schema 名 -> 表名 -> 各分块的大致行数之和
+	aggregates  map[string][]ContinuousAggregateInfo  // Schema 名 -> 连续聚合
+}
+
+// attachTimescaleMetadata 在安装了 timescaledb 时为缓存中的超表补充分块、压缩和保留策略信息，
+// 并记录各 Schema 下的连续聚合。需要在所有 Schema 加载完成后调用；
+// 缓存中的对象不可修改，有变化的 Schema 的表替换为新的切片。
+func (m *manager) attachTimescaleMetadata(ctx context.Context, connID string, info *DatabaseInfo) {
+	features, err := m.GetFeatures(ctx, connID)
+	if err != nil || !features.HasTimescale {
+		return
+	}
+	metadata, err := m.fetchTimescaleMetadata(ctx, connID)
+	if err != nil {
+		utils.DefaultLogger.Warn("获取 TimescaleDB 元数据失败，超表信息将不完整", zap.String("connID", connID), zap.Error(err))
+		return
+	}
+
+	for i := range info.Schemas {
+		schemaInfo := &info.Schemas[i]
+		schemaInfo.ContinuousAggregates = metadata.aggregates[schemaInfo.Name]
+		hypertables := metadata.hypertables[schemaInfo.Name]
+		tables := slices.Clone(schemaInfo.Tables)
+		for j := range tables {
+			tables[j].Hypertable = hypertables[tables[j].Name]
+			// 超表的父表本身不存储数据，pg_class 中的行数为 0，用各分块的行数之和代替
+			if rows, ok := metadata.rowCounts[schemaInfo.Name][tables[j].Name]; ok && rows > tables[j].RowCount {
+				tables[j].RowCount = rows
+			}
+		}
+		schemaInfo.Tables = tables
+	}
+}
+
+// fetchTimescaleMetadata 从 timescaledb_information 视图中获取超表的维度、压缩设置、后台作业和连续聚合
+func (m *manager) fetchTimescaleMetadata(ctx context.Context, connID string) (*timescaleMetadata, error) {
+	metadata := &timescaleMetadata{
+		hypertables: make(map[string]map[string]*HypertableInfo),
+		rowCounts:   make(map[string]map[string]int64),
+		aggregates:  make(map[string][]ContinuousAggregateInfo),
+	}
+
+	// 压缩分块的行存储在内部的压缩表中，这里的行数只是近似值
+	hypertableRows, err := m.dbService.ExecuteQuery(ctx, connID, true, `
+        SELECT
+            h.hypertable_schema::text AS schema_name,
+            h.hypertable_name::text AS table_name,
+            h.num_chunks::bigint AS num_chunks,
+            h.compression_enabled,
+            (
+                SELECT COALESCE(SUM(GREATEST(c.reltuples, 0)), 0)::bigint
+                FROM timescaledb_information.chunks ch
+                JOIN pg_namespace cn ON cn.nspname = ch.chunk_schema
+                JOIN pg_class c ON c.relnamespace = cn.oid AND c.relname = ch.chunk_name
+                WHERE ch.hypertable_schema = h.hypertable_schema AND ch.hypertable_name = h.hypertable_name
+            ) AS row_count
+        FROM timescaledb_information.hypertables h
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("查询超表失败: %w", err)
+	}
+	for _, row := range hypertableRows {
+		schemaName, tableName := dbString(row["schema_name"]), dbString(row["table_name"])
+		hypertable := &HypertableInfo{NumChunks: dbInt64(row["num_chunks"])}
+		hypertable.CompressionEnabled, _ = row["compression_enabled"].(bool)
+		if metadata.hypertables[schemaName] == nil {
+			metadata.hypertables[schemaName] = make(map[string]*HypertableInfo)
+			metadata.rowCounts[schemaName] = make(map[string]int64)
+		}
+		metadata.hypertables[schemaName][tableName] = hypertable
+		metadata.rowCounts[schemaName][tableName] = dbInt64(row["row_count"])
+	}
+
+	dimensionRows, err := m.dbService.ExecuteQuery(ctx, connID, true, `
+        SELECT
+            hypertable_schema::text AS schema_name,
+            hypertable_name::text AS table_name,
+            column_name::text AS column_name,
+            column_type::text AS column_type,
+            dimension_type::text AS dimension_type,
+            COALESCE(time_interval::text, integer_interval::text) AS chunk_interval
+        FROM timescaledb_information.dimensions
+        ORDER BY hypertable_schema, hypertable_name, dimension_number
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("查询超表维度失败: %w", err)
+	}
+	for _, row := range dimensionRows {
+		hypertable := metadata.hypertables[dbString(row["schema_name"])][dbString(row["table_name"])]
+		if hypertable == nil {
+			continue
+		}
+		if dbString(row["dimension_type"]) == "Time" && hypertable.TimeColumn == "" {
+			hypertable.TimeColumn = dbString(row["column_name"])
+			hypertable.TimeColumnType = dbString(row["column_type"])
+			hypertable.ChunkInterval = dbString(row["chunk_interval"])
+		} else {
+			hypertable.SpaceColumns = append(hypertable.SpaceColumns, dbString(row["column_name"]))
+		}
+	}
+
+	compressionRows, err := m.dbService.ExecuteQuery(ctx, connID, true, `
+        SELECT
+            hypertable_schema::text AS schema_name,
+            hypertable_name::text AS table_name,
+            attname::text AS column_name,
+            segmentby_column_index IS NOT NULL AS is_segmentby,
+            orderby_asc,
+            orderby_nullsfirst
+        FROM timescaledb_information.compression_settings
+        WHERE segmentby_column_index IS NOT NULL OR orderby_column_index IS NOT NULL
+        ORDER BY hypertable_schema, hypertable_name, segmentby_column_index, orderby_column_index
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("查询压缩设置失败: %w", err)
+	}
+	for _, row := range compressionRows {
+		hypertable := metadata.hypertables[dbString(row["schema_name"])][dbString(row["table_name"])]
+		if hypertable == nil {
+			continue
+		}
+		column := dbString(row["column_name"])
+		if segmentBy, _ := row["is_segmentby"].(bool); segmentBy {
+			hypertable.CompressSegmentBy = append(hypertable.CompressSegmentBy, column)
+			continue
+		}
+		if asc, _ := row["orderby_asc"].(bool); !asc {
+			column += " DESC"
+		}
+		if nullsFirst, _ := row["orderby_nullsfirst"].(bool); nullsFirst {
+			column += " NULLS FIRST"
+		}
+		hypertable.CompressOrderBy = append(hypertable.CompressOrderBy, column)
+	}
+
+	jobRows, err := m.dbService.ExecuteQuery(ctx, connID, true, `
+        SELECT
+            job_id::bigint AS job_id,
+            proc_name::text AS proc_name,
+            schedule_interval::text AS schedule_interval,
+            scheduled,
+            config,
+            hypertable_schema::text AS schema_name,
+            hypertable_name::text AS table_name
+        FROM timescaledb_information.jobs
+        WHERE hypertable_name IS NOT NULL
+        ORDER BY job_id
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("查询后台作业失败: %w", err)
+	}
+	// 连续聚合的刷新作业挂在其物化超表上，按 物化超表 -> 作业 记录，供下面的连续聚合查询使用
+	refreshJobs := make(map[string]TimescaleJobInfo)
+	for _, row := range jobRows {
+		job := TimescaleJobInfo{
+			JobID:            dbInt64(row["job_id"]),
+			ProcName:         dbString(row["proc_name"]),
+			ScheduleInterval: dbString(row["schedule_interval"]),
+		}
+		job.Scheduled, _ = row["scheduled"].(bool)
+		job.Config, _ = row["config"].(map[string]any)
+		schemaName, tableName := dbString(row["schema_name"]), dbString(row["table_name"])
+		if job.ProcName == timescaleRefreshPolicy {
+			refreshJobs[schemaName+"."+tableName] = job
+		}
+		hypertable := metadata.hypertables[schemaName][tableName]
+		if hypertable == nil {
+			continue
+		}
+		switch job.ProcName {
+		case timescaleRetentionPolicy:
+			hypertable.RetentionDropAfter = jobConfigString(job.Config, "drop_after")
+		case timescaleCompressionPolicy:
+			hypertable.CompressAfter = jobConfigString(job.Config, "compress_after")
+		}
+		hypertable.Jobs = append(hypertable.Jobs, job)
+	}
+
+	aggregateRows, err := m.dbService.ExecuteQuery(ctx, connID, true, `
+        SELECT
+            view_schema::text AS schema_name,
+            view_name::text AS view_name,
+            hypertable_schema::text AS hypertable_schema,
+            hypertable_name::text AS hypertable_name,
+            materialization_hypertable_schema::text AS materialization_schema,
+            materialization_hypertable_name::text AS materialization_name,
+            materialized_only,
+            compression_enabled,
+            view_definition
+        FROM timescaledb_information.continuous_aggregates
+        ORDER BY view_schema, view_name
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("查询连续聚合失败: %w", err)
+	}
+	for _, row := range aggregateRows {
+		aggregate := ContinuousAggregateInfo{
+			Name:             dbString(row["view_name"]),
+			HypertableSchema: dbString(row["hypertable_schema"]),
+			HypertableName:   dbString(row["hypertable_name"]),
+			Definition:       dbString(row["view_definition"]),
+		}
+		aggregate.MaterializedOnly, _ = row["materialized_only"].(bool)
+		aggregate.CompressionEnabled, _ = row["compression_enabled"].(bool)
+		if job, ok := refreshJobs[dbString(row["materialization_schema"])+"."+dbString(row["materialization_name"])]; ok {
+			aggregate.RefreshStartOffset = jobConfigString(job.Config, "start_offset")
+			aggregate.RefreshEndOffset = jobConfigString(job.Config, "end_offset")
+			aggregate.RefreshInterval = job.ScheduleInterval
+		}
+		schemaName := dbString(row["schema_name"])
+		metadata.aggregates[schemaName] = append(metadata.aggregates[schemaName], aggregate)
+	}
+	return metadata, nil
+}
+
+// jobConfigString 返回作业配置中的偏移量 (时间列为 "7 days" 这样的间隔，整数时间列为数值)
+func jobConfigString(config map[string]any, key string) string {
+	value, ok := config[key]
+	if !ok || value == nil {
+		return ""
+	}
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
@@ -24,13 +24,119 @@ type ForeignKeyInfo struct {
 
 // 索引的关键字
 type IndexInfo struct {
-	IndexName       string   `json:"name" yaml:"name"`                                   // 索引名称
-	IndexType       string   `json:"type" yaml:"type"`                                   // 索引类型 (e.g., btree, hash, gist, gin)
-	Columns         []string `json:"columns" yaml:"columns"`                             // 索引包含的列名
-	IsUnique        bool     `json:"is_unique" yaml:"is_unique"`                         // 是否唯一索引
-	IsPrimary       bool     `json:"is_primary" yaml:"is_primary"`                       // 是否主键索引 (通常与主键约束关联)
-	IndexDefinition string   `json:"definition,omitempty" yaml:"definition,omitempty"`   // 索引的 SQL 定义 (可选)
-	Description     string   `json:"description,omitempty" yaml:"description,omitempty"` // (可选) 索引的注释
+	IndexName       string            `json:"name" yaml:"name"`                                   // 索引名称
+	IndexType       string            `json:"type" yaml:"type"`                                   // 索引类型 (e.g., btree, hash, gist, gin)
+	Columns         []string          `json:"columns" yaml:"columns"`                             // 索引包含的列名
+	IsUnique        bool              `json:"is_unique" yaml:"is_unique"`                         // 是否唯一索引
+	IsPrimary       bool              `json:"is_primary" yaml:"is_primary"`                       // 是否主键索引 (通常与主键约束关联)
+	IndexDefinition string            `json:"definition,omitempty" yaml:"definition,omitempty"`   // 索引的 SQL 定义 (可选)
+	Description     string            `json:"description,omitempty" yaml:"description,omitempty"` // (可选) 索引的注释
+	Options         map[string]string `json:"options,omitempty" yaml:"options,omitempty"`         // 索引存储参数 (reloptions)，例如 lists=100
+	OpClasses       []string          `json:"opclasses,omitempty" yaml:"opclasses,omitempty"`     // 每个索引列使用的操作符类
+}
+
+// 触发器的信息
+type TriggerInfo struct {
+	Name        string   `json:"name" yaml:"name"`                                   // 触发器名称
+	Timing      string   `json:"timing" yaml:"timing"`                               // 触发时机 (BEFORE, AFTER, INSTEAD OF)
+	Events      []string `json:"events" yaml:"events"`                               // 触发事件 (INSERT, UPDATE, DELETE, TRUNCATE)
+	Level       string   `json:"level" yaml:"level"`                                 // 触发级别 (ROW, STATEMENT)
+	Function    string   `json:"function" yaml:"function"`                           // 调用的函数 (schema.function)
+	Enabled     string   `json:"enabled" yaml:"enabled"`                             // 启用状态 (enabled, disabled, replica, always)
+	Definition  string   `json:"definition,omitempty" yaml:"definition,omitempty"`   // 触发器的 SQL 定义
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"` // (可选) 触发器的注释
+}
+
+// 时态表/历史表信息 (启发式识别)
+type TemporalInfo struct {
+	Pattern         string `json:"pattern" yaml:"pattern"`                                         // 识别到的模式 (period_columns, range_column, history_table)
+	ValidFromColumn string `json:"valid_from_column,omitempty" yaml:"valid_from_column,omitempty"` // 有效期开始列
+	ValidToColumn   string `json:"valid_to_column,omitempty" yaml:"valid_to_column,omitempty"`     // 有效期结束列 (NULL 表示当前有效)
+	PeriodColumn    string `json:"period_column,omitempty" yaml:"period_column,omitempty"`         // 范围类型的有效期列
+	HistorySchema   string `json:"history_schema,omitempty" yaml:"history_schema,omitempty"`       // 历史表所在 Schema
+	HistoryTable    string `json:"history_table,omitempty" yaml:"history_table,omitempty"`         // 历史表名
+	IsHistoryOf     string `json:"is_history_of,omitempty" yaml:"is_history_of,omitempty"`         // 若本表是历史表，记录对应的当前表
+	DetectedBy      string `json:"detected_by" yaml:"detected_by"`                                 // 识别依据 (naming, trigger)
+}
+
+// TimescaleDB 超表信息 (来自 timescaledb_information 视图)
+type HypertableInfo struct {
+	TimeColumn         string   `json:"time_column" yaml:"time_column"`                                       // 时间维度列
+	TimeColumnType     string   `json:"time_column_type" yaml:"time_column_type"`                             // 时间维度列的类型 (timestamptz, bigint 等)
+	ChunkInterval      string   `json:"chunk_interval" yaml:"chunk_interval"`                                 // 分块时间间隔 (整数时间列为整数间隔)
+	SpaceColumns       []string `json:"space_columns,omitempty" yaml:"space_columns,omitempty"`               // 按哈希分区的空间维度列
+	NumChunks          int64    `json:"num_chunks" yaml:"num_chunks"`                                         // 分块数量
+	CompressionEnabled bool     `json:"compression_enabled" yaml:"compression_enabled"`                       // 是否开启压缩
+	CompressSegmentBy  []string `json:"compress_segmentby,omitempty" yaml:"compress_segmentby,omitempty"`     // 压缩的 segmentby 列
+	CompressOrderBy    []string `json:"compress_orderby,omitempty" yaml:"compress_orderby,omitempty"`         // 压缩的 orderby 列 (例如 "time DESC")
+	CompressAfter      string   `json:"compress_after,omitempty" yaml:"compress_after,omitempty"`             // 压缩策略: 压缩早于该时间的分块
+	RetentionDropAfter string   `json:"retention_drop_after,omitempty" yaml:"retention_drop_after,omitempty"` // 保留策略: 删除早于该时间的分块
+
+	Jobs []TimescaleJobInfo `json:"jobs,omitempty" yaml:"jobs,omitempty"` // 作用于超表的后台作业 (保留、压缩、重排等策略)
+}
+
+// TimescaleDB 后台作业 (策略) 信息
+type TimescaleJobInfo struct {
+	JobID            int64          `json:"job_id" yaml:"job_id"`                       // 作业 ID
+	ProcName         string         `json:"proc_name" yaml:"proc_name"`                 // 作业函数 (policy_retention, policy_compression 等)
+	ScheduleInterval string         `json:"schedule_interval" yaml:"schedule_interval"` // 执行间隔
+	Scheduled        bool           `json:"scheduled" yaml:"scheduled"`                 // 是否启用调度
+	Config           map[string]any `json:"config,omitempty" yaml:"config,omitempty"`   // 作业配置 (drop_after, compress_after 等)
+}
+
+// TimescaleDB 连续聚合信息
+type ContinuousAggregateInfo struct {
+	Name               string `json:"name" yaml:"name"`                                                     // 连续聚合视图名
+	HypertableSchema   string `json:"hypertable_schema" yaml:"hypertable_schema"`                           // 源超表所在 Schema
+	HypertableName     string `json:"hypertable_name" yaml:"hypertable_name"`                               // 源超表名
+	MaterializedOnly   bool   `json:"materialized_only" yaml:"materialized_only"`                           // 是否只查询已物化的数据 (不合并实时数据)
+	CompressionEnabled bool   `json:"compression_enabled" yaml:"compression_enabled"`                       // 物化数据是否开启压缩
+	RefreshStartOffset string `json:"refresh_start_offset,omitempty" yaml:"refresh_start_offset,omitempty"` // 刷新策略的起始偏移 (为空表示不限)
+	RefreshEndOffset   string `json:"refresh_end_offset,omitempty" yaml:"refresh_end_offset,omitempty"`     // 刷新策略的结束偏移
+	RefreshInterval    string `json:"refresh_interval,omitempty" yaml:"refresh_interval,omitempty"`         // 刷新策略的执行间隔 (没有刷新策略时为空)
+	Definition         string `json:"definition" yaml:"definition"`                                         // 视图定义
+}
+
+// 空间列信息 (来自 PostGIS 的 geometry_columns / geography_columns)
+type GeoInfo struct {
+	Kind         string `json:"kind" yaml:"kind"`                   // geometry 或 geography
+	SRID         int64  `json:"srid" yaml:"srid"`                   // 空间参考 ID (0 表示未指定)
+	GeometryType string `json:"geometry_type" yaml:"geometry_type"` // 几何类型 (POINT, POLYGON, GEOMETRY 等)
+	Dimensions   int64  `json:"dimensions" yaml:"dimensions"`       // 坐标维度 (2, 3, 4)
+}
+
+// 栅格列信息 (来自 PostGIS 的 raster_columns，需开启 SCHEMA_INCLUDE_POSTGIS_OBJECTS)
+type RasterInfo struct {
+	SRID          int64    `json:"srid" yaml:"srid"`                                         // 空间参考 ID
+	ScaleX        *float64 `json:"scale_x,omitempty" yaml:"scale_x,omitempty"`               // X 方向像素大小
+	ScaleY        *float64 `json:"scale_y,omitempty" yaml:"scale_y,omitempty"`               // Y 方向像素大小
+	BlockSizeX    int64    `json:"blocksize_x,omitempty" yaml:"blocksize_x,omitempty"`       // 瓦片宽度 (像素)
+	BlockSizeY    int64    `json:"blocksize_y,omitempty" yaml:"blocksize_y,omitempty"`       // 瓦片高度 (像素)
+	NumBands      int64    `json:"num_bands" yaml:"num_bands"`                               // 波段数
+	PixelTypes    []string `json:"pixel_types,omitempty" yaml:"pixel_types,omitempty"`       // 每个波段的像素类型
+	OutDB         []bool   `json:"out_db,omitempty" yaml:"out_db,omitempty"`                 // 每个波段是否为库外存储
+	SameAlignment bool     `json:"same_alignment" yaml:"same_alignment"`                     // 所有瓦片是否对齐
+	OverviewOf    string   `json:"overview_of,omitempty" yaml:"overview_of,omitempty"`       // 若本列属于金字塔概览表，记录原始表.列
+	OverviewLevel int64    `json:"overview_level,omitempty" yaml:"overview_level,omitempty"` // 概览级别
+}
+
+// 向量索引信息 (pgvector 的 ivfflat / hnsw)
+type VectorIndexInfo struct {
+	Name           string `json:"name" yaml:"name"`                                           // 索引名称
+	Method         string `json:"method" yaml:"method"`                                       // 索引方法 (ivfflat, hnsw)
+	OpClass        string `json:"opclass,omitempty" yaml:"opclass,omitempty"`                 // 操作符类 (如 vector_cosine_ops)
+	Distance       string `json:"distance,omitempty" yaml:"distance,omitempty"`               // 对应的距离度量 (l2, cosine, inner_product, l1, hamming, jaccard)
+	Operator       string `json:"operator,omitempty" yaml:"operator,omitempty"`               // 能使用该索引的距离运算符 (<->, <=>, <#> 等)
+	Lists          int64  `json:"lists,omitempty" yaml:"lists,omitempty"`                     // ivfflat: 聚类数
+	M              int64  `json:"m,omitempty" yaml:"m,omitempty"`                             // hnsw: 每层最大连接数
+	EfConstruction int64  `json:"ef_construction,omitempty" yaml:"ef_construction,omitempty"` // hnsw: 构建时的候选列表大小
+}
+
+// 向量列信息 (pgvector)
+type VectorInfo struct {
+	Type       string            `json:"type" yaml:"type"`                           // 向量类型 (vector, halfvec, sparsevec)
+	Dimensions int64             `json:"dimensions" yaml:"dimensions"`               // 维度 (0 表示未限定)
+	Indexes    []VectorIndexInfo `json:"indexes,omitempty" yaml:"indexes,omitempty"` // 该列上的向量索引
 }
 
 // 列的信息
@@ -41,6 +147,10 @@ type ColumnInfo struct {
 	DefaultValue *string            `json:"default,omitempty" yaml:"default,omitempty"`         // 默认值 (注意: 可能为 NULL)
 	Description  string             `json:"description,omitempty" yaml:"description,omitempty"` // 列注释
 	Constraints  []ColumnConstraint `json:"constraints,omitempty" yaml:"constraints,omitempty"` // 应用于此列的约束类型 (非 NotNull)
+	Geo          *GeoInfo           `json:"geo,omitempty" yaml:"geo,omitempty"`                 // 空间列信息 (仅 PostGIS geometry/geography 列)
+	Raster       *RasterInfo        `json:"raster,omitempty" yaml:"raster,omitempty"`           // 栅格列信息 (仅 PostGIS raster 列)
+	Vector       *VectorInfo        `json:"vector,omitempty" yaml:"vector,omitempty"`           // 向量列信息 (仅 pgvector 列)
+	Masked       string             `json:"masked,omitempty" yaml:"masked,omitempty"`           // 脱敏方式 (full, partial, hash)，查询结果中该列的值会被替换
 }
 
 // 表的信息
@@ -51,16 +161,114 @@ type TableInfo struct {
 	Columns     []ColumnInfo     `json:"columns" yaml:"columns"`                               // 表的列信息
 	Indexes     []IndexInfo      `json:"indexes,omitempty" yaml:"indexes,omitempty"`           // 表的索引信息 (可选加载)
 	ForeignKeys []ForeignKeyInfo `json:"foreign_keys,omitempty" yaml:"foreign_keys,omitempty"` // 表的外键信息 (可选加载)
+	Triggers    []TriggerInfo    `json:"triggers,omitempty" yaml:"triggers,omitempty"`         // 表的触发器信息 (可选加载)
+	Temporal    *TemporalInfo    `json:"temporal,omitempty" yaml:"temporal,omitempty"`         // 时态表/历史表模式 (未识别时为空)
+	Hypertable  *HypertableInfo  `json:"hypertable,omitempty" yaml:"hypertable,omitempty"`     // TimescaleDB 超表信息 (不是超表时为空)
+}
+
+// 自定义类型的种类
+const (
+	EnumType      = "enum"
+	CompositeType = "composite"
+	DomainType    = "domain"
+)
+
+// 复合类型的属性 (字段)
+type TypeAttribute struct {
+	Name string `json:"name" yaml:"name"` // 属性名
+	Type string `json:"type" yaml:"type"` // 属性的数据类型
+}
+
+// 自定义类型的信息 (枚举, 复合类型, 域)
+type TypeInfo struct {
+	Name        string          `json:"name" yaml:"name"`                                   // 类型名称
+	Kind        string          `json:"kind" yaml:"kind"`                                   // 类型种类 (enum, composite, domain)
+	Description string          `json:"description,omitempty" yaml:"description,omitempty"` // 类型注释
+	EnumLabels  []string        `json:"enum_labels,omitempty" yaml:"enum_labels,omitempty"` // 枚举的合法取值 (按定义顺序)
+	Attributes  []TypeAttribute `json:"attributes,omitempty" yaml:"attributes,omitempty"`   // 复合类型的属性
+	BaseType    string          `json:"base_type,omitempty" yaml:"base_type,omitempty"`     // 域的基础类型
+	NotNull     bool            `json:"not_null,omitempty" yaml:"not_null,omitempty"`       // 域是否 NOT NULL
+	Default     *string         `json:"default,omitempty" yaml:"default,omitempty"`         // 域的默认值
+	Checks      []string        `json:"checks,omitempty" yaml:"checks,omitempty"`           // 域的 CHECK 约束定义
+}
+
+// 函数/存储过程的信息
+type FunctionInfo struct {
+	Name        string   `json:"name" yaml:"name"`                                     // 函数名称
+	Kind        string   `json:"kind" yaml:"kind"`                                     // 种类 (function, procedure, aggregate, window)
+	Arguments   string   `json:"arguments" yaml:"arguments"`                           // 参数列表 (pg_get_function_arguments)
+	ArgTypes    []string `json:"arg_types,omitempty" yaml:"arg_types,omitempty"`       // 输入参数的类型 (按位置，format_type)；存储过程还包括 OUT 参数
+	ArgModes    []string `json:"arg_modes,omitempty" yaml:"arg_modes,omitempty"`       // 与 ArgTypes 对应的参数模式 (in, out, inout, variadic)
+	DefaultArgs int64    `json:"default_args,omitempty" yaml:"default_args,omitempty"` // 带默认值的参数个数 (位于参数列表末尾)
+	ReturnType  string   `json:"return_type,omitempty" yaml:"return_type,omitempty"`   // 返回类型 (存储过程为空)
+	Language    string   `json:"language" yaml:"language"`                             // 实现语言 (sql, plpgsql, c 等)
+	Volatility  string   `json:"volatility" yaml:"volatility"`                         // 易变性 (immutable, stable, volatile)
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`   // 函数注释
+}
+
+// PostGIS 拓扑信息 (来自 topology.topology，需开启 SCHEMA_INCLUDE_POSTGIS_OBJECTS)
+type TopologyInfo struct {
+	ID        int64   `json:"id" yaml:"id"`               // 拓扑 ID
+	Name      string  `json:"name" yaml:"name"`           // 拓扑名称 (与其 Schema 同名)
+	SRID      int64   `json:"srid" yaml:"srid"`           // 空间参考 ID
+	Precision float64 `json:"precision" yaml:"precision"` // 容差
+	HasZ      bool    `json:"has_z" yaml:"has_z"`         // 是否包含 Z 坐标
 }
 
 // 架构的信息
 type SchemaInfo struct {
-	Name        string      `json:"name" yaml:"name"`                                   // Schema 名称
-	Description string      `json:"description,omitempty" yaml:"description,omitempty"` // Schema 注释
-	Tables      []TableInfo `json:"tables" yaml:"tables"`                               // Schema 下的表信息
+	Name        string         `json:"name" yaml:"name"`                                   // Schema 名称
+	Description string         `json:"description,omitempty" yaml:"description,omitempty"` // Schema 注释
+	Tables      []TableInfo    `json:"tables" yaml:"tables"`                               // Schema 下的表信息
+	Types       []TypeInfo     `json:"types,omitempty" yaml:"types,omitempty"`             // Schema 下的自定义类型 (枚举, 复合类型, 域)
+	Functions   []FunctionInfo `json:"functions,omitempty" yaml:"functions,omitempty"`     // Schema 下的用户函数和存储过程 (不含扩展创建的函数)
+	Views       []ViewInfo     `json:"views,omitempty" yaml:"views,omitempty"`             // Schema 下的视图和物化视图 (不含扩展创建的视图)
+	Topology    *TopologyInfo  `json:"topology,omitempty" yaml:"topology,omitempty"`       // 若 Schema 是 PostGIS 拓扑，记录拓扑信息
+
+	ContinuousAggregates []ContinuousAggregateInfo `json:"continuous_aggregates,omitempty" yaml:"continuous_aggregates,omitempty"` // Schema 下的 TimescaleDB 连续聚合
+}
+
+// 视图信息 (包括物化视图)
+type ViewInfo struct {
+	Name         string           `json:"name" yaml:"name"`                                     // 视图名
+	Description  string           `json:"description,omitempty" yaml:"description,omitempty"`   // 视图注释
+	Materialized bool             `json:"materialized,omitempty" yaml:"materialized,omitempty"` // 是否为物化视图
+	Definition   string           `json:"definition" yaml:"definition"`                         // 视图定义 (pg_get_viewdef)
+	Columns      []ViewColumnInfo `json:"columns" yaml:"columns"`                               // 视图的输出列
+}
+
+// 视图列及其来源。来源由解析视图定义得到，并用数据库记录的列依赖校验，属于提示而非精确血缘
+type ViewColumnInfo struct {
+	Name       string         `json:"name" yaml:"name"`                                 // 列名
+	Type       string         `json:"type" yaml:"type"`                                 // 数据类型
+	Expression string         `json:"expression,omitempty" yaml:"expression,omitempty"` // 列不是直接引用时的计算表达式
+	Sources    []ColumnSource `json:"sources,omitempty" yaml:"sources,omitempty"`       // 直接引用的表或视图的列
+}
+
+// 视图列引用的表列或视图列
+type ColumnSource struct {
+	Schema string `json:"schema" yaml:"schema"`
+	Table  string `json:"table" yaml:"table"`
+	Column string `json:"column" yaml:"column"`
+}
+
+// 连接级别的特性摘要，便于 Agent 判断哪些专用工具可用
+type FeatureInfo struct {
+	ConnID       string            `json:"conn_id" yaml:"conn_id"`                           // 检测所用的连接 ID
+	PgVersion    string            `json:"pg_version" yaml:"pg_version"`                     // 服务端版本 (server_version)
+	PgVersionNum int64             `json:"pg_version_num" yaml:"pg_version_num"`             // 数字形式的版本 (server_version_num)，例如 160002
+	HasPostGIS   bool              `json:"has_postgis" yaml:"has_postgis"`                   // 是否安装 postgis
+	HasPGVector  bool              `json:"has_pgvector" yaml:"has_pgvector"`                 // 是否安装 pgvector (扩展名 vector)
+	HasTimescale bool              `json:"has_timescale" yaml:"has_timescale"`               // 是否安装 timescaledb
+	CurrentUser  string            `json:"current_user" yaml:"current_user"`                 // 当前登录角色
+	IsSuperuser  bool              `json:"is_superuser" yaml:"is_superuser"`                 // 当前角色是否为超级用户
+	InRecovery   bool              `json:"in_recovery" yaml:"in_recovery"`                   // 是否为只读备库 (pg_is_in_recovery)
+	ReadOnly     bool              `json:"read_only" yaml:"read_only"`                       // 当前角色实际上是否只读 (备库、默认只读事务或无任何表写权限)
+	Extensions   map[string]string `json:"extensions,omitempty" yaml:"extensions,omitempty"` // 已安装扩展: 名称 -> 版本
 }
 
 // 数据库下的架构的信息
 type DatabaseInfo struct {
-	Schemas []SchemaInfo `json:"schemas" yaml:"schemas"` // 数据库中的所有相关 Schema
+	Schemas  []SchemaInfo `json:"schemas" yaml:"schemas"`                       // 数据库中的所有相关 Schema
+	Features *FeatureInfo `json:"features,omitempty" yaml:"features,omitempty"` // 连接级别的特性摘要
 }
@@ -0,0 +1,102 @@
+package schemas
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pgvector 索引的默认参数 (未在 WITH 中显式指定时生效)
+const (
+	defaultIVFFlatLists       = 100
+	defaultHNSWM              = 16
+	defaultHNSWEfConstruction = 64
+)
+
+// vectorTypePattern 匹配 pgvector 的列类型，类型名可能带 Schema 前缀，例如 public.vector(1536)
+var vectorTypePattern = regexp.MustCompile(`^(?:\w+\.)?(vector|halfvec|sparsevec)(?:\((\d+)\))?$`)
+
+// vectorOpClassDistances 是操作符类到距离度量及对应运算符的映射
+var vectorOpClassDistances = map[string][2]string{
+	"vector_l2_ops":        {"l2", "<->"},
+	"vector_ip_ops":        {"inner_product", "<#>"},
+	"vector_cosine_ops":    {"cosine", "<=>"},
+	"vector_l1_ops":        {"l1", "<+>"},
+	"halfvec_l2_ops":       {"l2", "<->"},
+	"halfvec_ip_ops":       {"inner_product", "<#>"},
+	"halfvec_cosine_ops":   {"cosine", "<=>"},
+	"halfvec_l1_ops":       {"l1", "<+>"},
+	"sparsevec_l2_ops":     {"l2", "<->"},
+	"sparsevec_ip_ops":     {"inner_product", "<#>"},
+	"sparsevec_cosine_ops": {"cosine", "<=>"},
+	"sparsevec_l1_ops":     {"l1", "<+>"},
+	"bit_hamming_ops":      {"hamming", "<~>"},
+	"bit_jaccard_ops":      {"jaccard", "<%>"},
+}
+
+// attachVectorMetadata 为表中的 pgvector 列补充维度和向量索引参数。
+// 需要在列和索引都加载完成后调用。
+func attachVectorMetadata(table *TableInfo) {
+	for i := range table.Columns {
+		col := &table.Columns[i]
+		match := vectorTypePattern.FindStringSubmatch(col.Type)
+		if match == nil {
+			continue
+		}
+		vector := &VectorInfo{Type: match[1]}
+		if match[2] != "" {
+			vector.Dimensions, _ = strconv.ParseInt(match[2], 10, 64)
+		}
+
+		for _, idx := range table.Indexes {
+			if idx.IndexType != "ivfflat" && idx.IndexType != "hnsw" {
+				continue
+			}
+			position := -1
+			for p, name := range idx.Columns {
+				if name == col.Name {
+					position = p
+					break
+				}
+			}
+			if position < 0 {
+				continue
+			}
+			vector.Indexes = append(vector.Indexes, buildVectorIndexInfo(idx, position))
+		}
+		col.Vector = vector
+	}
+}
+
+// buildVectorIndexInfo 从索引的 reloptions 和操作符类中提取向量索引参数
+func buildVectorIndexInfo(idx IndexInfo, position int) VectorIndexInfo {
+	info := VectorIndexInfo{Name: idx.IndexName, Method: idx.IndexType}
+	if position < len(idx.OpClasses) {
+		info.OpClass = idx.OpClasses[position]
+		if distance, ok := vectorOpClassDistances[info.OpClass]; ok {
+			info.Distance, info.Operator = distance[0], distance[1]
+		}
+	}
+
+	switch idx.IndexType {
+	case "ivfflat":
+		info.Lists = relOptionInt(idx.Options, "lists", defaultIVFFlatLists)
+	case "hnsw":
+		info.M = relOptionInt(idx.Options, "m", defaultHNSWM)
+		info.EfConstruction = relOptionInt(idx.Options, "ef_construction", defaultHNSWEfConstruction)
+	}
+	return info
+}
+
+// relOptionInt 读取整数类型的 reloption，未设置或无法解析时返回默认值
+func relOptionInt(options map[string]string, key string, defaultValue int64) int64 {
+	value, ok := options[key]
+	if !ok {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseInt(strings.Trim(value, "'"), 10, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return parsed
+}
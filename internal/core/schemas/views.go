@@ -0,0 +1,438 @@
+package schemas
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// maxLineageDepth 限制沿视图追溯到基表时经过的视图层数
+const maxLineageDepth = 10
+
+var (
+	viewSelectPattern   = regexp.MustCompile(`(?i)\bselect\b`)
+	viewDistinctPattern = regexp.MustCompile(`(?i)^\s*distinct\b(\s+on\b)?`)
+	viewFromPattern     = regexp.MustCompile(`(?i)\bfrom\b`)
+	viewClausePattern   = regexp.MustCompile(`(?i)\b(where|group|having|window|order|limit|offset|fetch)\b`)
+	viewSetOpPattern    = regexp.MustCompile(`(?i)\b(union(\s+all)?|intersect(\s+all)?|except(\s+all)?)\b`)
+	viewAliasPattern    = regexp.MustCompile(`(?i)\s+as\s+("(?:[^"]|"")+"|[a-z_][a-z0-9_$]*)\s*$`)
+	viewColumnRef       = regexp.MustCompile(`(?i)^\s*(?:(?:"(?:[^"]|"")+"|[a-z_][a-z0-9_$]*)\s*\.\s*)*(?:"(?:[^"]|"")+"|[a-z_][a-z0-9_$]*)\s*$`)
+	// FROM/JOIN 后的关系和别名。pg_get_viewdef 会把 JOIN 放在括号中，所以同时匹配 '(' 之后的位置
+	viewRelationPattern = regexp.MustCompile(`(?i)(?:\bfrom|\bjoin|,|\()\s*((?:"(?:[^"]|"")+"|[a-z_][a-z0-9_$]*)(?:\s*\.\s*(?:"(?:[^"]|"")+"|[a-z_][a-z0-9_$]*))?)(?:\s+(?:as\s+)?("(?:[^"]|"")+"|[a-z_][a-z0-9_$]*))?`)
+)
+
+// relationKeywords 是可能出现在关系引用之后、但不是别名的关键字
+var relationKeywords = map[string]bool{
+	"on": true, "using": true, "join": true, "inner": true, "left": true, "right": true, "full": true, "cross": true,
+	"natural": true, "outer": true, "where": true, "group": true, "having": true, "window": true, "order": true,
+	"limit": true, "offset": true, "fetch": true, "union": true, "intersect": true, "except": true, "lateral": true,
+	"only": true, "select": true, "tablesample": true,
+}
+
+// loadViews 加载 Schema 下的视图和物化视图，并根据视图定义和数据库记录的列依赖推断每个输出列的来源
+func (m *manager) loadViews(ctx context.Context, connID, schemaName string, policies sqlguard.Policies) []ViewInfo {
+	query := `
+        SELECT
+            c.relname AS view_name,
+            c.relkind = 'm' AS materialized,
+            obj_description(c.oid, 'pg_class') AS description,
+            pg_get_viewdef(c.oid) AS definition,
+            (SELECT array_agg(a.attname::text ORDER BY a.attnum)
+               FROM pg_attribute a WHERE a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped) AS column_names,
+            (SELECT array_agg(format_type(a.atttypid, a.atttypmod) ORDER BY a.attnum)
+               FROM pg_attribute a WHERE a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped) AS column_types
+        FROM pg_class c
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        WHERE
+            n.nspname = $1
+            AND c.relkind IN ('v', 'm')
+            AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = c.oid AND d.deptype = 'e') -- 排除扩展创建的视图 (如 geometry_columns)
+        ORDER BY c.relname
+    `
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName)
+	if err != nil {
+		utils.DefaultLogger.Error("获取视图信息失败", zap.String("schema", schemaName), zap.String("connID", connID), zap.Error(err))
+		return nil
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	dependencies, err := m.fetchViewDependencies(ctx, connID, schemaName)
+	if err != nil {
+		// 没有依赖信息时无法校验解析结果，视图列不包含来源
+		utils.DefaultLogger.Warn("获取视图列依赖失败，视图列中将缺少来源", zap.String("schema", schemaName), zap.String("connID", connID), zap.Error(err))
+	}
+
+	views := make([]ViewInfo, 0, len(rows))
+	for _, row := range rows {
+		viewName := dbString(row["view_name"])
+		if !policies.TableAllowed(schemaName, viewName) {
+			continue
+		}
+		view := ViewInfo{
+			Name:        viewName,
+			Description: dbString(row["description"]),
+			Definition:  strings.TrimSpace(dbString(row["definition"])),
+			Columns:     []ViewColumnInfo{},
+		}
+		view.Materialized, _ = row["materialized"].(bool)
+		names := interfaceSliceToStringSlice(row["column_names"])
+		types := interfaceSliceToStringSlice(row["column_types"])
+		for i, name := range names {
+			col := ViewColumnInfo{Name: name}
+			if i < len(types) {
+				col.Type = types[i]
+			}
+			view.Columns = append(view.Columns, col)
+		}
+
+		// 访问策略禁止的表不出现在来源中
+		var allowed []ColumnSource
+		for _, dep := range dependencies[viewName] {
+			if policies.SchemaVisible(dep.Schema) && policies.TableAllowed(dep.Schema, dep.Table) {
+				allowed = append(allowed, dep)
+			}
+		}
+		attachViewLineage(&view, allowed)
+		views = append(views, view)
+	}
+	return views
+}
+
+// fetchViewDependencies 获取 Schema 下各视图通过重写规则依赖的列，返回 视图名 -> 被引用的列
+func (m *manager) fetchViewDependencies(ctx context.Context, connID, schemaName string) (map[string][]ColumnSource, error) {
+	query := `
+        SELECT DISTINCT
+            v.relname AS view_name,
+            rn.nspname AS ref_schema,
+            rt.relname AS ref_table,
+            ra.attname::text AS ref_column
+        FROM pg_class v
+        JOIN pg_namespace vn ON vn.oid = v.relnamespace
+        JOIN pg_rewrite r ON r.ev_class = v.oid
+        JOIN pg_depend d ON d.classid = 'pg_rewrite'::regclass AND d.objid = r.oid
+            AND d.refclassid = 'pg_class'::regclass AND d.refobjsubid > 0 -- 列级依赖
+        JOIN pg_class rt ON rt.oid = d.refobjid
+        JOIN pg_namespace rn ON rn.oid = rt.relnamespace
+        JOIN pg_attribute ra ON ra.attrelid = rt.oid AND ra.attnum = d.refobjsubid
+        WHERE
+            vn.nspname = $1
+            AND v.relkind IN ('v', 'm')
+            AND rt.oid <> v.oid -- 排除视图对自身的依赖
+        ORDER BY 1, 2, 3, 4
+    `
+	rows, err := m.dbService.ExecuteQuery(ctx, connID, true, query, schemaName)
+	if err != nil {
+		return nil, err
+	}
+	dependencies := make(map[string][]ColumnSource)
+	for _, row := range rows {
+		viewName := dbString(row["view_name"])
+		dependencies[viewName] = append(dependencies[viewName], ColumnSource{
+			Schema: dbString(row["ref_schema"]),
+			Table:  dbString(row["ref_table"]),
+			Column: dbString(row["ref_column"]),
+		})
+	}
+	return dependencies, nil
+}
+
+// attachViewLineage 解析视图定义的 SELECT 列表，按位置为每个输出列记录引用的列。
+// 只保留出现在 dependencies (数据库记录的列依赖) 中的引用，避免把函数名、类型名等误认为列。
+// UNION 等集合操作的各分支按位置合并来源；无法解析的视图只保留列名和类型。
+func attachViewLineage(view *ViewInfo, dependencies []ColumnSource) {
+	if len(dependencies) == 0 {
+		return
+	}
+	definition := strings.TrimRight(view.Definition, "; \t\r\n")
+	aliases := viewRelationAliases(definition, dependencies)
+	masked := maskViewDefinition(definition)
+
+	for branchIndex, branch := range splitSetOperations(masked) {
+		items := splitSelectList(definition, masked, branch[0], branch[1])
+		for i, item := range items {
+			if i >= len(view.Columns) {
+				break
+			}
+			col := &view.Columns[i]
+			expression := strings.TrimSpace(item)
+			if match := viewAliasPattern.FindStringIndex(maskViewDefinition(expression)); match != nil {
+				expression = strings.TrimSpace(expression[:match[0]])
+			}
+			if branchIndex == 0 && !viewColumnRef.MatchString(expression) {
+				col.Expression = strings.Join(strings.Fields(expression), " ")
+			}
+			for _, chain := range sqlguard.IdentifierChains(expression) {
+				if source, ok := resolveColumnChain(chain, aliases, dependencies); ok && !containsSource(col.Sources, source) {
+					col.Sources = append(col.Sources, source)
+				}
+			}
+		}
+	}
+}
+
+// maskViewDefinition 把字符串字面量和括号内的内容替换为空格，保持长度不变，使正则只匹配顶层结构
+func maskViewDefinition(sql string) string {
+	return maskSQLText(sql, true)
+}
+
+// maskSQLText 把字符串字面量和注释替换为空格 (保持长度不变)；nested 为 true 时括号及其中的内容也替换为空格
+func maskSQLText(sql string, nested bool) string {
+	out := []byte(sql)
+	depth := 0
+	blank := func(token sqlguard.Token) {
+		for k := token.Start; k < token.End; k++ {
+			out[k] = ' '
+		}
+	}
+	for _, token := range sqlguard.Lex(sql) {
+		switch {
+		case token.Kind == sqlguard.TokenString || token.Kind == sqlguard.TokenComment:
+			blank(token)
+		case !nested:
+		case token.Kind == sqlguard.TokenOther && token.Text == "(":
+			depth++
+			blank(token)
+		case token.Kind == sqlguard.TokenOther && token.Text == ")":
+			if depth > 0 {
+				depth--
+			}
+			blank(token)
+		case depth > 0:
+			// 引号标识符在顶层保留，括号内的内容替换为空格
+			blank(token)
+		}
+	}
+	return string(out)
+}
+
+// splitSetOperations 返回顶层 UNION/INTERSECT/EXCEPT 分隔的各分支在 masked 中的起止位置
+func splitSetOperations(masked string) [][2]int {
+	var branches [][2]int
+	start := 0
+	for _, match := range viewSetOpPattern.FindAllStringIndex(masked, -1) {
+		branches = append(branches, [2]int{start, match[0]})
+		start = match[1]
+	}
+	return append(branches, [2]int{start, len(masked)})
+}
+
+// splitSelectList 返回 [start, end) 范围内查询的顶层 SELECT 列表中的各项 (原始文本)
+func splitSelectList(definition, masked string, start, end int) []string {
+	branch := masked[start:end]
+	selectLoc := viewSelectPattern.FindStringIndex(branch)
+	if selectLoc == nil {
+		return nil // VALUES 等没有 SELECT 列表的分支
+	}
+	listStart := selectLoc[1]
+	if match := viewDistinctPattern.FindStringIndex(branch[listStart:]); match != nil {
+		listStart += match[1]
+	}
+	listEnd := len(branch)
+	if fromLoc := viewFromPattern.FindStringIndex(branch[listStart:]); fromLoc != nil {
+		listEnd = listStart + fromLoc[0]
+	} else if clauseLoc := viewClausePattern.FindStringIndex(branch[listStart:]); clauseLoc != nil {
+		listEnd = listStart + clauseLoc[0]
+	}
+
+	var items []string
+	itemStart := listStart
+	for i := listStart; i < listEnd; i++ {
+		if branch[i] == ',' {
+			items = append(items, definition[start+itemStart:start+i])
+			itemStart = i + 1
+		}
+	}
+	if strings.TrimSpace(branch[itemStart:listEnd]) != "" {
+		items = append(items, definition[start+itemStart:start+listEnd])
+	}
+	return items
+}
+
+// viewRelationAliases 从视图定义中提取 FROM/JOIN 的关系及其别名，返回 别名或表名 -> 被引用的关系。
+// 只保留出现在 dependencies 中的关系；同一别名指向不同关系时 (不同子查询) 视为无法确定。
+func viewRelationAliases(definition string, dependencies []ColumnSource) map[string]*ColumnSource {
+	literalMasked := maskSQLText(definition, false)
+	aliases := make(map[string]*ColumnSource)
+	ambiguous := make(map[string]bool)
+	add := func(name string, relation *ColumnSource) {
+		if existing, ok := aliases[name]; ok && (existing.Schema != relation.Schema || existing.Table != relation.Table) {
+			ambiguous[name] = true
+		}
+		aliases[name] = relation
+	}
+	for _, match := range viewRelationPattern.FindAllStringSubmatch(literalMasked, -1) {
+		parts := identifierParts(match[1])
+		if len(parts) == 0 || relationKeywords[parts[len(parts)-1]] {
+			continue
+		}
+		var relation *ColumnSource
+		for i := range dependencies {
+			dep := &dependencies[i]
+			if dep.Table == parts[len(parts)-1] && (len(parts) == 1 || dep.Schema == parts[0]) {
+				relation = &ColumnSource{Schema: dep.Schema, Table: dep.Table}
+				break
+			}
+		}
+		if relation == nil {
+			continue
+		}
+		add(relation.Table, relation)
+		if alias := identifierParts(match[2]); len(alias) == 1 && !relationKeywords[alias[0]] {
+			add(alias[0], relation)
+		}
+	}
+	for name := range ambiguous {
+		delete(aliases, name)
+	}
+	return aliases
+}
+
+// identifierParts 把 [schema.]name 形式的引用拆分为各部分，未加引号的部分转换为小写
+func identifierParts(reference string) []string {
+	var parts []string
+	for _, part := range strings.Split(reference, ".") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if strings.HasPrefix(part, `"`) {
+			parts = append(parts, strings.ReplaceAll(strings.Trim(part, `"`), `""`, `"`))
+		} else {
+			parts = append(parts, strings.ToLower(part))
+		}
+	}
+	return parts
+}
+
+// resolveColumnChain 把标识符序列 ([[schema.]table.]column) 解析为 dependencies 中的列。
+// 限定名无法识别 (子查询或 CTE 的别名) 或没有限定时，只在列名在依赖中唯一时返回结果。
+func resolveColumnChain(chain []string, aliases map[string]*ColumnSource, dependencies []ColumnSource) (ColumnSource, bool) {
+	column := chain[len(chain)-1]
+	if len(chain) >= 2 {
+		qualifier := chain[len(chain)-2]
+		if relation, ok := aliases[qualifier]; ok {
+			for _, dep := range dependencies {
+				if dep.Schema == relation.Schema && dep.Table == relation.Table && dep.Column == column {
+					return dep, true
+				}
+			}
+			return ColumnSource{}, false
+		}
+	}
+	var found *ColumnSource
+	for i := range dependencies {
+		if dependencies[i].Column != column {
+			continue
+		}
+		if found != nil {
+			return ColumnSource{}, false // 多个关系中有同名列，无法确定
+		}
+		found = &dependencies[i]
+	}
+	if found == nil {
+		return ColumnSource{}, false
+	}
+	return *found, true
+}
+
+// ViewLineage 是视图各输出列的来源，以及沿视图追溯到的基表列
+type ViewLineage struct {
+	Schema       string          `json:"schema"`
+	View         string          `json:"view"`
+	Materialized bool            `json:"materialized,omitempty"`
+	Columns      []ColumnLineage `json:"columns"`
+}
+
+// ColumnLineage 是一个视图列的血缘提示
+type ColumnLineage struct {
+	Column      string         `json:"column"`
+	Type        string         `json:"type"`
+	Expression  string         `json:"expression,omitempty"` // 列不是直接引用时的计算表达式
+	Sources     []ColumnSource `json:"sources"`              // 直接引用的表或视图的列
+	BaseSources []ColumnSource `json:"base_sources"`         // 沿引用的视图追溯到的基表列 (无法继续追溯的视图列保留原样)
+}
+
+// GetViewLineage 实现 Manager 接口。
+func (m *manager) GetViewLineage(schemaName, viewName string) (*ViewLineage, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	view := m.findViewLocked(schemaName, viewName)
+	if view == nil {
+		return nil, false
+	}
+	lineage := &ViewLineage{Schema: schemaName, View: view.Name, Materialized: view.Materialized, Columns: make([]ColumnLineage, 0, len(view.Columns))}
+	for _, col := range view.Columns {
+		lineage.Columns = append(lineage.Columns, ColumnLineage{
+			Column:      col.Name,
+			Type:        col.Type,
+			Expression:  col.Expression,
+			Sources:     orEmpty(col.Sources),
+			BaseSources: orEmpty(m.baseSourcesLocked(col.Sources, 0)),
+		})
+	}
+	return lineage, true
+}
+
+// findViewLocked 在缓存中查找视图，调用方需持有 m.mu
+func (m *manager) findViewLocked(schemaName, viewName string) *ViewInfo {
+	if m.cache == nil {
+		return nil
+	}
+	for i := range m.cache.Schemas {
+		if m.cache.Schemas[i].Name != schemaName {
+			continue
+		}
+		for j := range m.cache.Schemas[i].Views {
+			if m.cache.Schemas[i].Views[j].Name == viewName {
+				return &m.cache.Schemas[i].Views[j]
+			}
+		}
+	}
+	return nil
+}
+
+// baseSourcesLocked 把引用视图列的来源替换为该视图列的来源，直到基表或达到 maxLineageDepth，调用方需持有 m.mu
+func (m *manager) baseSourcesLocked(sources []ColumnSource, depth int) []ColumnSource {
+	var base []ColumnSource
+	add := func(source ColumnSource) {
+		if !containsSource(base, source) {
+			base = append(base, source)
+		}
+	}
+	for _, source := range sources {
+		view := m.findViewLocked(source.Schema, source.Table)
+		if view == nil || depth >= maxLineageDepth {
+			add(source)
+			continue
+		}
+		var resolved []ColumnSource
+		for _, col := range view.Columns {
+			if col.Name == source.Column {
+				resolved = m.baseSourcesLocked(col.Sources, depth+1)
+				break
+			}
+		}
+		if len(resolved) == 0 {
+			add(source) // 视图列的来源未知，保留视图列本身
+		}
+		for _, s := range resolved {
+			add(s)
+		}
+	}
+	return base
+}
+
+// containsSource 判断 sources 中是否已有 source
+func containsSource(sources []ColumnSource, source ColumnSource) bool {
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// sessionIdleTTL 是会话无任何消息后被视为已断开并从列表中移除的时长。
+// SSE 传输层不通知会话断开，只能在发送失败或长时间空闲时清理。
+const sessionIdleTTL = 1 * time.Hour
+
+// InFlightCall 是会话中正在执行的一个工具调用
+type InFlightCall struct {
+	RequestID string    `json:"request_id"` // JSON-RPC 请求 ID
+	Tool      string    `json:"tool"`       // 工具名称
+	ConnID    string    `json:"conn_id,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	ElapsedMs int64     `json:"elapsed_ms"` // 已执行时长 (毫秒)，在快照时计算
+}
+
+// SessionInfo 是一个 MCP 客户端会话的活动快照
+type SessionInfo struct {
+	SessionID     string           `json:"session_id"`               // 传输层分配的会话 ID
+	ClientName    string           `json:"client_name,omitempty"`    // initialize 时上报的客户端名称
+	ClientVersion string           `json:"client_version,omitempty"` // initialize 时上报的客户端版本
+	StartedAt     time.Time        `json:"started_at"`               // 首次收到消息的时间
+	LastActiveAt  time.Time        `json:"last_active_at"`           // 最近一次收到消息的时间
+	ConnIDs       []string         `json:"conn_ids"`                 // 该会话注册或使用过的连接 ID
+	InFlight      []InFlightCall   `json:"in_flight"`                // 正在执行的工具调用
+	ToolCalls     int64            `json:"tool_calls"`               // 累计工具调用次数
+	ToolCallsBy   map[string]int64 `json:"tool_calls_by_tool"`       // 按工具统计的累计调用次数
+	ResourceReads int64            `json:"resource_reads"`           // 累计资源读取次数
+	Errors        int64            `json:"errors"`                   // 累计返回错误的请求数
+}
+
+// session 是 Tracker 内部保存的会话状态
+type session struct {
+	info     SessionInfo
+	connIDs  map[string]bool
+	inFlight map[string]*InFlightCall // requestID -> 调用
+}
+
+// Tracker 通过包装传输层观察 JSON-RPC 消息，统计每个 MCP 会话的活动。
+// go-mcp 不会把会话 ID 传给 Handler，因此只能在传输层按消息内容进行统计。
+type Tracker struct {
+	mu       sync.Mutex
+	sessions map[string]*session // sessionID -> 会话
+}
+
+// NewTracker 创建一个新的会话追踪器。
+func NewTracker() *Tracker {
+	return &Tracker{sessions: make(map[string]*session)}
+}
+
+// WrapTransport 返回一个包装后的传输层，所有收发的消息都会先经过 Tracker。
+func (t *Tracker) WrapTransport(inner transport.ServerTransport) transport.ServerTransport {
+	return &trackedTransport{ServerTransport: inner, tracker: t}
+}
+
+// List 返回当前会话的快照，按开始时间排序。
+func (t *Tracker) List() []SessionInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	result := make([]SessionInfo, 0, len(t.sessions))
+	for sessionID, s := range t.sessions {
+		if len(s.inFlight) == 0 && now.Sub(s.info.LastActiveAt) > sessionIdleTTL {
+			delete(t.sessions, sessionID)
+			continue
+		}
+		info := s.info
+		info.ConnIDs = make([]string, 0, len(s.connIDs))
+		for connID := range s.connIDs {
+			info.ConnIDs = append(info.ConnIDs, connID)
+		}
+		sort.Strings(info.ConnIDs)
+		info.InFlight = make([]InFlightCall, 0, len(s.inFlight))
+		for _, call := range s.inFlight {
+			snapshot := *call
+			snapshot.ElapsedMs = now.Sub(call.StartedAt).Milliseconds()
+			info.InFlight = append(info.InFlight, snapshot)
+		}
+		sort.Slice(info.InFlight, func(i, j int) bool { return info.InFlight[i].StartedAt.Before(info.InFlight[j].StartedAt) })
+		info.ToolCallsBy = make(map[string]int64, len(s.info.ToolCallsBy))
+		for tool, count := range s.info.ToolCallsBy {
+			info.ToolCallsBy[tool] = count
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].StartedAt.Before(result[j].StartedAt) })
+	return result
+}
+
+// rpcMessage 是统计所需的 JSON-RPC 消息字段
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// getSession 返回 (必要时创建) 会话状态，调用方需持有锁
+func (t *Tracker) getSession(sessionID string) *session {
+	s, ok := t.sessions[sessionID]
+	if !ok {
+		now := time.Now()
+		s = &session{
+			info:     SessionInfo{SessionID: sessionID, StartedAt: now, LastActiveAt: now, ToolCallsBy: make(map[string]int64)},
+			connIDs:  make(map[string]bool),
+			inFlight: make(map[string]*InFlightCall),
+		}
+		t.sessions[sessionID] = s
+	}
+	return s
+}
+
+// onReceive 统计客户端发来的请求
+func (t *Tracker) onReceive(sessionID string, msg []byte) {
+	var message rpcMessage
+	if err := json.Unmarshal(msg, &message); err != nil || message.Method == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.getSession(sessionID)
+	s.info.LastActiveAt = time.Now()
+
+	switch protocol.Method(message.Method) {
+	case protocol.Initialize:
+		var params protocol.InitializeRequest
+		if err := json.Unmarshal(message.Params, &params); err == nil {
+			s.info.ClientName = params.ClientInfo.Name
+			s.info.ClientVersion = params.ClientInfo.Version
+		}
+	case protocol.ToolsCall:
+		var params struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return
+		}
+		s.info.ToolCalls++
+		s.info.ToolCallsBy[params.Name]++
+		connID, _ := params.Arguments["conn_id"].(string)
+		if connID != "" {
+			s.connIDs[connID] = true
+		}
+		if len(message.ID) > 0 {
+			requestID := string(message.ID)
+			s.inFlight[requestID] = &InFlightCall{RequestID: requestID, Tool: params.Name, ConnID: connID, StartedAt: time.Now()}
+		}
+	case protocol.ResourcesRead:
+		s.info.ResourceReads++
+	}
+}
+
+// onSend 统计服务端返回的响应: 结束在途调用，并从 connect 的结果中记录新注册的 connID
+func (t *Tracker) onSend(sessionID string, msg []byte, sendErr error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.sessions[sessionID]
+	if !ok {
+		return
+	}
+	if errors.Is(sendErr, pkg.ErrLackSession) {
+		// 传输层已经没有这个会话，客户端已断开
+		utils.DefaultLogger.Info("MCP 会话已断开", zap.String("sessionID", sessionID))
+		delete(t.sessions, sessionID)
+		return
+	}
+
+	var message rpcMessage
+	if err := json.Unmarshal(msg, &message); err != nil || message.Method != "" || len(message.ID) == 0 {
+		return // 通知或无法解析的消息
+	}
+	if len(message.Error) > 0 && string(message.Error) != "null" {
+		s.info.Errors++
+	}
+	call, ok := s.inFlight[string(message.ID)]
+	if !ok {
+		return
+	}
+	delete(s.inFlight, string(message.ID))
+
+	var result protocol.CallToolResult
+	if err := json.Unmarshal(message.Result, &result); err != nil {
+		return
+	}
+	if result.IsError {
+		s.info.Errors++
+		return
+	}
+	if call.Tool == "connect" {
+		for _, content := range result.Content {
+			text, ok := content.(protocol.TextContent)
+			if !ok {
+				continue
+			}
+			var connectResult struct {
+				ConnID string `json:"conn_id"`
+			}
+			if err := json.Unmarshal([]byte(text.Text), &connectResult); err == nil && connectResult.ConnID != "" {
+				s.connIDs[connectResult.ConnID] = true
+			}
+		}
+	}
+}
+
+// trackedTransport 在转发消息之前交给 Tracker 统计
+type trackedTransport struct {
+	transport.ServerTransport
+	tracker *Tracker
+}
+
+// Send 实现 transport.ServerTransport 接口。
+func (t *trackedTransport) Send(ctx context.Context, sessionID string, msg transport.Message) error {
+	err := t.ServerTransport.Send(ctx, sessionID, msg)
+	t.tracker.onSend(sessionID, msg, err)
+	return err
+}
+
+// SetReceiver 实现 transport.ServerTransport 接口。
+func (t *trackedTransport) SetReceiver(receiver transport.ServerReceiver) {
+	t.ServerTransport.SetReceiver(transport.ServerReceiverF(func(ctx context.Context, sessionID string, msg []byte) error {
+		t.tracker.onReceive(sessionID, msg)
+		return receiver.Receive(ctx, sessionID, msg)
+	}))
+}
@@ -0,0 +1,173 @@
+package shards
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 分片路由策略
+const (
+	StrategyHash   = "hash"   // 对路由键的文本形式做 FNV-1a 哈希后取模
+	StrategyModulo = "modulo" // 路由键必须是整数，直接取模
+)
+
+// ErrGroupNotFound 表示分片组未注册
+var ErrGroupNotFound = errors.New("分片组未注册")
+
+// Group 是一组按路由键划分数据的连接，ConnIDs 的顺序即分片编号 (从 0 开始)
+type Group struct {
+	Name       string   `json:"name"`
+	ConnIDs    []string `json:"conn_ids"`
+	RoutingKey string   `json:"routing_key"` // 决定数据所在分片的 SQL 表达式，例如 tenant_id
+	Strategy   string   `json:"strategy"`    // hash 或 modulo
+}
+
+// Registry 在内存中保存已注册的分片组，与连接注册一样不做持久化
+type Registry struct {
+	mu     sync.RWMutex
+	groups map[string]*Group
+}
+
+// NewRegistry 创建一个新的分片组注册表。
+func NewRegistry() *Registry {
+	return &Registry{groups: make(map[string]*Group)}
+}
+
+// Register 注册或替换一个分片组。
+func (r *Registry) Register(group Group) (*Group, error) {
+	group.Name = strings.TrimSpace(group.Name)
+	group.RoutingKey = strings.TrimSpace(group.RoutingKey)
+	group.Strategy = strings.ToLower(strings.TrimSpace(group.Strategy))
+	if group.Name == "" {
+		return nil, fmt.Errorf("分片组名称不能为空")
+	}
+	if group.RoutingKey == "" {
+		return nil, fmt.Errorf("分片组 '%s' 缺少路由键表达式", group.Name)
+	}
+	if group.Strategy == "" {
+		group.Strategy = StrategyHash
+	}
+	if group.Strategy != StrategyHash && group.Strategy != StrategyModulo {
+		return nil, fmt.Errorf("不支持的路由策略: '%s' (可选 hash, modulo)", group.Strategy)
+	}
+	if len(group.ConnIDs) == 0 {
+		return nil, fmt.Errorf("分片组 '%s' 至少需要一个连接", group.Name)
+	}
+	seen := make(map[string]bool, len(group.ConnIDs))
+	for _, connID := range group.ConnIDs {
+		if connID == "" || seen[connID] {
+			return nil, fmt.Errorf("分片组 '%s' 的连接 ID 不能为空或重复", group.Name)
+		}
+		seen[connID] = true
+	}
+	group.ConnIDs = append([]string{}, group.ConnIDs...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.groups[group.Name] = &group
+	return &group, nil
+}
+
+// Get 返回指定名称的分片组。
+func (r *Registry) Get(name string) (*Group, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	group, ok := r.groups[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrGroupNotFound, name)
+	}
+	copied := *group
+	copied.ConnIDs = append([]string{}, group.ConnIDs...)
+	return &copied, nil
+}
+
+// List 返回所有分片组，按名称排序。
+func (r *Registry) List() []Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	groups := make([]Group, 0, len(r.groups))
+	for _, group := range r.groups {
+		copied := *group
+		copied.ConnIDs = append([]string{}, group.ConnIDs...)
+		groups = append(groups, copied)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// Route 返回路由键取值 key 所在分片的连接 ID。
+// key 通常来自 JSON 参数: 字符串、数字或布尔值。
+func (g *Group) Route(key any) (string, error) {
+	index, err := g.shardIndex(key)
+	if err != nil {
+		return "", err
+	}
+	return g.ConnIDs[index], nil
+}
+
+func (g *Group) shardIndex(key any) (int, error) {
+	if key == nil {
+		return 0, fmt.Errorf("路由键取值不能为空")
+	}
+	shardCount := uint64(len(g.ConnIDs))
+	switch g.Strategy {
+	case StrategyModulo:
+		n, err := integerKey(key)
+		if err != nil {
+			return 0, err
+		}
+		index := n % int64(shardCount)
+		if index < 0 {
+			index += int64(shardCount)
+		}
+		return int(index), nil
+	default:
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(textKey(key)))
+		return int(uint64(hash.Sum32()) % shardCount), nil
+	}
+}
+
+// textKey 返回路由键的文本形式，整数值的数字不带小数部分，使 42 与 "42" 路由到同一分片
+func textKey(key any) string {
+	switch v := key.(type) {
+	case string:
+		return v
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// integerKey 将路由键转换为整数，用于 modulo 策略
+func integerKey(key any) (int64, error) {
+	switch v := key.(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("modulo 策略的路由键必须是整数，实际为 %v", v)
+		}
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("modulo 策略的路由键必须是整数，实际为 '%s'", v)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("modulo 策略的路由键必须是整数，实际为 %T", key)
+	}
+}
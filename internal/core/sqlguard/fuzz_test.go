@@ -0,0 +1,108 @@
+package sqlguard
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+)
+
+// fuzzSeeds 是词法扫描模糊测试的种子: 各种引号、注释、美元引用和未闭合的结构
+var fuzzSeeds = []string{
+	"", "select 1", `select "a""b" from t`, `select 'it''s'`, `select E'\'' from t`, `select e'\\' , x`,
+	"select $$ secret.accounts $$", "select $tag$ x $tag$", "select $1, $2", "select $", "select $a",
+	"-- secret.accounts\nselect 1", "/* secret.accounts */ select 1", "/* unterminated", `"unterminated`,
+	"'unterminated", "select U&'\\0041'", "select 1.5e10, .5", "select x::regclass", "订单.金额", "\x00\xff",
+}
+
+// deniedPolicy 拒绝 secret.accounts 和整个 vault Schema
+var deniedPolicy = Policies{{DenyTables: []string{"secret.accounts"}, DenySchemas: []string{"vault"}}}
+
+// FuzzKeywords 检查 Keywords 对任意输入不会 panic，返回的都是小写的未加引号单词
+func FuzzKeywords(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, sql string) {
+		for _, word := range Keywords(sql) {
+			if word == "" || word != strings.ToLower(word) || !isIdentStart(word[0]) {
+				t.Fatalf("Keywords(%q) 返回了无效的单词 %q", sql, word)
+			}
+		}
+	})
+}
+
+// FuzzLiteralIsOneToken 检查 sqlsafe 引用的字面量和标识符在词法扫描中是一个完整的单元:
+// 其内容不会产生关键字，也不会吞掉后面的 SQL
+func FuzzLiteralIsOneToken(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		want := []string{"select", "from", "t"}
+		if literal, err := sqlsafe.QuoteLiteral(value); err == nil {
+			sql := "select " + literal + " from t"
+			if got := Keywords(sql); !slices.Equal(got, want) {
+				t.Fatalf("Keywords(%q) = %v，期望 %v", sql, got, want)
+			}
+		}
+		if identifier, err := sqlsafe.QuoteIdentifier(value); err == nil {
+			sql := "select " + identifier + " from t"
+			if got := Keywords(sql); !slices.Equal(got, want) {
+				t.Fatalf("Keywords(%q) = %v，期望 %v", sql, got, want)
+			}
+			chains := IdentifierChains("select " + identifier + ".col from t")
+			if len(chains) != 4 || !slices.Equal(chains[1], []string{value, "col"}) {
+				t.Fatalf("IdentifierChains 没有把 %q 解析为 [%q col]: %v", identifier, value, chains)
+			}
+		}
+	})
+}
+
+// FuzzCheckQueryDenied 检查无论前面出现什么字面量、标识符或注释内容，之后对被拒绝对象的引用都会被发现
+func FuzzCheckQueryDenied(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		var prefixes []string
+		if literal, err := sqlsafe.QuoteLiteral(value); err == nil {
+			prefixes = append(prefixes, "select "+literal+" as x")
+		}
+		if identifier, err := sqlsafe.QuoteIdentifier(value); err == nil {
+			prefixes = append(prefixes, "select 1 as "+identifier)
+		}
+		if !strings.Contains(value, "*/") {
+			prefixes = append(prefixes, "select 1 /* "+value+" */")
+		}
+		if !strings.ContainsAny(value, "\r\n") {
+			prefixes = append(prefixes, "select 1 -- "+value+"\n")
+		}
+		for _, prefix := range prefixes {
+			for _, target := range []string{"secret.accounts", `"secret"."accounts"`, "SECRET . Accounts", "vault.anything"} {
+				sql := prefix + " from " + target
+				if err := deniedPolicy.CheckQuery(sql, nil); !errors.Is(err, ErrDenied) {
+					t.Fatalf("CheckQuery(%q) = %v，期望拒绝", sql, err)
+				}
+			}
+		}
+	})
+}
+
+// FuzzCheckQuery 检查 CheckQuery 对任意输入不会 panic，没有规则时总是放行
+func FuzzCheckQuery(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, sql string) {
+		if err := (Policies{}).CheckQuery(sql, nil); err != nil {
+			t.Fatalf("空策略拒绝了 %q: %v", sql, err)
+		}
+		err := deniedPolicy.CheckQuery(sql, func(name string) bool { return name == "public" })
+		if err != nil && !errors.Is(err, ErrDenied) {
+			t.Fatalf("CheckQuery(%q) 返回了 ErrDenied 以外的错误: %v", sql, err)
+		}
+	})
+}
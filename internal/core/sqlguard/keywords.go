@@ -0,0 +1,15 @@
+package sqlguard
+
+import "strings"
+
+// Keywords 返回 SQL 文本中所有未加引号的单词 (小写，按出现顺序)，跳过注释、字符串字面量、
+// 美元引用字符串和加引号的标识符，用于按语句的关键字判断语句类型 (例如事务控制语句或数据修改语句)。
+func Keywords(sql string) []string {
+	var words []string
+	for _, token := range Lex(sql) {
+		if token.Kind == TokenWord {
+			words = append(words, strings.ToLower(token.Text))
+		}
+	}
+	return words
+}
@@ -0,0 +1,130 @@
+package sqlguard
+
+import "strings"
+
+// TokenKind 是词法单元的类型
+type TokenKind int
+
+const (
+	TokenOther       TokenKind = iota // 单个字符: 空白、运算符和标点
+	TokenWord                         // 未加引号的标识符或关键字
+	TokenQuotedIdent                  // 加引号的标识符 "..."
+	TokenString                       // 字符串字面量 '...'、E'...' 或美元引用字符串 $tag$...$tag$
+	TokenComment                      // 注释 -- ... (不含换行) 或 /* ... */
+	TokenNumber                       // 数字字面量 (包括 1.5, 1e10)
+	TokenParam                        // 位置参数 $1
+)
+
+// Token 是 SQL 文本中的一个词法单元，Text 为 sql[Start:End]
+type Token struct {
+	Kind       TokenKind
+	Start, End int
+	Text       string
+}
+
+// Lex 将 SQL 文本切分为词法单元，所有单元依次覆盖整个文本 (未闭合的引号、注释和美元引用延续到文本末尾)。
+// 扫描规则与 PostgreSQL 一致: 连续两个引号是转义，E'...' 中反斜杠也转义下一个字符，$1 是位置参数而 $$ 和 $tag$ 开始美元引用字符串。
+// 访问策略检查、关键字识别以及需要跳过字面量和注释的 SQL 改写 (命名参数、子句定位等) 都使用它。
+func Lex(sql string) []Token {
+	var tokens []Token
+	emit := func(kind TokenKind, start, end int) {
+		tokens = append(tokens, Token{Kind: kind, Start: start, End: end, Text: sql[start:end]})
+	}
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			emit(TokenComment, i, i+end)
+			i += end
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end = i + 2 + end + 2
+			}
+			emit(TokenComment, i, end)
+			i = end
+		case c == '"':
+			end := skipQuoted(sql, i, '"', false)
+			emit(TokenQuotedIdent, i, end)
+			i = end
+		case c == '\'':
+			end := skipQuoted(sql, i, '\'', false)
+			emit(TokenString, i, end)
+			i = end
+		case (c == 'e' || c == 'E') && i+1 < len(sql) && sql[i+1] == '\'':
+			end := skipQuoted(sql, i+1, '\'', true)
+			emit(TokenString, i, end)
+			i = end
+		case c == '$':
+			if tag, ok := dollarQuoteTag(sql[i:]); ok {
+				start := i + len(tag)
+				end := strings.Index(sql[start:], tag)
+				if end < 0 {
+					end = len(sql)
+				} else {
+					end = start + end + len(tag)
+				}
+				emit(TokenString, i, end)
+				i = end
+				continue
+			}
+			end := i + 1
+			for end < len(sql) && sql[end] >= '0' && sql[end] <= '9' {
+				end++
+			}
+			if end > i+1 {
+				emit(TokenParam, i, end)
+			} else {
+				emit(TokenOther, i, end)
+			}
+			i = end
+		case isIdentStart(c):
+			end := i + 1
+			for end < len(sql) && (isIdentChar(sql[end]) || sql[end] == '$') {
+				end++
+			}
+			emit(TokenWord, i, end)
+			i = end
+		case c >= '0' && c <= '9':
+			end := i + 1
+			for end < len(sql) && (isIdentChar(sql[end]) || sql[end] == '.') {
+				end++
+			}
+			emit(TokenNumber, i, end)
+			i = end
+		default:
+			emit(TokenOther, i, i+1)
+			i++
+		}
+	}
+	return tokens
+}
+
+// literalContent 返回字符串字面量的内容 (去掉 E 前缀、引号或美元引用标记，不处理转义)
+func literalContent(token Token) string {
+	text := token.Text
+	if strings.HasPrefix(text, "$") {
+		tag, _ := dollarQuoteTag(text)
+		text = text[len(tag):]
+		return strings.TrimSuffix(text, tag)
+	}
+	if text[0] == 'e' || text[0] == 'E' {
+		text = text[1:]
+	}
+	return unquote(text, '\'')
+}
+
+// unquote 去掉开头的引号和 (已闭合时) 结尾的引号
+func unquote(text string, quote byte) string {
+	text = text[1:]
+	if strings.HasSuffix(text, string(quote)) {
+		text = text[:len(text)-1]
+	}
+	return text
+}
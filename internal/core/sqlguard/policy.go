@@ -0,0 +1,310 @@
+package sqlguard
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrDenied 表示查询引用了访问策略禁止的 Schema 或表
+var ErrDenied = errors.New("查询引用了被访问策略禁止的对象")
+
+// systemSchemas 是不受允许列表限制的 Schema: 系统目录，以及写入工具使用的 temp schema。
+// 拒绝列表仍然对它们生效。
+var systemSchemas = map[string]bool{
+	"pg_catalog":         true,
+	"information_schema": true,
+	"temp":               true,
+}
+
+// dynamicSQLFunctions 是以 SQL 文本 (或运行时拼接的表名) 为参数执行查询的函数。
+// 词法检查看不到运行时拼接出的文本 (例如 query_to_xml('select * from sec' || 'ret', ...))，访问策略生效时一律拒绝。
+var dynamicSQLFunctions = map[string]bool{
+	"query_to_xml":               true,
+	"query_to_xmlschema":         true,
+	"query_to_xml_and_xmlschema": true,
+	"cursor_to_xml":              true,
+	"cursor_to_xmlschema":        true,
+	"table_to_xml":               true,
+	"table_to_xmlschema":         true,
+	"table_to_xml_and_xmlschema": true,
+	"ts_stat":                    true,
+	"exec":                       true,
+	"exec_sql":                   true,
+	"execute_sql":                true,
+	"eval":                       true,
+}
+
+// dynamicSQLFunctionPrefixes 是按前缀拒绝的函数族: dblink 系列在另一个会话中执行任意 SQL 文本，
+// schema_to_xml / database_to_xml 系列按名称导出整个 Schema 或数据库。
+var dynamicSQLFunctionPrefixes = []string{"dblink", "schema_to_xml", "database_to_xml"}
+
+// isDynamicSQLFunction 判断名称是否属于执行 SQL 文本的函数
+func isDynamicSQLFunction(name string) bool {
+	name = strings.ToLower(name)
+	if dynamicSQLFunctions[name] {
+		return true
+	}
+	for _, prefix := range dynamicSQLFunctionPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy 是一组 Schema/表的允许和拒绝规则。
+// 表规则的格式为 schema.table，两部分都支持 * 和 ? 通配符；名称比较不区分大小写。
+// 拒绝优先于允许；允许列表为空表示不限制。
+type Policy struct {
+	AllowSchemas []string `json:"allow_schemas,omitempty"`
+	DenySchemas  []string `json:"deny_schemas,omitempty"`
+	AllowTables  []string `json:"allow_tables,omitempty"`
+	DenyTables   []string `json:"deny_tables,omitempty"`
+}
+
+// Validate 检查规则格式: 表规则必须是 schema.table
+func (p Policy) Validate() error {
+	for _, pattern := range append(append([]string{}, p.AllowTables...), p.DenyTables...) {
+		if parts := strings.Split(pattern, "."); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("无效的表规则 '%s' (格式为 schema.table，可使用 * 通配符)", pattern)
+		}
+	}
+	patterns := append(append(append(append([]string{}, p.AllowSchemas...), p.DenySchemas...), p.AllowTables...), p.DenyTables...)
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.ToLower(pattern), ""); err != nil {
+			return fmt.Errorf("无效的规则 '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// IsZero 判断策略是否没有任何规则
+func (p Policy) IsZero() bool {
+	return len(p.AllowSchemas) == 0 && len(p.DenySchemas) == 0 && len(p.AllowTables) == 0 && len(p.DenyTables) == 0
+}
+
+func (p Policy) hasAllowRules() bool {
+	return len(p.AllowSchemas) > 0 || len(p.AllowTables) > 0
+}
+
+// schemaDenied 判断整个 Schema 是否被拒绝
+func (p Policy) schemaDenied(schema string) bool {
+	return matchAny(p.DenySchemas, schema)
+}
+
+// tableAllowed 判断 schema.table 是否允许访问
+func (p Policy) tableAllowed(schema, table string) bool {
+	if p.schemaDenied(schema) || matchAnyTable(p.DenyTables, schema, table) {
+		return false
+	}
+	if !p.hasAllowRules() || systemSchemas[strings.ToLower(schema)] {
+		return true
+	}
+	return matchAny(p.AllowSchemas, schema) || matchAnyTable(p.AllowTables, schema, table)
+}
+
+// schemaVisible 判断 Schema 中是否可能有允许访问的表
+func (p Policy) schemaVisible(schema string) bool {
+	if p.schemaDenied(schema) {
+		return false
+	}
+	if !p.hasAllowRules() || systemSchemas[strings.ToLower(schema)] || matchAny(p.AllowSchemas, schema) {
+		return true
+	}
+	for _, pattern := range p.AllowTables {
+		if match(strings.SplitN(pattern, ".", 2)[0], schema) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policies 是同时生效的多层策略 (例如全局配置和连接级别的选项)，对象必须被每一层都允许
+type Policies []Policy
+
+// IsZero 判断是否没有任何规则
+func (ps Policies) IsZero() bool {
+	for _, p := range ps {
+		if !p.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// SchemaVisible 判断 Schema 是否应出现在 Schema 缓存中
+func (ps Policies) SchemaVisible(schema string) bool {
+	for _, p := range ps {
+		if !p.schemaVisible(schema) {
+			return false
+		}
+	}
+	return true
+}
+
+// TableAllowed 判断表是否允许访问 (也用于决定 Schema 缓存中是否包含该表)
+func (ps Policies) TableAllowed(schema, table string) bool {
+	for _, p := range ps {
+		if !p.tableAllowed(schema, table) {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchPath 返回连接应使用的 search_path，使未限定 Schema 的表名只能解析到允许的 Schema。
+// 返回空字符串表示不需要修改。
+// 有允许列表时为允许列表中出现的 (非通配) Schema；只有拒绝列表时为默认的 "$user", public 去掉被拒绝的 Schema。
+func (ps Policies) SearchPath() string {
+	if ps.IsZero() {
+		return ""
+	}
+	candidates := []string{"$user", "public"}
+	restricted := false
+	for _, p := range ps {
+		if p.hasAllowRules() {
+			restricted = true
+			candidates = nil
+			for _, schema := range p.AllowSchemas {
+				if !strings.ContainsAny(schema, "*?") {
+					candidates = append(candidates, schema)
+				}
+			}
+			for _, pattern := range p.AllowTables {
+				if schema := strings.SplitN(pattern, ".", 2)[0]; !strings.ContainsAny(schema, "*?") {
+					candidates = append(candidates, schema)
+				}
+			}
+			break
+		}
+	}
+	var searchPath []string
+	for _, schema := range candidates {
+		if schema == "$user" || ps.SchemaVisible(schema) {
+			searchPath = append(searchPath, quoteSearchPathEntry(schema))
+		} else {
+			restricted = true
+		}
+	}
+	if !restricted {
+		return ""
+	}
+	if len(searchPath) == 0 {
+		// 没有可用的 Schema 时只保留系统目录 (pg_catalog 总是隐式地位于 search_path 中)
+		return "pg_catalog"
+	}
+	return strings.Join(searchPath, ", ")
+}
+
+// CheckQuery 检查查询文本引用的对象是否被策略禁止。
+// 这是基于词法的保守检查: 任何与被拒绝对象同名的标识符都会导致拒绝 (包括字符串字面量中的名称，
+// 以防通过 query_to_xml 等接受 SQL 文本的函数绕过)；修改 search_path 的语句和执行 SQL 文本的函数
+// (query_to_xml、dblink 等，参数可能在运行时拼接) 也会被拒绝。
+// isSchema 判断名称是否为数据库中存在的 Schema，用于区分 schema.table 与 alias.column；可以为 nil (此时不检查允许列表中的限定名)。
+func (ps Policies) CheckQuery(sql string, isSchema func(string) bool) error {
+	if ps.IsZero() {
+		return nil
+	}
+	for _, chain := range identifierChains(sql) {
+		for _, name := range chain {
+			if strings.EqualFold(name, "search_path") || strings.EqualFold(name, "set_config") {
+				return fmt.Errorf("%w: 访问策略生效时不允许修改 search_path", ErrDenied)
+			}
+			if isDynamicSQLFunction(name) {
+				return fmt.Errorf("%w: 访问策略生效时不允许调用执行 SQL 文本的函数 '%s'", ErrDenied, name)
+			}
+		}
+		for i := 0; i+1 < len(chain); i++ {
+			schema, table := chain[i], chain[i+1]
+			if ps.schemaDenied(schema) {
+				return fmt.Errorf("%w: Schema '%s'", ErrDenied, schema)
+			}
+			if ps.tableDenied(schema, table) || (isSchema != nil && isSchema(schema) && !ps.TableAllowed(schema, table)) {
+				return fmt.Errorf("%w: 表 '%s.%s'", ErrDenied, schema, table)
+			}
+		}
+		// 未限定 Schema 的名称: 与任何被拒绝的表同名即拒绝
+		for _, name := range chain {
+			if ps.tableNameDenied(name) {
+				return fmt.Errorf("%w: 表 '%s'", ErrDenied, name)
+			}
+		}
+	}
+	return nil
+}
+
+// HasAllowRules 判断是否有任何一层配置了允许列表 (此时 CheckQuery 需要知道哪些名称是 Schema)
+func (ps Policies) HasAllowRules() bool {
+	for _, p := range ps {
+		if p.hasAllowRules() {
+			return true
+		}
+	}
+	return false
+}
+
+func (ps Policies) schemaDenied(schema string) bool {
+	for _, p := range ps {
+		if p.schemaDenied(schema) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ps Policies) tableDenied(schema, table string) bool {
+	for _, p := range ps {
+		if matchAnyTable(p.DenyTables, schema, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableNameDenied 判断名称是否与某条拒绝规则的表名部分相同 (不考虑 Schema)。
+// 表名部分只有通配符的规则 (例如 audit.*) 等同于拒绝整个 Schema，不参与未限定名称的匹配。
+func (ps Policies) tableNameDenied(name string) bool {
+	for _, p := range ps {
+		for _, pattern := range p.DenyTables {
+			parts := strings.SplitN(pattern, ".", 2)
+			if len(parts) == 2 && strings.Trim(parts[1], "*") != "" && match(parts[1], name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func match(pattern, name string) bool {
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return err == nil && matched
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyTable(patterns []string, schema, table string) bool {
+	for _, pattern := range patterns {
+		parts := strings.SplitN(pattern, ".", 2)
+		if len(parts) == 2 && match(parts[0], schema) && match(parts[1], table) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteSearchPathEntry 为 search_path 中的 Schema 名加引号 ($user 保持原样)
+func quoteSearchPathEntry(schema string) string {
+	if schema == "$user" {
+		return `"$user"`
+	}
+	return `"` + strings.ReplaceAll(schema, `"`, `""`) + `"`
+}
@@ -0,0 +1,112 @@
+package sqlguard
+
+import "strings"
+
+// maxLiteralDepth 限制递归扫描字符串字面量的层数
+const maxLiteralDepth = 3
+
+// identifierChains 从 SQL 文本中提取所有由点连接的标识符序列，例如 "public.users.id" -> [public users id]。
+// 未加引号的标识符转换为小写，加引号的保持原样；注释被跳过。
+// 字符串字面量和美元引用字符串的内容会被当作 SQL 再扫描一次，
+// 使 query_to_xml('select * from secret', ...) 或 'public.secret'::regclass 这类引用也能被发现。
+func identifierChains(sql string) [][]string {
+	return collectChains(sql, 0)
+}
+
+// IdentifierChains 是 identifierChains 的导出版本，用于按查询文本定位其引用的表 (例如为提示组装表定义)。
+func IdentifierChains(sql string) [][]string {
+	return identifierChains(sql)
+}
+
+func collectChains(sql string, depth int) [][]string {
+	var chains [][]string
+	var current []string
+	expectPart := false // 上一个有效字符是 '.'，下一个标识符属于当前序列
+
+	flush := func() {
+		if len(current) > 0 {
+			chains = append(chains, current)
+		}
+		current = nil
+		expectPart = false
+	}
+	addPart := func(part string) {
+		if !expectPart {
+			flush()
+		}
+		current = append(current, part)
+		expectPart = false
+	}
+	scanLiteral := func(content string) {
+		if depth < maxLiteralDepth {
+			chains = append(chains, collectChains(content, depth+1)...)
+		}
+	}
+
+	for _, token := range Lex(sql) {
+		switch token.Kind {
+		case TokenComment:
+			// 注释不打断 "schema /* ... */ . table"
+		case TokenOther:
+			switch token.Text {
+			case " ", "\t", "\n", "\r":
+				// 空白不打断 "schema . table"
+			case ".":
+				expectPart = len(current) > 0
+			default:
+				flush()
+			}
+		case TokenQuotedIdent:
+			addPart(strings.ReplaceAll(unquote(token.Text, '"'), `""`, `"`))
+		case TokenString:
+			flush()
+			scanLiteral(literalContent(token))
+		case TokenWord:
+			addPart(strings.ToLower(token.Text))
+		default:
+			flush() // 数字字面量和位置参数
+		}
+	}
+	flush()
+	return chains
+}
+
+// skipQuoted 返回从 start 处的引号开始的字面量或标识符结束后的位置，连续两个引号视为转义；
+// backslash 为 true 时 (E'...' 字符串) 反斜杠也转义下一个字符
+func skipQuoted(sql string, start int, quote byte, backslash bool) int {
+	for j := start + 1; j < len(sql); j++ {
+		if backslash && sql[j] == '\\' {
+			j++
+			continue
+		}
+		if sql[j] == quote {
+			if j+1 < len(sql) && sql[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(sql)
+}
+
+// dollarQuoteTag 识别以 $ 开头的美元引用标记 ($$ 或 $tag$)，$1 这样的位置参数不是标记
+func dollarQuoteTag(s string) (string, bool) {
+	for j := 1; j < len(s); j++ {
+		if s[j] == '$' {
+			return s[:j+1], true
+		}
+		if !isIdentChar(s[j]) || (j == 1 && !isIdentStart(s[j])) {
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,111 @@
+package toolpacks
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// defaultTimeout 是未设置 timeout 的工具的执行超时
+const defaultTimeout = 60 * time.Second
+
+// ExecTimeout 返回工具的执行超时
+func (t ToolDef) ExecTimeout() time.Duration {
+	if t.Timeout == "" {
+		return defaultTimeout
+	}
+	timeout, err := parseTimeout(t.Timeout)
+	if err != nil {
+		return defaultTimeout
+	}
+	return timeout
+}
+
+func parseTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("无效的 timeout '%s' (例如 30s, 2m)", value)
+	}
+	return timeout, nil
+}
+
+// BindArgs 按参数定义检查调用参数并返回每个命名参数的值:
+// 缺少必填参数或类型不匹配时返回错误，未提供的可选参数使用默认值或 NULL，未定义的参数视为错误。
+// array 和 object 参数以 JSON 文本传入 (SQL 中可以使用 :name::jsonb)。
+func (t ToolDef) BindArgs(arguments map[string]any) (map[string]any, error) {
+	declared := make(map[string]bool, len(t.Params))
+	for _, param := range t.Params {
+		declared[param.Name] = true
+	}
+	for name := range arguments {
+		if name != "conn_id" && !declared[name] {
+			return nil, fmt.Errorf("未定义的参数 '%s'", name)
+		}
+	}
+
+	values := make(map[string]any, len(t.Params))
+	for _, param := range t.Params {
+		value, ok := arguments[param.Name]
+		if !ok || value == nil {
+			if param.Required {
+				return nil, fmt.Errorf("缺少必填参数 '%s'", param.Name)
+			}
+			value = param.Default
+		}
+		converted, err := convertArg(param, value)
+		if err != nil {
+			return nil, err
+		}
+		values[param.Name] = converted
+	}
+	return values, nil
+}
+
+// convertArg 将 JSON 解码得到的值转换为参数类型对应的 Go 值
+func convertArg(param ParamDef, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch param.Type {
+	case ParamString, "":
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+	case ParamInteger:
+		switch v := value.(type) {
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v), nil
+			}
+		case int:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		}
+	case ParamNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+	case ParamBoolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case ParamArray, ParamObject:
+		_, isArray := value.([]any)
+		_, isObject := value.(map[string]any)
+		if (param.Type == ParamArray && isArray) || (param.Type == ParamObject && isObject) {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("序列化参数 '%s' 失败: %w", param.Name, err)
+			}
+			return string(data), nil
+		}
+	}
+	return nil, fmt.Errorf("参数 '%s' 应为 %s 类型，实际为 %T", param.Name, param.Type, value)
+}
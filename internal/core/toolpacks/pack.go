@@ -0,0 +1,158 @@
+package toolpacks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// 参数类型 (与 JSON Schema 的类型名一致)
+const (
+	ParamString  = "string"
+	ParamInteger = "integer"
+	ParamNumber  = "number"
+	ParamBoolean = "boolean"
+	ParamArray   = "array"
+	ParamObject  = "object"
+)
+
+// toolNamePattern 限制工具名和参数名的格式
+var toolNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Pack 是一个工具包文件的内容:
+//
+//	name: billing
+//	description: 账单相关的常用查询
+//	tools:
+//	  - name: billing_overdue_invoices
+//	    description: 列出逾期超过指定天数的发票
+//	    sql: SELECT id, customer_id, due_date FROM billing.invoices WHERE due_date < now() - make_interval(days => :days)
+//	    params:
+//	      - name: days
+//	        type: integer
+//	        required: true
+type Pack struct {
+	Name        string    `yaml:"name" json:"name"`                                   // 工具包名称 (默认为文件名)
+	Description string    `yaml:"description,omitempty" json:"description,omitempty"` // 工具包说明
+	Tools       []ToolDef `yaml:"tools" json:"tools"`                                 // 工具列表
+	File        string    `yaml:"-" json:"file"`                                      // 来源文件
+}
+
+// ToolDef 是工具包中定义的一个工具
+type ToolDef struct {
+	Name        string     `yaml:"name" json:"name"`                               // 工具名称，不能与内置工具或其他工具包重复
+	Description string     `yaml:"description" json:"description"`                 // 工具说明，展示给客户端
+	SQL         string     `yaml:"sql" json:"sql"`                                 // SQL 模板，参数使用 :name 命名占位符
+	Params      []ParamDef `yaml:"params,omitempty" json:"params,omitempty"`       // 参数定义
+	ReadOnly    *bool      `yaml:"read_only,omitempty" json:"read_only,omitempty"` // 是否只读，默认为 true
+	Timeout     string     `yaml:"timeout,omitempty" json:"timeout,omitempty"`     // 执行超时 (Go duration 格式)，默认 60s
+	Pack        string     `yaml:"-" json:"pack"`                                  // 所属工具包
+}
+
+// ParamDef 是工具参数的定义
+type ParamDef struct {
+	Name        string `yaml:"name" json:"name"`                                   // 参数名，对应 SQL 模板中的 :name
+	Type        string `yaml:"type,omitempty" json:"type,omitempty"`               // string (默认), integer, number, boolean, array, object
+	Description string `yaml:"description,omitempty" json:"description,omitempty"` // 参数说明
+	Required    bool   `yaml:"required,omitempty" json:"required,omitempty"`       // 是否必填；非必填且未提供时使用 default，没有 default 时为 NULL
+	Default     any    `yaml:"default,omitempty" json:"default,omitempty"`         // 默认值
+}
+
+// IsReadOnly 返回工具是否只读 (未设置时为 true)
+func (t ToolDef) IsReadOnly() bool {
+	return t.ReadOnly == nil || *t.ReadOnly
+}
+
+// Load 读取目录下所有 .yaml/.yml 工具包文件。
+// 目录为空字符串时不加载任何工具包；任何文件格式错误或工具重名都会返回错误，避免部分加载。
+func Load(dir string) ([]Pack, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取工具包目录 '%s' 失败: %w", dir, err)
+	}
+
+	var packs []Pack
+	seen := make(map[string]string) // 工具名 -> 来源文件
+	for _, file := range files {
+		fileName := file.Name()
+		if file.IsDir() || (!strings.HasSuffix(fileName, ".yaml") && !strings.HasSuffix(fileName, ".yml")) {
+			continue
+		}
+		filePath := filepath.Join(dir, fileName)
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("读取工具包文件 '%s' 失败: %w", filePath, err)
+		}
+		var pack Pack
+		if err := yaml.Unmarshal(data, &pack); err != nil {
+			return nil, fmt.Errorf("解析工具包文件 '%s' 失败: %w", filePath, err)
+		}
+		if pack.Name == "" {
+			pack.Name = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+		}
+		pack.File = filePath
+		for i := range pack.Tools {
+			tool := &pack.Tools[i]
+			tool.Pack = pack.Name
+			if err := tool.Validate(); err != nil {
+				return nil, fmt.Errorf("工具包文件 '%s' 中的工具 '%s' 无效: %w", filePath, tool.Name, err)
+			}
+			if previous, ok := seen[tool.Name]; ok {
+				return nil, fmt.Errorf("工具 '%s' 在 '%s' 和 '%s' 中重复定义", tool.Name, previous, filePath)
+			}
+			seen[tool.Name] = filePath
+		}
+		utils.DefaultLogger.Info("已加载工具包", zap.String("pack", pack.Name), zap.String("file", filePath), zap.Int("tools", len(pack.Tools)))
+		packs = append(packs, pack)
+	}
+	sort.Slice(packs, func(i, j int) bool { return packs[i].Name < packs[j].Name })
+	return packs, nil
+}
+
+// Validate 检查工具定义: 名称格式、SQL 非空、参数类型合法且不重复、超时格式正确
+func (t *ToolDef) Validate() error {
+	if !toolNamePattern.MatchString(t.Name) {
+		return fmt.Errorf("工具名必须由小写字母、数字和下划线组成并以字母开头")
+	}
+	if strings.TrimSpace(t.Description) == "" {
+		return fmt.Errorf("缺少 description")
+	}
+	if strings.TrimSpace(t.SQL) == "" {
+		return fmt.Errorf("缺少 sql")
+	}
+	if t.Timeout != "" {
+		if _, err := parseTimeout(t.Timeout); err != nil {
+			return err
+		}
+	}
+	names := make(map[string]bool, len(t.Params))
+	for i := range t.Params {
+		param := &t.Params[i]
+		if !toolNamePattern.MatchString(param.Name) || param.Name == "conn_id" {
+			return fmt.Errorf("参数名 '%s' 无效 (小写字母、数字和下划线，conn_id 为保留参数)", param.Name)
+		}
+		if names[param.Name] {
+			return fmt.Errorf("参数 '%s' 重复定义", param.Name)
+		}
+		names[param.Name] = true
+		if param.Type == "" {
+			param.Type = ParamString
+		}
+		switch param.Type {
+		case ParamString, ParamInteger, ParamNumber, ParamBoolean, ParamArray, ParamObject:
+		default:
+			return fmt.Errorf("参数 '%s' 的类型 '%s' 无效 (可选 string, integer, number, boolean, array, object)", param.Name, param.Type)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+// Package corpus 把工具调用中执行的 SQL 记录为 NL2SQL 训练语料 (JSONL)。
+//
+// 每条样本包含客户端提供的自然语言问题 (可选的 question 参数)、SQL、当时的 Schema 快照哈希以及执行结果，
+// 与审计日志同时写入但互不影响，便于团队在自己的数据库上微调 NL2SQL 模型。
+package corpus
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// QuestionArg 是工具调用中携带自然语言问题的参数名
+const QuestionArg = "question"
+
+// QuestionProperty 是 question 参数在工具 InputSchema 中的定义 (仅在开启语料记录时加入)
+var QuestionProperty = &protocol.Property{
+	Type:        protocol.String,
+	Description: "(可选) 这条 SQL 要回答的自然语言问题，会与 SQL 一起记录为训练语料",
+}
+
+// sqlArgumentNames 是工具参数中被视为 SQL 文本的字段 (与审计日志一致)
+var sqlArgumentNames = []string{"query", "sql"}
+
+// Example 是一条训练样本
+type Example struct {
+	Timestamp  time.Time `json:"timestamp"`          // 调用开始时间
+	Tool       string    `json:"tool"`               // 工具名称
+	ConnID     string    `json:"conn_id,omitempty"`  // 目标连接 ID
+	Question   string    `json:"question,omitempty"` // 自然语言问题 (客户端提供时)
+	SQL        string    `json:"sql"`                // 执行的 SQL
+	SchemaHash string    `json:"schema_hash"`        // 调用时 Schema 快照 (表、列、类型) 的哈希
+	Success    bool      `json:"success"`            // 是否执行成功
+	Error      string    `json:"error,omitempty"`    // 失败时的错误信息
+	DurationMs int64     `json:"duration_ms"`        // 执行时长 (毫秒)
+}
+
+// Recorder 在传输层观察带 SQL 的工具调用，把样本追加到 JSONL 文件 (按大小轮转)。
+// 为 nil 时所有方法都是空操作。
+type Recorder struct {
+	file          *utils.RotatingFile
+	schemaManager schemas.Manager
+
+	mu       sync.Mutex
+	pending  map[string]*Example // sessionID + "/" + 请求 ID -> 等待响应的样本
+	hashOf   *schemas.DatabaseInfo
+	lastHash string
+}
+
+// New 按配置创建 Recorder；未开启语料记录时返回 nil。
+func New(cfg *config.Config, schemaManager schemas.Manager) (*Recorder, error) {
+	if !cfg.CorpusEnabled {
+		return nil, nil
+	}
+	if cfg.CorpusFile == "" {
+		return nil, fmt.Errorf("训练语料文件路径 (CORPUS_FILE) 不能为空")
+	}
+	file, err := utils.OpenRotatingFile(cfg.CorpusFile, int64(cfg.CorpusMaxSizeMB)<<20, cfg.CorpusMaxBackups, 0)
+	if err != nil {
+		return nil, fmt.Errorf("打开训练语料文件失败: %w", err)
+	}
+	utils.DefaultLogger.Info("训练语料记录已启用", zap.String("file", cfg.CorpusFile), zap.Int("maxSizeMB", cfg.CorpusMaxSizeMB), zap.Int("maxBackups", cfg.CorpusMaxBackups))
+	return &Recorder{file: file, schemaManager: schemaManager, pending: make(map[string]*Example)}, nil
+}
+
+// Enabled 返回是否开启了语料记录
+func (r *Recorder) Enabled() bool {
+	return r != nil
+}
+
+// Close 关闭语料文件
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// WrapTransport 返回一个包装后的传输层，带 SQL 的工具调用完成时写入一条样本。
+// 未开启语料记录时直接返回原传输层。
+func (r *Recorder) WrapTransport(inner transport.ServerTransport) transport.ServerTransport {
+	if r == nil {
+		return inner
+	}
+	return &recordingTransport{ServerTransport: inner, recorder: r}
+}
+
+type recordingTransport struct {
+	transport.ServerTransport
+	recorder *Recorder
+}
+
+// rpcMessage 是记录样本所需的 JSON-RPC 消息字段
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// onReceive 记录带 SQL 参数的 tools/call 请求
+func (r *Recorder) onReceive(sessionID string, msg []byte) {
+	var message rpcMessage
+	if err := json.Unmarshal(msg, &message); err != nil || protocol.Method(message.Method) != protocol.ToolsCall || len(message.ID) == 0 {
+		return
+	}
+	var params struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	}
+	if err := json.Unmarshal(message.Params, &params); err != nil {
+		return
+	}
+	example := &Example{Timestamp: time.Now(), Tool: params.Name}
+	for _, name := range sqlArgumentNames {
+		if sql, ok := params.Arguments[name].(string); ok && sql != "" {
+			example.SQL = sql
+			break
+		}
+	}
+	if example.SQL == "" {
+		return
+	}
+	example.ConnID, _ = params.Arguments["conn_id"].(string)
+	example.Question, _ = params.Arguments[QuestionArg].(string)
+
+	r.mu.Lock()
+	example.SchemaHash = r.schemaHash()
+	r.pending[sessionID+"/"+string(message.ID)] = example
+	r.mu.Unlock()
+}
+
+// onSend 在响应发出时补全执行结果并写入样本
+func (r *Recorder) onSend(sessionID string, msg []byte) {
+	var message rpcMessage
+	if err := json.Unmarshal(msg, &message); err != nil || message.Method != "" || len(message.ID) == 0 {
+		return
+	}
+	key := sessionID + "/" + string(message.ID)
+	r.mu.Lock()
+	example, ok := r.pending[key]
+	delete(r.pending, key)
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	example.DurationMs = time.Since(example.Timestamp).Milliseconds()
+	example.Success = true
+	if message.Error != nil {
+		example.Success, example.Error = false, message.Error.Message
+	} else {
+		var result protocol.CallToolResult
+		if err := json.Unmarshal(message.Result, &result); err == nil && result.IsError {
+			example.Success = false
+			for _, content := range result.Content {
+				if text, ok := content.(protocol.TextContent); ok {
+					example.Error = text.Text
+					break
+				}
+			}
+		}
+	}
+
+	line, err := json.Marshal(example)
+	if err != nil {
+		utils.DefaultLogger.Error("序列化训练样本失败", zap.String("tool", example.Tool), zap.Error(err))
+		return
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		utils.DefaultLogger.Error("写入训练语料失败", zap.Error(err))
+	}
+}
+
+// schemaHash 返回当前 Schema 快照的哈希，Schema 重新加载后重新计算，调用方需持有锁。
+// 只包含表、列名、类型和可空性，行数等统计信息的变化不会改变哈希。
+func (r *Recorder) schemaHash() string {
+	info, ok := r.schemaManager.GetDatabaseInfo()
+	if !ok || info == nil {
+		return ""
+	}
+	if info == r.hashOf {
+		return r.lastHash
+	}
+	hash := sha256.New()
+	for _, schema := range info.Schemas {
+		for _, table := range schema.Tables {
+			fmt.Fprintf(hash, "%s.%s\n", schema.Name, table.Name)
+			for _, column := range table.Columns {
+				fmt.Fprintf(hash, "\t%s %s %t\n", column.Name, column.Type, column.IsNullable)
+			}
+		}
+	}
+	r.hashOf = info
+	r.lastHash = "sha256:" + hex.EncodeToString(hash.Sum(nil))[:16]
+	return r.lastHash
+}
+
+// Send 实现 transport.ServerTransport 接口。
+func (t *recordingTransport) Send(ctx context.Context, sessionID string, msg transport.Message) error {
+	err := t.ServerTransport.Send(ctx, sessionID, msg)
+	t.recorder.onSend(sessionID, msg)
+	return err
+}
+
+// SetReceiver 实现 transport.ServerTransport 接口。
+func (t *recordingTransport) SetReceiver(receiver transport.ServerReceiver) {
+	t.ServerTransport.SetReceiver(transport.ServerReceiverF(func(ctx context.Context, sessionID string, msg []byte) error {
+		t.recorder.onReceive(sessionID, msg)
+		return receiver.Receive(ctx, sessionID, msg)
+	}))
+}
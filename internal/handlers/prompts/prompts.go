@@ -0,0 +1,523 @@
+// Package prompts 提供内置的 MCP 提示 (prompts)，从 Schema 缓存和扩展知识组装编写和优化 SQL 所需的上下文。
+package prompts
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/extensions"
+	"github.com/cbc3929/pg_mcp_server/internal/core/retrieval"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	maxPromptTables    = 10   // 一个提示中最多附带的表定义数
+	rankedTables       = 5    // 问题中未提到表名时按相关度补充的表数
+	maxKnowledgeChars  = 3000 // 每个扩展知识附带的最大字符数，完整内容通过资源读取
+	relevantKnowledge  = 2    // 按问题检索的扩展知识数
+	minKnowledgeScore  = 0.2  // 低于该相似度的扩展知识不附带
+	maxPromptExamples  = 3    // 每个扩展附带的最大示例查询数
+	defaultPromptLimit = 4000 // 表定义部分的 token 预算 (近似值)
+)
+
+// Library 组装内置提示的内容
+type Library struct {
+	schemaManager schemas.Manager
+	extManager    extensions.Manager
+	ranker        *retrieval.Ranker // 为 nil 时不按相关度补充表和扩展知识
+	tokenBudget   int
+}
+
+// NewLibrary 创建提示库，tokenBudget 为表定义部分的近似 token 上限 (<= 0 时使用默认值)。
+func NewLibrary(schemaManager schemas.Manager, extManager extensions.Manager, ranker *retrieval.Ranker, tokenBudget int) *Library {
+	if tokenBudget <= 0 {
+		tokenBudget = defaultPromptLimit
+	}
+	return &Library{schemaManager: schemaManager, extManager: extManager, ranker: ranker, tokenBudget: tokenBudget}
+}
+
+// 内置提示的定义
+var (
+	GenerateSQLPrompt = &protocol.Prompt{
+		Name:        "generate_sql",
+		Description: "根据自然语言问题编写 PostgreSQL 查询，自动附带问题中提到的表 (或按相关度检索的表) 的列、索引、外键、相关扩展知识和已安装扩展的示例查询",
+		Arguments: []protocol.PromptArgument{
+			{Name: "question", Description: "要用 SQL 回答的问题", Required: true},
+			{Name: "tables", Description: "(可选) 逗号分隔的表名 (schema.table 或 table)，指定后不再自动识别"},
+			{Name: "conn_id", Description: "(可选) 执行查询使用的连接 ID，写入提示中供 pg_query 调用"},
+		},
+	}
+	ExplainPlanReviewPrompt = &protocol.Prompt{
+		Name:        "explain_plan_review",
+		Description: "审查查询的执行计划: 附带查询涉及的表定义、索引和行数，指出顺序扫描、估算偏差、排序溢出等问题",
+		Arguments: []protocol.PromptArgument{
+			{Name: "query", Description: "要审查的 SQL 查询", Required: true},
+			{Name: "plan", Description: "(可选) pg_explain 返回的执行计划，未提供时提示先调用 pg_explain"},
+			{Name: "conn_id", Description: "(可选) 用于调用 pg_explain 的连接 ID"},
+		},
+	}
+	OptimizeQueryPrompt = &protocol.Prompt{
+		Name:        "optimize_query",
+		Description: "改写并优化 SQL 查询: 附带查询涉及的表定义、索引和行数，要求给出等价改写、索引建议及其取舍",
+		Arguments: []protocol.PromptArgument{
+			{Name: "query", Description: "要优化的 SQL 查询", Required: true},
+			{Name: "goal", Description: "(可选) 优化目标，例如降低延迟、减少 I/O 或避免锁"},
+			{Name: "plan", Description: "(可选) 当前的执行计划"},
+			{Name: "conn_id", Description: "(可选) 用于验证改写结果的连接 ID"},
+		},
+	}
+)
+
+// promptTable 是提示中附带的一张表
+type promptTable struct {
+	schema string
+	table  *schemas.TableInfo
+}
+
+// GenerateSQL 组装 'generate_sql' 提示
+func (l *Library) GenerateSQL(ctx context.Context, request *protocol.GetPromptRequest) (*protocol.GetPromptResult, error) {
+	question := strings.TrimSpace(request.Arguments["question"])
+	if question == "" {
+		return nil, fmt.Errorf("缺少 'question' 参数")
+	}
+	dbInfo, err := l.databaseInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []promptTable
+	var missing []string
+	if names := request.Arguments["tables"]; strings.TrimSpace(names) != "" {
+		tables, missing = resolveTables(dbInfo, strings.Split(names, ","))
+	} else {
+		tables = mentionedTables(dbInfo, tokenize(question))
+		if len(tables) == 0 && l.ranker != nil {
+			tables = l.rankedTables(ctx, dbInfo, question)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("你是 PostgreSQL 专家。请根据下面的表结构编写一条只读 SQL 查询来回答问题。\n")
+	b.WriteString("要求:\n")
+	b.WriteString("- 只使用下面列出的表和列，表名使用 schema.table 形式；需要其他表时先调用 search_schema 或 relevant_schema 工具\n")
+	b.WriteString("- 按外键关系编写 JOIN 条件，不要猜测列名\n")
+	b.WriteString("- 用 $1, $2... 占位符传入问题中出现的常量\n")
+	b.WriteString("- 标记为脱敏的列在结果中会被替换，不要依赖其真实值做过滤\n")
+	b.WriteString("- 先给出 SQL，再用一两句话说明思路\n")
+	if connID := request.Arguments["conn_id"]; connID != "" {
+		fmt.Fprintf(&b, "- 编写完成后可用 pg_query 工具在连接 %s 上执行 (结果行数较多时加 LIMIT)\n", connID)
+	}
+	b.WriteString("\n")
+	l.writeTables(&b, tables, missing)
+	l.writeKnowledge(ctx, &b, dbInfo, tables, question)
+	fmt.Fprintf(&b, "## 问题\n%s\n", question)
+
+	utils.DefaultLogger.Info("组装 generate_sql 提示", zap.Int("tables", len(tables)), zap.Strings("missing", missing))
+	return newPromptResult(GenerateSQLPrompt.Description, b.String()), nil
+}
+
+// ExplainPlanReview 组装 'explain_plan_review' 提示
+func (l *Library) ExplainPlanReview(_ context.Context, request *protocol.GetPromptRequest) (*protocol.GetPromptResult, error) {
+	query := strings.TrimSpace(request.Arguments["query"])
+	if query == "" {
+		return nil, fmt.Errorf("缺少 'query' 参数")
+	}
+	dbInfo, err := l.databaseInfo()
+	if err != nil {
+		return nil, err
+	}
+	tables := referencedTables(dbInfo, query)
+
+	var b strings.Builder
+	b.WriteString("你是 PostgreSQL 性能专家。请审查下面查询的执行计划，按影响从大到小列出问题:\n")
+	b.WriteString("- 大表上的顺序扫描，以及可以利用的已有索引\n")
+	b.WriteString("- 估算行数与实际行数 (若有 ANALYZE 数据) 相差一个数量级以上的节点，以及可能的原因 (统计信息过期、相关列)\n")
+	b.WriteString("- 嵌套循环的外层行数过多、Hash 或 Sort 溢出到磁盘\n")
+	b.WriteString("- 对每个问题给出具体的修改建议 (改写、索引、ANALYZE 或参数)，并说明需要验证的指标\n\n")
+	l.writeTables(&b, tables, nil)
+	fmt.Fprintf(&b, "## 查询\n```sql\n%s\n```\n\n", query)
+	if plan := strings.TrimSpace(request.Arguments["plan"]); plan != "" {
+		fmt.Fprintf(&b, "## 执行计划\n```\n%s\n```\n", plan)
+	} else {
+		b.WriteString("## 执行计划\n尚未提供。请先调用 pg_explain 工具获取该查询的执行计划")
+		if connID := request.Arguments["conn_id"]; connID != "" {
+			fmt.Fprintf(&b, " (conn_id: %s)", connID)
+		}
+		b.WriteString("，再进行审查。\n")
+	}
+
+	utils.DefaultLogger.Info("组装 explain_plan_review 提示", zap.Int("tables", len(tables)))
+	return newPromptResult(ExplainPlanReviewPrompt.Description, b.String()), nil
+}
+
+// OptimizeQuery 组装 'optimize_query' 提示
+func (l *Library) OptimizeQuery(_ context.Context, request *protocol.GetPromptRequest) (*protocol.GetPromptResult, error) {
+	query := strings.TrimSpace(request.Arguments["query"])
+	if query == "" {
+		return nil, fmt.Errorf("缺少 'query' 参数")
+	}
+	dbInfo, err := l.databaseInfo()
+	if err != nil {
+		return nil, err
+	}
+	tables := referencedTables(dbInfo, query)
+
+	var b strings.Builder
+	b.WriteString("你是 PostgreSQL 性能专家。请优化下面的查询:\n")
+	if goal := strings.TrimSpace(request.Arguments["goal"]); goal != "" {
+		fmt.Fprintf(&b, "- 优化目标: %s\n", goal)
+	}
+	b.WriteString("- 给出语义等价的改写 (注意 NULL、重复行和排序语义)，说明为什么更快\n")
+	b.WriteString("- 如需新索引，给出 CREATE INDEX CONCURRENTLY 语句，并说明对写入和存储的影响；优先利用已有索引\n")
+	b.WriteString("- 指出改写前后需要用 pg_explain 对比的指标")
+	if connID := request.Arguments["conn_id"]; connID != "" {
+		fmt.Fprintf(&b, " (conn_id: %s)", connID)
+	}
+	b.WriteString("\n\n")
+	l.writeTables(&b, tables, nil)
+	fmt.Fprintf(&b, "## 查询\n```sql\n%s\n```\n", query)
+	if plan := strings.TrimSpace(request.Arguments["plan"]); plan != "" {
+		fmt.Fprintf(&b, "\n## 当前执行计划\n```\n%s\n```\n", plan)
+	}
+
+	utils.DefaultLogger.Info("组装 optimize_query 提示", zap.Int("tables", len(tables)))
+	return newPromptResult(OptimizeQueryPrompt.Description, b.String()), nil
+}
+
+func newPromptResult(description, text string) *protocol.GetPromptResult {
+	return protocol.NewGetPromptResult([]protocol.PromptMessage{{
+		Role:    protocol.RoleUser,
+		Content: protocol.TextContent{Type: "text", Text: text},
+	}}, description)
+}
+
+func (l *Library) databaseInfo() (*schemas.DatabaseInfo, error) {
+	dbInfo, found := l.schemaManager.GetDatabaseInfo()
+	if !found || dbInfo == nil {
+		return nil, fmt.Errorf("Schema 信息尚未加载")
+	}
+	return dbInfo, nil
+}
+
+// rankedTables 按相关度返回与问题最相关的表
+func (l *Library) rankedTables(ctx context.Context, dbInfo *schemas.DatabaseInfo, question string) []promptTable {
+	ranking, err := l.ranker.Rank(ctx, question, retrieval.RankOptions{TopK: rankedTables})
+	if err != nil {
+		utils.DefaultLogger.Warn("按相关度检索表失败，提示中不附带表定义", zap.Error(err))
+		return nil
+	}
+	names := make([]string, len(ranking))
+	for i, score := range ranking {
+		names[i] = score.Schema + "." + score.Table
+	}
+	tables, _ := resolveTables(dbInfo, names)
+	return tables
+}
+
+// writeTables 写入表定义，超出 token 预算后只列出表名
+func (l *Library) writeTables(b *strings.Builder, tables []promptTable, missing []string) {
+	if len(tables) == 0 {
+		b.WriteString("## 表结构\n未识别到相关的表，请先调用 search_schema 或 relevant_schema 工具查找。\n\n")
+		return
+	}
+	b.WriteString("## 表结构\n")
+	used := 0
+	var omitted []string
+	for i, t := range tables {
+		if i >= maxPromptTables {
+			omitted = append(omitted, t.schema+"."+t.table.Name)
+			continue
+		}
+		text := renderTable(t.schema, t.table)
+		tokens := schemas.EstimateTokens(text)
+		if used > 0 && used+tokens > l.tokenBudget {
+			omitted = append(omitted, t.schema+"."+t.table.Name)
+			continue
+		}
+		used += tokens
+		b.WriteString(text)
+	}
+	if len(omitted) > 0 {
+		fmt.Fprintf(b, "以下表因篇幅省略，可通过 pgmcp://{conn_id}/schemas/{schema}/tables/{table}/columns 资源读取: %s\n", strings.Join(omitted, ", "))
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(b, "未在 Schema 缓存中找到: %s\n", strings.Join(missing, ", "))
+	}
+	if len(omitted)+len(missing) > 0 {
+		b.WriteString("\n")
+	}
+}
+
+// renderTable 以紧凑的文本形式描述一张表: 列 (类型、可空、约束、注释)、索引和外键
+func renderTable(schemaName string, table *schemas.TableInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s.%s (约 %d 行)", schemaName, table.Name, table.RowCount)
+	if table.Description != "" {
+		b.WriteString(" — " + table.Description)
+	}
+	b.WriteString("\n列:\n")
+	for _, column := range table.Columns {
+		fmt.Fprintf(&b, "- %s %s", column.Name, column.Type)
+		if !column.IsNullable {
+			b.WriteString(" NOT NULL")
+		}
+		for _, constraint := range column.Constraints {
+			switch constraint {
+			case schemas.PrimaryKeyConstraint:
+				b.WriteString(" PK")
+			case schemas.UniqueConstraint:
+				b.WriteString(" UNIQUE")
+			}
+		}
+		if column.Masked != "" {
+			fmt.Fprintf(&b, " [脱敏: %s]", column.Masked)
+		}
+		if column.Geo != nil {
+			fmt.Fprintf(&b, " [%s %s SRID=%d]", column.Geo.Kind, column.Geo.GeometryType, column.Geo.SRID)
+		}
+		if column.Vector != nil && column.Vector.Dimensions > 0 {
+			fmt.Fprintf(&b, " [向量 %d 维]", column.Vector.Dimensions)
+		}
+		if column.Description != "" {
+			b.WriteString(" — " + column.Description)
+		}
+		b.WriteString("\n")
+	}
+	if len(table.Indexes) > 0 {
+		b.WriteString("索引:\n")
+		for _, index := range table.Indexes {
+			fmt.Fprintf(&b, "- %s %s (%s)", index.IndexName, index.IndexType, strings.Join(index.Columns, ", "))
+			if index.IsPrimary {
+				b.WriteString(" PRIMARY")
+			} else if index.IsUnique {
+				b.WriteString(" UNIQUE")
+			}
+			b.WriteString("\n")
+		}
+	}
+	if len(table.ForeignKeys) > 0 {
+		b.WriteString("外键:\n")
+		for _, fk := range table.ForeignKeys {
+			fmt.Fprintf(&b, "- (%s) -> %s.%s (%s)\n", strings.Join(fk.Columns, ", "), fk.ReferencedSchema, fk.ReferencedTable, strings.Join(fk.ReferencedColumns, ", "))
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// writeKnowledge 写入相关的扩展知识: 表中有空间、向量或 hstore 列的扩展，以及按问题检索到的扩展。
+// 示例查询不放在知识中，而是按与问题的相关度挑选后单独写入，且只写入数据库中已安装的扩展的示例。
+func (l *Library) writeKnowledge(ctx context.Context, b *strings.Builder, dbInfo *schemas.DatabaseInfo, tables []promptTable, question string) {
+	if l.extManager == nil {
+		return
+	}
+	names := make(map[string]bool)
+	for _, t := range tables {
+		for _, column := range t.table.Columns {
+			if column.Geo != nil || column.Raster != nil {
+				names["postgis"] = true
+			}
+			if column.Vector != nil {
+				names["pgvector"] = true
+			}
+			if strings.HasSuffix(column.Type, "hstore") {
+				names["hstore"] = true
+			}
+		}
+	}
+	if l.ranker != nil {
+		matches, err := l.ranker.Knowledge(ctx, question, relevantKnowledge)
+		if err != nil {
+			utils.DefaultLogger.Debug("检索相关扩展知识失败", zap.Error(err))
+		}
+		for _, match := range matches {
+			if match.Score >= minKnowledgeScore {
+				names[match.ID] = true
+			}
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	var examples strings.Builder
+	for _, name := range sorted {
+		knowledge, found := l.extManager.GetExtensionKnowledge(name)
+		if !found {
+			continue
+		}
+		if extensionInstalled(dbInfo, knowledge.ExtensionName(name)) {
+			writeExamples(&examples, name, knowledge.Examples, question)
+		}
+		knowledge.Examples = nil
+		data, err := yaml.Marshal(knowledge)
+		if err != nil {
+			continue
+		}
+		text := string(data)
+		if len(text) > maxKnowledgeChars {
+			text = strings.ToValidUTF8(text[:maxKnowledgeChars], "") + "\n... (完整内容见 pgmcp://{conn_id}/schemas/{schema}/extensions/" + name + " 资源)"
+		}
+		fmt.Fprintf(b, "## 扩展知识: %s\n```yaml\n%s\n```\n\n", name, strings.TrimRight(text, "\n"))
+	}
+	b.WriteString(examples.String())
+}
+
+// extensionInstalled 判断扩展是否已安装；缓存中没有特性摘要时无法判断，视为已安装
+func extensionInstalled(dbInfo *schemas.DatabaseInfo, extension string) bool {
+	if dbInfo.Features == nil || dbInfo.Features.Extensions == nil {
+		return true
+	}
+	_, ok := dbInfo.Features.Extensions[extension]
+	return ok
+}
+
+// writeExamples 写入与问题最相关的几个示例查询 (名称、说明和 SQL 中与问题相同的词越多越相关，相同时保持文件中的顺序)
+func writeExamples(b *strings.Builder, name string, examples []extensions.QueryExample, question string) {
+	if len(examples) == 0 {
+		return
+	}
+	words := make(map[string]bool)
+	for _, word := range tokenize(strings.ToLower(question)) {
+		words[word] = true
+	}
+	scores := make([]int, len(examples))
+	for i, example := range examples {
+		for _, word := range tokenize(strings.ToLower(example.Name + " " + example.Description + " " + example.Query)) {
+			if words[word] {
+				scores[i]++
+			}
+		}
+	}
+	order := make([]int, len(examples))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	if len(order) > maxPromptExamples {
+		order = order[:maxPromptExamples]
+	}
+
+	fmt.Fprintf(b, "## 示例查询: %s\n", name)
+	for _, i := range order {
+		example := examples[i]
+		fmt.Fprintf(b, "### %s\n", example.Name)
+		if example.Description != "" {
+			fmt.Fprintf(b, "%s\n", example.Description)
+		}
+		fmt.Fprintf(b, "```sql\n%s\n```\n", strings.TrimSpace(example.Query))
+		if result := example.Result; result != nil {
+			columns := make([]string, 0, len(result.Columns))
+			for _, column := range result.Columns {
+				text := column.Name
+				if column.Type != "" {
+					text += " " + column.Type
+				}
+				if column.Description != "" {
+					text += " (" + column.Description + ")"
+				}
+				columns = append(columns, text)
+			}
+			if len(columns) > 0 {
+				fmt.Fprintf(b, "结果列: %s\n", strings.Join(columns, ", "))
+			}
+			if result.Rows != "" {
+				fmt.Fprintf(b, "结果行: %s\n", result.Rows)
+			}
+		}
+		b.WriteString("\n")
+	}
+}
+
+// resolveTables 在缓存中查找 schema.table 或 table 形式的表名，返回找到的表和未找到的名称
+func resolveTables(dbInfo *schemas.DatabaseInfo, names []string) ([]promptTable, []string) {
+	var tables []promptTable
+	var missing []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		schemaName, tableName, qualified := strings.Cut(name, ".")
+		if !qualified {
+			schemaName, tableName = "", name
+		}
+		found := false
+		for i := range dbInfo.Schemas {
+			schema := &dbInfo.Schemas[i]
+			if schemaName != "" && schema.Name != schemaName {
+				continue
+			}
+			for j := range schema.Tables {
+				if schema.Tables[j].Name != tableName {
+					continue
+				}
+				found = true
+				if id := schema.Name + "." + tableName; !seen[id] {
+					seen[id] = true
+					tables = append(tables, promptTable{schema: schema.Name, table: &schema.Tables[j]})
+				}
+			}
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+	return tables, missing
+}
+
+// mentionedTables 返回名称 (或 schema.table) 出现在单词列表中的表，按在缓存中的顺序
+func mentionedTables(dbInfo *schemas.DatabaseInfo, words []string) []promptTable {
+	mentioned := make(map[string]bool, len(words))
+	for _, word := range words {
+		mentioned[strings.ToLower(word)] = true
+	}
+	var tables []promptTable
+	for i := range dbInfo.Schemas {
+		schema := &dbInfo.Schemas[i]
+		for j := range schema.Tables {
+			name := strings.ToLower(schema.Tables[j].Name)
+			if mentioned[name] || mentioned[strings.ToLower(schema.Name)+"."+name] {
+				tables = append(tables, promptTable{schema: schema.Name, table: &schema.Tables[j]})
+			}
+		}
+	}
+	return tables
+}
+
+// referencedTables 返回查询文本引用的表 (按词法识别，与访问策略检查一致)
+func referencedTables(dbInfo *schemas.DatabaseInfo, query string) []promptTable {
+	var words []string
+	for _, chain := range sqlguard.IdentifierChains(query) {
+		for i, part := range chain {
+			words = append(words, part)
+			if i+1 < len(chain) {
+				words = append(words, part+"."+chain[i+1])
+			}
+		}
+	}
+	return mentionedTables(dbInfo, words)
+}
+
+// tokenize 按标识符以外的字符切分问题文本 (保留 schema.table 中的点，去掉句末的点)
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !(r == '_' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	})
+	words := fields[:0]
+	for _, field := range fields {
+		if word := strings.Trim(field, "."); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
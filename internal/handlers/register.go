@@ -5,16 +5,40 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url" // 引入 url 包
+	"path/filepath"
 	"strconv"
 	"strings" // 引入 strings 包
+	"sync"
 	"time"
 
 	"github.com/ThinkInAIXYZ/go-mcp/protocol"
 	"github.com/ThinkInAIXYZ/go-mcp/server"
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/core/credentials"
 	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
 	"github.com/cbc3929/pg_mcp_server/internal/core/extensions"
+	"github.com/cbc3929/pg_mcp_server/internal/core/idempotency"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/namedqueries"
+	"github.com/cbc3929/pg_mcp_server/internal/core/notifications"
+	"github.com/cbc3929/pg_mcp_server/internal/core/plans"
+	"github.com/cbc3929/pg_mcp_server/internal/core/querylib"
+	"github.com/cbc3929/pg_mcp_server/internal/core/requests"
+	"github.com/cbc3929/pg_mcp_server/internal/core/results"
+	"github.com/cbc3929/pg_mcp_server/internal/core/retrieval"
 	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sessions"
+	"github.com/cbc3929/pg_mcp_server/internal/core/shards"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+	"github.com/cbc3929/pg_mcp_server/internal/core/toolpacks"
+	"github.com/cbc3929/pg_mcp_server/internal/corpus"
+	"github.com/cbc3929/pg_mcp_server/internal/handlers/prompts"
+	"github.com/cbc3929/pg_mcp_server/internal/handlers/resources"
+	"github.com/cbc3929/pg_mcp_server/internal/handlers/tools"
 	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"github.com/cbc3929/pg_mcp_server/pkg/plugin"
+	"github.com/jackc/pgx/v5/pgconn"
 
 	// 不再需要 uritemplate 库
 	"go.uber.org/zap"
@@ -22,55 +46,361 @@ import (
 
 // --- 定义 Tool 输入参数的结构体 (保持不变) ---
 type ConnectToolArgs struct {
-	ConnectionString string `json:"connection_string"`
+	ConnectionString string   `json:"connection_string,omitempty" description:"PostgreSQL 连接字符串 (服务端关闭 ALLOW_RAW_CONNECTION_STRINGS 时不可用，请改用 database)"`
+	Database         string   `json:"database,omitempty" description:"服务端配置的命名凭据名称 (例如 analytics)，密码不会经过客户端；与 connection_string 和结构化参数三选一"`
+	Host             string   `json:"host,omitempty" description:"(可选) 结构化连接参数: 数据库主机名或 IP 地址，由服务端组装连接字符串，代替 connection_string"`
+	Port             int      `json:"port,omitempty" description:"(可选) 结构化连接参数: 数据库端口，默认 5432"`
+	DBName           string   `json:"dbname,omitempty" description:"(可选) 结构化连接参数: 数据库名，默认与用户名相同"`
+	User             string   `json:"user,omitempty" description:"(可选) 结构化连接参数: 登录用户名"`
+	Password         string   `json:"password,omitempty" description:"(可选) 结构化连接参数: 密码；服务端关闭 ALLOW_RAW_CONNECTION_STRINGS 时结构化参数必须配合 credential_ref 使用"`
+	CredentialRef    string   `json:"credential_ref,omitempty" description:"(可选) 结构化连接参数: 使用该命名凭据的密码 (以及未指定时的主机、端口、用户和数据库)，只能连接凭据中的主机；与 password 二选一"`
+	SSLMode          string   `json:"sslmode,omitempty" description:"(可选) TLS 模式: disable, allow, prefer, require, verify-ca 或 verify-full (托管数据库建议 verify-full)，覆盖连接字符串和凭据中的设置；未指定时使用 DB_SSLMODE"`
+	SSLRootCert      string   `json:"sslrootcert,omitempty" description:"(可选) 校验服务器证书的 CA 证书文件 (服务端路径，必须位于 DB_TLS_CERT_DIR 下，可以使用相对路径)"`
+	SSLCert          string   `json:"sslcert,omitempty" description:"(可选) 客户端证书文件 (必须位于 DB_TLS_CERT_DIR 下)，与 sslkey 一起使用"`
+	SSLKey           string   `json:"sslkey,omitempty" description:"(可选) 客户端私钥文件 (必须位于 DB_TLS_CERT_DIR 下)，与 sslcert 一起使用"`
+	Options          []string `json:"options,omitempty" description:"(可选) 结构化连接参数: 其他连接参数，key=value 形式，例如 application_name=report、connect_timeout=5、search_path=app"`
+	AccessMode       string   `json:"access_mode,omitempty" description:"(可选) read_only (默认) 或 read_write，read_write 需要服务端开启 ALLOW_READ_WRITE_CONNECTIONS"`
+	AllowSchemas     []string `json:"allow_schemas,omitempty" description:"(可选) 只允许访问这些 Schema (在服务端全局策略之上追加)"`
+	DenySchemas      []string `json:"deny_schemas,omitempty" description:"(可选) 禁止访问的 Schema"`
+	AllowTables      []string `json:"allow_tables,omitempty" description:"(可选) 只允许访问这些表 (schema.table，支持 * 通配符)"`
+	DenyTables       []string `json:"deny_tables,omitempty" description:"(可选) 禁止访问的表 (schema.table，支持 * 通配符)"`
+	SSHHost          string   `json:"ssh_host,omitempty" description:"(可选) 经 SSH 跳板机访问数据库时的跳板机地址，只能与 connection_string 一起使用"`
+	SSHPort          int      `json:"ssh_port,omitempty" description:"(可选) 跳板机 SSH 端口，默认 22"`
+	SSHUser          string   `json:"ssh_user,omitempty" description:"(可选) 跳板机 SSH 用户名"`
+	SSHKeyPath       string   `json:"ssh_key_path,omitempty" description:"(可选) 服务端 SSH_KEY_DIR 下的私钥文件，为空时使用服务端的 ssh-agent"`
+	Replicas         []string `json:"replicas,omitempty" description:"(可选) 只读副本 (host 或 host:port，用户和密码与主库相同)，只读查询轮询路由到健康的副本，副本不可用时由主库执行；使用命名凭据 (database / credential_ref) 时不可用，副本在凭据文件中配置"`
 }
+
+// sshTunnelFromArgs 由 connect 的 ssh_* 参数组装 SSH 隧道配置，未指定 ssh_host 时返回 nil。
+// 客户端指定的私钥文件必须位于 SSH_KEY_DIR 下，防止读取服务端的任意文件。
+func sshTunnelFromArgs(cfg *config.Config, args *ConnectToolArgs) (*databases.SSHTunnelConfig, error) {
+	if args.SSHHost == "" {
+		if args.SSHUser != "" || args.SSHKeyPath != "" || args.SSHPort != 0 {
+			return nil, fmt.Errorf("使用 SSH 隧道时必须指定 'ssh_host'")
+		}
+		return nil, nil
+	}
+	tunnel := &databases.SSHTunnelConfig{Host: args.SSHHost, Port: args.SSHPort, User: args.SSHUser}
+	if args.SSHKeyPath != "" {
+		keyPath, err := pathUnderDir(cfg.SSHKeyDir, "SSH_KEY_DIR", "ssh_key_path", args.SSHKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		tunnel.KeyPath = keyPath
+	}
+	return tunnel, nil
+}
+
+// tlsFromArgs 根据 connect 的 sslmode / sslrootcert / sslcert / sslkey 参数构造连接级别的 TLS 设置，
+// 证书文件必须位于 DB_TLS_CERT_DIR 下；未指定任何 TLS 参数时返回 nil
+func tlsFromArgs(cfg *config.Config, args *ConnectToolArgs) (*databases.TLSOptions, error) {
+	if args.SSLMode == "" && args.SSLRootCert == "" && args.SSLCert == "" && args.SSLKey == "" {
+		return nil, nil
+	}
+	tlsOptions := &databases.TLSOptions{SSLMode: args.SSLMode}
+	for _, file := range []struct {
+		arg, value string
+		target     *string
+	}{
+		{"sslrootcert", args.SSLRootCert, &tlsOptions.RootCert},
+		{"sslcert", args.SSLCert, &tlsOptions.Cert},
+		{"sslkey", args.SSLKey, &tlsOptions.Key},
+	} {
+		if file.value == "" {
+			continue
+		}
+		resolved, err := pathUnderDir(cfg.DBTLSCertDir, "DB_TLS_CERT_DIR", file.arg, file.value)
+		if err != nil {
+			return nil, err
+		}
+		*file.target = resolved
+	}
+	return tlsOptions, tlsOptions.Validate()
+}
+
+// pathUnderDir 把 connect 传入的服务端文件路径 (绝对路径或相对 dir 的路径) 解析为绝对路径，
+// 并检查它位于配置项 envName 指定的目录 dir 下
+func pathUnderDir(dir, envName, argName, filePath string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("服务端未配置 %s，不允许指定 '%s'", envName, argName)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("解析 %s 失败: %w", envName, err)
+	}
+	if !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(absDir, filePath)
+	}
+	filePath = filepath.Clean(filePath)
+	if rel, err := filepath.Rel(absDir, filePath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("'%s' 必须位于 %s 下", argName, envName)
+	}
+	return filePath, nil
+}
+
+// hasConnParams 判断 connect 是否使用了结构化连接参数
+func (args *ConnectToolArgs) hasConnParams() bool {
+	return args.Host != "" || args.Port != 0 || args.DBName != "" || args.User != "" || args.Password != "" ||
+		args.CredentialRef != "" || len(args.Options) > 0
+}
+
+// connectionFromParams 由 connect 的结构化参数在服务端组装连接字符串。
+// 指定 credential_ref 时返回使用凭据密码的凭据副本 (其 ConnectionString 为组装后的连接字符串)：
+// 主机和端口必须与凭据一致，防止把凭据的密码发送到客户端指定的其他主机；未指定的字段沿用凭据中的值
+// (凭据连接字符串中 TLS 参数以外的其他参数不沿用，需要时通过 options 指定)。
+func connectionFromParams(ctx context.Context, resolver *credentials.Resolver, args *ConnectToolArgs) (string, *credentials.Credential, error) {
+	params := databases.ConnParams{
+		Host: args.Host, Port: args.Port, DBName: args.DBName, User: args.User,
+		Password: args.Password, Options: args.Options,
+	}
+	if args.CredentialRef == "" {
+		connString, err := params.ConnString()
+		return connString, nil, err
+	}
+	if args.Password != "" {
+		return "", nil, fmt.Errorf("'password' 和 'credential_ref' 只能指定一个")
+	}
+
+	credential, err := resolver.Resolve(ctx, args.CredentialRef)
+	if err != nil {
+		return "", nil, err
+	}
+	base, err := pgconn.ParseConfig(credential.ConnectionString)
+	if err != nil {
+		return "", nil, fmt.Errorf("凭据 '%s' 的连接字符串格式无效: %w", args.CredentialRef, err)
+	}
+	if params.Host == "" {
+		params.Host = base.Host
+	} else if !strings.EqualFold(params.Host, base.Host) {
+		return "", nil, fmt.Errorf("凭据 '%s' 只能用于主机 '%s'", args.CredentialRef, base.Host)
+	}
+	if params.Port == 0 {
+		params.Port = int(base.Port)
+	} else if params.Port != int(base.Port) {
+		return "", nil, fmt.Errorf("凭据 '%s' 只能用于端口 %d", args.CredentialRef, base.Port)
+	}
+	if params.User == "" {
+		params.User = base.User
+	}
+	if params.DBName == "" {
+		params.DBName = base.Database
+	}
+	connString := func() (string, error) {
+		built, err := params.ConnString()
+		if err != nil {
+			return "", err
+		}
+		// 沿用凭据中的 TLS 设置 (connect 的 TLS 参数在创建连接池时覆盖)
+		inherited := databases.TLSOptions{
+			SSLMode:  databases.ConnStringParam(credential.ConnectionString, "sslmode"),
+			RootCert: databases.ConnStringParam(credential.ConnectionString, "sslrootcert"),
+			Cert:     databases.ConnStringParam(credential.ConnectionString, "sslcert"),
+			Key:      databases.ConnStringParam(credential.ConnectionString, "sslkey"),
+		}
+		return databases.ApplyTLS(built, &inherited, databases.TLSOptions{})
+	}
+
+	resolved := *credential
+	if credential.Secret != nil {
+		// 凭据来自提供者时，轮换检查把新的用户名和密码注入组装后的 (不含密码的) 连接字符串
+		withoutPassword, err := connString()
+		if err != nil {
+			return "", nil, err
+		}
+		secret := *credential.Secret
+		secret.BaseURL = withoutPassword
+		resolved.Secret = &secret
+	}
+	params.Password = base.Password
+	if resolved.ConnectionString, err = connString(); err != nil {
+		return "", nil, err
+	}
+	return resolved.ConnectionString, &resolved, nil
+}
+
+// responseBudget 返回 pg_query 的字节预算: 客户端指定的预算 (token 按 BytesPerToken 换算) 中的较小者，
+// 不能超过服务器配置的 RESPONSE_MAX_BYTES；都未指定时返回 0 (不限制)
+func responseBudget(serverMax, maxBytes, maxTokens int) int {
+	budget := serverMax
+	for _, requested := range []int{maxBytes, maxTokens * results.BytesPerToken} {
+		if requested > 0 && (budget <= 0 || requested < budget) {
+			budget = requested
+		}
+	}
+	return budget
+}
+
+// knowledgeForExtension 返回 PostgreSQL 扩展对应的扩展知识 (知识名称可能与扩展名不同，例如 pgvector 知识对应 vector 扩展)
+func knowledgeForExtension(extManager extensions.Manager, extName string) (extensions.KnowledgeData, bool) {
+	if knowledge, ok := extManager.GetExtensionKnowledge(extName); ok && knowledge.ExtensionName(extName) == extName {
+		return knowledge, true
+	}
+	for name, knowledge := range extManager.AllKnowledge() {
+		if knowledge.ExtensionName(name) == extName {
+			return knowledge, true
+		}
+	}
+	return extensions.KnowledgeData{}, false
+}
+
 type DisconnectToolArgs struct {
 	ConnID string `json:"conn_id"`
 }
 type PgQueryToolArgs struct {
-	ConnID string `json:"conn_id"`
-	Query  string `json:"query"`
-	Params []any  `json:"params,omitempty"`
+	ConnID              string         `json:"conn_id"`
+	Query               string         `json:"query"`
+	Params              []any          `json:"params,omitempty"`
+	NamedParams         map[string]any `json:"named_params,omitempty"`          // :name 形式的命名参数
+	Format              string         `json:"format,omitempty"`                // 结果格式: json (默认), csv, tsv, markdown
+	IncludeLargeColumns bool           `json:"include_large_columns,omitempty"` // 开启 SELECT_STAR_REWRITE 时保留 SELECT * 中的大字段列
+	NoCache             bool           `json:"no_cache,omitempty"`              // 开启 RESULT_CACHE_TTL 时跳过结果缓存
+	MaxResponseBytes    int            `json:"max_response_bytes,omitempty"`    // 编码后结果的字节预算
+	MaxResponseTokens   int            `json:"max_response_tokens,omitempty"`   // 按 token 估算的预算 (约 4 字节/token)
+}
+type PgExplainToolArgs struct {
+	PgQueryToolArgs
+	Compact bool `json:"compact,omitempty"` // 精简计划，去掉很少有用的字段和透传节点
 }
 
 // --- 注册函数 ---
 
 // RegisterHandlers 将所有定义的 MCP Tool 和 Resource 处理器注册到服务器。
 // 使用基本的手动 URI 解析。
-func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, schemaManager schemas.Manager, extManager extensions.Manager) error {
+func RegisterHandlers(mcpServer *server.Server, cfg *config.Config, dbService databases.Service, schemaManager schemas.Manager, extManager extensions.Manager, sessionTracker *sessions.Tracker, requestTracker *requests.Tracker, reviewQueue *tools.ReviewQueue, extraPlugins ...plugin.Plugin) error {
 	utils.DefaultLogger.Info("开始注册 MCP Handlers (使用手动 URI 解析)...")
 
+	maskingRules, err := masking.ParseRules(cfg.MaskedColumns)
+	if err != nil {
+		return fmt.Errorf("解析 MASKED_COLUMNS 失败: %w", err)
+	}
+	masker := masking.NewMasker(dbService, maskingRules)
+	toolRegistry := newToolRegistry(mcpServer)
+	// LISTEN 专用连接随服务器的根 Context 关闭
+	notificationHub := notifications.NewHub(requestTracker.Root(), dbService, cfg.ListenMaxChannels, cfg.ListenBufferSize)
+	if masker.Enabled() {
+		utils.DefaultLogger.Info("列脱敏已启用", zap.Int("rules", len(maskingRules)))
+	}
+
 	// --- 注册 Tools (这部分逻辑不变) ---
-	connectTool, err := protocol.NewTool("connect", "注册数据库连接字符串并返回连接 ID", ConnectToolArgs{})
+	credentialResolver := credentials.NewResolver(cfg, databases.NewCredentialProviders(cfg))
+	connectTool, err := protocol.NewTool("connect", "通过服务端配置的命名凭据 (database)、连接字符串或结构化连接参数 (host, port, dbname, user, password/credential_ref, options) 注册数据库连接，可以通过 sslmode/sslrootcert/sslcert/sslkey 要求 TLS 校验 (例如 verify-full)，返回连接 ID", ConnectToolArgs{})
 	if err != nil {
 		return fmt.Errorf("创建 'connect' 工具定义失败: %w", err)
 	}
-	mcpServer.RegisterTool(connectTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	toolRegistry.RegisterTool(connectTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 15*time.Second)
 		defer cancel()
 		args := new(ConnectToolArgs)
 		if err := protocol.VerifyAndUnmarshal(request.RawArguments, args); err != nil {
 			return nil, fmt.Errorf("参数解析错误: %w", err)
 		}
-		if args.ConnectionString == "" {
-			return nil, fmt.Errorf("缺少 'connection_string' 参数")
+		connString := args.ConnectionString
+		var secret *databases.SecretSource
+		var credential *credentials.Credential
+		tunnel, err := sshTunnelFromArgs(cfg, args)
+		if err != nil {
+			return nil, err
+		}
+		tlsOptions, err := tlsFromArgs(cfg, args)
+		if err != nil {
+			return nil, err
+		}
+		modes := 0
+		for _, used := range []bool{args.Database != "", args.ConnectionString != "", args.hasConnParams()} {
+			if used {
+				modes++
+			}
+		}
+		if modes > 1 {
+			return nil, fmt.Errorf("'database'、'connection_string' 和结构化连接参数 (host, dbname, user...) 只能使用一种")
+		}
+		switch {
+		case args.Database != "":
+			if credential, err = credentialResolver.Resolve(ctx, args.Database); err != nil {
+				return nil, err
+			}
+		case args.ConnectionString != "":
+			if !cfg.AllowRawConnectionStrings {
+				return nil, fmt.Errorf("服务端已禁止直接传入连接字符串 (ALLOW_RAW_CONNECTION_STRINGS=false)，请使用 'database' 参数引用命名凭据")
+			}
+			if err := databases.CheckRawConnString(connString); err != nil {
+				return nil, err
+			}
+			hosts, err := databases.ConnStringHosts(connString)
+			if err != nil {
+				return nil, err
+			}
+			if err := databases.CheckHostPolicy(ctx, cfg, hosts...); err != nil {
+				return nil, err
+			}
+		case args.hasConnParams():
+			if args.CredentialRef == "" && !cfg.AllowRawConnectionStrings {
+				return nil, fmt.Errorf("服务端已禁止客户端指定连接目标 (ALLOW_RAW_CONNECTION_STRINGS=false)，请使用 'credential_ref' 或 'database' 引用命名凭据")
+			}
+			if connString, credential, err = connectionFromParams(ctx, credentialResolver, args); err != nil {
+				return nil, err
+			}
+			if credential == nil {
+				if err := databases.CheckHostPolicy(ctx, cfg, args.Host); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, fmt.Errorf("缺少 'database'、'connection_string' 或结构化连接参数 (host, user...)")
+		}
+		// 客户端指定的跳板机同样受主机策略限制 (命名凭据不能通过 ssh_host 指定隧道，见下方)
+		if credential == nil && tunnel != nil {
+			if err := databases.CheckHostPolicy(ctx, cfg, tunnel.Host); err != nil {
+				return nil, err
+			}
+		}
+		if credential != nil {
+			if credential.AccessMode == databases.AccessModeReadOnly && args.AccessMode == databases.AccessModeReadWrite {
+				return nil, fmt.Errorf("凭据 '%s' 只允许只读连接", credential.Name)
+			}
+			if args.AccessMode == "" && credential.AccessMode != "" {
+				args.AccessMode = credential.AccessMode
+			}
+			if tunnel != nil {
+				return nil, fmt.Errorf("命名凭据的 SSH 隧道需要在凭据文件中配置，不能通过 'ssh_host' 指定")
+			}
+			// 副本连接池使用凭据的密码，副本只能来自凭据文件，避免把密码发送到客户端指定的主机
+			if len(args.Replicas) > 0 {
+				return nil, fmt.Errorf("命名凭据的只读副本需要在凭据文件中配置，不能通过 'replicas' 指定")
+			}
+			connString, secret, tunnel = credential.ConnectionString, credential.Secret, credential.Tunnel
+			args.Replicas = credential.Replicas
+			utils.DefaultLogger.Info("使用命名凭据注册连接", zap.String("database", credential.Name), zap.String("source", credential.Source))
 		}
-		connID, err := dbService.RegisterConnection(ctx, args.ConnectionString)
+		connID, err := dbService.RegisterConnection(ctx, connString, databases.ConnectionOptions{
+			AccessMode: args.AccessMode,
+			Secret:     secret,
+			Tunnel:     tunnel,
+			Replicas:   args.Replicas,
+			TLS:        tlsOptions,
+			Policy: sqlguard.Policy{
+				AllowSchemas: args.AllowSchemas,
+				DenySchemas:  args.DenySchemas,
+				AllowTables:  args.AllowTables,
+				DenyTables:   args.DenyTables,
+			},
+		})
 		if err != nil {
 			return &protocol.CallToolResult{Content: []protocol.Content{protocol.TextContent{Type: "text/plain", Text: fmt.Sprintf(`{"error": "注册连接失败: %v"}`, err)}}, IsError: true}, nil
 		}
-		resultData := map[string]string{"conn_id": connID}
+		accessMode, _ := dbService.AccessMode(connID)
+		resultData := map[string]string{"conn_id": connID, "access_mode": accessMode, "status_uri": fmt.Sprintf("pgmcp://%s/status", connID)}
 		resultBytes, _ := json.Marshal(resultData)
 		return &protocol.CallToolResult{Content: []protocol.Content{protocol.TextContent{Type: "application/json", Text: string(resultBytes)}}}, nil
 	})
-	utils.DefaultLogger.Info("Tool 'connect' 已注册")
+	utils.DefaultLogger.Info("Tool 'connect' 已注册", zap.Bool("allowReadWrite", cfg.AllowReadWriteConnections), zap.Bool("allowRawConnectionStrings", cfg.AllowRawConnectionStrings))
 
 	disconnectTool, err := protocol.NewTool("disconnect", "关闭指定的数据库连接", DisconnectToolArgs{})
 	if err != nil {
 		return fmt.Errorf("创建 'disconnect' 工具定义失败: %w", err)
 	}
-	mcpServer.RegisterTool(disconnectTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	toolRegistry.RegisterTool(disconnectTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 10*time.Second)
 		defer cancel()
 		args := new(DisconnectToolArgs)
 		if err := protocol.VerifyAndUnmarshal(request.RawArguments, args); err != nil {
@@ -83,15 +413,64 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 		if err != nil {
 			return &protocol.CallToolResult{Content: []protocol.Content{protocol.TextContent{Type: "text/plain", Text: fmt.Sprintf(`{"success": false, "error": "断开连接失败: %v"}`, err)}}, IsError: true}, nil
 		}
+		notificationHub.UnlistenAll(args.ConnID)
 		resultData := map[string]bool{"success": true}
 		resultBytes, _ := json.Marshal(resultData)
 		return &protocol.CallToolResult{Content: []protocol.Content{protocol.TextContent{Type: "application/json", Text: string(resultBytes)}}}, nil
 	})
 	utils.DefaultLogger.Info("Tool 'disconnect' 已注册")
 
+	listConnectionsHandler := tools.NewListConnectionsHandler(dbService, schemaManager)
+	listConnectionsTool, err := protocol.NewTool("list_connections", "列出所有已注册的 connID: 主机/数据库/用户 (不含密码)、访问模式、连接池状态、最近使用时间和 Schema 缓存新鲜度，可选 Ping 检查连接池健康；注册新连接前先用它查找可复用的连接", tools.ListConnectionsToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'list_connections' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(listConnectionsTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 10*time.Second)
+		defer cancel()
+		return listConnectionsHandler.HandleListConnections(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'list_connections' 已注册")
+
+	refreshSchemaHandler := tools.NewRefreshSchemaHandler(schemaManager)
+	refreshSchemaTool, err := protocol.NewTool("refresh_schema", "重新加载 Schema 缓存 (执行 DDL 后使用)，使摘要、搜索和 Schema 资源反映最新结构；incremental 为 true 时只重新加载变化的对象；订阅了 Schema 资源的客户端会收到更新通知", tools.RefreshSchemaToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'refresh_schema' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(refreshSchemaTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 5*time.Minute)
+		defer cancel()
+		return refreshSchemaHandler.HandleRefreshSchema(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'refresh_schema' 已注册")
+
+	reloadExtensionsHandler := tools.NewReloadExtensionsHandler(extManager)
+	reloadExtensionsTool, err := protocol.NewTool("reload_extensions", "重新加载扩展知识目录中的 YAML 文件 (修改扩展知识后使用，开启 EXTENSIONS_WATCH 时会自动重新加载)，返回新增、修改、删除和加载失败的扩展", tools.ReloadExtensionsToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'reload_extensions' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(reloadExtensionsTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return reloadExtensionsHandler.HandleReloadExtensions(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'reload_extensions' 已注册")
+
+	validateKnowledgeHandler := tools.NewValidateKnowledgeHandler(extManager)
+	validateKnowledgeTool, err := protocol.NewTool("validate_knowledge", "校验扩展知识 YAML (传入的文本或目录中的文件)，返回每个问题的行号、列号、字段路径和说明；未知字段、类型错误、缺少必填字段和无效的 plan_advice 规则都会报告", tools.ValidateKnowledgeToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'validate_knowledge' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(validateKnowledgeTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return validateKnowledgeHandler.HandleValidateKnowledge(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'validate_knowledge' 已注册")
+
 	pgQueryToolManual := &protocol.Tool{
 		Name:        "pg_query",
-		Description: "对指定的数据库连接执行一个只读的 SQL 查询",
+		Description: "对指定的数据库连接执行一个只读的 SQL 查询；结果之后的内容块包含执行信息 (duration_ms, rows_returned, bytes_serialized, truncated)",
 		InputSchema: protocol.InputSchema{
 			Type: protocol.Object, // 使用 Object 常量
 			Properties: map[string]*protocol.Property{
@@ -101,7 +480,7 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 				},
 				"query": {
 					Type:        protocol.String,
-					Description: "要执行的 SQL 查询语句 (应使用 $1, $2... 作为参数占位符)",
+					Description: "要执行的 SQL 查询语句 (使用 $1, $2... 位置参数或 :name 命名参数作为占位符)",
 				},
 				"params": {
 					Type:        protocol.Array, // 类型是数组
@@ -115,191 +494,1525 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 						Description: "数组中的单个参数 (Schema 定义为 string，但接受任意 JSON 类型)",
 					},
 				},
+				"named_params": {
+					Type:        protocol.ObjectT,
+					Description: "(可选) 命名参数对象，例如 {\"status\": \"active\"}，对应查询中的 :status 占位符；可与 params 混用，编号接在 params 之后",
+				},
+				"format": {
+					Type:        protocol.String,
+					Description: fmt.Sprintf("(可选) 结果格式: json (默认，对象数组), csv, tsv, markdown。宽结果集使用表格格式可显著减少 token；markdown 适合直接展示，超过 %d 字符的值会被截断", results.MarkdownMaxCellWidth),
+				},
+				"max_response_bytes": {
+					Type:        protocol.Integer,
+					Description: "(可选) 编码后结果的字节预算，超出时只返回能放进预算的前 N 行，执行信息中 truncated=true 并附带截断说明和全部行的逐列统计 (count/nulls/distinct/min/max)",
+				},
+				"max_response_tokens": {
+					Type:        protocol.Integer,
+					Description: "(可选) 按 token 指定预算 (约 4 字节/token)，与 max_response_bytes 同时指定时取较小者",
+				},
 			},
 			Required: []string{"conn_id", "query"},
 		},
 	}
-	mcpServer.RegisterTool(pgQueryToolManual, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	if cfg.SelectStarRewrite {
+		pgQueryToolManual.InputSchema.Properties["include_large_columns"] = &protocol.Property{
+			Type:        protocol.Boolean,
+			Description: "(可选) 单表 SELECT * 默认省略二进制、向量等大字段列 (执行信息中列出 omitted_columns)，设为 true 时返回全部列",
+		}
+	}
+	if cfg.CorpusEnabled {
+		// 开启训练语料记录时允许客户端附带 SQL 对应的自然语言问题
+		pgQueryToolManual.InputSchema.Properties[corpus.QuestionArg] = corpus.QuestionProperty
+	}
+	if cfg.ResultCacheTTL > 0 {
+		pgQueryToolManual.InputSchema.Properties["no_cache"] = &protocol.Property{
+			Type:        protocol.Boolean,
+			Description: fmt.Sprintf("(可选) 相同的只读查询在 %s 内返回缓存结果 (执行信息中 cache_hit=true)，设为 true 时总是重新执行", cfg.ResultCacheTTL),
+		}
+	}
+	toolRegistry.RegisterTool(pgQueryToolManual, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
 		defer cancel()
 		args := new(PgQueryToolArgs)
-		if err := protocol.VerifyAndUnmarshal(request.RawArguments, args); err != nil {
+		// 手动定义的 Tool 没有经过 NewTool 生成 Schema 缓存，不能使用 VerifyAndUnmarshal
+		if err := json.Unmarshal(request.RawArguments, args); err != nil {
 			return nil, fmt.Errorf("参数解析错误: %w", err)
 		}
 		if args.ConnID == "" || args.Query == "" {
 			return nil, fmt.Errorf("缺少 'conn_id' 或 'query' 参数")
 		}
-		results, err := dbService.ExecuteQuery(ctx, args.ConnID, true, args.Query, args.Params...)
+		format := strings.ToLower(args.Format)
+		if !results.IsSupportedFormat(format) {
+			return nil, fmt.Errorf("不支持的 'format': '%s' (可选 json, csv, tsv, markdown)", args.Format)
+		}
+		query, params, err := tools.BindNamedParams(args.Query, args.Params, args.NamedParams)
+		if err != nil {
+			return nil, fmt.Errorf("参数绑定错误: %w", err)
+		}
+		var omittedColumns []string
+		if cfg.SelectStarRewrite && !args.IncludeLargeColumns {
+			query, omittedColumns = tools.ExpandSelectStar(query, schemaManager, cfg.SelectStarExcludeTypes)
+		}
+		// 分页查询缺少 ORDER BY 时按配置给出警告或自动按主键排序
+		query, orderWarning := tools.EnsureDeterministicOrder(query, schemaManager, cfg.PaginationOrderMode)
+		if !args.NoCache {
+			ctx = databases.WithResultCache(ctx)
+		}
+		started := time.Now()
+		queryResult, err := dbService.QueryWithColumns(ctx, args.ConnID, true, query, params...)
+		elapsed := time.Since(started)
 		if err != nil {
 			return &protocol.CallToolResult{Content: []protocol.Content{protocol.TextContent{Type: "text/plain", Text: fmt.Sprintf(`{"error": "查询执行失败: %v"}`, err)}}, IsError: true}, nil
 		}
-		resultBytes, err := json.Marshal(results)
+		// 无法确定哪些列需要脱敏时不返回结果
+		if err := masker.MaskResult(ctx, args.ConnID, queryResult); err != nil {
+			return &protocol.CallToolResult{Content: []protocol.Content{protocol.TextContent{Type: "text/plain", Text: fmt.Sprintf(`{"error": "结果脱敏失败: %v"}`, err)}}, IsError: true}, nil
+		}
+		encoded, returnedRows, truncation, err := results.EncodeWithinBudget(format, queryResult.Columns, queryResult.Rows, responseBudget(cfg.ResponseMaxBytes, args.MaxResponseBytes, args.MaxResponseTokens))
 		if err != nil {
-			return nil, fmt.Errorf("序列化查询结果失败: %w", err)
+			return nil, err
 		}
-		return &protocol.CallToolResult{Content: []protocol.Content{protocol.TextContent{Type: "application/json", Text: string(resultBytes)}}}, nil
+		// 执行信息和警告放在单独的内容块中，不改变第一个内容块 (结果行) 的格式
+		execution := results.NewMetadata(elapsed, queryResult.Columns, returnedRows, encoded)
+		execution.Truncated = truncation != nil
+		details := map[string]any{"execution": execution}
+		if truncation != nil {
+			details["truncation"] = truncation
+			utils.DefaultLogger.Info("pg_query 结果超过响应预算，已截断", zap.String("connID", args.ConnID), zap.Int("rowsTotal", truncation.RowsTotal), zap.Int("rowsReturned", truncation.RowsReturned), zap.Int("budgetBytes", truncation.BudgetBytes))
+		}
+		if len(omittedColumns) > 0 {
+			details["omitted_columns"] = omittedColumns
+			details["executed_query"] = query
+		}
+		if orderWarning != "" {
+			details["warning"] = orderWarning
+			details["executed_query"] = query
+		}
+		if !queryResult.CachedAt.IsZero() {
+			details["cache_hit"] = true
+			details["cached_at"] = queryResult.CachedAt
+		}
+		detailBytes, _ := json.Marshal(details)
+		content := []protocol.Content{
+			protocol.TextContent{Type: results.MimeType(format), Text: encoded},
+			protocol.TextContent{Type: "application/json", Text: string(detailBytes)},
+		}
+		return &protocol.CallToolResult{Content: content}, nil
 	})
 	utils.DefaultLogger.Info("Tool 'pg_query' 已注册")
 
+	planStore := plans.NewStore(cfg.PlanStorePath, cfg.PlanRegressionCostRatio, cfg.QueryAlertWebhookURL)
 	pgExplainToolManual := &protocol.Tool{
 		Name:        "pg_explain",
-		Description: "获取指定 SQL 查询的 PostgreSQL 执行计划 (EXPLAIN FORMAT JSON)",
+		Description: "获取指定 SQL 查询的 PostgreSQL 执行计划 (EXPLAIN FORMAT JSON)；计划会被记录，形状或成本相比上次显著变化时在结果中附加 plan_regression；命中扩展知识中的计划规则 (大表顺序扫描、高循环次数的 Nested Loop、排序溢出等) 时附加 plan_advice",
 		InputSchema: protocol.InputSchema{
 			Type: protocol.Object,
 			Properties: map[string]*protocol.Property{
-				"conn_id": {Type: protocol.String, Description: "目标数据库的连接 ID"},
-				"query":   {Type: protocol.String, Description: "要分析的 SQL 查询语句"},
-				"params":  {Type: protocol.Array, Description: "(可选) 查询参数列表", Items: &protocol.Property{Type: protocol.String}}, // Items 定义为 String
+				"conn_id":      {Type: protocol.String, Description: "目标数据库的连接 ID"},
+				"query":        {Type: protocol.String, Description: "要分析的 SQL 查询语句"},
+				"params":       {Type: protocol.Array, Description: "(可选) 查询参数列表", Items: &protocol.Property{Type: protocol.String}}, // Items 定义为 String
+				"named_params": {Type: protocol.ObjectT, Description: "(可选) 命名参数对象，对应查询中的 :name 占位符"},
+				"compact":      {Type: protocol.Boolean, Description: "(可选) 为 true 时返回精简计划: 去掉输出列表、启动成本、并行标记等字段，折叠透传节点，大幅减少计划体积"},
 			},
 			Required: []string{"conn_id", "query"},
 		},
 	}
-	mcpServer.RegisterTool(pgExplainToolManual, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	toolRegistry.RegisterTool(pgExplainToolManual, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
 		defer cancel()
-		args := new(PgQueryToolArgs)
-		if err := protocol.VerifyAndUnmarshal(request.RawArguments, args); err != nil {
+		args := new(PgExplainToolArgs)
+		if err := json.Unmarshal(request.RawArguments, args); err != nil {
 			return nil, fmt.Errorf("参数解析错误: %w", err)
 		}
 		if args.ConnID == "" || args.Query == "" {
 			return nil, fmt.Errorf("缺少 'conn_id' 或 'query' 参数")
 		}
-		explainQuery := "EXPLAIN (FORMAT JSON) " + args.Query
-		results, err := dbService.ExecuteQuery(ctx, args.ConnID, true, explainQuery, args.Params...)
+		query, params, err := tools.BindNamedParams(args.Query, args.Params, args.NamedParams)
+		if err != nil {
+			return nil, fmt.Errorf("参数绑定错误: %w", err)
+		}
+		planJSON, err := tools.ExplainPlan(ctx, dbService, args.ConnID, query, params)
 		if err != nil {
 			return &protocol.CallToolResult{Content: []protocol.Content{protocol.TextContent{Type: "text/plain", Text: fmt.Sprintf(`{"error": "EXPLAIN 执行失败: %v"}`, err)}}, IsError: true}, nil
 		}
-		var explainPlanJSON string
-		if len(results) > 0 && results[0] != nil {
-			if planField, ok := results[0]["QUERY PLAN"]; ok {
-				planBytes, err := json.Marshal(planField)
-				if err != nil {
-					return nil, fmt.Errorf("序列化 Explain Plan 失败: %w", err)
-				}
-				explainPlanJSON = string(planBytes)
+		outputJSON := planJSON
+		if args.Compact {
+			// 只精简返回给客户端的计划，计划历史仍记录完整计划
+			if compacted, err := plans.Compact(planJSON); err != nil {
+				utils.DefaultLogger.Warn("精简执行计划失败，返回完整计划", zap.Error(err))
 			} else {
-				resultBytes, err := json.Marshal(results)
-				if err != nil {
-					return nil, fmt.Errorf("序列化原始 Explain 结果失败: %w", err)
-				}
-				explainPlanJSON = string(resultBytes)
+				outputJSON = compacted
 			}
-		} else {
-			explainPlanJSON = "[]"
 		}
-		return &protocol.CallToolResult{Content: []protocol.Content{protocol.TextContent{Type: "application/json", Text: explainPlanJSON}}}, nil
+		content := []protocol.Content{protocol.TextContent{Type: "application/json", Text: string(outputJSON)}}
+		if advice := tools.AdvisePlan(planJSON, extManager, schemaManager); len(advice) > 0 {
+			adviceBytes, _ := json.Marshal(map[string]any{"plan_advice": advice})
+			content = append(content, protocol.TextContent{Type: "application/json", Text: string(adviceBytes)})
+		}
+		// 记录计划历史，与该查询上一次的计划比较
+		if _, regression, err := planStore.Record(args.ConnID, query, params, planJSON); err != nil {
+			utils.DefaultLogger.Debug("记录执行计划历史失败", zap.String("connID", args.ConnID), zap.Error(err))
+		} else if regression != nil {
+			regressionBytes, _ := json.Marshal(map[string]any{"plan_regression": regression})
+			content = append(content, protocol.TextContent{Type: "application/json", Text: string(regressionBytes)})
+		}
+		return &protocol.CallToolResult{Content: content}, nil
 	})
 	utils.DefaultLogger.Info("Tool 'pg_explain' 已注册")
 
-	// --- 注册 Resources (使用 RegisterResourceTemplate 和手动解析) ---
+	planHandler := tools.NewPlanHandler(dbService, planStore)
+	checkPlanRegressionsTool, err := protocol.NewTool("check_plan_regressions", "对 pg_explain 记录过的查询重新执行 EXPLAIN，报告计划形状变化或估算成本显著上升的查询 (适合在 ANALYZE 或 Schema 变更后调用)", tools.CheckPlanRegressionsToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'check_plan_regressions' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(checkPlanRegressionsTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 120*time.Second)
+		defer cancel()
+		return planHandler.HandleCheckPlanRegressions(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'check_plan_regressions' 已注册")
 
-	// 注册数据库完整信息资源模板
-	err = mcpServer.RegisterResourceTemplate(
-		&protocol.ResourceTemplate{
-			URITemplate: "pgmcp://{conn_id}/", // 模板仅用于注册标识
-			Description: "获取数据库的完整 Schema 信息",
-		},
-		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
-			_, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if cfg.StateBackupDir != "" {
+		stateHandler := tools.NewStateHandler(cfg.StateBackupDir, credentialResolver, planStore, schemaManager)
+		exportStateTool, err := protocol.NewTool("export_state", "(管理) 把命名凭据 (不含密码)、执行计划历史和 Schema 快照导出为 STATE_BACKUP_DIR 下的一个 .tar.gz 归档，用于迁移到其他主机", tools.ExportStateToolArgs{})
+		if err != nil {
+			return fmt.Errorf("创建 'export_state' 工具定义失败: %w", err)
+		}
+		toolRegistry.RegisterTool(exportStateTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
 			defer cancel()
+			return stateHandler.HandleExportState(ctx, request)
+		})
+		utils.DefaultLogger.Info("Tool 'export_state' 已注册")
 
-			// 1. 解析请求的 URI
-			parsedURI, err := url.Parse(request.URI)
-			if err != nil {
-				utils.DefaultLogger.Error("解析数据库信息请求 URI 失败", zap.String("uri", request.URI), zap.Error(err))
-				return nil, fmt.Errorf("无效的请求 URI: %w", err)
-			}
+		importStateTool, err := protocol.NewTool("import_state", "(管理) 从 export_state 生成的归档导入服务器状态: 命名凭据写入 CREDENTIALS_FILE，执行计划历史与现有记录合并，Schema 快照替换当前缓存", tools.ImportStateToolArgs{})
+		if err != nil {
+			return fmt.Errorf("创建 'import_state' 工具定义失败: %w", err)
+		}
+		toolRegistry.RegisterTool(importStateTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+			defer cancel()
+			return stateHandler.HandleImportState(ctx, request)
+		})
+		utils.DefaultLogger.Info("Tool 'import_state' 已注册")
+	}
 
-			// 2. 提取变量 (conn_id 在 Host 部分)
-			connID := parsedURI.Host
-			if connID == "" {
-				utils.DefaultLogger.Error("从 URI 中未能提取 conn_id (Host 为空)", zap.String("uri", request.URI))
-				return nil, fmt.Errorf("从 URI '%s' 中未能提取 conn_id", request.URI)
-			}
+	jsonbQueryHandler := tools.NewJSONBQueryHandler(dbService, masker)
+	toolRegistry.RegisterTool(tools.JSONBQueryTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return jsonbQueryHandler.HandleJSONBQuery(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'jsonb_query' 已注册")
 
-			// 3. 检查路径是否匹配 (根路径)
-			if parsedURI.Path != "/" && parsedURI.Path != "" { // 允许根路径为 "/" 或空
-				utils.DefaultLogger.Warn("数据库信息请求 URI 路径不匹配预期", zap.String("uri", request.URI), zap.String("expectedPath", "/"))
-				return nil, fmt.Errorf("请求的 URI '%s' 路径不符合预期", request.URI)
-			}
+	paginateHandler := tools.NewPaginateHandler(dbService, masker)
+	toolRegistry.RegisterTool(tools.PaginateQueryTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return paginateHandler.HandlePaginateQuery(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'paginate_query' 已注册")
 
-			utils.DefaultLogger.Info("处理数据库信息资源请求", zap.String("connID", connID), zap.String("uri", request.URI))
+	suggestChartHandler := tools.NewSuggestChartHandler(dbService, masker)
+	toolRegistry.RegisterTool(tools.SuggestChartTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return suggestChartHandler.HandleSuggestChart(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'suggest_chart' 已注册")
 
-			// 4. 调用核心逻辑 (不变)
-			dbInfo, found := schemaManager.GetDatabaseInfo()
-			if !found {
-				return protocol.NewReadResourceResult(nil), nil
-			}
-			resultBytes, err := json.Marshal(dbInfo)
-			if err != nil {
-				return nil, fmt.Errorf("序列化数据库信息失败: %w", err)
-			}
-			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
-			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
-		})
+	compareTablesHandler := tools.NewCompareTablesHandler(dbService, masker)
+	compareTablesTool, err := protocol.NewTool("compare_tables", "按键比较两张表 (可以在不同连接上) 的数据，返回只存在于一侧的行和值不同的行；两侧按键分批有序读取并归并，差异较多时通过 next_cursor 分批返回，适用于验证迁移或 ETL 结果", tools.CompareTablesToolArgs{})
 	if err != nil {
-		return fmt.Errorf("注册 'pgmcp://{conn_id}/' 资源模板失败: %w", err)
+		return fmt.Errorf("创建 'compare_tables' 工具定义失败: %w", err)
 	}
-	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/' 已注册")
+	toolRegistry.RegisterTool(compareTablesTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 120*time.Second)
+		defer cancel()
+		return compareTablesHandler.HandleCompareTables(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'compare_tables' 已注册")
 
-	// 注册 Schema 列表资源模板
-	err = mcpServer.RegisterResourceTemplate(
-		&protocol.ResourceTemplate{
-			URITemplate: "pgmcp://{conn_id}/schemas",
-			Description: "列出所有用户 Schema",
-		},
-		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
-			_, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
+	shardRegistry := shards.NewRegistry()
+	crossDBHandler := tools.NewCrossDBHandler(dbService, shardRegistry, masker)
+	toolRegistry.RegisterTool(tools.CrossDBQueryTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return crossDBHandler.HandleCrossDBQuery(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'cross_db_query' 已注册")
 
-			parsedURI, err := url.Parse(request.URI)
-			if err != nil {
-				return nil, fmt.Errorf("无效的请求 URI: %w", err)
-			}
-			connID := parsedURI.Host
-			if connID == "" {
-				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
-			}
+	shardHandler := tools.NewShardHandler(dbService, shardRegistry)
+	toolRegistry.RegisterTool(tools.RegisterShardGroupTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return shardHandler.HandleRegisterShardGroup(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'register_shard_group' 已注册")
 
-			// 检查路径
-			if parsedURI.Path != "/schemas" {
-				return nil, fmt.Errorf("请求的 URI '%s' 路径不符合预期 '/schemas'", request.URI)
-			}
+	toolRegistry.RegisterTool(tools.RouteShardTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 10*time.Second)
+		defer cancel()
+		return shardHandler.HandleRouteShard(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'route_shard' 已注册")
 
-			utils.DefaultLogger.Info("处理 Schema 列表资源请求", zap.String("connID", connID), zap.String("uri", request.URI))
+	exportHandler := tools.NewExportHandler(dbService, masker, cfg)
+	exportQueryTool, err := protocol.NewTool("export_query", "通过 COPY 将只读查询的结果流式导出为服务端 CSV/文本文件，返回文件路径 (或 URL) 和行数，用于无法直接返回的大结果集", tools.ExportQueryToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'export_query' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(exportQueryTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 10*time.Minute)
+		defer cancel()
+		return exportHandler.HandleExportQuery(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'export_query' 已注册", zap.String("exportDir", cfg.ExportDir))
 
-			dbInfo, found := schemaManager.GetDatabaseInfo()
-			if !found {
-				return protocol.NewReadResourceResult(nil), nil
-			}
-			// ... (Schema 列表提取和序列化逻辑不变) ...
-			schemaList := make([]map[string]string, 0, len(dbInfo.Schemas))
-			for _, s := range dbInfo.Schemas {
-				schemaList = append(schemaList, map[string]string{"name": s.Name, "description": s.Description})
+	dataDictionaryHandler := tools.NewDataDictionaryHandler(schemaManager, cfg)
+	exportDataDictionaryTool, err := protocol.NewTool("export_data_dictionary", "根据缓存的元数据为每个 Schema 生成 Markdown 数据字典 (表和列的注释, 外键及被引用关系, 大致行数, 索引, 视图, 类型, 函数)；可直接返回文档或写入服务端导出目录", tools.ExportDataDictionaryToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'export_data_dictionary' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(exportDataDictionaryTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return dataDictionaryHandler.HandleExportDataDictionary(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'export_data_dictionary' 已注册")
+
+	cancelHandler := tools.NewCancelHandler(dbService)
+	listActiveQueriesTool, err := protocol.NewTool("list_active_queries", "列出由本服务发起、仍在执行中的查询 (query_id, SQL, 开始时间, 后端 PID)", tools.ListActiveQueriesToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'list_active_queries' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(listActiveQueriesTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 5*time.Second)
+		defer cancel()
+		return cancelHandler.HandleListActiveQueries(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'list_active_queries' 已注册")
+
+	pgCancelTool, err := protocol.NewTool("pg_cancel", "取消一个长时间运行的在途查询 (通过 query_id)", tools.PgCancelToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'pg_cancel' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(pgCancelTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 10*time.Second)
+		defer cancel()
+		return cancelHandler.HandlePgCancel(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'pg_cancel' 已注册")
+
+	notificationsHandler := tools.NewNotificationsHandler(notificationHub)
+	pgListenTool, err := protocol.NewTool("pg_listen", "在专用连接上 LISTEN 一个 PostgreSQL 通知频道，收到的 NOTIFY 会被缓存，可通过 pg_poll_notifications 读取，订阅 pgmcp://{conn_id}/notifications 资源的客户端会在有新通知时收到更新", tools.PgListenToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'pg_listen' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(pgListenTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 15*time.Second)
+		defer cancel()
+		return notificationsHandler.HandlePgListen(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'pg_listen' 已注册", zap.Int("maxChannels", cfg.ListenMaxChannels), zap.Int("bufferSize", cfg.ListenBufferSize))
+
+	pgUnlistenTool, err := protocol.NewTool("pg_unlisten", "停止监听 PostgreSQL 通知频道并关闭其专用连接 (不指定 channel 时停止该连接上的所有频道)", tools.PgUnlistenToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'pg_unlisten' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(pgUnlistenTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 10*time.Second)
+		defer cancel()
+		return notificationsHandler.HandlePgUnlisten(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'pg_unlisten' 已注册")
+
+	pgPollNotificationsTool, err := protocol.NewTool("pg_poll_notifications", "读取 pg_listen 监听的频道收到的通知 (按序号游标 since_id 增量读取，wait_ms 可长轮询等待新通知)，并返回各频道的监听状态", tools.PgPollNotificationsToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'pg_poll_notifications' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(pgPollNotificationsTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 90*time.Second)
+		defer cancel()
+		return notificationsHandler.HandlePgPollNotifications(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'pg_poll_notifications' 已注册")
+
+	transactionHandler := tools.NewTransactionHandler(dbService, masker)
+	txBeginTool, err := protocol.NewTool("tx_begin", "开始一个事务会话: 固定一条数据库连接并在 REPEATABLE READ (或 SERIALIZABLE) 只读事务中获取快照，之后的 tx_execute 语句都看到同一时刻的一致数据；temp_tables=true 时允许创建本会话的临时表 (需要 read_write 连接)。会话空闲或持续过久会被自动回滚，用完请 tx_commit 或 tx_rollback", tools.TxBeginToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'tx_begin' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(txBeginTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return transactionHandler.HandleTxBegin(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'tx_begin' 已注册")
+
+	toolRegistry.RegisterTool(tools.TxExecuteTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return transactionHandler.HandleTxExecute(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'tx_execute' 已注册")
+
+	txCommitTool, err := protocol.NewTool("tx_commit", "提交事务会话并释放其连接 (只读会话提交与回滚效果相同)；语句出错而中止的事务会被回滚", tools.TxIDToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'tx_commit' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(txCommitTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return transactionHandler.HandleTxCommit(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'tx_commit' 已注册")
+
+	txRollbackTool, err := protocol.NewTool("tx_rollback", "回滚事务会话并释放其连接，会话中创建的临时表随之删除", tools.TxIDToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'tx_rollback' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(txRollbackTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return transactionHandler.HandleTxRollback(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'tx_rollback' 已注册")
+
+	txSavepointTool, err := protocol.NewTool("tx_savepoint", "在事务会话中创建保存点，之后尝试性的语句失败 (使事务中止) 时可以用 tx_rollback_to 回到该点继续分析，而不必回滚整个事务", tools.TxSavepointToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'tx_savepoint' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(txSavepointTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return transactionHandler.HandleTxSavepoint(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'tx_savepoint' 已注册")
+
+	txRollbackToTool, err := protocol.NewTool("tx_rollback_to", "把事务会话回滚到保存点: 撤销之后的语句和临时表，中止的事务恢复为可用；保存点保留，可以再次回滚到它", tools.TxSavepointToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'tx_rollback_to' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(txRollbackToTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return transactionHandler.HandleTxRollbackTo(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'tx_rollback_to' 已注册")
+
+	txListTool, err := protocol.NewTool("tx_list", "列出打开的事务会话及其状态 (语句数、临时表、自动回滚时间)", tools.TxListToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'tx_list' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(txListTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 10*time.Second)
+		defer cancel()
+		return transactionHandler.HandleTxList(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'tx_list' 已注册")
+
+	namedQueryHandler := tools.NewNamedQueryHandler(dbService, masker, namedqueries.NewRegistry(cfg.NamedQueriesPath))
+	if cfg.NamedQueryRegistration {
+		toolRegistry.RegisterTool(tools.RegisterQueryTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Context(request), 10*time.Second)
+			defer cancel()
+			return namedQueryHandler.HandleRegisterQuery(ctx, request)
+		})
+		utils.DefaultLogger.Info("Tool 'register_query' 已注册")
+	}
+
+	// 命名查询的执行超时由查询定义决定 (默认 60s)
+	toolRegistry.RegisterTool(tools.RunNamedQueryTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 10*time.Minute)
+		defer cancel()
+		return namedQueryHandler.HandleRunNamedQuery(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'run_named_query' 已注册")
+
+	listNamedQueriesTool, err := protocol.NewTool("list_named_queries", "列出已登记的命名查询及其说明、SQL 模板和参数定义", tools.ListNamedQueriesToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'list_named_queries' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(listNamedQueriesTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 10*time.Second)
+		defer cancel()
+		return namedQueryHandler.HandleListNamedQueries(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'list_named_queries' 已注册")
+
+	// 查询模板库: 目录不存在或无效时不加载模板，不影响启动
+	queryLibrary := querylib.NewManager(cfg.QueryTemplatesDir, tools.ValidateTemplate)
+	if err := queryLibrary.LoadTemplates(); err != nil {
+		utils.DefaultLogger.Warn("加载查询模板库失败，run_template 将没有可用模板", zap.Error(err))
+	}
+	queryTemplateHandler := tools.NewQueryTemplateHandler(dbService, masker, queryLibrary)
+	// 模板的执行超时由模板定义决定 (默认 60s)
+	toolRegistry.RegisterTool(tools.RunTemplateTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 10*time.Minute)
+		defer cancel()
+		return queryTemplateHandler.HandleRunTemplate(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'run_template' 已注册")
+
+	mcpServer.RegisterResource(
+		&protocol.Resource{
+			URI:         "pgmcp://server/query_templates",
+			Name:        "query_templates",
+			Description: "列出查询模板库中的模板 (名称、说明、标签、SQL 模板和参数定义)，可通过 run_template 运行",
+			MimeType:    "application/json",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			utils.DefaultLogger.Info("处理查询模板列表资源请求", zap.String("uri", request.URI))
+			resultBytes, err := json.Marshal(map[string]any{"templates": queryLibrary.AllTemplates()})
+			if err != nil {
+				return nil, fmt.Errorf("序列化查询模板列表失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	utils.DefaultLogger.Info("Resource 'pgmcp://server/query_templates' 已注册")
+
+	asOfQueryHandler := tools.NewAsOfQueryHandler(dbService, schemaManager, masker)
+	toolRegistry.RegisterTool(tools.AsOfQueryTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return asOfQueryHandler.HandleAsOfQuery(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'as_of_query' 已注册")
+
+	idempotencyStore := idempotency.NewStore(dbService, cfg.IdempotencyPendingTTL)
+	callFunctionHandler := tools.NewCallFunctionHandler(dbService, schemaManager, idempotencyStore, reviewQueue)
+	toolRegistry.RegisterTool(tools.CallFunctionTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return callFunctionHandler.HandleCallFunction(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'call_function' 已注册")
+
+	writeTempHandler := tools.NewWriteTempHandler(dbService, idempotencyStore, reviewQueue, cfg.ImportDir)
+	toolRegistry.RegisterTool(tools.SaveAnalysisResultTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return writeTempHandler.HandleSaveAnalysisResult(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'save_analysis_result' 已注册")
+
+	toolRegistry.RegisterTool(tools.ImportCSVTempTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 5*time.Minute)
+		defer cancel()
+		return writeTempHandler.HandleImportCSVTemp(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'import_csv_temp' 已注册", zap.String("importDir", cfg.ImportDir))
+
+	callProcedureHandler := tools.NewCallProcedureHandler(dbService, schemaManager, idempotencyStore, reviewQueue, cfg.ProcedureAllowlist)
+	toolRegistry.RegisterTool(tools.CallProcedureTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 5*time.Minute)
+		defer cancel()
+		return callProcedureHandler.HandleCallProcedure(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'call_procedure' 已注册", zap.Strings("allowlist", cfg.ProcedureAllowlist))
+
+	queryLogHandler := tools.NewQueryLogHandler(dbService, reviewQueue)
+	loadQueryLogTool, err := protocol.NewTool("load_query_log", "将服务端记录的最近查询历史 (SQL, 执行时长, 慢查询标记, 错误) 导入 temp.mcp_query_log 表，之后可用 SQL 分析服务使用情况", tools.LoadQueryLogToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'load_query_log' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(loadQueryLogTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return queryLogHandler.HandleLoadQueryLog(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'load_query_log' 已注册")
+
+	// 表、列和扩展知识的嵌入索引 (关闭时 relevant_schema 只按关键字排序)，由 search_schema 和 relevant_schema 共用
+	embeddingIndex, err := retrieval.OpenIndex(cfg)
+	if err != nil {
+		return fmt.Errorf("初始化嵌入索引失败: %w", err)
+	}
+	ranker := retrieval.NewRanker(schemaManager, extManager, embeddingIndex)
+
+	searchSchemaHandler := tools.NewSearchSchemaHandler(schemaManager, ranker)
+	searchSchemaTool, err := protocol.NewTool("search_schema", "按关键字搜索缓存的 Schema 元数据 (表名, 列名, 注释, 函数名, 类型及枚举值)，返回按相关度排序的对象及其位置", tools.SearchSchemaToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'search_schema' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(searchSchemaTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return searchSchemaHandler.HandleSearchSchema(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'search_schema' 已注册")
+
+	relevantSchemaHandler := tools.NewRelevantSchemaHandler(ranker, resources.NewContextBundleHandler(dbService, schemaManager, masker))
+	relevantSchemaTool, err := protocol.NewTool("relevant_schema", "根据自然语言问题对缓存的表按相关度排序 (表名、列名、注释的关键字匹配与嵌入相似度)，返回最相关的 top_k 张表及其列、外键关系和统计信息，以及相关的扩展知识，适用于表很多的数据库", tools.RelevantSchemaToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'relevant_schema' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(relevantSchemaTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return relevantSchemaHandler.HandleRelevantSchema(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'relevant_schema' 已注册")
+
+	// 内置提示: 按 Schema 缓存和扩展知识组装编写、审查和优化 SQL 的提示
+	promptLibrary := prompts.NewLibrary(schemaManager, extManager, ranker, cfg.SchemaSummaryTokenBudget)
+	for _, prompt := range []struct {
+		definition *protocol.Prompt
+		build      func(context.Context, *protocol.GetPromptRequest) (*protocol.GetPromptResult, error)
+	}{
+		{prompts.GenerateSQLPrompt, promptLibrary.GenerateSQL},
+		{prompts.ExplainPlanReviewPrompt, promptLibrary.ExplainPlanReview},
+		{prompts.OptimizeQueryPrompt, promptLibrary.OptimizeQuery},
+	} {
+		build := prompt.build
+		mcpServer.RegisterPrompt(prompt.definition, func(request *protocol.GetPromptRequest) (*protocol.GetPromptResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 30*time.Second)
+			defer cancel()
+			return build(ctx, request)
+		})
+		utils.DefaultLogger.Info("Prompt '" + prompt.definition.Name + "' 已注册")
+	}
+
+	if embeddingIndex != nil {
+		schemaEmbeddingsHandler := tools.NewSchemaEmbeddingsHandler(dbService, ranker, reviewQueue)
+		loadSchemaEmbeddingsTool, err := protocol.NewTool("load_schema_embeddings", "将表、列和扩展知识的嵌入索引导入 temp.mcp_schema_embeddings 表 (安装了 pgvector 时为 vector 类型)，之后可在 SQL 中做相似度查询", tools.LoadSchemaEmbeddingsToolArgs{})
+		if err != nil {
+			return fmt.Errorf("创建 'load_schema_embeddings' 工具定义失败: %w", err)
+		}
+		toolRegistry.RegisterTool(loadSchemaEmbeddingsTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Context(request), 120*time.Second)
+			defer cancel()
+			return schemaEmbeddingsHandler.HandleLoadSchemaEmbeddings(ctx, request)
+		})
+		utils.DefaultLogger.Info("Tool 'load_schema_embeddings' 已注册")
+	}
+
+	distinctValuesHandler := tools.NewDistinctValuesHandler(dbService, schemaManager, masker)
+	distinctValuesTool, err := protocol.NewTool("column_distinct_values", "返回指定列最多 N 个不同值及其出现次数 (按次数降序)，用于获取枚举类文本列的合法过滤值", tools.DistinctValuesToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'column_distinct_values' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(distinctValuesTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return distinctValuesHandler.HandleDistinctValues(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'column_distinct_values' 已注册")
+
+	vectorSearchHandler := tools.NewVectorSearchHandler(dbService, schemaManager, masker)
+	toolRegistry.RegisterTool(tools.VectorSearchTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return vectorSearchHandler.HandleVectorSearch(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'vector_search' 已注册")
+
+	gisHandler := tools.NewGISHandler(dbService, schemaManager, masker)
+	gisTableSummaryTool, err := protocol.NewTool("gis_table_summary", "需要 PostGIS: 返回表中每个 geometry/geography 列的声明类型、SRID、实际出现的几何类型及个数、空值数、范围 (extent) 和空间索引，编写空间查询前使用", tools.GISTableSummaryToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'gis_table_summary' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(gisTableSummaryTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return gisHandler.HandleGISTableSummary(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'gis_table_summary' 已注册")
+
+	gisBBoxQueryTool, err := protocol.NewTool("gis_bbox_query", "需要 PostGIS: 查询空间列与范围框 (xmin, ymin, xmax, ymax) 相交的行 (ST_Intersects，可以使用空间索引)，范围框坐标的 SRID 与列不同时自动转换；结果之后的内容块包含执行信息", tools.GISBBoxQueryToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'gis_bbox_query' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(gisBBoxQueryTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return gisHandler.HandleGISBBoxQuery(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'gis_bbox_query' 已注册")
+
+	gisTransformTool, err := protocol.NewTool("gis_transform", "需要 PostGIS: 把 GeoJSON 或 WKT 几何对象从一个空间参考 (SRID) 转换到另一个 (ST_Transform)，返回 GeoJSON、WKT 和目标参考系名称", tools.GISTransformToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'gis_transform' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(gisTransformTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 10*time.Second)
+		defer cancel()
+		return gisHandler.HandleGISTransform(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'gis_transform' 已注册")
+
+	timescaleStatsHandler := tools.NewTimescaleStatsHandler(dbService, schemaManager)
+	timescaleStatsTool, err := protocol.NewTool("timescale_stats", "需要 TimescaleDB: 返回超表的大小 (表/索引/TOAST)、分块数量和时间范围、压缩前后的大小，以及保留、压缩等后台作业的最近执行状态", tools.TimescaleStatsToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'timescale_stats' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(timescaleStatsTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return timescaleStatsHandler.HandleTimescaleStats(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'timescale_stats' 已注册")
+
+	checkOrphansHandler := tools.NewCheckOrphansHandler(dbService, schemaManager, masker)
+	checkOrphansTool, err := protocol.NewTool("check_orphans", "检查表上的外键 (或指定外键) 是否存在父行缺失的子行: 用反连接计数并返回样本，用于诊断数据不一致", tools.CheckOrphansToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'check_orphans' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(checkOrphansTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return checkOrphansHandler.HandleCheckOrphans(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'check_orphans' 已注册")
+
+	auditSequencesHandler := tools.NewAuditSequencesHandler(dbService)
+	auditSequencesTool, err := protocol.NewTool("audit_sequences", "检查接近上限的序列 (含 int4 列使用 bigint 序列的情况) 和接近溢出的 smallint/integer 主键，按已用比例排序并给出剩余次数", tools.AuditSequencesToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'audit_sequences' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(auditSequencesTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 60*time.Second)
+		defer cancel()
+		return auditSequencesHandler.HandleAuditSequences(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'audit_sequences' 已注册")
+
+	findDuplicateIndexesHandler := tools.NewFindDuplicateIndexesHandler(dbService, schemaManager)
+	findDuplicateIndexesTool, err := protocol.NewTool("find_duplicate_indexes", "比较 Schema 缓存中同一张表上的索引定义，找出完全重复或被其他 btree 索引前缀覆盖的冗余索引，给出可回收空间、扫描次数和删除建议", tools.FindDuplicateIndexesToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'find_duplicate_indexes' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(findDuplicateIndexesTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return findDuplicateIndexesHandler.HandleFindDuplicateIndexes(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'find_duplicate_indexes' 已注册")
+
+	auditColumnsHandler := tools.NewAuditColumnsHandler(dbService, schemaManager)
+	auditColumnsTool, err := protocol.NewTool("audit_columns", "结合 pg_stats 的 NULL 比例和不同值估算、抽样中的非 NULL 行数和等于默认值的行数，按表标记疑似未使用的列 (全为 NULL、全为默认值、几乎全为 NULL 或只有一个取值)，用于 Schema 清理", tools.AuditColumnsToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'audit_columns' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(auditColumnsTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 120*time.Second)
+		defer cancel()
+		return auditColumnsHandler.HandleAuditColumns(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'audit_columns' 已注册")
+
+	topQueriesHandler := tools.NewTopQueriesHandler(dbService, schemaManager)
+	topQueriesTool, err := protocol.NewTool("top_queries", "基于 pg_stat_statements 返回当前数据库开销最大的语句 (总耗时, 调用次数, 平均耗时, 行数)，可按表名过滤，用于性能排查", tools.TopQueriesToolArgs{})
+	if err != nil {
+		return fmt.Errorf("创建 'top_queries' 工具定义失败: %w", err)
+	}
+	toolRegistry.RegisterTool(topQueriesTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(requestTracker.Context(request), 30*time.Second)
+		defer cancel()
+		return topQueriesHandler.HandleTopQueries(ctx, request)
+	})
+	utils.DefaultLogger.Info("Tool 'top_queries' 已注册")
+
+	// --- 注册 Resources (使用 RegisterResourceTemplate 和手动解析) ---
+
+	// 注册数据库完整信息资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/", // 模板仅用于注册标识
+			Description: "获取数据库的完整 Schema 信息及连接特性摘要 (版本, postgis/pgvector/timescaledb, 是否只读)",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 30*time.Second)
+			defer cancel()
+
+			// 1. 解析请求的 URI
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				utils.DefaultLogger.Error("解析数据库信息请求 URI 失败", zap.String("uri", request.URI), zap.Error(err))
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+
+			// 2. 提取变量 (conn_id 在 Host 部分)
+			connID := parsedURI.Host
+			if connID == "" {
+				utils.DefaultLogger.Error("从 URI 中未能提取 conn_id (Host 为空)", zap.String("uri", request.URI))
+				return nil, fmt.Errorf("从 URI '%s' 中未能提取 conn_id", request.URI)
+			}
+
+			// 3. 检查路径是否匹配 (根路径)
+			if parsedURI.Path != "/" && parsedURI.Path != "" { // 允许根路径为 "/" 或空
+				utils.DefaultLogger.Warn("数据库信息请求 URI 路径不匹配预期", zap.String("uri", request.URI), zap.String("expectedPath", "/"))
+				return nil, fmt.Errorf("请求的 URI '%s' 路径不符合预期", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理数据库信息资源请求", zap.String("connID", connID), zap.String("uri", request.URI))
+
+			// 4. 调用核心逻辑 (不变)
+			dbInfo, found := schemaManager.GetDatabaseInfo()
+			if !found {
+				return protocol.NewReadResourceResult(nil), nil
+			}
+			// 特性摘要按请求的连接返回，不修改共享的缓存
+			result := *dbInfo
+			if features, err := schemaManager.GetFeatures(ctx, connID); err != nil {
+				utils.DefaultLogger.Warn("检测连接特性失败，返回 Schema 加载连接的特性", zap.String("connID", connID), zap.Error(err))
+			} else {
+				result.Features = features
+			}
+			resultBytes, err := json.Marshal(result)
+			if err != nil {
+				return nil, fmt.Errorf("序列化数据库信息失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/' 已注册")
+
+	// 注册 Schema 摘要资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/summary{?budget}",
+			Description: "获取适合 LLM 上下文的精简 Schema 摘要 (Markdown: Schema -> 表 -> 关键列及外键关系)，可用 ?budget=N 指定 token 预算",
+			MimeType:    "text/markdown",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 15*time.Second)
+			defer cancel()
+
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			if strings.Trim(parsedURI.Path, "/") != "summary" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/summary'", request.URI)
+			}
+			budget := cfg.SchemaSummaryTokenBudget
+			if budgetStr := parsedURI.Query().Get("budget"); budgetStr != "" {
+				budget, err = strconv.Atoi(budgetStr)
+				if err != nil || budget <= 0 {
+					return nil, fmt.Errorf("无效的 budget 参数: '%s'", budgetStr)
+				}
+			}
+
+			utils.DefaultLogger.Info("处理 Schema 摘要资源请求", zap.String("connID", connID), zap.Int("budget", budget), zap.String("uri", request.URI))
+
+			dbInfo, found := schemaManager.GetDatabaseInfo()
+			if !found {
+				return protocol.NewReadResourceResult(nil), nil
+			}
+			result := *dbInfo
+			if features, err := schemaManager.GetFeatures(ctx, connID); err == nil {
+				result.Features = features
+			}
+			summary := schemas.SummarizeDatabase(&result, budget)
+
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "text/markdown", Text: summary}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/summary' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/summary' 已注册")
+
+	// 注册 MCP 会话活动资源
+	mcpServer.RegisterResource(
+		&protocol.Resource{
+			URI:         "pgmcp://server/sessions",
+			Name:        "sessions",
+			Description: "列出当前 MCP 客户端会话: 注册/使用过的连接 ID、在途工具调用、累计调用次数，以及所有在途数据库查询",
+			MimeType:    "application/json",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			utils.DefaultLogger.Info("处理 MCP 会话活动资源请求", zap.String("uri", request.URI))
+			resultBytes, err := json.Marshal(map[string]any{
+				"sessions":       sessionTracker.List(),
+				"active_queries": dbService.ListActiveQueries(""),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("序列化会话活动失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	utils.DefaultLogger.Info("Resource 'pgmcp://server/sessions' 已注册")
+
+	// 注册结果缓存状态资源
+	mcpServer.RegisterResource(
+		&protocol.Resource{
+			URI:         "pgmcp://server/result_cache",
+			Name:        "result_cache",
+			Description: "只读查询结果缓存 (RESULT_CACHE_TTL) 的状态: 缓存条目数、估算大小、命中/未命中/淘汰次数和命中率",
+			MimeType:    "application/json",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			utils.DefaultLogger.Info("处理结果缓存状态资源请求", zap.String("uri", request.URI))
+			resultBytes, err := json.Marshal(dbService.ResultCacheStats())
+			if err != nil {
+				return nil, fmt.Errorf("序列化结果缓存状态失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	utils.DefaultLogger.Info("Resource 'pgmcp://server/result_cache' 已注册")
+
+	// 注册命名凭据列表资源 (只包含名称和说明，不含连接字符串)
+	mcpServer.RegisterResource(
+		&protocol.Resource{
+			URI:         "pgmcp://server/databases",
+			Name:        "databases",
+			Description: "列出服务端配置的命名数据库凭据，可作为 connect 工具的 database 参数使用 (不包含连接字符串或密码)",
+			MimeType:    "application/json",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			utils.DefaultLogger.Info("处理命名凭据列表资源请求", zap.String("uri", request.URI))
+			infos, err := credentialResolver.List()
+			if err != nil {
+				return nil, err
+			}
+			resultBytes, err := json.Marshal(map[string]any{
+				"databases":                    infos,
+				"allow_raw_connection_strings": cfg.AllowRawConnectionStrings,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("序列化命名凭据列表失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	utils.DefaultLogger.Info("Resource 'pgmcp://server/databases' 已注册")
+
+	// 注册表关系图资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/graph{?format,schema}",
+			Description: "获取基于外键的表关系图 (节点为表，边为外键及 JOIN 条件)，用于规划多表连接。?format=json|mermaid|dot，?schema=xxx 只包含指定 Schema",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			if strings.Trim(parsedURI.Path, "/") != "graph" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/graph'", request.URI)
+			}
+			format := strings.ToLower(parsedURI.Query().Get("format"))
+			if format == "" {
+				format = schemas.GraphFormatJSON
+			}
+			schemaName := parsedURI.Query().Get("schema")
+
+			utils.DefaultLogger.Info("处理表关系图资源请求", zap.String("connID", connID), zap.String("format", format), zap.String("schema", schemaName))
+
+			dbInfo, found := schemaManager.GetDatabaseInfo()
+			if !found {
+				return protocol.NewReadResourceResult(nil), nil
+			}
+			graph := schemas.BuildRelationshipGraph(dbInfo, schemaName)
+
+			var textContent protocol.TextResourceContents
+			switch format {
+			case schemas.GraphFormatJSON:
+				resultBytes, err := json.Marshal(graph)
+				if err != nil {
+					return nil, fmt.Errorf("序列化表关系图失败: %w", err)
+				}
+				textContent = protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			case schemas.GraphFormatMermaid:
+				textContent = protocol.TextResourceContents{URI: request.URI, MimeType: "text/vnd.mermaid", Text: graph.Mermaid()}
+			case schemas.GraphFormatDOT:
+				textContent = protocol.TextResourceContents{URI: request.URI, MimeType: "text/vnd.graphviz", Text: graph.DOT()}
+			default:
+				return nil, fmt.Errorf("不支持的 format 参数: '%s' (可选 json, mermaid, dot)", format)
+			}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/graph' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/graph' 已注册")
+
+	// 注册连接池统计资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/pool/stats",
+			Description: "获取连接的连接池状态 (使用中/空闲/最大连接数, 获取连接的等待时间和被取消次数)，用于判断是连接池饱和还是数据库本身变慢",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 10*time.Second)
+			defer cancel()
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			if strings.Trim(parsedURI.Path, "/") != "pool/stats" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/pool/stats'", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理连接池统计资源请求", zap.String("connID", connID))
+			pool, err := dbService.GetPool(ctx, connID)
+			if err != nil {
+				return nil, fmt.Errorf("获取连接池失败: %w", err)
+			}
+			resultBytes, err := json.Marshal(databases.NewPoolStats(pool.Stat()))
+			if err != nil {
+				return nil, fmt.Errorf("序列化连接池统计失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/pool/stats' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/pool/stats' 已注册")
+
+	// 注册主机路由状态资源模板 (主库和只读副本)
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/hosts",
+			Description: "获取连接中主库和各只读副本的路由状态: 是否健康、路由到的只读查询数、连接失败次数、最近一次错误和各自的连接池状态",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 10*time.Second)
+			defer cancel()
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			if strings.Trim(parsedURI.Path, "/") != "hosts" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/hosts'", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理主机路由状态资源请求", zap.String("connID", connID))
+			stats, err := dbService.HostStats(ctx, connID)
+			if err != nil {
+				return nil, fmt.Errorf("获取主机路由状态失败: %w", err)
+			}
+			resultBytes, err := json.Marshal(stats)
+			if err != nil {
+				return nil, fmt.Errorf("序列化主机路由状态失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/hosts' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/hosts' 已注册")
+
+	// 注册连接状态资源模板；连接池被空闲回收或 connID 过期时向订阅者发送 resources/updated 通知
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/status",
+			Description: "获取 connID 的状态 (active / expired / unknown)、连接池是否打开、最近使用时间和按 DB_CONN_TTL 计算的过期时间；订阅后在连接池被空闲回收或 connID 过期时收到更新通知",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			if strings.Trim(parsedURI.Path, "/") != "status" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/status'", request.URI)
+			}
+			resultBytes, err := json.Marshal(dbService.ConnectionStatus(connID))
+			if err != nil {
+				return nil, fmt.Errorf("序列化连接状态失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/status' 资源模板失败: %w", err)
+	}
+	dbService.AddEvictionListener(func(eviction databases.ConnectionEviction) {
+		ctx, cancel := context.WithTimeout(requestTracker.Root(), 5*time.Second)
+		defer cancel()
+		notification := &protocol.ResourceUpdatedNotification{URI: fmt.Sprintf("pgmcp://%s/status", eviction.ConnID)}
+		if err := mcpServer.SendNotification4ResourcesUpdated(ctx, notification); err != nil {
+			utils.DefaultLogger.Warn("发送连接状态更新通知失败", zap.String("connID", eviction.ConnID), zap.String("reason", eviction.Reason), zap.Error(err))
+		}
+	})
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/status' 已注册")
+
+	// 注册通知资源模板 (pg_listen 监听的频道收到的最近通知)
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/notifications",
+			Description: "pg_listen 监听的频道状态和缓存中的通知 (最多最近 100 条)；订阅后在收到新的 NOTIFY 时会收到资源更新通知",
+			MimeType:    "application/json",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			if strings.Trim(parsedURI.Path, "/") != "notifications" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/notifications'", request.URI)
+			}
+			received := notificationHub.Poll(requestTracker.Root(), connID, "", 0, 0, 0)
+			if len(received) > 100 {
+				received = received[len(received)-100:]
+			}
+			resultBytes, err := json.Marshal(map[string]any{"subscriptions": notificationHub.Subscriptions(connID), "notifications": received})
+			if err != nil {
+				return nil, fmt.Errorf("序列化通知失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/notifications' 资源模板失败: %w", err)
+	}
+	// 短时间内的多条 NOTIFY 合并为一次资源更新通知
+	var pendingMu sync.Mutex
+	pendingUpdates := make(map[string]bool)
+	notificationHub.AddObserver(func(n notifications.Notification) {
+		pendingMu.Lock()
+		defer pendingMu.Unlock()
+		if pendingUpdates[n.ConnID] {
+			return
+		}
+		pendingUpdates[n.ConnID] = true
+		time.AfterFunc(200*time.Millisecond, func() {
+			pendingMu.Lock()
+			delete(pendingUpdates, n.ConnID)
+			pendingMu.Unlock()
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 5*time.Second)
+			defer cancel()
+			notification := &protocol.ResourceUpdatedNotification{URI: fmt.Sprintf("pgmcp://%s/notifications", n.ConnID)}
+			if err := mcpServer.SendNotification4ResourcesUpdated(ctx, notification); err != nil {
+				utils.DefaultLogger.Warn("发送通知资源更新通知失败", zap.String("connID", n.ConnID), zap.Error(err))
+			}
+		})
+	})
+	dbService.AddEvictionListener(func(eviction databases.ConnectionEviction) {
+		if eviction.Reason == databases.EvictionExpired {
+			notificationHub.UnlistenAll(eviction.ConnID)
+		}
+	})
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/notifications' 已注册")
+
+	// 注册表上下文资源模板 (编写 SQL 前一次取回所需的表定义、关系、样本和统计)
+	contextBundleHandler := resources.NewContextBundleHandler(dbService, schemaManager, masker)
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/context{?tables,sample}",
+			Description: "一次返回指定表 (?tables=schema.table,table) 的列定义、索引、外键关系 (含 JOIN 条件)、样本行 (?sample=N，默认 3) 和列统计信息，用于编写 SQL 之前获取上下文",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 30*time.Second)
+			defer cancel()
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			return contextBundleHandler.HandleContextBundle(ctx, parsedURI)
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/context' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/context' 已注册")
+
+	// 注册待审核写入资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/pending_writes",
+			Description: "列出审核模式下等待操作员批准 (以及已审核、已过期) 的写入操作，不包含工具调用参数",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			if strings.Trim(parsedURI.Path, "/") != "pending_writes" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/pending_writes'", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理待审核写入资源请求", zap.String("connID", connID), zap.String("uri", request.URI))
+			resultBytes, err := json.Marshal(map[string]any{
+				"review_mode": reviewQueue.Enabled(),
+				"writes":      reviewQueue.List(connID),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("序列化待审核写入失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/pending_writes' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/pending_writes' 已注册")
+
+	// 注册执行计划回归资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/plan_regressions",
+			Description: "列出最近检测到的执行计划回归 (计划形状变化或估算成本显著上升) 以及已记录计划的查询",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			if strings.Trim(parsedURI.Path, "/") != "plan_regressions" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/plan_regressions'", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理执行计划回归资源请求", zap.String("connID", connID), zap.String("uri", request.URI))
+			resultBytes, err := json.Marshal(map[string]any{
+				"regressions":     planStore.Regressions(connID),
+				"tracked_queries": planStore.Latest(connID),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("序列化执行计划回归失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/plan_regressions' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/plan_regressions' 已注册")
+
+	// 注册 Schema 列表资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/schemas",
+			Description: "列出所有用户 Schema",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			_, cancel := context.WithTimeout(requestTracker.Root(), 10*time.Second)
+			defer cancel()
+
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+
+			// 检查路径
+			if parsedURI.Path != "/schemas" {
+				return nil, fmt.Errorf("请求的 URI '%s' 路径不符合预期 '/schemas'", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理 Schema 列表资源请求", zap.String("connID", connID), zap.String("uri", request.URI))
+
+			dbInfo, found := schemaManager.GetDatabaseInfo()
+			if !found {
+				return protocol.NewReadResourceResult(nil), nil
+			}
+			// ... (Schema 列表提取和序列化逻辑不变) ...
+			schemaList := make([]map[string]string, 0, len(dbInfo.Schemas))
+			for _, s := range dbInfo.Schemas {
+				schemaList = append(schemaList, map[string]string{"name": s.Name, "description": s.Description})
+			}
+			resultBytes, err := json.Marshal(schemaList)
+			if err != nil {
+				return nil, fmt.Errorf("序列化 Schema 列表失败: %w", err)
+			}
+
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas' 已注册")
+
+	// 注册 TimescaleDB 连续聚合列表资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/continuous_aggregates",
+			Description: "列出 TimescaleDB 连续聚合: 所在 Schema、源超表、是否只查询已物化数据、压缩和刷新策略 (起止偏移、执行间隔) 以及视图定义；未安装 timescaledb 时为空列表",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			if strings.Trim(parsedURI.Path, "/") != "continuous_aggregates" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/continuous_aggregates'", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理连续聚合列表资源请求", zap.String("connID", connID))
+			type schemaAggregate struct {
+				Schema string `json:"schema"`
+				schemas.ContinuousAggregateInfo
+			}
+			aggregates := []schemaAggregate{}
+			if dbInfo, found := schemaManager.GetDatabaseInfo(); found {
+				for _, s := range dbInfo.Schemas {
+					for _, aggregate := range s.ContinuousAggregates {
+						aggregates = append(aggregates, schemaAggregate{Schema: s.Name, ContinuousAggregateInfo: aggregate})
+					}
+				}
+			}
+			resultBytes, err := json.Marshal(aggregates)
+			if err != nil {
+				return nil, fmt.Errorf("序列化连续聚合列表失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/continuous_aggregates' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/continuous_aggregates' 已注册")
+
+	// 注册 Table 列表资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/tables",
+			Description: "列出指定 Schema 下的所有表",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			_, cancel := context.WithTimeout(requestTracker.Root(), 15*time.Second)
+			defer cancel()
+
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+
+			// 按路径段提取 schema
+			// Path: /schemas/{schema}/tables
+			pathSegments := strings.Split(strings.Trim(parsedURI.Path, "/"), "/")
+			if len(pathSegments) != 3 || pathSegments[0] != "schemas" || pathSegments[2] != "tables" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/tables'", request.URI)
+			}
+			schemaName := pathSegments[1]
+			if schemaName == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 schema: %s", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理 Table 列表资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("uri", request.URI))
+
+			schemaInfo, found := schemaManager.GetSchemaInfo(schemaName)
+			if !found {
+				return protocol.NewReadResourceResult(nil), nil
+			}
+			// ... (Table 列表提取和序列化逻辑不变) ...
+			tableList := make([]map[string]any, 0, len(schemaInfo.Tables))
+			for _, t := range schemaInfo.Tables {
+				tableList = append(tableList, map[string]any{"name": t.Name, "description": t.Description, "row_count": t.RowCount})
+			}
+			resultBytes, err := json.Marshal(tableList)
+			if err != nil {
+				return nil, fmt.Errorf("序列化 Table 列表失败: %w", err)
+			}
+
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/tables' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/tables' 已注册")
+
+	// 注册 Column 列表资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/tables/{table}/columns",
+			Description: "获取指定表的列信息",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			_, cancel := context.WithTimeout(requestTracker.Root(), 15*time.Second)
+			defer cancel()
+
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+
+			// Path: /schemas/{schema}/tables/{table}/columns
+			pathSegments := strings.Split(strings.Trim(parsedURI.Path, "/"), "/")
+			if len(pathSegments) != 5 || pathSegments[0] != "schemas" || pathSegments[2] != "tables" || pathSegments[4] != "columns" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/tables/{table}/columns'", request.URI)
+			}
+			schemaName := pathSegments[1]
+			if schemaName == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 schema: %s", request.URI)
+			}
+			tableName := pathSegments[3]
+			if tableName == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 table: %s", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理 Column 列表资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("table", tableName), zap.String("uri", request.URI))
+
+			tableInfo, found := schemaManager.GetTableInfo(schemaName, tableName)
+			if !found {
+				return protocol.NewReadResourceResult(nil), nil
+			}
+
+			resultBytes, err := json.Marshal(tableInfo.Columns)
+			if err != nil {
+				return nil, fmt.Errorf("序列化 Column 列表失败: %w", err)
+			}
+
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/columns' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/columns' 已注册")
+
+	// 注册 Index 列表资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/tables/{table}/indexes",
+			Description: "获取指定表的索引信息",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			_, cancel := context.WithTimeout(requestTracker.Root(), 15*time.Second)
+			defer cancel()
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			pathSegments := strings.Split(strings.Trim(parsedURI.Path, "/"), "/")
+			if len(pathSegments) != 5 || pathSegments[0] != "schemas" || pathSegments[2] != "tables" || pathSegments[4] != "indexes" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/tables/{table}/indexes'", request.URI)
+			}
+			schemaName := pathSegments[1]
+			if schemaName == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 schema: %s", request.URI)
+			}
+			tableName := pathSegments[3]
+			if tableName == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 table: %s", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理 Index 列表资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("table", tableName), zap.String("uri", request.URI))
+			tableInfo, found := schemaManager.GetTableInfo(schemaName, tableName)
+			if !found {
+				return protocol.NewReadResourceResult(nil), nil
+			}
+			resultBytes, err := json.Marshal(tableInfo.Indexes)
+			if err != nil {
+				return nil, fmt.Errorf("序列化 Index 列表失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/indexes' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/indexes' 已注册")
+
+	// 注册 Constraint 列表资源模板 (主要返回外键)
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/tables/{table}/constraints",
+			Description: "获取指定表的外键约束信息",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			_, cancel := context.WithTimeout(requestTracker.Root(), 15*time.Second)
+			defer cancel()
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			pathSegments := strings.Split(strings.Trim(parsedURI.Path, "/"), "/")
+			if len(pathSegments) != 5 || pathSegments[0] != "schemas" || pathSegments[2] != "tables" || pathSegments[4] != "constraints" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/tables/{table}/constraints'", request.URI)
+			}
+			schemaName := pathSegments[1]
+			if schemaName == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 schema: %s", request.URI)
+			}
+			tableName := pathSegments[3]
+			if tableName == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 table: %s", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理 Constraint 列表资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("table", tableName), zap.String("uri", request.URI))
+			tableInfo, found := schemaManager.GetTableInfo(schemaName, tableName)
+			if !found {
+				return protocol.NewReadResourceResult(nil), nil
 			}
-			resultBytes, err := json.Marshal(schemaList)
+			resultBytes, err := json.Marshal(tableInfo.ForeignKeys)
 			if err != nil {
-				return nil, fmt.Errorf("序列化 Schema 列表失败: %w", err)
+				return nil, fmt.Errorf("序列化 Constraint 列表失败: %w", err)
 			}
-
 			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
 			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
 		})
 	if err != nil {
-		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas' 资源模板失败: %w", err)
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/constraints' 资源模板失败: %w", err)
 	}
-	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas' 已注册")
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/constraints' 已注册")
 
-	// 注册 Table 列表资源模板
+	// 注册 Trigger 列表资源模板
 	err = mcpServer.RegisterResourceTemplate(
 		&protocol.ResourceTemplate{
-			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/tables",
-			Description: "列出指定 Schema 下的所有表",
+			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/tables/{table}/triggers",
+			Description: "获取指定表的触发器信息 (时机, 事件, 调用函数, 启用状态)",
 		},
 		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
-			_, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			_, cancel := context.WithTimeout(requestTracker.Root(), 15*time.Second)
 			defer cancel()
-
 			parsedURI, err := url.Parse(request.URI)
 			if err != nil {
 				return nil, fmt.Errorf("无效的请求 URI: %w", err)
@@ -308,52 +2021,46 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 			if connID == "" {
 				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
 			}
-
-			// 按路径段提取 schema
-			// Path: /schemas/{schema}/tables
 			pathSegments := strings.Split(strings.Trim(parsedURI.Path, "/"), "/")
-			if len(pathSegments) != 3 || pathSegments[0] != "schemas" || pathSegments[2] != "tables" {
-				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/tables'", request.URI)
+			if len(pathSegments) != 5 || pathSegments[0] != "schemas" || pathSegments[2] != "tables" || pathSegments[4] != "triggers" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/tables/{table}/triggers'", request.URI)
 			}
 			schemaName := pathSegments[1]
 			if schemaName == "" {
 				return nil, fmt.Errorf("无法从 URI 提取 schema: %s", request.URI)
 			}
+			tableName := pathSegments[3]
+			if tableName == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 table: %s", request.URI)
+			}
 
-			utils.DefaultLogger.Info("处理 Table 列表资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("uri", request.URI))
-
-			schemaInfo, found := schemaManager.GetSchemaInfo(schemaName)
+			utils.DefaultLogger.Info("处理 Trigger 列表资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("table", tableName), zap.String("uri", request.URI))
+			tableInfo, found := schemaManager.GetTableInfo(schemaName, tableName)
 			if !found {
 				return protocol.NewReadResourceResult(nil), nil
 			}
-			// ... (Table 列表提取和序列化逻辑不变) ...
-			tableList := make([]map[string]any, 0, len(schemaInfo.Tables))
-			for _, t := range schemaInfo.Tables {
-				tableList = append(tableList, map[string]any{"name": t.Name, "description": t.Description, "row_count": t.RowCount})
-			}
-			resultBytes, err := json.Marshal(tableList)
+			resultBytes, err := json.Marshal(tableInfo.Triggers)
 			if err != nil {
-				return nil, fmt.Errorf("序列化 Table 列表失败: %w", err)
+				return nil, fmt.Errorf("序列化 Trigger 列表失败: %w", err)
 			}
-
 			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
 			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
 		})
 	if err != nil {
-		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/tables' 资源模板失败: %w", err)
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/triggers' 资源模板失败: %w", err)
 	}
-	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/tables' 已注册")
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/triggers' 已注册")
 
-	// 注册 Column 列表资源模板
+	// 注册表 DDL 资源模板
 	err = mcpServer.RegisterResourceTemplate(
 		&protocol.ResourceTemplate{
-			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/tables/{table}/columns",
-			Description: "获取指定表的列信息",
+			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/tables/{table}/ddl",
+			Description: "获取指定表重建后的 CREATE TABLE 语句 (列, 约束, 索引, 触发器, 注释)",
+			MimeType:    "application/sql",
 		},
 		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
-			_, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 15*time.Second)
 			defer cancel()
-
 			parsedURI, err := url.Parse(request.URI)
 			if err != nil {
 				return nil, fmt.Errorf("无效的请求 URI: %w", err)
@@ -362,11 +2069,9 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 			if connID == "" {
 				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
 			}
-
-			// Path: /schemas/{schema}/tables/{table}/columns
 			pathSegments := strings.Split(strings.Trim(parsedURI.Path, "/"), "/")
-			if len(pathSegments) != 5 || pathSegments[0] != "schemas" || pathSegments[2] != "tables" || pathSegments[4] != "columns" {
-				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/tables/{table}/columns'", request.URI)
+			if len(pathSegments) != 5 || pathSegments[0] != "schemas" || pathSegments[2] != "tables" || pathSegments[4] != "ddl" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/tables/{table}/ddl'", request.URI)
 			}
 			schemaName := pathSegments[1]
 			if schemaName == "" {
@@ -377,34 +2082,30 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 				return nil, fmt.Errorf("无法从 URI 提取 table: %s", request.URI)
 			}
 
-			utils.DefaultLogger.Info("处理 Column 列表资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("table", tableName), zap.String("uri", request.URI))
-
-			tableInfo, found := schemaManager.GetTableInfo(schemaName, tableName)
-			if !found {
+			utils.DefaultLogger.Info("处理表 DDL 资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("table", tableName), zap.String("uri", request.URI))
+			if _, found := schemaManager.GetTableInfo(schemaName, tableName); !found {
 				return protocol.NewReadResourceResult(nil), nil
 			}
-
-			resultBytes, err := json.Marshal(tableInfo.Columns)
+			ddl, err := schemaManager.GetTableDDL(ctx, connID, schemaName, tableName)
 			if err != nil {
-				return nil, fmt.Errorf("序列化 Column 列表失败: %w", err)
+				return nil, fmt.Errorf("生成表 DDL 失败: %w", err)
 			}
-
-			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/sql", Text: ddl}
 			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
 		})
 	if err != nil {
-		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/columns' 资源模板失败: %w", err)
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/ddl' 资源模板失败: %w", err)
 	}
-	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/columns' 已注册")
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/ddl' 已注册")
 
-	// 注册 Index 列表资源模板
+	// 注册视图列血缘资源模板
 	err = mcpServer.RegisterResourceTemplate(
 		&protocol.ResourceTemplate{
-			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/tables/{table}/indexes",
-			Description: "获取指定表的索引信息",
+			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/views/{view}/lineage",
+			Description: "获取视图各列来源的基表列 (直接来源和经过嵌套视图展开后的基表来源)，以及非直接引用列的表达式",
 		},
 		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
-			_, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			_, cancel := context.WithTimeout(requestTracker.Root(), 15*time.Second)
 			defer cancel()
 			parsedURI, err := url.Parse(request.URI)
 			if err != nil {
@@ -415,44 +2116,45 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
 			}
 			pathSegments := strings.Split(strings.Trim(parsedURI.Path, "/"), "/")
-			if len(pathSegments) != 5 || pathSegments[0] != "schemas" || pathSegments[2] != "tables" || pathSegments[4] != "indexes" {
-				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/tables/{table}/indexes'", request.URI)
+			if len(pathSegments) != 5 || pathSegments[0] != "schemas" || pathSegments[2] != "views" || pathSegments[4] != "lineage" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/views/{view}/lineage'", request.URI)
 			}
 			schemaName := pathSegments[1]
 			if schemaName == "" {
 				return nil, fmt.Errorf("无法从 URI 提取 schema: %s", request.URI)
 			}
-			tableName := pathSegments[3]
-			if tableName == "" {
-				return nil, fmt.Errorf("无法从 URI 提取 table: %s", request.URI)
+			viewName := pathSegments[3]
+			if viewName == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 view: %s", request.URI)
 			}
 
-			utils.DefaultLogger.Info("处理 Index 列表资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("table", tableName), zap.String("uri", request.URI))
-			tableInfo, found := schemaManager.GetTableInfo(schemaName, tableName)
+			utils.DefaultLogger.Info("处理视图血缘资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("view", viewName), zap.String("uri", request.URI))
+			lineage, found := schemaManager.GetViewLineage(schemaName, viewName)
 			if !found {
 				return protocol.NewReadResourceResult(nil), nil
 			}
-			resultBytes, err := json.Marshal(tableInfo.Indexes)
+			resultBytes, err := json.Marshal(lineage)
 			if err != nil {
-				return nil, fmt.Errorf("序列化 Index 列表失败: %w", err)
+				return nil, fmt.Errorf("序列化视图血缘失败: %w", err)
 			}
 			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
 			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
 		})
 	if err != nil {
-		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/indexes' 资源模板失败: %w", err)
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/views/{view}/lineage' 资源模板失败: %w", err)
 	}
-	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/indexes' 已注册")
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/views/{view}/lineage' 已注册")
 
-	// 注册 Constraint 列表资源模板 (主要返回外键)
+	// 注册自定义类型资源模板
 	err = mcpServer.RegisterResourceTemplate(
 		&protocol.ResourceTemplate{
-			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/tables/{table}/constraints",
-			Description: "获取指定表的外键约束信息",
+			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/types",
+			Description: "获取指定 Schema 下的自定义类型 (枚举及其合法取值, 复合类型, 域)",
 		},
 		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
-			_, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			_, cancel := context.WithTimeout(requestTracker.Root(), 15*time.Second)
 			defer cancel()
+
 			parsedURI, err := url.Parse(request.URI)
 			if err != nil {
 				return nil, fmt.Errorf("无效的请求 URI: %w", err)
@@ -461,35 +2163,39 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 			if connID == "" {
 				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
 			}
+
+			// Path: /schemas/{schema}/types
 			pathSegments := strings.Split(strings.Trim(parsedURI.Path, "/"), "/")
-			if len(pathSegments) != 5 || pathSegments[0] != "schemas" || pathSegments[2] != "tables" || pathSegments[4] != "constraints" {
-				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/tables/{table}/constraints'", request.URI)
+			if len(pathSegments) != 3 || pathSegments[0] != "schemas" || pathSegments[2] != "types" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/types'", request.URI)
 			}
 			schemaName := pathSegments[1]
 			if schemaName == "" {
 				return nil, fmt.Errorf("无法从 URI 提取 schema: %s", request.URI)
 			}
-			tableName := pathSegments[3]
-			if tableName == "" {
-				return nil, fmt.Errorf("无法从 URI 提取 table: %s", request.URI)
-			}
 
-			utils.DefaultLogger.Info("处理 Constraint 列表资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("table", tableName), zap.String("uri", request.URI))
-			tableInfo, found := schemaManager.GetTableInfo(schemaName, tableName)
+			utils.DefaultLogger.Info("处理自定义类型资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("uri", request.URI))
+
+			schemaInfo, found := schemaManager.GetSchemaInfo(schemaName)
 			if !found {
 				return protocol.NewReadResourceResult(nil), nil
 			}
-			resultBytes, err := json.Marshal(tableInfo.ForeignKeys)
+			types := schemaInfo.Types
+			if types == nil {
+				types = []schemas.TypeInfo{}
+			}
+			resultBytes, err := json.Marshal(types)
 			if err != nil {
-				return nil, fmt.Errorf("序列化 Constraint 列表失败: %w", err)
+				return nil, fmt.Errorf("序列化自定义类型信息失败: %w", err)
 			}
+
 			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
 			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
 		})
 	if err != nil {
-		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/constraints' 资源模板失败: %w", err)
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/types' 资源模板失败: %w", err)
 	}
-	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/constraints' 已注册")
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/types' 已注册")
 
 	// 注册 Extension 列表资源模板
 	err = mcpServer.RegisterResourceTemplate(
@@ -498,7 +2204,7 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 			Description: "列出数据库中实际安装的扩展及其版本",
 		},
 		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 10*time.Second)
 			defer cancel()
 			parsedURI, err := url.Parse(request.URI)
 			if err != nil {
@@ -524,8 +2230,9 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 			resultList := make([]map[string]any, 0, len(installedExts))
 			for _, ext := range installedExts {
 				extName, _ := ext["name"].(string)
-				_, knowledgeFound := extManager.GetExtensionKnowledge(extName)
+				knowledge, knowledgeFound := knowledgeForExtension(extManager, extName)
 				ext["knowledge_available"] = knowledgeFound
+				ext["example_count"] = len(knowledge.Examples)
 				resultList = append(resultList, ext)
 			}
 			resultBytes, err := json.Marshal(resultList)
@@ -554,7 +2261,7 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 			}
 			// connID := parsedURI.Host // 可能不需要 connID
 			pathSegments := strings.Split(strings.Trim(parsedURI.Path, "/"), "/")
-			if len(pathSegments) != 5 || pathSegments[0] != "schemas" || pathSegments[2] != "extensions" {
+			if len(pathSegments) != 4 || pathSegments[0] != "schemas" || pathSegments[2] != "extensions" {
 				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/extensions/{extension}'", request.URI)
 			}
 			// schemaHint := pathSegments[1]
@@ -580,6 +2287,58 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 	}
 	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/extensions/{extension}' 已注册")
 
+	// 注册扩展示例查询资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/extensions/{extension}/examples",
+			Description: "获取指定扩展知识中的示例查询 (说明、SQL 和预期结果形状) 以及该扩展是否已安装 (JSON)",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 10*time.Second)
+			defer cancel()
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			pathSegments := strings.Split(strings.Trim(parsedURI.Path, "/"), "/")
+			if len(pathSegments) != 5 || pathSegments[0] != "schemas" || pathSegments[2] != "extensions" || pathSegments[4] != "examples" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/extensions/{extension}/examples'", request.URI)
+			}
+			knowledgeName := pathSegments[3]
+
+			knowledge, found := extManager.GetExtensionKnowledge(knowledgeName)
+			if !found {
+				return protocol.NewReadResourceResult(nil), nil
+			}
+			examples := knowledge.Examples
+			if examples == nil {
+				examples = []extensions.QueryExample{}
+			}
+			extensionName := knowledge.ExtensionName(knowledgeName)
+			result := map[string]any{"extension": extensionName, "examples": examples}
+			// 特性检测失败时不返回 installed，由客户端自行判断
+			if features, err := schemaManager.GetFeatures(ctx, connID); err == nil {
+				_, installed := features.Extensions[extensionName]
+				result["installed"] = installed
+			} else {
+				utils.DefaultLogger.Debug("检测扩展是否安装失败", zap.String("connID", connID), zap.String("extension", extensionName), zap.Error(err))
+			}
+			resultBytes, err := json.Marshal(result)
+			if err != nil {
+				return nil, fmt.Errorf("序列化示例查询失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/extensions/{extension}/examples' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/extensions/{extension}/examples' 已注册")
+
 	// 注册获取表样本数据的资源模板
 	err = mcpServer.RegisterResourceTemplate(
 		&protocol.ResourceTemplate{
@@ -587,7 +2346,7 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 			Description: "获取指定表的前 N 行样本数据 (?limit=N)",
 		},
 		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 30*time.Second)
 			defer cancel()
 			parsedURI, err := url.Parse(request.URI)
 			if err != nil {
@@ -620,14 +2379,17 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 			}
 
 			utils.DefaultLogger.Info("处理表样本数据资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("table", tableName), zap.Int("limit", limit), zap.String("uri", request.URI))
-			safeSchema := utils.QuoteIdentifier(schemaName)
-			safeTable := utils.QuoteIdentifier(tableName)
-			query := fmt.Sprintf("SELECT * FROM %s.%s LIMIT $1", safeSchema, safeTable)
-			results, err := dbService.ExecuteQuery(ctx, connID, true, query, limit)
+			qualifiedTable, err := sqlsafe.QuoteQualified(schemaName, tableName)
+			if err != nil {
+				return nil, fmt.Errorf("无效的 schema 或 table 名称: %w", err)
+			}
+			query := fmt.Sprintf("SELECT * FROM %s LIMIT $1", qualifiedTable)
+			sampleRows, err := dbService.ExecuteQuery(ctx, connID, true, query, limit)
 			if err != nil {
 				return nil, fmt.Errorf("执行样本数据查询失败: %w", err)
 			}
-			resultBytes, err := json.Marshal(results)
+			masker.MaskTableRows(schemaName, tableName, sampleRows)
+			resultBytes, err := json.Marshal(results.NormalizeRows(sampleRows))
 			if err != nil {
 				return nil, fmt.Errorf("序列化样本数据失败: %w", err)
 			}
@@ -646,7 +2408,7 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 			Description: "获取指定表的大致行数",
 		},
 		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 10*time.Second)
 			defer cancel()
 			parsedURI, err := url.Parse(request.URI)
 			if err != nil {
@@ -669,6 +2431,10 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 				return nil, fmt.Errorf("无法从 URI 提取 table: %s", request.URI)
 			}
 
+			if _, err := sqlsafe.QuoteQualified(schemaName, tableName); err != nil {
+				return nil, fmt.Errorf("无效的 schema 或 table 名称: %w", err)
+			}
+
 			utils.DefaultLogger.Info("处理表行数资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("table", tableName), zap.String("uri", request.URI))
 			query := `SELECT reltuples::bigint AS approximate_row_count FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind = 'r'`
 			results, err := dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tableName)
@@ -694,6 +2460,295 @@ func RegisterHandlers(mcpServer *server.Server, dbService databases.Service, sch
 	}
 	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/rowcount' 已注册")
 
+	// 注册列统计信息资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/schemas/{schema}/tables/{table}/columns/{column}/stats",
+			Description: "获取指定列的 pg_stats 统计信息 (空值比例, 不同值数量, 高频值, 直方图边界)，用于估算选择性而无需执行 COUNT 查询",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 10*time.Second)
+			defer cancel()
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			pathSegments := strings.Split(strings.Trim(parsedURI.Path, "/"), "/")
+			if len(pathSegments) != 7 || pathSegments[0] != "schemas" || pathSegments[2] != "tables" || pathSegments[4] != "columns" || pathSegments[6] != "stats" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/schemas/{schema}/tables/{table}/columns/{column}/stats'", request.URI)
+			}
+			schemaName := pathSegments[1]
+			if schemaName == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 schema: %s", request.URI)
+			}
+			tableName := pathSegments[3]
+			if tableName == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 table: %s", request.URI)
+			}
+			columnName := pathSegments[5]
+			if columnName == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 column: %s", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理列统计信息资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("table", tableName), zap.String("column", columnName), zap.String("uri", request.URI))
+			// anyarray 列无法直接解码，统一转换为 text[]; 继承表统计 (inherited = true) 排在后面
+			query := `
+                SELECT null_frac, avg_width, n_distinct, correlation,
+                       most_common_vals::text::text[] AS most_common_vals,
+                       most_common_freqs,
+                       histogram_bounds::text::text[] AS histogram_bounds,
+                       inherited
+                FROM pg_stats
+                WHERE schemaname = $1 AND tablename = $2 AND attname = $3
+                ORDER BY inherited
+                LIMIT 1`
+			results, err := dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tableName, columnName)
+			if err != nil {
+				return nil, fmt.Errorf("执行列统计信息查询失败: %w", err)
+			}
+			var resultData map[string]any
+			if len(results) > 0 {
+				resultData = results[0]
+				resultData["analyzed"] = true
+			} else {
+				tableInfo, found := schemaManager.GetTableInfo(schemaName, tableName)
+				if !found {
+					return protocol.NewReadResourceResult(nil), nil
+				}
+				columnFound := false
+				for _, col := range tableInfo.Columns {
+					if col.Name == columnName {
+						columnFound = true
+						break
+					}
+				}
+				if !columnFound {
+					return protocol.NewReadResourceResult(nil), nil
+				}
+				// 列存在但没有统计信息: 表尚未 ANALYZE
+				resultData = map[string]any{"analyzed": false, "message": "该列暂无统计信息，表可能尚未执行 ANALYZE"}
+			}
+			resultBytes, err := json.Marshal(resultData)
+			if err != nil {
+				return nil, fmt.Errorf("序列化列统计信息失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/columns/{column}/stats' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/schemas/{schema}/tables/{table}/columns/{column}/stats' 已注册")
+
+	// 注册会话活动资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/activity/sessions",
+			Description: "列出当前数据库的后端会话 (pg_stat_activity): 状态, 等待事件, 事务/查询开始时间, 阻塞它的 PID 以及查询文本",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 10*time.Second)
+			defer cancel()
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			if strings.Trim(parsedURI.Path, "/") != "activity/sessions" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/activity/sessions'", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理会话活动资源请求", zap.String("connID", connID), zap.String("uri", request.URI))
+			// 排除本次查询自身的会话；没有 pg_read_all_stats 权限时，其他角色会话的 query 显示为 <insufficient privilege>
+			query := `
+                SELECT pid, usename AS user_name, application_name, client_addr::text AS client_addr,
+                       backend_type, state, wait_event_type, wait_event,
+                       backend_start, xact_start, query_start, state_change,
+                       (extract(epoch FROM now() - xact_start) * 1000)::bigint AS xact_duration_ms,
+                       (extract(epoch FROM now() - query_start) * 1000)::bigint AS query_duration_ms,
+                       pg_blocking_pids(pid) AS blocked_by,
+                       left(query, 2000) AS query
+                FROM pg_stat_activity
+                WHERE datname = current_database() AND pid <> pg_backend_pid()
+                ORDER BY state = 'idle', xact_start NULLS LAST, pid`
+			results, err := dbService.ExecuteQuery(ctx, connID, true, query)
+			if err != nil {
+				return nil, fmt.Errorf("查询会话活动失败: %w", err)
+			}
+			if results == nil {
+				results = []map[string]any{}
+			}
+			resultBytes, err := json.Marshal(map[string]any{"sessions": results})
+			if err != nil {
+				return nil, fmt.Errorf("序列化会话活动失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/activity/sessions' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/activity/sessions' 已注册")
+
+	// 注册锁等待资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/activity/locks",
+			Description: "列出当前数据库的锁等待关系 (被阻塞 PID -> 阻塞者 PID, 等待的锁, 等待时长, 双方查询文本) 以及按模式汇总的锁数量",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 10*time.Second)
+			defer cancel()
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			if strings.Trim(parsedURI.Path, "/") != "activity/locks" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/activity/locks'", request.URI)
+			}
+
+			utils.DefaultLogger.Info("处理锁等待资源请求", zap.String("connID", connID), zap.String("uri", request.URI))
+			// pg_blocking_pids 同时考虑了锁队列中排在前面的等待者，比直接自连接 pg_locks 更准确
+			waitsQuery := `
+                SELECT blocked.pid AS blocked_pid,
+                       blocked.usename AS blocked_user,
+                       blocked.wait_event_type, blocked.wait_event,
+                       (extract(epoch FROM now() - blocked.query_start) * 1000)::bigint AS waiting_ms,
+                       (SELECT string_agg(DISTINCT l.locktype || coalesce(' ' || l.relation::regclass::text, '') || ' ' || l.mode, ', ')
+                        FROM pg_locks l WHERE l.pid = blocked.pid AND NOT l.granted) AS waiting_for,
+                       left(blocked.query, 2000) AS blocked_query,
+                       blocking.pid AS blocking_pid,
+                       blocking.usename AS blocking_user,
+                       blocking.state AS blocking_state,
+                       (extract(epoch FROM now() - blocking.xact_start) * 1000)::bigint AS blocking_xact_duration_ms,
+                       left(blocking.query, 2000) AS blocking_query
+                FROM pg_stat_activity blocked
+                CROSS JOIN LATERAL unnest(pg_blocking_pids(blocked.pid)) AS b(pid)
+                JOIN pg_stat_activity blocking ON blocking.pid = b.pid
+                WHERE blocked.datname = current_database()
+                ORDER BY waiting_ms DESC NULLS LAST, blocked.pid, blocking.pid`
+			waits, err := dbService.ExecuteQuery(ctx, connID, true, waitsQuery)
+			if err != nil {
+				return nil, fmt.Errorf("查询锁等待失败: %w", err)
+			}
+			summaryQuery := `
+                SELECT locktype, mode, granted, count(*) AS count
+                FROM pg_locks
+                WHERE database = (SELECT oid FROM pg_database WHERE datname = current_database()) OR database IS NULL
+                GROUP BY locktype, mode, granted
+                ORDER BY granted, count DESC`
+			summary, err := dbService.ExecuteQuery(ctx, connID, true, summaryQuery)
+			if err != nil {
+				return nil, fmt.Errorf("查询锁汇总失败: %w", err)
+			}
+			if waits == nil {
+				waits = []map[string]any{}
+			}
+			resultBytes, err := json.Marshal(map[string]any{
+				"lock_waits":   waits,
+				"lock_summary": summary,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("序列化锁等待信息失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/activity/locks' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/activity/locks' 已注册")
+
+	// 注册空间占用资源模板
+	err = mcpServer.RegisterResourceTemplate(
+		&protocol.ResourceTemplate{
+			URITemplate: "pgmcp://{conn_id}/stats/sizes{?schema,limit}",
+			Description: "获取数据库总大小、按大小排序的表 (含索引和 TOAST) 与索引，以及表膨胀估算，用于回答空间占用问题。?schema=xxx 只包含指定 Schema，?limit=N 限制每个列表的条数 (默认 50)",
+		},
+		func(request *protocol.ReadResourceRequest) (*protocol.ReadResourceResult, error) {
+			ctx, cancel := context.WithTimeout(requestTracker.Root(), 30*time.Second)
+			defer cancel()
+			parsedURI, err := url.Parse(request.URI)
+			if err != nil {
+				return nil, fmt.Errorf("无效的请求 URI: %w", err)
+			}
+			connID := parsedURI.Host
+			if connID == "" {
+				return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", request.URI)
+			}
+			if strings.Trim(parsedURI.Path, "/") != "stats/sizes" {
+				return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/stats/sizes'", request.URI)
+			}
+			limit := 0
+			if limitStr := parsedURI.Query().Get("limit"); limitStr != "" {
+				limit, err = strconv.Atoi(limitStr)
+				if err != nil || limit <= 0 {
+					return nil, fmt.Errorf("无效的 limit 参数: '%s'", limitStr)
+				}
+			}
+			schemaName := parsedURI.Query().Get("schema")
+
+			utils.DefaultLogger.Info("处理空间占用资源请求", zap.String("connID", connID), zap.String("schema", schemaName), zap.String("uri", request.URI))
+			report, err := tools.SizeReport(ctx, dbService, connID, schemaName, limit)
+			if err != nil {
+				return nil, err
+			}
+			resultBytes, err := json.Marshal(report)
+			if err != nil {
+				return nil, fmt.Errorf("序列化空间占用报告失败: %w", err)
+			}
+			textContent := protocol.TextResourceContents{URI: request.URI, MimeType: "application/json", Text: string(resultBytes)}
+			return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+		})
+	if err != nil {
+		return fmt.Errorf("注册 'pgmcp://{conn_id}/stats/sizes' 资源模板失败: %w", err)
+	}
+	utils.DefaultLogger.Info("Resource Template 'pgmcp://{conn_id}/stats/sizes' 已注册")
+
+	// --- 注册工具包 (YAML) 中定义的工具，放在最后以便检查与内置工具重名 ---
+	packs, err := toolpacks.Load(cfg.ToolPacksDir)
+	if err != nil {
+		return fmt.Errorf("加载工具包失败: %w", err)
+	}
+	toolPackHandler := tools.NewToolPackHandler(dbService, masker, idempotencyStore, reviewQueue)
+	for _, pack := range packs {
+		for _, def := range pack.Tools {
+			if toolRegistry.Has(def.Name) {
+				return fmt.Errorf("工具包 '%s' 中的工具 '%s' 与已注册的工具重名", pack.Name, def.Name)
+			}
+			packTool, err := tools.PackTool(def)
+			if err != nil {
+				return fmt.Errorf("工具包 '%s': %w", pack.Name, err)
+			}
+			toolRegistry.RegisterTool(packTool, func(request *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+				ctx, cancel := context.WithTimeout(requestTracker.Context(request), def.ExecTimeout())
+				defer cancel()
+				return toolPackHandler.HandlePackTool(ctx, def, request)
+			})
+			utils.DefaultLogger.Info("工具包中的 Tool 已注册", zap.String("pack", pack.Name), zap.String("tool", def.Name), zap.Bool("readOnly", def.IsReadOnly()))
+		}
+	}
+
+	// --- 注册编译进服务器的插件 (pkg/plugin) ---
+	host := plugin.NewHost(mcpServer, toolRegistry, requestTracker, cfg, dbService, schemaManager, extManager)
+	for _, p := range append(plugin.Plugins(), extraPlugins...) {
+		if err := p.Register(host.ForPlugin(p.Name())); err != nil {
+			return fmt.Errorf("注册插件 '%s' 失败: %w", p.Name(), err)
+		}
+		utils.DefaultLogger.Info("插件已注册", zap.String("plugin", p.Name()))
+	}
+
 	utils.DefaultLogger.Info("所有 MCP Handlers 注册完成。")
 	return nil
 }
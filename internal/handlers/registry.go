@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/server"
+)
+
+// toolRegistry 记录已注册的工具名。
+// go-mcp 注册同名工具时会静默覆盖，工具包等外部定义的工具需要先检查名称是否已被占用。
+type toolRegistry struct {
+	server *server.Server
+	names  map[string]bool
+}
+
+func newToolRegistry(mcpServer *server.Server) *toolRegistry {
+	return &toolRegistry{server: mcpServer, names: make(map[string]bool)}
+}
+
+// RegisterTool 注册工具并记录名称
+func (r *toolRegistry) RegisterTool(tool *protocol.Tool, handler server.ToolHandlerFunc) {
+	r.names[tool.Name] = true
+	r.server.RegisterTool(tool, handler)
+}
+
+// Has 判断工具名是否已被注册
+func (r *toolRegistry) Has(name string) bool {
+	return r.names[name]
+}
@@ -0,0 +1,243 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	coreschema "github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+const (
+	maxContextTables      = 20 // 一次请求最多包含的表数
+	maxContextSampleLimit = 50 // 每张表样本行数的上限
+	contextCommonValues   = 5  // 每列最多返回的高频值个数
+)
+
+// ContextBundle 是编写 SQL 前需要的表上下文: 表定义、外键关系、样本数据和列统计
+type ContextBundle struct {
+	Tables        []TableContext         `json:"tables"`
+	Relationships []coreschema.GraphEdge `json:"relationships"`     // 涉及所请求表的外键 (含 JOIN 条件)
+	Missing       []string               `json:"missing,omitempty"` // 未找到的表
+	Warnings      []string               `json:"warnings,omitempty"`
+}
+
+// TableContext 是一张表的上下文
+type TableContext struct {
+	Schema      string                      `json:"schema"`
+	Name        string                      `json:"name"`
+	Description string                      `json:"description,omitempty"`
+	RowCount    int64                       `json:"row_count"`
+	Columns     []coreschema.ColumnInfo     `json:"columns"`
+	Indexes     []coreschema.IndexInfo      `json:"indexes,omitempty"`
+	ForeignKeys []coreschema.ForeignKeyInfo `json:"foreign_keys,omitempty"`
+	SampleRows  []map[string]any            `json:"sample_rows"`
+	ColumnStats map[string]*ColumnStats     `json:"column_stats,omitempty"` // 列名 -> pg_stats 摘要 (表未 ANALYZE 时为空)
+}
+
+// ColumnStats 是 pg_stats 中对编写查询有用的部分
+type ColumnStats struct {
+	NullFrac       float64  `json:"null_frac"`
+	NDistinct      float64  `json:"n_distinct"` // 负数表示不同值数量占行数的比例
+	MostCommonVals []string `json:"most_common_vals,omitempty"`
+}
+
+// ContextBundleHandler 处理 pgmcp://{conn_id}/context 资源请求。
+type ContextBundleHandler struct {
+	dbService     databases.Service
+	schemaManager coreschema.Manager
+	masker        *masking.Masker
+}
+
+// NewContextBundleHandler 创建一个新的 ContextBundleHandler。
+func NewContextBundleHandler(dbService databases.Service, schemaManager coreschema.Manager, masker *masking.Masker) *ContextBundleHandler {
+	return &ContextBundleHandler{dbService: dbService, schemaManager: schemaManager, masker: masker}
+}
+
+// HandleContextBundle 处理 pgmcp://{conn_id}/context?tables=a,b[&sample=N] 请求。
+// 表名可以写成 schema.table 或 table (在所有 Schema 中查找，重名时需要指定 Schema)。
+func (h *ContextBundleHandler) HandleContextBundle(ctx context.Context, uri *url.URL) (*protocol.ReadResourceResult, error) {
+	connID := uri.Host
+	if connID == "" {
+		return nil, fmt.Errorf("无法从 URI 提取 conn_id: %s", uri.String())
+	}
+	if strings.Trim(uri.Path, "/") != "context" {
+		return nil, fmt.Errorf("URI '%s' 路径格式不匹配 '/context'", uri.String())
+	}
+	var names []string
+	for _, name := range strings.Split(uri.Query().Get("tables"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("缺少 'tables' 参数，例如 ?tables=public.orders,customers")
+	}
+	if len(names) > maxContextTables {
+		return nil, fmt.Errorf("一次最多请求 %d 张表", maxContextTables)
+	}
+	sampleLimit := 3
+	if value := uri.Query().Get("sample"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("无效的 sample 参数: '%s'", value)
+		}
+		sampleLimit = min(parsed, maxContextSampleLimit)
+	}
+
+	utils.DefaultLogger.Info("处理表上下文资源请求", zap.String("connID", connID), zap.Strings("tables", names), zap.Int("sample", sampleLimit))
+	bundle, err := h.Build(ctx, connID, names, sampleLimit)
+	if err != nil {
+		return nil, err
+	}
+	resultBytes, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("序列化表上下文失败: %w", err)
+	}
+	textContent := protocol.TextResourceContents{URI: uri.String(), MimeType: "application/json", Text: string(resultBytes)}
+	return protocol.NewReadResourceResult([]protocol.ResourceContents{textContent}), nil
+}
+
+// Build 组装所请求表的上下文。单张表的样本或统计查询失败时记录警告并继续。
+func (h *ContextBundleHandler) Build(ctx context.Context, connID string, names []string, sampleLimit int) (*ContextBundle, error) {
+	dbInfo, found := h.schemaManager.GetDatabaseInfo()
+	if !found {
+		return nil, fmt.Errorf("Schema 信息尚未加载")
+	}
+	bundle := &ContextBundle{Tables: []TableContext{}, Relationships: []coreschema.GraphEdge{}}
+	requested := make(map[string]bool)
+	for _, name := range names {
+		schemaName, table, err := resolveTable(dbInfo, name)
+		if err != nil {
+			bundle.Missing = append(bundle.Missing, name)
+			bundle.Warnings = append(bundle.Warnings, err.Error())
+			continue
+		}
+		id := schemaName + "." + table.Name
+		if requested[id] {
+			continue
+		}
+		requested[id] = true
+
+		tableContext := TableContext{
+			Schema:      schemaName,
+			Name:        table.Name,
+			Description: table.Description,
+			RowCount:    table.RowCount,
+			Columns:     table.Columns,
+			Indexes:     table.Indexes,
+			ForeignKeys: table.ForeignKeys,
+			SampleRows:  []map[string]any{},
+		}
+		if sampleLimit > 0 {
+			var rows []map[string]any
+			qualifiedTable, err := sqlsafe.QuoteQualified(schemaName, table.Name)
+			if err == nil {
+				rows, err = h.dbService.ExecuteQuery(ctx, connID, true, fmt.Sprintf("SELECT * FROM %s LIMIT $1", qualifiedTable), sampleLimit)
+			}
+			if err != nil {
+				bundle.Warnings = append(bundle.Warnings, fmt.Sprintf("获取 %s 的样本数据失败: %v", id, err))
+			} else {
+				h.masker.MaskTableRows(schemaName, table.Name, rows)
+				tableContext.SampleRows = rows
+			}
+		}
+		stats, err := h.columnStats(ctx, connID, schemaName, table.Name)
+		if err != nil {
+			bundle.Warnings = append(bundle.Warnings, fmt.Sprintf("获取 %s 的列统计信息失败: %v", id, err))
+		} else if len(stats) > 0 {
+			for column, columnStats := range stats {
+				// 脱敏列的高频值同样是真实数据，不返回
+				if h.masker.ModeFor(schemaName, table.Name, column) != "" {
+					columnStats.MostCommonVals = nil
+				}
+			}
+			tableContext.ColumnStats = stats
+		}
+		bundle.Tables = append(bundle.Tables, tableContext)
+	}
+
+	for _, edge := range coreschema.BuildRelationshipGraph(dbInfo, "").Edges {
+		if requested[edge.From] || requested[edge.To] {
+			bundle.Relationships = append(bundle.Relationships, edge)
+		}
+	}
+	return bundle, nil
+}
+
+// columnStats 查询一张表所有列的 pg_stats 摘要
+func (h *ContextBundleHandler) columnStats(ctx context.Context, connID, schemaName, tableName string) (map[string]*ColumnStats, error) {
+	query := `
+        SELECT DISTINCT ON (attname) attname, null_frac, n_distinct,
+               (most_common_vals::text::text[])[1:$3] AS most_common_vals
+        FROM pg_stats
+        WHERE schemaname = $1 AND tablename = $2
+        ORDER BY attname, inherited`
+	rows, err := h.dbService.ExecuteQuery(ctx, connID, true, query, schemaName, tableName, contextCommonValues)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]*ColumnStats, len(rows))
+	for _, row := range rows {
+		column, _ := row["attname"].(string)
+		columnStats := &ColumnStats{NullFrac: statFloat(row["null_frac"]), NDistinct: statFloat(row["n_distinct"])}
+		if values, ok := row["most_common_vals"].([]any); ok {
+			for _, value := range values {
+				if text, ok := value.(string); ok {
+					columnStats.MostCommonVals = append(columnStats.MostCommonVals, text)
+				}
+			}
+		}
+		stats[column] = columnStats
+	}
+	return stats, nil
+}
+
+// statFloat 转换 pg_stats 中的 real 列 (pgx 解码为 float32)
+func statFloat(value any) float64 {
+	switch v := value.(type) {
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// resolveTable 在缓存中查找表，name 为 schema.table 或 table
+func resolveTable(dbInfo *coreschema.DatabaseInfo, name string) (string, *coreschema.TableInfo, error) {
+	schemaName, tableName, qualified := strings.Cut(name, ".")
+	if !qualified {
+		tableName, schemaName = schemaName, ""
+	}
+	var matchSchema string
+	var match *coreschema.TableInfo
+	for i := range dbInfo.Schemas {
+		schema := &dbInfo.Schemas[i]
+		if schemaName != "" && schema.Name != schemaName {
+			continue
+		}
+		for j := range schema.Tables {
+			if schema.Tables[j].Name != tableName {
+				continue
+			}
+			if match != nil {
+				return "", nil, fmt.Errorf("表 '%s' 在多个 Schema 中存在 (%s, %s)，请使用 schema.table", name, matchSchema, schema.Name)
+			}
+			matchSchema, match = schema.Name, &schema.Tables[j]
+		}
+	}
+	if match == nil {
+		return "", nil, fmt.Errorf("未找到表 '%s'", name)
+	}
+	return matchSchema, match, nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/ThinkInAIXYZ/go-mcp/protocol"
 	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
 	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
 	"go.uber.org/zap"
 )
 
@@ -52,18 +53,17 @@ func (h *DataHandler) HandleSampleData(ctx context.Context, uri *url.URL, params
 		}
 	}
 
-	// 安全地引用标识符
-	safeSchema := utils.QuoteIdentifier(schemaName)
-	safeTable := utils.QuoteIdentifier(tableName)
-	if safeSchema == "" || safeTable == "" {
-		utils.DefaultLogger.Error("无效的 schema 或 table 名称", zap.String("schema", schemaName), zap.String("table", tableName))
-		return nil, fmt.Errorf("无效的 schema 或 table 名称")
+	// 校验并安全地引用标识符
+	qualifiedTable, err := sqlsafe.QuoteQualified(schemaName, tableName)
+	if err != nil {
+		utils.DefaultLogger.Error("无效的 schema 或 table 名称", zap.String("schema", schemaName), zap.String("table", tableName), zap.Error(err))
+		return nil, fmt.Errorf("无效的 schema 或 table 名称: %w", err)
 	}
 
 	// 构造查询语句
 	// 注意：SELECT * 可能返回大量列或不受支持的类型。更健壮的方式是先获取列名。
 	// 但为了简单起见，先用 SELECT *。
-	query := fmt.Sprintf("SELECT * FROM %s.%s LIMIT $1", safeSchema, safeTable)
+	query := fmt.Sprintf("SELECT * FROM %s LIMIT $1", qualifiedTable)
 	utils.DefaultLogger.Debug("执行样本数据查询", zap.String("connID", connID), zap.String("query", query), zap.Int("limit", limit))
 
 	// 执行查询 (只读)
@@ -103,6 +103,11 @@ func (h *DataHandler) HandleRowCount(ctx context.Context, uri *url.URL, params m
 		zap.String("uri", uri.String()),
 	)
 
+	// 名称通过参数传递，这里只拒绝不可能存在的名称 (空、超长或含 NUL)
+	if _, err := sqlsafe.QuoteQualified(schemaName, tableName); err != nil {
+		return nil, fmt.Errorf("无效的 schema 或 table 名称: %w", err)
+	}
+
 	// 使用之前 Schema Manager 加载时用的查询（从 pg_class 获取大致行数）
 	query := `
         SELECT reltuples::bigint AS approximate_row_count
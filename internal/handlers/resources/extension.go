@@ -96,7 +96,7 @@ func (h *ExtensionHandler) HandleGetExtensionKnowledge(ctx context.Context, uri
 		return &protocol.ReadResourceResult{Contents: []protocol.ResourceContents{}}, nil
 	}
 
-	// 将缓存的 map[string]any 序列化回 JSON 字符串
+	// 将缓存的知识数据序列化为 JSON 字符串
 	// 注意：这里返回的是 JSON 格式，即使原始文件是 YAML。如果需要原始 YAML，需要额外存储或处理。
 	resultBytes, err := json.MarshalIndent(knowledgeData, "", "  ") // 使用缩进美化输出
 	if err != nil {
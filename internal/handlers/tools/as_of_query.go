@@ -0,0 +1,333 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAsOfQueryLimit = 100  // 未提供 query 时的默认返回行数
+	maxAsOfQueryLimit     = 1000 // 返回行数上限
+)
+
+// AsOfQueryTool 是 'as_of_query' 工具的定义。
+var AsOfQueryTool = &protocol.Tool{
+	Name:        "as_of_query",
+	Description: "查询时态表/历史表在指定时间点的数据，可将已有 SELECT 中的表引用改写为该时间点的行集合",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"conn_id": {Type: protocol.String, Description: "目标数据库的连接 ID"},
+			"schema":  {Type: protocol.String, Description: "时态表所在的 Schema"},
+			"table":   {Type: protocol.String, Description: "时态表名 (当前表或带有效期列的表)"},
+			"as_of":   {Type: protocol.String, Description: "历史时间点，例如 2024-01-01T00:00:00Z"},
+			"query":   {Type: protocol.String, Description: "(可选) 引用该表的 SELECT 语句，表引用会被改写为该时间点的行集合"},
+			"params": {
+				Type:        protocol.Array,
+				Description: "(可选) query 中 $1, $2... 占位符的参数值；时间点参数编号排在这些占位符之后",
+				Items:       &protocol.Property{Type: protocol.String, Description: "单个参数 (Schema 定义为 string，但接受任意 JSON 类型)"},
+			},
+			"select": {
+				Type:        protocol.Array,
+				Description: "(可选) 未提供 query 时需要返回的列，默认全部",
+				Items:       &protocol.Property{Type: protocol.String},
+			},
+			"limit":   {Type: protocol.Integer, Description: "(可选) 未提供 query 时的返回行数，默认 100，最大 1000"},
+			"dry_run": {Type: protocol.Boolean, Description: "(可选) 只返回改写后的 SQL，不执行"},
+		},
+		Required: []string{"conn_id", "schema", "table", "as_of"},
+	},
+}
+
+// AsOfQueryToolArgs 是 'as_of_query' 工具的输入参数。
+// 工具 Schema 手动定义 (params 接受任意 JSON 类型)，参数用 json.Unmarshal 解析。
+type AsOfQueryToolArgs struct {
+	ConnID string   `json:"conn_id"`
+	Schema string   `json:"schema"`
+	Table  string   `json:"table"`
+	AsOf   string   `json:"as_of"`
+	Query  string   `json:"query,omitempty"`
+	Params []any    `json:"params,omitempty"`
+	Select []string `json:"select,omitempty"`
+	Limit  int      `json:"limit,omitempty"`
+	DryRun bool     `json:"dry_run,omitempty"`
+}
+
+// AsOfQueryHandler 根据 Schema 加载时识别出的时态表模式构造 as-of 查询。
+type AsOfQueryHandler struct {
+	dbService     databases.Service
+	schemaManager schemas.Manager
+	masker        *masking.Masker
+}
+
+// NewAsOfQueryHandler 创建一个新的 AsOfQueryHandler。
+func NewAsOfQueryHandler(dbService databases.Service, schemaManager schemas.Manager, masker *masking.Masker) *AsOfQueryHandler {
+	return &AsOfQueryHandler{dbService: dbService, schemaManager: schemaManager, masker: masker}
+}
+
+// HandleAsOfQuery 处理 'as_of_query' 工具的调用请求。
+func (h *AsOfQueryHandler) HandleAsOfQuery(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	utils.DefaultLogger.Info("收到 'as_of_query' 工具调用请求")
+
+	args := new(AsOfQueryToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Schema == "" || args.Table == "" || args.AsOf == "" {
+		return nil, fmt.Errorf("缺少 'conn_id', 'schema', 'table' 或 'as_of' 参数")
+	}
+
+	tableInfo, found := h.schemaManager.GetTableInfo(args.Schema, args.Table)
+	if !found {
+		return newErrorResult(fmt.Sprintf("表 '%s.%s' 不在 Schema 缓存中", args.Schema, args.Table), nil), nil
+	}
+	// 仅被标记为历史表 (且无有效期列) 的表没有可用的时间范围信息
+	if tableInfo.Temporal == nil || (tableInfo.Temporal.Pattern == schemas.TemporalHistoryTable && tableInfo.Temporal.HistoryTable == "") {
+		return newErrorResult(fmt.Sprintf("表 '%s.%s' 未识别到时态表模式 (有效期列或历史表)", args.Schema, args.Table), nil), nil
+	}
+
+	var query string
+	var params []any
+	if strings.TrimSpace(args.Query) != "" {
+		// 时间点参数排在 query 自身的占位符之后，避免与用户的 $1, $2... 冲突
+		placeholders := maxPlaceholder(args.Query)
+		if len(args.Params) != placeholders {
+			return newErrorResult(fmt.Sprintf("query 使用了 %d 个位置参数，但提供了 %d 个参数值", placeholders, len(args.Params)), nil), nil
+		}
+		source, err := buildAsOfSource(args.Schema, tableInfo, fmt.Sprintf("$%d", placeholders+1))
+		if err != nil {
+			return newErrorResult("构造 as-of 查询失败", err), nil
+		}
+		query, err = rewriteTableReferences(args.Query, args.Schema, args.Table, source)
+		if err != nil {
+			return newErrorResult("改写查询失败", err), nil
+		}
+		params = append(append(params, args.Params...), args.AsOf)
+	} else {
+		source, err := buildAsOfSource(args.Schema, tableInfo, "$1")
+		if err != nil {
+			return newErrorResult("构造 as-of 查询失败", err), nil
+		}
+		limit := args.Limit
+		if limit <= 0 {
+			limit = defaultAsOfQueryLimit
+		}
+		if limit > maxAsOfQueryLimit {
+			limit = maxAsOfQueryLimit
+		}
+		selectList := "*"
+		if len(args.Select) > 0 {
+			quoted, err := sqlsafe.QuoteIdentifiers(args.Select)
+			if err != nil {
+				return newErrorResult("无效的列名", err), nil
+			}
+			selectList = strings.Join(quoted, ", ")
+		}
+		alias, err := sqlsafe.QuoteIdentifier(args.Table)
+		if err != nil {
+			return newErrorResult("无效的表名", err), nil
+		}
+		params = []any{args.AsOf, limit}
+		query = fmt.Sprintf("SELECT %s FROM %s AS %s LIMIT $2", selectList, source, alias)
+	}
+
+	response := map[string]any{
+		"sql":      query,
+		"params":   params,
+		"temporal": tableInfo.Temporal,
+	}
+	if args.DryRun {
+		return newJSONResult(response)
+	}
+
+	utils.DefaultLogger.Debug("执行 as-of 查询", zap.String("connID", args.ConnID), zap.String("query", query), zap.String("asOf", args.AsOf))
+	result, err := h.dbService.QueryWithColumns(ctx, args.ConnID, true, query, params...) // readOnly = true
+	if err != nil {
+		utils.DefaultLogger.Error("执行 'as_of_query' 失败", zap.String("connID", args.ConnID), zap.String("query", query), zap.Error(err))
+		return newErrorResult("查询执行失败", err), nil
+	}
+	if err := h.masker.MaskResult(ctx, args.ConnID, result); err != nil {
+		return newErrorResult("结果脱敏失败", err), nil
+	}
+	utils.DefaultLogger.Info("as-of 查询执行成功", zap.String("connID", args.ConnID), zap.Int("rowCount", len(result.Rows)))
+
+	response["rows"] = result.Rows
+	return newJSONResult(response)
+}
+
+// buildAsOfSource 构造代表"某时间点有效行"的子查询，时间点为位置参数 placeholder (例如 $1)。
+func buildAsOfSource(schemaName string, table *schemas.TableInfo, placeholder string) (string, error) {
+	temporal := table.Temporal
+	condition, err := asOfCondition(temporal, placeholder)
+	if err != nil {
+		return "", err
+	}
+
+	current, err := sqlsafe.QuoteQualified(schemaName, table.Name)
+	if err != nil {
+		return "", err
+	}
+	switch temporal.Pattern {
+	case schemas.TemporalPeriodColumns, schemas.TemporalRangeColumn:
+		return fmt.Sprintf("(SELECT * FROM %s WHERE %s)", current, condition), nil
+	case schemas.TemporalHistoryTable:
+		history, err := sqlsafe.QuoteQualified(temporal.HistorySchema, temporal.HistoryTable)
+		if err != nil {
+			return "", fmt.Errorf("无效的历史表名称: %w", err)
+		}
+		// 当前表与历史表的列一般一致 (temporal_tables 约定)，合并后再按有效期过滤
+		return fmt.Sprintf("(SELECT * FROM (SELECT * FROM %s UNION ALL SELECT * FROM %s) AS _versions WHERE %s)", current, history, condition), nil
+	default:
+		return "", fmt.Errorf("不支持的时态表模式: '%s'", temporal.Pattern)
+	}
+}
+
+// asOfCondition 根据有效期列信息生成过滤条件
+func asOfCondition(temporal *schemas.TemporalInfo, placeholder string) (string, error) {
+	asOf := placeholder + "::timestamptz"
+	if temporal.PeriodColumn != "" {
+		period, err := sqlsafe.QuoteIdentifier(temporal.PeriodColumn)
+		if err != nil {
+			return "", fmt.Errorf("无效的有效期列名: %w", err)
+		}
+		return fmt.Sprintf("%s @> %s", period, asOf), nil
+	}
+	if temporal.ValidFromColumn != "" && temporal.ValidToColumn != "" {
+		columns, err := sqlsafe.QuoteIdentifiers([]string{temporal.ValidFromColumn, temporal.ValidToColumn})
+		if err != nil {
+			return "", fmt.Errorf("无效的有效期列名: %w", err)
+		}
+		from, to := columns[0], columns[1]
+		return fmt.Sprintf("%s <= %s AND (%s IS NULL OR %s > %s)", from, asOf, to, to, asOf), nil
+	}
+	return "", fmt.Errorf("未识别到有效期列，无法确定历史版本的时间范围")
+}
+
+// maxPlaceholder 返回查询中最大的位置参数编号 ($N)，字符串字面量和注释中的内容不计入
+func maxPlaceholder(query string) int {
+	highest := 0
+	for _, token := range sqlguard.Lex(query) {
+		if token.Kind != sqlguard.TokenParam {
+			continue
+		}
+		if n, err := strconv.Atoi(token.Text[1:]); err == nil && n > highest {
+			highest = n
+		}
+	}
+	return highest
+}
+
+// rewriteTableReferences 将 SELECT 中 FROM/JOIN 后对目标表的引用替换为 as-of 子查询。
+// 已有别名时保留原别名，否则使用表名作为别名，保证原查询中的列引用仍然有效。
+// 按 sqlguard.Lex 的词法单元匹配，字符串字面量和注释中的表名不会被改写；
+// 未加引号的名称按 PostgreSQL 规则转为小写后比较，加引号的名称区分大小写。
+func rewriteTableReferences(query, schemaName, tableName, source string) (string, error) {
+	trimmed := strings.TrimSpace(query)
+	if keywords := sqlguard.Keywords(trimmed); len(keywords) == 0 || (keywords[0] != "select" && keywords[0] != "with") {
+		return "", fmt.Errorf("只支持 SELECT 查询")
+	}
+
+	tokens := sqlguard.Lex(trimmed)
+	// 跳过空白和注释，返回从 i 开始的下一个有效词法单元的下标
+	next := func(i int) int {
+		for i < len(tokens) && (tokens[i].Kind == sqlguard.TokenComment || (tokens[i].Kind == sqlguard.TokenOther && strings.TrimSpace(tokens[i].Text) == "")) {
+			i++
+		}
+		return i
+	}
+	isName := func(i int, name string) bool {
+		return i < len(tokens) && identifierValue(tokens[i]) == name
+	}
+	isPunct := func(i int, text string) bool {
+		return i < len(tokens) && tokens[i].Kind == sqlguard.TokenOther && tokens[i].Text == text
+	}
+
+	var sb strings.Builder
+	replaced := 0
+	copied := 0
+	for i := 0; i < len(tokens); i++ {
+		keyword := tokens[i]
+		if keyword.Kind != sqlguard.TokenWord || (!strings.EqualFold(keyword.Text, "FROM") && !strings.EqualFold(keyword.Text, "JOIN")) {
+			continue
+		}
+		// 表引用: [schema .] table，之后不能再跟 "."，避免把 orders.x 中的 orders 当成表
+		start := next(i + 1)
+		end := start
+		if isName(start, schemaName) && isPunct(next(start+1), ".") && isName(next(next(start+1)+1), tableName) {
+			end = next(next(start+1)+1) + 1
+		} else if isName(start, tableName) {
+			end = start + 1
+		} else {
+			continue
+		}
+		if isPunct(next(end), ".") {
+			continue
+		}
+
+		// 已有别名: [AS] alias，例如 "FROM orders WHERE ..." 中的 WHERE 不是别名
+		alias := ""
+		aliasAt := next(end)
+		if aliasAt < len(tokens) && tokens[aliasAt].Kind == sqlguard.TokenWord && strings.EqualFold(tokens[aliasAt].Text, "AS") {
+			aliasAt = next(aliasAt + 1)
+		}
+		if aliasAt < len(tokens) && (tokens[aliasAt].Kind == sqlguard.TokenQuotedIdent || (tokens[aliasAt].Kind == sqlguard.TokenWord && !isSQLKeyword(tokens[aliasAt].Text))) {
+			alias = tokens[aliasAt].Text
+		}
+
+		sb.WriteString(trimmed[copied:tokens[start].Start])
+		sb.WriteString(source)
+		if alias == "" {
+			quoted, err := sqlsafe.QuoteIdentifier(tableName)
+			if err != nil {
+				return "", fmt.Errorf("无效的表名: %w", err)
+			}
+			sb.WriteString(" AS " + quoted)
+		}
+		copied = tokens[end-1].End
+		replaced++
+		i = end - 1
+	}
+	if replaced == 0 {
+		return "", fmt.Errorf("查询中未找到对表 '%s.%s' 的 FROM/JOIN 引用", schemaName, tableName)
+	}
+	sb.WriteString(trimmed[copied:])
+	return sb.String(), nil
+}
+
+// identifierValue 返回标识符词法单元代表的名称: 未加引号的转为小写，加引号的去掉引号并还原转义；其他词法单元返回空字符串
+func identifierValue(token sqlguard.Token) string {
+	switch token.Kind {
+	case sqlguard.TokenWord:
+		return strings.ToLower(token.Text)
+	case sqlguard.TokenQuotedIdent:
+		if len(token.Text) < 2 || !strings.HasSuffix(token.Text, `"`) {
+			return ""
+		}
+		return strings.ReplaceAll(token.Text[1:len(token.Text)-1], `""`, `"`)
+	default:
+		return ""
+	}
+}
+
+// sqlClauseKeywords 是可能紧跟在表名后面、不能被当作别名的关键字
+var sqlClauseKeywords = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "CROSS": true,
+	"ON": true, "USING": true, "GROUP": true, "ORDER": true, "LIMIT": true, "OFFSET": true, "HAVING": true,
+	"WINDOW": true, "UNION": true, "INTERSECT": true, "EXCEPT": true, "FOR": true, "NATURAL": true, "FETCH": true,
+}
+
+func isSQLKeyword(word string) bool {
+	return sqlClauseKeywords[strings.ToUpper(word)]
+}
@@ -0,0 +1,326 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultColumnAuditSample    = 10000
+	maxColumnAuditSample        = 100000
+	defaultColumnAuditMaxTables = 20
+	maxColumnAuditMaxTables     = 100
+	mostlyNullFrac              = 0.99
+)
+
+// 列审计的结论 (ColumnAudit.Verdict)
+const (
+	ColumnLikelyUnused = "likely_unused" // 抽样中全为 NULL 或全为默认值
+	ColumnSuspicious   = "suspicious"    // 几乎全为 NULL 或只有一个取值
+	ColumnInUse        = "in_use"
+)
+
+// literalDefault 匹配常量默认值 (字符串、数字、布尔、NULL，可带类型转换)，
+// 只有这类默认值会被拼进抽样查询比较；nextval()、now() 等函数默认值不参与比较
+var literalDefault = regexp.MustCompile(`^\(?('(?:[^']|'')*'|-?[0-9]+(?:\.[0-9]+)?|true|false|NULL)\)?(?:::[a-zA-Z0-9_ ."]+(?:\([0-9, ]+\))?(?:\[\])*)?$`)
+
+// columnStatsQuery 读取列的 NULL 比例和不同值估算 (需要表已 ANALYZE)，分区父表使用 inherited 统计
+const columnStatsQuery = `
+SELECT attname AS column_name, null_frac::float8 AS null_frac, n_distinct::float8 AS n_distinct
+FROM pg_stats
+WHERE schemaname = $1 AND tablename = $2
+ORDER BY inherited DESC`
+
+// tableActivityQuery 读取表的写入和扫描统计，作为判断列是否废弃的背景信息
+const tableActivityQuery = `
+SELECT n_live_tup, n_tup_ins, n_tup_upd, seq_scan, coalesce(idx_scan, 0) AS idx_scan,
+       last_analyze, last_autoanalyze
+FROM pg_stat_user_tables
+WHERE schemaname = $1 AND relname = $2`
+
+// AuditColumnsToolArgs 是 'audit_columns' 工具的输入参数。
+type AuditColumnsToolArgs struct {
+	ConnID     string `json:"conn_id" description:"目标数据库的连接 ID"`
+	Schema     string `json:"schema" description:"要检查的 Schema"`
+	Table      string `json:"table,omitempty" description:"(可选) 只检查该表，默认按行数从大到小检查 Schema 中的表"`
+	SampleRows int    `json:"sample_rows,omitempty" description:"(可选) 每张表抽样的行数，默认 10000，最大 100000"`
+	MaxTables  int    `json:"max_tables,omitempty" description:"(可选) 未指定 table 时最多检查的表数量，默认 20，最大 100"`
+	IncludeAll bool   `json:"include_all,omitempty" description:"(可选) 为 true 时返回所有列，默认只返回疑似未使用的列"`
+}
+
+// ColumnAudit 是一个列的审计结果
+type ColumnAudit struct {
+	Column        string   `json:"column"`
+	Type          string   `json:"type"`
+	Default       *string  `json:"default,omitempty"`
+	NullFrac      *float64 `json:"null_frac,omitempty"`  // pg_stats 的 NULL 比例
+	NDistinct     *float64 `json:"n_distinct,omitempty"` // pg_stats 的不同值估算 (负数表示占行数的比例)
+	SampleNonNull int64    `json:"sample_non_null"`
+	SampleDefault *int64   `json:"sample_default,omitempty"` // 抽样中等于默认值的行数 (只对常量默认值统计)
+	Indexed       bool     `json:"indexed,omitempty"`
+	Constrained   bool     `json:"constrained,omitempty"` // 主键、唯一或外键列
+	Verdict       string   `json:"verdict"`
+	Reasons       []string `json:"reasons,omitempty"`
+}
+
+// TableColumnAudit 是一张表的审计结果
+type TableColumnAudit struct {
+	Table       string         `json:"table"`
+	EstRows     int64          `json:"estimated_rows"`
+	SampledRows int64          `json:"sampled_rows"`
+	Sampled     bool           `json:"sampled"` // true 表示使用 TABLESAMPLE 抽样，否则为前 sample_rows 行
+	Activity    map[string]any `json:"activity,omitempty"`
+	Columns     []ColumnAudit  `json:"columns"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// AuditColumnsHandler 处理疑似未使用列检测的工具调用。
+type AuditColumnsHandler struct {
+	dbService     databases.Service
+	schemaManager schemas.Manager
+}
+
+// NewAuditColumnsHandler 创建一个新的 AuditColumnsHandler。
+func NewAuditColumnsHandler(dbService databases.Service, schemaManager schemas.Manager) *AuditColumnsHandler {
+	return &AuditColumnsHandler{dbService: dbService, schemaManager: schemaManager}
+}
+
+// HandleAuditColumns 处理 'audit_columns' 工具的调用请求。
+// 结合 pg_stats 的 NULL 比例与不同值估算、对表抽样得到的非 NULL 行数和等于默认值的行数，
+// 标记抽样中全为 NULL 或全为默认值的列 (likely_unused) 以及几乎全为 NULL 或只有一个取值的列 (suspicious)。
+// 结果只包含计数，不返回列值；结论是启发式的，删除列前需要确认应用代码和报表不再引用。
+func (h *AuditColumnsHandler) HandleAuditColumns(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(AuditColumnsToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Schema == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 或 'schema' 参数")
+	}
+	sampleRows := args.SampleRows
+	if sampleRows <= 0 {
+		sampleRows = defaultColumnAuditSample
+	}
+	sampleRows = min(sampleRows, maxColumnAuditSample)
+	maxTables := args.MaxTables
+	if maxTables <= 0 {
+		maxTables = defaultColumnAuditMaxTables
+	}
+	maxTables = min(maxTables, maxColumnAuditMaxTables)
+
+	// 只允许缓存中存在的表和列，避免把任意标识符拼进 SQL
+	schemaInfo, found := h.schemaManager.GetSchemaInfo(args.Schema)
+	if !found {
+		return newErrorResult(fmt.Sprintf("未找到 Schema '%s'", args.Schema), nil), nil
+	}
+	policies := h.dbService.Policies(args.ConnID)
+	tables := []schemas.TableInfo{}
+	for _, table := range schemaInfo.Tables {
+		if (args.Table == "" || table.Name == args.Table) && policies.TableAllowed(args.Schema, table.Name) {
+			tables = append(tables, table)
+		}
+	}
+	if args.Table != "" && len(tables) == 0 {
+		return newErrorResult(fmt.Sprintf("未找到表 '%s.%s'", args.Schema, args.Table), nil), nil
+	}
+	sort.SliceStable(tables, func(i, j int) bool { return tables[i].RowCount > tables[j].RowCount })
+	truncated := len(tables) > maxTables
+	if truncated {
+		tables = tables[:maxTables]
+	}
+
+	audits := make([]TableColumnAudit, 0, len(tables))
+	flagged := 0
+	for _, table := range tables {
+		audit := h.auditTable(ctx, args.ConnID, args.Schema, table, sampleRows)
+		if !args.IncludeAll {
+			kept := []ColumnAudit{}
+			for _, column := range audit.Columns {
+				if column.Verdict != ColumnInUse {
+					kept = append(kept, column)
+				}
+			}
+			audit.Columns = kept
+		}
+		for _, column := range audit.Columns {
+			if column.Verdict != ColumnInUse {
+				flagged++
+			}
+		}
+		audits = append(audits, audit)
+	}
+
+	utils.DefaultLogger.Info("列使用情况审计完成", zap.String("connID", args.ConnID), zap.String("schema", args.Schema), zap.Int("tables", len(audits)), zap.Int("flagged", flagged))
+	return newJSONResult(map[string]any{
+		"tables":          audits,
+		"flagged_columns": flagged,
+		"truncated":       truncated, // true 表示还有表未检查，可通过 max_tables 或 table 参数继续
+		"note":            "结论基于统计信息和抽样的启发式判断；删除列前请确认应用代码、视图和报表不再引用",
+	})
+}
+
+// auditTable 审计一张表的所有列，查询错误记录在结果中，不影响其他表
+func (h *AuditColumnsHandler) auditTable(ctx context.Context, connID, schema string, table schemas.TableInfo, sampleRows int) TableColumnAudit {
+	audit := TableColumnAudit{Table: schema + "." + table.Name, EstRows: table.RowCount, Columns: []ColumnAudit{}}
+	if len(table.Columns) == 0 {
+		return audit
+	}
+
+	activity, err := h.dbService.ExecuteQuery(ctx, connID, true, tableActivityQuery, schema, table.Name)
+	if err == nil && len(activity) > 0 {
+		audit.Activity = activity[0]
+	}
+	stats := map[string]map[string]any{}
+	statRows, err := h.dbService.ExecuteQuery(ctx, connID, true, columnStatsQuery, schema, table.Name)
+	if err != nil {
+		utils.DefaultLogger.Warn("读取列统计信息失败", zap.String("connID", connID), zap.String("table", audit.Table), zap.Error(err))
+	}
+	for _, row := range statRows {
+		name, _ := row["column_name"].(string)
+		if _, exists := stats[name]; !exists {
+			stats[name] = row
+		}
+	}
+
+	audit.Sampled = table.RowCount > int64(sampleRows)*10
+	query, comparesDefault, err := columnSampleQuery(schema, table, sampleRows, audit.Sampled)
+	if err != nil {
+		audit.Error = fmt.Sprintf("生成列抽样查询失败: %v", err)
+		return audit
+	}
+	rows, err := h.dbService.ExecuteQuery(ctx, connID, true, query)
+	if err != nil {
+		utils.DefaultLogger.Error("列抽样统计失败", zap.String("connID", connID), zap.String("table", audit.Table), zap.Error(err))
+		audit.Error = fmt.Sprintf("列抽样统计失败: %v", err)
+		return audit
+	}
+	if len(rows) == 0 {
+		return audit
+	}
+	sample := rows[0]
+	audit.SampledRows = utils.DbInt64(sample["sampled_rows"])
+
+	indexed, constrained := indexedColumns(table)
+	for i, column := range table.Columns {
+		result := ColumnAudit{
+			Column:        column.Name,
+			Type:          column.Type,
+			Default:       column.DefaultValue,
+			SampleNonNull: utils.DbInt64(sample[fmt.Sprintf("nn_%d", i)]),
+			Indexed:       indexed[column.Name],
+			Constrained:   constrained[column.Name],
+		}
+		if row, ok := stats[column.Name]; ok {
+			if v, ok := row["null_frac"].(float64); ok {
+				result.NullFrac = &v
+			}
+			if v, ok := row["n_distinct"].(float64); ok {
+				result.NDistinct = &v
+			}
+		}
+		if comparesDefault[i] {
+			count := utils.DbInt64(sample[fmt.Sprintf("df_%d", i)])
+			result.SampleDefault = &count
+		}
+		result.Verdict, result.Reasons = columnVerdict(result, audit.SampledRows)
+		audit.Columns = append(audit.Columns, result)
+	}
+	return audit
+}
+
+// columnSampleQuery 生成对抽样行统计每列非 NULL 行数和等于常量默认值行数的查询。
+// sampled 为 true (估算行数超过抽样行数的 10 倍) 时使用 TABLESAMPLE SYSTEM，否则读取前 sampleRows 行。
+// 返回的切片标记哪些列统计了默认值；表名或列名无法安全引用时返回错误。
+func columnSampleQuery(schema string, table schemas.TableInfo, sampleRows int, sampled bool) (string, []bool, error) {
+	source, err := sqlsafe.QuoteQualified(schema, table.Name)
+	if err != nil {
+		return "", nil, err
+	}
+	if sampled {
+		source += tableSampleClause(int64(sampleRows)*2, table.RowCount) // 按两倍抽样，弥补页级抽样的偏差
+	}
+	comparesDefault := make([]bool, len(table.Columns))
+	aggregates := []string{"count(*) AS sampled_rows"}
+	for i, column := range table.Columns {
+		quotedColumn, err := sqlsafe.QuoteIdentifier(column.Name)
+		if err != nil {
+			return "", nil, fmt.Errorf("无效的列名 '%s': %w", column.Name, err)
+		}
+		quoted := "s." + quotedColumn
+		aggregates = append(aggregates, fmt.Sprintf("count(%s) AS nn_%d", quoted, i))
+		if column.DefaultValue != nil && literalDefault.MatchString(strings.TrimSpace(*column.DefaultValue)) && !strings.EqualFold(strings.TrimSpace(*column.DefaultValue), "NULL") {
+			comparesDefault[i] = true
+			// 转为 text 比较，避免没有等号运算符的类型 (json 等) 报错
+			aggregates = append(aggregates, fmt.Sprintf("count(*) FILTER (WHERE %s::text = (%s)::text) AS df_%d", quoted, *column.DefaultValue, i))
+		}
+	}
+	return fmt.Sprintf("SELECT %s FROM (SELECT * FROM %s LIMIT %d) AS s", strings.Join(aggregates, ", "), source, sampleRows), comparesDefault, nil
+}
+
+// indexedColumns 返回出现在索引中的列，以及属于主键、唯一或外键约束的列
+func indexedColumns(table schemas.TableInfo) (map[string]bool, map[string]bool) {
+	indexed, constrained := map[string]bool{}, map[string]bool{}
+	for _, index := range table.Indexes {
+		for _, column := range index.Columns {
+			indexed[column] = true
+			if index.IsPrimary || index.IsUnique {
+				constrained[column] = true
+			}
+		}
+	}
+	for _, fk := range table.ForeignKeys {
+		for _, column := range fk.Columns {
+			constrained[column] = true
+		}
+	}
+	return indexed, constrained
+}
+
+// columnVerdict 根据抽样和统计信息给出结论，约束列不会被判为 likely_unused
+func columnVerdict(column ColumnAudit, sampledRows int64) (string, []string) {
+	if sampledRows == 0 {
+		return ColumnInUse, nil
+	}
+	reasons := []string{}
+	verdict := ColumnInUse
+	switch {
+	case column.SampleNonNull == 0:
+		reasons = append(reasons, fmt.Sprintf("抽样的 %d 行全部为 NULL", sampledRows))
+		verdict = ColumnLikelyUnused
+	case column.SampleDefault != nil && *column.SampleDefault == column.SampleNonNull:
+		reasons = append(reasons, fmt.Sprintf("抽样中所有非 NULL 值都等于默认值 %s", *column.Default))
+		verdict = ColumnLikelyUnused
+	}
+	if column.NullFrac != nil && *column.NullFrac >= mostlyNullFrac && column.SampleNonNull > 0 {
+		reasons = append(reasons, fmt.Sprintf("pg_stats 显示 %.1f%% 为 NULL", *column.NullFrac*100))
+		if verdict == ColumnInUse {
+			verdict = ColumnSuspicious
+		}
+	}
+	if column.NDistinct != nil && *column.NDistinct == 1 && column.SampleNonNull > 0 && verdict == ColumnInUse {
+		reasons = append(reasons, "pg_stats 显示只有一个取值")
+		verdict = ColumnSuspicious
+	}
+	if len(reasons) == 0 {
+		return ColumnInUse, nil
+	}
+	if column.Constrained && verdict == ColumnLikelyUnused {
+		reasons = append(reasons, "列属于主键、唯一或外键约束，降级为 suspicious")
+		verdict = ColumnSuspicious
+	}
+	if column.Indexed {
+		reasons = append(reasons, "列上有索引，删除列会同时删除这些索引")
+	}
+	return verdict, reasons
+}
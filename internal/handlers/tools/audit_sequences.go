@@ -0,0 +1,297 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSequenceThreshold = 75.0
+	defaultSequenceMaxTables = 200
+	maxSequenceMaxTables     = 1000
+	criticalSequenceUsedPct  = 90.0
+)
+
+// integerTypeMax 是整数列类型的最大值，序列属于这些列时以列类型的上限为准 (例如 int4 列使用 bigint 序列)
+var integerTypeMax = map[string]int64{
+	"smallint": math.MaxInt16,
+	"integer":  math.MaxInt32,
+	"bigint":   math.MaxInt64,
+}
+
+// sequenceAuditQuery 读取序列的当前值和上限，以及拥有该序列的列 (serial / identity)
+const sequenceAuditQuery = `
+SELECT s.schemaname AS schema, s.sequencename AS sequence, s.data_type::text AS data_type,
+       s.last_value, s.min_value, s.max_value, s.increment_by, s.cycle,
+       tn.nspname AS table_schema, t.relname AS table_name, a.attname AS column_name,
+       format_type(a.atttypid, NULL) AS column_type
+FROM pg_sequences s
+JOIN pg_namespace n ON n.nspname = s.schemaname
+JOIN pg_class c ON c.relnamespace = n.oid AND c.relname = s.sequencename
+LEFT JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.objid = c.oid
+     AND d.refclassid = 'pg_class'::regclass AND d.refobjsubid > 0 AND d.deptype IN ('a', 'i')
+LEFT JOIN pg_class t ON t.oid = d.refobjid
+LEFT JOIN pg_namespace tn ON tn.oid = t.relnamespace
+LEFT JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+WHERE ($1 = '' OR s.schemaname = $1)
+ORDER BY s.schemaname, s.sequencename`
+
+// smallKeyQuery 列出单列 smallint / integer 主键，按表的估算行数降序
+const smallKeyQuery = `
+SELECT n.nspname AS schema, c.relname AS table_name, a.attname AS column_name,
+       format_type(a.atttypid, NULL) AS column_type
+FROM pg_index i
+JOIN pg_class c ON c.oid = i.indrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = i.indkey[0]
+WHERE i.indisprimary AND i.indnatts = 1
+  AND a.atttypid IN ('int2'::regtype, 'int4'::regtype)
+  AND c.relkind IN ('r', 'p') AND NOT c.relispartition
+  AND n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%'
+  AND ($1 = '' OR n.nspname = $1)
+ORDER BY c.reltuples DESC
+LIMIT $2`
+
+// AuditSequencesToolArgs 是 'audit_sequences' 工具的输入参数。
+type AuditSequencesToolArgs struct {
+	ConnID       string  `json:"conn_id" description:"目标数据库的连接 ID"`
+	Schema       string  `json:"schema,omitempty" description:"(可选) 只检查该 Schema，默认检查所有用户 Schema"`
+	ThresholdPct float64 `json:"threshold_pct,omitempty" description:"(可选) 只报告已用比例不低于该百分比的序列和主键，默认 75"`
+	IncludeAll   bool    `json:"include_all,omitempty" description:"(可选) 为 true 时返回所有序列和主键，不按阈值过滤"`
+	MaxTables    int     `json:"max_tables,omitempty" description:"(可选) 最多检查的 smallint/integer 主键表数量 (按行数从大到小)，默认 200，最大 1000"`
+}
+
+// SequenceUsage 是一个序列的使用情况
+type SequenceUsage struct {
+	Sequence        string  `json:"sequence"`
+	DataType        string  `json:"data_type"`
+	Column          string  `json:"column,omitempty"`      // 拥有该序列的列 (schema.table.column)
+	ColumnType      string  `json:"column_type,omitempty"` // 列类型，比序列类型更窄时以列类型上限为准
+	LastValue       *int64  `json:"last_value"`            // 尚未调用过 nextval 时为 null
+	Limit           int64   `json:"limit"`                 // 实际可用的上限 (递减序列为下限)
+	IncrementBy     int64   `json:"increment_by"`
+	Cycle           bool    `json:"cycle"`
+	UsedPct         float64 `json:"used_pct"`
+	Remaining       int64   `json:"remaining"`                   // 还能调用 nextval 的次数
+	Severity        string  `json:"severity"`                    // ok, warning 或 critical
+	LimitedByColumn bool    `json:"limited_by_column,omitempty"` // 上限由列类型决定
+}
+
+// KeyUsage 是一个 smallint/integer 主键的使用情况
+type KeyUsage struct {
+	Table      string  `json:"table"`
+	Column     string  `json:"column"`
+	ColumnType string  `json:"column_type"`
+	MaxValue   *int64  `json:"max_value"` // 空表为 null
+	Limit      int64   `json:"limit"`
+	UsedPct    float64 `json:"used_pct"`
+	Severity   string  `json:"severity"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// AuditSequencesHandler 处理序列耗尽与整数主键溢出检查的工具调用。
+type AuditSequencesHandler struct {
+	dbService databases.Service
+}
+
+// NewAuditSequencesHandler 创建一个新的 AuditSequencesHandler。
+func NewAuditSequencesHandler(dbService databases.Service) *AuditSequencesHandler {
+	return &AuditSequencesHandler{dbService: dbService}
+}
+
+// HandleAuditSequences 处理 'audit_sequences' 工具的调用请求。
+// 序列部分读取 pg_sequences (需要 PostgreSQL 10+，没有 USAGE/SELECT 权限的序列 last_value 为 null)，
+// 序列属于 smallint/integer 列时 (例如 int4 列使用 bigint 序列) 以列类型的上限计算；
+// 主键部分对单列 smallint/integer 主键取 max()，由主键索引完成，不扫描表。
+func (h *AuditSequencesHandler) HandleAuditSequences(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(AuditSequencesToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 参数")
+	}
+	threshold := args.ThresholdPct
+	if threshold <= 0 {
+		threshold = defaultSequenceThreshold
+	}
+	if args.IncludeAll {
+		threshold = 0
+	}
+	maxTables := args.MaxTables
+	if maxTables <= 0 {
+		maxTables = defaultSequenceMaxTables
+	}
+	maxTables = min(maxTables, maxSequenceMaxTables)
+	policies := h.dbService.Policies(args.ConnID)
+
+	rows, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true, sequenceAuditQuery, args.Schema)
+	if err != nil {
+		utils.DefaultLogger.Error("读取序列信息失败", zap.String("connID", args.ConnID), zap.Error(err))
+		return newErrorResult("读取序列信息失败 (需要 PostgreSQL 10+)", err), nil
+	}
+	sequences := []SequenceUsage{}
+	for _, row := range rows {
+		schema, _ := row["schema"].(string)
+		if !policies.SchemaVisible(schema) {
+			continue
+		}
+		if tableSchema, ok := row["table_schema"].(string); ok && !policies.TableAllowed(tableSchema, fmt.Sprint(row["table_name"])) {
+			continue
+		}
+		usage := sequenceUsage(row)
+		if usage.UsedPct >= threshold {
+			sequences = append(sequences, usage)
+		}
+	}
+	sort.SliceStable(sequences, func(i, j int) bool { return sequences[i].UsedPct > sequences[j].UsedPct })
+
+	keyRows, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true, smallKeyQuery, args.Schema, maxTables)
+	if err != nil {
+		utils.DefaultLogger.Error("读取整数主键信息失败", zap.String("connID", args.ConnID), zap.Error(err))
+		return newErrorResult("读取整数主键信息失败", err), nil
+	}
+	keys := []KeyUsage{}
+	for _, row := range keyRows {
+		schema, _ := row["schema"].(string)
+		table, _ := row["table_name"].(string)
+		if !policies.TableAllowed(schema, table) {
+			continue
+		}
+		usage := h.keyUsage(ctx, args.ConnID, row)
+		if usage.Error != "" || usage.UsedPct >= threshold {
+			keys = append(keys, usage)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].UsedPct > keys[j].UsedPct })
+
+	utils.DefaultLogger.Info("序列与整数主键检查完成", zap.String("connID", args.ConnID), zap.Int("sequences", len(sequences)), zap.Int("keys", len(keys)), zap.Int("keysChecked", len(keyRows)))
+	return newJSONResult(map[string]any{
+		"threshold_pct":  threshold,
+		"sequences":      sequences,
+		"primary_keys":   keys,
+		"tables_checked": len(keyRows),
+	})
+}
+
+// sequenceUsage 计算一个序列的已用比例和剩余次数
+func sequenceUsage(row map[string]any) SequenceUsage {
+	usage := SequenceUsage{
+		Sequence:    fmt.Sprintf("%v.%v", row["schema"], row["sequence"]),
+		DataType:    fmt.Sprint(row["data_type"]),
+		IncrementBy: utils.DbInt64(row["increment_by"]),
+		Cycle:       row["cycle"] == true,
+	}
+	minValue, maxValue := utils.DbInt64(row["min_value"]), utils.DbInt64(row["max_value"])
+	if column, ok := row["column_name"].(string); ok {
+		usage.Column = fmt.Sprintf("%v.%v.%s", row["table_schema"], row["table_name"], column)
+		usage.ColumnType, _ = row["column_type"].(string)
+		if columnMax, ok := integerTypeMax[usage.ColumnType]; ok {
+			if columnMax < maxValue {
+				maxValue, usage.LimitedByColumn = columnMax, true
+			}
+			if -columnMax-1 > minValue {
+				minValue, usage.LimitedByColumn = -columnMax-1, true
+			}
+		}
+	}
+
+	// 从起点走向上限的进度: 递增序列从 min 走向 max，递减序列从 max 走向 min
+	start, limit := minValue, maxValue
+	if usage.IncrementBy < 0 {
+		start, limit = maxValue, minValue
+	}
+	usage.Limit = limit
+	usage.Remaining = remainingCalls(limit, start, usage.IncrementBy)
+	if row["last_value"] != nil {
+		last := utils.DbInt64(row["last_value"])
+		usage.LastValue = &last
+		if span := float64(limit) - float64(start); span != 0 {
+			usage.UsedPct = roundPct((float64(last) - float64(start)) / span * 100)
+		}
+		usage.Remaining = remainingCalls(limit, last, usage.IncrementBy)
+	}
+	usage.Severity = severityFor(usage.UsedPct)
+	return usage
+}
+
+// remainingCalls 返回从 from 到 limit 还能调用 nextval 的次数 (按 float64 计算，避免 int64 相减溢出)
+func remainingCalls(limit, from, increment int64) int64 {
+	if increment == 0 {
+		return 0
+	}
+	remaining := math.Floor((float64(limit) - float64(from)) / float64(increment))
+	switch {
+	case remaining <= 0:
+		return 0
+	case remaining >= math.MaxInt64:
+		return math.MaxInt64
+	}
+	return int64(remaining)
+}
+
+// keyUsage 取主键的当前最大值并计算已用比例
+func (h *AuditSequencesHandler) keyUsage(ctx context.Context, connID string, row map[string]any) KeyUsage {
+	schema, _ := row["schema"].(string)
+	table, _ := row["table_name"].(string)
+	column, _ := row["column_name"].(string)
+	columnType, _ := row["column_type"].(string)
+	usage := KeyUsage{Table: schema + "." + table, Column: column, ColumnType: columnType, Limit: integerTypeMax[columnType], Severity: "ok"}
+
+	qualified, err := sqlsafe.QuoteQualified(schema, table)
+	if err != nil {
+		usage.Error = err.Error()
+		return usage
+	}
+	quotedColumn, err := sqlsafe.QuoteIdentifier(column)
+	if err != nil {
+		usage.Error = err.Error()
+		return usage
+	}
+	// 负数主键同样会溢出，取绝对值更大的一端
+	query := fmt.Sprintf("SELECT max(%[1]s) AS max_value, min(%[1]s) AS min_value FROM %[2]s", quotedColumn, qualified)
+	rows, err := h.dbService.ExecuteQuery(ctx, connID, true, query)
+	if err != nil {
+		usage.Error = fmt.Sprintf("读取主键最大值失败: %v", err)
+		return usage
+	}
+	if len(rows) == 0 || rows[0]["max_value"] == nil {
+		return usage
+	}
+	value := utils.DbInt64(rows[0]["max_value"])
+	if minValue := utils.DbInt64(rows[0]["min_value"]); -minValue > value {
+		value = minValue
+	}
+	usage.MaxValue = &value
+	if usage.Limit > 0 {
+		usage.UsedPct = roundPct(math.Abs(float64(value)) / float64(usage.Limit) * 100)
+	}
+	usage.Severity = severityFor(usage.UsedPct)
+	return usage
+}
+
+// severityFor 按已用比例给出级别
+func severityFor(usedPct float64) string {
+	switch {
+	case usedPct >= criticalSequenceUsedPct:
+		return "critical"
+	case usedPct >= defaultSequenceThreshold:
+		return "warning"
+	default:
+		return "ok"
+	}
+}
+
+// roundPct 保留两位小数
+func roundPct(pct float64) float64 {
+	return math.Round(pct*100) / 100
+}
@@ -0,0 +1,205 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/idempotency"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+// CallFunctionTool 是 'call_function' 工具的定义。
+var CallFunctionTool = &protocol.Tool{
+	Name:        "call_function",
+	Description: "调用缓存 Schema 中的用户函数 (SELECT * FROM schema.func(...)) 并返回结果集；只读连接上只允许 immutable/stable 函数，volatile 函数按写入处理 (审核模式和幂等键)",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"conn_id":  {Type: protocol.String, Description: "目标数据库的连接 ID"},
+			"schema":   {Type: protocol.String, Description: "函数所在的 Schema"},
+			"function": {Type: protocol.String, Description: "函数名称"},
+			"params": {
+				Type:        protocol.Array,
+				Description: "(可选) 按位置传入的参数值，会按函数声明的参数类型转换；末尾带默认值的参数可以省略",
+				Items:       &protocol.Property{Type: protocol.String, Description: "单个参数 (Schema 定义为 string，但接受任意 JSON 类型)"},
+			},
+			"arg_types": {
+				Type:        protocol.Array,
+				Description: "(可选) 函数有多个重载时，用参数类型列表 (例如 [\"integer\", \"text\"]) 指定要调用的版本",
+				Items:       &protocol.Property{Type: protocol.String},
+			},
+			IdempotencyKeyArg: IdempotencyKeyProperty,
+		},
+		Required: []string{"conn_id", "schema", "function"},
+	},
+}
+
+// CallFunctionToolArgs 是 'call_function' 工具的输入参数。
+type CallFunctionToolArgs struct {
+	ConnID   string   `json:"conn_id"`
+	Schema   string   `json:"schema"`
+	Function string   `json:"function"`
+	Params   []any    `json:"params,omitempty"`
+	ArgTypes []string `json:"arg_types,omitempty"`
+}
+
+// CallFunctionHandler 处理函数调用的工具请求。
+type CallFunctionHandler struct {
+	dbService        databases.Service
+	schemaManager    schemas.Manager
+	idempotencyStore idempotency.Store
+	reviewQueue      *ReviewQueue
+}
+
+// NewCallFunctionHandler 创建一个新的 CallFunctionHandler。
+func NewCallFunctionHandler(dbService databases.Service, schemaManager schemas.Manager, idempotencyStore idempotency.Store, reviewQueue *ReviewQueue) *CallFunctionHandler {
+	return &CallFunctionHandler{
+		dbService:        dbService,
+		schemaManager:    schemaManager,
+		idempotencyStore: idempotencyStore,
+		reviewQueue:      reviewQueue,
+	}
+}
+
+// HandleCallFunction 处理 'call_function' 工具的调用请求。
+// 函数必须存在于缓存的 Schema 元数据中，调用语句只由缓存中的名称和类型构成，参数值全部通过占位符传入。
+// volatile 函数可能修改数据，只能在 read_write 连接上以读写事务执行，与 call_procedure 相同经过审核队列和幂等键保护。
+func (h *CallFunctionHandler) HandleCallFunction(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(CallFunctionToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Schema == "" || args.Function == "" {
+		return nil, fmt.Errorf("缺少 'conn_id', 'schema' 或 'function' 参数")
+	}
+
+	function, err := resolveFunction(h.schemaManager, args.Schema, args.Function, "function", len(args.Params), args.ArgTypes)
+	if err != nil {
+		return newErrorResult("函数校验失败", err), nil
+	}
+
+	readOnly := function.Volatility != "volatile"
+	if !readOnly {
+		mode, err := h.dbService.AccessMode(args.ConnID)
+		if err != nil {
+			return newErrorResult("获取连接访问模式失败", err), nil
+		}
+		if mode != databases.AccessModeReadWrite {
+			return newErrorResult(fmt.Sprintf("函数 '%s.%s' 是 volatile 的 (可能修改数据)，只读连接上只能调用 immutable 或 stable 函数", args.Schema, args.Function), nil), nil
+		}
+	}
+
+	qualified, err := sqlsafe.QuoteQualified(args.Schema, function.Name)
+	if err != nil {
+		return newErrorResult("函数校验失败", err), nil
+	}
+	query := fmt.Sprintf("SELECT * FROM %s(%s)", qualified, typedPlaceholders(function.ArgTypes[:len(args.Params)]))
+	if readOnly {
+		return h.callFunction(ctx, args, function, query, true)
+	}
+	summary := fmt.Sprintf("调用 volatile 函数 %s.%s(%s)", args.Schema, function.Name, strings.Join(function.ArgTypes, ", "))
+	return runIdempotent(ctx, h.idempotencyStore, args.ConnID, CallFunctionTool.Name, req, func() (*protocol.CallToolResult, error) {
+		return runReviewed(ctx, h.reviewQueue, args.ConnID, CallFunctionTool.Name, summary, req, func(ctx context.Context) (*protocol.CallToolResult, error) {
+			return h.callFunction(ctx, args, function, query, false)
+		})
+	})
+}
+
+// callFunction 执行函数调用并返回结果集，readOnly 为 false 时在读写事务中执行
+func (h *CallFunctionHandler) callFunction(ctx context.Context, args *CallFunctionToolArgs, function *schemas.FunctionInfo, query string, readOnly bool) (*protocol.CallToolResult, error) {
+	utils.DefaultLogger.Info("调用函数", zap.String("connID", args.ConnID), zap.String("function", args.Schema+"."+function.Name), zap.String("volatility", function.Volatility))
+	result, err := h.dbService.QueryWithColumns(ctx, args.ConnID, readOnly, query, args.Params...)
+	if err != nil {
+		utils.DefaultLogger.Error("函数调用失败", zap.String("connID", args.ConnID), zap.String("function", args.Schema+"."+function.Name), zap.Error(err))
+		return newErrorResult("函数调用失败", err), nil
+	}
+	return newJSONResult(map[string]any{
+		"function":   args.Schema + "." + function.Name + "(" + strings.Join(function.ArgTypes, ", ") + ")",
+		"volatility": function.Volatility,
+		"columns":    result.Columns,
+		"rows":       nonNilRows(result.Rows),
+		"row_count":  len(result.Rows),
+	})
+}
+
+// resolveFunction 在缓存的元数据中查找指定种类 (function 或 procedure) 的函数，
+// 按参数个数 (考虑默认参数) 和可选的参数类型列表选择重载版本。
+func resolveFunction(schemaManager schemas.Manager, schemaName, name, kind string, paramCount int, argTypes []string) (*schemas.FunctionInfo, error) {
+	schemaInfo, found := schemaManager.GetSchemaInfo(schemaName)
+	if !found {
+		return nil, fmt.Errorf("未找到 Schema '%s'", schemaName)
+	}
+	var candidates []schemas.FunctionInfo
+	nameFound := false
+	for _, function := range schemaInfo.Functions {
+		if function.Name != name {
+			continue
+		}
+		nameFound = true
+		if function.Kind != kind {
+			continue
+		}
+		if len(argTypes) > 0 && !sameTypes(function.ArgTypes, argTypes) {
+			continue
+		}
+		inputs := inputArgCount(function)
+		required := inputs - int(function.DefaultArgs)
+		if paramCount < required || paramCount > inputs {
+			continue
+		}
+		candidates = append(candidates, function)
+	}
+	switch {
+	case !nameFound:
+		return nil, fmt.Errorf("Schema '%s' 中不存在 '%s'", schemaName, name)
+	case len(candidates) == 0:
+		return nil, fmt.Errorf("'%s.%s' 没有接受 %d 个参数的 %s 版本 (注意参数类型和种类)", schemaName, name, paramCount, kind)
+	case len(candidates) > 1:
+		signatures := make([]string, 0, len(candidates))
+		for _, candidate := range candidates {
+			signatures = append(signatures, "("+strings.Join(candidate.ArgTypes, ", ")+")")
+		}
+		return nil, fmt.Errorf("'%s.%s' 有多个匹配的重载版本，请通过 'arg_types' 指定: %s", schemaName, name, strings.Join(signatures, "; "))
+	}
+	return &candidates[0], nil
+}
+
+// inputArgCount 返回需要调用方传值的参数个数 (存储过程的 OUT 参数除外)
+func inputArgCount(function schemas.FunctionInfo) int {
+	count := 0
+	for i := range function.ArgTypes {
+		if i >= len(function.ArgModes) || function.ArgModes[i] != "out" {
+			count++
+		}
+	}
+	return count
+}
+
+// typedPlaceholders 生成带类型转换的占位符列表 "$1::integer, $2::text"，类型名来自缓存的元数据
+func typedPlaceholders(argTypes []string) string {
+	placeholders := make([]string, len(argTypes))
+	for i, argType := range argTypes {
+		placeholders[i] = fmt.Sprintf("$%d::%s", i+1, argType)
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+// sameTypes 比较两个类型列表 (忽略大小写和首尾空白)
+func sameTypes(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(strings.TrimSpace(a[i]), strings.TrimSpace(b[i])) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/idempotency"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// CallProcedureTool 是 'call_procedure' 工具的定义。
+var CallProcedureTool = &protocol.Tool{
+	Name:        "call_procedure",
+	Description: "(写入) 在读写事务中执行 CALL schema.procedure(...) 并返回 OUT/INOUT 参数的值；只能调用配置 PROCEDURE_ALLOWLIST 中列出的存储过程",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"conn_id":   {Type: protocol.String, Description: "目标数据库的连接 ID (必须是 read_write 连接)"},
+			"schema":    {Type: protocol.String, Description: "存储过程所在的 Schema"},
+			"procedure": {Type: protocol.String, Description: "存储过程名称"},
+			"params": {
+				Type:        protocol.Array,
+				Description: "(可选) 按位置传入 IN/INOUT 参数的值 (OUT 参数不需要传)，会按声明的参数类型转换；末尾带默认值的参数可以省略",
+				Items:       &protocol.Property{Type: protocol.String, Description: "单个参数 (Schema 定义为 string，但接受任意 JSON 类型)"},
+			},
+			"arg_types": {
+				Type:        protocol.Array,
+				Description: "(可选) 存储过程有多个重载时，用完整的参数类型列表 (包括 OUT 参数) 指定要调用的版本",
+				Items:       &protocol.Property{Type: protocol.String},
+			},
+			IdempotencyKeyArg: IdempotencyKeyProperty,
+		},
+		Required: []string{"conn_id", "schema", "procedure"},
+	},
+}
+
+// CallProcedureToolArgs 是 'call_procedure' 工具的输入参数。
+type CallProcedureToolArgs struct {
+	ConnID    string   `json:"conn_id"`
+	Schema    string   `json:"schema"`
+	Procedure string   `json:"procedure"`
+	Params    []any    `json:"params,omitempty"`
+	ArgTypes  []string `json:"arg_types,omitempty"`
+}
+
+// CallProcedureHandler 处理存储过程调用的工具请求。
+type CallProcedureHandler struct {
+	dbService        databases.Service
+	schemaManager    schemas.Manager
+	idempotencyStore idempotency.Store
+	reviewQueue      *ReviewQueue
+	allowlist        []string // 允许调用的存储过程 (schema.procedure，支持通配符)
+}
+
+// NewCallProcedureHandler 创建一个新的 CallProcedureHandler。allowlist 为空时拒绝所有调用。
+func NewCallProcedureHandler(dbService databases.Service, schemaManager schemas.Manager, idempotencyStore idempotency.Store, reviewQueue *ReviewQueue, allowlist []string) *CallProcedureHandler {
+	return &CallProcedureHandler{
+		dbService:        dbService,
+		schemaManager:    schemaManager,
+		idempotencyStore: idempotencyStore,
+		reviewQueue:      reviewQueue,
+		allowlist:        allowlist,
+	}
+}
+
+// HandleCallProcedure 处理 'call_procedure' 工具的调用请求。
+// 存储过程必须在允许列表中并存在于缓存的 Schema 元数据中，CALL 语句只由缓存中的名称和类型构成，参数值全部通过占位符传入。
+func (h *CallProcedureHandler) HandleCallProcedure(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(CallProcedureToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Schema == "" || args.Procedure == "" {
+		return nil, fmt.Errorf("缺少 'conn_id', 'schema' 或 'procedure' 参数")
+	}
+
+	if !h.allowed(args.Schema, args.Procedure) {
+		utils.DefaultLogger.Warn("拒绝调用不在允许列表中的存储过程", zap.String("connID", args.ConnID), zap.String("procedure", args.Schema+"."+args.Procedure))
+		return newErrorResult(fmt.Sprintf("存储过程 '%s.%s' 不在 PROCEDURE_ALLOWLIST 中", args.Schema, args.Procedure), nil), nil
+	}
+	if err := ensureWritable(h.dbService, args.ConnID); err != nil {
+		return newErrorResult("写入被拒绝", err), nil
+	}
+
+	procedure, err := resolveFunction(h.schemaManager, args.Schema, args.Procedure, "procedure", len(args.Params), args.ArgTypes)
+	if err != nil {
+		return newErrorResult("存储过程校验失败", err), nil
+	}
+	callArgs, err := procedureCallArgs(procedure, len(args.Params))
+	if err != nil {
+		return newErrorResult("存储过程校验失败", err), nil
+	}
+	qualified, err := sqlsafe.QuoteQualified(args.Schema, procedure.Name)
+	if err != nil {
+		return newErrorResult("存储过程校验失败", err), nil
+	}
+	statement := fmt.Sprintf("CALL %s(%s)", qualified, callArgs)
+
+	summary := fmt.Sprintf("调用存储过程 %s.%s(%s)", args.Schema, procedure.Name, strings.Join(procedure.ArgTypes, ", "))
+	return runIdempotent(ctx, h.idempotencyStore, args.ConnID, CallProcedureTool.Name, req, func() (*protocol.CallToolResult, error) {
+		return runReviewed(ctx, h.reviewQueue, args.ConnID, CallProcedureTool.Name, summary, req, func(ctx context.Context) (*protocol.CallToolResult, error) {
+			return h.callProcedure(ctx, args, procedure, statement)
+		})
+	})
+}
+
+// callProcedure 在读写事务中执行 CALL，并读取 OUT/INOUT 参数组成的结果行。
+func (h *CallProcedureHandler) callProcedure(ctx context.Context, args *CallProcedureToolArgs, procedure *schemas.FunctionInfo, statement string) (*protocol.CallToolResult, error) {
+	utils.DefaultLogger.Info("调用存储过程", zap.String("connID", args.ConnID), zap.String("procedure", args.Schema+"."+procedure.Name))
+	// 有 OUT/INOUT 参数时 CALL 返回一行，列名为参数名
+	outputs := map[string]any{}
+	var failure *protocol.CallToolResult
+	err := h.dbService.WriteTx(ctx, args.ConnID, []string{statement}, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, statement, args.Params...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			values, err := rows.Values()
+			if err != nil {
+				failure = newErrorResult("读取 OUT 参数失败", err)
+				return err
+			}
+			for i, field := range rows.FieldDescriptions() {
+				outputs[field.Name] = values[i]
+			}
+		}
+		return rows.Err()
+	})
+	switch {
+	case failure != nil:
+		return failure, nil
+	case errors.Is(err, sqlguard.ErrDenied):
+		return newErrorResult("存储过程调用被访问策略拒绝", err), nil
+	case err != nil:
+		utils.DefaultLogger.Error("存储过程调用失败", zap.String("connID", args.ConnID), zap.String("procedure", args.Schema+"."+procedure.Name), zap.Error(err))
+		return newErrorResult("存储过程调用失败", err), nil
+	}
+
+	utils.DefaultLogger.Info("存储过程调用完成", zap.String("connID", args.ConnID), zap.String("procedure", args.Schema+"."+procedure.Name), zap.Int("outputs", len(outputs)))
+	return newJSONResult(map[string]any{
+		"success":   true,
+		"procedure": args.Schema + "." + procedure.Name + "(" + strings.Join(procedure.ArgTypes, ", ") + ")",
+		"outputs":   outputs,
+	})
+}
+
+// allowed 判断存储过程是否在允许列表中 (名称比较不区分大小写)
+func (h *CallProcedureHandler) allowed(schema, procedure string) bool {
+	name := strings.ToLower(schema + "." + procedure)
+	for _, pattern := range h.allowlist {
+		if matched, err := path.Match(strings.ToLower(pattern), name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// procedureCallArgs 生成 CALL 的参数列表: 输入参数使用带类型的占位符，OUT 参数传入 NULL。
+// 省略末尾带默认值的输入参数时，其后不能再有 OUT 参数 (按位置调用无法跳过)。
+func procedureCallArgs(procedure *schemas.FunctionInfo, paramCount int) (string, error) {
+	callArgs := make([]string, 0, len(procedure.ArgTypes))
+	next := 0
+	for i, argType := range procedure.ArgTypes {
+		if i < len(procedure.ArgModes) && procedure.ArgModes[i] == "out" {
+			callArgs = append(callArgs, "NULL::"+argType)
+			continue
+		}
+		if next == paramCount {
+			for j := i + 1; j < len(procedure.ArgModes); j++ {
+				if procedure.ArgModes[j] == "out" {
+					return "", fmt.Errorf("省略默认参数后仍有 OUT 参数，请传入全部 %d 个输入参数", inputArgCount(*procedure))
+				}
+			}
+			break
+		}
+		next++
+		callArgs = append(callArgs, fmt.Sprintf("$%d::%s", next, argType))
+	}
+	return strings.Join(callArgs, ", "), nil
+}
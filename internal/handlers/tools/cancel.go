@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ListActiveQueriesToolArgs 是 'list_active_queries' 工具的输入参数。
+type ListActiveQueriesToolArgs struct {
+	ConnID string `json:"conn_id,omitempty" description:"(可选) 只列出该连接 ID 下的在途查询"`
+}
+
+// PgCancelToolArgs 是 'pg_cancel' 工具的输入参数。
+type PgCancelToolArgs struct {
+	QueryID string `json:"query_id" description:"list_active_queries 返回的查询 ID"`
+}
+
+// CancelHandler 处理在途查询的查看与取消。
+type CancelHandler struct {
+	dbService databases.Service
+}
+
+// NewCancelHandler 创建一个新的 CancelHandler。
+func NewCancelHandler(dbService databases.Service) *CancelHandler {
+	return &CancelHandler{dbService: dbService}
+}
+
+// HandleListActiveQueries 处理 'list_active_queries' 工具的调用请求。
+func (h *CancelHandler) HandleListActiveQueries(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(ListActiveQueriesToolArgs)
+	if len(req.RawArguments) > 0 { // 所有参数都是可选的，允许不传 arguments
+		if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+			return nil, fmt.Errorf("参数解析错误: %w", err)
+		}
+	}
+	queries := h.dbService.ListActiveQueries(args.ConnID)
+	utils.DefaultLogger.Info("列出在途查询", zap.String("connID", args.ConnID), zap.Int("count", len(queries)))
+	return newJSONResult(queries)
+}
+
+// HandlePgCancel 处理 'pg_cancel' 工具的调用请求。
+func (h *CancelHandler) HandlePgCancel(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(PgCancelToolArgs)
+	if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.QueryID == "" {
+		return nil, fmt.Errorf("缺少 'query_id' 参数")
+	}
+
+	cancelled, err := h.dbService.CancelQuery(ctx, args.QueryID)
+	if err != nil {
+		utils.DefaultLogger.Error("取消查询失败", zap.String("queryID", args.QueryID), zap.Error(err))
+		return newErrorResult("取消查询失败", err), nil
+	}
+	utils.DefaultLogger.Info("查询已取消", zap.String("queryID", args.QueryID), zap.String("connID", cancelled.ConnID))
+	return newJSONResult(map[string]any{"success": true, "cancelled": cancelled})
+}
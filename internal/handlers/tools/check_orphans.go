@@ -0,0 +1,186 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultOrphanSample   = 10
+	maxOrphanSample       = 100
+	defaultOrphanMaxCount = 10000
+	maxOrphanMaxCount     = 1000000
+)
+
+// CheckOrphansToolArgs 是 'check_orphans' 工具的输入参数。
+type CheckOrphansToolArgs struct {
+	ConnID     string `json:"conn_id" description:"目标数据库的连接 ID"`
+	Schema     string `json:"schema" description:"子表 (定义外键的表) 所在的 Schema"`
+	Table      string `json:"table" description:"子表名"`
+	Constraint string `json:"constraint,omitempty" description:"(可选) 只检查该外键约束，默认检查表上的所有外键"`
+	Sample     int    `json:"sample,omitempty" description:"(可选) 每个外键返回的孤儿行样本数，默认 10，最大 100"`
+	MaxCount   int    `json:"max_count,omitempty" description:"(可选) 每个外键最多计数的孤儿行数，默认 10000，超过时只报告下限"`
+}
+
+// OrphanCheck 是一个外键的检查结果
+type OrphanCheck struct {
+	Constraint        string           `json:"constraint"`
+	Columns           []string         `json:"columns"`
+	ReferencedTable   string           `json:"referenced_table"`
+	ReferencedColumns []string         `json:"referenced_columns"`
+	OrphanCount       int64            `json:"orphan_count"`
+	CountCapped       bool             `json:"count_capped,omitempty"` // true 表示孤儿行至少有 orphan_count 行
+	Sample            []map[string]any `json:"sample"`
+	Error             string           `json:"error,omitempty"`
+}
+
+// CheckOrphansHandler 处理引用完整性检查的工具调用。
+type CheckOrphansHandler struct {
+	dbService     databases.Service
+	schemaManager schemas.Manager
+	masker        *masking.Masker
+}
+
+// NewCheckOrphansHandler 创建一个新的 CheckOrphansHandler。
+func NewCheckOrphansHandler(dbService databases.Service, schemaManager schemas.Manager, masker *masking.Masker) *CheckOrphansHandler {
+	return &CheckOrphansHandler{dbService: dbService, schemaManager: schemaManager, masker: masker}
+}
+
+// HandleCheckOrphans 处理 'check_orphans' 工具的调用请求。
+// 对每个外键用 NOT EXISTS 反连接查找父行不存在的子行 (任一外键列为 NULL 的行按 MATCH SIMPLE 语义不检查)，
+// 计数使用 LIMIT 限制扫描量；外键约束被禁用 (触发器关闭) 或以 NOT VALID 添加时可能存在这样的行。
+func (h *CheckOrphansHandler) HandleCheckOrphans(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(CheckOrphansToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Schema == "" || args.Table == "" {
+		return nil, fmt.Errorf("缺少 'conn_id', 'schema' 或 'table' 参数")
+	}
+	sample := args.Sample
+	if sample <= 0 {
+		sample = defaultOrphanSample
+	}
+	sample = min(sample, maxOrphanSample)
+	maxCount := args.MaxCount
+	if maxCount <= 0 {
+		maxCount = defaultOrphanMaxCount
+	}
+	maxCount = min(maxCount, maxOrphanMaxCount)
+
+	// 只允许缓存中存在的表和外键，避免把任意标识符拼进 SQL
+	tableInfo, found := h.schemaManager.GetTableInfo(args.Schema, args.Table)
+	if !found {
+		return newErrorResult(fmt.Sprintf("未找到表 '%s.%s'", args.Schema, args.Table), nil), nil
+	}
+	foreignKeys := tableInfo.ForeignKeys
+	if args.Constraint != "" {
+		foreignKeys = nil
+		for _, fk := range tableInfo.ForeignKeys {
+			if fk.ConstraintName == args.Constraint {
+				foreignKeys = append(foreignKeys, fk)
+			}
+		}
+		if len(foreignKeys) == 0 {
+			return newErrorResult(fmt.Sprintf("表 '%s.%s' 上没有外键约束 '%s'", args.Schema, args.Table, args.Constraint), nil), nil
+		}
+	}
+
+	checks := make([]OrphanCheck, 0, len(foreignKeys))
+	total := int64(0)
+	for _, fk := range foreignKeys {
+		check := h.checkForeignKey(ctx, args, fk, sample, maxCount)
+		total += check.OrphanCount
+		checks = append(checks, check)
+	}
+	utils.DefaultLogger.Info("引用完整性检查完成", zap.String("connID", args.ConnID), zap.String("table", args.Schema+"."+args.Table), zap.Int("foreignKeys", len(checks)), zap.Int64("orphans", total))
+	return newJSONResult(map[string]any{
+		"table":        args.Schema + "." + args.Table,
+		"foreign_keys": checks,
+		"total":        total,
+	})
+}
+
+// checkForeignKey 检查一个外键，错误记录在结果中，不影响其他外键
+func (h *CheckOrphansHandler) checkForeignKey(ctx context.Context, args *CheckOrphansToolArgs, fk schemas.ForeignKeyInfo, sample, maxCount int) OrphanCheck {
+	check := OrphanCheck{
+		Constraint:        fk.ConstraintName,
+		Columns:           fk.Columns,
+		ReferencedTable:   fk.ReferencedSchema + "." + fk.ReferencedTable,
+		ReferencedColumns: fk.ReferencedColumns,
+		Sample:            []map[string]any{},
+	}
+	orphans, err := orphanQuery(args.Schema, args.Table, fk)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+
+	countQuery := fmt.Sprintf("SELECT count(*) AS count FROM (SELECT 1 %s LIMIT $1) AS orphans", orphans)
+	rows, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true, countQuery, maxCount)
+	if err != nil {
+		utils.DefaultLogger.Error("孤儿行计数失败", zap.String("connID", args.ConnID), zap.String("constraint", fk.ConstraintName), zap.Error(err))
+		check.Error = fmt.Sprintf("孤儿行计数失败: %v", err)
+		return check
+	}
+	if len(rows) > 0 {
+		check.OrphanCount = utils.DbInt64(rows[0]["count"])
+	}
+	check.CountCapped = check.OrphanCount >= int64(maxCount)
+	if check.OrphanCount == 0 {
+		return check
+	}
+
+	sampleRows, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true, fmt.Sprintf("SELECT c.* %s LIMIT $1", orphans), sample)
+	if err != nil {
+		check.Error = fmt.Sprintf("读取孤儿行样本失败: %v", err)
+		return check
+	}
+	h.masker.MaskTableRows(args.Schema, args.Table, sampleRows)
+	if sampleRows != nil {
+		check.Sample = sampleRows
+	}
+	return check
+}
+
+// orphanQuery 生成查找孤儿行的 FROM ... WHERE 子句:
+// FROM child c WHERE c.k1 IS NOT NULL AND ... AND NOT EXISTS (SELECT 1 FROM parent p WHERE p.r1 = c.k1 AND ...)
+func orphanQuery(schema, table string, fk schemas.ForeignKeyInfo) (string, error) {
+	if len(fk.Columns) == 0 || len(fk.Columns) != len(fk.ReferencedColumns) {
+		return "", fmt.Errorf("外键 '%s' 的列信息不完整", fk.ConstraintName)
+	}
+	child, err := sqlsafe.QuoteQualified(schema, table)
+	if err != nil {
+		return "", err
+	}
+	parent, err := sqlsafe.QuoteQualified(fk.ReferencedSchema, fk.ReferencedTable)
+	if err != nil {
+		return "", err
+	}
+	notNull := make([]string, len(fk.Columns))
+	joins := make([]string, len(fk.Columns))
+	for i, column := range fk.Columns {
+		childColumn, err := sqlsafe.QuoteIdentifier(column)
+		if err != nil {
+			return "", err
+		}
+		parentColumn, err := sqlsafe.QuoteIdentifier(fk.ReferencedColumns[i])
+		if err != nil {
+			return "", err
+		}
+		notNull[i] = "c." + childColumn + " IS NOT NULL"
+		joins[i] = "p." + parentColumn + " = c." + childColumn
+	}
+	return fmt.Sprintf("FROM %s AS c WHERE %s AND NOT EXISTS (SELECT 1 FROM %s AS p WHERE %s)",
+		child, strings.Join(notNull, " AND "), parent, strings.Join(joins, " AND ")), nil
+}
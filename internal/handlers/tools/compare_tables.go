@@ -0,0 +1,634 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/results"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCompareBatchSize = 1000
+	maxCompareBatchSize     = 10000
+	defaultCompareDiffs     = 100
+	maxCompareDiffs         = 1000
+	maxCompareRowsPerCall   = 200000 // 单次调用每一侧最多扫描的行数，超出后返回 next_cursor
+)
+
+// CompareTablesToolArgs 是 'compare_tables' 工具的输入参数。
+type CompareTablesToolArgs struct {
+	ConnID         string   `json:"conn_id" description:"源表所在的连接 ID"`
+	Table          string   `json:"table" description:"源表 (schema.table)"`
+	TargetConnID   string   `json:"target_conn_id,omitempty" description:"(可选) 目标表所在的连接 ID，默认与 conn_id 相同"`
+	TargetTable    string   `json:"target_table,omitempty" description:"(可选) 目标表 (schema.table)，默认与 table 相同 (此时必须指定不同的 target_conn_id)"`
+	KeyColumns     []string `json:"key_columns,omitempty" description:"(可选) 用于匹配行的键列，默认使用源表的主键；支持数值、文本、日期时间、布尔和 uuid 类型"`
+	Columns        []string `json:"columns,omitempty" description:"(可选) 要比较的列，默认比较两表共有的所有非键列"`
+	BatchSize      int      `json:"batch_size,omitempty" description:"(可选) 每批从每张表读取的行数，默认 1000，最大 10000"`
+	MaxDifferences int      `json:"max_differences,omitempty" description:"(可选) 单次调用最多返回的差异行数，默认 100，最大 1000；达到后返回 next_cursor"`
+	Cursor         string   `json:"cursor,omitempty" description:"(可选) 上一次调用返回的 next_cursor，从上次停止的键继续比较"`
+}
+
+// compareCursor 是 next_cursor 的内容: 已比较到的键和累计统计
+type compareCursor struct {
+	Fingerprint string       `json:"f"`
+	Key         []string     `json:"k"` // 已比较的最后一个键 (文本形式)
+	Totals      CompareStats `json:"t"`
+}
+
+// CompareStats 是比较的行数统计
+type CompareStats struct {
+	SourceRows   int `json:"source_rows"`    // 扫描的源表行数
+	TargetRows   int `json:"target_rows"`    // 扫描的目标表行数
+	Matched      int `json:"matched"`        // 键和值都相同的行
+	Changed      int `json:"changed"`        // 键相同但值不同的行
+	OnlyInSource int `json:"only_in_source"` // 只存在于源表的行
+	OnlyInTarget int `json:"only_in_target"` // 只存在于目标表的行
+}
+
+// ChangedRow 是键相同但值不同的行
+type ChangedRow struct {
+	Key     map[string]any           `json:"key"`
+	Columns map[string]ChangedColumn `json:"columns"`
+}
+
+// ChangedColumn 是一列在两侧的取值
+type ChangedColumn struct {
+	Source any `json:"source"`
+	Target any `json:"target"`
+}
+
+// CompareTablesResult 是 'compare_tables' 工具的返回结果
+type CompareTablesResult struct {
+	KeyColumns           []string         `json:"key_columns"`
+	ComparedColumns      []string         `json:"compared_columns"`
+	ColumnsOnlyInSource  []string         `json:"columns_only_in_source,omitempty"` // 结构差异: 只有源表有的列 (不参与比较)
+	ColumnsOnlyInTarget  []string         `json:"columns_only_in_target,omitempty"`
+	OnlyInSource         []map[string]any `json:"only_in_source"`
+	OnlyInTarget         []map[string]any `json:"only_in_target"`
+	Changed              []ChangedRow     `json:"changed"`
+	Batch                CompareStats     `json:"batch"`  // 本次调用的统计
+	Totals               CompareStats     `json:"totals"` // 包含之前调用的累计统计
+	HasMore              bool             `json:"has_more"`
+	NextCursor           string           `json:"next_cursor,omitempty"`
+	DifferencesTruncated bool             `json:"differences_truncated,omitempty"` // 因达到 max_differences 提前停止
+}
+
+// compareColumn 是表列的元数据
+type compareColumn struct {
+	Name        string
+	Type        string // format_type 的结果
+	Category    string // pg_type.typcategory
+	KeyPosition int    // 在主键中的位置 (从 1 开始)，不是主键列时为 0
+}
+
+// compareSide 是参与比较的一张表
+type compareSide struct {
+	connID  string
+	name    sqlsafe.QualifiedName
+	columns map[string]compareColumn
+	order   []string // 按列号排列的列名
+}
+
+// CompareTablesHandler 处理表数据比较的工具调用。
+type CompareTablesHandler struct {
+	dbService databases.Service
+	masker    *masking.Masker
+}
+
+// NewCompareTablesHandler 创建一个新的 CompareTablesHandler。
+func NewCompareTablesHandler(dbService databases.Service, masker *masking.Masker) *CompareTablesHandler {
+	return &CompareTablesHandler{dbService: dbService, masker: masker}
+}
+
+// HandleCompareTables 处理 'compare_tables' 工具的调用请求。
+// 两侧按键 (文本键使用 "C" 排序规则) 分批有序读取并归并比较，因此两张表可以在不同的连接上；
+// 每次调用最多返回 max_differences 个差异，通过 next_cursor 继续。
+func (h *CompareTablesHandler) HandleCompareTables(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(CompareTablesToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Table == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 或 'table' 参数")
+	}
+	if args.TargetConnID == "" {
+		args.TargetConnID = args.ConnID
+	}
+	if args.TargetTable == "" {
+		args.TargetTable = args.Table
+	}
+	batchSize := args.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultCompareBatchSize
+	}
+	batchSize = min(batchSize, maxCompareBatchSize)
+	maxDiffs := args.MaxDifferences
+	if maxDiffs <= 0 {
+		maxDiffs = defaultCompareDiffs
+	}
+	maxDiffs = min(maxDiffs, maxCompareDiffs)
+
+	source, err := h.loadSide(ctx, args.ConnID, args.Table)
+	if err != nil {
+		return newErrorResult("读取源表结构失败", err), nil
+	}
+	target, err := h.loadSide(ctx, args.TargetConnID, args.TargetTable)
+	if err != nil {
+		return newErrorResult("读取目标表结构失败", err), nil
+	}
+	if args.ConnID == args.TargetConnID && source.name == target.name {
+		return nil, fmt.Errorf("源表和目标表相同，请指定不同的 'target_table' 或 'target_conn_id'")
+	}
+
+	result := &CompareTablesResult{OnlyInSource: []map[string]any{}, OnlyInTarget: []map[string]any{}, Changed: []ChangedRow{}}
+	result.KeyColumns, err = compareKeyColumns(args.KeyColumns, source, target)
+	if err != nil {
+		return newErrorResult("无法确定比较键", err), nil
+	}
+	result.ComparedColumns, result.ColumnsOnlyInSource, result.ColumnsOnlyInTarget, err = comparedColumns(args.Columns, result.KeyColumns, source, target)
+	if err != nil {
+		return newErrorResult("无法确定比较列", err), nil
+	}
+
+	fingerprint := compareFingerprint(args, result.KeyColumns, result.ComparedColumns)
+	var lastKey []string
+	if args.Cursor != "" {
+		cursor, err := decodeCompareCursor(args.Cursor, fingerprint, len(result.KeyColumns))
+		if err != nil {
+			return nil, err
+		}
+		lastKey, result.Totals = cursor.Key, cursor.Totals
+	}
+
+	utils.DefaultLogger.Info("开始比较表数据",
+		zap.String("source", args.ConnID+":"+source.name.String()), zap.String("target", args.TargetConnID+":"+target.name.String()),
+		zap.Strings("keys", result.KeyColumns), zap.Bool("resume", lastKey != nil))
+
+	selected := append(append([]string{}, result.KeyColumns...), result.ComparedColumns...)
+	differences := 0
+	stoppedEarly := false
+	for !stoppedEarly {
+		sourceRows, err := h.fetchBatch(ctx, source, selected, result.KeyColumns, lastKey, batchSize)
+		if err != nil {
+			return newErrorResult("读取源表失败", err), nil
+		}
+		targetRows, err := h.fetchBatch(ctx, target, selected, result.KeyColumns, lastKey, batchSize)
+		if err != nil {
+			return newErrorResult("读取目标表失败", err), nil
+		}
+		sourceFull, targetFull := len(sourceRows) == batchSize, len(targetRows) == batchSize
+		if len(sourceRows) == 0 && len(targetRows) == 0 {
+			break
+		}
+
+		// 只有读满一批的一侧还可能有更多行，本批只比较不超过两侧上界中较小者的键
+		var bound map[string]any
+		switch {
+		case sourceFull && targetFull:
+			bound = sourceRows[len(sourceRows)-1]
+			if compareKeys(targetRows[len(targetRows)-1], bound, result.KeyColumns) < 0 {
+				bound = targetRows[len(targetRows)-1]
+			}
+		case sourceFull:
+			bound = sourceRows[len(sourceRows)-1]
+		case targetFull:
+			bound = targetRows[len(targetRows)-1]
+		}
+		withinBound := func(row map[string]any) bool {
+			return bound == nil || compareKeys(row, bound, result.KeyColumns) <= 0
+		}
+
+		i, j := 0, 0
+		var processed map[string]any
+		for (i < len(sourceRows) && withinBound(sourceRows[i])) || (j < len(targetRows) && withinBound(targetRows[j])) {
+			if differences >= maxDiffs {
+				stoppedEarly = true
+				break
+			}
+			hasSource := i < len(sourceRows) && withinBound(sourceRows[i])
+			hasTarget := j < len(targetRows) && withinBound(targetRows[j])
+			order := 0
+			switch {
+			case hasSource && hasTarget:
+				order = compareKeys(sourceRows[i], targetRows[j], result.KeyColumns)
+			case hasSource:
+				order = -1
+			default:
+				order = 1
+			}
+			switch {
+			case order < 0:
+				processed = sourceRows[i]
+				result.OnlyInSource = append(result.OnlyInSource, sourceRows[i])
+				result.Batch.SourceRows++
+				result.Batch.OnlyInSource++
+				differences++
+				i++
+			case order > 0:
+				processed = targetRows[j]
+				result.OnlyInTarget = append(result.OnlyInTarget, targetRows[j])
+				result.Batch.TargetRows++
+				result.Batch.OnlyInTarget++
+				differences++
+				j++
+			default:
+				processed = sourceRows[i]
+				result.Batch.SourceRows++
+				result.Batch.TargetRows++
+				if changed := diffRow(sourceRows[i], targetRows[j], result.KeyColumns, result.ComparedColumns); changed != nil {
+					result.Changed = append(result.Changed, *changed)
+					result.Batch.Changed++
+					differences++
+				} else {
+					result.Batch.Matched++
+				}
+				i++
+				j++
+			}
+		}
+		if processed != nil {
+			if lastKey, err = keyText(processed, result.KeyColumns); err != nil {
+				return newErrorResult("记录比较位置失败", err), nil
+			}
+		}
+		if stoppedEarly {
+			result.DifferencesTruncated = true
+			result.HasMore = true
+			break
+		}
+		if bound == nil {
+			break // 两侧都已读完
+		}
+		if result.Batch.SourceRows >= maxCompareRowsPerCall || result.Batch.TargetRows >= maxCompareRowsPerCall {
+			result.HasMore = true
+			break
+		}
+	}
+
+	result.Totals = result.Totals.add(result.Batch)
+	if result.HasMore {
+		cursor := compareCursor{Fingerprint: fingerprint, Key: lastKey, Totals: result.Totals}
+		cursorBytes, err := json.Marshal(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("生成 next_cursor 失败: %w", err)
+		}
+		result.NextCursor = base64.RawURLEncoding.EncodeToString(cursorBytes)
+	}
+	h.maskDifferences(source, target, result)
+	utils.DefaultLogger.Info("表数据比较完成", zap.Int("sourceRows", result.Batch.SourceRows), zap.Int("targetRows", result.Batch.TargetRows), zap.Int("differences", differences), zap.Bool("hasMore", result.HasMore))
+	return newJSONResult(result)
+}
+
+// loadSide 读取表的列、类型类别和主键
+func (h *CompareTablesHandler) loadSide(ctx context.Context, connID, table string) (*compareSide, error) {
+	name, err := sqlsafe.ParseQualifiedName(table)
+	if err != nil {
+		return nil, err
+	}
+	if name.Schema == "" {
+		name.Schema = "public"
+	}
+	const query = `
+SELECT a.attname AS name,
+       format_type(a.atttypid, a.atttypmod) AS type,
+       t.typcategory::text AS category,
+       COALESCE(array_position(i.indkey::int2[], a.attnum), 0) AS key_position
+FROM pg_catalog.pg_attribute a
+JOIN pg_catalog.pg_type t ON t.oid = a.atttypid
+LEFT JOIN pg_catalog.pg_index i ON i.indrelid = a.attrelid AND i.indisprimary
+WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`
+	rows, err := h.dbService.ExecuteQuery(ctx, connID, true, query, name.Quoted())
+	if err != nil {
+		return nil, fmt.Errorf("表 '%s': %w", name, err)
+	}
+	side := &compareSide{connID: connID, name: name, columns: make(map[string]compareColumn, len(rows))}
+	for _, row := range rows {
+		column := compareColumn{Name: fmt.Sprint(row["name"]), Type: fmt.Sprint(row["type"]), Category: fmt.Sprint(row["category"]), KeyPosition: int(utils.DbInt64(row["key_position"]))}
+		side.columns[column.Name] = column
+		side.order = append(side.order, column.Name)
+	}
+	if len(side.order) == 0 {
+		return nil, fmt.Errorf("表 '%s' 没有列", name)
+	}
+	return side, nil
+}
+
+// compareKeyColumns 确定比较键: 指定的键列或源表的主键，两侧都必须存在且类型可以比较排序
+func compareKeyColumns(requested []string, source, target *compareSide) ([]string, error) {
+	keys := requested
+	if len(keys) == 0 {
+		positions := map[int]string{}
+		for _, column := range source.columns {
+			if column.KeyPosition > 0 {
+				positions[column.KeyPosition] = column.Name
+			}
+		}
+		for i := 1; i <= len(positions); i++ {
+			keys = append(keys, positions[i])
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("表 '%s' 没有主键，请通过 'key_columns' 指定比较键", source.name)
+		}
+	}
+	for _, key := range keys {
+		sourceColumn, ok := source.columns[key]
+		if !ok {
+			return nil, fmt.Errorf("源表中没有键列 '%s'", key)
+		}
+		targetColumn, ok := target.columns[key]
+		if !ok {
+			return nil, fmt.Errorf("目标表中没有键列 '%s'", key)
+		}
+		if !sortableKey(sourceColumn) || !sortableKey(targetColumn) {
+			return nil, fmt.Errorf("键列 '%s' 的类型 (%s / %s) 不支持比较，请使用数值、文本、日期时间、布尔或 uuid 列", key, sourceColumn.Type, targetColumn.Type)
+		}
+		if sourceColumn.Category != targetColumn.Category {
+			return nil, fmt.Errorf("键列 '%s' 在两侧的类型不兼容 (%s / %s)", key, sourceColumn.Type, targetColumn.Type)
+		}
+	}
+	return keys, nil
+}
+
+// sortableKey 返回列的排序在 PostgreSQL 和本服务中是否一致:
+// 数值 (N)、日期时间 (D)、布尔 (B)、uuid，以及按 "C" 排序规则比较的文本 (S)
+func sortableKey(column compareColumn) bool {
+	switch column.Category {
+	case "N", "D", "B", "S":
+		return true
+	}
+	return column.Type == "uuid"
+}
+
+// comparedColumns 确定比较的列，并返回只存在于一侧的列
+func comparedColumns(requested, keys []string, source, target *compareSide) (compared, onlySource, onlyTarget []string, err error) {
+	isKey := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		isKey[key] = true
+	}
+	for _, name := range source.order {
+		if _, ok := target.columns[name]; !ok {
+			onlySource = append(onlySource, name)
+		}
+	}
+	for _, name := range target.order {
+		if _, ok := source.columns[name]; !ok {
+			onlyTarget = append(onlyTarget, name)
+		}
+	}
+	if len(requested) > 0 {
+		for _, name := range requested {
+			_, inSource := source.columns[name]
+			_, inTarget := target.columns[name]
+			if !inSource || !inTarget {
+				return nil, nil, nil, fmt.Errorf("列 '%s' 不同时存在于两张表中", name)
+			}
+			if !isKey[name] {
+				compared = append(compared, name)
+			}
+		}
+		return compared, onlySource, onlyTarget, nil
+	}
+	compared = []string{}
+	for _, name := range source.order {
+		if _, ok := target.columns[name]; ok && !isKey[name] {
+			compared = append(compared, name)
+		}
+	}
+	return compared, onlySource, onlyTarget, nil
+}
+
+// fetchBatch 按键顺序读取键大于 lastKey 的下一批行
+func (h *CompareTablesHandler) fetchBatch(ctx context.Context, side *compareSide, columns, keys []string, lastKey []string, batchSize int) ([]map[string]any, error) {
+	selectList := make([]string, len(columns))
+	for i, name := range columns {
+		quoted, err := sqlsafe.QuoteIdentifier(name)
+		if err != nil {
+			return nil, err
+		}
+		selectList[i] = quoted
+	}
+	keyExprs := make([]string, len(keys))
+	for i, key := range keys {
+		quoted, _ := sqlsafe.QuoteIdentifier(key)
+		keyExprs[i] = quoted
+		// 文本键按字节序比较，使两侧 (可能使用不同排序规则的数据库) 的顺序与本服务的比较一致
+		if side.columns[key].Category == "S" {
+			keyExprs[i] = quoted + ` COLLATE "C"`
+		}
+	}
+	var sb strings.Builder
+	var params []any
+	fmt.Fprintf(&sb, "SELECT %s FROM %s", strings.Join(selectList, ", "), side.name.Quoted())
+	if lastKey != nil {
+		placeholders := make([]string, len(lastKey))
+		for i, value := range lastKey {
+			params = append(params, value)
+			placeholders[i] = fmt.Sprintf("$%d", len(params))
+		}
+		fmt.Fprintf(&sb, " WHERE (%s) > (%s)", strings.Join(keyExprs, ", "), strings.Join(placeholders, ", "))
+	}
+	params = append(params, batchSize)
+	fmt.Fprintf(&sb, " ORDER BY %s LIMIT $%d", strings.Join(keyExprs, ", "), len(params))
+	return h.dbService.ExecuteQuery(ctx, side.connID, true, sb.String(), params...)
+}
+
+// maskDifferences 按各自表的脱敏规则处理返回的差异行 (比较使用原始值)
+func (h *CompareTablesHandler) maskDifferences(source, target *compareSide, result *CompareTablesResult) {
+	h.masker.MaskTableRows(source.name.Schema, source.name.Name, result.OnlyInSource)
+	h.masker.MaskTableRows(target.name.Schema, target.name.Name, result.OnlyInTarget)
+	for i := range result.Changed {
+		h.masker.MaskTableRows(source.name.Schema, source.name.Name, []map[string]any{result.Changed[i].Key})
+		for name, column := range result.Changed[i].Columns {
+			sourceRow := []map[string]any{{name: column.Source}}
+			targetRow := []map[string]any{{name: column.Target}}
+			h.masker.MaskTableRows(source.name.Schema, source.name.Name, sourceRow)
+			h.masker.MaskTableRows(target.name.Schema, target.name.Name, targetRow)
+			result.Changed[i].Columns[name] = ChangedColumn{Source: sourceRow[0][name], Target: targetRow[0][name]}
+		}
+	}
+}
+
+// diffRow 比较键相同的两行，值都相同时返回 nil
+func diffRow(source, target map[string]any, keys, columns []string) *ChangedRow {
+	var changed map[string]ChangedColumn
+	for _, name := range columns {
+		if !equalValues(source[name], target[name]) {
+			if changed == nil {
+				changed = make(map[string]ChangedColumn)
+			}
+			changed[name] = ChangedColumn{Source: source[name], Target: target[name]}
+		}
+	}
+	if changed == nil {
+		return nil
+	}
+	key := make(map[string]any, len(keys))
+	for _, name := range keys {
+		key[name] = source[name]
+	}
+	return &ChangedRow{Key: key, Columns: changed}
+}
+
+// equalValues 比较两个值: 时间按时刻比较，数值按数值比较 (1.50 等于 1.5)，其他按文本比较
+func equalValues(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Equal(tb)
+		}
+	}
+	textA, textB := results.FormatValue(a), results.FormatValue(b)
+	if textA == textB {
+		return true
+	}
+	ra, okA := numericValue(a)
+	rb, okB := numericValue(b)
+	return okA && okB && ra.Cmp(rb) == 0
+}
+
+// compareKeys 按键列比较两行的顺序 (与 ORDER BY 一致)
+func compareKeys(a, b map[string]any, keys []string) int {
+	for _, key := range keys {
+		if order := compareKeyValue(a[key], b[key]); order != 0 {
+			return order
+		}
+	}
+	return 0
+}
+
+// compareKeyValue 比较两个键值: 数值按数值，时间按时刻，布尔 false 在前，uuid 按字节，文本按字节序 ("C" 排序规则)
+func compareKeyValue(a, b any) int {
+	if ra, ok := numericValue(a); ok {
+		if rb, ok := numericValue(b); ok {
+			return ra.Cmp(rb)
+		}
+	}
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Compare(tb)
+		}
+	}
+	if ba, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok {
+			switch {
+			case ba == bb:
+				return 0
+			case !ba:
+				return -1
+			}
+			return 1
+		}
+	}
+	if ua, ok := a.([16]byte); ok {
+		if ub, ok := b.([16]byte); ok {
+			return bytes.Compare(ua[:], ub[:])
+		}
+	}
+	return strings.Compare(results.FormatValue(a), results.FormatValue(b))
+}
+
+// numericValue 把整数、浮点数和 numeric 转换为精确的有理数
+func numericValue(value any) (*big.Rat, bool) {
+	switch v := value.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case int32:
+		return new(big.Rat).SetInt64(int64(v)), true
+	case int16:
+		return new(big.Rat).SetInt64(int64(v)), true
+	case float64:
+		r := new(big.Rat)
+		if r.SetFloat64(v) == nil {
+			return nil, false
+		}
+		return r, true
+	case float32:
+		r := new(big.Rat)
+		if r.SetFloat64(float64(v)) == nil {
+			return nil, false
+		}
+		return r, true
+	case driver.Valuer:
+		driverValue, err := v.Value()
+		if err != nil {
+			return nil, false
+		}
+		if text, ok := driverValue.(string); ok {
+			return new(big.Rat).SetString(text)
+		}
+	}
+	return nil, false
+}
+
+// keyText 返回行的键值 (文本形式)，用于 next_cursor
+func keyText(row map[string]any, keys []string) ([]string, error) {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		if row[key] == nil {
+			return nil, fmt.Errorf("键列 '%s' 存在 NULL 值，比较键必须非空", key)
+		}
+		text, err := cursorText(row[key])
+		if err != nil {
+			return nil, fmt.Errorf("键列 '%s': %w", key, err)
+		}
+		values[i] = text
+	}
+	return values, nil
+}
+
+// compareFingerprint 计算比较参数的摘要，防止游标被用于不同的比较
+func compareFingerprint(args *CompareTablesToolArgs, keys, columns []string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		args.ConnID, args.Table, args.TargetConnID, args.TargetTable, strings.Join(keys, ","), strings.Join(columns, ","),
+	}, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// decodeCompareCursor 解析并校验调用方传回的游标
+func decodeCompareCursor(encoded, fingerprint string, keyCount int) (*compareCursor, error) {
+	cursorBytes, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 'cursor': %w", err)
+	}
+	cursor := new(compareCursor)
+	if err := json.Unmarshal(cursorBytes, cursor); err != nil {
+		return nil, fmt.Errorf("无效的 'cursor': %w", err)
+	}
+	if cursor.Fingerprint != fingerprint {
+		return nil, fmt.Errorf("'cursor' 与当前的表、键列或比较列不匹配，请重新开始比较")
+	}
+	if len(cursor.Key) != keyCount {
+		return nil, fmt.Errorf("'cursor' 中的键值数量与键列不一致")
+	}
+	return cursor, nil
+}
+
+// add 返回两个统计之和
+func (s CompareStats) add(other CompareStats) CompareStats {
+	return CompareStats{
+		SourceRows:   s.SourceRows + other.SourceRows,
+		TargetRows:   s.TargetRows + other.TargetRows,
+		Matched:      s.Matched + other.Matched,
+		Changed:      s.Changed + other.Changed,
+		OnlyInSource: s.OnlyInSource + other.OnlyInSource,
+		OnlyInTarget: s.OnlyInTarget + other.OnlyInTarget,
+	}
+}
@@ -34,8 +34,9 @@ func (h *ConnectionHandler) HandleConnect(ctx context.Context, req *protocol.Cal
 		return nil, fmt.Errorf("缺少或无效的 'connection_string' 参数") // 返回错误给框架
 	}
 
-	// 2. 调用数据库服务注册连接
-	connID, err := h.dbService.RegisterConnection(ctx, connString)
+	// 2. 调用数据库服务注册连接 (access_mode 为空时为只读)
+	accessMode, _ := req.Arguments["access_mode"].(string)
+	connID, err := h.dbService.RegisterConnection(ctx, connString, databases.ConnectionOptions{AccessMode: accessMode})
 	if err != nil {
 		utils.DefaultLogger.Error("注册数据库连接失败", zap.String("connStringPrefix", connString[:min(len(connString), 20)]), zap.Error(err))
 		// 返回包含错误信息的 CallToolResult
@@ -0,0 +1,180 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/shards"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// maxCrossDBConnections 是单次 'cross_db_query' 调用允许的连接数上限
+const maxCrossDBConnections = 20
+
+// CrossDBQueryToolArgs 是 'cross_db_query' 工具的输入参数。
+type CrossDBQueryToolArgs struct {
+	ConnIDs     []string       `json:"conn_ids,omitempty"`
+	ShardGroup  string         `json:"shard_group,omitempty"`       // 分片组名称，替代 conn_ids
+	RoutingKey  any            `json:"routing_key_value,omitempty"` // 指定时只在该取值所在的分片上执行
+	Query       string         `json:"query"`
+	Params      []any          `json:"params,omitempty"`
+	NamedParams map[string]any `json:"named_params,omitempty"`
+}
+
+// CrossDBQueryTool 是 'cross_db_query' 工具的定义。
+// params 的元素可以是任意 JSON 类型，Schema 中定义为 string (与 pg_query 的 params 相同的妥协)。
+// 可以用 shard_group 代替 conn_ids，在分片组的所有分片上扇出，或配合 routing_key_value 只路由到一个分片。
+var CrossDBQueryTool = &protocol.Tool{
+	Name:        "cross_db_query",
+	Description: "在多个连接上并发执行同一个只读查询，按连接 ID 返回各自的结果或错误，用于对比不同环境或分片",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"conn_ids":          {Type: protocol.Array, Description: fmt.Sprintf("(与 shard_group 二选一) 目标数据库的连接 ID 列表 (最多 %d 个)", maxCrossDBConnections), Items: &protocol.Property{Type: protocol.String}},
+			"shard_group":       {Type: protocol.String, Description: "(与 conn_ids 二选一) 通过 register_shard_group 注册的分片组名称"},
+			"routing_key_value": {Type: protocol.String, Description: "(可选, 需配合 shard_group) 路由键的取值，指定时只在对应分片上执行 (Schema 定义为 string，但接受数字)"},
+			"query":             {Type: protocol.String, Description: "要在每个连接上执行的只读 SQL 查询"},
+			"params": {
+				Type:        protocol.Array,
+				Description: "(可选) 查询参数列表 ($1, $2...)",
+				Items:       &protocol.Property{Type: protocol.String, Description: "数组中的单个参数 (Schema 定义为 string，但接受任意 JSON 类型)"},
+			},
+			"named_params": {Type: protocol.ObjectT, Description: "(可选) 命名参数对象，对应查询中的 :name 占位符"},
+		},
+		Required: []string{"query"},
+	},
+}
+
+// crossDBResult 是单个连接上的执行结果
+type crossDBResult struct {
+	Rows       []map[string]any `json:"rows,omitempty"`
+	RowCount   int              `json:"row_count"`
+	DurationMs int64            `json:"duration_ms"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// CrossDBHandler 处理跨连接查询的工具调用。
+type CrossDBHandler struct {
+	dbService databases.Service
+	shards    *shards.Registry
+	masker    *masking.Masker
+}
+
+// NewCrossDBHandler 创建一个新的 CrossDBHandler。
+func NewCrossDBHandler(dbService databases.Service, shardRegistry *shards.Registry, masker *masking.Masker) *CrossDBHandler {
+	return &CrossDBHandler{dbService: dbService, shards: shardRegistry, masker: masker}
+}
+
+// HandleCrossDBQuery 处理 'cross_db_query' 工具的调用请求。
+// 单个连接失败不影响其他连接，错误记录在该连接的结果中。
+func (h *CrossDBHandler) HandleCrossDBQuery(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(CrossDBQueryToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.Query == "" {
+		return nil, fmt.Errorf("缺少 'query' 参数")
+	}
+	targets, err := h.resolveTargets(args)
+	if err != nil {
+		return nil, err
+	}
+	connIDs := make([]string, 0, len(targets))
+	seen := make(map[string]bool, len(targets))
+	for _, connID := range targets {
+		if connID != "" && !seen[connID] {
+			seen[connID] = true
+			connIDs = append(connIDs, connID)
+		}
+	}
+	if len(connIDs) > maxCrossDBConnections {
+		return nil, fmt.Errorf("'conn_ids' 最多包含 %d 个连接，实际为 %d 个", maxCrossDBConnections, len(connIDs))
+	}
+	query, params, err := BindNamedParams(args.Query, args.Params, args.NamedParams)
+	if err != nil {
+		return nil, fmt.Errorf("参数绑定错误: %w", err)
+	}
+
+	results := make(map[string]*crossDBResult, len(connIDs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, connID := range connIDs {
+		wg.Add(1)
+		go func(connID string) {
+			defer wg.Done()
+			started := time.Now()
+			queryResult, err := h.dbService.QueryWithColumns(ctx, connID, true, query, params...)
+			result := &crossDBResult{DurationMs: time.Since(started).Milliseconds()}
+			if err == nil {
+				// 每个连接的来源表 OID 不同，分别脱敏
+				if err = h.masker.MaskResult(ctx, connID, queryResult); err != nil {
+					err = fmt.Errorf("结果脱敏失败: %w", err)
+				}
+			}
+			if err != nil {
+				utils.DefaultLogger.Warn("跨连接查询在单个连接上失败", zap.String("connID", connID), zap.Error(err))
+				result.Error = err.Error()
+			} else {
+				result.Rows, result.RowCount = queryResult.Rows, len(queryResult.Rows)
+				if result.Rows == nil {
+					result.Rows = []map[string]any{}
+				}
+			}
+			mu.Lock()
+			results[connID] = result
+			mu.Unlock()
+		}(connID)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	utils.DefaultLogger.Info("跨连接查询完成", zap.Int("connections", len(connIDs)), zap.Int("failed", failed), zap.String("shardGroup", args.ShardGroup))
+	response := map[string]any{
+		"results": results,
+		"failed":  failed,
+	}
+	if args.ShardGroup != "" {
+		response["shard_group"] = args.ShardGroup
+	}
+	return newJSONResult(response)
+}
+
+// resolveTargets 返回要执行查询的连接 ID: 直接使用 conn_ids，或展开分片组 (指定路由键取值时只取对应分片)
+func (h *CrossDBHandler) resolveTargets(args *CrossDBQueryToolArgs) ([]string, error) {
+	if args.ShardGroup == "" {
+		if len(args.ConnIDs) == 0 {
+			return nil, fmt.Errorf("缺少 'conn_ids' 或 'shard_group' 参数")
+		}
+		if args.RoutingKey != nil {
+			return nil, fmt.Errorf("'routing_key_value' 需要配合 'shard_group' 使用")
+		}
+		return args.ConnIDs, nil
+	}
+	if len(args.ConnIDs) > 0 {
+		return nil, fmt.Errorf("'conn_ids' 和 'shard_group' 只能提供一个")
+	}
+	group, err := h.shards.Get(args.ShardGroup)
+	if err != nil {
+		return nil, err
+	}
+	if args.RoutingKey == nil {
+		return group.ConnIDs, nil
+	}
+	connID, err := group.Route(args.RoutingKey)
+	if err != nil {
+		return nil, fmt.Errorf("分片路由失败: %w", err)
+	}
+	return []string{connID}, nil
+}
@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ExportDataDictionaryToolArgs 是 'export_data_dictionary' 工具的输入参数。
+type ExportDataDictionaryToolArgs struct {
+	Schemas    []string `json:"schemas,omitempty" description:"(可选) 要导出的 Schema 名称列表，默认导出缓存中的全部 Schema"`
+	WriteFiles bool     `json:"write_files,omitempty" description:"(可选) 为 true 时把每个 Schema 的文档写入服务端导出目录并返回文件路径 (或 URL)，而不是直接返回文档内容"`
+}
+
+// DataDictionaryHandler 处理导出数据字典的工具调用。
+type DataDictionaryHandler struct {
+	schemaManager schemas.Manager
+	dir           string // 导出文件目录 (与 export_query 相同)
+	baseURL       string // 导出目录对外访问的 URL 前缀，为空时只返回文件路径
+}
+
+// NewDataDictionaryHandler 创建一个新的 DataDictionaryHandler。
+func NewDataDictionaryHandler(schemaManager schemas.Manager, cfg *config.Config) *DataDictionaryHandler {
+	return &DataDictionaryHandler{
+		schemaManager: schemaManager,
+		dir:           cfg.ExportDir,
+		baseURL:       cfg.ExportBaseURL,
+	}
+}
+
+// HandleExportDataDictionary 处理 'export_data_dictionary' 工具的调用请求。
+// 基于缓存的元数据为每个 Schema 生成一份 Markdown 数据字典 (表和列的注释, 外键, 大致行数, 索引, 视图, 类型, 函数)，
+// 不查询数据库；每个 Schema 的文档作为一个文本内容块返回，或写入导出目录。
+func (h *DataDictionaryHandler) HandleExportDataDictionary(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(ExportDataDictionaryToolArgs)
+	if len(req.RawArguments) > 0 {
+		if err := json.Unmarshal(req.RawArguments, args); err != nil {
+			return nil, fmt.Errorf("参数解析错误: %w", err)
+		}
+	}
+
+	info, ok := h.schemaManager.GetDatabaseInfo()
+	if !ok {
+		return newErrorResult("Schema 缓存尚未加载", nil), nil
+	}
+	selected := make([]*schemas.SchemaInfo, 0, len(info.Schemas))
+	if len(args.Schemas) == 0 {
+		for i := range info.Schemas {
+			selected = append(selected, &info.Schemas[i])
+		}
+	} else {
+		for _, name := range args.Schemas {
+			schemaInfo, found := h.schemaManager.GetSchemaInfo(name)
+			if !found {
+				return newErrorResult(fmt.Sprintf("Schema '%s' 不存在或未被缓存", name), nil), nil
+			}
+			selected = append(selected, schemaInfo)
+		}
+	}
+
+	if !args.WriteFiles {
+		result := &protocol.CallToolResult{Content: make([]protocol.Content, 0, len(selected))}
+		for _, schemaInfo := range selected {
+			result.Content = append(result.Content, protocol.TextContent{Type: "text", Text: schemas.RenderDataDictionary(info, schemaInfo)})
+		}
+		return result, nil
+	}
+
+	if err := os.MkdirAll(h.dir, 0o755); err != nil {
+		return newErrorResult("创建导出目录失败", err), nil
+	}
+	timestamp := time.Now().Format("20060102T150405")
+	files := make([]map[string]any, 0, len(selected))
+	for _, schemaInfo := range selected {
+		if err := ctx.Err(); err != nil {
+			return newErrorResult("导出数据字典被中断", err), nil
+		}
+		document := schemas.RenderDataDictionary(info, schemaInfo)
+		fileName := fmt.Sprintf("data_dictionary_%s_%s.md", sanitizeFileName(schemaInfo.Name), timestamp)
+		filePath := filepath.Join(h.dir, fileName)
+		if err := os.WriteFile(filePath, []byte(document), 0o644); err != nil {
+			return newErrorResult("写入数据字典文件失败", err), nil
+		}
+		absPath, _ := filepath.Abs(filePath)
+		file := map[string]any{"schema": schemaInfo.Name, "path": absPath, "bytes": len(document)}
+		if h.baseURL != "" {
+			file["url"] = strings.TrimRight(h.baseURL, "/") + "/" + url.PathEscape(fileName)
+		}
+		files = append(files, file)
+	}
+	utils.DefaultLogger.Info("数据字典已导出", zap.Int("schemas", len(files)), zap.String("dir", h.dir))
+	return newJSONResult(map[string]any{"success": true, "files": files})
+}
+
+// sanitizeFileName 把 Schema 名中不适合出现在文件名里的字符替换为下划线
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == '*' || r == '?' || r == '"' || r == '<' || r == '>' || r == '|' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDistinctValuesLimit = 50
+	maxDistinctValuesLimit     = 500
+
+	// 估算行数超过该值时使用 TABLESAMPLE 抽样统计，避免对大表全表扫描
+	distinctValuesSampleThreshold = 1000000
+	// 抽样时期望扫描的行数
+	distinctValuesSampleRows = 100000
+	// TABLESAMPLE 的最小百分比，避免超大表上算出的百分比过小而抽不到任何行
+	minTableSamplePercent = 0.0001
+)
+
+// DistinctValuesToolArgs 是 'column_distinct_values' 工具的输入参数。
+type DistinctValuesToolArgs struct {
+	ConnID string `json:"conn_id" description:"目标数据库的连接 ID"`
+	Schema string `json:"schema" description:"表所在的 Schema"`
+	Table  string `json:"table" description:"表名"`
+	Column string `json:"column" description:"列名"`
+	Limit  int    `json:"limit,omitempty" description:"(可选) 返回的不同值数量上限，默认 50，最大 500"`
+}
+
+// DistinctValuesHandler 处理列不同值采样的工具调用。
+type DistinctValuesHandler struct {
+	dbService     databases.Service
+	schemaManager schemas.Manager
+	masker        *masking.Masker
+}
+
+// NewDistinctValuesHandler 创建一个新的 DistinctValuesHandler。
+func NewDistinctValuesHandler(dbService databases.Service, schemaManager schemas.Manager, masker *masking.Masker) *DistinctValuesHandler {
+	return &DistinctValuesHandler{dbService: dbService, schemaManager: schemaManager, masker: masker}
+}
+
+// HandleDistinctValues 处理 'column_distinct_values' 工具的调用请求。
+// 返回按出现次数降序排列的不同值及其计数，适合为枚举类文本列找到合法的过滤值。
+func (h *DistinctValuesHandler) HandleDistinctValues(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(DistinctValuesToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Schema == "" || args.Table == "" || args.Column == "" {
+		return nil, fmt.Errorf("缺少 'conn_id', 'schema', 'table' 或 'column' 参数")
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultDistinctValuesLimit
+	}
+	if limit > maxDistinctValuesLimit {
+		limit = maxDistinctValuesLimit
+	}
+
+	// 只允许缓存中存在的表和列，避免把任意标识符拼进 SQL
+	tableInfo, found := h.schemaManager.GetTableInfo(args.Schema, args.Table)
+	if !found {
+		return newErrorResult(fmt.Sprintf("未找到表 '%s.%s'", args.Schema, args.Table), nil), nil
+	}
+	columnFound := false
+	for _, col := range tableInfo.Columns {
+		if col.Name == args.Column {
+			columnFound = true
+			break
+		}
+	}
+	if !columnFound {
+		return newErrorResult(fmt.Sprintf("表 '%s.%s' 中不存在列 '%s'", args.Schema, args.Table, args.Column), nil), nil
+	}
+	// 脱敏列的不同值及其计数本身就会泄露原始数据 (脱敏后的值也无法用作过滤条件)
+	if h.masker.ModeFor(args.Schema, args.Table, args.Column) != "" {
+		return newErrorResult(fmt.Sprintf("列 '%s.%s.%s' 已配置脱敏，不能查询其不同值", args.Schema, args.Table, args.Column), nil), nil
+	}
+
+	source, err := sqlsafe.QuoteQualified(args.Schema, args.Table)
+	if err != nil {
+		return newErrorResult("无效的表名", err), nil
+	}
+	column, err := sqlsafe.QuoteIdentifier(args.Column)
+	if err != nil {
+		return newErrorResult("无效的列名", err), nil
+	}
+	sampled := tableInfo.RowCount > distinctValuesSampleThreshold
+	if sampled {
+		source += tableSampleClause(distinctValuesSampleRows, tableInfo.RowCount)
+	}
+	// 多取一行用于判断是否还有更多不同值
+	query := fmt.Sprintf("SELECT %s AS value, count(*) AS count FROM %s GROUP BY 1 ORDER BY 2 DESC, 1 LIMIT $1", column, source)
+
+	results, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true, query, limit+1)
+	if err != nil {
+		utils.DefaultLogger.Error("查询列不同值失败", zap.String("connID", args.ConnID), zap.String("table", args.Schema+"."+args.Table), zap.String("column", args.Column), zap.Error(err))
+		return newErrorResult("查询列不同值失败", err), nil
+	}
+	truncated := len(results) > limit
+	if truncated {
+		results = results[:limit]
+	}
+
+	utils.DefaultLogger.Info("列不同值查询完成", zap.String("connID", args.ConnID), zap.String("table", args.Schema+"."+args.Table), zap.String("column", args.Column), zap.Int("count", len(results)), zap.Bool("sampled", sampled))
+	return newJSONResult(map[string]any{
+		"values":    results,
+		"truncated": truncated, // true 表示还有更多不同值未返回
+		"sampled":   sampled,   // true 表示计数来自抽样，只代表相对频率
+	})
+}
+
+// tableSampleClause 返回按估算行数抽取约 sampleRows 行的 TABLESAMPLE SYSTEM 子句。
+// 百分比限制在 [minTableSamplePercent, 100] 之间，并用 %g 输出，超大表上不会被格式化为 0。
+func tableSampleClause(sampleRows, rowCount int64) string {
+	percent := 100.0
+	if rowCount > 0 {
+		percent = float64(sampleRows) * 100 / float64(rowCount)
+	}
+	if percent < minTableSamplePercent {
+		percent = minTableSamplePercent
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	return fmt.Sprintf(" TABLESAMPLE SYSTEM (%g)", percent)
+}
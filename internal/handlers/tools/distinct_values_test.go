@@ -0,0 +1,26 @@
+package tools
+
+import "testing"
+
+func TestTableSampleClause(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRows int64
+		rowCount   int64
+		want       string
+	}{
+		{name: "普通大表", sampleRows: 100000, rowCount: 2000000, want: " TABLESAMPLE SYSTEM (5)"},
+		{name: "小数百分比", sampleRows: 100000, rowCount: 30000000, want: " TABLESAMPLE SYSTEM (0.3333333333333333)"},
+		{name: "超大表不会格式化为 0", sampleRows: 100000, rowCount: 5000000000, want: " TABLESAMPLE SYSTEM (0.002)"},
+		{name: "百分比低于下限", sampleRows: 100000, rowCount: 1000000000000000, want: " TABLESAMPLE SYSTEM (0.0001)"},
+		{name: "不超过 100", sampleRows: 100000, rowCount: 10, want: " TABLESAMPLE SYSTEM (100)"},
+		{name: "行数未知", sampleRows: 100000, rowCount: 0, want: " TABLESAMPLE SYSTEM (100)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tableSampleClause(tt.sampleRows, tt.rowCount); got != tt.want {
+				t.Errorf("tableSampleClause(%d, %d) = %q, want %q", tt.sampleRows, tt.rowCount, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+// 冗余索引的种类 (RedundantIndex.Kind)
+const (
+	IndexDuplicate   = "duplicate"   // 与另一个索引的方法、键、INCLUDE 列和谓词完全相同
+	IndexOverlapping = "overlapping" // 键是另一个 btree 索引键的前缀 (或被其 INCLUDE 列覆盖)，查询可以改用后者
+)
+
+// indexSizeQuery 读取冗余索引的大小、扫描次数以及依赖它的约束 (主键、唯一、排他约束)
+const indexSizeQuery = `
+SELECT n.nspname AS schema, c.relname AS index,
+       pg_relation_size(c.oid) AS index_bytes,
+       pg_size_pretty(pg_relation_size(c.oid)) AS index_size,
+       coalesce(s.idx_scan, 0) AS index_scans,
+       (SELECT string_agg(con.conname, ', ') FROM pg_constraint con
+        WHERE con.conindid = c.oid AND con.contype IN ('p', 'u', 'x')) AS backs_constraint
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+LEFT JOIN pg_stat_user_indexes s ON s.indexrelid = c.oid
+WHERE c.relkind IN ('i', 'I')
+  AND (n.nspname, c.relname) IN (SELECT * FROM unnest($1::text[], $2::text[]))`
+
+// FindDuplicateIndexesToolArgs 是 'find_duplicate_indexes' 工具的输入参数。
+type FindDuplicateIndexesToolArgs struct {
+	ConnID string `json:"conn_id" description:"目标数据库的连接 ID (用于读取索引大小和扫描次数)"`
+	Schema string `json:"schema,omitempty" description:"(可选) 只检查该 Schema，默认检查缓存中的所有 Schema"`
+	Table  string `json:"table,omitempty" description:"(可选) 只检查该表，需要同时指定 schema"`
+}
+
+// RedundantIndex 是一个可以删除的冗余索引
+type RedundantIndex struct {
+	Table           string `json:"table"`
+	Index           string `json:"index"`
+	Definition      string `json:"definition"`
+	Kind            string `json:"kind"`       // IndexDuplicate 或 IndexOverlapping
+	CoveredBy       string `json:"covered_by"` // 能代替它的索引
+	CoveredByDef    string `json:"covered_by_definition"`
+	WastedBytes     *int64 `json:"wasted_bytes"` // 删除后可回收的空间 (读取大小失败时为 null)
+	WastedSize      string `json:"wasted_size,omitempty"`
+	IndexScans      *int64 `json:"index_scans,omitempty"`      // 统计重置以来被扫描的次数
+	BacksConstraint string `json:"backs_constraint,omitempty"` // 依赖该索引的约束，需要删除约束而不是索引
+	Recommendation  string `json:"recommendation"`
+
+	schema string
+}
+
+// indexShape 是从 pg_get_indexdef 解析出的索引结构
+type indexShape struct {
+	method    string
+	keys      []string // 键列或表达式，包含排序方向、排序规则和非默认操作符类
+	include   []string
+	predicate string
+	options   string // WITH (...) 存储参数，不影响能否代替
+}
+
+// FindDuplicateIndexesHandler 处理冗余索引检测的工具调用。
+type FindDuplicateIndexesHandler struct {
+	dbService     databases.Service
+	schemaManager schemas.Manager
+}
+
+// NewFindDuplicateIndexesHandler 创建一个新的 FindDuplicateIndexesHandler。
+func NewFindDuplicateIndexesHandler(dbService databases.Service, schemaManager schemas.Manager) *FindDuplicateIndexesHandler {
+	return &FindDuplicateIndexesHandler{dbService: dbService, schemaManager: schemaManager}
+}
+
+// HandleFindDuplicateIndexes 处理 'find_duplicate_indexes' 工具的调用请求。
+// 比较缓存中同一张表上的索引定义: 完全相同的索引保留主键 > 唯一 > 普通索引中的一个；
+// 非唯一 btree 索引的键是另一个 btree 索引键的前缀且谓词相同时视为被覆盖。
+// 缓存在 Schema 加载时生成，之后新建或删除的索引需要重新加载 Schema 才能反映。
+func (h *FindDuplicateIndexesHandler) HandleFindDuplicateIndexes(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(FindDuplicateIndexesToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 参数")
+	}
+	if args.Table != "" && args.Schema == "" {
+		return nil, fmt.Errorf("指定 'table' 时需要同时指定 'schema'")
+	}
+	dbInfo, found := h.schemaManager.GetDatabaseInfo()
+	if !found {
+		return newErrorResult("Schema 缓存尚未加载", nil), nil
+	}
+	policies := h.dbService.Policies(args.ConnID)
+
+	redundant := []RedundantIndex{}
+	tablesChecked, indexesChecked := 0, 0
+	for _, schemaInfo := range dbInfo.Schemas {
+		if (args.Schema != "" && schemaInfo.Name != args.Schema) || !policies.SchemaVisible(schemaInfo.Name) {
+			continue
+		}
+		for _, table := range schemaInfo.Tables {
+			if (args.Table != "" && table.Name != args.Table) || !policies.TableAllowed(schemaInfo.Name, table.Name) {
+				continue
+			}
+			tablesChecked++
+			indexesChecked += len(table.Indexes)
+			redundant = append(redundant, redundantIndexes(schemaInfo.Name, table)...)
+		}
+	}
+	if args.Table != "" && tablesChecked == 0 {
+		return newErrorResult(fmt.Sprintf("未找到表 '%s.%s'", args.Schema, args.Table), nil), nil
+	}
+
+	totalWasted := int64(0)
+	if len(redundant) > 0 {
+		if err := h.fillSizes(ctx, args.ConnID, redundant); err != nil {
+			utils.DefaultLogger.Warn("读取冗余索引大小失败", zap.String("connID", args.ConnID), zap.Error(err))
+		}
+		for _, index := range redundant {
+			if index.WastedBytes != nil {
+				totalWasted += *index.WastedBytes
+			}
+		}
+	}
+	sort.SliceStable(redundant, func(i, j int) bool {
+		return derefInt64(redundant[i].WastedBytes) > derefInt64(redundant[j].WastedBytes)
+	})
+
+	utils.DefaultLogger.Info("冗余索引检测完成", zap.String("connID", args.ConnID), zap.Int("tables", tablesChecked), zap.Int("indexes", indexesChecked), zap.Int("redundant", len(redundant)))
+	return newJSONResult(map[string]any{
+		"redundant_indexes":  redundant,
+		"total_wasted_bytes": totalWasted,
+		"tables_checked":     tablesChecked,
+		"indexes_checked":    indexesChecked,
+		"note":               "基于 Schema 缓存中的索引定义；删除前请确认 covered_by 索引能满足相同的查询，并在低峰期使用 DROP INDEX CONCURRENTLY",
+	})
+}
+
+// redundantIndexes 找出一张表上能被其他索引代替的索引，每个冗余索引只报告一次
+func redundantIndexes(schema string, table schemas.TableInfo) []RedundantIndex {
+	shapes := make([]*indexShape, len(table.Indexes))
+	for i, index := range table.Indexes {
+		shapes[i] = parseIndexShape(index.IndexDefinition)
+	}
+	result := []RedundantIndex{}
+	for i, index := range table.Indexes {
+		if shapes[i] == nil {
+			continue
+		}
+		for j, other := range table.Indexes {
+			if i == j || shapes[j] == nil {
+				continue
+			}
+			kind, ok := coveredBy(index, shapes[i], other, shapes[j])
+			if !ok {
+				continue
+			}
+			// 完全相同的两个索引只报告等级较低的一个，等级相同时保留名称较小的
+			if kind == IndexDuplicate {
+				if rank, otherRank := indexRank(index), indexRank(other); rank > otherRank || (rank == otherRank && index.IndexName < other.IndexName) {
+					continue
+				}
+			}
+			result = append(result, RedundantIndex{
+				schema:       schema,
+				Table:        schema + "." + table.Name,
+				Index:        index.IndexName,
+				Definition:   index.IndexDefinition,
+				Kind:         kind,
+				CoveredBy:    other.IndexName,
+				CoveredByDef: other.IndexDefinition,
+			})
+			break
+		}
+	}
+	return result
+}
+
+// coveredBy 判断 index 能否被 other 代替。
+// 两者的方法和谓词必须相同；唯一索引只能被键完全相同的唯一索引代替；
+// 键不同时只考虑 btree 的前缀匹配，index 的 INCLUDE 列需要出现在 other 的键或 INCLUDE 列中。
+func coveredBy(index schemas.IndexInfo, shape *indexShape, other schemas.IndexInfo, otherShape *indexShape) (string, bool) {
+	if shape.method != otherShape.method || shape.predicate != otherShape.predicate {
+		return "", false
+	}
+	sameKeys := slices.Equal(shape.keys, otherShape.keys)
+	if index.IsUnique && !(other.IsUnique && sameKeys) {
+		return "", false
+	}
+	if !sameKeys && (shape.method != "btree" || len(shape.keys) >= len(otherShape.keys) || !slices.Equal(shape.keys, otherShape.keys[:len(shape.keys)])) {
+		return "", false
+	}
+	for _, column := range shape.include {
+		if !slices.Contains(otherShape.include, column) && !slices.Contains(otherShape.keys, column) {
+			return "", false
+		}
+	}
+	if sameKeys && index.IsUnique == other.IsUnique && slices.Equal(shape.include, otherShape.include) {
+		return IndexDuplicate, true
+	}
+	return IndexOverlapping, true
+}
+
+// indexRank 是重复索引中保留的优先级: 主键 > 唯一 > 普通
+func indexRank(index schemas.IndexInfo) int {
+	switch {
+	case index.IsPrimary:
+		return 2
+	case index.IsUnique:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// parseIndexShape 解析 pg_get_indexdef 的输出:
+// CREATE [UNIQUE] INDEX name ON [ONLY] table USING method (keys) [INCLUDE (cols)] [WITH (opts)] [WHERE predicate]
+// 无法解析时返回 nil。
+func parseIndexShape(definition string) *indexShape {
+	using := strings.Index(definition, " USING ")
+	if using < 0 {
+		return nil
+	}
+	rest := definition[using+len(" USING "):]
+	open := strings.Index(rest, " (")
+	if open < 0 {
+		return nil
+	}
+	shape := &indexShape{method: rest[:open]}
+	keys, rest, ok := cutParenthesized(rest[open+1:])
+	if !ok {
+		return nil
+	}
+	shape.keys = splitTopLevel(keys)
+	if after, found := strings.CutPrefix(rest, " INCLUDE "); found {
+		include, remaining, ok := cutParenthesized(after)
+		if !ok {
+			return nil
+		}
+		shape.include, rest = splitTopLevel(include), remaining
+		sort.Strings(shape.include)
+	}
+	if after, found := strings.CutPrefix(rest, " WITH "); found {
+		options, remaining, ok := cutParenthesized(after)
+		if !ok {
+			return nil
+		}
+		shape.options, rest = options, remaining
+	}
+	if after, found := strings.CutPrefix(rest, " WHERE "); found {
+		shape.predicate = strings.TrimSpace(after)
+	}
+	return shape
+}
+
+// cutParenthesized 截取开头括号内的内容 (忽略字符串字面量和带引号标识符中的括号)，返回内容和括号之后的部分
+func cutParenthesized(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, "(") {
+		return "", "", false
+	}
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return s[1:i], s[i+1:], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// splitTopLevel 按不在括号和引号内的逗号拆分
+func splitTopLevel(s string) []string {
+	parts := []string{}
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+// fillSizes 读取冗余索引的大小、扫描次数和依赖的约束，并生成清理建议
+func (h *FindDuplicateIndexesHandler) fillSizes(ctx context.Context, connID string, redundant []RedundantIndex) error {
+	schemaNames := make([]string, len(redundant))
+	indexNames := make([]string, len(redundant))
+	for i, index := range redundant {
+		schemaNames[i] = index.schema
+		indexNames[i] = index.Index
+	}
+	rows, err := h.dbService.ExecuteQuery(ctx, connID, true, indexSizeQuery, schemaNames, indexNames)
+	for i := range redundant {
+		redundant[i].Recommendation = dropRecommendation(redundant[i], schemaNames[i])
+	}
+	if err != nil {
+		return err
+	}
+	sizes := make(map[string]map[string]any, len(rows))
+	for _, row := range rows {
+		sizes[fmt.Sprintf("%v.%v", row["schema"], row["index"])] = row
+	}
+	for i := range redundant {
+		row, ok := sizes[schemaNames[i]+"."+redundant[i].Index]
+		if !ok {
+			continue
+		}
+		bytes, scans := utils.DbInt64(row["index_bytes"]), utils.DbInt64(row["index_scans"])
+		redundant[i].WastedBytes = &bytes
+		redundant[i].WastedSize, _ = row["index_size"].(string)
+		redundant[i].IndexScans = &scans
+		redundant[i].BacksConstraint, _ = row["backs_constraint"].(string)
+		redundant[i].Recommendation = dropRecommendation(redundant[i], schemaNames[i])
+	}
+	return nil
+}
+
+// dropRecommendation 生成删除冗余索引的建议语句
+func dropRecommendation(index RedundantIndex, schema string) string {
+	if index.BacksConstraint != "" {
+		return fmt.Sprintf("索引支撑约束 %s，需要评估后用 ALTER TABLE %s DROP CONSTRAINT 删除约束 (会同时删除索引)", index.BacksConstraint, index.Table)
+	}
+	qualified, err := sqlsafe.QuoteQualified(schema, index.Index)
+	if err != nil {
+		return fmt.Sprintf("确认 %s 能满足相同的查询后删除索引 %s", index.CoveredBy, index.Index)
+	}
+	return fmt.Sprintf("DROP INDEX CONCURRENTLY %s; -- 由 %s 代替", qualified, index.CoveredBy)
+}
+
+// derefInt64 返回指针指向的值，nil 时返回 0
+func derefInt64(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,163 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/requests"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// errExportTooLarge 表示导出文件超过了 EXPORT_MAX_BYTES
+var errExportTooLarge = errors.New("导出文件超过大小上限")
+
+// ExportQueryToolArgs 是 'export_query' 工具的输入参数。
+type ExportQueryToolArgs struct {
+	ConnID   string `json:"conn_id" description:"目标数据库的连接 ID"`
+	Query    string `json:"query" description:"要导出的只读 SELECT 查询 (COPY 不支持参数占位符，也不能包含分号)"`
+	Format   string `json:"format,omitempty" description:"(可选) 文件格式: csv (默认) 或 text (制表符分隔, NULL 为 \\N)"`
+	NoHeader bool   `json:"no_header,omitempty" description:"(可选) 为 true 时 csv 文件不包含表头"`
+}
+
+// ExportHandler 处理将查询结果导出为服务端文件的工具调用。
+type ExportHandler struct {
+	dbService databases.Service
+	masker    *masking.Masker
+	dir       string // 导出文件目录
+	baseURL   string // 导出目录对外访问的 URL 前缀，为空时只返回文件路径
+	maxBytes  int64  // 单个导出文件的大小上限，0 表示不限制
+}
+
+// NewExportHandler 创建一个新的 ExportHandler。
+func NewExportHandler(dbService databases.Service, masker *masking.Masker, cfg *config.Config) *ExportHandler {
+	return &ExportHandler{
+		dbService: dbService,
+		masker:    masker,
+		dir:       cfg.ExportDir,
+		baseURL:   cfg.ExportBaseURL,
+		maxBytes:  cfg.ExportMaxBytes,
+	}
+}
+
+// HandleExportQuery 处理 'export_query' 工具的调用请求。
+// 通过 COPY (query) TO STDOUT 将结果流式写入服务端文件，返回文件路径 (或 URL) 和行数，适合无法内联返回的大结果集。
+func (h *ExportHandler) HandleExportQuery(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(ExportQueryToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Query == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 或 'query' 参数")
+	}
+	format := strings.ToLower(args.Format)
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "text" {
+		return nil, fmt.Errorf("不支持的 'format': '%s' (可选 csv, text)", args.Format)
+	}
+	query := strings.TrimRight(strings.TrimSpace(args.Query), "; \t\r\n")
+	// COPY 走简单查询协议，允许多条语句；拒绝任何分号，避免查询闭合括号后追加其他语句 (例如 COMMIT 后写入)
+	if strings.Contains(query, ";") {
+		return newErrorResult("'query' 不能包含分号 (仅支持单条 SELECT 查询)", nil), nil
+	}
+	// COPY 直接把数据写入文件，无法逐值脱敏；先用 LIMIT 0 取得结果列的来源，包含脱敏列时拒绝导出
+	if h.masker.Enabled() {
+		described, err := h.dbService.QueryWithColumns(ctx, args.ConnID, true, fmt.Sprintf("SELECT * FROM (%s) AS export LIMIT 0", query))
+		if err != nil {
+			return newErrorResult("查询执行失败", err), nil
+		}
+		masked, err := h.masker.MaskedColumns(ctx, args.ConnID, described)
+		if err != nil {
+			return newErrorResult("检查脱敏列失败", err), nil
+		}
+		if len(masked) > 0 {
+			columns := make([]string, 0, len(masked))
+			for column := range masked {
+				columns = append(columns, column)
+			}
+			slices.Sort(columns)
+			return newErrorResult(fmt.Sprintf("查询结果包含已配置脱敏的列 (%s)，不能导出", strings.Join(columns, ", ")), nil), nil
+		}
+	}
+
+	copySQL := fmt.Sprintf("COPY (%s) TO STDOUT WITH (FORMAT %s", query, format)
+	extension := ".tsv"
+	if format == "csv" {
+		copySQL += fmt.Sprintf(", HEADER %t", !args.NoHeader)
+		extension = ".csv"
+	}
+	copySQL += ")"
+
+	if err := os.MkdirAll(h.dir, 0o755); err != nil {
+		return newErrorResult("创建导出目录失败", err), nil
+	}
+	fileName := fmt.Sprintf("export_%s_%s%s", time.Now().Format("20060102T150405"), utils.GenerateUUID()[:8], extension)
+	filePath := filepath.Join(h.dir, fileName)
+	file, err := os.Create(filePath)
+	if err != nil {
+		return newErrorResult("创建导出文件失败", err), nil
+	}
+	writer := &limitedWriter{ctx: ctx, file: file, limit: h.maxBytes}
+	rowCount, err := h.dbService.CopyTo(ctx, args.ConnID, copySQL, writer)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(filePath) // 不保留不完整的文件
+		utils.DefaultLogger.Error("导出查询结果失败", zap.String("connID", args.ConnID), zap.Error(err))
+		if errors.Is(err, errExportTooLarge) {
+			return newErrorResult(fmt.Sprintf("导出文件超过大小上限 (%d 字节)，请缩小查询范围", h.maxBytes), nil), nil
+		}
+		return newErrorResult("导出查询结果失败", err), nil
+	}
+
+	absPath, _ := filepath.Abs(filePath)
+	result := map[string]any{
+		"success":   true,
+		"path":      absPath,
+		"format":    format,
+		"row_count": rowCount,
+		"bytes":     writer.written,
+	}
+	if h.baseURL != "" {
+		result["url"] = strings.TrimRight(h.baseURL, "/") + "/" + url.PathEscape(fileName)
+	}
+	utils.DefaultLogger.Info("查询结果已导出", zap.String("connID", args.ConnID), zap.String("path", absPath), zap.Int64("rowCount", rowCount), zap.Int64("bytes", writer.written))
+	return newJSONResult(result)
+}
+
+// limitedWriter 在写入量超过上限时返回错误，使 COPY 中止；同时向客户端报告已导出的行数
+type limitedWriter struct {
+	ctx     context.Context
+	file    *os.File
+	limit   int64 // 0 表示不限制
+	written int64
+	writes  int64 // COPY TO 每行数据调用一次 Write (CSV 表头也算一次)
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.limit > 0 && w.written+int64(len(p)) > w.limit {
+		return 0, errExportTooLarge
+	}
+	n, err := w.file.Write(p)
+	w.written += int64(n)
+	w.writes++
+	if w.writes%1000 == 0 {
+		requests.ReportProgress(w.ctx, float64(w.writes), 0, fmt.Sprintf("已导出约 %d 行 (%d 字节)", w.writes, w.written))
+	}
+	return n, err
+}
@@ -0,0 +1,372 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/results"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultGISBBoxLimit = 100
+	maxGISBBoxLimit     = 1000
+
+	// 估算行数超过该值时 gis_table_summary 抽样统计几何类型，范围使用 ST_EstimatedExtent
+	gisSummarySampleThreshold = 1000000
+	// 抽样时期望扫描的行数
+	gisSummarySampleRows = 100000
+)
+
+// GISTableSummaryToolArgs 是 'gis_table_summary' 工具的输入参数。
+type GISTableSummaryToolArgs struct {
+	ConnID string `json:"conn_id" description:"目标数据库的连接 ID"`
+	Schema string `json:"schema" description:"表所在的 Schema"`
+	Table  string `json:"table" description:"表名"`
+	Column string `json:"column,omitempty" description:"(可选) 只统计该空间列，默认统计表中所有 geometry/geography 列"`
+}
+
+// GISBBoxQueryToolArgs 是 'gis_bbox_query' 工具的输入参数。
+type GISBBoxQueryToolArgs struct {
+	ConnID  string   `json:"conn_id" description:"目标数据库的连接 ID"`
+	Schema  string   `json:"schema" description:"表所在的 Schema"`
+	Table   string   `json:"table" description:"表名"`
+	Column  string   `json:"column" description:"geometry 或 geography 列名"`
+	XMin    float64  `json:"xmin" description:"范围框的最小 X (经度)"`
+	YMin    float64  `json:"ymin" description:"范围框的最小 Y (纬度)"`
+	XMax    float64  `json:"xmax" description:"范围框的最大 X (经度)"`
+	YMax    float64  `json:"ymax" description:"范围框的最大 Y (纬度)"`
+	SRID    int      `json:"srid,omitempty" description:"(可选) 范围框坐标的空间参考 ID，默认 4326；与列的 SRID 不同时自动转换"`
+	Columns []string `json:"columns,omitempty" description:"(可选) 返回的列，默认返回所有列 (空间列在 JSON 结果中为 GeoJSON)"`
+	Limit   int      `json:"limit,omitempty" description:"(可选) 返回的行数上限，默认 100，最大 1000"`
+	Format  string   `json:"format,omitempty" description:"(可选) 结果格式: json (默认), csv, tsv, markdown"`
+}
+
+// GISTransformToolArgs 是 'gis_transform' 工具的输入参数。
+type GISTransformToolArgs struct {
+	ConnID   string `json:"conn_id" description:"目标数据库的连接 ID (使用该库 PostGIS 的 spatial_ref_sys 转换)"`
+	Geometry string `json:"geometry" description:"要转换的几何对象: GeoJSON 几何 (例如 {\"type\":\"Point\",\"coordinates\":[116.4,39.9]}) 或 WKT (例如 POINT(116.4 39.9))"`
+	FromSRID int    `json:"from_srid,omitempty" description:"(可选) 输入坐标的空间参考 ID，默认 4326"`
+	ToSRID   int    `json:"to_srid" description:"目标空间参考 ID，例如 3857"`
+}
+
+// GISHandler 处理 PostGIS 相关的工具调用。
+type GISHandler struct {
+	dbService     databases.Service
+	schemaManager schemas.Manager
+	masker        *masking.Masker
+}
+
+// NewGISHandler 创建一个新的 GISHandler。
+func NewGISHandler(dbService databases.Service, schemaManager schemas.Manager, masker *masking.Masker) *GISHandler {
+	return &GISHandler{dbService: dbService, schemaManager: schemaManager, masker: masker}
+}
+
+// requirePostGIS 检查连接的数据库安装了 PostGIS，未安装时返回业务错误结果
+func (h *GISHandler) requirePostGIS(ctx context.Context, connID string) *protocol.CallToolResult {
+	features, err := h.schemaManager.GetFeatures(ctx, connID)
+	if err != nil {
+		return newErrorResult("检测数据库特性失败", err)
+	}
+	if !features.HasPostGIS {
+		return newErrorResult("当前数据库未安装 PostGIS 扩展 (CREATE EXTENSION postgis)", nil)
+	}
+	return nil
+}
+
+// gisColumnSummary 是一个空间列的统计
+type gisColumnSummary struct {
+	Column          string              `json:"column"`
+	Kind            string              `json:"kind"`              // geometry 或 geography
+	DeclaredType    string              `json:"declared_type"`     // 列定义的几何类型 (GEOMETRY 表示不限)
+	DeclaredSRID    int64               `json:"declared_srid"`     // 列定义的 SRID (0 表示不限)
+	Dimensions      int64               `json:"dimensions"`        // 坐标维度
+	Extent          map[string]any      `json:"extent,omitempty"`  // 范围 {xmin, ymin, xmax, ymax}，坐标与列的 SRID 相同
+	ExtentEstimated bool                `json:"extent_estimated"`  // true 表示范围来自统计信息估算或抽样，不是精确范围
+	GeometryTypes   []map[string]any    `json:"geometry_types"`    // 实际出现的 {geometry_type, srid, count}
+	NullCount       int64               `json:"null_count"`        // 空值个数 (抽样时为样本中的个数)
+	Sampled         bool                `json:"sampled"`           // true 表示 geometry_types 和 null_count 来自抽样
+	Error           string              `json:"error,omitempty"`   // 统计该列失败时的错误
+	Indexes         []schemas.IndexInfo `json:"indexes,omitempty"` // 以该列开头的索引 (空间查询需要 gist/spgist/brin 索引)
+}
+
+// HandleGISTableSummary 处理 'gis_table_summary' 工具的调用请求。
+// 返回每个空间列的声明类型、SRID、实际出现的几何类型和范围，用于在编写空间查询前了解数据。
+func (h *GISHandler) HandleGISTableSummary(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(GISTableSummaryToolArgs)
+	if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Schema == "" || args.Table == "" {
+		return nil, fmt.Errorf("缺少 'conn_id', 'schema' 或 'table' 参数")
+	}
+	if result := h.requirePostGIS(ctx, args.ConnID); result != nil {
+		return result, nil
+	}
+	tableInfo, found := h.schemaManager.GetTableInfo(args.Schema, args.Table)
+	if !found {
+		return newErrorResult(fmt.Sprintf("未找到表 '%s.%s'", args.Schema, args.Table), nil), nil
+	}
+
+	source, err := sqlsafe.QuoteQualified(args.Schema, args.Table)
+	if err != nil {
+		return newErrorResult("无效的表名", err), nil
+	}
+	sampled := tableInfo.RowCount > gisSummarySampleThreshold
+	sampledSource := source
+	if sampled {
+		sampledSource += tableSampleClause(gisSummarySampleRows, tableInfo.RowCount)
+	}
+
+	var summaries []gisColumnSummary
+	for _, col := range tableInfo.Columns {
+		if col.Geo == nil || (args.Column != "" && col.Name != args.Column) {
+			continue
+		}
+		summary := gisColumnSummary{
+			Column:       col.Name,
+			Kind:         col.Geo.Kind,
+			DeclaredType: col.Geo.GeometryType,
+			DeclaredSRID: col.Geo.SRID,
+			Dimensions:   col.Geo.Dimensions,
+			Sampled:      sampled,
+		}
+		for _, idx := range tableInfo.Indexes {
+			if len(idx.Columns) > 0 && idx.Columns[0] == col.Name {
+				summary.Indexes = append(summary.Indexes, idx)
+			}
+		}
+		if err := h.summarizeGeoColumn(ctx, args, col, sampledSource, sampled, &summary); err != nil {
+			utils.DefaultLogger.Warn("统计空间列失败", zap.String("connID", args.ConnID), zap.String("table", args.Schema+"."+args.Table), zap.String("column", col.Name), zap.Error(err))
+			summary.Error = err.Error()
+		}
+		summaries = append(summaries, summary)
+	}
+	if len(summaries) == 0 {
+		if args.Column != "" {
+			return newErrorResult(fmt.Sprintf("表 '%s.%s' 中没有空间列 '%s'", args.Schema, args.Table, args.Column), nil), nil
+		}
+		return newErrorResult(fmt.Sprintf("表 '%s.%s' 中没有 geometry/geography 列", args.Schema, args.Table), nil), nil
+	}
+	return newJSONResult(map[string]any{
+		"schema":    args.Schema,
+		"table":     args.Table,
+		"row_count": tableInfo.RowCount, // 估算行数
+		"columns":   summaries,
+	})
+}
+
+// summarizeGeoColumn 统计一个空间列实际出现的几何类型、SRID、空值数和范围
+func (h *GISHandler) summarizeGeoColumn(ctx context.Context, args *GISTableSummaryToolArgs, col schemas.ColumnInfo, sampledSource string, sampled bool, summary *gisColumnSummary) error {
+	column, err := sqlsafe.QuoteIdentifier(col.Name)
+	if err != nil {
+		return fmt.Errorf("无效的列名: %w", err)
+	}
+	// geography 没有 GeometryType/ST_Extent，统一转换为 geometry 统计
+	geometry := column
+	if col.Geo.Kind == "geography" {
+		geometry = column + "::geometry"
+	}
+
+	typeRows, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true, fmt.Sprintf(
+		"SELECT GeometryType(%[1]s) AS geometry_type, ST_SRID(%[1]s) AS srid, count(*) AS count FROM %[2]s GROUP BY 1, 2 ORDER BY 3 DESC",
+		geometry, sampledSource))
+	if err != nil {
+		return fmt.Errorf("统计几何类型失败: %w", err)
+	}
+	summary.GeometryTypes = []map[string]any{}
+	for _, row := range typeRows {
+		if row["geometry_type"] == nil {
+			if count, ok := row["count"].(int64); ok {
+				summary.NullCount = count
+			}
+			continue
+		}
+		summary.GeometryTypes = append(summary.GeometryTypes, row)
+	}
+
+	var extentRows []map[string]any
+	extentQuery := "SELECT ST_XMin(e) AS xmin, ST_YMin(e) AS ymin, ST_XMax(e) AS xmax, ST_YMax(e) AS ymax FROM (SELECT %s AS e) extent"
+	if sampled && col.Geo.Kind == "geometry" {
+		// 大表的精确范围需要全表扫描，改用统计信息估算 (没有统计信息时返回 NULL 或报错，改为抽样计算)
+		extentRows, err = h.dbService.ExecuteQuery(ctx, args.ConnID, true, fmt.Sprintf(extentQuery, "ST_EstimatedExtent($1, $2, $3)"), args.Schema, args.Table, col.Name)
+		summary.ExtentEstimated = true
+	}
+	if err != nil || len(extentRows) == 0 || extentRows[0]["xmin"] == nil {
+		extentRows, err = h.dbService.ExecuteQuery(ctx, args.ConnID, true, fmt.Sprintf(extentQuery, fmt.Sprintf("(SELECT ST_Extent(%s) FROM %s)", geometry, sampledSource)))
+		if err != nil {
+			return fmt.Errorf("计算范围失败: %w", err)
+		}
+	}
+	if len(extentRows) > 0 && extentRows[0]["xmin"] != nil {
+		summary.Extent = extentRows[0]
+	}
+	return nil
+}
+
+// HandleGISBBoxQuery 处理 'gis_bbox_query' 工具的调用请求。
+// 用 ST_Intersects 查询与范围框相交的行 (可以使用空间索引)，范围框坐标通过参数传入。
+func (h *GISHandler) HandleGISBBoxQuery(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(GISBBoxQueryToolArgs)
+	if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Schema == "" || args.Table == "" || args.Column == "" {
+		return nil, fmt.Errorf("缺少 'conn_id', 'schema', 'table' 或 'column' 参数")
+	}
+	if args.XMin >= args.XMax || args.YMin >= args.YMax {
+		return nil, fmt.Errorf("无效的范围框: 需要 xmin < xmax 且 ymin < ymax")
+	}
+	format := strings.ToLower(args.Format)
+	if !results.IsSupportedFormat(format) {
+		return nil, fmt.Errorf("不支持的 'format': '%s' (可选 json, csv, tsv, markdown)", args.Format)
+	}
+	srid := args.SRID
+	if srid <= 0 {
+		srid = 4326
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultGISBBoxLimit
+	}
+	if limit > maxGISBBoxLimit {
+		limit = maxGISBBoxLimit
+	}
+	if result := h.requirePostGIS(ctx, args.ConnID); result != nil {
+		return result, nil
+	}
+
+	tableInfo, found := h.schemaManager.GetTableInfo(args.Schema, args.Table)
+	if !found {
+		return newErrorResult(fmt.Sprintf("未找到表 '%s.%s'", args.Schema, args.Table), nil), nil
+	}
+	columns := make(map[string]schemas.ColumnInfo, len(tableInfo.Columns))
+	for _, col := range tableInfo.Columns {
+		columns[col.Name] = col
+	}
+	geoColumn, ok := columns[args.Column]
+	if !ok {
+		return newErrorResult(fmt.Sprintf("表 '%s.%s' 中不存在列 '%s'", args.Schema, args.Table, args.Column), nil), nil
+	}
+	if geoColumn.Geo == nil {
+		return newErrorResult(fmt.Sprintf("列 '%s' 的类型是 %s，不是 geometry/geography 列", args.Column, geoColumn.Type), nil), nil
+	}
+
+	selected := args.Columns
+	if len(selected) == 0 {
+		for _, col := range tableInfo.Columns {
+			selected = append(selected, col.Name)
+		}
+	}
+	for _, name := range selected {
+		if _, ok := columns[name]; !ok {
+			return newErrorResult(fmt.Sprintf("表 '%s.%s' 中不存在列 '%s'", args.Schema, args.Table, name), nil), nil
+		}
+	}
+	selectList, err := sqlsafe.QuoteIdentifiers(selected)
+	if err != nil {
+		return newErrorResult("无效的列名", err), nil
+	}
+	table, err := sqlsafe.QuoteQualified(args.Schema, args.Table)
+	if err != nil {
+		return newErrorResult("无效的表名", err), nil
+	}
+	column, err := sqlsafe.QuoteIdentifier(args.Column)
+	if err != nil {
+		return newErrorResult("无效的列名", err), nil
+	}
+
+	// 范围框转换到列的 SRID (列未限定 SRID 时按输入的 SRID 比较)；geography 列统一使用 4326
+	envelope := "ST_MakeEnvelope($1, $2, $3, $4, $5)"
+	switch {
+	case geoColumn.Geo.Kind == "geography":
+		if srid != 4326 {
+			envelope = fmt.Sprintf("ST_Transform(%s, 4326)", envelope)
+		}
+		envelope += "::geography"
+	case geoColumn.Geo.SRID > 0 && int(geoColumn.Geo.SRID) != srid:
+		envelope = fmt.Sprintf("ST_Transform(%s, %d)", envelope, geoColumn.Geo.SRID)
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE ST_Intersects(%s, %s) LIMIT $6",
+		strings.Join(selectList, ", "), table, column, envelope)
+	params := []any{args.XMin, args.YMin, args.XMax, args.YMax, srid, limit}
+
+	started := time.Now()
+	queryResult, err := h.dbService.QueryWithColumns(ctx, args.ConnID, true, query, params...)
+	elapsed := time.Since(started)
+	if err != nil {
+		utils.DefaultLogger.Error("范围框查询失败", zap.String("connID", args.ConnID), zap.String("table", args.Schema+"."+args.Table), zap.String("column", args.Column), zap.Error(err))
+		return newErrorResult("范围框查询失败", err), nil
+	}
+	if err := h.masker.MaskResult(ctx, args.ConnID, queryResult); err != nil {
+		return newErrorResult("结果脱敏失败", err), nil
+	}
+	encoded, err := results.Encode(format, queryResult.Columns, queryResult.Rows)
+	if err != nil {
+		return nil, err
+	}
+	execution := results.NewMetadata(elapsed, queryResult.Columns, queryResult.Rows, encoded)
+	// 返回行数达到 limit 时可能还有更多相交的行
+	execution.Truncated = len(queryResult.Rows) >= limit
+	details := map[string]any{"execution": execution, "executed_query": query}
+	detailBytes, _ := json.Marshal(details)
+	return &protocol.CallToolResult{Content: []protocol.Content{
+		protocol.TextContent{Type: results.MimeType(format), Text: encoded},
+		protocol.TextContent{Type: "application/json", Text: string(detailBytes)},
+	}}, nil
+}
+
+// HandleGISTransform 处理 'gis_transform' 工具的调用请求。
+// 用数据库中 PostGIS 的 ST_Transform 转换坐标，返回 GeoJSON 和 WKT 两种形式。
+func (h *GISHandler) HandleGISTransform(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(GISTransformToolArgs)
+	if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	geometryText := strings.TrimSpace(args.Geometry)
+	if args.ConnID == "" || geometryText == "" || args.ToSRID <= 0 {
+		return nil, fmt.Errorf("缺少 'conn_id', 'geometry' 或 'to_srid' 参数")
+	}
+	fromSRID := args.FromSRID
+	if fromSRID <= 0 {
+		fromSRID = 4326
+	}
+	if result := h.requirePostGIS(ctx, args.ConnID); result != nil {
+		return result, nil
+	}
+
+	input := "ST_GeomFromText($1, $2)"
+	if strings.HasPrefix(geometryText, "{") {
+		input = "ST_SetSRID(ST_GeomFromGeoJSON($1), $2)"
+	}
+	query := fmt.Sprintf(`
+        SELECT ST_AsGeoJSON(g) AS geojson, ST_AsText(g) AS wkt, ST_SRID(g) AS srid,
+               (SELECT auth_name || ':' || auth_srid FROM spatial_ref_sys WHERE srid = $3) AS srs
+        FROM (SELECT ST_Transform(%s, $3) AS g) transformed`, input)
+	rows, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true, query, geometryText, fromSRID, args.ToSRID)
+	if err != nil {
+		return newErrorResult("坐标转换失败", err), nil
+	}
+	if len(rows) == 0 {
+		return newErrorResult("坐标转换没有返回结果", nil), nil
+	}
+	result := rows[0]
+	// ST_AsGeoJSON 返回文本，解析后作为对象返回
+	if text, ok := result["geojson"].(string); ok {
+		var geoJSON any
+		if err := json.Unmarshal([]byte(text), &geoJSON); err == nil {
+			result["geojson"] = geoJSON
+		}
+	}
+	result["from_srid"] = fromSRID
+	return newJSONResult(result)
+}
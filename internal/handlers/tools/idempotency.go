@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"context"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/idempotency"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// IdempotencyKeyArg 是写入类工具统一接受的幂等键参数名
+const IdempotencyKeyArg = "idempotency_key"
+
+// IdempotencyKeyProperty 是幂等键参数的 Schema 定义，供手动定义的写入工具复用
+var IdempotencyKeyProperty = &protocol.Property{
+	Type:        protocol.String,
+	Description: "(可选) 幂等键。超时后使用同一个键重试时，服务端直接返回首次执行的结果，不会重复写入",
+}
+
+// runIdempotent 在幂等键保护下执行写入操作。
+// 未提供幂等键时直接执行；键已完成时重放之前的结果；写入失败时释放该键以便重试。
+func runIdempotent(ctx context.Context, store idempotency.Store, connID, tool string, req *protocol.CallToolRequest,
+	write func() (*protocol.CallToolResult, error)) (*protocol.CallToolResult, error) {
+	key, _ := req.Arguments[IdempotencyKeyArg].(string)
+	if key == "" || store == nil {
+		return write()
+	}
+
+	// 参数摘要不包含幂等键本身
+	args := make(map[string]any, len(req.Arguments))
+	for name, value := range req.Arguments {
+		if name != IdempotencyKeyArg {
+			args[name] = value
+		}
+	}
+
+	record, err := store.Begin(ctx, connID, tool, key, args)
+	if err != nil {
+		utils.DefaultLogger.Warn("幂等键校验失败", zap.String("tool", tool), zap.String("key", key), zap.Error(err))
+		return newErrorResult("幂等键校验失败", err), nil
+	}
+	if record != nil {
+		return &protocol.CallToolResult{
+			Content: []protocol.Content{protocol.TextContent{Type: "text", Text: record.Result}},
+		}, nil
+	}
+
+	result, err := write()
+	if err != nil || result == nil || result.IsError {
+		store.Abort(ctx, connID, tool, key)
+		return result, err
+	}
+	if text, ok := firstText(result); ok {
+		if err := store.Complete(ctx, connID, tool, key, text); err != nil {
+			// 写入已经执行，不能释放该键 (否则重试会再次写入)；结果未记录时不返回成功，由调用方先确认写入结果
+			utils.DefaultLogger.Error("记录幂等键结果失败", zap.String("tool", tool), zap.String("key", key), zap.Error(err))
+			return newErrorResult("写入已执行但无法记录幂等键结果，请先确认写入结果，不要用新的幂等键重试", err), nil
+		}
+	}
+	return result, nil
+}
+
+// firstText 返回结果中的第一个文本内容
+func firstText(result *protocol.CallToolResult) (string, bool) {
+	for _, content := range result.Content {
+		if text, ok := content.(protocol.TextContent); ok {
+			return text.Text, true
+		}
+		if text, ok := content.(*protocol.TextContent); ok {
+			return text.Text, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,380 @@
+package tools
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+// CSV 导入支持的列类型，值会在本地转换后通过 CopyFrom (二进制格式) 写入
+const (
+	csvTypeText        = "text"
+	csvTypeBigint      = "bigint"
+	csvTypeInteger     = "integer"
+	csvTypeDouble      = "double precision"
+	csvTypeNumeric     = "numeric"
+	csvTypeBoolean     = "boolean"
+	csvTypeDate        = "date"
+	csvTypeTimestamptz = "timestamptz"
+	csvTypeJSONB       = "jsonb"
+)
+
+// csvTypeAliases 将常见写法映射到支持的列类型
+var csvTypeAliases = map[string]string{
+	"text": csvTypeText, "varchar": csvTypeText, "string": csvTypeText,
+	"bigint": csvTypeBigint, "int8": csvTypeBigint,
+	"integer": csvTypeInteger, "int": csvTypeInteger, "int4": csvTypeInteger,
+	"double precision": csvTypeDouble, "float8": csvTypeDouble, "float": csvTypeDouble,
+	"numeric": csvTypeNumeric, "decimal": csvTypeNumeric,
+	"boolean": csvTypeBoolean, "bool": csvTypeBoolean,
+	"date":        csvTypeDate,
+	"timestamptz": csvTypeTimestamptz, "timestamp with time zone": csvTypeTimestamptz, "timestamp": csvTypeTimestamptz,
+	"jsonb": csvTypeJSONB, "json": csvTypeJSONB,
+}
+
+// csvTimestampLayouts 是推断和解析时间戳列时尝试的格式
+var csvTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// csvColumnNamePattern 用于从表头生成列名: 非字母数字下划线的字符替换为下划线
+var csvColumnNamePattern = regexp.MustCompile(`[^\p{L}\p{N}_]+`)
+
+// ImportCSVTempTool 是 'import_csv_temp' 工具的定义。
+var ImportCSVTempTool = &protocol.Tool{
+	Name:        "import_csv_temp",
+	Description: "将 CSV 数据导入 temp schema 下新建的表 (CopyFrom 批量写入)，返回表名和列类型，之后可与业务表 JOIN",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"conn_id":                  {Type: protocol.String, Description: "目标数据库的连接 ID"},
+			"target_table_name_suffix": {Type: protocol.String, Description: "表名后缀 (只能包含字母、数字和下划线，最多 40 个字符)，最终表名为 temp.csv_<后缀>_<随机串>"},
+			"csv_content":              {Type: protocol.String, Description: "(与 file_path 二选一) CSV 文本内容"},
+			"file_path":                {Type: protocol.String, Description: "(与 csv_content 二选一) 服务端 IMPORT_DIR 目录下的 CSV 文件相对路径"},
+			"delimiter":                {Type: protocol.String, Description: "(可选) 分隔符，默认 ','；制表符可传 '\\t'"},
+			"no_header":                {Type: protocol.Boolean, Description: "(可选) 为 true 时第一行是数据而不是表头，列名为 column_1, column_2..."},
+			"column_types": {
+				Type:        protocol.ObjectT,
+				Description: "(可选) 列名 -> 类型，覆盖自动推断。支持 text, bigint, integer, double precision, numeric, boolean, date, timestamptz, jsonb",
+			},
+			IdempotencyKeyArg: IdempotencyKeyProperty,
+		},
+		Required: []string{"conn_id", "target_table_name_suffix"},
+	},
+}
+
+// ImportCSVTempToolArgs 是 'import_csv_temp' 工具的输入参数。
+type ImportCSVTempToolArgs struct {
+	ConnID      string            `json:"conn_id"`
+	TableSuffix string            `json:"target_table_name_suffix"`
+	CSVContent  string            `json:"csv_content,omitempty"`
+	FilePath    string            `json:"file_path,omitempty"`
+	Delimiter   string            `json:"delimiter,omitempty"`
+	NoHeader    bool              `json:"no_header,omitempty"`
+	ColumnTypes map[string]string `json:"column_types,omitempty"`
+}
+
+// csvColumn 是导入表的一列
+type csvColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// HandleImportCSVTemp 处理 'import_csv_temp' 工具的调用请求。
+func (h *WriteTempHandler) HandleImportCSVTemp(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(ImportCSVTempToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.TableSuffix == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 或 'target_table_name_suffix' 参数")
+	}
+	if (args.CSVContent == "") == (args.FilePath == "") {
+		return nil, fmt.Errorf("'csv_content' 和 'file_path' 必须且只能提供一个")
+	}
+
+	if err := ensureWritable(h.dbService, args.ConnID); err != nil {
+		return newErrorResult("写入被拒绝", err), nil
+	}
+
+	summary := fmt.Sprintf("在 temp schema 下新建 csv_%s_* 表并导入 CSV 数据", args.TableSuffix)
+	return runIdempotent(ctx, h.idempotencyStore, args.ConnID, ImportCSVTempTool.Name, req, func() (*protocol.CallToolResult, error) {
+		return runReviewed(ctx, h.reviewQueue, args.ConnID, ImportCSVTempTool.Name, summary, req, func(ctx context.Context) (*protocol.CallToolResult, error) {
+			return h.importCSVTemp(ctx, args)
+		})
+	})
+}
+
+// importCSVTemp 解析 CSV、确定列类型，并在一个事务中建表和 CopyFrom 写入。
+func (h *WriteTempHandler) importCSVTemp(ctx context.Context, args *ImportCSVTempToolArgs) (*protocol.CallToolResult, error) {
+	if err := sqlsafe.ValidateNamePart(args.TableSuffix, maxTableSuffixLength); err != nil {
+		return nil, fmt.Errorf("无效的 'target_table_name_suffix': %w", err)
+	}
+	records, err := h.readCSV(args)
+	if err != nil {
+		return newErrorResult("读取 CSV 失败", err), nil
+	}
+	if len(records) == 0 {
+		return newErrorResult("CSV 内容为空", nil), nil
+	}
+
+	header := records[0]
+	dataRows := records[1:]
+	if args.NoHeader {
+		header = make([]string, len(records[0]))
+		for i := range header {
+			header[i] = fmt.Sprintf("column_%d", i+1)
+		}
+		dataRows = records
+	}
+	columns, err := buildCSVColumns(header, dataRows, args.ColumnTypes)
+	if err != nil {
+		return newErrorResult("确定列类型失败", err), nil
+	}
+
+	rows := make([][]any, 0, len(dataRows))
+	for i, record := range dataRows {
+		row := make([]any, len(columns))
+		for j, column := range columns {
+			if j >= len(record) {
+				continue // 缺失的字段视为 NULL
+			}
+			value, err := convertCSVValue(record[j], column.Type)
+			if err != nil {
+				return newErrorResult(fmt.Sprintf("第 %d 行列 '%s' 的值无法转换为 %s", i+1, column.Name, column.Type), err), nil
+			}
+			row[j] = value
+		}
+		rows = append(rows, row)
+	}
+
+	tableName := fmt.Sprintf("csv_%s_%s", args.TableSuffix, utils.GenerateUUID()[:8])
+	quotedTableName, err := sqlsafe.QuoteQualified("temp", tableName)
+	if err != nil {
+		return nil, err
+	}
+	columnDefs := make([]string, 0, len(columns))
+	columnNames := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quotedColumn, err := sqlsafe.QuoteIdentifier(column.Name)
+		if err != nil {
+			return newErrorResult(fmt.Sprintf("无效的列名 '%s'", column.Name), err), nil
+		}
+		columnDefs = append(columnDefs, quotedColumn+" "+column.Type)
+		columnNames = append(columnNames, column.Name)
+	}
+	createTableSQL := fmt.Sprintf("CREATE TABLE %s (%s)", quotedTableName, strings.Join(columnDefs, ", "))
+	var copied int64
+	var failure *protocol.CallToolResult
+	err = h.dbService.WriteTx(ctx, args.ConnID, []string{createTableSQL}, func(tx pgx.Tx) error {
+		utils.DefaultLogger.Debug("执行 CREATE TABLE", zap.String("sql", createTableSQL))
+		if _, err := tx.Exec(ctx, createTableSQL); err != nil {
+			utils.DefaultLogger.Error("创建 CSV 导入表失败", zap.Error(err), zap.String("sql", createTableSQL))
+			failure = newErrorResult("创建临时表失败", err)
+			return err
+		}
+		var err error
+		copied, err = tx.CopyFrom(ctx, pgx.Identifier{"temp", tableName}, columnNames, pgx.CopyFromRows(rows))
+		if err != nil {
+			utils.DefaultLogger.Error("CopyFrom 写入 CSV 数据失败", zap.String("connID", args.ConnID), zap.Error(err))
+			failure = newErrorResult("写入 CSV 数据失败", err)
+		}
+		return err
+	})
+	switch {
+	case failure != nil:
+		return failure, nil
+	case errors.Is(err, sqlguard.ErrDenied):
+		return newErrorResult("写入被访问策略拒绝", err), nil
+	case err != nil:
+		return newErrorResult("导入 CSV 数据失败", err), nil
+	}
+
+	utils.DefaultLogger.Info("CSV 数据已导入 temp 表", zap.String("connID", args.ConnID), zap.String("tableName", "temp."+tableName), zap.Int64("rowCount", copied))
+	return newJSONResult(map[string]any{
+		"success":    true,
+		"table_name": "temp." + tableName,
+		"rows_saved": copied,
+		"columns":    columns,
+	})
+}
+
+// readCSV 从 csv_content 或 IMPORT_DIR 下的文件读取全部记录
+func (h *WriteTempHandler) readCSV(args *ImportCSVTempToolArgs) ([][]string, error) {
+	var source io.Reader
+	if args.CSVContent != "" {
+		source = strings.NewReader(args.CSVContent)
+	} else {
+		if h.importDir == "" {
+			return nil, fmt.Errorf("服务端未配置 IMPORT_DIR，不支持 'file_path'，请使用 'csv_content'")
+		}
+		// 只允许读取 IMPORT_DIR 下的文件，防止读取服务端任意路径
+		baseDir, err := filepath.Abs(h.importDir)
+		if err != nil {
+			return nil, err
+		}
+		fullPath, err := filepath.Abs(filepath.Join(baseDir, args.FilePath))
+		if err != nil {
+			return nil, err
+		}
+		if rel, err := filepath.Rel(baseDir, fullPath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("'file_path' 必须位于 IMPORT_DIR 目录下")
+		}
+		file, err := os.Open(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		source = file
+	}
+
+	reader := csv.NewReader(source)
+	reader.FieldsPerRecord = -1 // 允许行尾缺失的字段
+	switch args.Delimiter {
+	case "", ",":
+	case `\t`, "\t":
+		reader.Comma = '\t'
+	default:
+		delimiter := []rune(args.Delimiter)
+		if len(delimiter) != 1 {
+			return nil, fmt.Errorf("'delimiter' 必须是单个字符")
+		}
+		reader.Comma = delimiter[0]
+	}
+	return reader.ReadAll()
+}
+
+// buildCSVColumns 根据表头生成唯一的列名，并确定每列的类型 (显式指定优先，否则根据所有值推断)
+func buildCSVColumns(header []string, rows [][]string, columnTypes map[string]string) ([]csvColumn, error) {
+	columns := make([]csvColumn, 0, len(header))
+	used := make(map[string]bool, len(header))
+	matchedTypes := 0
+	for i, rawName := range header {
+		name := strings.Trim(csvColumnNamePattern.ReplaceAllString(strings.ToLower(strings.TrimSpace(rawName)), "_"), "_")
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		for base, n := name, 2; used[name]; n++ {
+			name = fmt.Sprintf("%s_%d", base, n)
+		}
+		used[name] = true
+
+		columnType := ""
+		requested, ok := columnTypes[rawName]
+		if !ok {
+			requested, ok = columnTypes[name]
+		}
+		if ok {
+			matchedTypes++
+			columnType, ok = csvTypeAliases[strings.ToLower(strings.TrimSpace(requested))]
+			if !ok {
+				return nil, fmt.Errorf("列 '%s' 的类型 '%s' 不受支持", rawName, requested)
+			}
+		} else {
+			columnType = inferCSVColumnType(rows, i)
+		}
+		columns = append(columns, csvColumn{Name: name, Type: columnType})
+	}
+	if matchedTypes < len(columnTypes) {
+		return nil, fmt.Errorf("'column_types' 中有列名不在 CSV 表头中")
+	}
+	return columns, nil
+}
+
+// inferCSVColumnType 依次尝试 boolean, bigint, double precision, date, timestamptz，全部值都能解析时选用该类型，否则为 text。
+// 空字符串视为 NULL，不参与推断。
+func inferCSVColumnType(rows [][]string, index int) string {
+	candidates := []string{csvTypeBoolean, csvTypeBigint, csvTypeDouble, csvTypeDate, csvTypeTimestamptz}
+	nonEmpty := 0
+	for _, row := range rows {
+		if index >= len(row) || strings.TrimSpace(row[index]) == "" {
+			continue
+		}
+		nonEmpty++
+		remaining := candidates[:0]
+		for _, candidate := range candidates {
+			if _, err := convertCSVValue(row[index], candidate); err == nil {
+				remaining = append(remaining, candidate)
+			}
+		}
+		candidates = remaining
+		if len(candidates) == 0 {
+			return csvTypeText
+		}
+	}
+	if nonEmpty == 0 {
+		return csvTypeText
+	}
+	return candidates[0]
+}
+
+// convertCSVValue 将 CSV 字段转换为列类型对应的 Go 值，空字符串 (text 列除外) 转换为 NULL
+func convertCSVValue(raw, columnType string) (any, error) {
+	if columnType == csvTypeText {
+		return raw, nil
+	}
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		return nil, nil
+	}
+	switch columnType {
+	case csvTypeBigint:
+		return strconv.ParseInt(value, 10, 64)
+	case csvTypeInteger:
+		n, err := strconv.ParseInt(value, 10, 32)
+		return int32(n), err
+	case csvTypeDouble:
+		return strconv.ParseFloat(value, 64)
+	case csvTypeNumeric:
+		var n pgtype.Numeric
+		if err := n.Scan(value); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case csvTypeBoolean:
+		switch strings.ToLower(value) {
+		case "true", "t":
+			return true, nil
+		case "false", "f":
+			return false, nil
+		}
+		return nil, fmt.Errorf("无效的布尔值 '%s'", value)
+	case csvTypeDate:
+		return time.Parse("2006-01-02", value)
+	case csvTypeTimestamptz:
+		for _, layout := range csvTimestampLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("无效的时间戳 '%s'", value)
+	case csvTypeJSONB:
+		if !json.Valid([]byte(value)) {
+			return nil, fmt.Errorf("无效的 JSON")
+		}
+		return json.RawMessage(value), nil
+	default:
+		return nil, fmt.Errorf("不支持的类型 '%s'", columnType)
+	}
+}
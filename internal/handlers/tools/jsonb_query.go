@@ -0,0 +1,244 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultJSONBQueryLimit = 50   // 默认返回行数
+	maxJSONBQueryLimit     = 1000 // 返回行数上限，防止一次性拉取过多数据
+)
+
+// jsonbComparisonOperators 是允许在 jsonpath 过滤表达式中使用的比较运算符。
+var jsonbComparisonOperators = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+// JSONBQueryToolArgs 是 'jsonb_query' 工具的输入参数。
+type JSONBQueryToolArgs struct {
+	ConnID   string   `json:"conn_id"`
+	Schema   string   `json:"schema"`
+	Table    string   `json:"table"`
+	Column   string   `json:"column"`            // jsonb 列名
+	Path     []string `json:"path"`              // JSON 路径段，纯数字段视为数组下标
+	Operator string   `json:"operator"`          // contains / exists / == / != / < / <= / > / >= / like_regex / starts_with
+	Value    any      `json:"value,omitempty"`   // 比较值 (exists 时可省略)
+	Select   []string `json:"select,omitempty"`  // 需要返回的列，默认全部
+	Extract  bool     `json:"extract,omitempty"` // 是否额外返回路径上的值 (jsonb_path_query_first)
+	Limit    int      `json:"limit,omitempty"`   // 返回行数
+}
+
+// JSONBQueryTool 是 'jsonb_query' 工具的定义。
+// value 可以是任意 JSON 类型，库不支持 "any"，所以 Schema 中定义为 string (与 pg_query 的 params 相同的妥协)。
+var JSONBQueryTool = &protocol.Tool{
+	Name:        "jsonb_query",
+	Description: "根据结构化的路径/条件描述构造参数化的 jsonb 查询 (@> 或 jsonb_path_exists)，避免手写 jsonpath 语法错误",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"conn_id":  {Type: protocol.String, Description: "目标数据库的连接 ID"},
+			"schema":   {Type: protocol.String, Description: "表所在的 Schema"},
+			"table":    {Type: protocol.String, Description: "表名"},
+			"column":   {Type: protocol.String, Description: "jsonb 类型的列名"},
+			"path":     {Type: protocol.Array, Description: "JSON 路径段列表，例如 [\"address\", \"city\"]；纯数字段视为数组下标", Items: &protocol.Property{Type: protocol.String}},
+			"operator": {Type: protocol.String, Description: "条件运算符: contains, exists, ==, !=, <, <=, >, >=, like_regex, starts_with"},
+			"value":    {Type: protocol.String, Description: "(可选) 比较值，可以是任意 JSON 类型；like_regex 时为正则表达式"},
+			"select":   {Type: protocol.Array, Description: "(可选) 需要返回的列名列表，默认返回全部列", Items: &protocol.Property{Type: protocol.String}},
+			"extract":  {Type: protocol.Boolean, Description: "(可选) 是否额外返回路径上的值 (extracted_value 列)"},
+			"limit":    {Type: protocol.Integer, Description: "(可选) 返回行数，默认 50，最大 1000"},
+		},
+		Required: []string{"conn_id", "schema", "table", "column", "path", "operator"},
+	},
+}
+
+// JSONBQueryHandler 处理 jsonb 路径查询的工具调用。
+type JSONBQueryHandler struct {
+	dbService databases.Service
+	masker    *masking.Masker
+}
+
+// NewJSONBQueryHandler 创建一个新的 JSONBQueryHandler。
+func NewJSONBQueryHandler(dbService databases.Service, masker *masking.Masker) *JSONBQueryHandler {
+	return &JSONBQueryHandler{dbService: dbService, masker: masker}
+}
+
+// HandleJSONBQuery 处理 'jsonb_query' 工具的调用请求。
+func (h *JSONBQueryHandler) HandleJSONBQuery(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	utils.DefaultLogger.Info("收到 'jsonb_query' 工具调用请求")
+
+	args := new(JSONBQueryToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Schema == "" || args.Table == "" || args.Column == "" {
+		return nil, fmt.Errorf("缺少 'conn_id', 'schema', 'table' 或 'column' 参数")
+	}
+	// 按脱敏列过滤或提取其中的值会泄露原始数据
+	if h.masker.ModeFor(args.Schema, args.Table, args.Column) != "" {
+		return newErrorResult(fmt.Sprintf("列 '%s.%s.%s' 已配置脱敏，不能用于 jsonb 查询", args.Schema, args.Table, args.Column), nil), nil
+	}
+
+	query, params, err := buildJSONBQuery(args)
+	if err != nil {
+		utils.DefaultLogger.Error("'jsonb_query' 构造查询失败", zap.Error(err), zap.Any("args", args))
+		return newErrorResult("构造 jsonb 查询失败", err), nil
+	}
+	utils.DefaultLogger.Debug("执行 jsonb 查询", zap.String("connID", args.ConnID), zap.String("query", query), zap.Any("params", params))
+
+	result, err := h.dbService.QueryWithColumns(ctx, args.ConnID, true, query, params...) // readOnly = true
+	if err != nil {
+		utils.DefaultLogger.Error("执行 'jsonb_query' 失败", zap.String("connID", args.ConnID), zap.String("query", query), zap.Error(err))
+		return newErrorResult("查询执行失败", err), nil
+	}
+	if err := h.masker.MaskResult(ctx, args.ConnID, result); err != nil {
+		return newErrorResult("结果脱敏失败", err), nil
+	}
+
+	utils.DefaultLogger.Info("jsonb 查询执行成功", zap.String("connID", args.ConnID), zap.Int("rowCount", len(result.Rows)))
+
+	// 同时返回生成的 SQL，便于调用方复用或在 pg_query 中继续调整
+	return newJSONResult(map[string]any{
+		"sql":    query,
+		"params": params,
+		"rows":   result.Rows,
+	})
+}
+
+// buildJSONBQuery 根据结构化参数构造参数化 SQL。
+// 所有用户提供的值都通过 $N 参数传递；标识符通过 sqlsafe 校验并引用。
+func buildJSONBQuery(args *JSONBQueryToolArgs) (string, []any, error) {
+	if len(args.Path) == 0 && args.Operator != "contains" {
+		return "", nil, fmt.Errorf("'path' 不能为空")
+	}
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultJSONBQueryLimit
+	}
+	if limit > maxJSONBQueryLimit {
+		limit = maxJSONBQueryLimit
+	}
+
+	column, err := sqlsafe.QuoteIdentifier(args.Column)
+	if err != nil {
+		return "", nil, fmt.Errorf("无效的列名: %w", err)
+	}
+	table, err := sqlsafe.QuoteQualified(args.Schema, args.Table)
+	if err != nil {
+		return "", nil, err
+	}
+	jsonPath := buildJSONPath(args.Path)
+
+	var params []any
+	var condition string
+	operator := strings.TrimSpace(args.Operator)
+	switch {
+	case operator == "contains":
+		if args.Value == nil {
+			return "", nil, fmt.Errorf("'contains' 运算符需要提供 'value'")
+		}
+		docBytes, err := json.Marshal(nestJSONValue(args.Path, args.Value))
+		if err != nil {
+			return "", nil, fmt.Errorf("序列化包含条件失败: %w", err)
+		}
+		params = append(params, string(docBytes))
+		condition = fmt.Sprintf("%s @> $%d::jsonb", column, len(params))
+	case operator == "exists":
+		params = append(params, jsonPath)
+		condition = fmt.Sprintf("jsonb_path_exists(%s, $%d::jsonpath)", column, len(params))
+	case jsonbComparisonOperators[operator] || operator == "starts_with":
+		if args.Value == nil {
+			return "", nil, fmt.Errorf("'%s' 运算符需要提供 'value'", operator)
+		}
+		jsonOperator := operator
+		if operator == "starts_with" {
+			jsonOperator = "starts with"
+		}
+		varsBytes, err := json.Marshal(map[string]any{"v": args.Value})
+		if err != nil {
+			return "", nil, fmt.Errorf("序列化比较值失败: %w", err)
+		}
+		// 比较值通过 jsonpath 变量 $v 传入，而不是拼接到路径表达式中
+		params = append(params, fmt.Sprintf("%s ? (@ %s $v)", jsonPath, jsonOperator), string(varsBytes))
+		condition = fmt.Sprintf("jsonb_path_exists(%s, $%d::jsonpath, $%d::jsonb)", column, len(params)-1, len(params))
+	case operator == "like_regex":
+		pattern, ok := args.Value.(string)
+		if !ok || pattern == "" {
+			return "", nil, fmt.Errorf("'like_regex' 运算符需要字符串类型的 'value'")
+		}
+		// like_regex 的模式必须是 jsonpath 字符串字面量，不能使用变量
+		params = append(params, fmt.Sprintf("%s ? (@ like_regex %s)", jsonPath, quoteJSONPathString(pattern)))
+		condition = fmt.Sprintf("jsonb_path_exists(%s, $%d::jsonpath)", column, len(params))
+	default:
+		return "", nil, fmt.Errorf("不支持的运算符: '%s'", args.Operator)
+	}
+
+	selectList := "*"
+	if len(args.Select) > 0 {
+		quoted, err := sqlsafe.QuoteIdentifiers(args.Select)
+		if err != nil {
+			return "", nil, err
+		}
+		selectList = strings.Join(quoted, ", ")
+	}
+	if args.Extract && len(args.Path) > 0 {
+		params = append(params, jsonPath)
+		selectList += fmt.Sprintf(", jsonb_path_query_first(%s, $%d::jsonpath) AS extracted_value", column, len(params))
+	}
+
+	params = append(params, limit)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s LIMIT $%d",
+		selectList,
+		table,
+		condition,
+		len(params),
+	)
+	return query, params, nil
+}
+
+// buildJSONPath 将路径段转换为严格的 jsonpath 表达式，例如 ["a", "0", "b"] -> $."a"[0]."b"
+func buildJSONPath(path []string) string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, segment := range path {
+		if index, err := strconv.Atoi(segment); err == nil && index >= 0 {
+			sb.WriteString(fmt.Sprintf("[%d]", index))
+			continue
+		}
+		sb.WriteString(".")
+		sb.WriteString(quoteJSONPathString(segment))
+	}
+	return sb.String()
+}
+
+// quoteJSONPathString 将字符串转为 jsonpath 字符串字面量 (双引号包裹，转义反斜杠和双引号)
+func quoteJSONPathString(s string) string {
+	escaped := strings.ReplaceAll(s, `\`, `\\`)
+	escaped = strings.ReplaceAll(escaped, `"`, `\"`)
+	return `"` + escaped + `"`
+}
+
+// nestJSONValue 根据路径段构造 @> 使用的嵌套文档，例如 ["a", "b"], 1 -> {"a": {"b": 1}}
+// 非负整数段在包含语义下构造为单元素数组，表示"数组中包含该元素"；与 buildJSONPath 一致，其他段 (包括 "-1") 都是对象键。
+func nestJSONValue(path []string, value any) any {
+	nested := value
+	for i := len(path) - 1; i >= 0; i-- {
+		if index, err := strconv.Atoi(path[i]); err == nil && index >= 0 {
+			nested = []any{nested}
+			continue
+		}
+		nested = map[string]any{path[i]: nested}
+	}
+	return nested
+}
@@ -0,0 +1,34 @@
+package tools
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONPathSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     []string
+		wantPath string
+		wantDoc  string
+	}{
+		{name: "对象键", path: []string{"a", "b"}, wantPath: `$."a"."b"`, wantDoc: `{"a":{"b":1}}`},
+		{name: "数组下标", path: []string{"items", "0"}, wantPath: `$."items"[0]`, wantDoc: `{"items":[1]}`},
+		{name: "负数是对象键", path: []string{"offsets", "-1"}, wantPath: `$."offsets"."-1"`, wantDoc: `{"offsets":{"-1":1}}`},
+		{name: "只有负数段", path: []string{"-1"}, wantPath: `$."-1"`, wantDoc: `{"-1":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildJSONPath(tt.path); got != tt.wantPath {
+				t.Errorf("buildJSONPath(%q) = %s, want %s", tt.path, got, tt.wantPath)
+			}
+			doc, err := json.Marshal(nestJSONValue(tt.path, 1))
+			if err != nil {
+				t.Fatalf("序列化失败: %v", err)
+			}
+			if string(doc) != tt.wantDoc {
+				t.Errorf("nestJSONValue(%q) = %s, want %s", tt.path, doc, tt.wantDoc)
+			}
+		})
+	}
+}
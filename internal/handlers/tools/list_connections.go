@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ListConnectionsToolArgs 是 'list_connections' 工具的输入参数。
+type ListConnectionsToolArgs struct {
+	Ping bool `json:"ping,omitempty" description:"(可选) 为 true 时 Ping 已创建的连接池并返回健康状态和耗时"`
+}
+
+// SchemaCacheFreshness 是 Schema 缓存相对某个连接的新鲜度
+type SchemaCacheFreshness struct {
+	Loaded     bool       `json:"loaded"` // 缓存是否由该连接加载
+	LoadedAt   *time.Time `json:"loaded_at,omitempty"`
+	AgeSeconds *int64     `json:"age_seconds,omitempty"`
+}
+
+// ConnectionListing 是 'list_connections' 返回的一个连接
+type ConnectionListing struct {
+	databases.ConnectionSummary
+	SchemaCache SchemaCacheFreshness `json:"schema_cache"`
+}
+
+// ListConnectionsHandler 处理列出已注册连接的工具调用。
+type ListConnectionsHandler struct {
+	dbService     databases.Service
+	schemaManager schemas.Manager
+}
+
+// NewListConnectionsHandler 创建一个新的 ListConnectionsHandler。
+func NewListConnectionsHandler(dbService databases.Service, schemaManager schemas.Manager) *ListConnectionsHandler {
+	return &ListConnectionsHandler{dbService: dbService, schemaManager: schemaManager}
+}
+
+// HandleListConnections 处理 'list_connections' 工具的调用请求。
+// 返回每个已注册 connID 的主机、数据库和用户 (不含密码)、访问模式、连接池状态、最近使用时间，
+// 以及 Schema 缓存是否由该连接加载和加载时间，便于复用已有连接而不是重复注册。
+func (h *ListConnectionsHandler) HandleListConnections(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(ListConnectionsToolArgs)
+	if len(req.RawArguments) > 0 {
+		if err := json.Unmarshal(req.RawArguments, args); err != nil {
+			return nil, fmt.Errorf("参数解析错误: %w", err)
+		}
+	}
+
+	cache := h.schemaManager.CacheInfo()
+	now := time.Now()
+	connections := []ConnectionListing{}
+	for _, summary := range h.dbService.ListConnections(ctx, args.Ping) {
+		listing := ConnectionListing{ConnectionSummary: summary}
+		if cache.ConnID == summary.ConnID && cache.LoadedAt != nil {
+			age := int64(now.Sub(*cache.LoadedAt).Seconds())
+			listing.SchemaCache = SchemaCacheFreshness{Loaded: true, LoadedAt: cache.LoadedAt, AgeSeconds: &age}
+		}
+		connections = append(connections, listing)
+	}
+
+	utils.DefaultLogger.Info("列出已注册连接", zap.Int("count", len(connections)), zap.Bool("ping", args.Ping))
+	return newJSONResult(map[string]any{
+		"connections":  connections,
+		"count":        len(connections),
+		"schema_cache": cache,
+	})
+}
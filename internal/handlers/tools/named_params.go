@@ -0,0 +1,66 @@
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+)
+
+// BindNamedParams 将查询中的 :name 命名参数替换为 $N 位置参数。
+// 编号从 len(positional)+1 开始，因此命名参数可以与已有的位置参数混用；同名参数多次出现时共用同一个位置。
+// 按 sqlguard.Lex 的词法单元扫描，字符串字面量 (包括 E'...')、引号标识符、美元引用字符串、注释以及 :: 类型转换中的内容不会被替换。
+// 只替换 named 中提供的名称；提供了但查询中未使用的名称视为错误，以便发现拼写错误。
+func BindNamedParams(query string, positional []any, named map[string]any) (string, []any, error) {
+	if len(named) == 0 {
+		return query, positional, nil
+	}
+	params := append([]any{}, positional...)
+	positions := make(map[string]int, len(named))
+
+	var sb strings.Builder
+	tokens := sqlguard.Lex(query)
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token.Kind != sqlguard.TokenOther || token.Text != ":" || i+1 == len(tokens) {
+			sb.WriteString(token.Text)
+			continue
+		}
+		next := tokens[i+1]
+		switch {
+		case next.Kind == sqlguard.TokenOther && next.Text == ":":
+			sb.WriteString("::") // 类型转换
+			i++
+		case next.Kind == sqlguard.TokenWord:
+			value, ok := named[next.Text]
+			if !ok {
+				sb.WriteString(":" + next.Text) // 未提供的名称原样保留 (例如数组切片 arr[lo:hi])
+				i++
+				continue
+			}
+			position, seen := positions[next.Text]
+			if !seen {
+				params = append(params, value)
+				position = len(params)
+				positions[next.Text] = position
+			}
+			fmt.Fprintf(&sb, "$%d", position)
+			i++
+		default:
+			sb.WriteString(token.Text)
+		}
+	}
+
+	if len(positions) < len(named) {
+		var unused []string
+		for name := range named {
+			if _, used := positions[name]; !used {
+				unused = append(unused, name)
+			}
+		}
+		sort.Strings(unused)
+		return "", nil, fmt.Errorf("命名参数未在查询中使用: %s", strings.Join(unused, ", "))
+	}
+	return sb.String(), params, nil
+}
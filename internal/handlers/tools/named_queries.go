@@ -0,0 +1,206 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/namedqueries"
+	"github.com/cbc3929/pg_mcp_server/internal/core/results"
+	"github.com/cbc3929/pg_mcp_server/internal/core/toolpacks"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// RegisterQueryToolArgs 是 'register_query' 工具的输入参数。
+type RegisterQueryToolArgs struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description"`
+	SQL         string               `json:"sql"`
+	Params      []toolpacks.ParamDef `json:"params,omitempty"`
+	ConnIDs     []string             `json:"conn_ids,omitempty"`
+	Timeout     string               `json:"timeout,omitempty"`
+}
+
+// RunNamedQueryToolArgs 是 'run_named_query' 工具的输入参数。
+type RunNamedQueryToolArgs struct {
+	ConnID string         `json:"conn_id"`
+	Name   string         `json:"name"`
+	Params map[string]any `json:"params,omitempty"`
+	Format string         `json:"format,omitempty"`
+}
+
+// ListNamedQueriesToolArgs 是 'list_named_queries' 工具的输入参数 (没有参数)。
+type ListNamedQueriesToolArgs struct{}
+
+// RegisterQueryTool 是 'register_query' 工具的定义。参数定义是对象数组，Schema 手动定义。
+var RegisterQueryTool = &protocol.Tool{
+	Name:        "register_query",
+	Description: "登记一个经过审核的参数化查询 (名称 + SQL 模板 + 参数定义)，之后通过 run_named_query 按名称运行，调用方只能提供参数值；同名查询会被替换 (服务端注册表文件中配置的查询不能替换)",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"name":        {Type: protocol.String, Description: "查询名称 (小写字母、数字和下划线，以字母开头)"},
+			"description": {Type: protocol.String, Description: "查询说明，说明查询的用途和返回内容"},
+			"sql":         {Type: protocol.String, Description: "只读 SQL 模板，参数使用 :name 命名占位符，例如 SELECT * FROM orders WHERE customer_id = :customer_id"},
+			"params": {
+				Type:        protocol.Array,
+				Description: "(可选) 参数定义列表，每项为 {name, type (string/integer/number/boolean/array/object), description, required, default}",
+				Items:       &protocol.Property{Type: protocol.ObjectT},
+			},
+			"conn_ids": {
+				Type:        protocol.Array,
+				Description: "(可选) 允许运行该查询的连接 ID 列表，为空时可以在任意连接上运行",
+				Items:       &protocol.Property{Type: protocol.String},
+			},
+			"timeout": {Type: protocol.String, Description: "(可选) 执行超时 (例如 30s, 2m)，默认 60s"},
+		},
+		Required: []string{"name", "description", "sql"},
+	},
+}
+
+// RunNamedQueryTool 是 'run_named_query' 工具的定义。
+var RunNamedQueryTool = &protocol.Tool{
+	Name:        "run_named_query",
+	Description: "按名称运行已登记的命名查询 (只读)，只需提供参数值；可用的查询及其参数见 list_named_queries",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"conn_id": {Type: protocol.String, Description: "目标数据库的连接 ID"},
+			"name":    {Type: protocol.String, Description: "命名查询的名称"},
+			"params":  {Type: protocol.ObjectT, Description: "(可选) 参数对象，键为参数名，例如 {\"customer_id\": 42}"},
+			"format":  {Type: protocol.String, Description: "(可选) 结果格式: json (默认), csv, tsv, markdown"},
+		},
+		Required: []string{"conn_id", "name"},
+	},
+}
+
+// NamedQueryHandler 处理命名查询相关的工具调用。
+type NamedQueryHandler struct {
+	dbService databases.Service
+	masker    *masking.Masker
+	registry  *namedqueries.Registry
+}
+
+// NewNamedQueryHandler 创建一个新的 NamedQueryHandler。
+func NewNamedQueryHandler(dbService databases.Service, masker *masking.Masker, registry *namedqueries.Registry) *NamedQueryHandler {
+	return &NamedQueryHandler{dbService: dbService, masker: masker, registry: registry}
+}
+
+// HandleRegisterQuery 处理 'register_query' 工具的调用请求。
+func (h *NamedQueryHandler) HandleRegisterQuery(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(RegisterQueryToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.Name == "" || args.SQL == "" {
+		return nil, fmt.Errorf("缺少 'name' 或 'sql' 参数")
+	}
+
+	query := namedqueries.Query{
+		Name:        args.Name,
+		Description: args.Description,
+		SQL:         args.SQL,
+		Params:      args.Params,
+		ConnIDs:     args.ConnIDs,
+		Timeout:     args.Timeout,
+		Source:      namedqueries.SourceRegisterQuery,
+	}
+	// 与工具包相同: SQL 模板中的占位符必须都有参数定义
+	if _, err := PackTool(query.ToolDef()); err != nil {
+		return newErrorResult("命名查询无效", err), nil
+	}
+	replaced, err := h.registry.Register(query)
+	if err != nil {
+		return newErrorResult("注册命名查询失败", err), nil
+	}
+	registered, _ := h.registry.Get(args.Name)
+	return newJSONResult(map[string]any{"success": true, "replaced": replaced, "query": registered})
+}
+
+// HandleListNamedQueries 处理 'list_named_queries' 工具的调用请求。
+func (h *NamedQueryHandler) HandleListNamedQueries(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	return newJSONResult(map[string]any{"queries": h.registry.List()})
+}
+
+// HandleRunNamedQuery 处理 'run_named_query' 工具的调用请求。
+// 参数按查询的参数定义校验后通过占位符传入，SQL 文本不受调用方影响。
+func (h *NamedQueryHandler) HandleRunNamedQuery(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(RunNamedQueryToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Name == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 或 'name' 参数")
+	}
+	format := strings.ToLower(args.Format)
+	if !results.IsSupportedFormat(format) {
+		return nil, fmt.Errorf("不支持的 'format': '%s' (可选 json, csv, tsv, markdown)", args.Format)
+	}
+
+	query, err := h.registry.Get(args.Name)
+	if err != nil {
+		if errors.Is(err, namedqueries.ErrNotFound) {
+			var names []string
+			for _, registered := range h.registry.List() {
+				names = append(names, registered.Name)
+			}
+			return newErrorResult(fmt.Sprintf("%v，可用的命名查询: [%s]", err, strings.Join(names, ", ")), nil), nil
+		}
+		return newErrorResult("获取命名查询失败", err), nil
+	}
+	if !query.AllowsConn(args.ConnID) {
+		return newErrorResult(fmt.Sprintf("命名查询 '%s' 不允许在连接 '%s' 上运行", query.Name, args.ConnID), nil), nil
+	}
+	utils.DefaultLogger.Info("运行命名查询", zap.String("name", query.Name), zap.String("connID", args.ConnID))
+	return runReadOnlyDef(ctx, h.dbService, h.masker, args.ConnID, query.ToolDef(), args.Params, format, map[string]any{"named_query": query.Name})
+}
+
+// runReadOnlyDef 按工具定义校验参数、绑定占位符并以只读方式执行 (命名查询和查询模板共用)，
+// 返回编码后的结果和执行信息 (details 中的字段一并放入执行信息内容块)。
+func runReadOnlyDef(ctx context.Context, dbService databases.Service, masker *masking.Masker, connID string, def toolpacks.ToolDef, arguments map[string]any, format string, details map[string]any) (*protocol.CallToolResult, error) {
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+	named, err := def.BindArgs(arguments)
+	if err != nil {
+		return newErrorResult("参数校验失败", err), nil
+	}
+	sql, params, err := BindNamedParams(def.SQL, nil, named)
+	if err != nil {
+		return newErrorResult("参数绑定失败", err), nil
+	}
+
+	ctx, cancel := context.WithTimeout(databases.WithResultCache(ctx), def.ExecTimeout())
+	defer cancel()
+	started := time.Now()
+	queryResult, err := dbService.QueryWithColumns(ctx, connID, true, sql, params...)
+	elapsed := time.Since(started)
+	if err != nil {
+		utils.DefaultLogger.Error("参数化查询执行失败", zap.String("name", def.Name), zap.String("connID", connID), zap.Error(err))
+		return newErrorResult("查询执行失败", err), nil
+	}
+	if err := masker.MaskResult(ctx, connID, queryResult); err != nil {
+		return newErrorResult("结果脱敏失败", err), nil
+	}
+	encoded, err := results.Encode(format, queryResult.Columns, queryResult.Rows)
+	if err != nil {
+		return nil, err
+	}
+	details["execution"] = results.NewMetadata(elapsed, queryResult.Columns, queryResult.Rows, encoded)
+	if !queryResult.CachedAt.IsZero() {
+		details["cache_hit"] = true
+		details["cached_at"] = queryResult.CachedAt
+	}
+	detailBytes, _ := json.Marshal(details)
+	return &protocol.CallToolResult{Content: []protocol.Content{
+		protocol.TextContent{Type: results.MimeType(format), Text: encoded},
+		protocol.TextContent{Type: "application/json", Text: string(detailBytes)},
+	}}, nil
+}
@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/notifications"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// pollDefaultLimit 和 pollMaxWait 是 pg_poll_notifications 的默认返回条数和最长等待时间
+const (
+	pollDefaultLimit = 100
+	pollMaxWait      = 60 * time.Second
+)
+
+// PgListenToolArgs 是 'pg_listen' 工具的输入参数。
+type PgListenToolArgs struct {
+	ConnID  string `json:"conn_id" description:"连接 ID"`
+	Channel string `json:"channel" description:"要监听的频道名 (区分大小写，与 pg_notify 的第一个参数一致)"`
+}
+
+// PgUnlistenToolArgs 是 'pg_unlisten' 工具的输入参数。
+type PgUnlistenToolArgs struct {
+	ConnID  string `json:"conn_id" description:"连接 ID"`
+	Channel string `json:"channel,omitempty" description:"(可选) 要停止监听的频道名，为空时停止该连接上的所有频道"`
+}
+
+// PgPollNotificationsToolArgs 是 'pg_poll_notifications' 工具的输入参数。
+type PgPollNotificationsToolArgs struct {
+	ConnID  string `json:"conn_id,omitempty" description:"(可选) 只返回该连接 ID 的通知"`
+	Channel string `json:"channel,omitempty" description:"(可选) 只返回该频道的通知"`
+	SinceID int64  `json:"since_id,omitempty" description:"(可选) 只返回序号大于该值的通知，传入上次返回的 next_since_id 以继续读取"`
+	Limit   int    `json:"limit,omitempty" description:"(可选) 最多返回的通知条数，默认 100"`
+	WaitMS  int    `json:"wait_ms,omitempty" description:"(可选) 没有新通知时等待的毫秒数 (长轮询，最多 60000)，默认立即返回"`
+}
+
+// NotificationsHandler 处理 LISTEN/NOTIFY 相关的工具调用。
+type NotificationsHandler struct {
+	hub *notifications.Hub
+}
+
+// NewNotificationsHandler 创建一个新的 NotificationsHandler。
+func NewNotificationsHandler(hub *notifications.Hub) *NotificationsHandler {
+	return &NotificationsHandler{hub: hub}
+}
+
+// HandlePgListen 处理 'pg_listen' 工具的调用请求。
+func (h *NotificationsHandler) HandlePgListen(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(PgListenToolArgs)
+	if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Channel == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 或 'channel' 参数")
+	}
+
+	sub, err := h.hub.Listen(ctx, args.ConnID, args.Channel)
+	if err != nil {
+		if errors.Is(err, notifications.ErrTooManyChannels) {
+			return newErrorResult("无法监听更多频道", err), nil
+		}
+		utils.DefaultLogger.Error("监听通知频道失败", zap.String("connID", args.ConnID), zap.String("channel", args.Channel), zap.Error(err))
+		return newErrorResult("监听通知频道失败", err), nil
+	}
+	return newJSONResult(map[string]any{
+		"success":      true,
+		"subscription": sub,
+		"resource_uri": fmt.Sprintf("pgmcp://%s/notifications", args.ConnID),
+	})
+}
+
+// HandlePgUnlisten 处理 'pg_unlisten' 工具的调用请求。
+func (h *NotificationsHandler) HandlePgUnlisten(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(PgUnlistenToolArgs)
+	if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 参数")
+	}
+
+	if args.Channel == "" {
+		stopped := h.hub.UnlistenAll(args.ConnID)
+		return newJSONResult(map[string]any{"success": true, "stopped": stopped})
+	}
+	sub, found := h.hub.Unlisten(args.ConnID, args.Channel)
+	if !found {
+		return newErrorResult(fmt.Sprintf("连接 '%s' 未监听频道 '%s'", args.ConnID, args.Channel), nil), nil
+	}
+	return newJSONResult(map[string]any{"success": true, "subscription": sub})
+}
+
+// HandlePgPollNotifications 处理 'pg_poll_notifications' 工具的调用请求。
+// 返回游标之后的通知以及所有被监听频道的状态，客户端用 next_since_id 继续读取。
+func (h *NotificationsHandler) HandlePgPollNotifications(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(PgPollNotificationsToolArgs)
+	if len(req.RawArguments) > 0 { // 所有参数都是可选的，允许不传 arguments
+		if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+			return nil, fmt.Errorf("参数解析错误: %w", err)
+		}
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = pollDefaultLimit
+	}
+	wait := time.Duration(args.WaitMS) * time.Millisecond
+	if wait > pollMaxWait {
+		wait = pollMaxWait
+	}
+
+	received := h.hub.Poll(ctx, args.ConnID, args.Channel, args.SinceID, limit, wait)
+	nextSinceID := args.SinceID
+	if len(received) > 0 {
+		nextSinceID = received[len(received)-1].ID
+	}
+	if received == nil {
+		received = []notifications.Notification{}
+	}
+	return newJSONResult(map[string]any{
+		"notifications": received,
+		"next_since_id": nextSinceID,
+		"subscriptions": h.hub.Subscriptions(args.ConnID),
+	})
+}
@@ -0,0 +1,167 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+)
+
+// 分页查询缺少确定排序时的处理方式 (PAGINATION_ORDER_MODE)
+const (
+	PaginationOrderOff  = "off"  // 不检查
+	PaginationOrderWarn = "warn" // 在结果中附加警告
+	PaginationOrderFix  = "fix"  // 可以确定主键时自动追加 ORDER BY 主键，否则附加警告
+)
+
+var (
+	orderByPattern     = regexp.MustCompile(`(?i)\border\s+by\b`)
+	paginationPattern  = regexp.MustCompile(`(?i)\b(limit|offset|fetch\s+(first|next))\b`)
+	setOperatorPattern = regexp.MustCompile(`(?i)\b(union|intersect|except)\b`)
+	joinPattern        = regexp.MustCompile(`(?i)\bjoin\b`)
+	// 分组和去重: 结果行不再对应表中的单行
+	groupingPattern = regexp.MustCompile(`(?i)\b(group\s+by|having|distinct)\b`)
+	// 常见的聚合函数名 (后接左括号才视为调用)
+	aggregatePattern = regexp.MustCompile(`(?i)\b(count|sum|avg|min|max|every|bool_and|bool_or|bit_and|bit_or|bit_xor|array_agg|string_agg|json_agg|jsonb_agg|json_object_agg|jsonb_object_agg|xmlagg|range_agg|range_intersect_agg|any_value|mode|percentile_cont|percentile_disc|stddev|stddev_pop|stddev_samp|variance|var_pop|var_samp|corr|covar_pop|covar_samp|regr_[a-z]+|st_union|st_collect|st_extent)\s*$`)
+	// 顶层 FROM 后的单个表: FROM [schema.]table [[AS] alias] 后接子句关键字或结尾
+	singleFromPattern = regexp.MustCompile(`(?i)\bfrom\s+((?:"[^"]+"|[a-z_][a-z0-9_$]*)(?:\s*\.\s*(?:"[^"]+"|[a-z_][a-z0-9_$]*))?)(?:\s+(?:as\s+)?[a-z_][a-z0-9_$]*)?\s*(?:\bwhere\b|\bgroup\b|\bhaving\b|\bwindow\b|\blimit\b|\boffset\b|\bfetch\b|$)`)
+)
+
+// EnsureDeterministicOrder 检查带 LIMIT/OFFSET/FETCH 的查询在顶层是否有 ORDER BY。
+// 没有确定排序时，分页的每一页可能出现重复或遗漏的行。
+// mode 为 fix 且查询只涉及一张可在缓存中找到主键的表时，在分页子句前追加 ORDER BY 主键；
+// 查询带有 GROUP BY、HAVING、DISTINCT、聚合函数或集合运算时结果行不对应表中的行 (主键列甚至可能不可用)，
+// 与其他情况相同只返回原查询和一条警告 (warning 为空表示无需处理)。
+func EnsureDeterministicOrder(query string, schemaManager schemas.Manager, mode string) (string, string) {
+	if mode == PaginationOrderOff || mode == "" {
+		return query, ""
+	}
+	trimmed := strings.TrimRight(strings.TrimSpace(query), "; \t\r\n")
+	masked := maskSQL(trimmed)
+	pagination := paginationPattern.FindStringIndex(masked)
+	if pagination == nil || orderByPattern.MatchString(masked) {
+		return query, ""
+	}
+	warning := "查询使用了 LIMIT/OFFSET 分页但没有 ORDER BY，各页之间可能出现重复或遗漏的行，请按唯一键排序"
+	if mode != PaginationOrderFix || setOperatorPattern.MatchString(masked) || joinPattern.MatchString(masked) ||
+		groupingPattern.MatchString(masked) || hasTopLevelAggregate(trimmed, masked) {
+		return query, warning
+	}
+
+	match := singleFromPattern.FindStringSubmatchIndex(masked)
+	if match == nil || strings.Contains(trimmed[match[0]:match[2]], "(") {
+		return query, warning // FROM 后是子查询或函数，无法确定主键
+	}
+	primaryKey := lookupPrimaryKey(schemaManager, trimmed[match[2]:match[3]])
+	if len(primaryKey) == 0 {
+		return query, warning
+	}
+	quoted, err := sqlsafe.QuoteIdentifiers(primaryKey)
+	if err != nil {
+		return query, warning
+	}
+	rewritten := fmt.Sprintf("%s ORDER BY %s %s", strings.TrimRight(trimmed[:pagination[0]], " \t\r\n"), strings.Join(quoted, ", "), trimmed[pagination[0]:])
+	return rewritten, fmt.Sprintf("查询使用了分页但没有 ORDER BY，已自动按主键 (%s) 排序", strings.Join(primaryKey, ", "))
+}
+
+// hasTopLevelAggregate 判断查询在顶层 (不在子查询中) 是否调用了聚合函数。
+// masked 是 maskSQL(query)，长度相同: 左括号要在原查询中判断 (maskSQL 把括号替换为空格)，
+// 函数名在 masked 中判断 (子查询和字面量中的函数名已被替换为空格)
+func hasTopLevelAggregate(query, masked string) bool {
+	for i := 0; i < len(query); i++ {
+		if query[i] != '(' {
+			continue
+		}
+		// 只在左括号前的一小段中匹配函数名，避免对长查询反复扫描整个前缀
+		if aggregatePattern.MatchString(masked[max(0, i-64):i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupPrimaryKey 在缓存中查找表的主键列。未指定 Schema 时只在表名唯一时返回结果。
+func lookupPrimaryKey(schemaManager schemas.Manager, reference string) []string {
+	table := lookupCachedTable(schemaManager, reference)
+	if table == nil {
+		return nil
+	}
+	var primaryKey []string
+	for _, col := range table.Columns {
+		for _, constraint := range col.Constraints {
+			if constraint == schemas.PrimaryKeyConstraint {
+				primaryKey = append(primaryKey, col.Name)
+				break
+			}
+		}
+	}
+	return primaryKey
+}
+
+// lookupCachedTable 按 SQL 中的表引用 ([schema.]table，可带引号) 在缓存中查找表。
+// 未指定 Schema 时只在表名唯一时返回结果。
+func lookupCachedTable(schemaManager schemas.Manager, reference string) *schemas.TableInfo {
+	parts := strings.Split(reference, ".")
+	names := make([]string, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, `"`) {
+			names = append(names, strings.ReplaceAll(strings.Trim(part, `"`), `""`, `"`))
+		} else {
+			names = append(names, strings.ToLower(part))
+		}
+	}
+
+	var table *schemas.TableInfo
+	if len(names) == 2 {
+		table, _ = schemaManager.GetTableInfo(names[0], names[1])
+	} else if dbInfo, found := schemaManager.GetDatabaseInfo(); found {
+		for i := range dbInfo.Schemas {
+			for j := range dbInfo.Schemas[i].Tables {
+				if dbInfo.Schemas[i].Tables[j].Name != names[0] {
+					continue
+				}
+				if table != nil {
+					return nil // 多个 Schema 中有同名表，无法确定
+				}
+				table = &dbInfo.Schemas[i].Tables[j]
+			}
+		}
+	}
+	return table
+}
+
+// maskSQL 将字符串字面量、引号标识符、注释以及括号 (子查询、函数参数) 内的内容替换为空格，
+// 保持长度不变，使正则只匹配到顶层的子句关键字。
+// 引号标识符本身保留，以便解析 FROM 后的表名。
+func maskSQL(query string) string {
+	out := []byte(query)
+	depth := 0
+	for _, token := range sqlguard.Lex(query) {
+		switch {
+		case token.Kind == sqlguard.TokenString || token.Kind == sqlguard.TokenComment:
+			blankBytes(out[token.Start:token.End])
+		case token.Kind == sqlguard.TokenOther && token.Text == "(":
+			depth++
+			out[token.Start] = ' '
+		case token.Kind == sqlguard.TokenOther && token.Text == ")":
+			if depth > 0 {
+				depth--
+			}
+			out[token.Start] = ' '
+		case depth > 0:
+			blankBytes(out[token.Start:token.End])
+		}
+	}
+	return string(out)
+}
+
+// blankBytes 将 b 中的每个字节替换为空格
+func blankBytes(b []byte) {
+	for i := range b {
+		b[i] = ' '
+	}
+}
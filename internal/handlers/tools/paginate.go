@@ -0,0 +1,283 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// PaginateQueryToolArgs 是 'paginate_query' 工具的输入参数。
+type PaginateQueryToolArgs struct {
+	ConnID     string   `json:"conn_id"`
+	Query      string   `json:"query"`                // 基础 SELECT，不需要 ORDER BY / LIMIT
+	Params     []any    `json:"params,omitempty"`     // 基础查询的参数 ($1, $2...)
+	KeyColumns []string `json:"key_columns"`          // 组合起来唯一的排序键列
+	Descending bool     `json:"descending,omitempty"` // 是否按键降序
+	PageSize   int      `json:"page_size,omitempty"`  // 每页行数
+	Cursor     string   `json:"cursor,omitempty"`     // 上一页返回的 next_cursor
+}
+
+// PaginateQueryTool 是 'paginate_query' 工具的定义。
+// params 的元素可以是任意 JSON 类型，Schema 中定义为 string (与 pg_query 的 params 相同的妥协)。
+var PaginateQueryTool = &protocol.Tool{
+	Name:        "paginate_query",
+	Description: "对只读查询进行键集 (keyset) 分页: 按唯一键排序，每页返回 next_cursor，下一页传回即可。深度分页比 OFFSET 高效且不会重复或遗漏行",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"conn_id": {Type: protocol.String, Description: "目标数据库的连接 ID"},
+			"query":   {Type: protocol.String, Description: "基础 SELECT 查询 (不需要 ORDER BY 和 LIMIT)，结果中必须包含 key_columns 列"},
+			"params": {
+				Type:        protocol.Array,
+				Description: "(可选) 基础查询的参数列表 ($1, $2...)",
+				Items:       &protocol.Property{Type: protocol.String, Description: "数组中的单个参数 (Schema 定义为 string，但接受任意 JSON 类型)"},
+			},
+			"key_columns": {
+				Type:        protocol.Array,
+				Description: "排序键列名，组合起来必须唯一且非空，例如 [\"created_at\", \"id\"]",
+				Items:       &protocol.Property{Type: protocol.String},
+			},
+			"descending": {Type: protocol.Boolean, Description: "(可选) 是否按键降序，默认升序"},
+			"page_size":  {Type: protocol.Integer, Description: "(可选) 每页行数，默认 100，最大 1000"},
+			"cursor":     {Type: protocol.String, Description: "(可选) 上一页返回的 next_cursor，为空时返回第一页"},
+		},
+		Required: []string{"conn_id", "query", "key_columns"},
+	},
+}
+
+// pageCursor 是 next_cursor 的内容，以 base64 编码的 JSON 返回给调用方
+type pageCursor struct {
+	Fingerprint string `json:"f"` // 查询与排序键的摘要，防止游标被用于不同的查询
+	Values      []any  `json:"v"` // 上一页最后一行的键值 (文本形式)
+}
+
+// PaginateHandler 处理键集分页的工具调用。
+type PaginateHandler struct {
+	dbService databases.Service
+	masker    *masking.Masker
+}
+
+// NewPaginateHandler 创建一个新的 PaginateHandler。
+func NewPaginateHandler(dbService databases.Service, masker *masking.Masker) *PaginateHandler {
+	return &PaginateHandler{dbService: dbService, masker: masker}
+}
+
+// HandlePaginateQuery 处理 'paginate_query' 工具的调用请求。
+func (h *PaginateHandler) HandlePaginateQuery(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(PaginateQueryToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Query == "" || len(args.KeyColumns) == 0 {
+		return nil, fmt.Errorf("缺少 'conn_id', 'query' 或 'key_columns' 参数")
+	}
+	pageSize := args.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	query, params, err := buildKeysetQuery(args, pageSize)
+	if err != nil {
+		return newErrorResult("构造分页查询失败", err), nil
+	}
+	utils.DefaultLogger.Debug("执行键集分页查询", zap.String("connID", args.ConnID), zap.String("query", query))
+
+	result, err := h.dbService.QueryWithColumns(ctx, args.ConnID, true, query, params...)
+	if err != nil {
+		utils.DefaultLogger.Error("执行 'paginate_query' 失败", zap.String("connID", args.ConnID), zap.Error(err))
+		return newErrorResult("查询执行失败", err), nil
+	}
+	// 游标中保存的是键列的原始值，并且可以构造游标按键列比较，脱敏列不能作为排序键
+	masked, err := h.masker.MaskedColumns(ctx, args.ConnID, result)
+	if err != nil {
+		return newErrorResult("结果脱敏失败", err), nil
+	}
+	for _, col := range args.KeyColumns {
+		if masked[col] != "" {
+			return newErrorResult(fmt.Sprintf("键列 '%s' 已配置脱敏，不能用于分页", col), nil), nil
+		}
+	}
+	if err := h.masker.MaskResult(ctx, args.ConnID, result); err != nil {
+		return newErrorResult("结果脱敏失败", err), nil
+	}
+	results := result.Rows
+	hasMore := len(results) > pageSize
+	if hasMore {
+		results = results[:pageSize]
+	}
+
+	nextCursor := ""
+	if hasMore && len(results) > 0 {
+		nextCursor, err = encodePageCursor(args, results[len(results)-1])
+		if err != nil {
+			return newErrorResult("生成 next_cursor 失败", err), nil
+		}
+	}
+	if results == nil {
+		results = []map[string]any{}
+	}
+	return newJSONResult(map[string]any{
+		"rows":        results,
+		"row_count":   len(results),
+		"has_more":    hasMore,
+		"next_cursor": nextCursor, // 为空表示已经是最后一页
+	})
+}
+
+// buildKeysetQuery 构造形如
+// SELECT * FROM (<query>) AS page WHERE (k1, k2) > ($n, $n+1) ORDER BY k1, k2 LIMIT $m 的查询。
+// 比较值来自游标；多取一行用于判断是否还有下一页。
+func buildKeysetQuery(args *PaginateQueryToolArgs, pageSize int) (string, []any, error) {
+	base := strings.TrimRight(strings.TrimSpace(args.Query), "; \t\r\n")
+	params := append([]any{}, args.Params...)
+
+	keys := make([]string, 0, len(args.KeyColumns))
+	for _, col := range args.KeyColumns {
+		if col == "" {
+			return "", nil, fmt.Errorf("'key_columns' 包含空列名")
+		}
+		quoted, err := sqlsafe.QuoteIdentifier(col)
+		if err != nil {
+			return "", nil, fmt.Errorf("无效的键列名 '%s': %w", col, err)
+		}
+		keys = append(keys, "page."+quoted)
+	}
+	keyList := strings.Join(keys, ", ")
+	direction, comparison := "ASC", ">"
+	if args.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("SELECT * FROM (%s) AS page", base))
+	if args.Cursor != "" {
+		cursor, err := decodePageCursor(args)
+		if err != nil {
+			return "", nil, err
+		}
+		placeholders := make([]string, 0, len(cursor.Values))
+		for _, value := range cursor.Values {
+			params = append(params, value)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(params)))
+		}
+		// 行比较 (k1, k2) > (v1, v2) 可以直接使用 (k1, k2) 上的复合索引
+		sb.WriteString(fmt.Sprintf(" WHERE (%s) %s (%s)", keyList, comparison, strings.Join(placeholders, ", ")))
+	}
+	orderTerms := make([]string, 0, len(keys))
+	for _, key := range keys {
+		orderTerms = append(orderTerms, key+" "+direction)
+	}
+	params = append(params, pageSize+1)
+	sb.WriteString(fmt.Sprintf(" ORDER BY %s LIMIT $%d", strings.Join(orderTerms, ", "), len(params)))
+	return sb.String(), params, nil
+}
+
+// cursorFingerprint 计算查询、参数和排序键的摘要
+func cursorFingerprint(args *PaginateQueryToolArgs) string {
+	paramsBytes, _ := json.Marshal(args.Params)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%t",
+		strings.TrimSpace(args.Query), paramsBytes, strings.Join(args.KeyColumns, ","), args.Descending)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// encodePageCursor 根据当前页最后一行生成 next_cursor
+func encodePageCursor(args *PaginateQueryToolArgs, lastRow map[string]any) (string, error) {
+	cursor := pageCursor{Fingerprint: cursorFingerprint(args), Values: make([]any, 0, len(args.KeyColumns))}
+	for _, col := range args.KeyColumns {
+		value, ok := lastRow[col]
+		if !ok {
+			return "", fmt.Errorf("查询结果中没有键列 '%s'", col)
+		}
+		if value == nil {
+			return "", fmt.Errorf("键列 '%s' 存在 NULL 值，键集分页要求排序键非空", col)
+		}
+		text, err := cursorText(value)
+		if err != nil {
+			return "", fmt.Errorf("键列 '%s': %w", col, err)
+		}
+		cursor.Values = append(cursor.Values, text)
+	}
+	cursorBytes, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cursorBytes), nil
+}
+
+// decodePageCursor 解析并校验调用方传回的游标
+func decodePageCursor(args *PaginateQueryToolArgs) (*pageCursor, error) {
+	cursorBytes, err := base64.RawURLEncoding.DecodeString(args.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 'cursor': %w", err)
+	}
+	cursor := new(pageCursor)
+	if err := json.Unmarshal(cursorBytes, cursor); err != nil {
+		return nil, fmt.Errorf("无效的 'cursor': %w", err)
+	}
+	if cursor.Fingerprint != cursorFingerprint(args) {
+		return nil, fmt.Errorf("'cursor' 与当前的 query/params/key_columns/descending 不匹配，请从第一页重新开始")
+	}
+	if len(cursor.Values) != len(args.KeyColumns) {
+		return nil, fmt.Errorf("'cursor' 中的键值数量与 'key_columns' 不一致")
+	}
+	return cursor, nil
+}
+
+// cursorText 将键值转换为 PostgreSQL 可解析的文本形式。
+// 游标经过 JSON 往返后数字会变成 float64，统一使用文本可以避免精度丢失，
+// pgx 会以文本格式发送字符串参数，由服务端按键列的实际类型解析。
+func cursorText(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case [16]byte: // uuid
+		return fmt.Sprintf("%x-%x-%x-%x-%x", v[0:4], v[4:6], v[6:8], v[8:10], v[10:16]), nil
+	case driver.Valuer: // numeric 等 pgtype 类型
+		driverValue, err := v.Value()
+		if err != nil {
+			return "", err
+		}
+		if driverValue == nil {
+			return "", fmt.Errorf("键值为 NULL")
+		}
+		return cursorText(driverValue)
+	default:
+		return "", fmt.Errorf("不支持作为分页键的类型 %T", value)
+	}
+}
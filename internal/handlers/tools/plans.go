@@ -0,0 +1,144 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/extensions"
+	"github.com/cbc3929/pg_mcp_server/internal/core/plans"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// CheckPlanRegressionsToolArgs 是 'check_plan_regressions' 工具的输入参数。
+type CheckPlanRegressionsToolArgs struct {
+	ConnID      string `json:"conn_id" description:"目标数据库的连接 ID"`
+	Fingerprint string `json:"fingerprint,omitempty" description:"(可选) 只重新检查指定指纹的查询，默认检查该连接下所有已记录的查询"`
+}
+
+// PlanHandler 处理执行计划历史相关的工具调用。
+type PlanHandler struct {
+	dbService databases.Service
+	planStore *plans.Store
+}
+
+// NewPlanHandler 创建一个新的 PlanHandler。
+func NewPlanHandler(dbService databases.Service, planStore *plans.Store) *PlanHandler {
+	return &PlanHandler{dbService: dbService, planStore: planStore}
+}
+
+// ExplainPlan 执行 EXPLAIN (FORMAT JSON) 并返回计划的 JSON 文本。
+func ExplainPlan(ctx context.Context, dbService databases.Service, connID, query string, params []any) ([]byte, error) {
+	results, err := dbService.ExecuteQuery(ctx, connID, true, "EXPLAIN (FORMAT JSON) "+query, params...)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 || results[0] == nil {
+		return []byte("[]"), nil
+	}
+	if planField, ok := results[0]["QUERY PLAN"]; ok {
+		planBytes, err := json.Marshal(planField)
+		if err != nil {
+			return nil, fmt.Errorf("序列化 Explain Plan 失败: %w", err)
+		}
+		return planBytes, nil
+	}
+	resultBytes, err := json.Marshal(results)
+	if err != nil {
+		return nil, fmt.Errorf("序列化原始 Explain 结果失败: %w", err)
+	}
+	return resultBytes, nil
+}
+
+// AdvisePlan 用扩展知识中的 plan_advice 规则检查执行计划，表的大致行数取自 Schema 缓存。
+// 规则或计划解析失败只记录日志，返回已得到的建议。
+func AdvisePlan(planJSON []byte, extManager extensions.Manager, schemaManager schemas.Manager) []plans.Advice {
+	rules, errs := plans.KnowledgeAdviceRules(extManager.AllKnowledge())
+	for _, err := range errs {
+		utils.DefaultLogger.Warn("跳过无效的执行计划建议规则", zap.Error(err))
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	advice, err := plans.Advise(planJSON, rules, schemaTableRows(schemaManager))
+	if err != nil {
+		utils.DefaultLogger.Debug("生成执行计划建议失败", zap.Error(err))
+	}
+	return advice
+}
+
+// schemaTableRows 返回从 Schema 缓存查找表行数的函数；计划中没有 Schema 时取同名表中行数最多的一个
+func schemaTableRows(schemaManager schemas.Manager) plans.TableRowsFunc {
+	return func(schema, table string) (int64, bool) {
+		if schema != "" {
+			tableInfo, ok := schemaManager.GetTableInfo(schema, table)
+			if !ok {
+				return 0, false
+			}
+			return tableInfo.RowCount, true
+		}
+		info, ok := schemaManager.GetDatabaseInfo()
+		if !ok {
+			return 0, false
+		}
+		var rows int64
+		found := false
+		for _, schemaInfo := range info.Schemas {
+			for _, tableInfo := range schemaInfo.Tables {
+				if tableInfo.Name == table && (!found || tableInfo.RowCount > rows) {
+					rows, found = tableInfo.RowCount, true
+				}
+			}
+		}
+		return rows, found
+	}
+}
+
+// HandleCheckPlanRegressions 处理 'check_plan_regressions' 工具的调用请求。
+// 对已记录的查询重新执行 EXPLAIN，适合在 ANALYZE、建删索引或其他 Schema 变更后检查计划是否退化。
+func (h *PlanHandler) HandleCheckPlanRegressions(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(CheckPlanRegressionsToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 参数")
+	}
+
+	checked := 0
+	regressions := make([]*plans.Regression, 0)
+	failures := make([]map[string]string, 0)
+	for _, previous := range h.planStore.Latest(args.ConnID) {
+		if args.Fingerprint != "" && previous.Fingerprint != args.Fingerprint {
+			continue
+		}
+		checked++
+		planJSON, err := ExplainPlan(ctx, h.dbService, args.ConnID, previous.Query, previous.Params)
+		if err == nil {
+			var regression *plans.Regression
+			_, regression, err = h.planStore.Record(args.ConnID, previous.Query, previous.Params, planJSON)
+			if regression != nil {
+				regressions = append(regressions, regression)
+			}
+		}
+		if err != nil {
+			// 表被删除或列被重命名时 EXPLAIN 会失败，这本身也是需要关注的变化
+			failures = append(failures, map[string]string{"fingerprint": previous.Fingerprint, "query": previous.Query, "error": err.Error()})
+		}
+	}
+	if args.Fingerprint != "" && checked == 0 {
+		return newErrorResult(fmt.Sprintf("未找到指纹为 '%s' 的计划记录", args.Fingerprint), nil), nil
+	}
+
+	utils.DefaultLogger.Info("执行计划回归检查完成", zap.String("connID", args.ConnID), zap.Int("checked", checked),
+		zap.Int("regressions", len(regressions)), zap.Int("failures", len(failures)))
+	return newJSONResult(map[string]any{
+		"checked":     checked,
+		"regressions": regressions,
+		"failures":    failures,
+	})
+}
@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// queryLogTable 是导入查询历史的目标表，每次导入都会替换为最新的快照
+const queryLogTable = `"temp"."mcp_query_log"`
+
+// LoadQueryLogToolArgs 是 'load_query_log' 工具的输入参数。
+type LoadQueryLogToolArgs struct {
+	ConnID   string `json:"conn_id" description:"目标数据库的连接 ID，该连接自身的查询历史会写入该库的 temp.mcp_query_log 表"`
+	SlowOnly bool   `json:"slow_only,omitempty" description:"(可选) 为 true 时只导入慢查询"`
+}
+
+// QueryLogHandler 处理将服务端查询历史导入 temp schema 的工具调用。
+type QueryLogHandler struct {
+	dbService   databases.Service
+	reviewQueue *ReviewQueue // 审核模式下暂存写入，等待人工批准
+}
+
+// NewQueryLogHandler 创建一个新的 QueryLogHandler。
+func NewQueryLogHandler(dbService databases.Service, reviewQueue *ReviewQueue) *QueryLogHandler {
+	return &QueryLogHandler{dbService: dbService, reviewQueue: reviewQueue}
+}
+
+// HandleLoadQueryLog 处理 'load_query_log' 工具的调用请求。
+func (h *QueryLogHandler) HandleLoadQueryLog(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(LoadQueryLogToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 参数")
+	}
+
+	if err := ensureWritable(h.dbService, args.ConnID); err != nil {
+		return newErrorResult("写入被拒绝", err), nil
+	}
+
+	summary := "将服务端查询历史导入 temp.mcp_query_log (替换已有内容)"
+	return runReviewed(ctx, h.reviewQueue, args.ConnID, "load_query_log", summary, req, func(ctx context.Context) (*protocol.CallToolResult, error) {
+		return h.loadQueryLog(ctx, args)
+	})
+}
+
+// loadQueryLog 重建 temp.mcp_query_log 并写入该连接的历史快照。
+// 只导入本连接的查询: 其他连接的 SQL 可能来自其他会话或数据库。快照在写入前获取，导入语句本身不会出现在其中。
+// 语句通过 dbService.ExecuteNonQuery 执行，与其他写入一样经过访问策略检查并使结果缓存失效。
+func (h *QueryLogHandler) loadQueryLog(ctx context.Context, args *LoadQueryLogToolArgs) (*protocol.CallToolResult, error) {
+	entries := h.dbService.RecentQueries(args.ConnID)
+	if args.SlowOnly {
+		slowEntries := make([]databases.QueryLogEntry, 0, len(entries))
+		for _, entry := range entries {
+			if entry.Slow {
+				slowEntries = append(slowEntries, entry)
+			}
+		}
+		entries = slowEntries
+	}
+	entriesJSON, err := json.Marshal(entries)
+	if err != nil {
+		return nil, fmt.Errorf("序列化查询历史失败: %w", err)
+	}
+
+	statements := []string{
+		`DROP TABLE IF EXISTS ` + queryLogTable,
+		`CREATE TABLE ` + queryLogTable + ` (
+            query_id    text PRIMARY KEY,
+            conn_id     text NOT NULL,
+            sql         text NOT NULL,
+            read_only   boolean NOT NULL,
+            started_at  timestamptz NOT NULL,
+            duration_ms bigint NOT NULL,
+            slow        boolean NOT NULL,
+            error       text
+        )`,
+	}
+	for _, statement := range statements {
+		if err := h.dbService.ExecuteNonQuery(ctx, args.ConnID, false, statement); err != nil {
+			utils.DefaultLogger.Error("创建查询历史表失败", zap.String("connID", args.ConnID), zap.Error(err))
+			return newErrorResult("创建查询历史表失败", err), nil
+		}
+	}
+	insertSQL := `INSERT INTO ` + queryLogTable + `
+        SELECT query_id, conn_id, sql, read_only, started_at, duration_ms, slow, error
+        FROM jsonb_to_recordset($1::jsonb) AS r(
+            query_id text, conn_id text, sql text, read_only boolean,
+            started_at timestamptz, duration_ms bigint, slow boolean, error text)`
+	if err := h.dbService.ExecuteNonQuery(ctx, args.ConnID, false, insertSQL, string(entriesJSON)); err != nil {
+		utils.DefaultLogger.Error("写入查询历史失败", zap.String("connID", args.ConnID), zap.Error(err))
+		return newErrorResult("写入查询历史失败", err), nil
+	}
+
+	utils.DefaultLogger.Info("查询历史已导入 temp schema", zap.String("connID", args.ConnID), zap.Int("rowCount", len(entries)))
+	return newJSONResult(map[string]any{
+		"success":    true,
+		"table_name": "temp.mcp_query_log",
+		"rows_saved": len(entries),
+		"columns":    []string{"query_id", "conn_id", "sql", "read_only", "started_at", "duration_ms", "slow", "error"},
+	})
+}
@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/querylib"
+	"github.com/cbc3929/pg_mcp_server/internal/core/results"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// RunTemplateToolArgs 是 'run_template' 工具的输入参数。
+type RunTemplateToolArgs struct {
+	ConnID string         `json:"conn_id"`
+	Name   string         `json:"name"`
+	Params map[string]any `json:"params,omitempty"`
+	Format string         `json:"format,omitempty"`
+}
+
+// RunTemplateTool 是 'run_template' 工具的定义。
+var RunTemplateTool = &protocol.Tool{
+	Name:        "run_template",
+	Description: "运行查询模板库中的模板 (只读)，只需提供参数值；可用的模板及其参数见 pgmcp://server/query_templates 资源",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"conn_id": {Type: protocol.String, Description: "目标数据库的连接 ID"},
+			"name":    {Type: protocol.String, Description: "模板名称"},
+			"params":  {Type: protocol.ObjectT, Description: "(可选) 参数对象，键为参数名，例如 {\"seconds\": 300}"},
+			"format":  {Type: protocol.String, Description: "(可选) 结果格式: json (默认), csv, tsv, markdown"},
+		},
+		Required: []string{"conn_id", "name"},
+	},
+}
+
+// ValidateTemplate 检查模板 SQL 中的占位符与参数定义一致，供 querylib.NewManager 使用。
+func ValidateTemplate(template querylib.Template) error {
+	_, err := PackTool(template.ToolDef())
+	return err
+}
+
+// QueryTemplateHandler 处理查询模板相关的工具调用。
+type QueryTemplateHandler struct {
+	dbService databases.Service
+	masker    *masking.Masker
+	library   querylib.Manager
+}
+
+// NewQueryTemplateHandler 创建一个新的 QueryTemplateHandler。
+func NewQueryTemplateHandler(dbService databases.Service, masker *masking.Masker, library querylib.Manager) *QueryTemplateHandler {
+	return &QueryTemplateHandler{dbService: dbService, masker: masker, library: library}
+}
+
+// HandleRunTemplate 处理 'run_template' 工具的调用请求。
+func (h *QueryTemplateHandler) HandleRunTemplate(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(RunTemplateToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Name == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 或 'name' 参数")
+	}
+	format := strings.ToLower(args.Format)
+	if !results.IsSupportedFormat(format) {
+		return nil, fmt.Errorf("不支持的 'format': '%s' (可选 json, csv, tsv, markdown)", args.Format)
+	}
+
+	template, ok := h.library.GetTemplate(args.Name)
+	if !ok {
+		var names []string
+		for _, available := range h.library.AllTemplates() {
+			names = append(names, available.Name)
+		}
+		return newErrorResult(fmt.Sprintf("查询模板 '%s' 不存在，可用的模板: [%s]", args.Name, strings.Join(names, ", ")), nil), nil
+	}
+	utils.DefaultLogger.Info("运行查询模板", zap.String("library", template.Library), zap.String("template", template.Name), zap.String("connID", args.ConnID))
+	return runReadOnlyDef(ctx, h.dbService, h.masker, args.ConnID, template.ToolDef(), args.Params, format, map[string]any{"template": template.Name, "library": template.Library})
+}
@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// RefreshSchemaToolArgs 是 'refresh_schema' 工具的输入参数。
+type RefreshSchemaToolArgs struct {
+	ConnID      string `json:"conn_id,omitempty" description:"(可选) 用于加载 Schema 的连接 ID，默认使用当前缓存的来源连接"`
+	Incremental bool   `json:"incremental,omitempty" description:"(可选) 只重新加载自上次加载以来结构发生变化的表、视图、类型和函数 (比较目录行版本)；缓存来自其他连接时仍执行完整加载"`
+}
+
+// RefreshSchemaHandler 处理重新加载 Schema 缓存的工具调用。
+type RefreshSchemaHandler struct {
+	schemaManager schemas.Manager
+}
+
+// NewRefreshSchemaHandler 创建一个新的 RefreshSchemaHandler。
+func NewRefreshSchemaHandler(schemaManager schemas.Manager) *RefreshSchemaHandler {
+	return &RefreshSchemaHandler{schemaManager: schemaManager}
+}
+
+// HandleRefreshSchema 处理 'refresh_schema' 工具的调用请求。
+// 重新加载整个 Schema 缓存 (DDL 变更后使用)，incremental 为 true 时只重新加载发生变化的对象；
+// 缓存替换后订阅了 Schema 资源的客户端会收到更新通知。
+func (h *RefreshSchemaHandler) HandleRefreshSchema(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(RefreshSchemaToolArgs)
+	if len(req.RawArguments) > 0 {
+		if err := json.Unmarshal(req.RawArguments, args); err != nil {
+			return nil, fmt.Errorf("参数解析错误: %w", err)
+		}
+	}
+
+	previous := h.schemaManager.CacheInfo()
+	connID := args.ConnID
+	if connID == "" {
+		connID = previous.ConnID
+	}
+	if connID == "" {
+		return nil, fmt.Errorf("Schema 缓存尚未加载，必须提供 conn_id")
+	}
+
+	utils.DefaultLogger.Info("开始重新加载 Schema 缓存", zap.String("connID", connID), zap.String("previousConnID", previous.ConnID))
+	start := time.Now()
+	result := map[string]any{"previous": previous}
+	if args.Incremental {
+		changes, err := h.schemaManager.RefreshIncremental(ctx, connID)
+		if err != nil {
+			return newErrorResult("增量刷新 Schema 缓存失败，保留原有缓存", err), nil
+		}
+		result["changes"] = changes
+	} else if err := h.schemaManager.LoadSchema(ctx, connID); err != nil {
+		return newErrorResult("重新加载 Schema 缓存失败，保留原有缓存", err), nil
+	}
+
+	result["current"] = h.schemaManager.CacheInfo()
+	result["elapsed_ms"] = time.Since(start).Milliseconds()
+	return newJSONResult(result)
+}
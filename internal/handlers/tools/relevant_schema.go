@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/retrieval"
+	"github.com/cbc3929/pg_mcp_server/internal/handlers/resources"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRelevantTables = 5   // 默认返回的表数
+	maxRelevantTables     = 20  // 返回表数上限 (与表上下文资源一致)
+	maxRelevantSample     = 10  // 每张表样本行数上限
+	relevantKnowledge     = 3   // 返回的相关扩展知识数
+	minKnowledgeScore     = 0.2 // 低于该相似度的扩展知识不返回
+)
+
+// RelevantSchemaToolArgs 是 'relevant_schema' 工具的输入参数。
+type RelevantSchemaToolArgs struct {
+	ConnID   string `json:"conn_id" description:"通过 'connect' 工具获取的数据库连接 ID"`
+	Question string `json:"question" description:"要用 SQL 回答的自然语言问题"`
+	TopK     int    `json:"top_k,omitempty" description:"(可选) 返回最相关的表数，默认 5，最大 20"`
+	Schema   string `json:"schema,omitempty" description:"(可选) 只在该 Schema 中查找"`
+	Sample   int    `json:"sample,omitempty" description:"(可选) 每张表附带的样本行数，默认 0，最大 10"`
+}
+
+// RelevantSchemaResult 是 'relevant_schema' 工具的返回结果
+type RelevantSchemaResult struct {
+	Question  string                   `json:"question"`
+	Embedder  string                   `json:"embedder,omitempty"`  // 使用的嵌入方式 (未启用时为空)
+	Ranking   []retrieval.TableScore   `json:"ranking"`             // 按相关度降序的表
+	Knowledge []retrieval.Match        `json:"knowledge,omitempty"` // 相关的扩展知识 (可通过 pgmcp://{conn_id}/schemas/{schema}/extensions/{extension} 资源读取)
+	Context   *resources.ContextBundle `json:"context"`             // 这些表的上下文 (列、索引、外键关系、样本和统计)
+}
+
+// RelevantSchemaHandler 处理按问题检索相关表的工具调用。
+type RelevantSchemaHandler struct {
+	ranker        *retrieval.Ranker
+	contextBundle *resources.ContextBundleHandler
+}
+
+// NewRelevantSchemaHandler 创建一个新的 RelevantSchemaHandler。
+func NewRelevantSchemaHandler(ranker *retrieval.Ranker, contextBundle *resources.ContextBundleHandler) *RelevantSchemaHandler {
+	return &RelevantSchemaHandler{ranker: ranker, contextBundle: contextBundle}
+}
+
+// HandleRelevantSchema 处理 'relevant_schema' 工具的调用请求。
+func (h *RelevantSchemaHandler) HandleRelevantSchema(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(RelevantSchemaToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 参数")
+	}
+	if args.Question == "" {
+		return nil, fmt.Errorf("缺少 'question' 参数")
+	}
+	if args.TopK <= 0 {
+		args.TopK = defaultRelevantTables
+	}
+	args.TopK = min(args.TopK, maxRelevantTables)
+	args.Sample = min(max(args.Sample, 0), maxRelevantSample)
+
+	ranking, err := h.ranker.Rank(ctx, args.Question, retrieval.RankOptions{Schema: args.Schema, TopK: args.TopK})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(ranking))
+	for i, score := range ranking {
+		names[i] = score.Schema + "." + score.Table
+	}
+	bundle, err := h.contextBundle.Build(ctx, args.ConnID, names, args.Sample)
+	if err != nil {
+		return nil, err
+	}
+	knowledge, err := h.ranker.Knowledge(ctx, args.Question, relevantKnowledge)
+	if err != nil {
+		return nil, err
+	}
+	relevant := knowledge[:0]
+	for _, match := range knowledge {
+		if match.Score >= minKnowledgeScore {
+			relevant = append(relevant, match)
+		}
+	}
+	utils.DefaultLogger.Info("相关表检索完成", zap.String("question", args.Question), zap.Strings("tables", names))
+	return newJSONResult(RelevantSchemaResult{
+		Question:  args.Question,
+		Embedder:  h.ranker.EmbedderName(),
+		Ranking:   ranking,
+		Knowledge: relevant,
+		Context:   bundle,
+	})
+}
@@ -0,0 +1,36 @@
+package tools
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/extensions"
+)
+
+// ReloadExtensionsToolArgs 是 'reload_extensions' 工具的输入参数 (无参数)。
+type ReloadExtensionsToolArgs struct{}
+
+// ReloadExtensionsHandler 处理重新加载扩展知识的工具调用。
+type ReloadExtensionsHandler struct {
+	extManager extensions.Manager
+}
+
+// NewReloadExtensionsHandler 创建一个新的 ReloadExtensionsHandler。
+func NewReloadExtensionsHandler(extManager extensions.Manager) *ReloadExtensionsHandler {
+	return &ReloadExtensionsHandler{extManager: extManager}
+}
+
+// HandleReloadExtensions 处理 'reload_extensions' 工具的调用请求。
+// 重新读取扩展知识目录中的 YAML 文件，返回新增、修改、删除和加载失败的扩展。
+func (h *ReloadExtensionsHandler) HandleReloadExtensions(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	start := time.Now()
+	result, err := h.extManager.ReloadKnowledge()
+	if err != nil {
+		return newErrorResult("重新加载扩展知识失败，保留原有知识", err), nil
+	}
+	return newJSONResult(map[string]any{
+		"result":     result,
+		"elapsed_ms": time.Since(start).Milliseconds(),
+	})
+}
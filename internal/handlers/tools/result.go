@@ -0,0 +1,38 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// newJSONResult 将任意数据序列化为 JSON 并包装为成功的 CallToolResult。
+// 序列化失败属于内部错误，直接返回 error 给框架。
+func newJSONResult(data any) (*protocol.CallToolResult, error) {
+	resultBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("序列化响应失败: %w", err)
+	}
+	return &protocol.CallToolResult{
+		Content: []protocol.Content{
+			protocol.TextContent{Type: "text", Text: string(resultBytes)},
+		},
+	}, nil
+}
+
+// newErrorResult 构建业务错误结果 (IsError=true)。
+// 对于 Tool 调用，业务错误放在 Result 里返回，而不是返回 error 给框架。
+func newErrorResult(message string, err error) *protocol.CallToolResult {
+	errorData := map[string]any{"success": false, "error": message}
+	if err != nil {
+		errorData["error"] = fmt.Sprintf("%s: %v", message, err)
+	}
+	resultBytes, _ := json.Marshal(errorData) // map[string]any 序列化不会失败
+	return &protocol.CallToolResult{
+		Content: []protocol.Content{
+			protocol.TextContent{Type: "text", Text: string(resultBytes)},
+		},
+		IsError: true,
+	}
+}
@@ -0,0 +1,220 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// 待审核写入的状态
+const (
+	WriteStatusPending  = "pending"
+	WriteStatusApproved = "approved"
+	WriteStatusRejected = "rejected"
+	WriteStatusFailed   = "failed"
+	WriteStatusExpired  = "expired" // 超过 WRITE_REVIEW_TTL 仍未审核，不再执行
+)
+
+// ErrWriteNotPending 表示审核的写入不存在、已审核或已过期
+var ErrWriteNotPending = errors.New("写入不存在或已审核")
+
+// PendingWrite 是一条等待人工审核的写入操作。
+type PendingWrite struct {
+	WriteID     string         `json:"write_id"`              // 审核 ID
+	ConnID      string         `json:"conn_id"`               // 目标连接 ID
+	Tool        string         `json:"tool"`                  // 发起写入的工具
+	Summary     string         `json:"summary"`               // 写入内容的简要描述
+	Arguments   map[string]any `json:"-"`                     // 工具调用参数，只在审核接口中返回 (可能包含写入的数据)
+	Status      string         `json:"status"`                // pending / approved / rejected / failed / expired
+	CreatedAt   time.Time      `json:"created_at"`            // 入队时间
+	ExpiresAt   *time.Time     `json:"expires_at,omitempty"`  // 超过该时间仍未审核时不再执行，WRITE_REVIEW_TTL 为 0 时为空
+	ReviewedAt  *time.Time     `json:"reviewed_at,omitempty"` // 审核 (或过期) 时间
+	ReviewNote  string         `json:"review_note,omitempty"` // 审核备注
+	ResultError string         `json:"error,omitempty"`       // 批准后执行失败的错误信息
+
+	execute func(ctx context.Context) (*protocol.CallToolResult, error) // 批准后执行的实际写入
+}
+
+// ReviewQueue 在审核模式下暂存写入工具的调用，直到操作员通过审核接口 (ReviewAPI) 批准后才执行。
+// 审核不通过 MCP 工具进行，发起写入的客户端无法批准自己的写入。
+type ReviewQueue struct {
+	enabled    bool
+	ttl        time.Duration // 待审核写入的有效期，审核结果也在该时长后移除
+	maxPending int           // 同时等待审核的写入数上限
+	mu         sync.Mutex
+	writes     map[string]*PendingWrite // writeID -> 写入
+}
+
+// NewReviewQueue 创建一个新的 ReviewQueue。未开启 WRITE_REVIEW_MODE 时写入工具直接执行。
+func NewReviewQueue(cfg *config.Config) *ReviewQueue {
+	return &ReviewQueue{
+		enabled:    cfg.WriteReviewMode,
+		ttl:        cfg.WriteReviewTTL,
+		maxPending: cfg.WriteReviewMaxPending,
+		writes:     make(map[string]*PendingWrite),
+	}
+}
+
+// Enabled 返回是否开启了审核模式。
+func (q *ReviewQueue) Enabled() bool {
+	return q != nil && q.enabled
+}
+
+// List 返回写入队列的快照，connID 为空时返回全部。按入队时间排序。
+func (q *ReviewQueue) List(connID string) []PendingWrite {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expireLocked(time.Now())
+	result := make([]PendingWrite, 0, len(q.writes))
+	for _, write := range q.writes {
+		if connID != "" && write.ConnID != connID {
+			continue
+		}
+		result = append(result, *write)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// reviewedRetention 是 WRITE_REVIEW_TTL 为 0 时审核记录的保留时长
+const reviewedRetention = 24 * time.Hour
+
+// expireLocked 把超过有效期的待审核写入标记为过期，并移除审核 (或过期) 超过保留时长的记录。调用方必须持有 mu。
+func (q *ReviewQueue) expireLocked(now time.Time) {
+	retention := q.ttl
+	if retention <= 0 {
+		retention = reviewedRetention
+	}
+	for writeID, write := range q.writes {
+		if write.Status == WriteStatusPending && write.ExpiresAt != nil && now.After(*write.ExpiresAt) {
+			write.Status = WriteStatusExpired
+			write.ReviewedAt = &now
+			write.execute = nil
+			utils.DefaultLogger.Info("待审核写入已过期", zap.String("writeID", writeID), zap.String("tool", write.Tool))
+			continue
+		}
+		if write.ReviewedAt != nil && now.Sub(*write.ReviewedAt) > retention {
+			delete(q.writes, writeID)
+		}
+	}
+}
+
+// pendingLocked 返回等待审核的写入数。调用方必须持有 mu。
+func (q *ReviewQueue) pendingLocked() int {
+	count := 0
+	for _, write := range q.writes {
+		if write.Status == WriteStatusPending {
+			count++
+		}
+	}
+	return count
+}
+
+// ensureWritable 确认连接以 read_write 模式注册。
+// 写入工具直接使用连接池开启读写事务，不经过 ExecuteNonQuery 的检查，因此必须在入队或执行前调用。
+func ensureWritable(dbService databases.Service, connID string) error {
+	mode, err := dbService.AccessMode(connID)
+	if err != nil {
+		return err
+	}
+	if mode != databases.AccessModeReadWrite {
+		return fmt.Errorf("%w，请使用 access_mode=read_write 重新 connect (connID: %s)", databases.ErrReadOnlyConnection, connID)
+	}
+	return nil
+}
+
+// runReviewed 在审核模式下将写入操作入队并返回审核 ID；未开启审核模式时使用当前 ctx 直接执行。
+// 批准后写入在审核接口请求的 ctx 中执行。
+func runReviewed(ctx context.Context, q *ReviewQueue, connID, tool, summary string, req *protocol.CallToolRequest,
+	write func(ctx context.Context) (*protocol.CallToolResult, error)) (*protocol.CallToolResult, error) {
+	if !q.Enabled() {
+		return write(ctx)
+	}
+
+	now := time.Now()
+	pending := &PendingWrite{
+		WriteID:   utils.GenerateUUID(),
+		ConnID:    connID,
+		Tool:      tool,
+		Summary:   summary,
+		Arguments: req.Arguments,
+		Status:    WriteStatusPending,
+		CreatedAt: now,
+		execute:   write,
+	}
+	if q.ttl > 0 {
+		expiresAt := now.Add(q.ttl)
+		pending.ExpiresAt = &expiresAt
+	}
+	q.mu.Lock()
+	q.expireLocked(now)
+	if q.maxPending > 0 && q.pendingLocked() >= q.maxPending {
+		q.mu.Unlock()
+		return newErrorResult(fmt.Sprintf("审核队列已满 (%d 条写入等待审核，WRITE_REVIEW_MAX_PENDING)，请等待操作员处理后重试", q.maxPending), nil), nil
+	}
+	q.writes[pending.WriteID] = pending
+	q.mu.Unlock()
+
+	utils.DefaultLogger.Info("写入操作已进入审核队列", zap.String("writeID", pending.WriteID), zap.String("tool", tool), zap.String("connID", connID))
+	return newJSONResult(map[string]any{
+		"success":    true,
+		"status":     WriteStatusPending,
+		"write_id":   pending.WriteID,
+		"expires_at": pending.ExpiresAt,
+		"message":    "审核模式已开启，写入需要操作员通过审核接口批准后才会执行，可以在 pending_writes 资源中查看状态",
+	})
+}
+
+// Review 批准 (reject 为 false) 或拒绝一条待审核写入，批准后在 ctx 中执行并返回写入工具的结果。
+// 写入不存在、已审核或已过期时返回 ErrWriteNotPending。
+func (q *ReviewQueue) Review(ctx context.Context, writeID string, reject bool, note string) (*PendingWrite, *protocol.CallToolResult, error) {
+	// 先在锁内把状态改掉，防止同一写入被并发批准两次
+	q.mu.Lock()
+	now := time.Now()
+	q.expireLocked(now)
+	pending, ok := q.writes[writeID]
+	if !ok || pending.Status != WriteStatusPending {
+		q.mu.Unlock()
+		return nil, nil, fmt.Errorf("%w: '%s'", ErrWriteNotPending, writeID)
+	}
+	pending.ReviewedAt = &now
+	pending.ReviewNote = note
+	execute := pending.execute
+	pending.execute = nil
+	if reject {
+		pending.Status = WriteStatusRejected
+	} else {
+		pending.Status = WriteStatusApproved
+	}
+	snapshot := *pending
+	q.mu.Unlock()
+
+	if reject {
+		utils.DefaultLogger.Info("写入已被拒绝", zap.String("writeID", writeID), zap.String("note", note))
+		return &snapshot, nil, nil
+	}
+
+	utils.DefaultLogger.Warn("写入已批准，开始执行", zap.String("writeID", writeID), zap.String("tool", pending.Tool), zap.String("connID", pending.ConnID))
+	result, err := execute(ctx)
+	if err != nil || (result != nil && result.IsError) {
+		q.mu.Lock()
+		pending.Status = WriteStatusFailed
+		if err != nil {
+			pending.ResultError = err.Error()
+		} else if text, ok := firstText(result); ok {
+			pending.ResultError = text
+		}
+		snapshot = *pending
+		q.mu.Unlock()
+	}
+	return &snapshot, result, err
+}
@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// reviewExecTimeout 是批准后执行写入的超时时间
+const reviewExecTimeout = 5 * time.Minute
+
+// ReviewAPI 是供操作员审核写入的 HTTP 接口，监听独立于 MCP 的地址并使用单独的 token，
+// MCP 客户端 (发起写入的 agent) 的工具列表中没有审核入口。
+//
+//	GET  /writes[?conn_id=...]          列出写入 (包括工具调用参数)
+//	POST /writes/{write_id}/approve     批准并执行，可选请求体 {"note": "..."}
+//	POST /writes/{write_id}/reject      拒绝
+type ReviewAPI struct {
+	queue  *ReviewQueue
+	token  string
+	server *http.Server
+	done   chan struct{}
+}
+
+// NewReviewAPI 根据配置创建审核接口。未开启审核模式或未配置 WRITE_REVIEW_ADDR 时返回 nil；
+// 未配置 WRITE_REVIEW_TOKEN 时拒绝启动 (同样返回 nil)，此时待审核写入只会过期。
+func NewReviewAPI(queue *ReviewQueue, cfg *config.Config) *ReviewAPI {
+	if !queue.Enabled() || cfg.WriteReviewAddr == "" {
+		if queue.Enabled() {
+			utils.DefaultLogger.Warn("写入审核模式已开启但未配置 WRITE_REVIEW_ADDR，待审核写入无法被批准")
+		}
+		return nil
+	}
+	if cfg.WriteReviewToken == "" {
+		utils.DefaultLogger.Error("未配置 WRITE_REVIEW_TOKEN，写入审核接口不会启动", zap.String("address", cfg.WriteReviewAddr))
+		return nil
+	}
+	api := &ReviewAPI{queue: queue, token: cfg.WriteReviewToken}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /writes", api.handleList)
+	mux.HandleFunc("POST /writes/{write_id}/approve", api.handleReview(false))
+	mux.HandleFunc("POST /writes/{write_id}/reject", api.handleReview(true))
+	api.server = &http.Server{Addr: cfg.WriteReviewAddr, Handler: api.authenticate(mux), ReadHeaderTimeout: 10 * time.Second}
+	return api
+}
+
+// Start 在后台开始监听。对 nil ReviewAPI 调用是安全的。
+func (a *ReviewAPI) Start() error {
+	if a == nil {
+		return nil
+	}
+	listener, err := net.Listen("tcp", a.server.Addr)
+	if err != nil {
+		return err
+	}
+	a.done = make(chan struct{})
+	utils.DefaultLogger.Info("写入审核接口已启动", zap.String("address", listener.Addr().String()))
+	go func() {
+		defer close(a.done)
+		if err := a.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			utils.DefaultLogger.Error("写入审核接口异常退出", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Stop 关闭审核接口并等待其退出。对 nil ReviewAPI 调用是安全的。
+func (a *ReviewAPI) Stop(ctx context.Context) {
+	if a == nil || a.done == nil {
+		return
+	}
+	if err := a.server.Shutdown(ctx); err != nil {
+		utils.DefaultLogger.Warn("关闭写入审核接口失败", zap.Error(err))
+	}
+	<-a.done
+}
+
+// authenticate 校验 Authorization: Bearer <WRITE_REVIEW_TOKEN>
+func (a *ReviewAPI) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			utils.DefaultLogger.Warn("写入审核接口认证失败", zap.String("remote", r.RemoteAddr), zap.String("path", r.URL.Path))
+			writeReviewJSON(w, http.StatusUnauthorized, map[string]any{"error": "未授权"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reviewedWrite 是审核接口返回的写入，包含 pending_writes 资源中隐藏的工具调用参数
+type reviewedWrite struct {
+	PendingWrite
+	Arguments map[string]any `json:"arguments"`
+}
+
+func (a *ReviewAPI) handleList(w http.ResponseWriter, r *http.Request) {
+	writes := a.queue.List(r.URL.Query().Get("conn_id"))
+	result := make([]reviewedWrite, 0, len(writes))
+	for _, write := range writes {
+		result = append(result, reviewedWrite{PendingWrite: write, Arguments: write.Arguments})
+	}
+	writeReviewJSON(w, http.StatusOK, map[string]any{"writes": result})
+}
+
+func (a *ReviewAPI) handleReview(reject bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Note string `json:"note"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+				writeReviewJSON(w, http.StatusBadRequest, map[string]any{"error": "请求体格式错误: " + err.Error()})
+				return
+			}
+		}
+		writeID := r.PathValue("write_id")
+		utils.DefaultLogger.Info("操作员审核写入", zap.String("writeID", writeID), zap.Bool("reject", reject), zap.String("remote", r.RemoteAddr))
+
+		ctx, cancel := context.WithTimeout(r.Context(), reviewExecTimeout)
+		defer cancel()
+		write, result, err := a.queue.Review(ctx, writeID, reject, body.Note)
+		switch {
+		case errors.Is(err, ErrWriteNotPending):
+			writeReviewJSON(w, http.StatusConflict, map[string]any{"error": err.Error()})
+			return
+		case err != nil:
+			writeReviewJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error(), "write": write})
+			return
+		}
+		response := map[string]any{"write": write}
+		if result != nil {
+			if text, ok := firstText(result); ok && json.Valid([]byte(text)) {
+				response["result"] = json.RawMessage(text)
+			} else if ok {
+				response["result"] = text
+			}
+		}
+		writeReviewJSON(w, http.StatusOK, response)
+	}
+}
+
+// writeReviewJSON 写出 JSON 响应
+func writeReviewJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		utils.DefaultLogger.Warn("写出审核接口响应失败", zap.Error(err))
+	}
+}
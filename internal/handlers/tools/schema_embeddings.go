@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/retrieval"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// schemaEmbeddingsTable 是导出嵌入索引的目标表，每次导出都会替换为最新的快照
+const schemaEmbeddingsTable = `"temp"."mcp_schema_embeddings"`
+
+// LoadSchemaEmbeddingsToolArgs 是 'load_schema_embeddings' 工具的输入参数。
+type LoadSchemaEmbeddingsToolArgs struct {
+	ConnID string `json:"conn_id" description:"目标数据库的连接 ID，嵌入索引会写入该库的 temp.mcp_schema_embeddings 表"`
+}
+
+// SchemaEmbeddingsHandler 处理将 Schema 嵌入索引导出到 temp schema 的工具调用。
+type SchemaEmbeddingsHandler struct {
+	dbService   databases.Service
+	ranker      *retrieval.Ranker
+	reviewQueue *ReviewQueue // 审核模式下暂存写入，等待人工批准
+}
+
+// NewSchemaEmbeddingsHandler 创建一个新的 SchemaEmbeddingsHandler。
+func NewSchemaEmbeddingsHandler(dbService databases.Service, ranker *retrieval.Ranker, reviewQueue *ReviewQueue) *SchemaEmbeddingsHandler {
+	return &SchemaEmbeddingsHandler{dbService: dbService, ranker: ranker, reviewQueue: reviewQueue}
+}
+
+// HandleLoadSchemaEmbeddings 处理 'load_schema_embeddings' 工具的调用请求。
+func (h *SchemaEmbeddingsHandler) HandleLoadSchemaEmbeddings(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(LoadSchemaEmbeddingsToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 参数")
+	}
+	if h.ranker.Index() == nil {
+		return nil, fmt.Errorf("未启用嵌入索引 (SCHEMA_RETRIEVAL_EMBEDDINGS=off)")
+	}
+
+	if err := ensureWritable(h.dbService, args.ConnID); err != nil {
+		return newErrorResult("写入被拒绝", err), nil
+	}
+
+	summary := "将表、列和扩展知识的嵌入索引导入 temp.mcp_schema_embeddings (替换已有内容)"
+	return runReviewed(ctx, h.reviewQueue, args.ConnID, "load_schema_embeddings", summary, req, func(ctx context.Context) (*protocol.CallToolResult, error) {
+		return h.loadSchemaEmbeddings(ctx, args)
+	})
+}
+
+// loadSchemaEmbeddings 在一个事务中重建 temp.mcp_schema_embeddings 并写入索引快照。
+// 目标库安装了 pgvector 时向量列使用 vector 类型 (可直接用 <=> 做相似度查询)，否则使用 real[]。
+func (h *SchemaEmbeddingsHandler) loadSchemaEmbeddings(ctx context.Context, args *LoadSchemaEmbeddingsToolArgs) (*protocol.CallToolResult, error) {
+	if err := h.ranker.EnsureIndex(ctx); err != nil {
+		return nil, err
+	}
+	entries := h.ranker.Index().Entries()
+	entriesJSON, err := json.Marshal(entries)
+	if err != nil {
+		return nil, fmt.Errorf("序列化嵌入索引失败: %w", err)
+	}
+
+	pgvector, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'vector') AS installed`)
+	if err != nil {
+		return newErrorResult("检查 pgvector 扩展失败", err), nil
+	}
+	hasPGVector := len(pgvector) > 0 && pgvector[0]["installed"] == true
+	vectorType := "real[]"
+	if hasPGVector {
+		vectorType = "vector"
+	}
+
+	statements := []string{
+		`DROP TABLE IF EXISTS ` + schemaEmbeddingsTable,
+		`CREATE TABLE ` + schemaEmbeddingsTable + ` (
+            kind      text NOT NULL,
+            id        text NOT NULL,
+            embedder  text NOT NULL,
+            embedding ` + vectorType + ` NOT NULL,
+            PRIMARY KEY (kind, id)
+        )`,
+	}
+	// real[] 和 vector 都可以从 JSON 数组的文本形式 ('[0.1,0.2]' 转换为 '{0.1,0.2}') 转换
+	embeddingExpr := `translate(r.vector::text, '[]', '{}')::real[]`
+	if hasPGVector {
+		embeddingExpr = `r.vector::text::vector`
+	}
+	insertSQL := `INSERT INTO ` + schemaEmbeddingsTable + `
+        SELECT r.kind, r.id, $2, ` + embeddingExpr + `
+        FROM jsonb_to_recordset($1::jsonb) AS r(kind text, id text, vector jsonb)`
+	var failure *protocol.CallToolResult
+	err = h.dbService.WriteTx(ctx, args.ConnID, append(statements, insertSQL), func(tx pgx.Tx) error {
+		for _, statement := range statements {
+			if _, err := tx.Exec(ctx, statement); err != nil {
+				utils.DefaultLogger.Error("创建嵌入索引表失败", zap.String("connID", args.ConnID), zap.Error(err))
+				failure = newErrorResult("创建嵌入索引表失败", err)
+				return err
+			}
+		}
+		if _, err := tx.Exec(ctx, insertSQL, string(entriesJSON), h.ranker.EmbedderName()); err != nil {
+			utils.DefaultLogger.Error("写入嵌入索引失败", zap.String("connID", args.ConnID), zap.Error(err))
+			failure = newErrorResult("写入嵌入索引失败", err)
+			return err
+		}
+		return nil
+	})
+	switch {
+	case failure != nil:
+		return failure, nil
+	case errors.Is(err, sqlguard.ErrDenied):
+		return newErrorResult("写入被访问策略拒绝", err), nil
+	case err != nil:
+		return newErrorResult("导入嵌入索引失败", err), nil
+	}
+
+	utils.DefaultLogger.Info("嵌入索引已导入 temp schema", zap.String("connID", args.ConnID), zap.Int("rowCount", len(entries)), zap.Bool("pgvector", hasPGVector))
+	return newJSONResult(map[string]any{
+		"success":        true,
+		"table_name":     "temp.mcp_schema_embeddings",
+		"rows_saved":     len(entries),
+		"embedder":       h.ranker.EmbedderName(),
+		"embedding_type": vectorType,
+		"columns":        []string{"kind", "id", "embedder", "embedding"},
+	})
+}
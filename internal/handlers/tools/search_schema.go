@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/retrieval"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	maxSearchSchemaLimit = 200  // 返回结果数上限
+	semanticScoreScale   = 10.0 // 嵌入相似度 (0-1) 换算为搜索得分的倍数，与名称完全匹配的得分一致
+	defaultSemanticLimit = 20   // semantic 搜索的默认结果数 (与关键字搜索一致)
+)
+
+// SearchSchemaToolArgs 是 'search_schema' 工具的输入参数。
+type SearchSchemaToolArgs struct {
+	Keyword  string   `json:"keyword" description:"搜索关键字，多个词用空格分隔 (任一词匹配即可，匹配越多得分越高)"`
+	Schema   string   `json:"schema,omitempty" description:"(可选) 只在该 Schema 中搜索"`
+	Kinds    []string `json:"kinds,omitempty" description:"(可选) 只返回这些种类: table, column, function, type"`
+	Limit    int      `json:"limit,omitempty" description:"(可选) 返回结果数，默认 20，最大 200"`
+	Semantic bool     `json:"semantic,omitempty" description:"(可选) 为 true 时同时按嵌入相似度匹配表和列 (可匹配同义或拼写不同的名称)，需要启用嵌入索引"`
+}
+
+// SearchSchemaHandler 处理 Schema 元数据搜索的工具调用。
+type SearchSchemaHandler struct {
+	schemaManager schemas.Manager
+	ranker        *retrieval.Ranker // 提供 semantic 搜索使用的嵌入索引
+}
+
+// NewSearchSchemaHandler 创建一个新的 SearchSchemaHandler。
+func NewSearchSchemaHandler(schemaManager schemas.Manager, ranker *retrieval.Ranker) *SearchSchemaHandler {
+	return &SearchSchemaHandler{schemaManager: schemaManager, ranker: ranker}
+}
+
+// HandleSearchSchema 处理 'search_schema' 工具的调用请求。
+func (h *SearchSchemaHandler) HandleSearchSchema(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(SearchSchemaToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.Keyword == "" {
+		return nil, fmt.Errorf("缺少 'keyword' 参数")
+	}
+	if args.Limit > maxSearchSchemaLimit {
+		args.Limit = maxSearchSchemaLimit
+	}
+
+	options := schemas.SearchOptions{
+		Schema: args.Schema,
+		Kinds:  args.Kinds,
+		Limit:  args.Limit,
+	}
+	if args.Semantic {
+		// 先取回更多关键字结果，与嵌入匹配合并后再截断
+		options.Limit = maxSearchSchemaLimit
+	}
+	results := h.schemaManager.SearchSchema(args.Keyword, options)
+	if args.Semantic {
+		var err error
+		if results, err = h.mergeSemantic(ctx, args, results); err != nil {
+			return nil, err
+		}
+	}
+	utils.DefaultLogger.Info("Schema 搜索完成", zap.String("keyword", args.Keyword), zap.Int("count", len(results)))
+	return newJSONResult(results)
+}
+
+// mergeSemantic 把嵌入索引中与关键字相似的表和列合并到关键字搜索结果中，
+// 同时被两种方式匹配的对象得分相加。
+func (h *SearchSchemaHandler) mergeSemantic(ctx context.Context, args *SearchSchemaToolArgs, results []schemas.SearchResult) ([]schemas.SearchResult, error) {
+	if h.ranker.Index() == nil {
+		return nil, fmt.Errorf("未启用嵌入索引 (SCHEMA_RETRIEVAL_EMBEDDINGS=off)，无法使用 semantic 搜索")
+	}
+	kinds := []string{}
+	for _, kind := range args.Kinds {
+		if kind := strings.ToLower(kind); kind == schemas.SearchKindTable || kind == schemas.SearchKindColumn {
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(args.Kinds) > 0 && len(kinds) == 0 {
+		return results, nil // 只搜索函数或类型，嵌入索引中没有这些对象
+	}
+	if len(kinds) == 0 {
+		kinds = []string{retrieval.DocumentTable, retrieval.DocumentColumn}
+	}
+	if err := h.ranker.EnsureIndex(ctx); err != nil {
+		return nil, err
+	}
+	matches, err := h.ranker.Index().Search(ctx, args.Keyword, kinds, maxSearchSchemaLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	byLocation := make(map[string]int, len(results))
+	for i, result := range results {
+		byLocation[result.Location] = i
+	}
+	for _, match := range matches {
+		score := match.Score * semanticScoreScale
+		if i, ok := byLocation[match.ID]; ok {
+			results[i].Score += score
+			continue
+		}
+		parts := strings.SplitN(match.ID, ".", 3)
+		result := schemas.SearchResult{Kind: match.Kind, Schema: parts[0], Location: match.ID, Score: score}
+		if match.Kind == retrieval.DocumentColumn && len(parts) == 3 {
+			result.Table, result.Name = parts[1], parts[2]
+		} else if len(parts) >= 2 {
+			result.Name = strings.Join(parts[1:], ".")
+		}
+		if args.Schema != "" && result.Schema != args.Schema {
+			continue
+		}
+		byLocation[match.ID] = len(results)
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultSemanticLimit
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
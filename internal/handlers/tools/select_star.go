@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+)
+
+// DefaultLargeColumnTypes 是 SELECT_STAR_EXCLUDE_TYPES 未设置时，SELECT * 改写省略的列类型
+var DefaultLargeColumnTypes = []string{"bytea", "vector", "halfvec", "sparsevec", "raster"}
+
+// 顶层 SELECT * FROM [schema.]table [[AS] alias] 后接子句关键字或结尾 (在 maskSQL 的结果上匹配)
+var selectStarPattern = regexp.MustCompile(`(?i)^\s*select\s+(\*)\s+from\s+((?:"[^"]+"|[a-z_][a-z0-9_$]*)(?:\s*\.\s*(?:"[^"]+"|[a-z_][a-z0-9_$]*))?)(?:\s+(?:as\s+)?[a-z_][a-z0-9_$]*)?\s*(?:\bwhere\b|\bgroup\b|\bhaving\b|\bwindow\b|\border\b|\blimit\b|\boffset\b|\bfetch\b|\bfor\b|$)`)
+
+// ExpandSelectStar 把针对单张缓存表的顶层 SELECT * 改写为显式列列表，省略类型属于 excludeTypes 的大字段列
+// (excludeTypes 为空时使用 DefaultLargeColumnTypes)，避免无意中读取整列二进制或向量数据撑大响应。
+// 返回执行的查询和被省略的列；无法确定表、没有需要省略的列或全部列都会被省略时返回原查询。
+func ExpandSelectStar(query string, schemaManager schemas.Manager, excludeTypes []string) (string, []string) {
+	if len(excludeTypes) == 0 {
+		excludeTypes = DefaultLargeColumnTypes
+	}
+	trimmed := strings.TrimRight(strings.TrimSpace(query), "; \t\r\n")
+	masked := maskSQL(trimmed)
+	if setOperatorPattern.MatchString(masked) || joinPattern.MatchString(masked) {
+		return query, nil
+	}
+	match := selectStarPattern.FindStringSubmatchIndex(masked)
+	if match == nil {
+		return query, nil
+	}
+	table := lookupCachedTable(schemaManager, trimmed[match[4]:match[5]])
+	if table == nil {
+		return query, nil
+	}
+
+	var kept, omitted []string
+	for _, col := range table.Columns {
+		if isLargeColumnType(col.Type, excludeTypes) {
+			omitted = append(omitted, col.Name)
+		} else {
+			quoted, err := sqlsafe.QuoteIdentifier(col.Name)
+			if err != nil {
+				return query, nil // 无法安全引用的列名，不改写
+			}
+			kept = append(kept, quoted)
+		}
+	}
+	if len(omitted) == 0 || len(kept) == 0 {
+		return query, nil
+	}
+	return trimmed[:match[2]] + strings.Join(kept, ", ") + trimmed[match[3]:], omitted
+}
+
+// isLargeColumnType 判断列类型 (format_type 的结果，例如 vector(1536)、public.raster、bytea[]) 的基础类型是否属于 types
+func isLargeColumnType(columnType string, types []string) bool {
+	base := strings.ToLower(strings.TrimSpace(columnType))
+	if i := strings.IndexAny(base, "(["); i >= 0 {
+		base = strings.TrimSpace(base[:i])
+	}
+	if i := strings.LastIndexByte(base, '.'); i >= 0 {
+		base = base[i+1:]
+	}
+	base = strings.Trim(base, `"`)
+	for _, t := range types {
+		if strings.EqualFold(base, strings.TrimSpace(t)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/shards"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// RegisterShardGroupTool 是 'register_shard_group' 工具的定义。
+var RegisterShardGroupTool = &protocol.Tool{
+	Name:        "register_shard_group",
+	Description: "将多个已注册的连接登记为一个逻辑分片组 (按路由键划分数据)，之后 cross_db_query 可以按组扇出查询或路由到单个分片",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"name":        {Type: protocol.String, Description: "分片组名称，重复注册会替换已有的组"},
+			"conn_ids":    {Type: protocol.Array, Description: "各分片的连接 ID，顺序即分片编号 (从 0 开始)", Items: &protocol.Property{Type: protocol.String}},
+			"routing_key": {Type: protocol.String, Description: "决定数据所在分片的 SQL 表达式，例如 tenant_id"},
+			"strategy":    {Type: protocol.String, Description: "(可选) 路由策略: hash (默认, 对路由键文本做 FNV-1a 哈希取模) 或 modulo (整数路由键直接取模)"},
+		},
+		Required: []string{"name", "conn_ids", "routing_key"},
+	},
+}
+
+// RouteShardTool 是 'route_shard' 工具的定义。
+var RouteShardTool = &protocol.Tool{
+	Name:        "route_shard",
+	Description: "返回路由键取值所在分片的连接 ID，可直接用于 pg_query 等单连接工具；不带参数时列出所有分片组",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"shard_group":       {Type: protocol.String, Description: "(可选) 分片组名称，为空时列出所有分片组"},
+			"routing_key_value": {Type: protocol.String, Description: "(可选) 路由键的取值 (Schema 定义为 string，但接受数字)"},
+		},
+	},
+}
+
+// RegisterShardGroupToolArgs 是 'register_shard_group' 工具的输入参数。
+type RegisterShardGroupToolArgs struct {
+	Name       string   `json:"name"`
+	ConnIDs    []string `json:"conn_ids"`
+	RoutingKey string   `json:"routing_key"`
+	Strategy   string   `json:"strategy,omitempty"`
+}
+
+// RouteShardToolArgs 是 'route_shard' 工具的输入参数。
+type RouteShardToolArgs struct {
+	ShardGroup      string `json:"shard_group,omitempty"`
+	RoutingKeyValue any    `json:"routing_key_value,omitempty"`
+}
+
+// ShardHandler 处理分片组相关的工具调用。
+type ShardHandler struct {
+	dbService databases.Service
+	registry  *shards.Registry
+}
+
+// NewShardHandler 创建一个新的 ShardHandler。
+func NewShardHandler(dbService databases.Service, registry *shards.Registry) *ShardHandler {
+	return &ShardHandler{dbService: dbService, registry: registry}
+}
+
+// HandleRegisterShardGroup 处理 'register_shard_group' 工具的调用请求。
+// 组内的每个连接必须已经通过 connect 注册。
+func (h *ShardHandler) HandleRegisterShardGroup(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(RegisterShardGroupToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if len(args.ConnIDs) > maxCrossDBConnections {
+		return nil, fmt.Errorf("分片组最多包含 %d 个连接，实际为 %d 个", maxCrossDBConnections, len(args.ConnIDs))
+	}
+	for _, connID := range args.ConnIDs {
+		if _, err := h.dbService.GetPool(ctx, connID); err != nil {
+			return newErrorResult(fmt.Sprintf("连接 '%s' 不可用", connID), err), nil
+		}
+	}
+	group, err := h.registry.Register(shards.Group{
+		Name:       args.Name,
+		ConnIDs:    args.ConnIDs,
+		RoutingKey: args.RoutingKey,
+		Strategy:   args.Strategy,
+	})
+	if err != nil {
+		return newErrorResult("注册分片组失败", err), nil
+	}
+	utils.DefaultLogger.Info("分片组已注册", zap.String("group", group.Name), zap.Int("shards", len(group.ConnIDs)), zap.String("strategy", group.Strategy))
+	return newJSONResult(map[string]any{"success": true, "group": group})
+}
+
+// HandleRouteShard 处理 'route_shard' 工具的调用请求。
+func (h *ShardHandler) HandleRouteShard(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(RouteShardToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ShardGroup == "" {
+		return newJSONResult(map[string]any{"groups": h.registry.List()})
+	}
+	group, err := h.registry.Get(args.ShardGroup)
+	if err != nil {
+		return newErrorResult("查找分片组失败", err), nil
+	}
+	if args.RoutingKeyValue == nil {
+		return newJSONResult(map[string]any{"group": group})
+	}
+	connID, err := group.Route(args.RoutingKeyValue)
+	if err != nil {
+		return newErrorResult("路由失败", err), nil
+	}
+	return newJSONResult(map[string]any{
+		"shard_group": group.Name,
+		"routing_key": group.RoutingKey,
+		"conn_id":     connID,
+	})
+}
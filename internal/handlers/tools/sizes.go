@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+)
+
+const (
+	defaultSizeReportLimit = 50
+	maxSizeReportLimit     = 500
+)
+
+// sizeReportSchemaFilter 排除系统 Schema，schema 参数为空时匹配所有用户 Schema
+const sizeReportSchemaFilter = `n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%' AND n.nspname NOT LIKE 'pg_temp%' AND ($1::text = '' OR n.nspname = $1::text)`
+
+// SizeReport 返回数据库总大小、按总大小排序的表和索引，以及表膨胀估算。
+// schema 为空时包含所有用户 Schema，limit 限制每个列表的条数。
+func SizeReport(ctx context.Context, dbService databases.Service, connID, schema string, limit int) (map[string]any, error) {
+	if limit <= 0 {
+		limit = defaultSizeReportLimit
+	}
+	if limit > maxSizeReportLimit {
+		limit = maxSizeReportLimit
+	}
+
+	database, err := dbService.ExecuteQuery(ctx, connID, true,
+		`SELECT current_database() AS database, pg_database_size(current_database()) AS total_bytes, pg_size_pretty(pg_database_size(current_database())) AS total_size`)
+	if err != nil {
+		return nil, fmt.Errorf("查询数据库大小失败: %w", err)
+	}
+
+	tablesQuery := `
+        SELECT n.nspname AS schema, c.relname AS table, c.relkind::text AS kind,
+               c.reltuples::bigint AS estimated_rows,
+               pg_total_relation_size(c.oid) AS total_bytes,
+               pg_relation_size(c.oid) AS table_bytes,
+               pg_indexes_size(c.oid) AS index_bytes,
+               coalesce(pg_total_relation_size(nullif(c.reltoastrelid, 0)), 0) AS toast_bytes,
+               pg_size_pretty(pg_total_relation_size(c.oid)) AS total_size
+        FROM pg_class c
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        WHERE c.relkind IN ('r', 'm', 'p') AND ` + sizeReportSchemaFilter + `
+        ORDER BY total_bytes DESC
+        LIMIT $2`
+	tables, err := dbService.ExecuteQuery(ctx, connID, true, tablesQuery, schema, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询表大小失败: %w", err)
+	}
+
+	indexesQuery := `
+        SELECT n.nspname AS schema, t.relname AS table, c.relname AS index,
+               pg_relation_size(c.oid) AS index_bytes,
+               pg_size_pretty(pg_relation_size(c.oid)) AS index_size,
+               coalesce(s.idx_scan, 0) AS index_scans,
+               i.indisunique AS is_unique, i.indisprimary AS is_primary
+        FROM pg_index i
+        JOIN pg_class c ON c.oid = i.indexrelid
+        JOIN pg_class t ON t.oid = i.indrelid
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        LEFT JOIN pg_stat_user_indexes s ON s.indexrelid = i.indexrelid
+        WHERE ` + sizeReportSchemaFilter + `
+        ORDER BY index_bytes DESC
+        LIMIT $2`
+	indexes, err := dbService.ExecuteQuery(ctx, connID, true, indexesQuery, schema, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询索引大小失败: %w", err)
+	}
+
+	// 根据 pg_stats 中的平均列宽估算紧凑存储所需的页数，与实际页数的差值作为膨胀估算。
+	// 每行额外计算 24 字节元组头和 4 字节行指针，每页扣除 24 字节页头，并考虑 fillfactor。
+	bloatQuery := `
+        WITH widths AS (
+            SELECT schemaname, tablename, sum((1 - null_frac) * avg_width) AS row_width
+            FROM pg_stats
+            WHERE NOT inherited
+            GROUP BY schemaname, tablename
+        ), estimates AS (
+            SELECT n.nspname AS schema, c.relname AS table,
+                   c.reltuples::bigint AS estimated_rows,
+                   pg_relation_size(c.oid) AS table_bytes,
+                   (ceil(c.reltuples * (w.row_width + 28)
+                         / (current_setting('block_size')::numeric
+                            * coalesce((SELECT substring(opt FROM 'fillfactor=(\d+)')::int FROM unnest(c.reloptions) AS opt WHERE opt LIKE 'fillfactor=%'), 100) / 100
+                            - 24))
+                    * current_setting('block_size')::numeric)::bigint AS expected_bytes,
+                   coalesce(s.n_dead_tup, 0) AS dead_tuples,
+                   s.last_vacuum, s.last_autovacuum
+            FROM pg_class c
+            JOIN pg_namespace n ON n.oid = c.relnamespace
+            JOIN widths w ON w.schemaname = n.nspname AND w.tablename = c.relname
+            LEFT JOIN pg_stat_user_tables s ON s.relid = c.oid
+            WHERE c.relkind IN ('r', 'm') AND c.reltuples > 0 AND ` + sizeReportSchemaFilter + `
+        )
+        SELECT schema, "table", estimated_rows, table_bytes, expected_bytes,
+               greatest(table_bytes - expected_bytes, 0) AS bloat_bytes,
+               pg_size_pretty(greatest(table_bytes - expected_bytes, 0)) AS bloat_size,
+               round(100 * greatest(table_bytes - expected_bytes, 0)::numeric / nullif(table_bytes, 0), 1) AS bloat_percent,
+               dead_tuples, last_vacuum, last_autovacuum
+        FROM estimates
+        ORDER BY bloat_bytes DESC
+        LIMIT $2`
+	bloat, err := dbService.ExecuteQuery(ctx, connID, true, bloatQuery, schema, limit)
+	if err != nil {
+		return nil, fmt.Errorf("估算表膨胀失败: %w", err)
+	}
+
+	report := map[string]any{
+		"tables":      nonNilRows(tables),
+		"indexes":     nonNilRows(indexes),
+		"table_bloat": nonNilRows(bloat),
+		"note":        "膨胀为基于 pg_stats 平均列宽的估算值，未 ANALYZE 的表不会出现在 table_bloat 中；小表的估算误差较大",
+	}
+	if len(database) > 0 {
+		report["database"] = database[0]
+	}
+	return report, nil
+}
+
+// nonNilRows 将 nil 结果替换为空切片，使 JSON 输出为 [] 而不是 null
+func nonNilRows(rows []map[string]any) []map[string]any {
+	if rows == nil {
+		return []map[string]any{}
+	}
+	return rows
+}
@@ -0,0 +1,284 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/buildinfo"
+	"github.com/cbc3929/pg_mcp_server/internal/core/backup"
+	"github.com/cbc3929/pg_mcp_server/internal/core/credentials"
+	"github.com/cbc3929/pg_mcp_server/internal/core/plans"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// 状态归档中的分区
+const (
+	stateSectionCredentials    = "credentials"     // 命名凭据 (CREDENTIALS_FILE 中的条目，不含密码)
+	stateSectionPlanHistory    = "plan_history"    // 执行计划历史和回归记录
+	stateSectionSchemaSnapshot = "schema_snapshot" // Schema 缓存快照
+)
+
+// stateSectionFiles 是各分区在归档中的文件名，新增可迁移的状态时在这里登记
+var stateSectionFiles = map[string]string{
+	stateSectionCredentials:    "credentials.yaml",
+	stateSectionPlanHistory:    "plan_history.json",
+	stateSectionSchemaSnapshot: "schema_snapshot.json",
+}
+
+// ExportStateToolArgs 是 'export_state' 工具的输入参数。
+type ExportStateToolArgs struct {
+	Sections []string `json:"sections,omitempty" description:"(可选) 要导出的分区: credentials, plan_history, schema_snapshot，默认全部导出"`
+	FileName string   `json:"file_name,omitempty" description:"(可选) 归档文件名 (STATE_BACKUP_DIR 下)，默认 pgmcp-state-<时间>.tar.gz"`
+}
+
+// ImportStateToolArgs 是 'import_state' 工具的输入参数。
+type ImportStateToolArgs struct {
+	FileName  string   `json:"file_name" description:"STATE_BACKUP_DIR 下的归档文件名 (export_state 返回的 file_name)"`
+	Sections  []string `json:"sections,omitempty" description:"(可选) 要导入的分区，默认导入归档中的全部分区"`
+	Overwrite bool     `json:"overwrite,omitempty" description:"(可选) 是否覆盖同名的命名凭据，默认跳过已存在的条目"`
+	ConnID    string   `json:"conn_id,omitempty" description:"(可选) 恢复 Schema 快照后记录的来源连接 ID (新主机上对应同一数据库的连接)，默认使用快照中的连接 ID"`
+}
+
+// schemaSnapshot 是归档中 Schema 快照分区的内容
+type schemaSnapshot struct {
+	ConnID   string                `json:"conn_id"`
+	LoadedAt time.Time             `json:"loaded_at"`
+	Database *schemas.DatabaseInfo `json:"database"`
+}
+
+// StateHandler 处理服务器状态的导出和导入。
+// 可迁移的状态目前包括命名凭据、执行计划历史和 Schema 缓存快照；连接池、会话和审核队列等运行时状态不导出。
+type StateHandler struct {
+	dir           string
+	resolver      *credentials.Resolver
+	planStore     *plans.Store
+	schemaManager schemas.Manager
+}
+
+// NewStateHandler 创建一个新的 StateHandler，归档读写限制在 dir 目录下。
+func NewStateHandler(dir string, resolver *credentials.Resolver, planStore *plans.Store, schemaManager schemas.Manager) *StateHandler {
+	return &StateHandler{dir: dir, resolver: resolver, planStore: planStore, schemaManager: schemaManager}
+}
+
+// HandleExportState 处理 'export_state' 工具的调用请求。
+func (h *StateHandler) HandleExportState(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(ExportStateToolArgs)
+	if len(req.RawArguments) > 0 {
+		if err := json.Unmarshal(req.RawArguments, args); err != nil {
+			return nil, fmt.Errorf("参数解析错误: %w", err)
+		}
+	}
+	sections, err := selectStateSections(args.Sections, nil)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	fileName := args.FileName
+	if fileName == "" {
+		fileName = "pgmcp-state-" + now.Format("20060102-150405") + ".tar.gz"
+	}
+	path, err := h.resolvePath(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := backup.Manifest{CreatedAt: now, ServerVersion: buildinfo.Get().Version}
+	files := make(map[string][]byte)
+	for _, section := range sections {
+		data, notes, err := h.exportSection(section)
+		if err != nil {
+			return newErrorResult(fmt.Sprintf("导出分区 '%s' 失败", section), err), nil
+		}
+		manifest.Notes = append(manifest.Notes, notes...)
+		if data != nil {
+			files[stateSectionFiles[section]] = data
+		}
+	}
+	if err := backup.Write(path, manifest, files); err != nil {
+		return newErrorResult("写入状态归档失败", err), nil
+	}
+
+	exported := make([]string, 0, len(files))
+	for _, section := range sections {
+		if _, ok := files[stateSectionFiles[section]]; ok {
+			exported = append(exported, section)
+		}
+	}
+	utils.DefaultLogger.Info("服务器状态已导出", zap.String("path", path), zap.Strings("sections", exported))
+	return newJSONResult(map[string]any{
+		"file_name": filepath.Base(path),
+		"path":      path,
+		"sections":  exported,
+		"notes":     manifest.Notes,
+	})
+}
+
+// exportSection 序列化一个分区，没有可导出的内容时返回 nil
+func (h *StateHandler) exportSection(section string) ([]byte, []string, error) {
+	switch section {
+	case stateSectionCredentials:
+		entries, stripped, err := h.resolver.ExportEntries()
+		if err != nil {
+			return nil, nil, err
+		}
+		var notes []string
+		if len(stripped) > 0 {
+			notes = append(notes, fmt.Sprintf("以下命名凭据的密码或 SSH 口令已移除，导入后需在新主机上补充 (建议改用 password_env/password_file): %s", strings.Join(stripped, ", ")))
+		}
+		// 来自环境变量和 Secret 目录的凭据本身就是 Secret，不导出，只提示名称
+		infos, err := h.resolver.List()
+		if err != nil {
+			return nil, nil, err
+		}
+		var external []string
+		for _, info := range infos {
+			if info.Source == "env" || info.Source == "secret_dir" {
+				external = append(external, info.Name+" ("+info.Source+")")
+			}
+		}
+		if len(external) > 0 {
+			notes = append(notes, fmt.Sprintf("以下命名凭据来自环境变量或 Secret 目录，未导出，需在新主机上重新配置: %s", strings.Join(external, ", ")))
+		}
+		if len(entries) == 0 {
+			return nil, notes, nil
+		}
+		data, err := yaml.Marshal(entries)
+		return data, notes, err
+	case stateSectionPlanHistory:
+		data, err := h.planStore.Export()
+		return data, nil, err
+	case stateSectionSchemaSnapshot:
+		info, ok := h.schemaManager.GetDatabaseInfo()
+		cacheInfo := h.schemaManager.CacheInfo()
+		if !ok || cacheInfo.LoadedAt == nil {
+			return nil, []string{"Schema 缓存尚未加载，未导出 Schema 快照"}, nil
+		}
+		data, err := json.Marshal(schemaSnapshot{ConnID: cacheInfo.ConnID, LoadedAt: *cacheInfo.LoadedAt, Database: info})
+		return data, nil, err
+	}
+	return nil, nil, fmt.Errorf("未知的分区 '%s'", section)
+}
+
+// HandleImportState 处理 'import_state' 工具的调用请求。
+// 命名凭据写入 CREDENTIALS_FILE，执行计划历史与现有记录合并，Schema 快照替换当前缓存。
+func (h *StateHandler) HandleImportState(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(ImportStateToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.FileName == "" {
+		return nil, fmt.Errorf("缺少必需参数 'file_name'")
+	}
+	path, err := h.resolvePath(args.FileName)
+	if err != nil {
+		return nil, err
+	}
+	manifest, files, err := backup.Read(path)
+	if err != nil {
+		return newErrorResult("读取状态归档失败", err), nil
+	}
+	available := []string{}
+	for section, fileName := range stateSectionFiles {
+		if _, ok := files[fileName]; ok {
+			available = append(available, section)
+		}
+	}
+	sections, err := selectStateSections(args.Sections, available)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]any, len(sections))
+	for _, section := range sections {
+		data := files[stateSectionFiles[section]]
+		switch section {
+		case stateSectionCredentials:
+			entries := make(map[string]credentials.Entry)
+			if err := yaml.Unmarshal(data, &entries); err != nil {
+				return newErrorResult("解析归档中的命名凭据失败", err), nil
+			}
+			written, skipped, err := h.resolver.ImportEntries(entries, args.Overwrite)
+			if err != nil {
+				return newErrorResult("导入命名凭据失败", err), nil
+			}
+			results[section] = map[string]any{"written": written, "skipped": skipped}
+		case stateSectionPlanHistory:
+			added, err := h.planStore.Import(data)
+			if err != nil {
+				return newErrorResult("导入执行计划历史失败", err), nil
+			}
+			results[section] = map[string]any{"added_snapshots": added}
+		case stateSectionSchemaSnapshot:
+			snapshot := new(schemaSnapshot)
+			if err := json.Unmarshal(data, snapshot); err != nil || snapshot.Database == nil {
+				return newErrorResult("解析归档中的 Schema 快照失败", err), nil
+			}
+			connID := args.ConnID
+			if connID == "" {
+				connID = snapshot.ConnID
+			}
+			h.schemaManager.RestoreSnapshot(connID, snapshot.Database, snapshot.LoadedAt)
+			results[section] = h.schemaManager.CacheInfo()
+		}
+	}
+	utils.DefaultLogger.Info("服务器状态已导入", zap.String("path", path), zap.Strings("sections", sections), zap.Time("createdAt", manifest.CreatedAt))
+	return newJSONResult(map[string]any{
+		"manifest": manifest,
+		"imported": results,
+	})
+}
+
+// resolvePath 返回 STATE_BACKUP_DIR 下的归档路径，拒绝目录之外的路径
+func (h *StateHandler) resolvePath(fileName string) (string, error) {
+	baseDir, err := filepath.Abs(h.dir)
+	if err != nil {
+		return "", err
+	}
+	fullPath, err := filepath.Abs(filepath.Join(baseDir, fileName))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(baseDir, fullPath); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("'file_name' 必须位于 STATE_BACKUP_DIR 目录下")
+	}
+	if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+		return "", fmt.Errorf("'%s' 是目录", fileName)
+	}
+	return fullPath, nil
+}
+
+// selectStateSections 校验请求的分区；未指定时返回 available (为 nil 时表示全部分区)，按固定顺序排列
+func selectStateSections(requested, available []string) ([]string, error) {
+	order := []string{stateSectionCredentials, stateSectionPlanHistory, stateSectionSchemaSnapshot}
+	if available == nil {
+		available = order
+	}
+	for _, section := range requested {
+		if _, ok := stateSectionFiles[section]; !ok {
+			return nil, fmt.Errorf("未知的分区 '%s' (可选: %s)", section, strings.Join(order, ", "))
+		}
+		if !slices.Contains(available, section) {
+			return nil, fmt.Errorf("归档中不包含分区 '%s'", section)
+		}
+	}
+	if len(requested) == 0 {
+		requested = available
+	}
+	var sections []string
+	for _, section := range order {
+		if slices.Contains(requested, section) {
+			sections = append(sections, section)
+		}
+	}
+	return sections, nil
+}
@@ -0,0 +1,170 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/charts"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// maxChartRows 是生成图表时使用的最大行数，超出部分截断 (规格中内联了数据，过多的行会使响应过大)
+const maxChartRows = 5000
+
+// SuggestChartToolArgs 是 'suggest_chart' 工具的输入参数。
+type SuggestChartToolArgs struct {
+	ConnID    string           `json:"conn_id,omitempty"`
+	Query     string           `json:"query,omitempty"`
+	Params    []any            `json:"params,omitempty"`
+	Rows      []map[string]any `json:"rows,omitempty"`    // 直接传入的结果行 (与 query 二选一)
+	Columns   []string         `json:"columns,omitempty"` // rows 的列顺序
+	Format    string           `json:"format,omitempty"`  // vega-lite, chartjs 或 both
+	ChartType string           `json:"chart_type,omitempty"`
+	X         string           `json:"x,omitempty"`
+	Y         string           `json:"y,omitempty"`
+	Series    string           `json:"series,omitempty"`
+	Title     string           `json:"title,omitempty"`
+}
+
+// SuggestChartTool 是 'suggest_chart' 工具的定义。
+var SuggestChartTool = &protocol.Tool{
+	Name:        "suggest_chart",
+	Description: "根据结果集的列类型和基数推荐图表 (折线、柱状、散点、饼图或直方图)，返回可直接渲染的 Vega-Lite 规格和/或 Chart.js 配置。可以传入只读查询 (conn_id + query) 或已有的结果行 (rows)",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"conn_id": {Type: protocol.String, Description: "(与 query 一起使用) 目标数据库的连接 ID"},
+			"query":   {Type: protocol.String, Description: "(可选) 只读 SQL 查询，以只读事务执行，最多使用前 5000 行"},
+			"params": {
+				Type:        protocol.Array,
+				Description: "(可选) 查询参数列表 ($1, $2...)",
+				Items:       &protocol.Property{Type: protocol.String, Description: "数组中的单个参数 (Schema 定义为 string，但接受任意 JSON 类型)"},
+			},
+			"rows": {
+				Type:        protocol.Array,
+				Description: "(可选) 已有的结果行，每行是 {列名: 值} 对象，与 query 二选一",
+				Items:       &protocol.Property{Type: protocol.ObjectT, Description: "一行数据"},
+			},
+			"columns": {
+				Type:        protocol.Array,
+				Description: "(可选) rows 的列顺序，默认按列名排序",
+				Items:       &protocol.Property{Type: protocol.String},
+			},
+			"format":     {Type: protocol.String, Description: "(可选) 返回的规格: vega-lite (默认), chartjs 或 both"},
+			"chart_type": {Type: protocol.String, Description: "(可选) 指定图表类型: bar, line, scatter, pie 或 histogram，默认自动选择"},
+			"x":          {Type: protocol.String, Description: "(可选) X 轴 (或类别) 列，默认自动选择"},
+			"y":          {Type: protocol.String, Description: "(可选) Y 轴 (数值) 列，默认自动选择"},
+			"series":     {Type: protocol.String, Description: "(可选) 系列 (颜色) 列，默认选择不超过 10 个不同值的类别列"},
+			"title":      {Type: protocol.String, Description: "(可选) 图表标题"},
+		},
+	},
+}
+
+// SuggestChartResult 是 'suggest_chart' 工具的返回结果
+type SuggestChartResult struct {
+	*charts.Suggestion
+	RowCount  int            `json:"row_count"`
+	Truncated bool           `json:"truncated,omitempty"` // 结果超过 5000 行，只使用了前 5000 行
+	VegaLite  map[string]any `json:"vega_lite,omitempty"`
+	ChartJS   map[string]any `json:"chartjs,omitempty"`
+}
+
+// SuggestChartHandler 处理图表推荐的工具调用。
+type SuggestChartHandler struct {
+	dbService databases.Service
+	masker    *masking.Masker
+}
+
+// NewSuggestChartHandler 创建一个新的 SuggestChartHandler。
+func NewSuggestChartHandler(dbService databases.Service, masker *masking.Masker) *SuggestChartHandler {
+	return &SuggestChartHandler{dbService: dbService, masker: masker}
+}
+
+// HandleSuggestChart 处理 'suggest_chart' 工具的调用请求。
+func (h *SuggestChartHandler) HandleSuggestChart(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(SuggestChartToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	format := strings.ToLower(args.Format)
+	if format == "" {
+		format = charts.FormatVegaLite
+	}
+	if format != charts.FormatVegaLite && format != charts.FormatChartJS && format != "both" {
+		return nil, fmt.Errorf("不支持的 'format': '%s' (可选 vega-lite, chartjs, both)", args.Format)
+	}
+
+	var columns []string
+	var rows []map[string]any
+	switch {
+	case args.Query != "" && args.Rows != nil:
+		return nil, fmt.Errorf("'query' 和 'rows' 只能指定一个")
+	case args.Query != "":
+		if args.ConnID == "" {
+			return nil, fmt.Errorf("使用 'query' 时缺少 'conn_id' 参数")
+		}
+		result, err := h.dbService.QueryWithColumns(ctx, args.ConnID, true, args.Query, args.Params...)
+		if err != nil {
+			utils.DefaultLogger.Error("图表查询执行失败", zap.String("connID", args.ConnID), zap.Error(err))
+			return newErrorResult("查询执行失败", err), nil
+		}
+		if err := h.masker.MaskResult(ctx, args.ConnID, result); err != nil {
+			return newErrorResult("结果脱敏失败", err), nil
+		}
+		columns, rows = result.Columns, result.Rows
+	case args.Rows != nil:
+		columns, rows = args.Columns, args.Rows
+		if len(columns) == 0 {
+			columns = rowColumns(rows)
+		}
+	default:
+		return nil, fmt.Errorf("缺少 'query' 或 'rows' 参数")
+	}
+
+	chartResult := &SuggestChartResult{RowCount: len(rows)}
+	if len(rows) > maxChartRows {
+		rows = rows[:maxChartRows]
+		chartResult.Truncated = true
+	}
+	suggestion, err := charts.Suggest(columns, rows, charts.Options{
+		Type:   strings.ToLower(args.ChartType),
+		X:      args.X,
+		Y:      args.Y,
+		Series: args.Series,
+	})
+	if err != nil {
+		return newErrorResult("无法生成图表", err), nil
+	}
+	chartResult.Suggestion = suggestion
+	if format != charts.FormatChartJS {
+		chartResult.VegaLite = suggestion.VegaLite(rows, args.Title)
+	}
+	if format != charts.FormatVegaLite {
+		chartResult.ChartJS = suggestion.ChartJS(rows, args.Title)
+	}
+	utils.DefaultLogger.Info("已生成图表规格", zap.String("type", suggestion.Type), zap.String("x", suggestion.X), zap.String("y", suggestion.Y), zap.Int("rows", len(rows)))
+	return newJSONResult(chartResult)
+}
+
+// rowColumns 返回所有行中出现过的列名 (按名称排序)
+func rowColumns(rows []map[string]any) []string {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, row := range rows {
+		for column := range row {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
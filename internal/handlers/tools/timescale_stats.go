@@ -0,0 +1,144 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/results"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+)
+
+// TimescaleStatsToolArgs 是 'timescale_stats' 工具的输入参数。
+type TimescaleStatsToolArgs struct {
+	ConnID string `json:"conn_id" description:"目标数据库的连接 ID"`
+	Schema string `json:"schema,omitempty" description:"(可选) 只统计该 Schema 下的超表"`
+	Table  string `json:"table,omitempty" description:"(可选) 只统计该超表 (需同时指定 schema)"`
+}
+
+// TimescaleStatsHandler 处理 'timescale_stats' 工具的调用。
+type TimescaleStatsHandler struct {
+	dbService     databases.Service
+	schemaManager schemas.Manager
+}
+
+// NewTimescaleStatsHandler 创建一个新的 TimescaleStatsHandler。
+func NewTimescaleStatsHandler(dbService databases.Service, schemaManager schemas.Manager) *TimescaleStatsHandler {
+	return &TimescaleStatsHandler{dbService: dbService, schemaManager: schemaManager}
+}
+
+// HandleTimescaleStats 处理 'timescale_stats' 工具的调用请求。
+// 返回每个超表的大小、分块数量和时间范围、压缩前后的大小，以及后台作业 (策略) 的最近执行情况。
+func (h *TimescaleStatsHandler) HandleTimescaleStats(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(TimescaleStatsToolArgs)
+	if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 参数")
+	}
+	if args.Table != "" && args.Schema == "" {
+		return nil, fmt.Errorf("指定 'table' 时必须同时指定 'schema'")
+	}
+
+	features, err := h.schemaManager.GetFeatures(ctx, args.ConnID)
+	if err != nil {
+		return newErrorResult("检测数据库特性失败", err), nil
+	}
+	if !features.HasTimescale {
+		return newErrorResult("当前数据库未安装 TimescaleDB 扩展 (CREATE EXTENSION timescaledb)", nil), nil
+	}
+
+	// 大小统计函数安装在扩展所在的 Schema 中，不依赖 search_path
+	extRows, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true,
+		`SELECT n.nspname::text AS schema FROM pg_extension e JOIN pg_namespace n ON n.oid = e.extnamespace WHERE e.extname = 'timescaledb'`)
+	if err != nil || len(extRows) == 0 {
+		return newErrorResult("查询 TimescaleDB 扩展所在的 Schema 失败", err), nil
+	}
+	extSchema, _ := extRows[0]["schema"].(string)
+	ext, err := sqlsafe.QuoteIdentifier(extSchema)
+	if err != nil {
+		return newErrorResult("查询 TimescaleDB 扩展所在的 Schema 失败", err), nil
+	}
+
+	hypertablesQuery := `
+        SELECT
+            h.hypertable_schema::text AS schema,
+            h.hypertable_name::text AS table,
+            h.num_chunks::bigint AS num_chunks,
+            h.compression_enabled,
+            s.table_bytes, s.index_bytes, s.toast_bytes, s.total_bytes,
+            pg_size_pretty(s.total_bytes) AS total_size,
+            ch.compressed_chunks,
+            ch.range_start,
+            ch.range_end,
+            c.before_compression_total_bytes,
+            c.after_compression_total_bytes
+        FROM timescaledb_information.hypertables h
+        CROSS JOIN LATERAL ` + ext + `.hypertable_detailed_size(format('%I.%I', h.hypertable_schema, h.hypertable_name)::regclass) s
+        CROSS JOIN LATERAL (
+            SELECT
+                count(*) FILTER (WHERE is_compressed)::bigint AS compressed_chunks,
+                COALESCE(min(range_start)::text, min(range_start_integer)::text) AS range_start,
+                COALESCE(max(range_end)::text, max(range_end_integer)::text) AS range_end
+            FROM timescaledb_information.chunks
+            WHERE hypertable_schema = h.hypertable_schema AND hypertable_name = h.hypertable_name
+        ) ch
+        LEFT JOIN LATERAL (
+            SELECT before_compression_total_bytes, after_compression_total_bytes
+            FROM ` + ext + `.hypertable_compression_stats(format('%I.%I', h.hypertable_schema, h.hypertable_name)::regclass)
+        ) c ON h.compression_enabled
+        WHERE ($1::text = '' OR h.hypertable_schema = $1::text) AND ($2::text = '' OR h.hypertable_name = $2::text)
+        ORDER BY s.total_bytes DESC`
+	hypertables, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true, hypertablesQuery, args.Schema, args.Table)
+	if err != nil {
+		return newErrorResult("查询超表统计失败", err), nil
+	}
+	if args.Table != "" && len(hypertables) == 0 {
+		return newErrorResult(fmt.Sprintf("'%s.%s' 不是 TimescaleDB 超表", args.Schema, args.Table), nil), nil
+	}
+
+	jobsQuery := `
+        SELECT
+            j.hypertable_schema::text AS schema,
+            j.hypertable_name::text AS table,
+            j.job_id::bigint AS job_id,
+            j.proc_name::text AS proc_name,
+            j.schedule_interval::text AS schedule_interval,
+            j.scheduled,
+            j.config,
+            s.last_run_started_at,
+            s.last_successful_finish,
+            s.last_run_status::text AS last_run_status,
+            s.job_status::text AS job_status,
+            s.next_start,
+            s.total_runs::bigint AS total_runs,
+            s.total_failures::bigint AS total_failures
+        FROM timescaledb_information.jobs j
+        LEFT JOIN timescaledb_information.job_stats s ON s.job_id = j.job_id
+        WHERE j.hypertable_name IS NOT NULL
+          AND ($1::text = '' OR j.hypertable_schema = $1::text) AND ($2::text = '' OR j.hypertable_name = $2::text)
+        ORDER BY j.job_id`
+	jobs, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true, jobsQuery, args.Schema, args.Table)
+	if err != nil {
+		return newErrorResult("查询后台作业统计失败", err), nil
+	}
+
+	jobsByTable := make(map[string][]map[string]any)
+	for _, job := range results.NormalizeRows(jobs) {
+		key := fmt.Sprint(job["schema"]) + "." + fmt.Sprint(job["table"])
+		delete(job, "schema")
+		delete(job, "table")
+		jobsByTable[key] = append(jobsByTable[key], job)
+	}
+	stats := results.NormalizeRows(hypertables)
+	for _, hypertable := range stats {
+		hypertable["jobs"] = jobsByTable[fmt.Sprint(hypertable["schema"])+"."+fmt.Sprint(hypertable["table"])]
+	}
+	return newJSONResult(map[string]any{
+		"timescaledb_version": features.Extensions["timescaledb"],
+		"hypertables":         stats,
+	})
+}
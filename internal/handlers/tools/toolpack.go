@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/idempotency"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/toolpacks"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ToolPackHandler 执行工具包 (YAML) 中定义的自定义工具。
+type ToolPackHandler struct {
+	dbService        databases.Service
+	masker           *masking.Masker
+	idempotencyStore idempotency.Store
+	reviewQueue      *ReviewQueue
+}
+
+// NewToolPackHandler 创建一个新的 ToolPackHandler。
+func NewToolPackHandler(dbService databases.Service, masker *masking.Masker, idempotencyStore idempotency.Store, reviewQueue *ReviewQueue) *ToolPackHandler {
+	return &ToolPackHandler{dbService: dbService, masker: masker, idempotencyStore: idempotencyStore, reviewQueue: reviewQueue}
+}
+
+// PackTool 根据工具定义生成 MCP 工具定义 (自动加入 conn_id 参数)，并检查 SQL 模板中的占位符与参数定义一致。
+func PackTool(def toolpacks.ToolDef) (*protocol.Tool, error) {
+	placeholders := make(map[string]any, len(def.Params))
+	for _, param := range def.Params {
+		placeholders[param.Name] = nil
+	}
+	if _, _, err := BindNamedParams(def.SQL, nil, placeholders); err != nil {
+		return nil, fmt.Errorf("工具 '%s' 的 SQL 模板与参数定义不一致: %w", def.Name, err)
+	}
+
+	properties := map[string]*protocol.Property{
+		"conn_id": {Type: protocol.String, Description: "目标数据库的连接 ID"},
+	}
+	required := []string{"conn_id"}
+	for _, param := range def.Params {
+		property := &protocol.Property{Type: protocol.DataType(param.Type), Description: param.Description}
+		if param.Type == toolpacks.ParamArray {
+			property.Items = &protocol.Property{Type: protocol.String, Description: "数组元素 (Schema 定义为 string，但接受任意 JSON 类型)"}
+		}
+		if param.Default != nil {
+			property.Description = fmt.Sprintf("%s (默认值: %v)", property.Description, param.Default)
+		}
+		properties[param.Name] = property
+		if param.Required {
+			required = append(required, param.Name)
+		}
+	}
+	description := def.Description
+	if !def.IsReadOnly() {
+		description = "(写入) " + description
+		properties[IdempotencyKeyArg] = IdempotencyKeyProperty
+	}
+	return &protocol.Tool{
+		Name:        def.Name,
+		Description: description,
+		InputSchema: protocol.InputSchema{Type: protocol.Object, Properties: properties, Required: required},
+	}, nil
+}
+
+// HandlePackTool 处理工具包中定义的工具的调用请求。
+// 参数值全部通过占位符传入；非只读工具需要 read_write 连接，并与其他写入工具一样经过幂等键和审核队列。
+func (h *ToolPackHandler) HandlePackTool(ctx context.Context, def toolpacks.ToolDef, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	arguments := make(map[string]any)
+	if len(req.RawArguments) > 0 {
+		if err := json.Unmarshal(req.RawArguments, &arguments); err != nil {
+			return nil, fmt.Errorf("参数解析错误: %w", err)
+		}
+	}
+	connID, _ := arguments["conn_id"].(string)
+	if connID == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 参数")
+	}
+	delete(arguments, IdempotencyKeyArg)
+	named, err := def.BindArgs(arguments)
+	if err != nil {
+		return newErrorResult("参数校验失败", err), nil
+	}
+	query, params, err := BindNamedParams(def.SQL, nil, named)
+	if err != nil {
+		return newErrorResult("参数绑定失败", err), nil
+	}
+
+	if def.IsReadOnly() {
+		return h.execute(ctx, def, connID, query, params)
+	}
+	if err := ensureWritable(h.dbService, connID); err != nil {
+		return newErrorResult("写入被拒绝", err), nil
+	}
+	summary := fmt.Sprintf("执行工具包 '%s' 中的写入工具 '%s'", def.Pack, def.Name)
+	return runIdempotent(ctx, h.idempotencyStore, connID, def.Name, req, func() (*protocol.CallToolResult, error) {
+		return runReviewed(ctx, h.reviewQueue, connID, def.Name, summary, req, func(ctx context.Context) (*protocol.CallToolResult, error) {
+			return h.execute(ctx, def, connID, query, params)
+		})
+	})
+}
+
+// execute 执行绑定后的 SQL 并返回脱敏后的结果
+func (h *ToolPackHandler) execute(ctx context.Context, def toolpacks.ToolDef, connID, query string, params []any) (*protocol.CallToolResult, error) {
+	utils.DefaultLogger.Info("执行工具包中的工具", zap.String("pack", def.Pack), zap.String("tool", def.Name), zap.String("connID", connID), zap.Bool("readOnly", def.IsReadOnly()))
+	result, err := h.dbService.QueryWithColumns(ctx, connID, def.IsReadOnly(), query, params...)
+	if err != nil {
+		utils.DefaultLogger.Error("工具包中的工具执行失败", zap.String("tool", def.Name), zap.String("connID", connID), zap.Error(err))
+		return newErrorResult("查询执行失败", err), nil
+	}
+	if err := h.masker.MaskResult(ctx, connID, result); err != nil {
+		return newErrorResult("结果脱敏失败", err), nil
+	}
+	return newJSONResult(map[string]any{
+		"columns":   result.Columns,
+		"rows":      nonNilRows(result.Rows),
+		"row_count": len(result.Rows),
+	})
+}
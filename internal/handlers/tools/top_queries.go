@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTopQueriesLimit = 10
+	maxTopQueriesLimit     = 100
+)
+
+// topQueriesOrderColumns 是允许的排序方式 -> 结果列
+var topQueriesOrderColumns = map[string]string{
+	"total_time": "total_time_ms",
+	"mean_time":  "mean_time_ms",
+	"calls":      "calls",
+	"rows":       "rows",
+}
+
+// TopQueriesToolArgs 是 'top_queries' 工具的输入参数。
+type TopQueriesToolArgs struct {
+	ConnID  string `json:"conn_id" description:"目标数据库的连接 ID"`
+	OrderBy string `json:"order_by,omitempty" description:"(可选) 排序方式: total_time (默认), mean_time, calls, rows"`
+	Table   string `json:"table,omitempty" description:"(可选) 只返回语句文本中引用了该表名的语句"`
+	Limit   int    `json:"limit,omitempty" description:"(可选) 返回的语句数，默认 10，最大 100"`
+}
+
+// TopQueriesHandler 处理基于 pg_stat_statements 的慢查询分析工具调用。
+type TopQueriesHandler struct {
+	dbService     databases.Service
+	schemaManager schemas.Manager
+}
+
+// NewTopQueriesHandler 创建一个新的 TopQueriesHandler。
+func NewTopQueriesHandler(dbService databases.Service, schemaManager schemas.Manager) *TopQueriesHandler {
+	return &TopQueriesHandler{dbService: dbService, schemaManager: schemaManager}
+}
+
+// HandleTopQueries 处理 'top_queries' 工具的调用请求。
+// 返回当前数据库中开销最大的语句 (总耗时, 调用次数, 平均耗时, 行数)，需要安装 pg_stat_statements 扩展。
+func (h *TopQueriesHandler) HandleTopQueries(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(TopQueriesToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 参数")
+	}
+	orderBy := args.OrderBy
+	if orderBy == "" {
+		orderBy = "total_time"
+	}
+	orderColumn, ok := topQueriesOrderColumns[orderBy]
+	if !ok {
+		return nil, fmt.Errorf("不支持的 'order_by': '%s' (可选 total_time, mean_time, calls, rows)", args.OrderBy)
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultTopQueriesLimit
+	}
+	if limit > maxTopQueriesLimit {
+		limit = maxTopQueriesLimit
+	}
+
+	features, err := h.schemaManager.GetFeatures(ctx, args.ConnID)
+	if err != nil {
+		return newErrorResult("检测数据库特性失败", err), nil
+	}
+	if _, installed := features.Extensions["pg_stat_statements"]; !installed {
+		return newErrorResult("当前数据库未安装 pg_stat_statements 扩展 (需要 shared_preload_libraries 中包含 pg_stat_statements 并执行 CREATE EXTENSION)", nil), nil
+	}
+
+	// 扩展可能安装在任意 Schema 下
+	rows, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true,
+		`SELECT n.nspname AS schema FROM pg_extension e JOIN pg_namespace n ON n.oid = e.extnamespace WHERE e.extname = 'pg_stat_statements'`)
+	if err != nil || len(rows) == 0 {
+		return newErrorResult("查找 pg_stat_statements 所在 Schema 失败", err), nil
+	}
+	extSchema, err := sqlsafe.QuoteIdentifier(fmt.Sprint(rows[0]["schema"]))
+	if err != nil {
+		return newErrorResult("查找 pg_stat_statements 所在 Schema 失败", err), nil
+	}
+	view := extSchema + ".pg_stat_statements"
+
+	// PostgreSQL 13 起 total_time/mean_time 拆分为 plan 和 exec 两部分
+	totalTime, meanTime := "total_exec_time", "mean_exec_time"
+	if features.PgVersionNum > 0 && features.PgVersionNum < 130000 {
+		totalTime, meanTime = "total_time", "mean_time"
+	}
+
+	params := []any{}
+	condition := "dbid = (SELECT oid FROM pg_database WHERE datname = current_database())"
+	if args.Table != "" {
+		// \m \M 是 PostgreSQL 正则中的单词边界
+		params = append(params, `\m`+regexp.QuoteMeta(args.Table)+`\M`)
+		condition += fmt.Sprintf(" AND query ~* $%d", len(params))
+	}
+	params = append(params, limit)
+	query := fmt.Sprintf(`
+        SELECT queryid::text AS query_id, query,
+               calls,
+               round(%[1]s::numeric, 2) AS total_time_ms,
+               round(%[2]s::numeric, 2) AS mean_time_ms,
+               rows,
+               round((100 * %[1]s / nullif(sum(%[1]s) OVER (), 0))::numeric, 2) AS percent_of_total_time
+        FROM %[3]s
+        WHERE %[4]s
+        ORDER BY %[5]s DESC
+        LIMIT $%[6]d`, totalTime, meanTime, view, condition, orderColumn, len(params))
+
+	results, err := h.dbService.ExecuteQuery(ctx, args.ConnID, true, query, params...)
+	if err != nil {
+		utils.DefaultLogger.Error("查询 pg_stat_statements 失败", zap.String("connID", args.ConnID), zap.Error(err))
+		return newErrorResult("查询 pg_stat_statements 失败", err), nil
+	}
+
+	utils.DefaultLogger.Info("top_queries 查询完成", zap.String("connID", args.ConnID), zap.String("orderBy", orderBy), zap.Int("count", len(results)))
+	return newJSONResult(map[string]any{
+		"order_by": orderBy,
+		"queries":  results,
+		"note":     "percent_of_total_time 是在过滤条件范围内计算的占比；没有 pg_read_all_stats 权限时，其他角色执行的语句文本显示为 <insufficient privilege>",
+	})
+}
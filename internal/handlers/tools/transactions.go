@@ -0,0 +1,221 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/results"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// TxBeginToolArgs 是 'tx_begin' 工具的输入参数。
+type TxBeginToolArgs struct {
+	ConnID     string `json:"conn_id" description:"目标数据库的连接 ID"`
+	Isolation  string `json:"isolation,omitempty" description:"(可选) 隔离级别: repeatable_read (默认) 或 serializable，会话中的所有语句看到同一个快照"`
+	TempTables bool   `json:"temp_tables,omitempty" description:"(可选) 为 true 时允许在会话中创建和写入临时表 (CREATE TEMP TABLE, 对其 INSERT INTO / DROP TABLE)，需要 read_write 连接；临时表随会话结束删除"`
+}
+
+// TxExecuteToolArgs 是 'tx_execute' 工具的输入参数。
+// 工具 Schema 手动定义 (params 接受任意 JSON 类型)，参数用 json.Unmarshal 解析。
+type TxExecuteToolArgs struct {
+	TxID        string         `json:"tx_id"`
+	Query       string         `json:"query"`
+	Params      []any          `json:"params,omitempty"`
+	NamedParams map[string]any `json:"named_params,omitempty"`
+	Format      string         `json:"format,omitempty"`
+}
+
+// TxIDToolArgs 是 'tx_commit' 和 'tx_rollback' 工具的输入参数。
+type TxIDToolArgs struct {
+	TxID string `json:"tx_id" description:"tx_begin 返回的事务会话 ID"`
+}
+
+// TxSavepointToolArgs 是 'tx_savepoint' 和 'tx_rollback_to' 工具的输入参数。
+type TxSavepointToolArgs struct {
+	TxID string `json:"tx_id" description:"tx_begin 返回的事务会话 ID"`
+	Name string `json:"name" description:"保存点名称 (区分大小写)"`
+}
+
+// TxListToolArgs 是 'tx_list' 工具的输入参数。
+type TxListToolArgs struct {
+	ConnID string `json:"conn_id,omitempty" description:"(可选) 只列出该连接 ID 的事务会话"`
+}
+
+// TxExecuteTool 是 'tx_execute' 工具的定义。
+var TxExecuteTool = &protocol.Tool{
+	Name:        "tx_execute",
+	Description: "在 tx_begin 开始的事务会话中执行一条语句，所有语句共用同一个快照 (结果之后的内容块包含执行信息和会话状态)；语句出错后事务中止，只能 tx_rollback 或 tx_rollback_to 到出错前的保存点",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"tx_id": {Type: protocol.String, Description: "tx_begin 返回的事务会话 ID"},
+			"query": {Type: protocol.String, Description: "要执行的 SQL 语句 (使用 $1, $2... 位置参数或 :name 命名参数作为占位符)，不能包含 BEGIN/COMMIT/ROLLBACK/SAVEPOINT 等事务控制语句"},
+			"params": {
+				Type:        protocol.Array,
+				Description: "(可选) 语句对应的参数列表",
+				Items:       &protocol.Property{Type: protocol.String, Description: "数组中的单个参数 (Schema 定义为 string，但接受任意 JSON 类型)"},
+			},
+			"named_params": {Type: protocol.ObjectT, Description: "(可选) 命名参数对象，对应语句中的 :name 占位符"},
+			"format":       {Type: protocol.String, Description: "(可选) 结果格式: json (默认), csv, tsv, markdown"},
+		},
+		Required: []string{"tx_id", "query"},
+	},
+}
+
+// TransactionHandler 处理事务会话相关的工具调用。
+type TransactionHandler struct {
+	dbService databases.Service
+	masker    *masking.Masker
+}
+
+// NewTransactionHandler 创建一个新的 TransactionHandler。
+func NewTransactionHandler(dbService databases.Service, masker *masking.Masker) *TransactionHandler {
+	return &TransactionHandler{dbService: dbService, masker: masker}
+}
+
+// HandleTxBegin 处理 'tx_begin' 工具的调用请求。
+func (h *TransactionHandler) HandleTxBegin(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(TxBeginToolArgs)
+	if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" {
+		return nil, fmt.Errorf("缺少 'conn_id' 参数")
+	}
+
+	session, err := h.dbService.BeginTx(ctx, args.ConnID, databases.TxOptions{Isolation: strings.ToLower(args.Isolation), TempTables: args.TempTables})
+	if err != nil {
+		if errors.Is(err, databases.ErrTooManyTxSessions) {
+			return newErrorResult("无法开始更多事务会话", err), nil
+		}
+		utils.DefaultLogger.Error("开始事务会话失败", zap.String("connID", args.ConnID), zap.Error(err))
+		return newErrorResult("开始事务会话失败", err), nil
+	}
+	return newJSONResult(map[string]any{"success": true, "session": session})
+}
+
+// HandleTxExecute 处理 'tx_execute' 工具的调用请求。
+func (h *TransactionHandler) HandleTxExecute(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(TxExecuteToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.TxID == "" || args.Query == "" {
+		return nil, fmt.Errorf("缺少 'tx_id' 或 'query' 参数")
+	}
+	format := strings.ToLower(args.Format)
+	if !results.IsSupportedFormat(format) {
+		return nil, fmt.Errorf("不支持的 'format': '%s' (可选 json, csv, tsv, markdown)", args.Format)
+	}
+	query, params, err := BindNamedParams(args.Query, args.Params, args.NamedParams)
+	if err != nil {
+		return nil, fmt.Errorf("参数绑定错误: %w", err)
+	}
+
+	started := time.Now()
+	queryResult, session, err := h.dbService.ExecuteTx(ctx, args.TxID, query, params...)
+	elapsed := time.Since(started)
+	if err != nil {
+		return newSessionErrorResult("语句执行失败", err, session), nil
+	}
+	// 无法确定哪些列需要脱敏时不返回结果
+	if err := h.masker.MaskResult(ctx, session.ConnID, queryResult); err != nil {
+		return newErrorResult("结果脱敏失败", err), nil
+	}
+	encoded, err := results.Encode(format, queryResult.Columns, queryResult.Rows)
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]any{
+		"execution": results.NewMetadata(elapsed, queryResult.Columns, queryResult.Rows, encoded),
+		"session":   session,
+	}
+	detailBytes, _ := json.Marshal(details)
+	return &protocol.CallToolResult{Content: []protocol.Content{
+		protocol.TextContent{Type: results.MimeType(format), Text: encoded},
+		protocol.TextContent{Type: "application/json", Text: string(detailBytes)},
+	}}, nil
+}
+
+// HandleTxCommit 处理 'tx_commit' 工具的调用请求。
+func (h *TransactionHandler) HandleTxCommit(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	return h.finish(ctx, req, "提交", h.dbService.CommitTx)
+}
+
+// HandleTxRollback 处理 'tx_rollback' 工具的调用请求。
+func (h *TransactionHandler) HandleTxRollback(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	return h.finish(ctx, req, "回滚", h.dbService.RollbackTx)
+}
+
+// finish 用 end (CommitTx 或 RollbackTx) 结束会话
+func (h *TransactionHandler) finish(ctx context.Context, req *protocol.CallToolRequest, action string, end func(context.Context, string) (*databases.TxSession, error)) (*protocol.CallToolResult, error) {
+	args := new(TxIDToolArgs)
+	if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.TxID == "" {
+		return nil, fmt.Errorf("缺少 'tx_id' 参数")
+	}
+
+	session, err := end(ctx, args.TxID)
+	if err != nil {
+		// 会话可能已经结束 (例如中止的事务提交时被回滚)，附带结束时的状态
+		return newSessionErrorResult(fmt.Sprintf("%s事务会话失败", action), err, session), nil
+	}
+	return newJSONResult(map[string]any{"success": true, "session": session})
+}
+
+// HandleTxSavepoint 处理 'tx_savepoint' 工具的调用请求。
+func (h *TransactionHandler) HandleTxSavepoint(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	return h.savepoint(ctx, req, "创建保存点", h.dbService.SavepointTx)
+}
+
+// HandleTxRollbackTo 处理 'tx_rollback_to' 工具的调用请求。
+func (h *TransactionHandler) HandleTxRollbackTo(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	return h.savepoint(ctx, req, "回滚到保存点", h.dbService.RollbackToSavepointTx)
+}
+
+// savepoint 用 run (SavepointTx 或 RollbackToSavepointTx) 执行保存点操作
+func (h *TransactionHandler) savepoint(ctx context.Context, req *protocol.CallToolRequest, action string, run func(context.Context, string, string) (*databases.TxSession, error)) (*protocol.CallToolResult, error) {
+	args := new(TxSavepointToolArgs)
+	if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.TxID == "" || args.Name == "" {
+		return nil, fmt.Errorf("缺少 'tx_id' 或 'name' 参数")
+	}
+
+	session, err := run(ctx, args.TxID, args.Name)
+	if err != nil {
+		return newSessionErrorResult(fmt.Sprintf("%s失败", action), err, session), nil
+	}
+	return newJSONResult(map[string]any{"success": true, "session": session})
+}
+
+// newSessionErrorResult 构建附带会话状态的业务错误结果，客户端据此判断会话是否仍可使用
+func newSessionErrorResult(message string, err error, session *databases.TxSession) *protocol.CallToolResult {
+	if session == nil {
+		return newErrorResult(message, err)
+	}
+	resultBytes, _ := json.Marshal(map[string]any{"success": false, "error": fmt.Sprintf("%s: %v", message, err), "session": session})
+	return &protocol.CallToolResult{Content: []protocol.Content{protocol.TextContent{Type: "text", Text: string(resultBytes)}}, IsError: true}
+}
+
+// HandleTxList 处理 'tx_list' 工具的调用请求。
+func (h *TransactionHandler) HandleTxList(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(TxListToolArgs)
+	if len(req.RawArguments) > 0 { // 所有参数都是可选的，允许不传 arguments
+		if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+			return nil, fmt.Errorf("参数解析错误: %w", err)
+		}
+	}
+	return newJSONResult(map[string]any{"sessions": h.dbService.ListTxSessions(args.ConnID)})
+}
@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/extensions"
+)
+
+// ValidateKnowledgeToolArgs 是 'validate_knowledge' 工具的输入参数。
+type ValidateKnowledgeToolArgs struct {
+	Content   string `json:"content,omitempty" description:"(可选) 要校验的扩展知识 YAML 文本，不读取目录也不加载"`
+	Extension string `json:"extension,omitempty" description:"(可选) 只校验目录中该扩展的文件 (文件名去除 .yaml 后缀)；未指定 content 和 extension 时校验目录中的所有文件"`
+}
+
+// ValidateKnowledgeHandler 处理校验扩展知识的工具调用。
+type ValidateKnowledgeHandler struct {
+	extManager extensions.Manager
+}
+
+// NewValidateKnowledgeHandler 创建一个新的 ValidateKnowledgeHandler。
+func NewValidateKnowledgeHandler(extManager extensions.Manager) *ValidateKnowledgeHandler {
+	return &ValidateKnowledgeHandler{extManager: extManager}
+}
+
+// HandleValidateKnowledge 处理 'validate_knowledge' 工具的调用请求。
+// 返回每个文件是否有效以及问题列表 (行号、列号、字段路径和说明)，不改变已加载的知识。
+func (h *ValidateKnowledgeHandler) HandleValidateKnowledge(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(ValidateKnowledgeToolArgs)
+	if err := protocol.VerifyAndUnmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.Content != "" && args.Extension != "" {
+		return nil, fmt.Errorf("'content' 和 'extension' 只能指定一个")
+	}
+
+	if args.Content != "" {
+		knowledge, err := extensions.ParseKnowledge([]byte(args.Content))
+		if err != nil {
+			var knowledgeErr *extensions.KnowledgeError
+			if !errors.As(err, &knowledgeErr) {
+				return newErrorResult("校验扩展知识失败", err), nil
+			}
+			return newJSONResult(map[string]any{"valid": false, "issues": knowledgeErr.Issues})
+		}
+		return newJSONResult(map[string]any{
+			"valid": true,
+			"counts": map[string]int{
+				"data_types":     len(knowledge.DataTypes),
+				"operators":      len(knowledge.Operators),
+				"functions":      len(knowledge.Functions),
+				"examples":       len(knowledge.Examples),
+				"best_practices": len(knowledge.BestPractices),
+				"plan_advice":    len(knowledge.PlanAdvice),
+			},
+		})
+	}
+
+	reports, err := h.extManager.ValidateKnowledge(args.Extension)
+	if err != nil {
+		return newErrorResult("校验扩展知识失败", err), nil
+	}
+	if args.Extension != "" && len(reports) == 0 {
+		return newErrorResult(fmt.Sprintf("扩展知识目录中没有 '%s' 的 YAML 文件", args.Extension), nil), nil
+	}
+	valid := true
+	for _, report := range reports {
+		valid = valid && report.Valid
+	}
+	return newJSONResult(map[string]any{"valid": valid, "files": reports})
+}
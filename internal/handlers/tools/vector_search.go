@@ -0,0 +1,329 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/masking"
+	"github.com/cbc3929/pg_mcp_server/internal/core/results"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultVectorSearchK = 10
+	maxVectorSearchK     = 1000
+)
+
+// vectorSearchOperators 是距离度量到 pgvector 距离运算符的映射
+var vectorSearchOperators = map[string]string{
+	"l2":            "<->",
+	"cosine":        "<=>",
+	"inner_product": "<#>",
+	"l1":            "<+>",
+}
+
+// VectorSearchToolArgs 是 'vector_search' 工具的输入参数。
+// 工具 Schema 手动定义 (vector 是数字数组，filters 是对象)，参数用 json.Unmarshal 解析。
+type VectorSearchToolArgs struct {
+	ConnID            string         `json:"conn_id"`
+	Schema            string         `json:"schema"`
+	Table             string         `json:"table"`
+	Column            string         `json:"column"`
+	Vector            []float64      `json:"vector,omitempty"`
+	QueryText         string         `json:"query_text,omitempty"`
+	EmbeddingFunction string         `json:"embedding_function,omitempty"`
+	EmbeddingArgs     []string       `json:"embedding_args,omitempty"`
+	Metric            string         `json:"metric,omitempty"`
+	K                 int            `json:"k,omitempty"`
+	Columns           []string       `json:"columns,omitempty"`
+	Filters           map[string]any `json:"filters,omitempty"`
+	Format            string         `json:"format,omitempty"`
+}
+
+// VectorSearchTool 是 'vector_search' 工具的定义。
+var VectorSearchTool = &protocol.Tool{
+	Name:        "vector_search",
+	Description: "在 pgvector 向量列上做 k 近邻相似度搜索 (ORDER BY 距离 LIMIT k，可以使用 ivfflat/hnsw 索引)，返回最相似的行和 distance 列；查询向量可以直接提供，也可以提供文本和数据库内的嵌入函数 (例如 pgai 的 ai.openai_embed)",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"conn_id": {Type: protocol.String, Description: "目标数据库的连接 ID"},
+			"schema":  {Type: protocol.String, Description: "表所在的 Schema"},
+			"table":   {Type: protocol.String, Description: "表名"},
+			"column":  {Type: protocol.String, Description: "向量列名 (vector、halfvec 或 sparsevec 类型)"},
+			"vector": {
+				Type:        protocol.Array,
+				Description: "(可选) 查询向量，维度必须与向量列一致；与 query_text 二选一",
+				Items:       &protocol.Property{Type: protocol.Number},
+			},
+			"query_text":         {Type: protocol.String, Description: "(可选) 查询文本，由 embedding_function 在数据库中转换为向量；与 vector 二选一"},
+			"embedding_function": {Type: protocol.String, Description: "(可选) 把文本转换为向量的数据库函数 (可带 Schema 前缀，例如 ai.openai_embed)，调用形式为 函数(embedding_args..., query_text)；生成列时使用的函数和模型应与此相同"},
+			"embedding_args": {
+				Type:        protocol.Array,
+				Description: "(可选) 放在 query_text 之前传给嵌入函数的文本参数，例如模型名 [\"text-embedding-3-small\"]",
+				Items:       &protocol.Property{Type: protocol.String},
+			},
+			"metric": {Type: protocol.String, Description: "(可选) 距离度量: cosine, l2, inner_product (距离为负内积), l1；默认使用该列向量索引的度量，没有索引时为 cosine"},
+			"k":      {Type: protocol.Integer, Description: fmt.Sprintf("(可选) 返回的行数，默认 %d，最大 %d", defaultVectorSearchK, maxVectorSearchK)},
+			"columns": {
+				Type:        protocol.Array,
+				Description: "(可选) 返回的列，默认返回除向量列以外的所有列",
+				Items:       &protocol.Property{Type: protocol.String},
+			},
+			"filters": {Type: protocol.ObjectT, Description: "(可选) 等值过滤条件，键为列名，例如 {\"tenant_id\": 42}；值为 null 时匹配 IS NULL"},
+			"format":  {Type: protocol.String, Description: "(可选) 结果格式: json (默认), csv, tsv, markdown"},
+		},
+		Required: []string{"conn_id", "schema", "table", "column"},
+	},
+}
+
+// VectorSearchHandler 处理向量相似度搜索的工具调用。
+type VectorSearchHandler struct {
+	dbService     databases.Service
+	schemaManager schemas.Manager
+	masker        *masking.Masker
+}
+
+// NewVectorSearchHandler 创建一个新的 VectorSearchHandler。
+func NewVectorSearchHandler(dbService databases.Service, schemaManager schemas.Manager, masker *masking.Masker) *VectorSearchHandler {
+	return &VectorSearchHandler{dbService: dbService, schemaManager: schemaManager, masker: masker}
+}
+
+// HandleVectorSearch 处理 'vector_search' 工具的调用请求。
+// 表、列只允许 Schema 缓存中存在的名称，查询向量、文本和过滤值都通过参数传入。
+func (h *VectorSearchHandler) HandleVectorSearch(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+	args := new(VectorSearchToolArgs)
+	if err := json.Unmarshal(req.RawArguments, args); err != nil {
+		return nil, fmt.Errorf("参数解析错误: %w", err)
+	}
+	if args.ConnID == "" || args.Schema == "" || args.Table == "" || args.Column == "" {
+		return nil, fmt.Errorf("缺少 'conn_id', 'schema', 'table' 或 'column' 参数")
+	}
+	if (len(args.Vector) > 0) == (args.QueryText != "") {
+		return nil, fmt.Errorf("'vector' 和 'query_text' 必须且只能提供一个")
+	}
+	if args.QueryText != "" && args.EmbeddingFunction == "" {
+		return nil, fmt.Errorf("使用 'query_text' 时需要提供 'embedding_function'")
+	}
+	format := strings.ToLower(args.Format)
+	if !results.IsSupportedFormat(format) {
+		return nil, fmt.Errorf("不支持的 'format': '%s' (可选 json, csv, tsv, markdown)", args.Format)
+	}
+	k := args.K
+	if k <= 0 {
+		k = defaultVectorSearchK
+	}
+	if k > maxVectorSearchK {
+		k = maxVectorSearchK
+	}
+
+	features, err := h.schemaManager.GetFeatures(ctx, args.ConnID)
+	if err != nil {
+		return newErrorResult("检测数据库特性失败", err), nil
+	}
+	if !features.HasPGVector {
+		return newErrorResult("当前数据库未安装 pgvector 扩展 (CREATE EXTENSION vector)", nil), nil
+	}
+	tableInfo, found := h.schemaManager.GetTableInfo(args.Schema, args.Table)
+	if !found {
+		return newErrorResult(fmt.Sprintf("未找到表 '%s.%s'", args.Schema, args.Table), nil), nil
+	}
+	columns := make(map[string]schemas.ColumnInfo, len(tableInfo.Columns))
+	for _, col := range tableInfo.Columns {
+		columns[col.Name] = col
+	}
+	vectorColumn, ok := columns[args.Column]
+	if !ok {
+		return newErrorResult(fmt.Sprintf("表 '%s.%s' 中不存在列 '%s'", args.Schema, args.Table, args.Column), nil), nil
+	}
+	if vectorColumn.Vector == nil {
+		return newErrorResult(fmt.Sprintf("列 '%s' 的类型是 %s，不是 pgvector 向量列", args.Column, vectorColumn.Type), nil), nil
+	}
+
+	metric, index := vectorSearchMetric(strings.ToLower(args.Metric), vectorColumn.Vector)
+	operator, ok := vectorSearchOperators[metric]
+	if !ok {
+		return nil, fmt.Errorf("不支持的 'metric': '%s' (可选 cosine, l2, inner_product, l1)", args.Metric)
+	}
+
+	// 查询向量: 直接提供的向量或嵌入函数的结果，都转换为列的类型 (类型名来自目录，已经过 pgvector 类型检查)
+	var params []any
+	var withClause, queryVector string
+	if len(args.Vector) > 0 {
+		if dims := vectorColumn.Vector.Dimensions; dims > 0 && int64(len(args.Vector)) != dims {
+			return newErrorResult(fmt.Sprintf("查询向量的维度为 %d，列 '%s' 的维度为 %d", len(args.Vector), args.Column, dims), nil), nil
+		}
+		params = append(params, vectorLiteral(vectorColumn.Vector.Type, args.Vector))
+		queryVector = fmt.Sprintf("$1::%s", vectorColumn.Type)
+	} else {
+		function, err := sqlsafe.ParseQualifiedName(args.EmbeddingFunction)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 'embedding_function': %w", err)
+		}
+		placeholders := make([]string, 0, len(args.EmbeddingArgs)+1)
+		for _, arg := range args.EmbeddingArgs {
+			params = append(params, arg)
+			placeholders = append(placeholders, fmt.Sprintf("$%d::text", len(params)))
+		}
+		params = append(params, args.QueryText)
+		placeholders = append(placeholders, fmt.Sprintf("$%d::text", len(params)))
+		// 嵌入函数通常是 VOLATILE 的 (例如调用外部服务)，放在 CTE 中只计算一次，而不是对每一行计算
+		withClause = fmt.Sprintf("WITH query_vector AS (SELECT (%s(%s))::%s AS v) ", function.Quoted(), strings.Join(placeholders, ", "), vectorColumn.Type)
+		queryVector = "(SELECT v FROM query_vector)"
+	}
+
+	selected := args.Columns
+	if len(selected) == 0 {
+		for _, col := range tableInfo.Columns {
+			if col.Vector == nil {
+				selected = append(selected, col.Name)
+			}
+		}
+	}
+	for _, name := range selected {
+		if _, ok := columns[name]; !ok {
+			return newErrorResult(fmt.Sprintf("表 '%s.%s' 中不存在列 '%s'", args.Schema, args.Table, name), nil), nil
+		}
+	}
+	selectList, err := sqlsafe.QuoteIdentifiers(selected)
+	if err != nil {
+		return newErrorResult("无效的列名", err), nil
+	}
+
+	// 按列名排序，相同的过滤条件生成相同的 SQL
+	filterColumns := make([]string, 0, len(args.Filters))
+	for name := range args.Filters {
+		filterColumns = append(filterColumns, name)
+	}
+	sort.Strings(filterColumns)
+	var conditions []string
+	for _, name := range filterColumns {
+		if _, ok := columns[name]; !ok {
+			return newErrorResult(fmt.Sprintf("表 '%s.%s' 中不存在过滤列 '%s'", args.Schema, args.Table, name), nil), nil
+		}
+		quoted, err := sqlsafe.QuoteIdentifier(name)
+		if err != nil {
+			return newErrorResult("无效的过滤列名", err), nil
+		}
+		value := args.Filters[name]
+		if value == nil {
+			conditions = append(conditions, quoted+" IS NULL")
+			continue
+		}
+		params = append(params, value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", quoted, len(params)))
+	}
+
+	// ORDER BY 使用与索引相同的 "列 运算符 查询向量" 形式，ivfflat/hnsw 索引才能生效
+	quotedColumn, err := sqlsafe.QuoteIdentifier(args.Column)
+	if err != nil {
+		return newErrorResult("无效的向量列名", err), nil
+	}
+	table, err := sqlsafe.QuoteQualified(args.Schema, args.Table)
+	if err != nil {
+		return newErrorResult("无效的表名", err), nil
+	}
+	distance := fmt.Sprintf("%s %s %s", quotedColumn, operator, queryVector)
+	selectList = append(selectList, distance+" AS distance")
+	query := fmt.Sprintf("%sSELECT %s FROM %s", withClause, strings.Join(selectList, ", "), table)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	params = append(params, k)
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d", distance, len(params))
+
+	started := time.Now()
+	queryResult, err := h.dbService.QueryWithColumns(ctx, args.ConnID, true, query, params...)
+	elapsed := time.Since(started)
+	if err != nil {
+		utils.DefaultLogger.Error("向量搜索失败", zap.String("connID", args.ConnID), zap.String("table", args.Schema+"."+args.Table), zap.String("column", args.Column), zap.Error(err))
+		return newErrorResult("向量搜索失败", err), nil
+	}
+	if err := h.masker.MaskResult(ctx, args.ConnID, queryResult); err != nil {
+		return newErrorResult("结果脱敏失败", err), nil
+	}
+	encoded, err := results.Encode(format, queryResult.Columns, queryResult.Rows)
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[string]any{
+		"execution":      results.NewMetadata(elapsed, queryResult.Columns, queryResult.Rows, encoded),
+		"metric":         metric,
+		"executed_query": query,
+	}
+	if index != "" {
+		details["index"] = index
+	} else {
+		details["warning"] = fmt.Sprintf("列 '%s' 上没有 %s 度量的向量索引，搜索会扫描全表", args.Column, metric)
+	}
+	utils.DefaultLogger.Info("向量搜索完成", zap.String("connID", args.ConnID), zap.String("table", args.Schema+"."+args.Table), zap.String("metric", metric), zap.Int("rows", len(queryResult.Rows)))
+	detailBytes, _ := json.Marshal(details)
+	return &protocol.CallToolResult{Content: []protocol.Content{
+		protocol.TextContent{Type: results.MimeType(format), Text: encoded},
+		protocol.TextContent{Type: "application/json", Text: string(detailBytes)},
+	}}, nil
+}
+
+// vectorSearchMetric 返回实际使用的距离度量和能用于该度量的向量索引名。
+// 未指定度量时优先使用列上第一个向量索引的度量，没有索引时使用 cosine。
+func vectorSearchMetric(metric string, vector *schemas.VectorInfo) (string, string) {
+	if metric == "" {
+		metric = "cosine"
+		for _, idx := range vector.Indexes {
+			if _, ok := vectorSearchOperators[idx.Distance]; ok {
+				metric = idx.Distance
+				break
+			}
+		}
+	}
+	for _, idx := range vector.Indexes {
+		if idx.Distance == metric {
+			return metric, idx.Name
+		}
+	}
+	return metric, ""
+}
+
+// vectorLiteral 返回查询向量的文本形式: vector/halfvec 为 [1,2,3]，sparsevec 为 {1:1,3:2}/3 (下标从 1 开始，省略 0)
+func vectorLiteral(vectorType string, vector []float64) string {
+	var sb strings.Builder
+	if vectorType == "sparsevec" {
+		sb.WriteString("{")
+		first := true
+		for i, value := range vector {
+			if value == 0 {
+				continue
+			}
+			if !first {
+				sb.WriteString(",")
+			}
+			first = false
+			sb.WriteString(strconv.Itoa(i + 1))
+			sb.WriteString(":")
+			sb.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+		}
+		sb.WriteString("}/")
+		sb.WriteString(strconv.Itoa(len(vector)))
+		return sb.String()
+	}
+	sb.WriteString("[")
+	for i, value := range vector {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
@@ -3,26 +3,52 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/ThinkInAIXYZ/go-mcp/protocol"
 	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/idempotency"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sqlguard"
 	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/internal/utils/sqlsafe"
 	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 )
 
+// maxTableSuffixLength 是 temp 表名后缀的最大长度，加上 analysis_/csv_ 前缀和 8 位随机后缀后不超过 63 字节的标识符上限
+const maxTableSuffixLength = 40
+
 // WriteTempHandler 处理向 temp schema 写入数据的工具调用。
 // !! 极度重要: 这个处理器的实现必须非常小心，以防止安全风险 !!
 type WriteTempHandler struct {
-	dbService databases.Service
+	dbService        databases.Service
+	idempotencyStore idempotency.Store // 记录已完成的幂等键，防止重试导致重复写入
+	reviewQueue      *ReviewQueue      // 审核模式下暂存写入，等待人工批准
+	importDir        string            // import_csv_temp 允许读取文件的目录，为空时不支持 file_path
+}
+
+// SaveAnalysisResultTool 是 'save_analysis_result' 工具的定义。
+var SaveAnalysisResultTool = &protocol.Tool{
+	Name:        "save_analysis_result",
+	Description: "将分析结果 (对象数组) 保存到 temp schema 下新建的表中，返回表名",
+	InputSchema: protocol.InputSchema{
+		Type: protocol.Object,
+		Properties: map[string]*protocol.Property{
+			"conn_id":                  {Type: protocol.String, Description: "目标数据库的连接 ID"},
+			"target_table_name_suffix": {Type: protocol.String, Description: "表名后缀 (只能包含字母、数字和下划线，最多 40 个字符)，最终表名为 temp.analysis_<后缀>_<随机串>"},
+			"result_data":              {Type: protocol.String, Description: "要保存的数据，JSON 对象数组 (或其 JSON 字符串)，列类型根据第一行推断"},
+			IdempotencyKeyArg:          IdempotencyKeyProperty,
+		},
+		Required: []string{"conn_id", "target_table_name_suffix", "result_data"},
+	},
 }
 
 // NewWriteTempHandler 创建一个新的 WriteTempHandler。
-func NewWriteTempHandler(dbService databases.Service) *WriteTempHandler {
-	return &WriteTempHandler{dbService: dbService}
+func NewWriteTempHandler(dbService databases.Service, idempotencyStore idempotency.Store, reviewQueue *ReviewQueue, importDir string) *WriteTempHandler {
+	return &WriteTempHandler{dbService: dbService, idempotencyStore: idempotencyStore, reviewQueue: reviewQueue, importDir: importDir}
 }
 
 // HandleSaveAnalysisResult (示例) 处理将分析结果保存到 temp 表的请求。
@@ -35,19 +61,39 @@ func (h *WriteTempHandler) HandleSaveAnalysisResult(ctx context.Context, req *pr
 		return nil, fmt.Errorf("缺少或无效的 'conn_id'")
 	}
 
+	if err := ensureWritable(h.dbService, connID); err != nil {
+		return newErrorResult("写入被拒绝", err), nil
+	}
+
+	// 幂等键: 超时重试时直接返回首次调用的结果 (审核模式下即同一个 write_id)
+	suffix, _ := req.Arguments["target_table_name_suffix"].(string)
+	summary := fmt.Sprintf("在 temp schema 下新建 analysis_%s_* 表并写入分析结果", suffix)
+	return runIdempotent(ctx, h.idempotencyStore, connID, SaveAnalysisResultTool.Name, req, func() (*protocol.CallToolResult, error) {
+		return runReviewed(ctx, h.reviewQueue, connID, SaveAnalysisResultTool.Name, summary, req, func(ctx context.Context) (*protocol.CallToolResult, error) {
+			return h.saveAnalysisResult(ctx, connID, req)
+		})
+	})
+}
+
+// saveAnalysisResult 执行实际的建表和写入。
+func (h *WriteTempHandler) saveAnalysisResult(ctx context.Context, connID string, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
 	// 目标表名 - 必须严格限制在 temp schema 下，并且进行清理
 	targetTableNameSuffix, ok := req.Arguments["target_table_name_suffix"].(string)
 	if !ok || targetTableNameSuffix == "" {
 		return nil, fmt.Errorf("缺少 'target_table_name_suffix'")
 	}
-	// 清理表名后缀，只允许字母、数字、下划线
-	safeSuffix := utils.SanitizeSQLString(targetTableNameSuffix)
-	if safeSuffix == "" {
-		return nil, fmt.Errorf("无效的 'target_table_name_suffix' (清理后为空)")
+	// 表名后缀只允许字母、数字、下划线
+	if err := sqlsafe.ValidateNamePart(targetTableNameSuffix, maxTableSuffixLength); err != nil {
+		return nil, fmt.Errorf("无效的 'target_table_name_suffix': %w", err)
 	}
 	// 构造完整的、带 schema 前缀的表名
 	// 使用会话ID或任务ID确保唯一性，防止冲突（这里用UUID模拟）
-	uniqueTableName := fmt.Sprintf("temp.analysis_%s_%s", safeSuffix, utils.GenerateUUID()[:8])
+	tableName := fmt.Sprintf("analysis_%s_%s", targetTableNameSuffix, utils.GenerateUUID()[:8])
+	uniqueTableName := "temp." + tableName
+	quotedTableName, err := sqlsafe.QuoteQualified("temp", tableName)
+	if err != nil {
+		return nil, err
+	}
 
 	// 结果数据 - 假设是以 JSON 数组形式传入
 	resultDataVal, ok := req.Arguments["result_data"] // 类型可能是 string 或 []any
@@ -91,6 +137,7 @@ func (h *WriteTempHandler) HandleSaveAnalysisResult(ctx context.Context, req *pr
 
 	// 2a. 推断列名和类型 (基于第一行数据) - 这很脆弱！
 	firstRow := results[0]
+	var rawColumnNames []string // 未引用的列名，用于从每行数据中取值
 	var columnNames []string
 	var columnDefs []string
 	var valuePlaceholders []string
@@ -98,11 +145,15 @@ func (h *WriteTempHandler) HandleSaveAnalysisResult(ctx context.Context, req *pr
 
 	colIndex := 1
 	for name, value := range firstRow {
-		safeColName := utils.QuoteIdentifier(name) // 清理并引用列名
-		pgType := inferPostgresType(value)         // 推断 PG 类型
+		safeColName, err := sqlsafe.QuoteIdentifier(name) // 校验并引用列名
+		if err != nil {
+			return nil, fmt.Errorf("无效的列名 '%s': %w", name, err)
+		}
+		pgType := inferPostgresType(value) // 推断 PG 类型
 		if pgType == "" {
 			return nil, fmt.Errorf("无法推断列 '%s' 的 PostgreSQL 类型", name)
 		}
+		rawColumnNames = append(rawColumnNames, name)
 		columnNames = append(columnNames, safeColName)
 		columnDefs = append(columnDefs, fmt.Sprintf("%s %s", safeColName, pgType))
 		valuePlaceholders = append(valuePlaceholders, fmt.Sprintf("$%d", colIndex))
@@ -113,13 +164,13 @@ func (h *WriteTempHandler) HandleSaveAnalysisResult(ctx context.Context, req *pr
 	// 使用 quote_ident 确保表名安全
 	// 注意: 这里的 uniqueTableName 已经包含了 "temp." 前缀
 	createTableSQL := fmt.Sprintf("CREATE TABLE %s (%s);",
-		utils.QuoteIdentifier(uniqueTableName), // "temp"."table_name"
+		quotedTableName, // "temp"."table_name"
 		strings.Join(columnDefs, ", "),
 	)
 
 	// 构造 INSERT 语句
 	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);",
-		utils.QuoteIdentifier(uniqueTableName),
+		quotedTableName,
 		strings.Join(columnNames, ", "),
 		strings.Join(valuePlaceholders, ", "),
 	)
@@ -127,9 +178,8 @@ func (h *WriteTempHandler) HandleSaveAnalysisResult(ctx context.Context, req *pr
 	// 准备插入数据
 	for _, row := range results {
 		rowArgs := make([]any, 0, len(columnNames))
-		for i := range columnNames {
+		for _, originalColName := range rawColumnNames {
 			// 需要从原始列名获取值，因为 columnNames 已经被 quote 了
-			originalColName := strings.Trim(columnNames[i], `"`) // 假设 QuoteIdentifier 加了双引号
 			val, exists := row[originalColName]
 			if !exists {
 				// 理论上不应该发生，因为列是基于第一行推断的
@@ -144,70 +194,53 @@ func (h *WriteTempHandler) HandleSaveAnalysisResult(ctx context.Context, req *pr
 	// 3. 执行数据库操作 (使用读写模式，并且需要事务)
 	utils.DefaultLogger.Info("准备向 temp schema 写入数据...", zap.String("connID", connID), zap.String("tableName", uniqueTableName))
 
-	// 这里需要一个能执行多条语句的事务性操作
-	// 我们可以通过 dbService 暴露一个 ExecuteTx 方法，或者在这里直接获取连接池操作
-	pool, err := h.dbService.GetPool(ctx, connID)
-	if err != nil {
-		return nil, fmt.Errorf("获取连接池失败: %w", err)
-	}
+	// CREATE TABLE 和批量 INSERT 在同一个读写事务中执行
+	var failure string
+	err = h.dbService.WriteTx(ctx, connID, []string{createTableSQL, insertSQL}, func(tx pgx.Tx) error {
+		// 执行 CREATE TABLE
+		utils.DefaultLogger.Debug("执行 CREATE TABLE", zap.String("sql", createTableSQL))
+		if _, err := tx.Exec(ctx, createTableSQL); err != nil {
+			utils.DefaultLogger.Error("创建 temp 表失败", zap.Error(err), zap.String("sql", createTableSQL))
+			failure = fmt.Sprintf("创建临时表失败: %v", err)
+			return err
+		}
 
-	tx, err := pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadWrite}) // 显式读写模式
-	if err != nil {
-		return nil, fmt.Errorf("开始读写事务失败: %w", err)
+		// 批量执行 INSERT
+		utils.DefaultLogger.Debug("准备批量插入数据", zap.Int("rowCount", len(insertArgs)))
+		// 使用 pgx 的 Batch 功能提高效率
+		batch := &pgx.Batch{}
+		for _, args := range insertArgs {
+			batch.Queue(insertSQL, args...)
+		}
+		br := tx.SendBatch(ctx, batch)
+		// 检查批量操作的结果
+		for i := 0; i < len(insertArgs); i++ {
+			_, errExec := br.Exec()
+			if errExec != nil {
+				closeErr := br.Close() // 必须关闭 batch results
+				utils.DefaultLogger.Error("批量插入时发生错误", zap.Error(errExec), zap.Int("rowIndex", i), zap.NamedError("closeErr", closeErr))
+				failure = fmt.Sprintf("插入第 %d 行数据失败: %v", i+1, errExec)
+				return errExec
+			}
+		}
+		if err := br.Close(); err != nil { // 关闭并检查最终错误
+			utils.DefaultLogger.Error("关闭 BatchResults 时发生错误", zap.Error(err))
+			failure = fmt.Sprintf("完成批量插入时出错: %v", err)
+			return err
+		}
+		return nil
+	})
+	if errors.Is(err, sqlguard.ErrDenied) {
+		return newErrorResult("写入被访问策略拒绝", err), nil
 	}
-	defer func() { _ = tx.Rollback(ctx) }() // 保证回滚
-
-	// 执行 CREATE TABLE
-	utils.DefaultLogger.Debug("执行 CREATE TABLE", zap.String("sql", createTableSQL))
-	_, err = tx.Exec(ctx, createTableSQL)
 	if err != nil {
-		utils.DefaultLogger.Error("创建 temp 表失败", zap.Error(err), zap.String("sql", createTableSQL))
-		return &protocol.CallToolResult{
-			Content: []protocol.Content{
-				protocol.TextContent{Type: "text", Text: fmt.Sprintf(`{"success": false, "error": "创建临时表失败: %v"}`, err)},
-			},
-			IsError: true,
-		}, nil
-	}
-
-	// 批量执行 INSERT
-	utils.DefaultLogger.Debug("准备批量插入数据", zap.Int("rowCount", len(insertArgs)))
-	// 使用 pgx 的 Batch 功能提高效率
-	batch := &pgx.Batch{}
-	for _, args := range insertArgs {
-		batch.Queue(insertSQL, args...)
-	}
-	br := tx.SendBatch(ctx, batch)
-	// 检查批量操作的结果
-	for i := 0; i < len(insertArgs); i++ {
-		_, errExec := br.Exec()
-		if errExec != nil {
-			closeErr := br.Close() // 必须关闭 batch results
-			utils.DefaultLogger.Error("批量插入时发生错误", zap.Error(errExec), zap.Int("rowIndex", i), zap.NamedError("closeErr", closeErr))
-			return &protocol.CallToolResult{
-				Content: []protocol.Content{
-					protocol.TextContent{Type: "text", Text: fmt.Sprintf(`{"success": false, "error": "插入第 %d 行数据失败: %v"}`, i+1, errExec)},
-				},
-				IsError: true,
-			}, nil
+		if failure == "" {
+			utils.DefaultLogger.Error("temp 表写入事务失败", zap.Error(err))
+			failure = err.Error()
 		}
-	}
-	if err := br.Close(); err != nil { // 关闭并检查最终错误
-		utils.DefaultLogger.Error("关闭 BatchResults 时发生错误", zap.Error(err))
-		return &protocol.CallToolResult{
-			Content: []protocol.Content{
-				protocol.TextContent{Type: "text", Text: fmt.Sprintf(`{"success": false, "error": "完成批量插入时出错: %v"}`, err)},
-			},
-			IsError: true,
-		}, nil
-	}
-
-	// 提交事务
-	if err := tx.Commit(ctx); err != nil {
-		utils.DefaultLogger.Error("提交 temp 表写入事务失败", zap.Error(err))
 		return &protocol.CallToolResult{
 			Content: []protocol.Content{
-				protocol.TextContent{Type: "text", Text: fmt.Sprintf(`{"success": false, "error": "提交事务失败: %v"}`, err)},
+				protocol.TextContent{Type: "text", Text: fmt.Sprintf(`{"success": false, "error": "%s"}`, failure)},
 			},
 			IsError: true,
 		}, nil
@@ -256,38 +289,3 @@ func inferPostgresType(value any) string {
 		return "" // 未知类型
 	}
 }
-
-// (确保 utils 包中有 SanitizeIdentifier 和 QuoteIdentifierQualified 函数)
-/* 示例 utils/security.go:
-package utils
-
-import (
-	"regexp"
-	"strings"
-	"fmt"
-)
-
-var nonAlphanumericUnderscore = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
-
-// SanitizeIdentifier 移除标识符中不安全的字符，只保留字母、数字、下划线
-func SanitizeIdentifier(identifier string) string {
-	return nonAlphanumericUnderscore.ReplaceAllString(identifier, "")
-}
-
-// QuoteIdentifier 安全地引用单个 PostgreSQL 标识符 (表名, 列名)
-func QuoteIdentifier(identifier string) string {
-	// 替换双引号为两个双引号，然后用双引号包围
-	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
-}
-
-// QuoteIdentifierQualified 安全地引用可能带 schema 的标识符 (e.g., "temp"."mytable")
-func QuoteIdentifierQualified(qualifiedIdentifier string) string {
-    parts := strings.SplitN(qualifiedIdentifier, ".", 2)
-    if len(parts) == 2 {
-        // 假设是 schema.table
-        return fmt.Sprintf("%s.%s", QuoteIdentifier(parts[0]), QuoteIdentifier(parts[1]))
-    }
-    // 否则认为是单个标识符
-    return QuoteIdentifier(qualifiedIdentifier)
-}
-*/
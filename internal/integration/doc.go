@@ -0,0 +1,8 @@
+// Package integration 包含端到端的集成测试: 用 testcontainers 启动 PostgreSQL (以及 PostGIS、pgvector 变体)，
+// 加载 testdata/fixtures 下的夹具 Schema，通过 SSE 传输层启动的 MCP 服务器逐一调用所有工具并读取所有资源。
+//
+// 测试文件带有 integration 构建标签，普通的 go test ./... 不会运行；需要本机可用的 Docker:
+//
+//	make test-integration
+//	PG_MCP_IT_VARIANTS=postgis make test-integration   # 只运行指定的变体 (逗号分隔)
+package integration
@@ -0,0 +1,296 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/client"
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/pkg/pgmcp"
+	"github.com/jackc/pgx/v5"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+// variant 是一种数据库镜像及其额外的夹具
+type variant struct {
+	name       string
+	image      string
+	fixtures   []string // testdata/fixtures 下除 01_common.sql 之外的夹具
+	extensions []string // 该变体提供的扩展，toolCase.requires 据此判断工具是否可用
+}
+
+var variants = []variant{
+	{name: "postgres", image: "postgres:16-alpine"},
+	{name: "postgis", image: "postgis/postgis:16-3.4", fixtures: []string{"02_postgis.sql"}, extensions: []string{"postgis"}},
+	{name: "pgvector", image: "pgvector/pgvector:pg16", fixtures: []string{"02_pgvector.sql"}, extensions: []string{"vector"}},
+}
+
+// selectedVariants 返回 PG_MCP_IT_VARIANTS (逗号分隔) 选择的变体，未设置时返回全部
+func selectedVariants(t *testing.T) []variant {
+	names := strings.TrimSpace(os.Getenv("PG_MCP_IT_VARIANTS"))
+	if names == "" {
+		return variants
+	}
+	var selected []variant
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		index := slices.IndexFunc(variants, func(v variant) bool { return v.name == name })
+		if index < 0 {
+			t.Fatalf("PG_MCP_IT_VARIANTS 中的变体 '%s' 不存在", name)
+		}
+		selected = append(selected, variants[index])
+	}
+	return selected
+}
+
+func TestMain(m *testing.M) {
+	if err := utils.SetupLogger(utils.DefaultLogConfig()); err != nil {
+		fmt.Fprintf(os.Stderr, "初始化日志失败: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// harness 是一个变体的测试环境: 数据库容器、MCP 服务器和连接到它的 MCP 客户端
+type harness struct {
+	variant variant
+	dsn     string // 夹具数据库的连接字符串
+	client  *client.Client
+}
+
+// startHarness 启动变体的数据库容器和 MCP 服务器，测试结束时全部清理
+func startHarness(t *testing.T, v variant) *harness {
+	t.Helper()
+	skipWithoutDocker(t)
+	ctx := context.Background()
+
+	scripts := []string{filepath.Join("testdata", "fixtures", "01_common.sql")}
+	for _, fixture := range v.fixtures {
+		scripts = append(scripts, filepath.Join("testdata", "fixtures", fixture))
+	}
+	container, err := postgres.Run(ctx, v.image,
+		postgres.WithDatabase("pgmcp_it"),
+		postgres.WithUsername("pgmcp"),
+		postgres.WithPassword("pgmcp"),
+		postgres.WithInitScripts(scripts...),
+		postgres.BasicWaitStrategies(),
+		// top_queries 需要预加载 pg_stat_statements
+		testcontainers.CustomizeRequestOption(func(req *testcontainers.GenericContainerRequest) error {
+			req.Cmd = append(req.Cmd, "-c", "shared_preload_libraries=pg_stat_statements")
+			return nil
+		}),
+	)
+	testcontainers.CleanupContainer(t, container)
+	if err != nil {
+		t.Fatalf("启动 %s 容器失败: %v", v.image, err)
+	}
+	dsn, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatalf("获取连接字符串失败: %v", err)
+	}
+
+	h := &harness{variant: v, dsn: dsn}
+	h.startServer(t)
+	return h
+}
+
+// skipWithoutDocker 在没有可用的 Docker 时跳过测试 (找不到 Docker 主机时 testcontainers 会 panic)
+func skipWithoutDocker(t *testing.T) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Skipf("Docker 不可用: %v", r)
+		}
+	}()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+}
+
+// startServer 在 httptest 上通过 SSE 传输层启动 MCP 服务器并连接客户端
+func (h *harness) startServer(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	for key, value := range map[string]string{
+		"ALLOW_READ_WRITE_CONNECTIONS": "true",
+		"NAMED_QUERY_REGISTRATION":     "true",
+		"EXTENSIONS_DIR":               filepath.Join("..", "..", "extensions_knowledge"),
+		"EXTENSIONS_WATCH":             "false",
+		"QUERY_TEMPLATES_DIR":          filepath.Join("testdata", "query_templates"),
+		"TOOL_PACKS_DIR":               filepath.Join("testdata", "toolpacks"),
+		"EXPORT_DIR":                   filepath.Join(dir, "exports"),
+		"STATE_BACKUP_DIR":             filepath.Join(dir, "state"),
+		"EMBEDDING_INDEX_FILE":         filepath.Join(dir, "embeddings", "schema_index.json"),
+		"EXTENSIONS_REMOTE_CACHE_DIR":  filepath.Join(dir, "extensions_remote"),
+		"STARTUP_BANNER":               "false",
+		"LOG_LEVEL":                    "warn",
+	} {
+		t.Setenv(key, value)
+	}
+	for _, sub := range []string{"exports", "state"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := pgmcp.LoadConfig()
+
+	mux := http.NewServeMux()
+	httpServer := httptest.NewServer(mux)
+	t.Cleanup(httpServer.Close)
+	serverTransport, handler, err := transport.NewSSEServerTransportAndHandler(httpServer.URL + "/message")
+	if err != nil {
+		t.Fatalf("创建 SSE 传输层失败: %v", err)
+	}
+	mux.Handle("/sse", handler.HandleSSE())
+	mux.Handle("/message", handler.HandleMessage())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	srv, err := pgmcp.New(ctx, pgmcp.WithConfig(cfg), pgmcp.WithSchemaSource(h.dsn), pgmcp.WithTransport(serverTransport))
+	if err != nil {
+		t.Fatalf("启动 MCP 服务器失败: %v", err)
+	}
+	go func() {
+		if err := srv.Run(); err != nil {
+			t.Errorf("MCP 服务器异常退出: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Errorf("关闭 MCP 服务器失败: %v", err)
+		}
+	})
+
+	clientTransport, err := transport.NewSSEClientTransport(httpServer.URL+"/sse", transport.WithSSEClientOptionReceiveTimeout(2*time.Minute))
+	if err != nil {
+		t.Fatalf("创建 SSE 客户端传输层失败: %v", err)
+	}
+	h.client, err = client.NewClient(clientTransport, client.WithClientInfo(protocol.Implementation{Name: "pgmcp-integration", Version: "test"}))
+	if err != nil {
+		t.Fatalf("连接 MCP 服务器失败: %v", err)
+	}
+	t.Cleanup(func() { _ = h.client.Close() })
+}
+
+// has 判断变体是否提供扩展
+func (h *harness) has(extension string) bool {
+	return slices.Contains(h.variant.extensions, extension)
+}
+
+// exec 绕过 MCP 服务器直接在夹具数据库上执行语句 (例如发送 NOTIFY)
+func (h *harness) exec(t *testing.T, sql string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, h.dsn)
+	if err != nil {
+		t.Fatalf("连接夹具数据库失败: %v", err)
+	}
+	defer conn.Close(ctx)
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		t.Fatalf("执行 '%s' 失败: %v", sql, err)
+	}
+}
+
+// callTool 调用工具并返回结果的文本内容和是否失败 (协议错误或 IsError 结果都视为失败)
+func (h *harness) callTool(t *testing.T, name string, args map[string]any) (string, bool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	result, err := h.client.CallTool(ctx, &protocol.CallToolRequest{Name: name, Arguments: args})
+	if err != nil {
+		return err.Error(), true
+	}
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(protocol.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), result.IsError
+}
+
+// mustCallTool 调用工具，失败时终止测试
+func (h *harness) mustCallTool(t *testing.T, name string, args map[string]any) string {
+	t.Helper()
+	text, failed := h.callTool(t, name, args)
+	if failed {
+		t.Fatalf("调用 %s 失败: %s", name, text)
+	}
+	return text
+}
+
+// connect 通过 connect 工具注册夹具数据库，返回 connID。
+// applicationName 区分注册 (相同连接字符串的注册会复用同一个 connID)。
+func (h *harness) connect(t *testing.T, applicationName, accessMode string) string {
+	t.Helper()
+	text := h.mustCallTool(t, "connect", map[string]any{
+		"connection_string": h.dsn + "&application_name=" + applicationName,
+		"access_mode":       accessMode,
+	})
+	var result struct {
+		ConnID string `json:"conn_id"`
+	}
+	if err := json.Unmarshal([]byte(text), &result); err != nil || result.ConnID == "" {
+		t.Fatalf("connect 返回的结果无效: %s", text)
+	}
+	t.Cleanup(func() { h.callTool(t, "disconnect", map[string]any{"conn_id": result.ConnID}) })
+	return result.ConnID
+}
+
+// lookup 按点分隔的路径从 JSON 文本中取值 (例如 session.tx_id)
+func lookup(text, path string) (any, bool) {
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, false
+	}
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// expand 把参数中的 {{name}} 占位符替换为变量值 (递归处理数组和对象)
+func expand(value any, vars map[string]string) any {
+	switch v := value.(type) {
+	case string:
+		for name, replacement := range vars {
+			v = strings.ReplaceAll(v, "{{"+name+"}}", replacement)
+		}
+		return v
+	case []any:
+		expanded := make([]any, len(v))
+		for i, item := range v {
+			expanded[i] = expand(item, vars)
+		}
+		return expanded
+	case map[string]any:
+		expanded := make(map[string]any, len(v))
+		for key, item := range v {
+			expanded[key] = expand(item, vars)
+		}
+		return expanded
+	default:
+		return value
+	}
+}
@@ -0,0 +1,104 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+)
+
+// templateVarPattern 匹配 URI 模板中的 {name} 变量和 {?a,b} 查询参数
+var templateVarPattern = regexp.MustCompile(`\{\??([^}]*)\}`)
+
+// resourceContains 是资源模板读取结果应包含的内容 (以夹具中的对象为准)
+var resourceContains = map[string][]string{
+	"pgmcp://{conn_id}/schemas":                                                {"app"},
+	"pgmcp://{conn_id}/schemas/{schema}/tables":                                {"customers", "orders"},
+	"pgmcp://{conn_id}/schemas/{schema}/tables/{table}/columns":                {"customer_id", "amount"},
+	"pgmcp://{conn_id}/schemas/{schema}/tables/{table}/constraints":            {"customers"},
+	"pgmcp://{conn_id}/schemas/{schema}/tables/{table}/indexes":                {"orders_customer_id_idx"},
+	"pgmcp://{conn_id}/schemas/{schema}/tables/{table}/ddl":                    {"CREATE TABLE"},
+	"pgmcp://{conn_id}/schemas/{schema}/tables/{table}/sample":                 {"paid"},
+	"pgmcp://{conn_id}/schemas/{schema}/tables/{table}/columns/{column}/stats": {"status"},
+	"pgmcp://{conn_id}/schemas/{schema}/views/{view}/lineage":                  {"orders"},
+}
+
+// TestResources 读取服务器列出的每个资源和资源模板 (用夹具中的对象填充模板变量)
+func TestResources(t *testing.T) {
+	for _, v := range selectedVariants(t) {
+		t.Run(v.name, func(t *testing.T) {
+			h := startHarness(t, v)
+			connID := h.connect(t, "pgmcp-it-resources", "read_only")
+			h.mustCallTool(t, "refresh_schema", map[string]any{"conn_id": connID})
+			vars := map[string]string{
+				"conn_id":   connID,
+				"schema":    "app",
+				"table":     "orders",
+				"column":    "status",
+				"view":      "customer_totals",
+				"extension": "postgis",
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			templates, err := h.client.ListResourceTemplates(ctx)
+			if err != nil {
+				t.Fatalf("列出资源模板失败: %v", err)
+			}
+			if len(templates.ResourceTemplates) == 0 {
+				t.Fatal("服务器没有列出资源模板")
+			}
+			for _, template := range templates.ResourceTemplates {
+				uri := templateVarPattern.ReplaceAllStringFunc(template.URITemplate, func(match string) string {
+					if strings.HasPrefix(match, "{?") {
+						return "" // 可选的查询参数使用默认值
+					}
+					name := strings.Trim(match, "{}")
+					value, ok := vars[name]
+					if !ok {
+						t.Errorf("资源模板 %s 的变量 %s 没有测试值", template.URITemplate, name)
+					}
+					return value
+				})
+				text := h.readResource(t, uri)
+				for _, want := range resourceContains[template.URITemplate] {
+					if !strings.Contains(text, want) {
+						t.Errorf("资源 %s 中没有 %q: %s", uri, want, text)
+					}
+				}
+			}
+
+			resources, err := h.client.ListResources(ctx)
+			if err != nil {
+				t.Fatalf("列出资源失败: %v", err)
+			}
+			for _, resource := range resources.Resources {
+				h.readResource(t, resource.URI)
+			}
+		})
+	}
+}
+
+// readResource 读取资源并返回文本内容，读取失败时记录错误
+func (h *harness) readResource(t *testing.T, uri string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	result, err := h.client.ReadResource(ctx, &protocol.ReadResourceRequest{URI: uri})
+	if err != nil {
+		t.Errorf("读取资源 %s 失败: %v", uri, err)
+		return ""
+	}
+	var texts []string
+	for _, content := range result.Contents {
+		if text, ok := content.(protocol.TextResourceContents); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,81 @@
+-- 所有变体共用的夹具 Schema: 业务表、视图、时态表、函数、存储过程，以及写入工具使用的 temp Schema。
+-- 由容器的 docker-entrypoint-initdb.d 在首次启动时执行。
+
+CREATE EXTENSION IF NOT EXISTS pg_stat_statements;
+
+CREATE SCHEMA app;
+CREATE SCHEMA temp;
+
+COMMENT ON SCHEMA app IS '集成测试业务数据';
+
+CREATE TABLE app.customers (
+    id         serial PRIMARY KEY,
+    name       text NOT NULL,
+    email      text,
+    status     text NOT NULL DEFAULT 'active',
+    legacy     text,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+COMMENT ON TABLE app.customers IS '客户';
+COMMENT ON COLUMN app.customers.legacy IS '已废弃的列，始终为 NULL';
+
+CREATE TABLE app.orders (
+    id          bigserial PRIMARY KEY,
+    customer_id integer NOT NULL REFERENCES app.customers (id),
+    status      text NOT NULL,
+    amount      numeric(10, 2) NOT NULL,
+    placed_at   timestamptz NOT NULL,
+    attrs       jsonb NOT NULL DEFAULT '{}'
+);
+COMMENT ON TABLE app.orders IS '订单';
+
+-- 重复索引，供 find_duplicate_indexes 发现
+CREATE INDEX orders_customer_id_idx ON app.orders (customer_id);
+CREATE INDEX orders_customer_id_dup_idx ON app.orders (customer_id);
+
+-- 与 customers 结构相同的副本 (name 有一处差异)，供 compare_tables 比较
+CREATE TABLE app.customers_copy (LIKE app.customers INCLUDING ALL);
+
+-- 带有效期列的时态表，供 as_of_query 使用
+CREATE TABLE app.prices (
+    id         serial PRIMARY KEY,
+    product    text NOT NULL,
+    price      numeric(10, 2) NOT NULL,
+    valid_from timestamptz NOT NULL,
+    valid_to   timestamptz
+);
+
+CREATE VIEW app.customer_totals AS
+SELECT c.id, c.name, coalesce(sum(o.amount), 0) AS total
+FROM app.customers c
+LEFT JOIN app.orders o ON o.customer_id = c.id
+GROUP BY c.id, c.name;
+
+CREATE FUNCTION app.order_total(p_customer_id integer) RETURNS numeric
+LANGUAGE sql STABLE
+AS $$ SELECT coalesce(sum(amount), 0) FROM app.orders WHERE customer_id = p_customer_id $$;
+
+CREATE PROCEDURE app.touch_customer(p_id integer)
+LANGUAGE sql
+AS $$ UPDATE app.customers SET created_at = now() WHERE id = p_id $$;
+
+INSERT INTO app.customers (name, email, status) VALUES
+    ('Alice', 'alice@example.com', 'active'),
+    ('Bob', 'bob@example.com', 'active'),
+    ('Carol', 'carol@example.com', 'inactive');
+
+INSERT INTO app.customers_copy SELECT * FROM app.customers;
+UPDATE app.customers_copy SET name = 'Bobby' WHERE id = 2;
+
+INSERT INTO app.orders (customer_id, status, amount, placed_at, attrs) VALUES
+    (1, 'paid', 120.50, '2024-01-05T10:00:00Z', '{"channel": "web", "items": 2}'),
+    (1, 'shipped', 35.00, '2024-02-11T09:30:00Z', '{"channel": "app", "items": 1}'),
+    (2, 'paid', 80.00, '2024-03-02T14:15:00Z', '{"channel": "web", "items": 3}'),
+    (2, 'refunded', 15.25, '2024-03-20T08:00:00Z', '{"channel": "store"}'),
+    (3, 'paid', 250.00, '2024-04-01T12:00:00Z', '{"channel": "web", "items": 5}');
+
+INSERT INTO app.prices (product, price, valid_from, valid_to) VALUES
+    ('widget', 9.99, '2024-01-01T00:00:00Z', '2024-05-01T00:00:00Z'),
+    ('widget', 12.49, '2024-05-01T00:00:00Z', NULL);
+
+ANALYZE;
@@ -0,0 +1,15 @@
+-- pgvector 变体的夹具: 带 3 维嵌入的文档表
+CREATE EXTENSION IF NOT EXISTS vector;
+
+CREATE TABLE app.documents (
+    id        serial PRIMARY KEY,
+    title     text NOT NULL,
+    embedding vector(3) NOT NULL
+);
+
+INSERT INTO app.documents (title, embedding) VALUES
+    ('north', '[1, 0, 0]'),
+    ('east', '[0, 1, 0]'),
+    ('up', '[0, 0, 1]');
+
+ANALYZE app.documents;
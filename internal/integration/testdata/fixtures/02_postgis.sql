@@ -0,0 +1,15 @@
+-- PostGIS 变体的夹具: 带空间索引的点表
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+CREATE TABLE app.places (
+    id   serial PRIMARY KEY,
+    name text NOT NULL,
+    geom geometry(Point, 4326) NOT NULL
+);
+CREATE INDEX places_geom_idx ON app.places USING gist (geom);
+
+INSERT INTO app.places (name, geom) VALUES
+    ('Tiananmen', ST_SetSRID(ST_MakePoint(116.3975, 39.9087), 4326)),
+    ('Bund', ST_SetSRID(ST_MakePoint(121.4903, 31.2397), 4326));
+
+ANALYZE app.places;
@@ -0,0 +1,222 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// toolCase 是一次工具调用。用例按顺序执行，前面的用例可以把结果中的值记录为变量，
+// 后面的参数通过 {{name}} 引用 (内置变量: conn 为只读连接，rw 为读写连接)。
+type toolCase struct {
+	tool      string
+	args      map[string]any
+	requires  string            // 依赖的扩展，变体没有该扩展时期望调用失败
+	wantError bool              // 期望调用失败 (例如未安装 TimescaleDB)
+	contains  []string          // 结果文本应包含的内容 (可以引用变量)
+	capture   map[string]string // 变量名 -> 结果 JSON 中的点分隔路径
+	before    string            // 调用前直接在夹具数据库上执行的语句
+}
+
+// toolCases 覆盖所有内置工具、testdata 中的模板和工具包工具。新增工具时必须在这里加入用例，
+// 否则 TestTools 会失败。
+var toolCases = []toolCase{
+	{tool: "list_connections", args: map[string]any{"ping": true}, contains: []string{"{{conn}}", "{{rw}}"}},
+	{tool: "refresh_schema", args: map[string]any{"conn_id": "{{conn}}"}},
+	{tool: "refresh_schema", args: map[string]any{"conn_id": "{{rw}}", "incremental": true}},
+	{tool: "reload_extensions", args: map[string]any{}},
+	{tool: "validate_knowledge", args: map[string]any{"content": "extension: it_demo\ndescription: 集成测试\n"}},
+	{tool: "search_schema", args: map[string]any{"keyword": "orders"}, contains: []string{"orders"}},
+	{tool: "relevant_schema", args: map[string]any{"conn_id": "{{conn}}", "question": "每个客户的订单金额 orders amount"}, contains: []string{"orders"}},
+
+	{tool: "pg_query", args: map[string]any{"conn_id": "{{conn}}", "query": "SELECT id, name FROM app.customers ORDER BY id"}, contains: []string{"Alice", "Carol"}},
+	{tool: "pg_query", args: map[string]any{"conn_id": "{{conn}}", "query": "SELECT count(*) AS n FROM app.orders WHERE status = $1", "params": []any{"paid"}}, contains: []string{"3"}},
+	{tool: "pg_query", args: map[string]any{"conn_id": "{{conn}}", "query": "DELETE FROM app.orders"}, wantError: true},
+	{tool: "pg_explain", args: map[string]any{"conn_id": "{{conn}}", "query": "SELECT * FROM app.orders WHERE customer_id = 1"}, contains: []string{"orders"}},
+	{tool: "check_plan_regressions", args: map[string]any{"conn_id": "{{conn}}"}},
+	{tool: "jsonb_query", args: map[string]any{"conn_id": "{{conn}}", "schema": "app", "table": "orders", "column": "attrs", "path": []any{"channel"}, "operator": "==", "value": "store"}, contains: []string{"refunded"}},
+	{tool: "paginate_query", args: map[string]any{"conn_id": "{{conn}}", "query": "SELECT id, status FROM app.orders", "key_columns": []any{"id"}, "page_size": 2}, contains: []string{"next_cursor"}},
+	{tool: "suggest_chart", args: map[string]any{"conn_id": "{{conn}}", "query": "SELECT status, count(*) AS n FROM app.orders GROUP BY status"}},
+	{tool: "compare_tables", args: map[string]any{"conn_id": "{{conn}}", "table": "app.customers", "target_table": "app.customers_copy", "key_columns": []any{"id"}, "columns": []any{"name"}}, contains: []string{"Bobby"}},
+	{tool: "cross_db_query", args: map[string]any{"conn_ids": []any{"{{conn}}", "{{rw}}"}, "query": "SELECT count(*) AS n FROM app.customers"}, contains: []string{"{{conn}}", "{{rw}}"}},
+	{tool: "register_shard_group", args: map[string]any{"name": "it_shards", "conn_ids": []any{"{{conn}}", "{{rw}}"}, "routing_key": "customer_id"}},
+	{tool: "route_shard", args: map[string]any{"shard_group": "it_shards", "routing_key_value": "1"}},
+	{tool: "export_query", args: map[string]any{"conn_id": "{{conn}}", "query": "SELECT id, name FROM app.customers", "format": "csv"}, contains: []string{"3"}},
+	{tool: "export_data_dictionary", args: map[string]any{"schemas": []any{"app"}}, contains: []string{"customers", "orders"}},
+	{tool: "list_active_queries", args: map[string]any{"conn_id": "{{conn}}"}},
+	{tool: "pg_cancel", args: map[string]any{"query_id": "no-such-query"}, wantError: true},
+
+	{tool: "pg_listen", args: map[string]any{"conn_id": "{{conn}}", "channel": "it_events"}},
+	{tool: "pg_poll_notifications", args: map[string]any{"conn_id": "{{conn}}", "channel": "it_events", "wait_ms": 5000}, before: "NOTIFY it_events, 'hello from fixtures'", contains: []string{"hello from fixtures"}},
+	{tool: "pg_unlisten", args: map[string]any{"conn_id": "{{conn}}", "channel": "it_events"}},
+
+	{tool: "tx_begin", args: map[string]any{"conn_id": "{{conn}}"}, capture: map[string]string{"tx": "session.tx_id"}},
+	{tool: "tx_execute", args: map[string]any{"tx_id": "{{tx}}", "query": "SELECT count(*) AS n FROM app.orders"}, contains: []string{"5"}},
+	{tool: "tx_savepoint", args: map[string]any{"tx_id": "{{tx}}", "name": "sp1"}},
+	{tool: "tx_execute", args: map[string]any{"tx_id": "{{tx}}", "query": "SELECT 1 / 0"}, wantError: true},
+	{tool: "tx_rollback_to", args: map[string]any{"tx_id": "{{tx}}", "name": "sp1"}},
+	{tool: "tx_execute", args: map[string]any{"tx_id": "{{tx}}", "query": "SELECT name FROM app.customers WHERE id = 1"}, contains: []string{"Alice"}},
+	{tool: "tx_list", args: map[string]any{"conn_id": "{{conn}}"}, contains: []string{"{{tx}}"}},
+	{tool: "tx_commit", args: map[string]any{"tx_id": "{{tx}}"}},
+	{tool: "tx_begin", args: map[string]any{"conn_id": "{{rw}}", "temp_tables": true}, capture: map[string]string{"tx2": "session.tx_id"}},
+	{tool: "tx_execute", args: map[string]any{"tx_id": "{{tx2}}", "query": "CREATE TEMP TABLE it_scratch AS SELECT id FROM app.customers"}},
+	{tool: "tx_rollback", args: map[string]any{"tx_id": "{{tx2}}"}},
+
+	{tool: "register_query", args: map[string]any{
+		"name":        "it_orders_by_status",
+		"description": "按状态列出订单",
+		"sql":         "SELECT id, amount FROM app.orders WHERE status = :status ORDER BY id",
+		"params":      []any{map[string]any{"name": "status", "type": "string", "required": true}},
+	}},
+	{tool: "list_named_queries", args: map[string]any{}, contains: []string{"it_orders_by_status"}},
+	{tool: "run_named_query", args: map[string]any{"conn_id": "{{conn}}", "name": "it_orders_by_status", "params": map[string]any{"status": "refunded"}}, contains: []string{"15.25"}},
+	{tool: "run_template", args: map[string]any{"conn_id": "{{conn}}", "name": "it_customer_orders", "params": map[string]any{"customer_id": 2}}, contains: []string{"80"}},
+	{tool: "it_customer_count", args: map[string]any{"conn_id": "{{conn}}", "status": "inactive"}, contains: []string{"1"}},
+	{tool: "as_of_query", args: map[string]any{"conn_id": "{{conn}}", "schema": "app", "table": "prices", "as_of": "2024-03-01T00:00:00Z"}, contains: []string{"9.99"}},
+	{tool: "call_function", args: map[string]any{"conn_id": "{{conn}}", "schema": "app", "function": "order_total", "params": []any{1}}, contains: []string{"155.5"}},
+	{tool: "column_distinct_values", args: map[string]any{"conn_id": "{{conn}}", "schema": "app", "table": "orders", "column": "status"}, contains: []string{"paid", "shipped"}},
+
+	{tool: "save_analysis_result", args: map[string]any{"conn_id": "{{conn}}", "target_table_name_suffix": "it", "result_data": `[{"k": "a", "v": 1}]`}, wantError: true},
+	{tool: "save_analysis_result", args: map[string]any{"conn_id": "{{rw}}", "target_table_name_suffix": "it", "result_data": `[{"k": "a", "v": 1}]`}, contains: []string{"analysis_it_"}},
+	{tool: "import_csv_temp", args: map[string]any{"conn_id": "{{rw}}", "target_table_name_suffix": "it", "csv_content": "code,qty\nA,1\nB,2\n"}, contains: []string{"csv_it_"}},
+	{tool: "call_procedure", args: map[string]any{"conn_id": "{{rw}}", "schema": "app", "procedure": "touch_customer", "params": []any{1}}},
+	{tool: "load_query_log", args: map[string]any{"conn_id": "{{rw}}"}},
+	{tool: "load_schema_embeddings", args: map[string]any{"conn_id": "{{rw}}"}},
+
+	{tool: "vector_search", requires: "vector", args: map[string]any{"conn_id": "{{conn}}", "schema": "app", "table": "documents", "column": "embedding", "vector": []any{1, 0.1, 0}, "k": 2}, contains: []string{"north"}},
+	{tool: "gis_table_summary", requires: "postgis", args: map[string]any{"conn_id": "{{conn}}", "schema": "app", "table": "places"}, contains: []string{"geom", "4326"}},
+	{tool: "gis_bbox_query", requires: "postgis", args: map[string]any{"conn_id": "{{conn}}", "schema": "app", "table": "places", "column": "geom", "xmin": 116, "ymin": 39, "xmax": 117, "ymax": 40}, contains: []string{"Tiananmen"}},
+	{tool: "gis_transform", requires: "postgis", args: map[string]any{"conn_id": "{{conn}}", "geometry": "POINT(116.4 39.9)", "to_srid": 3857}, contains: []string{"3857"}},
+	{tool: "timescale_stats", args: map[string]any{"conn_id": "{{conn}}", "schema": "app", "table": "orders"}, wantError: true},
+
+	{tool: "check_orphans", args: map[string]any{"conn_id": "{{conn}}", "schema": "app", "table": "orders"}},
+	{tool: "audit_sequences", args: map[string]any{"conn_id": "{{conn}}", "schema": "app", "include_all": true}, contains: []string{"customers_id_seq"}},
+	{tool: "find_duplicate_indexes", args: map[string]any{"conn_id": "{{conn}}", "schema": "app"}, contains: []string{"orders_customer_id_dup_idx"}},
+	{tool: "audit_columns", args: map[string]any{"conn_id": "{{conn}}", "schema": "app"}, contains: []string{"legacy"}},
+	{tool: "top_queries", args: map[string]any{"conn_id": "{{conn}}"}},
+
+	{tool: "export_state", args: map[string]any{"file_name": "it-state.tar.gz"}, capture: map[string]string{"archive": "file_name"}},
+	{tool: "import_state", args: map[string]any{"file_name": "{{archive}}", "sections": []any{"plan_history"}}},
+
+	{tool: "disconnect", args: map[string]any{"conn_id": "{{rw}}"}},
+	{tool: "list_connections", args: map[string]any{}, contains: []string{"{{conn}}"}},
+	{tool: "connect", args: map[string]any{"connection_string": "{{dsn}}&sslrootcert=/etc/passwd"}, wantError: true},
+}
+
+// TestTools 在每个变体上按顺序执行 toolCases，并检查服务器列出的每个工具都有用例
+func TestTools(t *testing.T) {
+	for _, v := range selectedVariants(t) {
+		t.Run(v.name, func(t *testing.T) {
+			h := startHarness(t, v)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			listed, err := h.client.ListTools(ctx)
+			if err != nil {
+				t.Fatalf("列出工具失败: %v", err)
+			}
+			var names []string
+			for _, tool := range listed.Tools {
+				names = append(names, tool.Name)
+			}
+			covered := map[string]bool{"connect": true}
+			for _, tc := range toolCases {
+				covered[tc.tool] = true
+				if !slices.Contains(names, tc.tool) {
+					t.Errorf("用例中的工具 %s 没有被服务器注册", tc.tool)
+				}
+			}
+			for _, name := range names {
+				if !covered[name] {
+					t.Errorf("工具 %s 没有集成测试用例 (请在 toolCases 中加入)", name)
+				}
+			}
+
+			vars := map[string]string{
+				"dsn":  h.dsn,
+				"conn": h.connect(t, "pgmcp-it-ro", "read_only"),
+				"rw":   h.connect(t, "pgmcp-it-rw", "read_write"),
+			}
+			for i, tc := range toolCases {
+				if tc.before != "" {
+					h.exec(t, tc.before)
+				}
+				args, _ := expand(tc.args, vars).(map[string]any)
+				text, failed := h.callTool(t, tc.tool, args)
+				label := fmt.Sprintf("#%d %s", i, tc.tool)
+
+				wantError := tc.wantError || (tc.requires != "" && !h.has(tc.requires))
+				if wantError {
+					if !failed {
+						t.Errorf("%s: 期望调用失败，实际返回: %s", label, text)
+					}
+					continue
+				}
+				if failed {
+					t.Errorf("%s: 调用失败: %s", label, text)
+					continue
+				}
+				for _, want := range tc.contains {
+					want = expand(want, vars).(string)
+					if !strings.Contains(text, want) {
+						t.Errorf("%s: 结果中没有 %q: %s", label, want, text)
+					}
+				}
+				for name, path := range tc.capture {
+					value, ok := lookup(text, path)
+					if !ok {
+						t.Fatalf("%s: 结果中没有 %s: %s", label, path, text)
+					}
+					vars[name] = fmt.Sprint(value)
+				}
+			}
+		})
+	}
+}
+
+// TestCancelQuery 检查 list_active_queries 能看到执行中的查询，pg_cancel 能让它及时返回
+func TestCancelQuery(t *testing.T) {
+	v := selectedVariants(t)[0]
+	h := startHarness(t, v)
+	connID := h.connect(t, "pgmcp-it-cancel", "read_only")
+
+	done := make(chan string, 1)
+	started := time.Now()
+	go func() {
+		text, _ := h.callTool(t, "pg_query", map[string]any{"conn_id": connID, "query": "SELECT pg_sleep(60) AS slept"})
+		done <- text
+	}()
+
+	var queryID string
+	for deadline := time.Now().Add(20 * time.Second); queryID == "" && time.Now().Before(deadline); time.Sleep(200 * time.Millisecond) {
+		var queries []struct {
+			QueryID string `json:"query_id"`
+		}
+		text := h.mustCallTool(t, "list_active_queries", map[string]any{"conn_id": connID})
+		if err := json.Unmarshal([]byte(text), &queries); err != nil {
+			t.Fatalf("list_active_queries 返回的结果无效: %s", text)
+		}
+		if len(queries) > 0 {
+			queryID = queries[0].QueryID
+		}
+	}
+	if queryID == "" {
+		t.Fatal("list_active_queries 没有列出执行中的 pg_sleep 查询")
+	}
+	h.mustCallTool(t, "pg_cancel", map[string]any{"query_id": queryID})
+
+	select {
+	case text := <-done:
+		if elapsed := time.Since(started); elapsed > 30*time.Second {
+			t.Errorf("取消后查询过了 %s 才返回: %s", elapsed, text)
+		}
+	case <-time.After(45 * time.Second):
+		t.Fatal("取消后查询没有返回")
+	}
+}
@@ -0,0 +1,397 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// MCP 协议修订版本，按日期命名，可以直接按字符串比较先后
+const (
+	protocolVersion20241105 = "2024-11-05"
+	protocolVersion20250326 = "2025-03-26" // 新增 audio 内容块、工具注解 (annotations) 和 JSON-RPC 批量请求
+	protocolVersion20250618 = "2025-06-18" // 新增结构化工具结果 (structuredContent / outputSchema)、resource_link 内容块和 title 字段，移除批量请求
+)
+
+// supportedProtocolVersions 是兼容层可以协商的协议版本 (从新到旧)
+var supportedProtocolVersions = []string{protocolVersion20250618, protocolVersion20250326, protocolVersion20241105}
+
+// protocolCompatTransport 在 go-mcp 与客户端之间协商协议版本并转换内容编码。
+// go-mcp 只接受与 protocol.Version 完全相同的 protocolVersion，其他版本的 initialize 直接失败；
+// 兼容层把客户端请求的版本改写为 go-mcp 的版本交给它处理，在响应中返回协商后的版本
+// (客户端请求的版本受支持时返回该版本，否则按规范返回 go-mcp 的版本由客户端决定是否继续)，
+// 之后按协商的版本调整工具结果、提示和工具列表中的字段:
+//   - 旧版本客户端: 不认识的内容块 (audio、resource_link) 转换为 text，移除较新版本才有的字段；
+//   - 2025-06-18 及以后: 结果只有一个 JSON 对象文本块时同时附带 structuredContent。
+//
+// 这样升级 go-mcp 之后，只需在这里调整转换规则，旧客户端仍能正常工作。
+type protocolCompatTransport struct {
+	transport.ServerTransport
+
+	mu       sync.Mutex
+	versions map[string]string                    // sessionID -> 协商后的协议版本
+	pending  map[string]map[string]string         // sessionID -> 需要转换响应的请求 ID -> 方法
+	batches  map[string]map[string]*responseBatch // sessionID -> 批量请求中的请求 ID (见 requestIDKey) -> 所属的批量响应
+}
+
+// responseBatch 收集一个 JSON-RPC 批量请求的响应，全部到齐后作为一个数组返回
+type responseBatch struct {
+	ids       []string                   // 批量中请求的 ID (按请求顺序)
+	responses map[string]json.RawMessage // 已收到的响应
+}
+
+// wrapProtocolCompat 返回协商协议版本的传输层
+func wrapProtocolCompat(inner transport.ServerTransport) transport.ServerTransport {
+	return &protocolCompatTransport{
+		ServerTransport: inner,
+		versions:        make(map[string]string),
+		pending:         make(map[string]map[string]string),
+		batches:         make(map[string]map[string]*responseBatch),
+	}
+}
+
+// compatRequest 是兼容层需要的 JSON-RPC 请求字段
+type compatRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// negotiateVersion 返回对客户端请求版本的应答版本
+func negotiateVersion(requested string) string {
+	if slices.Contains(supportedProtocolVersions, requested) {
+		return requested
+	}
+	return protocol.Version
+}
+
+// SetReceiver 实现 transport.ServerTransport 接口。
+func (t *protocolCompatTransport) SetReceiver(receiver transport.ServerReceiver) {
+	t.ServerTransport.SetReceiver(transport.ServerReceiverF(func(ctx context.Context, sessionID string, msg []byte) error {
+		if trimmed := bytes.TrimSpace(msg); len(trimmed) > 0 && trimmed[0] == '[' {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(trimmed, &batch); err == nil {
+				t.receiveBatch(ctx, receiver, sessionID, batch)
+				return nil
+			}
+		}
+		return receiver.Receive(ctx, sessionID, t.onReceive(sessionID, msg))
+	}))
+}
+
+// receiveBatch 处理 2025-03-26 允许的 JSON-RPC 批量请求。go-mcp 不支持批量请求，拆成单条依次交给它处理，
+// 其中请求的响应由 Send 收集，全部到齐后作为一个数组返回；单条消息处理失败时在批量响应中返回 JSON-RPC 错误。
+func (t *protocolCompatTransport) receiveBatch(ctx context.Context, receiver transport.ServerReceiver, sessionID string, batch []json.RawMessage) {
+	collector := &responseBatch{responses: make(map[string]json.RawMessage)}
+	for _, item := range batch {
+		var envelope rpcEnvelope
+		if err := json.Unmarshal(item, &envelope); err == nil && envelope.Method != "" && len(envelope.ID) > 0 {
+			// 重复的 ID 只对应一个响应
+			if id := requestIDKey(envelope.ID); !slices.Contains(collector.ids, id) {
+				collector.ids = append(collector.ids, id)
+			}
+		}
+	}
+	if len(collector.ids) > 0 {
+		// go-mcp 异步处理请求，响应可能在拆分完成之前就开始发送，先登记再处理
+		t.mu.Lock()
+		if t.batches[sessionID] == nil {
+			t.batches[sessionID] = make(map[string]*responseBatch)
+		}
+		for _, id := range collector.ids {
+			t.batches[sessionID][id] = collector
+		}
+		t.mu.Unlock()
+	}
+
+	for _, item := range batch {
+		err := receiver.Receive(ctx, sessionID, t.onReceive(sessionID, item))
+		if err == nil {
+			continue
+		}
+		utils.DefaultLogger.Warn("处理批量请求中的消息失败", zap.String("sessionID", sessionID), zap.Error(err))
+		var envelope rpcEnvelope
+		if json.Unmarshal(item, &envelope) != nil || envelope.Method == "" || len(envelope.ID) == 0 {
+			continue // 通知和无法解析的消息没有响应
+		}
+		response, _ := json.Marshal(map[string]any{
+			"jsonrpc": "2.0",
+			"id":      envelope.ID,
+			"error":   map[string]any{"code": -32600, "message": err.Error()},
+		})
+		if err := t.Send(ctx, sessionID, response); err != nil {
+			utils.DefaultLogger.Warn("返回批量响应失败", zap.String("sessionID", sessionID), zap.Error(err))
+		}
+	}
+}
+
+// collectBatchResponse 把属于批量请求的响应放入批量响应中。
+// 返回的 batched 为 true 表示响应属于批量请求，此时 combined 为全部到齐后需要发送的数组 (尚未到齐时为 nil)
+func (t *protocolCompatTransport) collectBatchResponse(sessionID string, id json.RawMessage, msg []byte) (combined []byte, batched bool) {
+	key := requestIDKey(id)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	collector, ok := t.batches[sessionID][key]
+	if !ok {
+		return nil, false
+	}
+	delete(t.batches[sessionID], key)
+	collector.responses[key] = append(json.RawMessage(nil), msg...)
+	if len(collector.responses) < len(collector.ids) {
+		return nil, true
+	}
+	responses := make([]json.RawMessage, 0, len(collector.ids))
+	for _, id := range collector.ids {
+		responses = append(responses, collector.responses[id])
+	}
+	combined, err := json.Marshal(responses)
+	if err != nil {
+		utils.DefaultLogger.Warn("合并批量响应失败", zap.String("sessionID", sessionID), zap.Error(err))
+		return nil, true
+	}
+	return combined, true
+}
+
+// requestIDKey 返回请求 ID 的规范形式，使请求中的 1.0 与 go-mcp 响应中重新编码的 1 对应同一个请求
+func requestIDKey(id json.RawMessage) string {
+	var value any
+	if err := json.Unmarshal(id, &value); err != nil {
+		return string(id)
+	}
+	normalized, err := json.Marshal(value)
+	if err != nil {
+		return string(id)
+	}
+	return string(normalized)
+}
+
+// onReceive 记录需要转换响应的请求，并把 initialize 请求的协议版本改写为 go-mcp 支持的版本
+func (t *protocolCompatTransport) onReceive(sessionID string, msg []byte) []byte {
+	var request compatRequest
+	if err := json.Unmarshal(msg, &request); err != nil || request.Method == "" || len(request.ID) == 0 {
+		return msg
+	}
+	switch protocol.Method(request.Method) {
+	case protocol.Initialize, protocol.ToolsCall, protocol.ToolsList, protocol.PromptsGet:
+	default:
+		return msg
+	}
+
+	if request.Method != string(protocol.Initialize) {
+		// 协商结果与 go-mcp 的版本相同时无需转换
+		t.mu.Lock()
+		if version := t.versions[sessionID]; version != "" && version != protocol.Version {
+			t.addPending(sessionID, request)
+		}
+		t.mu.Unlock()
+		return msg
+	}
+
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		return msg
+	}
+	var requested string
+	_ = json.Unmarshal(params["protocolVersion"], &requested)
+	negotiated := negotiateVersion(requested)
+	t.mu.Lock()
+	t.versions[sessionID] = negotiated
+	if negotiated != protocol.Version {
+		t.addPending(sessionID, request)
+	}
+	t.mu.Unlock()
+	utils.DefaultLogger.Info("协商 MCP 协议版本", zap.String("sessionID", sessionID), zap.String("requested", requested), zap.String("negotiated", negotiated))
+	if requested == protocol.Version {
+		return msg
+	}
+
+	params["protocolVersion"], _ = json.Marshal(protocol.Version)
+	rewritten, err := rewriteField(msg, "params", params)
+	if err != nil {
+		utils.DefaultLogger.Warn("改写 initialize 请求的协议版本失败", zap.String("sessionID", sessionID), zap.Error(err))
+		return msg
+	}
+	return rewritten
+}
+
+// addPending 记录需要转换响应的请求，调用方需持有锁
+func (t *protocolCompatTransport) addPending(sessionID string, request compatRequest) {
+	if t.pending[sessionID] == nil {
+		t.pending[sessionID] = make(map[string]string)
+	}
+	t.pending[sessionID][string(request.ID)] = request.Method
+}
+
+// Send 实现 transport.ServerTransport 接口。
+func (t *protocolCompatTransport) Send(ctx context.Context, sessionID string, msg transport.Message) error {
+	t.mu.Lock()
+	waiting := len(t.pending[sessionID]) > 0
+	batching := len(t.batches[sessionID]) > 0
+	t.mu.Unlock()
+	var envelope rpcEnvelope
+	if (waiting || batching) && json.Unmarshal(msg, &envelope) == nil && envelope.Method == "" && len(envelope.ID) > 0 {
+		if waiting {
+			t.mu.Lock()
+			method, ok := t.pending[sessionID][string(envelope.ID)]
+			delete(t.pending[sessionID], string(envelope.ID))
+			version := t.versions[sessionID]
+			t.mu.Unlock()
+			if ok {
+				if rewritten, err := adaptResponse(msg, method, version); err == nil {
+					msg = rewritten
+				} else {
+					utils.DefaultLogger.Warn("按协议版本转换响应失败，返回原始响应", zap.String("sessionID", sessionID), zap.String("method", method), zap.Error(err))
+				}
+			}
+		}
+		if batching {
+			combined, batched := t.collectBatchResponse(sessionID, envelope.ID, msg)
+			if batched && combined == nil {
+				return nil // 等待批量请求中的其他响应
+			}
+			if batched {
+				msg = combined
+			}
+		}
+	}
+	err := t.ServerTransport.Send(ctx, sessionID, msg)
+	if errors.Is(err, pkg.ErrLackSession) {
+		t.mu.Lock()
+		delete(t.versions, sessionID)
+		delete(t.pending, sessionID)
+		delete(t.batches, sessionID)
+		t.mu.Unlock()
+	}
+	return err
+}
+
+// adaptResponse 按协商的协议版本转换一个响应
+func adaptResponse(msg []byte, method, version string) ([]byte, error) {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &response); err != nil {
+		return nil, err
+	}
+	if len(response["result"]) == 0 {
+		return msg, nil // 错误响应不转换
+	}
+	var result map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(response["result"]))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+
+	switch protocol.Method(method) {
+	case protocol.Initialize:
+		result["protocolVersion"] = version
+	case protocol.ToolsCall:
+		adaptToolResult(result, version)
+	case protocol.PromptsGet:
+		if messages, ok := result["messages"].([]any); ok {
+			for _, message := range messages {
+				if message, ok := message.(map[string]any); ok {
+					if block, ok := message["content"].(map[string]any); ok {
+						message["content"] = adaptContentBlock(block, version)
+					}
+				}
+			}
+		}
+	case protocol.ToolsList:
+		if tools, ok := result["tools"].([]any); ok {
+			for _, tool := range tools {
+				if tool, ok := tool.(map[string]any); ok {
+					adaptToolDefinition(tool, version)
+				}
+			}
+		}
+	}
+	return rewriteField(msg, "result", result)
+}
+
+// adaptToolResult 转换工具结果的内容块，并按版本移除或补充 structuredContent
+func adaptToolResult(result map[string]any, version string) {
+	content, _ := result["content"].([]any)
+	for i, block := range content {
+		if block, ok := block.(map[string]any); ok {
+			content[i] = adaptContentBlock(block, version)
+		}
+	}
+	if version < protocolVersion20250618 {
+		delete(result, "structuredContent")
+		return
+	}
+	// 规范要求返回结构化结果时同时在文本块中返回序列化的 JSON，反过来由唯一的 JSON 对象文本块生成结构化结果
+	if _, exists := result["structuredContent"]; exists || len(content) != 1 {
+		return
+	}
+	if isError, _ := result["isError"].(bool); isError {
+		return
+	}
+	block, _ := content[0].(map[string]any)
+	if block["type"] != "text" {
+		return
+	}
+	text, _ := block["text"].(string)
+	var structured map[string]json.RawMessage
+	if trimmed := bytes.TrimSpace([]byte(text)); len(trimmed) > 0 && trimmed[0] == '{' && json.Unmarshal(trimmed, &structured) == nil {
+		result["structuredContent"] = json.RawMessage(trimmed)
+	}
+}
+
+// adaptContentBlock 把客户端协议版本中不存在的内容块转换为 text
+func adaptContentBlock(block map[string]any, version string) map[string]any {
+	switch block["type"] {
+	case "audio":
+		if version < protocolVersion20250326 {
+			data, _ := block["data"].(string)
+			return map[string]any{"type": "text", "text": fmt.Sprintf("[音频: %v, base64 编码约 %d 字节，客户端协议版本不支持音频内容]", block["mimeType"], len(data))}
+		}
+	case "resource_link":
+		if version < protocolVersion20250618 {
+			text := fmt.Sprintf("资源: %v", block["uri"])
+			if name, ok := block["name"].(string); ok && name != "" {
+				text = fmt.Sprintf("资源 %s: %v", name, block["uri"])
+			}
+			if description, ok := block["description"].(string); ok && description != "" {
+				text += " (" + description + ")"
+			}
+			return map[string]any{"type": "text", "text": text}
+		}
+	}
+	return block
+}
+
+// adaptToolDefinition 移除客户端协议版本中不存在的工具定义字段
+func adaptToolDefinition(tool map[string]any, version string) {
+	if version < protocolVersion20250618 {
+		delete(tool, "outputSchema")
+		delete(tool, "title")
+	}
+	if version < protocolVersion20250326 {
+		delete(tool, "annotations")
+	}
+}
+
+// rewriteField 替换 JSON 对象中的一个顶层字段，其余字段保持原样
+func rewriteField(msg []byte, field string, value any) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &object); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	object[field] = encoded
+	return json.Marshal(object)
+}
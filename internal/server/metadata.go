@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
+	"github.com/cbc3929/pg_mcp_server/internal/buildinfo"
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// DatabaseFingerprint 标识一个已连接的数据库，不暴露主机地址和凭据
+type DatabaseFingerprint struct {
+	ConnID      string `json:"conn_id"`
+	Fingerprint string `json:"fingerprint"` // sha256(host:port/database?user=) 的前 16 位，凭据轮换后保持不变
+	AccessMode  string `json:"access_mode"`
+}
+
+// featureFlags 返回配置中各项功能是否启用，写入启动横幅和 serverInfo
+func featureFlags(cfg *config.Config) map[string]bool {
+	return map[string]bool{
+		"read_write_connections": cfg.AllowReadWriteConnections,
+		"raw_connection_strings": cfg.AllowRawConnectionStrings,
+		"write_review":           cfg.WriteReviewMode,
+		"access_policy":          len(cfg.AllowSchemas)+len(cfg.DenySchemas)+len(cfg.AllowTables)+len(cfg.DenyTables) > 0,
+		"masking":                len(cfg.MaskedColumns) > 0,
+		"audit":                  cfg.AuditEnabled,
+		"corpus":                 cfg.CorpusEnabled,
+		"query_watchdog":         cfg.QueryAlertThreshold > 0 || cfg.QueryHardLimit > 0,
+		"credential_rotation":    cfg.CredentialRotationInterval > 0,
+		"replica_health_checks":  cfg.ReplicaHealthCheckInterval > 0,
+		"idle_pool_eviction":     cfg.DBPoolIdleEvict > 0,
+		"conn_ttl":               cfg.DBConnTTL > 0,
+		"schema_embeddings":      cfg.SchemaRetrievalEmbeddings != "off",
+		"tool_packs":             cfg.ToolPacksDir != "",
+		"protocol_compat":        cfg.ProtocolCompat,
+		"state_backup":           cfg.StateBackupDir != "",
+		"select_star_rewrite":    cfg.SelectStarRewrite,
+		"schema_cache_file":      cfg.SchemaCacheDir != "",
+	}
+}
+
+// databaseFingerprints 返回已注册连接的指纹
+func databaseFingerprints(ctx context.Context, dbService databases.Service) []DatabaseFingerprint {
+	fingerprints := []DatabaseFingerprint{}
+	for _, conn := range dbService.ListConnections(ctx, false) {
+		fingerprints = append(fingerprints, DatabaseFingerprint{
+			ConnID:      conn.ConnID,
+			Fingerprint: conn.Fingerprint(),
+			AccessMode:  conn.AccessMode,
+		})
+	}
+	return fingerprints
+}
+
+// logStartupBanner 在日志中输出服务器名称、构建信息和已启用的功能
+func logStartupBanner(cfg *config.Config, name, version string) {
+	info := buildinfo.Get()
+	enabled := []string{}
+	for feature, on := range featureFlags(cfg) {
+		if on {
+			enabled = append(enabled, feature)
+		}
+	}
+	sort.Strings(enabled)
+	utils.DefaultLogger.Info("==== "+name+" "+version+" ====",
+		zap.String("commit", info.Commit),
+		zap.String("buildDate", info.BuildDate),
+		zap.String("goVersion", info.GoVersion),
+		zap.Bool("modified", info.Modified),
+		zap.String("address", cfg.ServerAddr),
+		zap.Strings("features", enabled),
+	)
+}
+
+// serverInfoTransport 在 initialize 响应的 serverInfo 中附带部署元数据 (提交、构建时间、功能开关、数据库指纹)。
+// go-mcp 的 protocol.Implementation 只有 name 和 version 字段，因此在传输层改写响应；
+// 多出的字段不影响按规范解析 serverInfo 的客户端。
+type serverInfoTransport struct {
+	transport.ServerTransport
+	cfg       *config.Config
+	dbService databases.Service
+
+	mu      sync.Mutex
+	pending map[string]string // sessionID -> 尚未响应的 initialize 请求 ID
+}
+
+// wrapServerInfo 返回附带部署元数据的传输层
+func wrapServerInfo(inner transport.ServerTransport, cfg *config.Config, dbService databases.Service) transport.ServerTransport {
+	return &serverInfoTransport{ServerTransport: inner, cfg: cfg, dbService: dbService, pending: make(map[string]string)}
+}
+
+// rpcEnvelope 是识别 initialize 请求和响应所需的 JSON-RPC 字段
+type rpcEnvelope struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+// SetReceiver 实现 transport.ServerTransport 接口。
+func (t *serverInfoTransport) SetReceiver(receiver transport.ServerReceiver) {
+	t.ServerTransport.SetReceiver(transport.ServerReceiverF(func(ctx context.Context, sessionID string, msg []byte) error {
+		var envelope rpcEnvelope
+		if err := json.Unmarshal(msg, &envelope); err == nil && envelope.Method == string(protocol.Initialize) && len(envelope.ID) > 0 {
+			t.mu.Lock()
+			t.pending[sessionID] = string(envelope.ID)
+			t.mu.Unlock()
+		}
+		return receiver.Receive(ctx, sessionID, msg)
+	}))
+}
+
+// Send 实现 transport.ServerTransport 接口。
+func (t *serverInfoTransport) Send(ctx context.Context, sessionID string, msg transport.Message) error {
+	t.mu.Lock()
+	requestID, waiting := t.pending[sessionID]
+	t.mu.Unlock()
+	if waiting {
+		var envelope rpcEnvelope
+		if err := json.Unmarshal(msg, &envelope); err == nil && envelope.Method == "" && string(envelope.ID) == requestID {
+			t.mu.Lock()
+			delete(t.pending, sessionID)
+			t.mu.Unlock()
+			if rewritten, err := t.withMetadata(ctx, msg); err == nil {
+				msg = rewritten
+			} else {
+				utils.DefaultLogger.Warn("写入 serverInfo 元数据失败，返回原始 initialize 响应", zap.String("sessionID", sessionID), zap.Error(err))
+			}
+		}
+	}
+	return t.ServerTransport.Send(ctx, sessionID, msg)
+}
+
+// withMetadata 在 initialize 响应的 result.serverInfo 中加入部署元数据
+func (t *serverInfoTransport) withMetadata(ctx context.Context, msg []byte) ([]byte, error) {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &response); err != nil {
+		return nil, err
+	}
+	if len(response["result"]) == 0 {
+		return msg, nil // initialize 失败时的错误响应不改写
+	}
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(response["result"], &result); err != nil {
+		return nil, err
+	}
+	var serverInfo map[string]any
+	if err := json.Unmarshal(result["serverInfo"], &serverInfo); err != nil {
+		return nil, err
+	}
+	info := buildinfo.Get()
+	if info.Commit != "" {
+		serverInfo["commit"] = info.Commit
+	}
+	if info.BuildDate != "" {
+		serverInfo["build_date"] = info.BuildDate
+	}
+	serverInfo["go_version"] = info.GoVersion
+	serverInfo["features"] = featureFlags(t.cfg)
+	serverInfo["databases"] = databaseFingerprints(ctx, t.dbService)
+
+	var err error
+	if result["serverInfo"], err = json.Marshal(serverInfo); err != nil {
+		return nil, err
+	}
+	if response["result"], err = json.Marshal(result); err != nil {
+		return nil, err
+	}
+	return json.Marshal(response)
+}
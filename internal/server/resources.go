@@ -0,0 +1,327 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ThinkInAIXYZ/go-mcp/pkg"
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	mcpserver "github.com/ThinkInAIXYZ/go-mcp/server"
+	"github.com/ThinkInAIXYZ/go-mcp/transport"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"go.uber.org/zap"
+)
+
+// schemaCursorPrefix 是 Schema 对象分页游标的前缀，游标的其余部分为下一页的起始位置
+const schemaCursorPrefix = "schema-objects:"
+
+// schemaResourceTransport 在 resources/list 响应中追加 Schema 缓存中每个 Schema 和表对应的具体资源
+// (Schema 列表、表列表、列定义)，并在 Schema 缓存刷新后通知客户端。
+// 这些 URI 由已注册的资源模板处理读取，若通过 RegisterResource 逐个注册，
+// 每次注册和注销都会向所有会话发送一次 list_changed，大库刷新时会产生成千上万条通知，
+// 因此在传输层改写 list 响应，刷新后只发送一次 list_changed。
+type schemaResourceTransport struct {
+	transport.ServerTransport
+	schemaManager schemas.Manager
+	pageSize      int
+
+	mu       sync.Mutex
+	pending  map[string]map[string]string // sessionID -> 尚未响应的 resources/list 请求 ID -> 游标
+	sessions map[string]bool              // 收到过消息的会话，用于发送 list_changed
+}
+
+// wrapSchemaResources 返回在 resources/list 中列出 Schema 对象的传输层
+func wrapSchemaResources(inner transport.ServerTransport, schemaManager schemas.Manager, pageSize int) *schemaResourceTransport {
+	return &schemaResourceTransport{
+		ServerTransport: inner,
+		schemaManager:   schemaManager,
+		pageSize:        pageSize,
+		pending:         make(map[string]map[string]string),
+		sessions:        make(map[string]bool),
+	}
+}
+
+// listRequest 是识别 resources/list 请求所需的 JSON-RPC 字段
+type listRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params struct {
+		Cursor string `json:"cursor"`
+	} `json:"params"`
+}
+
+// SetReceiver 实现 transport.ServerTransport 接口。
+func (t *schemaResourceTransport) SetReceiver(receiver transport.ServerReceiver) {
+	t.ServerTransport.SetReceiver(transport.ServerReceiverF(func(ctx context.Context, sessionID string, msg []byte) error {
+		var request listRequest
+		if err := json.Unmarshal(msg, &request); err == nil && request.Method != "" {
+			t.mu.Lock()
+			t.sessions[sessionID] = true
+			if request.Method == string(protocol.ResourcesList) && len(request.ID) > 0 {
+				if t.pending[sessionID] == nil {
+					t.pending[sessionID] = make(map[string]string)
+				}
+				t.pending[sessionID][string(request.ID)] = request.Params.Cursor
+			}
+			t.mu.Unlock()
+		}
+		return receiver.Receive(ctx, sessionID, msg)
+	}))
+}
+
+// Send 实现 transport.ServerTransport 接口。
+func (t *schemaResourceTransport) Send(ctx context.Context, sessionID string, msg transport.Message) error {
+	t.mu.Lock()
+	waiting := len(t.pending[sessionID]) > 0
+	t.mu.Unlock()
+	if waiting {
+		var envelope rpcEnvelope
+		if err := json.Unmarshal(msg, &envelope); err == nil && envelope.Method == "" {
+			t.mu.Lock()
+			cursor, ok := t.pending[sessionID][string(envelope.ID)]
+			delete(t.pending[sessionID], string(envelope.ID))
+			t.mu.Unlock()
+			if ok {
+				if rewritten, err := t.withSchemaResources(msg, cursor); err == nil {
+					msg = rewritten
+				} else {
+					utils.DefaultLogger.Warn("列出 Schema 资源失败，返回原始 resources/list 响应", zap.String("sessionID", sessionID), zap.Error(err))
+				}
+			}
+		}
+	}
+	err := t.ServerTransport.Send(ctx, sessionID, msg)
+	if errors.Is(err, pkg.ErrLackSession) {
+		t.forget(sessionID)
+	}
+	return err
+}
+
+// forget 移除已断开的会话
+func (t *schemaResourceTransport) forget(sessionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.sessions, sessionID)
+	delete(t.pending, sessionID)
+}
+
+// withSchemaResources 在 resources/list 响应中加入一页 Schema 对象资源。
+// 第一页 (无游标) 保留服务器级资源并追加 Schema 对象；后续页只包含 Schema 对象。
+func (t *schemaResourceTransport) withSchemaResources(msg []byte, cursor string) ([]byte, error) {
+	offset := 0
+	if cursor != "" {
+		value, found := strings.CutPrefix(cursor, schemaCursorPrefix)
+		parsed, err := strconv.Atoi(value)
+		if !found || err != nil || parsed < 0 {
+			return nil, fmt.Errorf("无效的分页游标: %s", cursor)
+		}
+		offset = parsed
+	}
+
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &response); err != nil {
+		return nil, err
+	}
+	if len(response["result"]) == 0 {
+		return msg, nil // 错误响应不改写
+	}
+	var result protocol.ListResourcesResult
+	if err := json.Unmarshal(response["result"], &result); err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		result.Resources = nil
+	}
+
+	all := t.schemaResources()
+	if offset < len(all) {
+		end := min(offset+t.pageSize, len(all))
+		result.Resources = append(result.Resources, all[offset:end]...)
+		if end < len(all) {
+			result.NextCursor = schemaCursorPrefix + strconv.Itoa(end)
+		}
+	}
+	if result.Resources == nil {
+		result.Resources = []protocol.Resource{}
+	}
+
+	var err error
+	if response["result"], err = json.Marshal(result); err != nil {
+		return nil, err
+	}
+	return json.Marshal(response)
+}
+
+// schemaResources 返回当前缓存对应的全部 Schema 对象资源
+func (t *schemaResourceTransport) schemaResources() []protocol.Resource {
+	connID := t.schemaManager.CacheInfo().ConnID
+	dbInfo, found := t.schemaManager.GetDatabaseInfo()
+	if t.pageSize <= 0 || connID == "" || !found {
+		return nil
+	}
+	return listSchemaResources(connID, dbInfo)
+}
+
+// listSchemaResources 为每个 Schema 和表生成具体资源，顺序与缓存一致
+func listSchemaResources(connID string, dbInfo *schemas.DatabaseInfo) []protocol.Resource {
+	resources := []protocol.Resource{{
+		URI:         schemaListURI(connID),
+		Name:        connID + " schemas",
+		Description: "连接 " + connID + " 的 Schema 列表",
+		MimeType:    "application/json",
+	}}
+	for _, s := range dbInfo.Schemas {
+		description := "Schema " + s.Name + " 下的表"
+		if s.Description != "" {
+			description += ": " + s.Description
+		}
+		resources = append(resources, protocol.Resource{
+			URI:         tableListURI(connID, s.Name),
+			Name:        s.Name,
+			Description: description,
+			MimeType:    "application/json",
+		})
+		for _, table := range s.Tables {
+			description := "表 " + s.Name + "." + table.Name + " 的列定义"
+			if table.Description != "" {
+				description += ": " + table.Description
+			}
+			resources = append(resources, protocol.Resource{
+				URI:         tableURI(connID, s.Name, table.Name, "columns"),
+				Name:        s.Name + "." + table.Name,
+				Description: description,
+				MimeType:    "application/json",
+			})
+		}
+	}
+	return resources
+}
+
+func schemaListURI(connID string) string {
+	return "pgmcp://" + connID + "/schemas"
+}
+
+func tableListURI(connID, schemaName string) string {
+	return "pgmcp://" + connID + "/schemas/" + url.PathEscape(schemaName) + "/tables"
+}
+
+func schemaURI(connID, schemaName, object string) string {
+	return "pgmcp://" + connID + "/schemas/" + url.PathEscape(schemaName) + "/" + object
+}
+
+func tableURI(connID, schemaName, tableName, object string) string {
+	return tableListURI(connID, schemaName) + "/" + url.PathEscape(tableName) + "/" + object
+}
+
+// tableObjects 是由缓存中的表定义决定内容的表级资源
+var tableObjects = []string{"columns", "indexes", "constraints", "triggers", "ddl"}
+
+// schemaResourceFingerprints 返回缓存中每个可订阅的 Schema 资源 URI 及其内容指纹，用于比较刷新前后的变化。
+// 表列表包含行数估计，因此 ANALYZE 后也会通知；表级资源的指纹不含行数。
+func schemaResourceFingerprints(connID string, dbInfo *schemas.DatabaseInfo) map[string][32]byte {
+	fingerprints := make(map[string][32]byte)
+	if connID == "" || dbInfo == nil {
+		return fingerprints
+	}
+	fingerprint := func(v any) [32]byte {
+		data, _ := json.Marshal(v)
+		return sha256.Sum256(data)
+	}
+
+	type named struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		RowCount    int64  `json:"row_count,omitempty"`
+	}
+	schemaList := make([]named, 0, len(dbInfo.Schemas))
+	for _, s := range dbInfo.Schemas {
+		schemaList = append(schemaList, named{Name: s.Name, Description: s.Description})
+		tableList := make([]named, 0, len(s.Tables))
+		for _, table := range s.Tables {
+			tableList = append(tableList, named{Name: table.Name, Description: table.Description, RowCount: table.RowCount})
+			definition := table
+			definition.RowCount = 0
+			sum := fingerprint(definition)
+			for _, object := range tableObjects {
+				fingerprints[tableURI(connID, s.Name, table.Name, object)] = sum
+			}
+		}
+		fingerprints[tableListURI(connID, s.Name)] = fingerprint(tableList)
+		fingerprints[schemaURI(connID, s.Name, "types")] = fingerprint(s.Types)
+	}
+	fingerprints[schemaListURI(connID)] = fingerprint(schemaList)
+	return fingerprints
+}
+
+// changedSchemaResources 返回刷新后内容发生变化 (包括新增和消失) 的资源 URI，以及列出的资源集合是否变化
+func changedSchemaResources(refresh schemas.SchemaRefresh) (updated []string, listChanged bool) {
+	previous := schemaResourceFingerprints(refresh.PreviousConnID, refresh.Previous)
+	current := schemaResourceFingerprints(refresh.ConnID, refresh.Current)
+	for uri, sum := range current {
+		old, ok := previous[uri]
+		if !ok || old != sum {
+			updated = append(updated, uri)
+		}
+		// 列出的资源只有 Schema 列表、表列表和列定义，其余表级资源的增减与列定义一致
+		if !ok && (uri == schemaListURI(refresh.ConnID) || strings.HasSuffix(uri, "/tables") || strings.HasSuffix(uri, "/columns")) {
+			listChanged = true
+		}
+	}
+	for uri := range previous {
+		if _, ok := current[uri]; !ok {
+			updated = append(updated, uri)
+			listChanged = true
+		}
+	}
+	sort.Strings(updated)
+	return updated, listChanged
+}
+
+// onSchemaRefresh 向订阅了变化资源的会话发送 resources/updated，资源集合变化时向所有会话发送 list_changed
+func (t *schemaResourceTransport) onSchemaRefresh(ctx context.Context, mcpServer *mcpserver.Server, refresh schemas.SchemaRefresh) {
+	updated, listChanged := changedSchemaResources(refresh)
+	failed := 0
+	for _, uri := range updated {
+		if err := mcpServer.SendNotification4ResourcesUpdated(ctx, protocol.NewResourceUpdatedNotification(uri)); err != nil {
+			failed++
+		}
+	}
+	if listChanged && t.pageSize > 0 {
+		t.notifyListChanged(ctx)
+	}
+	utils.DefaultLogger.Info("Schema 缓存已刷新，已通知资源订阅者",
+		zap.String("connID", refresh.ConnID),
+		zap.Int("changedResources", len(updated)),
+		zap.Int("failedNotifications", failed),
+		zap.Bool("listChanged", listChanged),
+	)
+}
+
+// notifyListChanged 向所有会话发送 notifications/resources/list_changed
+func (t *schemaResourceTransport) notifyListChanged(ctx context.Context) {
+	message, err := json.Marshal(protocol.NewJSONRPCNotification(protocol.NotificationResourcesListChanged, protocol.NewResourceListChangedNotification()))
+	if err != nil {
+		utils.DefaultLogger.Warn("序列化 list_changed 通知失败", zap.Error(err))
+		return
+	}
+	t.mu.Lock()
+	sessionIDs := make([]string, 0, len(t.sessions))
+	for sessionID := range t.sessions {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	t.mu.Unlock()
+	for _, sessionID := range sessionIDs {
+		if err := t.Send(ctx, sessionID, message); err != nil {
+			utils.DefaultLogger.Warn("发送资源列表变更通知失败", zap.String("sessionID", sessionID), zap.Error(err))
+		}
+	}
+}
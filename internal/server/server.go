@@ -2,19 +2,29 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
 	// 引入日志
 
 	"github.com/ThinkInAIXYZ/go-mcp/protocol"
 	mcpserver "github.com/ThinkInAIXYZ/go-mcp/server" // 使用别名避免与包名冲突
 	"github.com/ThinkInAIXYZ/go-mcp/transport"
+	"github.com/cbc3929/pg_mcp_server/internal/audit"
+	"github.com/cbc3929/pg_mcp_server/internal/buildinfo"
 	"github.com/cbc3929/pg_mcp_server/internal/config"
 	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
 	"github.com/cbc3929/pg_mcp_server/internal/core/extensions"
+	"github.com/cbc3929/pg_mcp_server/internal/core/requests"
 	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+	"github.com/cbc3929/pg_mcp_server/internal/core/sessions"
+	"github.com/cbc3929/pg_mcp_server/internal/corpus"
 	"github.com/cbc3929/pg_mcp_server/internal/handlers"
+	"github.com/cbc3929/pg_mcp_server/internal/handlers/tools"
 	"github.com/cbc3929/pg_mcp_server/internal/utils"
+	"github.com/cbc3929/pg_mcp_server/pkg/plugin"
 	"go.uber.org/zap"
 )
 
@@ -25,50 +35,129 @@ type MCPServer struct {
 	dbService     databases.Service
 	schemaManager schemas.Manager
 	extManager    extensions.Manager
+	requests      *requests.Tracker // 正在执行的工具调用
+	corpus        *corpus.Recorder  // 训练语料 (未开启时为 nil)
+	reviewAPI     *tools.ReviewAPI  // 操作员审核写入的 HTTP 接口 (未开启时为 nil)
+}
+
+// Option 是 NewMCPServer 的可选配置
+type Option func(*options)
+
+type options struct {
+	transport  transport.ServerTransport                                   // 自定义传输层，为 nil 时使用监听 cfg.ServerAddr 的 SSE 传输层
+	middleware []func(transport.ServerTransport) transport.ServerTransport // 依次包装传输层
+	plugins    []plugin.Plugin                                             // 除全局注册的插件外额外注册的插件
+	name       string
+	version    string
+}
+
+// WithTransport 使用自定义的传输层 (例如 stdio 或嵌入到已有 HTTP 服务中的 SSE)
+func WithTransport(t transport.ServerTransport) Option {
+	return func(o *options) { o.transport = t }
+}
+
+// WithTransportMiddleware 在内置的会话统计和审计包装之外再包装传输层，先添加的在内层
+func WithTransportMiddleware(middleware ...func(transport.ServerTransport) transport.ServerTransport) Option {
+	return func(o *options) { o.middleware = append(o.middleware, middleware...) }
+}
+
+// WithPlugins 额外注册插件 (不需要通过 plugin.Register 全局注册)
+func WithPlugins(plugins ...plugin.Plugin) Option {
+	return func(o *options) { o.plugins = append(o.plugins, plugins...) }
+}
+
+// WithServerInfo 设置在 initialize 响应中返回的服务器名称和版本
+func WithServerInfo(name, version string) Option {
+	return func(o *options) { o.name, o.version = name, version }
 }
 
 // NewMCPServer 创建、配置并返回一个新的 MCPServer 实例。
 // 它初始化 MCP 服务器，设置传输方式，并注册所有的 Handlers。
+// 出错时只返回错误而不退出进程，由调用方决定如何处理 (服务器可能嵌入在其他程序中)。
 func NewMCPServer(
 	cfg *config.Config,
 	dbService databases.Service,
 	schemaManager schemas.Manager,
 	extManager extensions.Manager,
+	auditor audit.Recorder,
+	opts ...Option,
 ) (*MCPServer, error) {
 	utils.DefaultLogger.Info("正在创建 MCP 服务器实例...")
+	o := options{name: cfg.ServerName, version: buildinfo.Get().DisplayVersion()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if cfg.StartupBanner {
+		logStartupBanner(cfg, o.name, o.version)
+	}
+
+	transportLayer := o.transport
+	if transportLayer == nil {
+		var err error
+		transportLayer, err = transport.NewSSEServerTransport(cfg.ServerAddr)
+		if err != nil {
+			utils.DefaultLogger.Error("创建 SSE 传输层失败", zap.String("address", cfg.ServerAddr), zap.Error(err))
+			return nil, fmt.Errorf("创建 SSE 传输层失败: %w", err)
+		}
+		utils.DefaultLogger.Info("SSE 传输层已创建", zap.String("configuredAddress", cfg.ServerAddr))
+	}
+	for _, wrap := range o.middleware {
+		transportLayer = wrap(transportLayer)
+	}
+	// 协商 go-mcp 之外的协议版本，按客户端版本转换内容编码
+	if cfg.ProtocolCompat {
+		transportLayer = wrapProtocolCompat(transportLayer)
+	}
+	// 在 initialize 响应的 serverInfo 中附带提交、功能开关和数据库指纹
+	if cfg.ServerInfoMeta {
+		transportLayer = wrapServerInfo(transportLayer, cfg, dbService)
+	}
+	// 在 resources/list 中列出缓存的 Schema 和表，缓存刷新后通知客户端
+	schemaResources := wrapSchemaResources(transportLayer, schemaManager, cfg.SchemaResourcePageSize)
+	transportLayer = schemaResources
 
-	// 注意：这里假设 transport.NewSSEServerTransport 接受 net.Listener
-	// 如果它只接受地址字符串，则直接传入 cfg.ServerAddr
-	// 需要根据 go-mcp 的实际 API 调整
-	// 假设它接受 Listener:
-	transportLayer, err := transport.NewSSEServerTransport(cfg.ServerAddr)
+	// 包装传输层以统计每个 MCP 会话的活动 (供 pgmcp://server/sessions 资源使用)
+	sessionTracker := sessions.NewTracker()
+	transportLayer = sessionTracker.WrapTransport(transportLayer)
+	// 每次工具调用 (带客户端身份) 写入一条审计记录
+	transportLayer = audit.WrapTransport(auditor, transportLayer)
+	// 带 SQL 的工具调用同时记录为训练语料 (未开启时为 nil)
+	corpusRecorder, err := corpus.New(cfg, schemaManager)
 	if err != nil {
-		utils.DefaultLogger.Fatal("创建 SSE 传输层失败", zap.String("address", cfg.ServerAddr), zap.Error(err))
-		return nil, fmt.Errorf("创建 SSE 传输层失败: %w", err)
+		utils.DefaultLogger.Error("初始化训练语料记录失败", zap.Error(err))
+		return nil, fmt.Errorf("初始化训练语料记录失败: %w", err)
 	}
-	utils.DefaultLogger.Info("SSE 传输层已创建", zap.String("configuredAddress", cfg.ServerAddr))
-	// 或者，如果它接受地址字符串:
-	// transportLayer, err := transport.NewSSEServerTransport(cfg.ServerAddr)
+	transportLayer = corpusRecorder.WrapTransport(transportLayer)
+	// 为每次工具调用创建请求 Context (客户端取消或服务器关闭时中断查询)，需要在审计外层
+	requestTracker := requests.NewTracker(context.Background())
+	transportLayer = requestTracker.WrapTransport(transportLayer)
 
 	// 2. 创建 MCP 服务器实例
 	//    可以传递服务器信息等选项
 	mcpServerInstance, err := mcpserver.NewServer(transportLayer,
 		mcpserver.WithServerInfo(protocol.Implementation{ // 使用 mcpserver.Implementation
-			Name:    "pg-mcp-server-go",
-			Version: "0.1.0", // 或者从配置/版本文件读取
+			Name:    o.name,
+			Version: o.version,
 		}),
 		// 这里可以添加其他 WithXXX 选项，例如日志记录器等，如果库支持的话
 	)
 	if err != nil {
-		utils.DefaultLogger.Fatal("创建 MCP 服务器失败", zap.Error(err))
+		utils.DefaultLogger.Error("创建 MCP 服务器失败", zap.Error(err))
 		return nil, fmt.Errorf("创建 MCP 服务器失败: %w", err)
 	}
 	utils.DefaultLogger.Info("MCP 服务器核心实例已创建")
+	schemaManager.AddRefreshListener(func(refresh schemas.SchemaRefresh) {
+		ctx, cancel := context.WithTimeout(requestTracker.Root(), 30*time.Second)
+		defer cancel()
+		schemaResources.onSchemaRefresh(ctx, mcpServerInstance, refresh)
+	})
 
 	// 3. 注册 Handlers
 	//    将核心服务和管理器传递给注册函数
-	if err := handlers.RegisterHandlers(mcpServerInstance, dbService, schemaManager, extManager); err != nil {
-		utils.DefaultLogger.Fatal("注册 MCP Handlers 失败", zap.Error(err))
+	//    审核队列的审核接口不在 MCP 中，由 MCPServer 单独监听
+	reviewQueue := tools.NewReviewQueue(cfg)
+	if err := handlers.RegisterHandlers(mcpServerInstance, cfg, dbService, schemaManager, extManager, sessionTracker, requestTracker, reviewQueue, o.plugins...); err != nil {
+		utils.DefaultLogger.Error("注册 MCP Handlers 失败", zap.Error(err))
 		return nil, fmt.Errorf("注册 MCP Handlers 失败: %w", err)
 	}
 
@@ -79,17 +168,30 @@ func NewMCPServer(
 		dbService:     dbService,
 		schemaManager: schemaManager, // 保留引用，虽然注册后主要由 Handler 使用
 		extManager:    extManager,
+		requests:      requestTracker,
+		corpus:        corpusRecorder,
+		reviewAPI:     tools.NewReviewAPI(reviewQueue, cfg),
 	}
 
 	utils.DefaultLogger.Info("MCP 服务器初始化完成，准备运行。")
 	return server, nil
 }
 
+// cancelGracePeriod 是关闭时取消剩余查询后等待 Handler 返回和传输层关闭的时间
+const cancelGracePeriod = 5 * time.Second
+
 // Run 启动 MCP 服务器并开始监听连接。
-// 这是一个阻塞操作，直到服务器停止或发生错误。
+// 这是一个阻塞操作，直到服务器停止或发生错误。Stop 导致的正常退出返回 nil。
 func (s *MCPServer) Run() error {
 	utils.DefaultLogger.Info("启动 MCP 服务器运行...", zap.String("address", s.config.ServerAddr))
+	if err := s.reviewAPI.Start(); err != nil {
+		utils.DefaultLogger.Error("启动写入审核接口失败", zap.String("address", s.config.WriteReviewAddr), zap.Error(err))
+		return fmt.Errorf("启动写入审核接口失败: %w", err)
+	}
 	err := s.mcpServer.Run() // 调用 go-mcp 的 Run 方法
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
 	if err != nil {
 		utils.DefaultLogger.Error("MCP 服务器运行出错", zap.Error(err))
 	} else {
@@ -98,29 +200,48 @@ func (s *MCPServer) Run() error {
 	return err // 将 Run 的错误返回给调用者 (main)
 }
 
-// Stop 优雅地停止 MCP 服务器 (如果 go-mcp 库提供了 Stop 方法)。
-// 注意: 需要检查 go-mcp/server.Server 是否有 Stop 或 Shutdown 方法。
-// 如果没有，可能需要通过取消传递给 Run 的 Context 来停止。
-// 这是一个示例，实际实现依赖于库。
+// Stop 优雅地停止 MCP 服务器:
+//  1. 停止监听，不再接受新的 SSE 会话和工具调用；
+//  2. 在 ctx 的截止时间之前等待正在执行的工具调用完成；
+//  3. 超时后取消剩余的调用 (正在执行的查询会被 PostgreSQL 取消)，再短暂等待它们返回；
+//  4. 关闭传输层、写入审核接口、所有数据库连接池和训练语料文件。
 func (s *MCPServer) Stop(ctx context.Context) error {
-	utils.DefaultLogger.Info("正在请求停止 MCP 服务器...")
-	// 假设 mcpServer 有一个 Stop 方法
-	// if hasattr(s.mcpServer, "Stop"):
-	//     return s.mcpServer.Stop(ctx)
-	// else:
-	//     utils.DefaultLogger.Warn("MCP 服务器实例没有提供 Stop 方法。")
-	//     return nil
-
-	// 如果没有 Stop 方法，可能需要在 Run 之前设置可取消的 Context
-	// 并在这里调用 cancel() 函数。Run 方法需要支持 Context 取消。
-	// 目前 go-mcp 的 Run 可能是阻塞的，不一定支持 context 取消。
-
-	// 暂时假设没有 Stop 方法或无法直接停止 Run
-	utils.DefaultLogger.Warn("go-mcp 服务器可能没有提供优雅停止的方法，将直接退出。")
-	// 可以在这里添加关闭数据库连接池的逻辑，作为最后的清理
-	if err := s.dbService.CloseAll(ctx); err != nil {
-		utils.DefaultLogger.Error("关闭数据库连接池时出错", zap.Error(err))
+	utils.DefaultLogger.Info("正在停止 MCP 服务器...", zap.Int("inFlight", s.requests.InFlight()))
+
+	// go-mcp 的 Shutdown 会关闭 HTTP 监听并等待它自己记录的进行中请求，然后关闭所有 SSE 会话
+	shutdownDone := make(chan error, 1)
+	go func() {
+		shutdownDone <- s.mcpServer.Shutdown(ctx)
+	}()
+
+	if err := s.requests.Drain(ctx); err != nil {
+		utils.DefaultLogger.Warn("等待进行中的工具调用超时，取消剩余的调用", zap.Int("inFlight", s.requests.InFlight()))
+	} else {
+		utils.DefaultLogger.Info("所有进行中的工具调用已完成")
+	}
+	s.requests.CancelAll()
+
+	graceCtx, graceCancel := context.WithTimeout(context.Background(), cancelGracePeriod)
+	defer graceCancel()
+	if err := s.requests.Drain(graceCtx); err != nil {
+		utils.DefaultLogger.Error("取消后仍有工具调用未返回", zap.Int("inFlight", s.requests.InFlight()))
+	}
+	var shutdownErr error
+	select {
+	case shutdownErr = <-shutdownDone:
+	case <-graceCtx.Done():
+		shutdownErr = fmt.Errorf("关闭传输层超时")
+	}
+	if shutdownErr != nil {
+		utils.DefaultLogger.Error("关闭传输层失败", zap.Error(shutdownErr))
 	}
 
-	return nil // 或者返回一个表示无法停止的错误
+	s.reviewAPI.Stop(graceCtx)
+	if err := s.dbService.CloseAll(graceCtx); err != nil {
+		utils.DefaultLogger.Error("关闭数据库连接池时出错", zap.Error(err))
+	}
+	if err := s.corpus.Close(); err != nil {
+		utils.DefaultLogger.Error("关闭训练语料文件时出错", zap.Error(err))
+	}
+	return shutdownErr
 }
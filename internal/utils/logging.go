@@ -2,6 +2,9 @@ package utils
 
 import (
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -11,46 +14,95 @@ import (
 // 它由 SetupLogger 函数配置。
 var DefaultLogger *zap.Logger
 
-// SetupLogger 初始化 zap 日志记录器。
-// 它根据 debugMode 标志配置日志级别、编码器和输出。
-// 在调试模式下，级别为 Debug，输出更易读，并包含调用者信息。
-// 在发布模式下，级别为 Info，输出为 JSON 格式，性能更高。
-func SetupLogger(debugMode bool) {
-	var zapConfig zap.Config
+// 日志编码格式
+const (
+	LogFormatConsole = "console" // 易读的文本格式
+	LogFormatJSON    = "json"    // 每行一个 JSON 对象，便于日志系统采集
+)
+
+// logFile 是当前写入的日志文件，重新配置 logger 时关闭
+var logFile *RotatingFile
+
+// LogConfig 是日志记录器的配置 (由 config.Config.LogConfig 生成)。
+type LogConfig struct {
+	Level       string // 日志级别: debug, info, warn, error, dpanic, panic, fatal
+	Format      string // 编码格式: console 或 json
+	File        string // 日志文件路径，为空时输出到标准输出
+	MaxSizeMB   int    // 单个日志文件的最大大小 (MB)，超过后轮转，<= 0 表示不轮转
+	MaxBackups  int    // 保留的旧日志文件数量
+	MaxAgeDays  int    // 旧日志文件的最长保留天数，<= 0 表示不按时间清理
+	Development bool   // 开发模式: 记录调用者信息，DPanic 级别会触发 panic
+}
+
+// DefaultLogConfig 返回加载配置之前使用的日志配置: 输出到标准输出的 console 格式，debug 级别。
+func DefaultLogConfig() LogConfig {
+	return LogConfig{Level: "debug", Format: LogFormatConsole, Development: true}
+}
+
+// SetupLogger 根据配置初始化 zap 日志记录器并替换 DefaultLogger。
+// console 格式输出到终端时使用彩色级别和 ISO8601 时间；json 格式使用 "ts" 毫秒时间戳。
+// 配置无效 (级别、格式错误或日志文件无法打开) 时返回错误，此时 DefaultLogger 保持不变。
+func SetupLogger(cfg LogConfig) error {
 	var level zapcore.Level
+	if cfg.Level == "" {
+		level = zapcore.InfoLevel
+	} else if err := level.UnmarshalText([]byte(strings.ToLower(cfg.Level))); err != nil {
+		return fmt.Errorf("无效的日志级别 '%s': %w", cfg.Level, err)
+	}
 
-	if debugMode {
-		// 使用 zap 提供的开发环境预设配置，易于阅读
-		zapConfig = zap.NewDevelopmentConfig()
-		level = zapcore.DebugLevel
-		zapConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder // 彩色级别显示
-		zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder        // 标准时间格式
-		zapConfig.DisableStacktrace = true                                     // 开发模式下通常不需要完整堆栈跟踪，除非是Error级别以上
-		zapConfig.EncoderConfig.CallerKey = "caller"                           // 显示调用者信息
-		zapConfig.EncoderConfig.NameKey = "logger"
-		zapConfig.EncoderConfig.MessageKey = "msg"
+	// 设置输出: 日志文件 (按大小轮转) 或标准输出
+	var output zapcore.WriteSyncer
+	var file *RotatingFile
+	if cfg.File != "" {
+		var err error
+		maxAge := time.Duration(cfg.MaxAgeDays) * 24 * time.Hour
+		file, err = OpenRotatingFile(cfg.File, int64(cfg.MaxSizeMB)*1024*1024, cfg.MaxBackups, maxAge)
+		if err != nil {
+			return fmt.Errorf("打开日志文件失败: %w", err)
+		}
+		output = file
 	} else {
-		// 使用 zap 提供的生产环境预设配置，性能优先，JSON 格式
-		zapConfig = zap.NewProductionConfig()
-		level = zapcore.InfoLevel
-		zapConfig.EncoderConfig.TimeKey = "ts"                              // 时间戳字段名
-		zapConfig.EncoderConfig.EncodeTime = zapcore.EpochMillisTimeEncoder // 使用毫秒时间戳
-		zapConfig.EncoderConfig.CallerKey = ""                              // 生产环境通常不记录调用者，以提高性能
+		output = zapcore.Lock(os.Stdout)
 	}
 
-	// 设置日志级别
-	zapConfig.Level = zap.NewAtomicLevelAt(level)
+	var encoder zapcore.Encoder
+	switch strings.ToLower(cfg.Format) {
+	case LogFormatConsole, "":
+		encoderConfig := zap.NewDevelopmentEncoderConfig()
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder // 标准时间格式
+		if file == nil {
+			encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder // 终端中彩色级别显示，文件中不写入颜色控制符
+		}
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	case LogFormatJSON:
+		encoderConfig := zap.NewProductionEncoderConfig()
+		encoderConfig.TimeKey = "ts"                              // 时间戳字段名
+		encoderConfig.EncodeTime = zapcore.EpochMillisTimeEncoder // 使用毫秒时间戳
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	default:
+		if file != nil {
+			_ = file.Close()
+		}
+		return fmt.Errorf("无效的日志格式 '%s' (可选 console, json)", cfg.Format)
+	}
 
-	// 设置输出到标准输出
-	zapConfig.OutputPaths = []string{"stdout"}
-	zapConfig.ErrorOutputPaths = []string{"stderr"}
+	options := []zap.Option{
+		zap.ErrorOutput(zapcore.Lock(os.Stderr)),
+		zap.AddStacktrace(zapcore.DPanicLevel), // 通常不需要完整堆栈跟踪，除非是 DPanic 级别以上
+	}
+	if cfg.Development {
+		// 开发模式下显示调用者信息；生产环境通常不记录调用者，以提高性能
+		options = append(options, zap.AddCaller(), zap.Development())
+	}
 
-	// 构建 logger
-	var err error
-	DefaultLogger, err = zapConfig.Build()
-	if err != nil {
-		// 如果构建 logger 失败，这是一个严重问题，直接 panic
-		panic(fmt.Sprintf("无法初始化 zap 日志记录器: %v", err))
+	// 构建 logger，替换旧的 logger 之前先刷新它的缓冲
+	logger := zap.New(zapcore.NewCore(encoder, output, zap.NewAtomicLevelAt(level)), options...)
+	previousFile := logFile
+	SyncLogger()
+	DefaultLogger = logger
+	logFile = file
+	if previousFile != nil {
+		_ = previousFile.Close()
 	}
 
 	// 可选：替换 zap 的全局 logger，这样可以在任何地方通过 zap.L() 或 zap.S() 访问
@@ -58,9 +110,20 @@ func SetupLogger(debugMode bool) {
 	// zap.S().Info("全局 SugaredLogger 已替换") // 示例：使用全局 SugaredLogger
 
 	DefaultLogger.Info("Zap 日志记录器已初始化",
-		zap.Bool("debugMode", debugMode),
 		zap.String("logLevel", level.String()),
+		zap.String("format", encoderFormat(cfg.Format)),
+		zap.String("file", cfg.File),
+		zap.Bool("development", cfg.Development),
 	)
+	return nil
+}
+
+// encoderFormat 返回实际使用的编码格式名称
+func encoderFormat(format string) string {
+	if format == "" {
+		return LogFormatConsole
+	}
+	return strings.ToLower(format)
 }
 
 // GetLogger 返回配置好的 zap 日志记录器实例。
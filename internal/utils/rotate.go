@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RotatingFile 是按大小轮转的追加写文件 (日志和审计记录使用):
+// 写入会使文件超过 MaxBytes 时，先把 app.log -> app.log.1 -> app.log.2 ... 依次后移，
+// 最多保留 MaxBackups 个旧文件，修改时间早于 MaxAge 的旧文件也会被删除。
+// 单次写入不会被拆分到两个文件中。
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64         // <= 0 表示不轮转
+	maxBackups int           // 0 表示轮转时直接丢弃旧内容
+	maxAge     time.Duration // <= 0 表示不按时间清理
+	file       *os.File
+	size       int64
+}
+
+// OpenRotatingFile 打开 (必要时创建目录和文件) 一个轮转文件。
+func OpenRotatingFile(path string, maxBytes int64, maxBackups int, maxAge time.Duration) (*RotatingFile, error) {
+	if path == "" {
+		return nil, fmt.Errorf("文件路径不能为空")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("创建目录 '%s' 失败: %w", filepath.Dir(path), err)
+	}
+	f := &RotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups, maxAge: maxAge}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open 以追加模式打开当前文件，调用方需持有锁 (或在初始化时调用)
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("打开文件 '%s' 失败: %w", f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("读取文件 '%s' 信息失败: %w", f.path, err)
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write 实现 io.Writer 接口。轮转失败时仍尽量写入当前文件，避免丢失日志。
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			// 这里不能使用 DefaultLogger: 日志本身可能就写在这个文件中
+			fmt.Fprintf(os.Stderr, "轮转文件 '%s' 失败: %v\n", f.path, err)
+			if f.file == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate 关闭当前文件并依次重命名旧文件，然后打开新的空文件，调用方需持有锁
+func (f *RotatingFile) rotate() error {
+	_ = f.file.Close()
+	f.file = nil
+	if f.maxBackups > 0 {
+		_ = os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups))
+		for i := f.maxBackups - 1; i >= 1; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		}
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return f.reopen(fmt.Errorf("重命名文件失败: %w", err))
+		}
+		f.removeExpiredBackups()
+	} else if err := os.Remove(f.path); err != nil {
+		return f.reopen(fmt.Errorf("删除文件失败: %w", err))
+	}
+	return f.open()
+}
+
+// removeExpiredBackups 删除修改时间早于 maxAge 的旧文件
+func (f *RotatingFile) removeExpiredBackups() {
+	if f.maxAge <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-f.maxAge)
+	for i := 1; i <= f.maxBackups; i++ {
+		backup := fmt.Sprintf("%s.%d", f.path, i)
+		if info, err := os.Stat(backup); err == nil && info.ModTime().Before(cutoff) {
+			_ = os.Remove(backup)
+		}
+	}
+}
+
+// reopen 在轮转失败后继续写入原文件，返回轮转的错误
+func (f *RotatingFile) reopen(rotateErr error) error {
+	if err := f.open(); err != nil {
+		return fmt.Errorf("%v; %w", rotateErr, err)
+	}
+	return rotateErr
+}
+
+// Sync 将文件内容刷到磁盘 (实现 zapcore.WriteSyncer)
+func (f *RotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// Close 关闭文件，之后的写入返回 os.ErrClosed
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,145 @@
+package sqlsafe
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// fuzzSeeds 是标识符和字面量模糊测试共用的种子: 引号、反斜杠、NUL、多字节字符、保留字和超长输入
+var fuzzSeeds = []string{
+	"", "orders", "Orders", "order items", `a"b`, `""`, `"`, `'`, `''`, `\`, `\'`, `a\'b`, `E'x'`,
+	"select", "user", "a.b", `"a"."b"`, "a\x00b", "\xff\xfe", "订单", "naïve", "$1", "a$b", "1abc",
+	"-- comment", "/* c */", "$$x$$", strings.Repeat("x", MaxIdentifierLength+1),
+}
+
+// unquoteLiteral 按 PostgreSQL 的规则 (standard_conforming_strings = on) 还原 QuoteLiteral 的输出，
+// 独立于被测实现，格式不符时返回 false
+func unquoteLiteral(quoted string) (string, bool) {
+	escaped := strings.HasPrefix(quoted, "E'")
+	body, ok := strings.CutPrefix(quoted, "'")
+	if escaped {
+		body, ok = strings.CutPrefix(quoted, "E'")
+	}
+	if !ok || !strings.HasSuffix(body, "'") || len(body) == 0 {
+		return "", false
+	}
+	body = body[:len(body)-1]
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '\'':
+			if i+1 >= len(body) || body[i+1] != '\'' {
+				return "", false // 未转义的引号会提前结束字面量
+			}
+			i++
+		case body[i] == '\\' && escaped:
+			if i+1 >= len(body) {
+				return "", false
+			}
+			i++
+		}
+		b.WriteByte(body[i])
+	}
+	return b.String(), true
+}
+
+// FuzzQuoteIdentifier 检查引用后的标识符总能被 ParseQualifiedName 原样解析回来
+func FuzzQuoteIdentifier(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, identifier string) {
+		quoted, err := QuoteIdentifier(identifier)
+		if err != nil {
+			if ValidateIdentifier(identifier) == nil {
+				t.Fatalf("QuoteIdentifier(%q) 拒绝了合法的标识符: %v", identifier, err)
+			}
+			return
+		}
+		if !strings.HasPrefix(quoted, `"`) || !strings.HasSuffix(quoted, `"`) || strings.Count(quoted, `"`)%2 != 0 {
+			t.Fatalf("QuoteIdentifier(%q) = %q，引号不成对", identifier, quoted)
+		}
+		parsed, err := ParseQualifiedName(quoted)
+		if err != nil || parsed.Schema != "" || parsed.Name != identifier {
+			t.Fatalf("ParseQualifiedName(%q) = %+v, %v，期望 %q", quoted, parsed, err, identifier)
+		}
+
+		simple, err := Identifier(identifier)
+		if err != nil {
+			t.Fatalf("Identifier(%q) 失败: %v", identifier, err)
+		}
+		if simple != quoted && (IsReserved(identifier) || strings.ToLower(identifier) != identifier) {
+			t.Fatalf("Identifier(%q) = %q，保留字和含大写字母的标识符必须加引号", identifier, simple)
+		}
+		if parsed, err := ParseQualifiedName(simple); err != nil || parsed.Name != identifier {
+			t.Fatalf("ParseQualifiedName(%q) = %+v, %v，期望 %q", simple, parsed, err, identifier)
+		}
+	})
+}
+
+// FuzzQuoteQualified 检查 schema.name 引用后解析回原来的两部分，名称中的点不会被当作分隔符
+func FuzzQuoteQualified(f *testing.F) {
+	f.Add("public", "orders")
+	f.Add("a.b", "c")
+	f.Add(`s"`, `."t`)
+	f.Add("Sales", "Order Items")
+	f.Fuzz(func(t *testing.T, schema, name string) {
+		quoted, err := QuoteQualified(schema, name)
+		if err != nil {
+			return
+		}
+		parsed, err := ParseQualifiedName(quoted)
+		if err != nil || parsed.Schema != schema || parsed.Name != name {
+			t.Fatalf("ParseQualifiedName(%q) = %+v, %v，期望 %q.%q", quoted, parsed, err, schema, name)
+		}
+		if parsed.Quoted() != quoted {
+			t.Fatalf("Quoted() = %q，期望 %q", parsed.Quoted(), quoted)
+		}
+	})
+}
+
+// FuzzQuoteLiteral 检查字面量按 PostgreSQL 的规则还原后与输入相同，且不会提前结束
+func FuzzQuoteLiteral(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, literal string) {
+		quoted, err := QuoteLiteral(literal)
+		if err != nil {
+			if !strings.ContainsRune(literal, 0) && utf8.ValidString(literal) {
+				t.Fatalf("QuoteLiteral(%q) 拒绝了合法的字符串: %v", literal, err)
+			}
+			return
+		}
+		if strings.HasPrefix(quoted, "E'") != strings.Contains(literal, `\`) {
+			t.Fatalf("QuoteLiteral(%q) = %q，只有含反斜杠时才使用 E'...'", literal, quoted)
+		}
+		unquoted, ok := unquoteLiteral(quoted)
+		if !ok || unquoted != literal {
+			t.Fatalf("QuoteLiteral(%q) = %q，还原为 %q (ok=%v)", literal, quoted, unquoted, ok)
+		}
+	})
+}
+
+// FuzzParseQualifiedName 检查解析任意输入不会 panic，解析成功的名称重新引用后得到相同的结果
+func FuzzParseQualifiedName(f *testing.F) {
+	for _, seed := range append(fuzzSeeds, `Public.Orders`, `"Sales"."Order Items"`, `a.b.c`, `"a""b".c`, `"unterminated`, `a."`, `.a`) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		parsed, err := ParseQualifiedName(input)
+		if err != nil {
+			return
+		}
+		if ValidateIdentifier(parsed.Name) != nil || (parsed.Schema != "" && ValidateIdentifier(parsed.Schema) != nil) {
+			t.Fatalf("ParseQualifiedName(%q) = %+v，包含无效的标识符", input, parsed)
+		}
+		for _, text := range []string{parsed.Quoted(), parsed.String()} {
+			again, err := ParseQualifiedName(text)
+			if err != nil || again != parsed {
+				t.Fatalf("ParseQualifiedName(%q) = %+v, %v，期望 %+v", text, again, err, parsed)
+			}
+		}
+	})
+}
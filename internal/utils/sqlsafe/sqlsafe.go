@@ -0,0 +1,207 @@
+// Package sqlsafe 提供拼接 SQL 时使用的标识符校验与引用、字面量转义和限定名解析。
+//
+// 值应尽量通过 $N 参数传递；只有表名、列名等无法参数化的部分才需要经过这里处理。
+package sqlsafe
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxIdentifierLength 是 PostgreSQL 标识符的最大字节数 (NAMEDATALEN - 1)，超出部分会被服务端静默截断
+const MaxIdentifierLength = 63
+
+// simpleIdentifier 匹配不需要引号的标识符: 小写字母或下划线开头，只包含小写字母、数字、下划线和 $
+var simpleIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// nameIdentifier 匹配服务端生成的对象名中允许由用户提供的部分 (例如表名后缀): 只包含字母、数字和下划线
+var nameIdentifier = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ValidateIdentifier 检查标识符能否安全地 (加引号后) 用于 SQL: 非空、不超过 63 字节、是合法的 UTF-8 且不含 NUL 字符。
+func ValidateIdentifier(identifier string) error {
+	switch {
+	case identifier == "":
+		return fmt.Errorf("标识符不能为空")
+	case len(identifier) > MaxIdentifierLength:
+		return fmt.Errorf("标识符 '%s' 超过 %d 字节", identifier, MaxIdentifierLength)
+	case !utf8.ValidString(identifier):
+		return fmt.Errorf("标识符包含无效的 UTF-8 字符")
+	case strings.ContainsRune(identifier, 0):
+		return fmt.Errorf("标识符不能包含 NUL 字符")
+	}
+	return nil
+}
+
+// ValidateNamePart 检查由用户提供、将拼接进服务端生成的对象名的部分 (例如 temp 表名后缀):
+// 只允许字母、数字和下划线，长度不超过 maxLength 字节。
+func ValidateNamePart(part string, maxLength int) error {
+	if part == "" {
+		return fmt.Errorf("名称不能为空")
+	}
+	if len(part) > maxLength {
+		return fmt.Errorf("名称 '%s' 超过 %d 个字符", part, maxLength)
+	}
+	if !nameIdentifier.MatchString(part) {
+		return fmt.Errorf("名称 '%s' 只能包含字母、数字和下划线", part)
+	}
+	return nil
+}
+
+// QuoteIdentifier 校验并用双引号引用标识符 (内部的双引号写两次)。
+func QuoteIdentifier(identifier string) (string, error) {
+	if err := ValidateIdentifier(identifier); err != nil {
+		return "", err
+	}
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`, nil
+}
+
+// QuoteIdentifiers 校验并引用一组标识符 (例如列名列表)，任一标识符无效时返回错误。
+func QuoteIdentifiers(identifiers []string) ([]string, error) {
+	quoted := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		q, err := QuoteIdentifier(identifier)
+		if err != nil {
+			return nil, fmt.Errorf("无效的标识符 '%s': %w", identifier, err)
+		}
+		quoted[i] = q
+	}
+	return quoted, nil
+}
+
+// QuoteQualified 校验并引用 schema.name 形式的限定名。
+func QuoteQualified(schema, name string) (string, error) {
+	quotedSchema, err := QuoteIdentifier(schema)
+	if err != nil {
+		return "", fmt.Errorf("无效的 Schema 名称: %w", err)
+	}
+	quotedName, err := QuoteIdentifier(name)
+	if err != nil {
+		return "", fmt.Errorf("无效的对象名称: %w", err)
+	}
+	return quotedSchema + "." + quotedName, nil
+}
+
+// Identifier 返回标识符在 SQL 中的最简写法: 不需要引号的小写标识符原样返回，
+// 含大写字母、特殊字符或与保留字相同的标识符加引号。用于生成便于阅读的 SQL (例如 DDL)。
+func Identifier(identifier string) (string, error) {
+	if err := ValidateIdentifier(identifier); err != nil {
+		return "", err
+	}
+	if simpleIdentifier.MatchString(identifier) && !reservedWords[identifier] {
+		return identifier, nil
+	}
+	return QuoteIdentifier(identifier)
+}
+
+// QuoteLiteral 把字符串转换为 SQL 字面量。不含反斜杠时使用标准写法 '...'，
+// 含反斜杠时使用 E'...' 并转义反斜杠，两种写法与 standard_conforming_strings 的设置无关。
+// PostgreSQL 的文本不能包含 NUL 字符，此时返回错误。
+func QuoteLiteral(literal string) (string, error) {
+	if strings.ContainsRune(literal, 0) {
+		return "", fmt.Errorf("字符串字面量不能包含 NUL 字符")
+	}
+	if !utf8.ValidString(literal) {
+		return "", fmt.Errorf("字符串字面量包含无效的 UTF-8 字符")
+	}
+	escaped := strings.ReplaceAll(literal, `'`, `''`)
+	if !strings.Contains(escaped, `\`) {
+		return "'" + escaped + "'", nil
+	}
+	return `E'` + strings.ReplaceAll(escaped, `\`, `\\`) + `'`, nil
+}
+
+// QualifiedName 是解析后的 [schema.]name
+type QualifiedName struct {
+	Schema string // 未指定 Schema 时为空
+	Name   string
+}
+
+// String 返回限定名的 SQL 写法 (按需加引号)
+func (q QualifiedName) String() string {
+	name, _ := Identifier(q.Name)
+	if q.Schema == "" {
+		return name
+	}
+	schema, _ := Identifier(q.Schema)
+	return schema + "." + name
+}
+
+// Quoted 返回所有部分都加引号的 SQL 写法
+func (q QualifiedName) Quoted() string {
+	name, _ := QuoteIdentifier(q.Name)
+	if q.Schema == "" {
+		return name
+	}
+	schema, _ := QuoteIdentifier(q.Schema)
+	return schema + "." + name
+}
+
+// ParseQualifiedName 按 PostgreSQL 的规则解析 [schema.]name:
+// 未加引号的部分转换为小写且只能包含字母、数字、下划线和 $，加引号的部分原样保留 ("" 表示一个双引号)。
+// 例如 Public.Orders -> public.orders，"Sales"."Order Items" -> Sales.Order Items。
+func ParseQualifiedName(input string) (QualifiedName, error) {
+	var parts []string
+	rest := strings.TrimSpace(input)
+	for {
+		part, remaining, err := parseIdentifierPart(rest)
+		if err != nil {
+			return QualifiedName{}, fmt.Errorf("无效的名称 '%s': %w", input, err)
+		}
+		parts = append(parts, part)
+		if remaining == "" {
+			break
+		}
+		if remaining[0] != '.' {
+			return QualifiedName{}, fmt.Errorf("无效的名称 '%s': 标识符后出现了意外的字符 '%s'", input, remaining)
+		}
+		rest = remaining[1:]
+	}
+	switch len(parts) {
+	case 1:
+		return QualifiedName{Name: parts[0]}, nil
+	case 2:
+		return QualifiedName{Schema: parts[0], Name: parts[1]}, nil
+	}
+	return QualifiedName{}, fmt.Errorf("无效的名称 '%s': 最多只能包含 schema 和名称两部分", input)
+}
+
+// parseIdentifierPart 解析开头的一个标识符，返回标识符和剩余部分
+func parseIdentifierPart(input string) (string, string, error) {
+	if input == "" {
+		return "", "", fmt.Errorf("标识符不能为空")
+	}
+	if input[0] == '"' {
+		var b strings.Builder
+		for i := 1; i < len(input); i++ {
+			if input[i] != '"' {
+				b.WriteByte(input[i])
+				continue
+			}
+			if i+1 < len(input) && input[i+1] == '"' {
+				b.WriteByte('"')
+				i++
+				continue
+			}
+			identifier := b.String()
+			if err := ValidateIdentifier(identifier); err != nil {
+				return "", "", err
+			}
+			return identifier, input[i+1:], nil
+		}
+		return "", "", fmt.Errorf("缺少结束的双引号")
+	}
+	end := strings.IndexByte(input, '.')
+	if end < 0 {
+		end = len(input)
+	}
+	identifier := strings.ToLower(input[:end])
+	if !simpleIdentifier.MatchString(identifier) {
+		return "", "", fmt.Errorf("未加引号的标识符 '%s' 只能包含字母、数字、下划线和 $，且不能以数字开头", input[:end])
+	}
+	if err := ValidateIdentifier(identifier); err != nil {
+		return "", "", err
+	}
+	return identifier, input[end:], nil
+}
@@ -0,0 +1,246 @@
+package sqlsafe
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		identifier string
+		want       string
+		wantErr    bool
+	}{
+		{name: "简单标识符", identifier: "orders", want: `"orders"`},
+		{name: "大写字母保留原样", identifier: "Orders", want: `"Orders"`},
+		{name: "空格", identifier: "order items", want: `"order items"`},
+		{name: "内嵌双引号", identifier: `a"b`, want: `"a""b"`},
+		{name: "只有双引号", identifier: `""`, want: `""""""`},
+		{name: "试图闭合引号并追加 SQL", identifier: `x"; DROP TABLE t; --`, want: `"x""; DROP TABLE t; --"`},
+		{name: "单引号不需要转义", identifier: `it's`, want: `"it's"`},
+		{name: "反斜杠不需要转义", identifier: `a\b`, want: `"a\b"`},
+		{name: "反斜杠在引号前", identifier: `a\"`, want: `"a\"""`},
+		{name: "点不是分隔符", identifier: "a.b", want: `"a.b"`},
+		{name: "保留字", identifier: "select", want: `"select"`},
+		{name: "中文", identifier: "订单", want: `"订单"`},
+		{name: "组合字符", identifier: "naïve", want: `"naïve"`},
+		{name: "emoji", identifier: "📦", want: `"📦"`},
+		{name: "恰好 63 字节", identifier: strings.Repeat("a", 63), want: `"` + strings.Repeat("a", 63) + `"`},
+		{name: "超过 63 字节", identifier: strings.Repeat("a", 64), wantErr: true},
+		{name: "多字节字符按字节计算长度", identifier: strings.Repeat("订", 22), wantErr: true},
+		{name: "空", identifier: "", wantErr: true},
+		{name: "NUL", identifier: "a\x00b", wantErr: true},
+		{name: "无效 UTF-8", identifier: "a\xffb", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := QuoteIdentifier(tt.identifier)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("QuoteIdentifier(%q) error = %v, wantErr %v", tt.identifier, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("QuoteIdentifier(%q) = %q, want %q", tt.identifier, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		identifier string
+		want       string
+		wantErr    bool
+	}{
+		{name: "小写标识符不加引号", identifier: "orders", want: "orders"},
+		{name: "下划线开头", identifier: "_tmp", want: "_tmp"},
+		{name: "包含数字和 $", identifier: "t1$x", want: "t1$x"},
+		{name: "大写字母", identifier: "Orders", want: `"Orders"`},
+		{name: "数字开头", identifier: "1abc", want: `"1abc"`},
+		{name: "$ 开头", identifier: "$1", want: `"$1"`},
+		{name: "保留字 select", identifier: "select", want: `"select"`},
+		{name: "保留字 user", identifier: "user", want: `"user"`},
+		{name: "类型名 integer", identifier: "integer", want: `"integer"`},
+		{name: "非保留关键字", identifier: "name", want: "name"},
+		{name: "保留字的大写形式", identifier: "SELECT", want: `"SELECT"`},
+		{name: "内嵌双引号", identifier: `a"b`, want: `"a""b"`},
+		{name: "反斜杠", identifier: `a\b`, want: `"a\b"`},
+		{name: "中文", identifier: "订单", want: `"订单"`},
+		{name: "NUL", identifier: "\x00", wantErr: true},
+		{name: "空", identifier: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Identifier(tt.identifier)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Identifier(%q) error = %v, wantErr %v", tt.identifier, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Identifier(%q) = %q, want %q", tt.identifier, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteIdentifiers(t *testing.T) {
+	got, err := QuoteIdentifiers([]string{"id", `a"b`})
+	if err != nil || strings.Join(got, ", ") != `"id", "a""b"` {
+		t.Errorf("QuoteIdentifiers = %q, %v", got, err)
+	}
+	if _, err := QuoteIdentifiers([]string{"id", ""}); err == nil {
+		t.Error("QuoteIdentifiers 应拒绝空标识符")
+	}
+}
+
+func TestQuoteQualified(t *testing.T) {
+	tests := []struct {
+		name         string
+		schema, item string
+		want         string
+		wantErr      string
+	}{
+		{name: "普通限定名", schema: "public", item: "orders", want: `"public"."orders"`},
+		{name: "两部分都有引号和点", schema: `s"x`, item: "a.b", want: `"s""x"."a.b"`},
+		{name: "保留字", schema: "user", item: "table", want: `"user"."table"`},
+		{name: "空 Schema", schema: "", item: "orders", wantErr: "Schema"},
+		{name: "对象名含 NUL", schema: "public", item: "a\x00", wantErr: "对象名称"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := QuoteQualified(tt.schema, tt.item)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("QuoteQualified(%q, %q) error = %v, want error containing %q", tt.schema, tt.item, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("QuoteQualified(%q, %q) = %q, %v, want %q", tt.schema, tt.item, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	tests := []struct {
+		name    string
+		literal string
+		want    string
+		wantErr bool
+	}{
+		{name: "普通字符串", literal: "hello", want: "'hello'"},
+		{name: "空字符串", literal: "", want: "''"},
+		{name: "内嵌单引号", literal: "it's", want: "'it''s'"},
+		{name: "只有单引号", literal: "'", want: "''''"},
+		{name: "试图闭合引号并追加 SQL", literal: "x'; DROP TABLE t; --", want: "'x''; DROP TABLE t; --'"},
+		{name: "双引号不需要转义", literal: `say "hi"`, want: `'say "hi"'`},
+		{name: "反斜杠使用 E 字符串", literal: `C:\tmp`, want: `E'C:\\tmp'`},
+		{name: "反斜杠在单引号前", literal: `\'`, want: `E'\\'''`},
+		{name: "结尾的反斜杠", literal: `a\`, want: `E'a\\'`},
+		{name: "连续反斜杠", literal: `\\`, want: `E'\\\\'`},
+		{name: "换行和制表符原样保留", literal: "a\nb\tc", want: "'a\nb\tc'"},
+		{name: "中文", literal: "订单", want: "'订单'"},
+		{name: "emoji", literal: "📦'", want: "'📦'''"},
+		{name: "美元引用标记不受影响", literal: "$$x$$", want: "'$$x$$'"},
+		{name: "NUL", literal: "a\x00b", wantErr: true},
+		{name: "无效 UTF-8", literal: "\xc3\x28", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := QuoteLiteral(tt.literal)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("QuoteLiteral(%q) error = %v, wantErr %v", tt.literal, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("QuoteLiteral(%q) = %q, want %q", tt.literal, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNamePart(t *testing.T) {
+	tests := []struct {
+		name    string
+		part    string
+		wantErr bool
+	}{
+		{name: "字母数字下划线", part: "report_2024"},
+		{name: "大写字母", part: "Report"},
+		{name: "空", part: "", wantErr: true},
+		{name: "超长", part: strings.Repeat("a", 41), wantErr: true},
+		{name: "双引号", part: `a"b`, wantErr: true},
+		{name: "反斜杠", part: `a\b`, wantErr: true},
+		{name: "空格", part: "a b", wantErr: true},
+		{name: "NUL", part: "a\x00", wantErr: true},
+		{name: "中文", part: "订单", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateNamePart(tt.part, 40); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateNamePart(%q) error = %v, wantErr %v", tt.part, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseQualifiedName(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    QualifiedName
+		wantErr bool
+	}{
+		{name: "未限定", input: "orders", want: QualifiedName{Name: "orders"}},
+		{name: "未加引号转换为小写", input: "Public.Orders", want: QualifiedName{Schema: "public", Name: "orders"}},
+		{name: "加引号原样保留", input: `"Sales"."Order Items"`, want: QualifiedName{Schema: "Sales", Name: "Order Items"}},
+		{name: "引号内的点", input: `"a.b".c`, want: QualifiedName{Schema: "a.b", Name: "c"}},
+		{name: "转义的双引号", input: `"a""b"`, want: QualifiedName{Name: `a"b`}},
+		{name: "引号内的反斜杠", input: `"a\b"`, want: QualifiedName{Name: `a\b`}},
+		{name: "保留字需要引号才原样保留", input: `"select"`, want: QualifiedName{Name: "select"}},
+		{name: "中文", input: `"订单"."金额"`, want: QualifiedName{Schema: "订单", Name: "金额"}},
+		{name: "首尾空白", input: "  public.orders ", want: QualifiedName{Schema: "public", Name: "orders"}},
+		{name: "三部分", input: "a.b.c", wantErr: true},
+		{name: "缺少结束引号", input: `"orders`, wantErr: true},
+		{name: "引号后的多余字符", input: `"a"b`, wantErr: true},
+		{name: "未加引号的特殊字符", input: "orders;drop", wantErr: true},
+		{name: "未加引号的数字开头", input: "1orders", wantErr: true},
+		{name: "空的部分", input: "public.", wantErr: true},
+		{name: "空引号", input: `""`, wantErr: true},
+		{name: "引号内的 NUL", input: "\"a\x00\"", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQualifiedName(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQualifiedName(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseQualifiedName(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQualifiedNameString(t *testing.T) {
+	tests := []struct {
+		name       string
+		qualified  QualifiedName
+		wantString string
+		wantQuoted string
+	}{
+		{name: "简单名称", qualified: QualifiedName{Schema: "public", Name: "orders"}, wantString: "public.orders", wantQuoted: `"public"."orders"`},
+		{name: "保留字和大写", qualified: QualifiedName{Schema: "Sales", Name: "user"}, wantString: `"Sales"."user"`, wantQuoted: `"Sales"."user"`},
+		{name: "未限定", qualified: QualifiedName{Name: `a"b`}, wantString: `"a""b"`, wantQuoted: `"a""b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.qualified.String(); got != tt.wantString {
+				t.Errorf("String() = %q, want %q", got, tt.wantString)
+			}
+			if got := tt.qualified.Quoted(); got != tt.wantQuoted {
+				t.Errorf("Quoted() = %q, want %q", got, tt.wantQuoted)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+// Package plugin 是编译进服务器的自定义工具、资源和提示的注册入口。
+//
+// 插件在自己的包中实现 Plugin 接口并在 init 中调用 Register，
+// 然后在 cmd/server/plugins.go 中以空导入的方式编译进服务器 (与 database/sql 驱动的用法相同):
+//
+//	package myplugin
+//
+//	func init() { plugin.Register(myPlugin{}) }
+//
+//	type myPlugin struct{}
+//
+//	func (myPlugin) Name() string { return "my_plugin" }
+//
+//	func (myPlugin) Register(host *plugin.Host) error {
+//		return host.RegisterTool(&protocol.Tool{Name: "my_tool", ...}, func(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+//			// 使用 host.DB 执行查询、host.Schemas 读取 Schema 元数据
+//			...
+//		})
+//	}
+//
+// 插件在所有内置工具和工具包注册之后注册，工具名与已注册的工具重复时启动失败。
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ThinkInAIXYZ/go-mcp/protocol"
+	mcpserver "github.com/ThinkInAIXYZ/go-mcp/server"
+	"github.com/cbc3929/pg_mcp_server/internal/config"
+	"github.com/cbc3929/pg_mcp_server/internal/core/databases"
+	"github.com/cbc3929/pg_mcp_server/internal/core/extensions"
+	"github.com/cbc3929/pg_mcp_server/internal/core/requests"
+	"github.com/cbc3929/pg_mcp_server/internal/core/schemas"
+)
+
+// 以下别名让模块外的插件可以使用 internal 包中定义的服务类型
+type (
+	Config           = config.Config
+	DatabaseService  = databases.Service
+	QueryResult      = databases.QueryResult
+	SchemaManager    = schemas.Manager
+	ExtensionManager = extensions.Manager
+)
+
+// Plugin 是一个编译进服务器的插件
+type Plugin interface {
+	// Name 返回插件名称，在所有插件中唯一
+	Name() string
+	// Register 通过 host 注册插件提供的工具、资源和提示，返回错误时服务器启动失败
+	Register(host *Host) error
+}
+
+var (
+	pluginsMu sync.Mutex
+	plugins   = make(map[string]Plugin)
+)
+
+// Register 注册一个插件，通常在插件包的 init 中调用。
+// 插件为 nil 或名称重复时 panic (属于编程错误)。
+func Register(p Plugin) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if p == nil {
+		panic("plugin: Register 的插件为 nil")
+	}
+	name := p.Name()
+	if _, exists := plugins[name]; exists {
+		panic(fmt.Sprintf("plugin: 插件 '%s' 重复注册", name))
+	}
+	plugins[name] = p
+}
+
+// Plugins 返回所有已注册的插件 (按名称排序)
+func Plugins() []Plugin {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	list := make([]Plugin, 0, len(plugins))
+	for _, p := range plugins {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// ToolHandler 处理工具调用，ctx 在客户端取消请求或服务器关闭时被取消
+type ToolHandler func(ctx context.Context, req *protocol.CallToolRequest) (*protocol.CallToolResult, error)
+
+// ToolRegistry 记录已注册的工具名，用于检查插件的工具是否与内置工具重名
+type ToolRegistry interface {
+	RegisterTool(tool *protocol.Tool, handler mcpserver.ToolHandlerFunc)
+	Has(name string) bool
+}
+
+// Host 是插件可以使用的服务器依赖和注册方法
+type Host struct {
+	Config     *Config          // 服务器配置
+	DB         DatabaseService  // 数据库连接和查询服务
+	Schemas    SchemaManager    // 已加载的 Schema 元数据
+	Extensions ExtensionManager // 扩展知识
+
+	server   *mcpserver.Server
+	tools    ToolRegistry
+	requests *requests.Tracker
+	plugin   string // 当前正在注册的插件
+}
+
+// NewHost 创建插件注册使用的 Host (由 handlers.RegisterHandlers 调用)
+func NewHost(mcpServer *mcpserver.Server, tools ToolRegistry, requestTracker *requests.Tracker, cfg *Config, dbService DatabaseService, schemaManager SchemaManager, extManager ExtensionManager) *Host {
+	return &Host{Config: cfg, DB: dbService, Schemas: schemaManager, Extensions: extManager, server: mcpServer, tools: tools, requests: requestTracker}
+}
+
+// ForPlugin 返回用于注册指定插件的 Host，错误信息中会带上插件名
+func (h *Host) ForPlugin(name string) *Host {
+	host := *h
+	host.plugin = name
+	return &host
+}
+
+// RegisterTool 注册一个工具，工具名已被占用时返回错误
+func (h *Host) RegisterTool(tool *protocol.Tool, handler ToolHandler) error {
+	if tool == nil || tool.Name == "" {
+		return fmt.Errorf("插件 '%s' 注册的工具缺少名称", h.plugin)
+	}
+	if h.tools.Has(tool.Name) {
+		return fmt.Errorf("插件 '%s' 的工具 '%s' 与已注册的工具重名", h.plugin, tool.Name)
+	}
+	h.tools.RegisterTool(tool, func(req *protocol.CallToolRequest) (*protocol.CallToolResult, error) {
+		return handler(h.requests.Context(req), req)
+	})
+	return nil
+}
+
+// Context 返回服务器的根 Context，服务器关闭时被取消 (资源和提示的 Handler 使用)
+func (h *Host) Context() context.Context {
+	return h.requests.Root()
+}
+
+// RegisterResource 注册一个静态资源
+func (h *Host) RegisterResource(resource *protocol.Resource, handler mcpserver.ResourceHandlerFunc) {
+	h.server.RegisterResource(resource, handler)
+}
+
+// RegisterResourceTemplate 注册一个资源模板
+func (h *Host) RegisterResourceTemplate(template *protocol.ResourceTemplate, handler mcpserver.ResourceHandlerFunc) error {
+	if err := h.server.RegisterResourceTemplate(template, handler); err != nil {
+		return fmt.Errorf("插件 '%s' 注册资源模板 '%s' 失败: %w", h.plugin, template.URITemplate, err)
+	}
+	return nil
+}
+
+// RegisterPrompt 注册一个提示
+func (h *Host) RegisterPrompt(prompt *protocol.Prompt, handler mcpserver.PromptHandlerFunc) {
+	h.server.RegisterPrompt(prompt, handler)
+}